@@ -0,0 +1,125 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ukane-philemon/megtask/webserver"
+)
+
+// Check that *LocalStore satisfies webserver.BlobStore.
+var _ webserver.BlobStore = (*LocalStore)(nil)
+
+// LocalStore implements webserver.BlobStore by saving blobs as files in a
+// directory. Keys are used as paths relative to the directory.
+type LocalStore struct {
+	dir string
+}
+
+// NewLocalStore returns a new instance of *LocalStore that saves blobs in
+// dir. The directory is created if it does not exist.
+func NewLocalStore(dir string) (*LocalStore, error) {
+	if dir == "" {
+		return nil, errors.New("missing blob store directory")
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("filepath.Abs error: %w", err)
+	}
+
+	err = os.MkdirAll(absDir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("os.MkdirAll error: %w", err)
+	}
+
+	return &LocalStore{dir: absDir}, nil
+}
+
+// PutBlob saves size bytes read from r as the file for key. The file is
+// written to a temporary file first so a failed upload never leaves a
+// partial blob.
+func (ls *LocalStore) PutBlob(_ context.Context, key string, r io.Reader, size int64, _ string) error {
+	path, err := ls.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return fmt.Errorf("os.MkdirAll error: %w", err)
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("os.CreateTemp error: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	n, err := io.Copy(tmpFile, io.LimitReader(r, size))
+	if err == nil && n != size {
+		err = fmt.Errorf("expected %d bytes, read %d", size, n)
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write blob %s: %w", key, err)
+	}
+
+	err = os.Rename(tmpFile.Name(), path)
+	if err != nil {
+		return fmt.Errorf("os.Rename error: %w", err)
+	}
+
+	return nil
+}
+
+// GetBlob opens the file for key.
+func (ls *LocalStore) GetBlob(_ context.Context, key string) (io.ReadCloser, error) {
+	path, err := ls.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, webserver.ErrBlobNotFound
+		}
+		return nil, fmt.Errorf("os.Open error: %w", err)
+	}
+
+	return file, nil
+}
+
+// DeleteBlob removes the file for key.
+func (ls *LocalStore) DeleteBlob(_ context.Context, key string) error {
+	path, err := ls.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("os.Remove error: %w", err)
+	}
+
+	return nil
+}
+
+// path returns the path of the file for key and ensures it is inside the
+// store's directory.
+func (ls *LocalStore) path(key string) (string, error) {
+	path := filepath.Join(ls.dir, filepath.FromSlash(key))
+	if key == "" || !strings.HasPrefix(path, ls.dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return path, nil
+}
@@ -0,0 +1,122 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ukane-philemon/megtask/webserver"
+)
+
+func TestLocalStoreKeys(t *testing.T) {
+	dir := t.TempDir()
+	ls, err := NewLocalStore(dir)
+	if err != nil {
+		t.Fatalf("NewLocalStore error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		key      string
+		wantPath string
+		wantErr  bool
+	}{
+		{"key", "attachments/1", filepath.Join(dir, "attachments", "1"), false},
+		{"empty key", "", "", true},
+		{"store directory", ".", "", true},
+		{"parent directory", "../outside", "", true},
+		{"escaping key", "attachments/../../outside", "", true},
+		{"sibling directory", "../" + filepath.Base(dir) + "-other/1", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ls.PutBlob(context.Background(), test.key, strings.NewReader("blob"), 4, "text/plain")
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("want error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PutBlob error: %v", err)
+			}
+
+			content, err := os.ReadFile(test.wantPath)
+			if err != nil {
+				t.Fatalf("os.ReadFile error: %v", err)
+			}
+			if string(content) != "blob" {
+				t.Fatalf("want blob content %q, got %q", "blob", content)
+			}
+		})
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	tests := []struct {
+		name string
+		// content is read by PutBlob, which is told the blob has size bytes.
+		content  string
+		size     int64
+		wantBlob string
+		wantErr  bool
+	}{
+		{"blob", "content", 7, "content", false},
+		{"reader longer than size", "content and more", 7, "content", false},
+		{"reader shorter than size", "short", 7, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			ls, err := NewLocalStore(dir)
+			if err != nil {
+				t.Fatalf("NewLocalStore error: %v", err)
+			}
+
+			ctx := context.Background()
+			err = ls.PutBlob(ctx, "attachments/1", strings.NewReader(test.content), test.size, "")
+			if test.wantErr != (err != nil) {
+				t.Fatalf("want error %v, got %v", test.wantErr, err)
+			}
+
+			// Failed uploads do not leave a partial blob or temporary file.
+			entries, _ := os.ReadDir(filepath.Join(dir, "attachments"))
+			if test.wantErr && len(entries) != 0 {
+				t.Fatalf("want no files after a failed upload, got %d", len(entries))
+			}
+
+			blob, err := ls.GetBlob(ctx, "attachments/1")
+			if test.wantErr {
+				if !errors.Is(err, webserver.ErrBlobNotFound) {
+					t.Fatalf("want ErrBlobNotFound, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetBlob error: %v", err)
+			}
+			content, _ := io.ReadAll(blob)
+			blob.Close()
+			if string(content) != test.wantBlob {
+				t.Fatalf("want blob %q, got %q", test.wantBlob, content)
+			}
+
+			if err := ls.DeleteBlob(ctx, "attachments/1"); err != nil {
+				t.Fatalf("DeleteBlob error: %v", err)
+			}
+			if _, err := ls.GetBlob(ctx, "attachments/1"); !errors.Is(err, webserver.ErrBlobNotFound) {
+				t.Fatalf("want ErrBlobNotFound after delete, got %v", err)
+			}
+			// Deleting a blob that does not exist is not an error.
+			if err := ls.DeleteBlob(ctx, "attachments/1"); err != nil {
+				t.Fatalf("DeleteBlob error for a deleted blob: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package blobstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ukane-philemon/megtask/webserver"
+)
+
+const (
+	// s3Service is the service name used to sign requests.
+	s3Service = "s3"
+	// unsignedPayload is used instead of the hash of the request body so
+	// uploads can be streamed.
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	// emptyPayloadHash is the hex encoded SHA-256 hash of an empty body.
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	amzDateFormat = "20060102T150405Z"
+	amzDayFormat  = "20060102"
+)
+
+// Check that *S3Store satisfies webserver.BlobStore.
+var _ webserver.BlobStore = (*S3Store)(nil)
+
+// S3Config is configuration for an S3 compatible object storage service.
+type S3Config struct {
+	// Endpoint is the URL of the service, e.g https://s3.us-east-1.amazonaws.com
+	// or http://localhost:9000 for a local MinIO server.
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// PathStyle addresses the bucket in the URL path instead of the host
+	// name. Most self-hosted services (e.g MinIO) require path style.
+	PathStyle bool
+	// HTTPClient is optional. Defaults to a client with a 5 minutes timeout.
+	HTTPClient *http.Client
+}
+
+// S3Store implements webserver.BlobStore using an S3 compatible object
+// storage service. Requests are signed with AWS Signature Version 4.
+type S3Store struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// NewS3Store returns a new instance of *S3Store.
+func NewS3Store(cfg *S3Config) (*S3Store, error) {
+	if cfg == nil || cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("s3 endpoint and bucket are required")
+	}
+
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("s3 access key ID and secret access key are required")
+	}
+
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", cfg.Endpoint)
+	}
+
+	s3Cfg := *cfg
+	if s3Cfg.Region == "" {
+		s3Cfg.Region = "us-east-1"
+	}
+
+	client := s3Cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Minute}
+	}
+
+	return &S3Store{
+		cfg:      s3Cfg,
+		endpoint: endpoint,
+		client:   client,
+	}, nil
+}
+
+// PutBlob uploads size bytes read from r as the object for key.
+func (s3 *S3Store) PutBlob(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	req, err := s3.newRequest(ctx, http.MethodPut, key, io.LimitReader(r, size))
+	if err != nil {
+		return err
+	}
+
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	res, err := s3.do(req, unsignedPayload)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	return nil
+}
+
+// GetBlob downloads the object for key.
+func (s3 *S3Store) GetBlob(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := s3.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s3.do(req, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body, nil
+}
+
+// DeleteBlob deletes the object for key.
+func (s3 *S3Store) DeleteBlob(ctx context.Context, key string) error {
+	req, err := s3.newRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := s3.do(req, emptyPayloadHash)
+	if err != nil {
+		if errors.Is(err, webserver.ErrBlobNotFound) {
+			return nil
+		}
+		return err
+	}
+	res.Body.Close()
+
+	return nil
+}
+
+// newRequest returns a request for the object with the provided key.
+func (s3 *S3Store) newRequest(ctx context.Context, method, key string, body io.Reader) (*http.Request, error) {
+	if key == "" {
+		return nil, errors.New("missing blob key")
+	}
+
+	objectURL := *s3.endpoint
+	escapedKey := escapePath(key)
+	if s3.cfg.PathStyle {
+		objectURL.Path = s3.endpoint.Path + "/" + s3.cfg.Bucket + "/" + key
+		objectURL.RawPath = s3.endpoint.Path + "/" + escapePath(s3.cfg.Bucket) + "/" + escapedKey
+	} else {
+		objectURL.Host = s3.cfg.Bucket + "." + s3.endpoint.Host
+		objectURL.Path = s3.endpoint.Path + "/" + key
+		objectURL.RawPath = s3.endpoint.Path + "/" + escapedKey
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, objectURL.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("http.NewRequestWithContext error: %w", err)
+	}
+
+	return req, nil
+}
+
+// do signs and sends req. Returns ErrBlobNotFound if the object does not
+// exist and an error for any other unsuccessful response.
+func (s3 *S3Store) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	s3.sign(req, payloadHash, time.Now().UTC())
+
+	res, err := s3.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s request error: %w", req.Method, err)
+	}
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, nil
+	}
+
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, webserver.ErrBlobNotFound
+	}
+
+	errBody, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return nil, fmt.Errorf("s3 %s request failed with status %d: %s", req.Method, res.StatusCode, strings.TrimSpace(string(errBody)))
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req.
+func (s3 *S3Store) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format(amzDateFormat)
+	day := now.Format(amzDayFormat)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// Sign the host, content type and all x-amz-* headers.
+	headerValues := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "content-type" {
+			headerValues[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+
+	headerNames := make([]string, 0, len(headerValues))
+	for name := range headerValues {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range headerNames {
+		canonicalHeaders.WriteString(name + ":" + headerValues[name] + "\n")
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + s3.cfg.Region + "/" + s3Service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+s3.cfg.SecretAccessKey), day)
+	signingKey = hmacSHA256(signingKey, s3.cfg.Region)
+	signingKey = hmacSHA256(signingKey, s3Service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3.cfg.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// escapePath escapes each segment of a slash separated path as required by
+// Signature Version 4.
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(url.QueryEscape(segment), "+", "%20")
+	}
+	return strings.Join(segments, "/")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
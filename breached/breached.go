@@ -0,0 +1,99 @@
+package breached
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ukane-philemon/megtask/webserver"
+)
+
+// prefixLength is the length of the SHA-1 hash prefix used to name range
+// files.
+const prefixLength = 5
+
+// Check that *Checker satisfies webserver.BreachedPasswordChecker.
+var _ webserver.BreachedPasswordChecker = (*Checker)(nil)
+
+// Checker implements webserver.BreachedPasswordChecker using a local copy of
+// a breached password list in the k-anonymity range format. The directory
+// contains one file per 5 character uppercase hex prefix of the SHA-1 hash of
+// a password (e.g "21BD1" or "21BD1.txt"). Each line of a file is the
+// remaining 35 characters of a hash and the number of times it has been seen,
+// separated by a colon (e.g "0018A45C4D1DEF81644B54AB7F969B88D65:10").
+// Passwords are checked without loading the list into memory.
+type Checker struct {
+	dir string
+}
+
+// NewChecker returns a new instance of *Checker for the range files in dir.
+func NewChecker(dir string) (*Checker, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("os.Stat error: %w", err)
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	return &Checker{dir: dir}, nil
+}
+
+// IsBreached returns true if password has appeared in a data breach.
+func (c *Checker) IsBreached(password string) (bool, error) {
+	hash := sha1.Sum([]byte(password))
+	hexHash := strings.ToUpper(hex.EncodeToString(hash[:]))
+	prefix, suffix := hexHash[:prefixLength], hexHash[prefixLength:]
+
+	file, err := c.openRangeFile(prefix)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		hashSuffix, countStr, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !strings.EqualFold(hashSuffix, suffix) {
+			continue
+		}
+
+		// Range files may be padded with entries that have a count of zero.
+		count, err := strconv.ParseInt(countStr, 10, 64)
+		return err != nil || count > 0, nil
+	}
+
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("failed to read range file %s: %w", prefix, err)
+	}
+
+	return false, nil
+}
+
+// openRangeFile opens the range file for prefix.
+func (c *Checker) openRangeFile(prefix string) (*os.File, error) {
+	var err error
+	for _, name := range []string{prefix, prefix + ".txt", strings.ToLower(prefix), strings.ToLower(prefix) + ".txt"} {
+		var file *os.File
+		file, err = os.Open(filepath.Join(c.dir, name))
+		if err == nil {
+			return file, nil
+		}
+
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("os.Open error: %w", err)
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,80 @@
+package breached
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsBreached(t *testing.T) {
+	// The SHA-1 hash of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8.
+	const (
+		prefix = "5BAA6"
+		suffix = "1E4C9B93F3F0682250B6CF8331B7EE68FD8"
+	)
+
+	tests := []struct {
+		name         string
+		fileName     string
+		contents     string
+		wantBreached bool
+	}{
+		{"listed", prefix, "0018A45C4D1DEF81644B54AB7F969B88D65:10\n" + suffix + ":3861493\n", true},
+		{"listed in a txt file", prefix + ".txt", suffix + ":1\n", true},
+		{"listed in a lowercase file", "5baa6.txt", suffix + ":1\n", true},
+		{"listed with a lowercase hash", prefix, "1e4c9b93f3f0682250b6cf8331b7ee68fd8:1\n", true},
+		{"listed with windows line endings", prefix, "0018A45C4D1DEF81644B54AB7F969B88D65:10\r\n" + suffix + ":1\r\n", true},
+		{"padding entry", prefix, suffix + ":0\n", false},
+		{"not listed", prefix, "0018A45C4D1DEF81644B54AB7F969B88D65:10\n", false},
+		{"no range file", "21BD1", suffix + ":1\n", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, test.fileName), []byte(test.contents), 0o600); err != nil {
+				t.Fatalf("os.WriteFile error: %v", err)
+			}
+
+			checker, err := NewChecker(dir)
+			if err != nil {
+				t.Fatalf("NewChecker error: %v", err)
+			}
+
+			breached, err := checker.IsBreached("password")
+			if err != nil {
+				t.Fatalf("IsBreached error: %v", err)
+			}
+			if breached != test.wantBreached {
+				t.Fatalf("want breached %v, got %v", test.wantBreached, breached)
+			}
+		})
+	}
+}
+
+func TestNewChecker(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatalf("os.WriteFile error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		dir     string
+		wantErr bool
+	}{
+		{"directory", dir, false},
+		{"missing directory", filepath.Join(dir, "missing"), true},
+		{"file", file, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewChecker(test.dir)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("want error %v, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package mongodb
+
+import (
+	"fmt"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Users returns a page of users sorted by creation time with their task
+// counts.
+func (mdb *MongoDB) Users(offset, limit int64) ([]*db.UserSummary, error) {
+	if offset < 0 || limit <= 0 {
+		return nil, fmt.Errorf("%w: invalid offset or limit", db.ErrorInvalidRequest)
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: createdAtKey, Value: 1}, {Key: dbIDKey, Value: 1}}).SetSkip(offset).SetLimit(limit)
+	cur, err := mdb.usersCollection.Find(mdb.ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("usersCollection.Find error: %w", err)
+	}
+
+	var dbUsers []*dbUser
+	err = cur.All(mdb.ctx, &dbUsers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode retrieved users: %w", err)
+	}
+
+	return mdb.userSummaries(dbUsers)
+}
+
+// UserSummary returns information about the user with the provided userID and
+// their task counts. Returns ErrorInvalidRequest if the user does not exist.
+func (mdb *MongoDB) UserSummary(userID string) (*db.UserSummary, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("%w: missing required argument", db.ErrorInvalidRequest)
+	}
+
+	user, err := mdb.user(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries, err := mdb.userSummaries([]*dbUser{user})
+	if err != nil {
+		return nil, err
+	}
+
+	return summaries[0], nil
+}
+
+// UserRole returns the current role of the user with the provided userID.
+// Returns ErrorInvalidRequest if the user does not exist or has been disabled.
+func (mdb *MongoDB) UserRole(userID string) (string, error) {
+	if userID == "" {
+		return "", fmt.Errorf("%w: missing required argument", db.ErrorInvalidRequest)
+	}
+
+	user, err := mdb.user(userID)
+	if err != nil {
+		return "", err
+	}
+
+	err = checkCanLogin(user)
+	if err != nil {
+		return "", err
+	}
+
+	return user.role(), nil
+}
+
+// SetUserDisabled disables or enables the account of the user with the
+// provided userID. Disabled users are logged out and cannot login or use
+// their api tokens. Returns ErrorInvalidRequest if the user does not exist.
+func (mdb *MongoDB) SetUserDisabled(userID string, disabled bool) error {
+	if userID == "" {
+		return fmt.Errorf("%w: missing required argument", db.ErrorInvalidRequest)
+	}
+
+	err := mdb.updateUser(userID, bson.M{disabledKey: disabled})
+	if err != nil || !disabled {
+		return err
+	}
+
+	return mdb.revokeUserSessions(userID, "")
+}
+
+// ForcePasswordReset logs out the user with the provided userID and requires
+// them to reset their password before they can login again. Returns the
+// user's information.
+// Returns ErrorInvalidRequest if the user does not exist.
+func (mdb *MongoDB) ForcePasswordReset(userID string) (*db.UserSummary, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("%w: missing required argument", db.ErrorInvalidRequest)
+	}
+
+	err := mdb.updateUser(userID, bson.M{mustResetPasswordKey: true})
+	if err != nil {
+		return nil, err
+	}
+
+	err = mdb.revokeUserSessions(userID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return mdb.UserSummary(userID)
+}
+
+// SetUserRole sets the role of the user with the provided username. It is
+// used to promote the first admin, who can then manage other users.
+func (mdb *MongoDB) SetUserRole(username, role string) error {
+	if username == "" || (role != db.RoleUser && role != db.RoleAdmin) {
+		return fmt.Errorf("%w: missing username or invalid role", db.ErrorInvalidRequest)
+	}
+
+	res, err := mdb.usersCollection.UpdateOne(mdb.ctx, bson.M{usernameKey: username}, bson.M{"$set": bson.M{roleKey: role}})
+	if err != nil {
+		return fmt.Errorf("usersCollection.UpdateOne error: %w", err)
+	}
+
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("%w: user does not exist", db.ErrorInvalidRequest)
+	}
+
+	return nil
+}
+
+// updateUser sets the provided fields for the user with the provided userID.
+func (mdb *MongoDB) updateUser(userID string, fields bson.M) error {
+	user, err := mdb.user(userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = mdb.usersCollection.UpdateByID(mdb.ctx, user.ID, bson.M{"$set": fields})
+	if err != nil {
+		return fmt.Errorf("usersCollection.UpdateByID error: %w", err)
+	}
+
+	return nil
+}
+
+// userSummaries returns the summaries of users with their task counts.
+func (mdb *MongoDB) userSummaries(users []*dbUser) ([]*db.UserSummary, error) {
+	userIDs := make([]string, 0, len(users))
+	for _, user := range users {
+		userIDs = append(userIDs, user.ID.Hex())
+	}
+
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{ownerIDKey: bson.M{"$in": userIDs}}},
+		bson.M{"$group": bson.M{
+			dbIDKey:     "$" + ownerIDKey,
+			"total":     bson.M{"$sum": 1},
+			"completed": bson.M{"$sum": bson.M{"$cond": bson.A{"$" + completedKey, 1, 0}}},
+		}},
+	}
+	cur, err := mdb.tasksCollection.Aggregate(mdb.ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("tasksCollection.Aggregate error: %w", err)
+	}
+
+	var taskCounts []struct {
+		OwnerID   string `bson:"_id"`
+		Total     int64  `bson:"total"`
+		Completed int64  `bson:"completed"`
+	}
+	err = cur.All(mdb.ctx, &taskCounts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode task counts: %w", err)
+	}
+
+	summaries := make(map[string]*db.UserSummary, len(users))
+	userSummaries := make([]*db.UserSummary, 0, len(users))
+	for _, user := range users {
+		summary := &db.UserSummary{
+			ID:                user.ID.Hex(),
+			Username:          user.Username,
+			Email:             user.Email,
+			Role:              user.role(),
+			Disabled:          user.Disabled,
+			MustResetPassword: user.MustResetPassword,
+			TwoFactorEnabled:  user.TOTPEnabled,
+			CreatedAt:         user.CreatedAt,
+		}
+		summaries[summary.ID] = summary
+		userSummaries = append(userSummaries, summary)
+	}
+
+	for _, count := range taskCounts {
+		if summary, found := summaries[count.OwnerID]; found {
+			summary.TaskCount = count.Total
+			summary.CompletedTaskCount = count.Completed
+		}
+	}
+
+	return userSummaries, nil
+}
@@ -0,0 +1,111 @@
+package mongodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSetUserDisabled(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name string
+		// userID is the ID of user, or of the user to update if user is nil.
+		userID   string
+		user     *dbUser
+		disabled bool
+		// wantRevoked is true if the user's sessions are revoked.
+		wantRevoked bool
+		wantErr     bool
+	}{
+		{"missing user", primitive.NewObjectID().Hex(), nil, true, false, true},
+		{"invalid user ID", "user", nil, true, false, true},
+		{"disable", "", &dbUser{ID: primitive.NewObjectID()}, true, true, false},
+		{"enable", "", &dbUser{ID: primitive.NewObjectID(), Disabled: true}, false, false, false},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			userID := test.userID
+			if test.user == nil {
+				mt.AddMockResponses(mockFound(mt, usersCollection))
+			} else {
+				userID = test.user.ID.Hex()
+				mt.AddMockResponses(mockFound(mt, usersCollection, test.user), mockWritten(1), mockWritten(1))
+			}
+
+			err := newMockMongoDB(mt).SetUserDisabled(userID, test.disabled)
+			if test.wantErr {
+				if !errors.Is(err, db.ErrorInvalidRequest) {
+					mt.Fatalf("want ErrorInvalidRequest, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				mt.Fatalf("SetUserDisabled error: %v", err)
+			}
+
+			update := sentCommand(mt, "update", usersCollection).Lookup("updates").Array().Index(0).Value().Document()
+			if disabled := update.Lookup("u", "$set", disabledKey).Boolean(); disabled != test.disabled {
+				mt.Fatalf("want disabled %v, got %v", test.disabled, disabled)
+			}
+
+			deleted := sentCommand(mt, "delete", sessionsCollection)
+			if (deleted != nil) != test.wantRevoked {
+				mt.Fatalf("want sessions revoked %v", test.wantRevoked)
+			}
+		})
+	}
+}
+
+func TestUsersTaskCounts(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	withTasks := &dbUser{ID: primitive.NewObjectID(), Username: "tasks"}
+	withoutTasks := &dbUser{ID: primitive.NewObjectID(), Username: "no-tasks"}
+
+	tests := []struct {
+		name          string
+		users         []any
+		counts        []bson.D
+		wantTotal     []int64
+		wantCompleted []int64
+	}{
+		{"no users", nil, nil, nil, nil},
+		{
+			"users with and without tasks",
+			[]any{withTasks, withoutTasks},
+			[]bson.D{{{Key: "_id", Value: withTasks.ID.Hex()}, {Key: "total", Value: int64(3)}, {Key: "completed", Value: int64(1)}}},
+			[]int64{3, 0},
+			[]int64{1, 0},
+		},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			mt.AddMockResponses(
+				mockFound(mt, usersCollection, test.users...),
+				mtest.CreateCursorResponse(0, taskDB+"."+taskCollection, mtest.FirstBatch, test.counts...),
+			)
+
+			users, err := newMockMongoDB(mt).Users(0, 10)
+			if err != nil {
+				mt.Fatalf("Users error: %v", err)
+			}
+			if len(users) != len(test.users) {
+				mt.Fatalf("want %d users, got %d", len(test.users), len(users))
+			}
+			for i, user := range users {
+				if user.TaskCount != test.wantTotal[i] || user.CompletedTaskCount != test.wantCompleted[i] {
+					mt.Fatalf("want %s to have %d tasks with %d completed, got %d with %d", user.Username,
+						test.wantTotal[i], test.wantCompleted[i], user.TaskCount, user.CompletedTaskCount)
+				}
+			}
+		})
+	}
+}
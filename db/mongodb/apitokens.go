@@ -0,0 +1,173 @@
+package mongodb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateAPIToken saves a new personal access token for the user with the
+// provided userID. The token expires after the provided duration or never
+// expires if expiry is zero.
+func (mdb *MongoDB) CreateAPIToken(userID, name, token string, scopes []string, expiry time.Duration) (*db.APIToken, error) {
+	if userID == "" || name == "" || token == "" || len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	apiToken := &dbAPIToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Name:      name,
+		Scopes:    scopes,
+		TokenHash: hashToken(token),
+		CreatedAt: time.Now().Unix(),
+	}
+
+	if expiry > 0 {
+		expiresAt := time.Now().Add(expiry)
+		apiToken.ExpiresAt = &expiresAt
+	}
+
+	_, err := mdb.apiTokensCollection.InsertOne(mdb.ctx, apiToken)
+	if err != nil {
+		return nil, fmt.Errorf("apiTokensCollection.InsertOne error: %w", err)
+	}
+
+	return apiToken.info(), nil
+}
+
+// APITokens returns all the unexpired personal access tokens created by the
+// user with the provided userID.
+func (mdb *MongoDB) APITokens(userID string) ([]*db.APIToken, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("%w: missing required argument", db.ErrorInvalidRequest)
+	}
+
+	filter := bson.M{
+		userIDKey: userID,
+		"$or": bson.A{
+			bson.M{expiresAtKey: bson.M{"$exists": false}},
+			bson.M{expiresAtKey: bson.M{"$gt": time.Now()}},
+		},
+	}
+	cur, err := mdb.apiTokensCollection.Find(mdb.ctx, filter, options.Find().SetSort(bson.M{dbIDKey: -1}))
+	if err != nil {
+		return nil, fmt.Errorf("apiTokensCollection.Find error: %w", err)
+	}
+
+	var dbAPITokens []*dbAPIToken
+	err = cur.All(mdb.ctx, &dbAPITokens)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode retrieved api tokens: %w", err)
+	}
+
+	apiTokens := make([]*db.APIToken, 0, len(dbAPITokens))
+	for _, apiToken := range dbAPITokens {
+		apiTokens = append(apiTokens, apiToken.info())
+	}
+
+	return apiTokens, nil
+}
+
+// RevokeAPIToken deletes a personal access token created by the user with the
+// provided userID. If no token match the provided tokenID, an
+// ErrorInvalidRequest is returned.
+func (mdb *MongoDB) RevokeAPIToken(userID, tokenID string) error {
+	if userID == "" || tokenID == "" {
+		return fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	tokenDBID, err := primitive.ObjectIDFromHex(tokenID)
+	if err != nil {
+		return fmt.Errorf("%w: invalid token ID", db.ErrorInvalidRequest)
+	}
+
+	res, err := mdb.apiTokensCollection.DeleteOne(mdb.ctx, bson.M{dbIDKey: tokenDBID, userIDKey: userID})
+	if err != nil {
+		return fmt.Errorf("apiTokensCollection.DeleteOne error: %w", err)
+	}
+
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("%w: api token does not exist", db.ErrorInvalidRequest)
+	}
+
+	return nil
+}
+
+// revokeUserAPITokens revokes all the api tokens of the user with the provided
+// userID.
+func (mdb *MongoDB) revokeUserAPITokens(userID string) error {
+	_, err := mdb.apiTokensCollection.DeleteMany(mdb.ctx, bson.M{userIDKey: userID})
+	if err != nil {
+		return fmt.Errorf("apiTokensCollection.DeleteMany error: %w", err)
+	}
+	return nil
+}
+
+// APITokenOwner checks that the provided personal access token is valid and
+// returns the ID of the user that created it and the token's scopes. Returns
+// ErrorInvalidRequest if the token does not exist or has expired, or if its
+// user is disabled or must reset their password.
+func (mdb *MongoDB) APITokenOwner(token string) (string, []string, error) {
+	if token == "" {
+		return "", nil, fmt.Errorf("%w: missing required argument", db.ErrorInvalidRequest)
+	}
+
+	filter := bson.M{tokenHashKey: hashToken(token)}
+	update := bson.M{"$set": bson.M{lastUsedAtKey: time.Now().Unix()}}
+
+	var apiToken *dbAPIToken
+	err := mdb.apiTokensCollection.FindOneAndUpdate(mdb.ctx, filter, update).Decode(&apiToken)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", nil, fmt.Errorf("%w: invalid api token", db.ErrorInvalidRequest)
+		}
+		return "", nil, fmt.Errorf("apiTokensCollection.FindOneAndUpdate error: %w", err)
+	}
+
+	// Expired tokens are removed periodically by the database, so they may
+	// still exist for a short while after expiry.
+	if apiToken.ExpiresAt != nil && apiToken.ExpiresAt.Before(time.Now()) {
+		return "", nil, fmt.Errorf("%w: api token has expired", db.ErrorInvalidRequest)
+	}
+
+	user, err := mdb.user(apiToken.UserID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = checkCanLogin(user)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = checkNoPasswordReset(user)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return apiToken.UserID, apiToken.Scopes, nil
+}
+
+// info returns the public information of a personal access token.
+func (t *dbAPIToken) info() *db.APIToken {
+	var expiresAt int64
+	if t.ExpiresAt != nil {
+		expiresAt = t.ExpiresAt.Unix()
+	}
+
+	return &db.APIToken{
+		ID:         t.ID.Hex(),
+		Name:       t.Name,
+		Scopes:     t.Scopes,
+		ExpiresAt:  expiresAt,
+		CreatedAt:  t.CreatedAt,
+		LastUsedAt: t.LastUsedAt,
+	}
+}
@@ -0,0 +1,107 @@
+package mongodb
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCreateAPIToken(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	const token = "megtask_token"
+
+	tests := []struct {
+		name        string
+		expiry      time.Duration
+		wantExpires bool
+	}{
+		{"never expires", 0, false},
+		{"expires", time.Hour, true},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+			apiToken, err := newMockMongoDB(mt).CreateAPIToken("user", "ci", token, []string{"tasks:read"}, test.expiry)
+			if err != nil {
+				mt.Fatalf("CreateAPIToken error: %v", err)
+			}
+			if (apiToken.ExpiresAt != 0) != test.wantExpires {
+				mt.Fatalf("want expires %v, got expiry %d", test.wantExpires, apiToken.ExpiresAt)
+			}
+
+			// Only the hash of the token is stored.
+			doc := sentCommand(mt, "insert", apiTokensCollection).Lookup("documents").Array().Index(0).Value().Document()
+			if tokenHash := doc.Lookup(tokenHashKey).StringValue(); tokenHash != hashToken(token) {
+				mt.Fatalf("want token hash %s, got %s", hashToken(token), tokenHash)
+			}
+			if _, err := doc.LookupErr(expiresAtKey); (err == nil) != test.wantExpires {
+				mt.Fatalf("want expiry stored %v", test.wantExpires)
+			}
+		})
+	}
+}
+
+func TestAPITokenOwner(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	const token = "megtask_token"
+	userID := primitive.NewObjectID()
+	expired := time.Now().Add(-time.Minute)
+	expires := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name string
+		// apiToken is the token with the hash of token, if any.
+		apiToken *dbAPIToken
+		// user is the owner of apiToken, if it is looked up.
+		user    *dbUser
+		wantErr bool
+	}{
+		{"unknown token", nil, nil, true},
+		{"expired token", &dbAPIToken{ID: primitive.NewObjectID(), UserID: userID.Hex(), ExpiresAt: &expired}, nil, true},
+		{"disabled owner", &dbAPIToken{ID: primitive.NewObjectID(), UserID: userID.Hex()}, &dbUser{ID: userID, Disabled: true}, true},
+		{"owner must reset password", &dbAPIToken{ID: primitive.NewObjectID(), UserID: userID.Hex()}, &dbUser{ID: userID, MustResetPassword: true}, true},
+		{"token without expiry", &dbAPIToken{ID: primitive.NewObjectID(), UserID: userID.Hex(), Scopes: []string{"tasks:read"}}, &dbUser{ID: userID}, false},
+		{"unexpired token", &dbAPIToken{ID: primitive.NewObjectID(), UserID: userID.Hex(), Scopes: []string{"tasks:read"}, ExpiresAt: &expires}, &dbUser{ID: userID}, false},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			if test.apiToken == nil {
+				mt.AddMockResponses(mockFoundAndModified(mt, nil))
+			} else {
+				mt.AddMockResponses(mockFoundAndModified(mt, test.apiToken))
+			}
+			if test.user != nil {
+				mt.AddMockResponses(mockFound(mt, usersCollection, test.user))
+			}
+
+			owner, scopes, err := newMockMongoDB(mt).APITokenOwner(token)
+			if test.wantErr {
+				if !errors.Is(err, db.ErrorInvalidRequest) {
+					mt.Fatalf("want ErrorInvalidRequest, got %v", err)
+				}
+			} else {
+				if err != nil {
+					mt.Fatalf("APITokenOwner error: %v", err)
+				}
+				if owner != userID.Hex() || len(scopes) != len(test.apiToken.Scopes) {
+					mt.Fatalf("want owner %s with scopes %v, got %s with %v", userID.Hex(), test.apiToken.Scopes, owner, scopes)
+				}
+			}
+
+			// Tokens are looked up by their hash.
+			query := sentCommand(mt, "findAndModify", apiTokensCollection).Lookup("query", tokenHashKey).StringValue()
+			if query != hashToken(token) {
+				mt.Fatalf("want token looked up by hash %s, got %s", hashToken(token), query)
+			}
+		})
+	}
+}
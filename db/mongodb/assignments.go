@@ -0,0 +1,179 @@
+package mongodb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AssignTask assigns the task with the provided taskID to the user with the
+// provided assigneeID, or removes the task's assignee if assigneeID is empty.
+// The user with the provided userID must be able to edit the task and the
+// assignee must have access to it. The change is recorded in the task's
+// history. Returns the list of tasks the task belongs to for the user.
+func (mdb *MongoDB) AssignTask(userID, taskID, assigneeID string) ([]*db.Task, error) {
+	if userID == "" || taskID == "" {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	task, permission, err := mdb.taskWithPermission(userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	if permission == db.PermissionRead {
+		return nil, fmt.Errorf("%w: you do not have permission to assign this task", db.ErrorInvalidRequest)
+	}
+
+	if assigneeID == task.AssigneeID {
+		if assigneeID == "" {
+			return nil, fmt.Errorf("%w: task is not assigned", db.ErrorInvalidRequest)
+		}
+		return nil, fmt.Errorf("%w: task is already assigned to this user", db.ErrorInvalidRequest)
+	}
+
+	action := db.TaskActionUnassigned
+	update := bson.M{
+		"$unset": bson.M{assigneeIDKey: ""},
+		"$set":   bson.M{updatedAtKey: time.Now().UnixMilli()},
+	}
+	if assigneeID != "" {
+		assigneePermission, err := mdb.taskPermission(assigneeID, task)
+		if err != nil {
+			return nil, err
+		}
+
+		if assigneePermission == "" {
+			return nil, fmt.Errorf("%w: the assignee does not have access to this task", db.ErrorInvalidRequest)
+		}
+
+		action = db.TaskActionAssigned
+		update = bson.M{"$set": bson.M{assigneeIDKey: assigneeID, updatedAtKey: time.Now().UnixMilli()}}
+	}
+
+	// Only update the task if its assignee has not changed since it was
+	// retrieved so the recorded history is accurate.
+	filter := bson.M{dbIDKey: task.ID, assigneeIDKey: task.AssigneeID}
+	if task.AssigneeID == "" {
+		filter[assigneeIDKey] = bson.M{"$exists": false}
+	}
+
+	res, err := mdb.tasksCollection.UpdateOne(mdb.ctx, filter, update)
+	if err != nil {
+		return nil, fmt.Errorf("tasksCollection.UpdateOne error: %w", err)
+	}
+
+	if res.MatchedCount == 0 {
+		return nil, fmt.Errorf("%w: the task's assignee was changed by someone else, please try again", db.ErrorInvalidRequest)
+	}
+
+	err = mdb.recordTaskHistory(&dbTaskHistoryEntry{
+		TaskID:             taskID,
+		ActorID:            userID,
+		Action:             action,
+		AssigneeID:         assigneeID,
+		PreviousAssigneeID: task.AssigneeID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return mdb.tasksAfterChange(userID, task, permission)
+}
+
+// AssignedTasks returns the tasks assigned to the user with the provided
+// userID that the user can still access. Only tasks with the provided
+// completed status are returned if completed is not nil.
+func (mdb *MongoDB) AssignedTasks(userID string, completed *bool) ([]*db.Task, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("%w: missing required argument", db.ErrorInvalidRequest)
+	}
+
+	filter := bson.M{assigneeIDKey: userID}
+	if completed != nil {
+		filter[completedKey] = *completed
+	}
+
+	dbTasks, err := mdb.findTasks(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]*db.Task, 0, len(dbTasks))
+	for _, dbTask := range dbTasks {
+		// The assignee may have lost access to the task since it was
+		// assigned.
+		permission, err := mdb.taskPermission(userID, dbTask)
+		if err != nil {
+			return nil, err
+		}
+
+		if permission == "" {
+			continue
+		}
+
+		task := dbTask.info()
+		task.OwnerID = dbTask.OwnerID
+		task.Permission = permission
+		tasks = append(tasks, task)
+	}
+
+	return mdb.prepareTasks(tasks)
+}
+
+// TaskHistory returns the changes made to the task with the provided taskID,
+// oldest first. The user with the provided userID must have access to the
+// task.
+func (mdb *MongoDB) TaskHistory(userID, taskID string) ([]*db.TaskHistoryEntry, error) {
+	if userID == "" || taskID == "" {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	_, _, err := mdb.taskWithPermission(userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := mdb.taskHistoryCollection.Find(mdb.ctx, bson.M{taskIDKey: taskID}, options.Find().SetSort(bson.M{timestampKey: 1}))
+	if err != nil {
+		return nil, fmt.Errorf("taskHistoryCollection.Find error: %w", err)
+	}
+
+	var dbEntries []*dbTaskHistoryEntry
+	err = cur.All(mdb.ctx, &dbEntries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode retrieved task history: %w", err)
+	}
+
+	entries := make([]*db.TaskHistoryEntry, 0, len(dbEntries))
+	for _, entry := range dbEntries {
+		entries = append(entries, &db.TaskHistoryEntry{
+			ID:                 entry.ID.Hex(),
+			TaskID:             entry.TaskID,
+			ActorID:            entry.ActorID,
+			Action:             entry.Action,
+			AssigneeID:         entry.AssigneeID,
+			PreviousAssigneeID: entry.PreviousAssigneeID,
+			Timestamp:          entry.Timestamp,
+		})
+	}
+
+	return entries, nil
+}
+
+// recordTaskHistory saves a change made to a task.
+func (mdb *MongoDB) recordTaskHistory(entry *dbTaskHistoryEntry) error {
+	entry.ID = primitive.NewObjectID()
+	entry.Timestamp = time.Now().Unix()
+
+	_, err := mdb.taskHistoryCollection.InsertOne(mdb.ctx, entry)
+	if err != nil {
+		return fmt.Errorf("taskHistoryCollection.InsertOne error: %w", err)
+	}
+
+	return nil
+}
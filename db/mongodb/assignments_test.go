@@ -0,0 +1,136 @@
+package mongodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestAssignTask(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	const workspaceID = "workspace"
+	userID := primitive.NewObjectID().Hex()
+
+	tests := []struct {
+		name string
+		// assignee is the current assignee of the task.
+		assignee   string
+		permission string
+		assigneeID string
+		// assigneeRole is the workspace role of the new assignee, if any.
+		assigneeRole string
+		// matched is the number of tasks matched by the update, or -1 if the
+		// task is not updated.
+		matched    int
+		wantAction string
+		wantErr    bool
+	}{
+		{name: "viewer assigns", permission: db.PermissionRead, assigneeID: "member", assigneeRole: db.WorkspaceRoleMember, matched: -1, wantErr: true},
+		{name: "assign", permission: db.PermissionEdit, assigneeID: "member", assigneeRole: db.WorkspaceRoleMember, matched: 1, wantAction: db.TaskActionAssigned},
+		{name: "assign to a viewer", permission: db.PermissionEdit, assigneeID: "viewer", assigneeRole: db.WorkspaceRoleViewer, matched: 1, wantAction: db.TaskActionAssigned},
+		{name: "reassign", assignee: "old", permission: db.PermissionEdit, assigneeID: "member", assigneeRole: db.WorkspaceRoleMember, matched: 1, wantAction: db.TaskActionAssigned},
+		{name: "assign to the current assignee", assignee: "member", permission: db.PermissionEdit, assigneeID: "member", matched: -1, wantErr: true},
+		{name: "assign to a non-member", permission: db.PermissionEdit, assigneeID: "stranger", matched: -1, wantErr: true},
+		{name: "unassign", assignee: "member", permission: db.PermissionEdit, matched: 1, wantAction: db.TaskActionUnassigned},
+		{name: "unassign an unassigned task", permission: db.PermissionEdit, matched: -1, wantErr: true},
+		{name: "assignee changed concurrently", permission: db.PermissionEdit, assigneeID: "member", assigneeRole: db.WorkspaceRoleMember, matched: 0, wantErr: true},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			task := &dbTask{ID: primitive.NewObjectID(), OwnerID: "owner", WorkspaceID: workspaceID, AssigneeID: test.assignee}
+			mt.AddMockResponses(mockTaskPermission(mt, task, userID, test.permission)...)
+			if test.assigneeID != "" && test.assigneeID != test.assignee {
+				if test.assigneeRole == "" {
+					mt.AddMockResponses(mockFound(mt, membersCollection))
+				} else {
+					member := &dbWorkspaceMember{ID: primitive.NewObjectID(), WorkspaceID: workspaceID, UserID: test.assigneeID, Role: test.assigneeRole}
+					mt.AddMockResponses(mockFound(mt, membersCollection, member))
+				}
+			}
+			if test.matched >= 0 {
+				mt.AddMockResponses(mockWritten(test.matched), mtest.CreateSuccessResponse(), mockFound(mt, taskCollection))
+			}
+
+			_, err := newMockMongoDB(mt).AssignTask(userID, task.ID.Hex(), test.assigneeID)
+			history := sentCommand(mt, "insert", taskHistoryCollection)
+			if test.wantErr {
+				if !errors.Is(err, db.ErrorInvalidRequest) {
+					mt.Fatalf("want ErrorInvalidRequest, got %v", err)
+				}
+				if history != nil {
+					mt.Fatal("want no history recorded")
+				}
+				if test.matched < 0 && sentCommand(mt, "update", taskCollection) != nil {
+					mt.Fatal("want task not updated")
+				}
+				return
+			}
+			if err != nil {
+				mt.Fatalf("AssignTask error: %v", err)
+			}
+
+			// The task is only updated if its assignee has not changed.
+			filter := sentCommand(mt, "update", taskCollection).Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+			if test.assignee == "" {
+				if _, err := filter.LookupErr(assigneeIDKey, "$exists"); err != nil {
+					mt.Fatalf("want unassigned task updated, got %v", filter)
+				}
+			} else if assignee := filter.Lookup(assigneeIDKey).StringValue(); assignee != test.assignee {
+				mt.Fatalf("want task assigned to %s updated, got %s", test.assignee, assignee)
+			}
+
+			var entry dbTaskHistoryEntry
+			raw := history.Lookup("documents").Array().Index(0).Value().Document()
+			if err := bson.Unmarshal(raw, &entry); err != nil {
+				mt.Fatalf("bson.Unmarshal error: %v", err)
+			}
+			if entry.Action != test.wantAction || entry.ActorID != userID || entry.AssigneeID != test.assigneeID || entry.PreviousAssigneeID != test.assignee {
+				mt.Fatalf("want %s by %s from %q to %q recorded, got %+v", test.wantAction, userID, test.assignee, test.assigneeID, entry)
+			}
+		})
+	}
+}
+
+func TestAssignedTasks(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	const userID = "user"
+
+	tests := []struct {
+		name string
+		// shared is true if the assigned personal task is still shared with
+		// the user.
+		shared    bool
+		wantTasks int
+	}{
+		{"assignee has access", true, 1},
+		{"assignee lost access", false, 0},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			task := &dbTask{ID: primitive.NewObjectID(), OwnerID: "owner", AssigneeID: userID}
+			mt.AddMockResponses(mockFound(mt, taskCollection, task))
+			if test.shared {
+				share := &dbShare{ID: primitive.NewObjectID(), OwnerID: "owner", TaskID: task.ID.Hex(), UserID: userID, Permission: db.PermissionRead}
+				mt.AddMockResponses(mockFound(mt, sharesCollection, share), mockFound(mt, commentsCollection))
+			} else {
+				mt.AddMockResponses(mockFound(mt, sharesCollection))
+			}
+
+			tasks, err := newMockMongoDB(mt).AssignedTasks(userID, nil)
+			if err != nil {
+				mt.Fatalf("AssignedTasks error: %v", err)
+			}
+			if len(tasks) != test.wantTasks {
+				mt.Fatalf("want %d tasks, got %d", test.wantTasks, len(tasks))
+			}
+		})
+	}
+}
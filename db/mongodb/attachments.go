@@ -0,0 +1,205 @@
+package mongodb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateAttachment saves information about a file attached to the task with
+// the provided taskID by the user with the provided userID. The user must be
+// able to edit the task and the total size of the files they have attached
+// must not exceed quota bytes. The content of the file is saved separately.
+func (mdb *MongoDB) CreateAttachment(userID, taskID, filename, contentType string, size, quota int64) (*db.Attachment, error) {
+	if userID == "" || taskID == "" || filename == "" || size <= 0 {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	_, permission, err := mdb.taskWithPermission(userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	if permission == db.PermissionRead {
+		return nil, fmt.Errorf("%w: you do not have permission to attach files to this task", db.ErrorInvalidRequest)
+	}
+
+	usage, err := mdb.attachmentUsage(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if usage+size > quota {
+		return nil, fmt.Errorf("%w: attachment storage quota exceeded, %d of %d bytes used", db.ErrorInvalidRequest, usage, quota)
+	}
+
+	attachment := &dbAttachment{
+		ID:          primitive.NewObjectID(),
+		TaskID:      taskID,
+		UploaderID:  userID,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        size,
+		CreatedAt:   time.Now().Unix(),
+	}
+
+	_, err = mdb.attachmentsCollection.InsertOne(mdb.ctx, attachment)
+	if err != nil {
+		return nil, fmt.Errorf("attachmentsCollection.InsertOne error: %w", err)
+	}
+
+	return attachment.info(), nil
+}
+
+// Attachments returns the files attached to the task with the provided
+// taskID, oldest first. The user with the provided userID must have access to
+// the task.
+func (mdb *MongoDB) Attachments(userID, taskID string) ([]*db.Attachment, error) {
+	if userID == "" || taskID == "" {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	_, _, err := mdb.taskWithPermission(userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := mdb.attachmentsCollection.Find(mdb.ctx, bson.M{taskIDKey: taskID}, options.Find().SetSort(bson.M{createdAtKey: 1}))
+	if err != nil {
+		return nil, fmt.Errorf("attachmentsCollection.Find error: %w", err)
+	}
+
+	var dbAttachments []*dbAttachment
+	err = cur.All(mdb.ctx, &dbAttachments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode retrieved attachments: %w", err)
+	}
+
+	attachments := make([]*db.Attachment, 0, len(dbAttachments))
+	for _, attachment := range dbAttachments {
+		attachments = append(attachments, attachment.info())
+	}
+
+	return attachments, nil
+}
+
+// Attachment returns information about a file attached to the task with the
+// provided taskID. The user with the provided userID must have access to the
+// task. Returns ErrorInvalidRequest if the attachment does not exist.
+func (mdb *MongoDB) Attachment(userID, taskID, attachmentID string) (*db.Attachment, error) {
+	if userID == "" || taskID == "" || attachmentID == "" {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	_, _, err := mdb.taskWithPermission(userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	attachment, err := mdb.attachment(taskID, attachmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return attachment.info(), nil
+}
+
+// DeleteAttachment deletes information about a file attached to the task
+// with the provided taskID. The user with the provided userID must be able to
+// edit the task. Returns ErrorInvalidRequest if the attachment does not
+// exist.
+func (mdb *MongoDB) DeleteAttachment(userID, taskID, attachmentID string) error {
+	if userID == "" || taskID == "" || attachmentID == "" {
+		return fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	_, permission, err := mdb.taskWithPermission(userID, taskID)
+	if err != nil {
+		return err
+	}
+
+	if permission == db.PermissionRead {
+		return fmt.Errorf("%w: you do not have permission to delete attachments of this task", db.ErrorInvalidRequest)
+	}
+
+	attachment, err := mdb.attachment(taskID, attachmentID)
+	if err != nil {
+		return err
+	}
+
+	_, err = mdb.attachmentsCollection.DeleteOne(mdb.ctx, bson.M{dbIDKey: attachment.ID})
+	if err != nil {
+		return fmt.Errorf("attachmentsCollection.DeleteOne error: %w", err)
+	}
+
+	return nil
+}
+
+// attachment returns a file attached to the task with the provided taskID.
+// Returns ErrorInvalidRequest if the attachment does not exist.
+func (mdb *MongoDB) attachment(taskID, attachmentID string) (*dbAttachment, error) {
+	attachmentDBID, err := primitive.ObjectIDFromHex(attachmentID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid attachment ID", db.ErrorInvalidRequest)
+	}
+
+	var attachment *dbAttachment
+	err = mdb.attachmentsCollection.FindOne(mdb.ctx, bson.M{dbIDKey: attachmentDBID, taskIDKey: taskID}).Decode(&attachment)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("%w: attachment does not exist", db.ErrorInvalidRequest)
+		}
+		return nil, fmt.Errorf("attachmentsCollection.FindOne error: %w", err)
+	}
+
+	return attachment, nil
+}
+
+// attachmentUsage returns the total size in bytes of the files attached by
+// the user with the provided userID.
+func (mdb *MongoDB) attachmentUsage(userID string) (int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{uploaderIDKey: userID}}},
+		{{Key: "$group", Value: bson.M{
+			dbIDKey: nil,
+			"total": bson.M{"$sum": "$" + sizeKey},
+		}}},
+	}
+	cur, err := mdb.attachmentsCollection.Aggregate(mdb.ctx, pipeline)
+	if err != nil {
+		return 0, fmt.Errorf("attachmentsCollection.Aggregate error: %w", err)
+	}
+
+	var usage []struct {
+		Total int64 `bson:"total"`
+	}
+	err = cur.All(mdb.ctx, &usage)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode attachment usage: %w", err)
+	}
+
+	if len(usage) == 0 {
+		return 0, nil
+	}
+
+	return usage[0].Total, nil
+}
+
+// info returns the public information of an attachment.
+func (a *dbAttachment) info() *db.Attachment {
+	return &db.Attachment{
+		ID:          a.ID.Hex(),
+		TaskID:      a.TaskID,
+		UploaderID:  a.UploaderID,
+		Filename:    a.Filename,
+		ContentType: a.ContentType,
+		Size:        a.Size,
+		CreatedAt:   a.CreatedAt,
+	}
+}
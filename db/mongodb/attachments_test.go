@@ -0,0 +1,64 @@
+package mongodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCreateAttachmentQuota(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	const (
+		size  = 100
+		quota = 1000
+	)
+
+	userID := primitive.NewObjectID().Hex()
+	task := &dbTask{ID: primitive.NewObjectID(), OwnerID: "owner"}
+
+	tests := []struct {
+		name       string
+		permission string
+		// usage is the size of the files the user has already attached, or
+		// -1 if they have not attached any.
+		usage   int64
+		wantErr bool
+	}{
+		{"no attachments", db.PermissionEdit, -1, false},
+		{"quota not reached", db.PermissionEdit, quota - size - 1, false},
+		{"quota reached", db.PermissionEdit, quota - size, false},
+		{"quota exceeded", db.PermissionEdit, quota - size + 1, true},
+		{"read collaborator", db.PermissionRead, 0, true},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			mt.AddMockResponses(mockTaskPermission(mt, task, userID, test.permission)...)
+
+			var usage []any
+			if test.usage >= 0 {
+				usage = append(usage, bson.M{"_id": nil, "total": test.usage})
+			}
+			mt.AddMockResponses(mockFound(mt, attachmentsCollection, usage...), mockWritten(1))
+
+			attachment, err := newMockMongoDB(mt).CreateAttachment(userID, task.ID.Hex(), "notes.txt", "text/plain", size, quota)
+			if test.wantErr {
+				if !errors.Is(err, db.ErrorInvalidRequest) {
+					mt.Fatalf("want ErrorInvalidRequest, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				mt.Fatalf("unexpected error: %v", err)
+			}
+			if attachment.Size != size || attachment.ContentType != "text/plain" || attachment.UploaderID != userID {
+				mt.Fatalf("unexpected attachment: %+v", attachment)
+			}
+		})
+	}
+}
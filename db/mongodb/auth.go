@@ -1,19 +1,32 @@
 package mongodb
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/ukane-philemon/megtask/db"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// CreateAccount creates a new user with the provided username and password.
-// An ErrorInvalidRequest will be returned is the username already exists.
-func (mdb *MongoDB) CreateAccount(username, password string) error {
+const (
+	// passwordResetPurpose is the purpose of user tokens issued to reset a
+	// password.
+	passwordResetPurpose = "passwordReset"
+	// emailVerificationPurpose is the purpose of user tokens issued to verify
+	// an email address.
+	emailVerificationPurpose = "emailVerification"
+)
+
+// CreateAccount creates a new user with the provided username, password and
+// optional email. An ErrorInvalidRequest will be returned is the username or
+// email already exists.
+func (mdb *MongoDB) CreateAccount(username, password, email string) error {
 	if username == "" || password == "" {
 		return fmt.Errorf("%w: missing username or password", db.ErrorInvalidRequest)
 	}
@@ -24,7 +37,9 @@ func (mdb *MongoDB) CreateAccount(username, password string) error {
 	}
 
 	userInfo := &dbUser{
+		ID:        primitive.NewObjectID(),
 		Username:  username,
+		Email:     email,
 		Password:  string(passwordHash),
 		CreatedAt: time.Now().Unix(),
 	}
@@ -32,7 +47,7 @@ func (mdb *MongoDB) CreateAccount(username, password string) error {
 	_, err = mdb.usersCollection.InsertOne(mdb.ctx, userInfo)
 	if err != nil {
 		if mongo.IsDuplicateKeyError(err) {
-			return fmt.Errorf("%w: please try another username", db.ErrorInvalidRequest)
+			return fmt.Errorf("%w: please try another username or email", db.ErrorInvalidRequest)
 		}
 		return fmt.Errorf("usersCollection.InsertOne error: %w", err)
 	}
@@ -58,15 +73,319 @@ func (mdb *MongoDB) Login(username, password string) (*db.User, error) {
 		return nil, fmt.Errorf("%w: username or password is incorrect", db.ErrorInvalidRequest)
 	}
 
-	userID := dbUser.ID.Hex()
+	err = checkCanLogin(dbUser)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkNoPasswordReset(dbUser)
+	if err != nil {
+		return nil, err
+	}
+
+	return mdb.userInfo(dbUser), nil
+}
+
+// checkCanLogin returns an ErrorInvalidRequest if user cannot login.
+func checkCanLogin(user *dbUser) error {
+	if user.Disabled {
+		return fmt.Errorf("%w: this account has been disabled", db.ErrorInvalidRequest)
+	}
+	return nil
+}
+
+// checkNoPasswordReset returns an ErrorInvalidRequest if an admin has required
+// user to reset their password before logging in again.
+func checkNoPasswordReset(user *dbUser) error {
+	if user.MustResetPassword {
+		return fmt.Errorf("%w: a password reset is required, please reset your password", db.ErrorInvalidRequest)
+	}
+	return nil
+}
+
+// user returns the user with the provided userID. Returns ErrorInvalidRequest
+// if userID is invalid or the user does not exist.
+func (mdb *MongoDB) user(userID string) (*dbUser, error) {
+	userDBID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid user ID", db.ErrorInvalidRequest)
+	}
+
+	var user *dbUser
+	err = mdb.usersCollection.FindOne(mdb.ctx, bson.M{dbIDKey: userDBID}).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("%w: user does not exist", db.ErrorInvalidRequest)
+		}
+		return nil, fmt.Errorf("usersCollection.FindOne error: %w", err)
+	}
+
+	return user, nil
+}
+
+// userInfo returns the public information of a user and their tasks.
+func (mdb *MongoDB) userInfo(user *dbUser) *db.User {
+	userID := user.ID.Hex()
 	tasks, err := mdb.userTasks(userID, nil)
 	if err != nil {
 		mdb.log.Error("failed to retrieve user tasks: ", " error", err)
 	}
 
 	return &db.User{
-		ID:       userID,
-		Username: username,
-		Tasks:    tasks,
-	}, nil
+		ID:               userID,
+		Username:         user.Username,
+		Email:            user.Email,
+		Role:             user.role(),
+		EmailVerified:    user.EmailVerified,
+		TwoFactorEnabled: user.TOTPEnabled,
+		Tasks:            tasks,
+	}
+}
+
+// CreatePasswordResetToken saves a password reset token for the user with the
+// provided email and returns the user's username. The token expires after the
+// provided duration. Returns ErrorInvalidRequest if no user has the provided
+// email.
+func (mdb *MongoDB) CreatePasswordResetToken(email, token string, expiry time.Duration) (string, error) {
+	if email == "" || token == "" {
+		return "", fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	var user *dbUser
+	err := mdb.usersCollection.FindOne(mdb.ctx, bson.M{emailKey: email}).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", fmt.Errorf("%w: no account with the provided email", db.ErrorInvalidRequest)
+		}
+		return "", fmt.Errorf("usersCollection.FindOne error: %w", err)
+	}
+
+	// An unverified email may belong to someone else, e.g if it was
+	// mistyped, so it cannot be used to take over the account.
+	if !user.EmailVerified {
+		return "", fmt.Errorf("%w: the email has not been verified", db.ErrorInvalidRequest)
+	}
+
+	err = mdb.saveUserToken(user.ID.Hex(), passwordResetPurpose, token, expiry)
+	if err != nil {
+		return "", err
+	}
+
+	return user.Username, nil
+}
+
+// ResetPassword sets a new password for the user that owns the provided
+// password reset token, logs them out of all their login sessions and revokes
+// their api tokens. The token is consumed and cannot be reused. Returns
+// ErrorInvalidRequest if the token is invalid or has expired.
+func (mdb *MongoDB) ResetPassword(token, newPassword string) error {
+	if token == "" || newPassword == "" {
+		return fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	userID, err := mdb.consumeUserToken(passwordResetPurpose, token)
+	if err != nil {
+		return err
+	}
+
+	err = mdb.setPassword(userID, newPassword, "")
+	if err != nil {
+		return err
+	}
+
+	// Api tokens may have been created by whoever had access to the account
+	// before it was recovered.
+	return mdb.revokeUserAPITokens(userID)
+}
+
+// PasswordResetUsername returns the username of the user that owns the
+// provided password reset token without consuming the token. Returns
+// ErrorInvalidRequest if the token is invalid or has expired.
+func (mdb *MongoDB) PasswordResetUsername(token string) (string, error) {
+	if token == "" {
+		return "", fmt.Errorf("%w: missing required argument", db.ErrorInvalidRequest)
+	}
+
+	filter := bson.M{
+		tokenHashKey: hashToken(token),
+		purposeKey:   passwordResetPurpose,
+		expiresAtKey: bson.M{"$gt": time.Now()},
+	}
+
+	var userToken *dbUserToken
+	err := mdb.userTokensCollection.FindOne(mdb.ctx, filter).Decode(&userToken)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", fmt.Errorf("%w: invalid or expired token", db.ErrorInvalidRequest)
+		}
+		return "", fmt.Errorf("userTokensCollection.FindOne error: %w", err)
+	}
+
+	user, err := mdb.user(userToken.UserID)
+	if err != nil {
+		return "", err
+	}
+
+	return user.Username, nil
+}
+
+// ChangePassword sets a new password for the user with the provided userID if
+// currentPassword is correct, and revokes all their login sessions except the
+// session with the provided keepSessionID. Returns ErrorInvalidRequest if
+// currentPassword is incorrect.
+func (mdb *MongoDB) ChangePassword(userID, currentPassword, newPassword, keepSessionID string) error {
+	if userID == "" || currentPassword == "" || newPassword == "" {
+		return fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	user, err := mdb.user(userID)
+	if err != nil {
+		return err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(currentPassword))
+	if err != nil {
+		return fmt.Errorf("%w: current password is incorrect", db.ErrorInvalidRequest)
+	}
+
+	return mdb.setPassword(userID, newPassword, keepSessionID)
+}
+
+// CreateEmailVerificationToken saves an email verification token for the user
+// with the provided email and returns the user's username. The token expires
+// after the provided duration. Returns ErrorInvalidRequest if no user has the
+// provided email or the email has already been verified.
+func (mdb *MongoDB) CreateEmailVerificationToken(email, token string, expiry time.Duration) (string, error) {
+	if email == "" || token == "" {
+		return "", fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	var user *dbUser
+	err := mdb.usersCollection.FindOne(mdb.ctx, bson.M{emailKey: email}).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", fmt.Errorf("%w: no account with the provided email", db.ErrorInvalidRequest)
+		}
+		return "", fmt.Errorf("usersCollection.FindOne error: %w", err)
+	}
+
+	if user.EmailVerified {
+		return "", fmt.Errorf("%w: email has already been verified", db.ErrorInvalidRequest)
+	}
+
+	err = mdb.saveUserToken(user.ID.Hex(), emailVerificationPurpose, token, expiry)
+	if err != nil {
+		return "", err
+	}
+
+	return user.Username, nil
+}
+
+// VerifyEmail marks the email of the user that owns the provided email
+// verification token as verified. The token is consumed and cannot be
+// reused. Returns ErrorInvalidRequest if the token is invalid or has expired.
+func (mdb *MongoDB) VerifyEmail(token string) error {
+	if token == "" {
+		return fmt.Errorf("%w: missing required argument", db.ErrorInvalidRequest)
+	}
+
+	userID, err := mdb.consumeUserToken(emailVerificationPurpose, token)
+	if err != nil {
+		return err
+	}
+
+	userDBID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return fmt.Errorf("primitive.ObjectIDFromHex error: %w", err)
+	}
+
+	res, err := mdb.usersCollection.UpdateByID(mdb.ctx, userDBID, bson.M{"$set": bson.M{emailVerifiedKey: true}})
+	if err != nil {
+		return fmt.Errorf("usersCollection.UpdateByID error: %w", err)
+	}
+
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("%w: user does not exist", db.ErrorInvalidRequest)
+	}
+
+	return nil
+}
+
+// setPassword hashes and saves a new password for the user with the provided
+// userID and revokes all their login sessions except the session with the
+// optional keepSessionID.
+func (mdb *MongoDB) setPassword(userID, newPassword, keepSessionID string) error {
+	userDBID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return fmt.Errorf("primitive.ObjectIDFromHex error: %w", err)
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("bcrypt.GenerateFromPassword error: %w", err)
+	}
+
+	update := bson.M{"$set": bson.M{
+		passwordKey:          string(passwordHash),
+		mustResetPasswordKey: false,
+	}}
+	res, err := mdb.usersCollection.UpdateByID(mdb.ctx, userDBID, update)
+	if err != nil {
+		return fmt.Errorf("usersCollection.UpdateByID error: %w", err)
+	}
+
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("%w: user does not exist", db.ErrorInvalidRequest)
+	}
+
+	// Logout everywhere else after a password change.
+	return mdb.revokeUserSessions(userID, keepSessionID)
+}
+
+// saveUserToken saves the hash of a single-use token issued to the user with
+// the provided userID.
+func (mdb *MongoDB) saveUserToken(userID, purpose, token string, expiry time.Duration) error {
+	userToken := &dbUserToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(expiry),
+	}
+
+	_, err := mdb.userTokensCollection.InsertOne(mdb.ctx, userToken)
+	if err != nil {
+		return fmt.Errorf("userTokensCollection.InsertOne error: %w", err)
+	}
+
+	return nil
+}
+
+// consumeUserToken deletes an unexpired token issued for the provided purpose
+// and returns the ID of the user it was issued to. Returns ErrorInvalidRequest
+// if the token does not exist or has expired.
+func (mdb *MongoDB) consumeUserToken(purpose, token string) (string, error) {
+	filter := bson.M{
+		tokenHashKey: hashToken(token),
+		purposeKey:   purpose,
+		expiresAtKey: bson.M{"$gt": time.Now()},
+	}
+
+	var userToken *dbUserToken
+	err := mdb.userTokensCollection.FindOneAndDelete(mdb.ctx, filter).Decode(&userToken)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", fmt.Errorf("%w: invalid or expired token", db.ErrorInvalidRequest)
+		}
+		return "", fmt.Errorf("userTokensCollection.FindOneAndDelete error: %w", err)
+	}
+
+	return userToken.UserID, nil
+}
+
+// hashToken returns the hex encoded SHA-256 hash of a token. Tokens are random
+// values so a fast hash is sufficient.
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
 }
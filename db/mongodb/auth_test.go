@@ -0,0 +1,218 @@
+package mongodb
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCreatePasswordResetToken(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	const (
+		token  = "token"
+		expiry = time.Hour
+	)
+
+	tests := []struct {
+		name string
+		// user is the user with the email, if any.
+		user    *dbUser
+		wantErr bool
+	}{
+		{"no account", nil, true},
+		{"unverified email", &dbUser{ID: primitive.NewObjectID(), Username: "user"}, true},
+		{"verified email", &dbUser{ID: primitive.NewObjectID(), Username: "user", EmailVerified: true}, false},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			if test.user == nil {
+				mt.AddMockResponses(mockFound(mt, usersCollection))
+			} else {
+				mt.AddMockResponses(mockFound(mt, usersCollection, test.user), mockWritten(1))
+			}
+
+			username, err := newMockMongoDB(mt).CreatePasswordResetToken("user@example.com", token, expiry)
+			if test.wantErr {
+				if !errors.Is(err, db.ErrorInvalidRequest) {
+					mt.Fatalf("want ErrorInvalidRequest, got %v", err)
+				}
+				if sentCommand(mt, "insert", userTokensCollection) != nil {
+					mt.Fatal("want no token saved")
+				}
+				return
+			}
+			if err != nil {
+				mt.Fatalf("unexpected error: %v", err)
+			}
+			if username != test.user.Username {
+				mt.Fatalf("want username %s, got %s", test.user.Username, username)
+			}
+
+			// Only the hash of the token is saved.
+			insert := sentCommand(mt, "insert", userTokensCollection)
+			if insert == nil {
+				mt.Fatal("token was not saved")
+			}
+			saved := insert.Lookup("documents").Array().Index(0).Value().Document()
+			if saved.Lookup(tokenHashKey).StringValue() != hashToken(token) ||
+				saved.Lookup("userID").StringValue() != test.user.ID.Hex() ||
+				saved.Lookup("purpose").StringValue() != passwordResetPurpose {
+				mt.Fatalf("unexpected saved token: %s", saved)
+			}
+			if expiresIn := time.Until(saved.Lookup(expiresAtKey).Time()); expiresIn <= 0 || expiresIn > expiry {
+				mt.Fatalf("want token to expire in %v, expires in %v", expiry, expiresIn)
+			}
+		})
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	userID := primitive.NewObjectID().Hex()
+
+	tests := []struct {
+		name string
+		// userToken is the unexpired token with the hash of the provided
+		// token, if any.
+		userToken *dbUserToken
+		wantErr   bool
+	}{
+		{"invalid or expired token", nil, true},
+		{"token", &dbUserToken{ID: primitive.NewObjectID(), UserID: userID, Purpose: passwordResetPurpose, TokenHash: hashToken("token")}, false},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			if test.userToken == nil {
+				mt.AddMockResponses(mockFoundAndModified(mt, nil))
+			} else {
+				// The password is saved, then sessions and api tokens are
+				// deleted.
+				mt.AddMockResponses(mockFoundAndModified(mt, test.userToken), mockWritten(1), mockWritten(2), mockWritten(1))
+			}
+
+			err := newMockMongoDB(mt).ResetPassword("token", "new-password")
+			if test.wantErr {
+				if !errors.Is(err, db.ErrorInvalidRequest) {
+					mt.Fatalf("want ErrorInvalidRequest, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				mt.Fatalf("unexpected error: %v", err)
+			}
+
+			// The token is deleted as it is used, so it cannot be reused.
+			consume := sentCommand(mt, "findAndModify", userTokensCollection)
+			if consume == nil || !consume.Lookup("remove").Boolean() ||
+				consume.Lookup("query", tokenHashKey).StringValue() != hashToken("token") {
+				mt.Fatalf("want token consumed by its hash, got %s", consume)
+			}
+
+			for _, collection := range []string{sessionsCollection, apiTokensCollection} {
+				revoke := sentCommand(mt, "delete", collection)
+				if revoke == nil || revoke.Lookup("deletes").Array().Index(0).Value().Document().Lookup("q", userIDKey).StringValue() != userID {
+					mt.Fatalf("want the %s of the user deleted, got %s", collection, revoke)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateEmailVerificationToken(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name string
+		// user is the user with the email, if any.
+		user    *dbUser
+		wantErr bool
+	}{
+		{"no account", nil, true},
+		{"verified email", &dbUser{ID: primitive.NewObjectID(), Username: "user", EmailVerified: true}, true},
+		{"unverified email", &dbUser{ID: primitive.NewObjectID(), Username: "user"}, false},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			if test.user == nil {
+				mt.AddMockResponses(mockFound(mt, usersCollection))
+			} else {
+				mt.AddMockResponses(mockFound(mt, usersCollection, test.user), mockWritten(1))
+			}
+
+			username, err := newMockMongoDB(mt).CreateEmailVerificationToken("user@example.com", "token", time.Hour)
+			if test.wantErr {
+				if !errors.Is(err, db.ErrorInvalidRequest) {
+					mt.Fatalf("want ErrorInvalidRequest, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				mt.Fatalf("unexpected error: %v", err)
+			}
+			if username != test.user.Username {
+				mt.Fatalf("want username %s, got %s", test.user.Username, username)
+			}
+
+			saved := sentCommand(mt, "insert", userTokensCollection).Lookup("documents").Array().Index(0).Value().Document()
+			if saved.Lookup(tokenHashKey).StringValue() != hashToken("token") || saved.Lookup("purpose").StringValue() != emailVerificationPurpose {
+				mt.Fatalf("unexpected saved token: %s", saved)
+			}
+		})
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	userID := primitive.NewObjectID().Hex()
+	userToken := &dbUserToken{ID: primitive.NewObjectID(), UserID: userID, Purpose: emailVerificationPurpose, TokenHash: hashToken("token")}
+
+	tests := []struct {
+		name string
+		// validToken is whether an unexpired token with the hash of the
+		// provided token exists.
+		validToken bool
+		// usersUpdated is the number of users matched by the update.
+		usersUpdated int
+		wantErr      bool
+	}{
+		{"invalid or expired token", false, 0, true},
+		{"deleted user", true, 0, true},
+		{"token", true, 1, false},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			if test.validToken {
+				mt.AddMockResponses(mockFoundAndModified(mt, userToken), mockWritten(test.usersUpdated))
+			} else {
+				mt.AddMockResponses(mockFoundAndModified(mt, nil))
+			}
+
+			err := newMockMongoDB(mt).VerifyEmail("token")
+			if test.wantErr {
+				if !errors.Is(err, db.ErrorInvalidRequest) {
+					mt.Fatalf("want ErrorInvalidRequest, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				mt.Fatalf("unexpected error: %v", err)
+			}
+
+			update := sentCommand(mt, "update", usersCollection).Lookup("updates").Array().Index(0).Value().Document()
+			if !update.Lookup("u", "$set", emailVerifiedKey).Boolean() {
+				mt.Fatalf("want email marked as verified, got %s", update)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package mongodb
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CalendarTask returns the task of the user with the provided userID that is
+// the calendar resource with the provided name. The name of a task is its
+// client ID, or its ID if it was not created by a client. Returns nil if
+// there is no such task.
+func (mdb *MongoDB) CalendarTask(userID, name string) (*db.Task, error) {
+	if userID == "" || name == "" {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	task, err := mdb.clientTask(userID, name)
+	if err == nil && task == nil && primitive.IsValidObjectID(name) {
+		task, err = mdb.ownTask(userID, name)
+	}
+	if err != nil || task == nil {
+		return nil, err
+	}
+
+	return task.info(), nil
+}
+
+// CreateCalendarTask creates a task for the user with the provided userID
+// from the calendar resource with the provided name, which is saved as the
+// task's client ID. Returns ErrorInvalidRequest if the user has a task with
+// the same name.
+func (mdb *MongoDB) CreateCalendarTask(userID, name string, info *db.TaskInfo) (*db.Task, error) {
+	if userID == "" || name == "" || info == nil || info.Detail == "" {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	now := time.Now()
+	task := &dbTask{
+		ID:         primitive.NewObjectID(),
+		OwnerID:    userID,
+		TaskInfo:   *info,
+		UpdatedAt:  now.UnixMilli(),
+		FieldTimes: newFieldTimes(now.UnixMilli()),
+		ClientID:   name,
+	}
+	task.Timestamp = now.Unix()
+
+	_, err := mdb.tasksCollection.InsertOne(mdb.ctx, task)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, fmt.Errorf("%w: task already exists", db.ErrorInvalidRequest)
+		}
+		return nil, fmt.Errorf("tasksCollection.InsertOne error: %w", err)
+	}
+
+	return task.info(), nil
+}
+
+// UpdateCalendarTask replaces the detail, completion state, due date, tags
+// and recurrence rule of a task the user with the provided userID owns with
+// those in info, if the task has not been updated since updatedAt. The
+// project of the task is not changed. Returns ErrorInvalidRequest if the task
+// does not exist or has been updated.
+func (mdb *MongoDB) UpdateCalendarTask(userID, taskID string, updatedAt int64, info *db.TaskInfo) (*db.Task, error) {
+	if userID == "" || taskID == "" || info == nil || info.Detail == "" {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	task, err := mdb.ownTask(userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	if task == nil || task.UpdatedAt != updatedAt {
+		return nil, fmt.Errorf("%w: task does not exist or has been updated", db.ErrorInvalidRequest)
+	}
+
+	now := time.Now().UnixMilli()
+	set := bson.M{updatedAtKey: now}
+	unset := bson.M{}
+	if info.Detail != task.Detail {
+		set[taskDetailKey] = info.Detail
+		set[fieldTimeKey(db.SyncFieldDetail)] = now
+	}
+
+	if info.Completed != task.Completed {
+		set[completedKey] = info.Completed
+		set[fieldTimeKey(db.SyncFieldCompleted)] = now
+	}
+
+	if info.DueAt != task.DueAt {
+		if info.DueAt == 0 {
+			unset[dueAtKey] = ""
+		} else {
+			set[dueAtKey] = info.DueAt
+		}
+		set[fieldTimeKey(db.SyncFieldDueAt)] = now
+	}
+
+	if !slices.Equal(info.Tags, task.Tags) {
+		if len(info.Tags) == 0 {
+			unset[tagsKey] = ""
+		} else {
+			set[tagsKey] = info.Tags
+		}
+		set[fieldTimeKey(db.SyncFieldTags)] = now
+	}
+
+	if info.Recurrence != task.Recurrence {
+		if info.Recurrence == "" {
+			unset[recurrenceKey] = ""
+		} else {
+			set[recurrenceKey] = info.Recurrence
+		}
+		set[fieldTimeKey(db.SyncFieldRecurrence)] = now
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	// Tasks written before sync was introduced have no updatedAt.
+	filter := bson.M{dbIDKey: task.ID, updatedAtKey: updatedAt}
+	if updatedAt == 0 {
+		filter[updatedAtKey] = bson.M{"$exists": false}
+	}
+
+	res, err := mdb.tasksCollection.UpdateOne(mdb.ctx, filter, update)
+	if err != nil {
+		return nil, fmt.Errorf("tasksCollection.UpdateOne error: %w", err)
+	}
+
+	if res.MatchedCount == 0 {
+		return nil, fmt.Errorf("%w: task does not exist or has been updated", db.ErrorInvalidRequest)
+	}
+
+	if info.DueAt != task.DueAt {
+		err = mdb.rescheduleReminders(taskID, info.DueAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	task.TaskInfo.Detail = info.Detail
+	task.TaskInfo.Completed = info.Completed
+	task.TaskInfo.DueAt = info.DueAt
+	task.TaskInfo.Tags = info.Tags
+	task.TaskInfo.Recurrence = info.Recurrence
+	task.UpdatedAt = now
+	return task.info(), nil
+}
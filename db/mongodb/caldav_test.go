@@ -0,0 +1,225 @@
+package mongodb
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCalendarTask(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	const userID = "user"
+	task := &dbTask{ID: primitive.NewObjectID(), OwnerID: userID, TaskInfo: db.TaskInfo{Detail: "task"}}
+
+	tests := []struct {
+		name string
+		// resourceName is the name of the calendar resource.
+		resourceName string
+		// byClientID is true if the task is found by its client ID.
+		byClientID bool
+		// byID is true if the task is found by its ID.
+		byID     bool
+		wantTask bool
+	}{
+		{"created by a client", "uid-1", true, false, true},
+		{"created on the server", task.ID.Hex(), false, true, true},
+		{"unknown name", "uid-2", false, false, false},
+		{"unknown ID", primitive.NewObjectID().Hex(), false, false, false},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			if test.byClientID {
+				mt.AddMockResponses(mockFound(mt, taskCollection, task))
+			} else {
+				mt.AddMockResponses(mockFound(mt, taskCollection))
+				if primitive.IsValidObjectID(test.resourceName) {
+					if test.byID {
+						mt.AddMockResponses(mockFound(mt, taskCollection, task))
+					} else {
+						mt.AddMockResponses(mockFound(mt, taskCollection))
+					}
+				}
+			}
+
+			got, err := newMockMongoDB(mt).CalendarTask(userID, test.resourceName)
+			if err != nil {
+				mt.Fatalf("CalendarTask error: %v", err)
+			}
+			if test.wantTask != (got != nil) {
+				mt.Fatalf("want task %v, got %+v", test.wantTask, got)
+			}
+			if got != nil && got.ID != task.ID.Hex() {
+				mt.Fatalf("want task %s, got %s", task.ID.Hex(), got.ID)
+			}
+		})
+	}
+}
+
+func TestCreateCalendarTask(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name     string
+		info     *db.TaskInfo
+		response bson.D
+		wantErr  bool
+	}{
+		{"new task", &db.TaskInfo{Detail: "task"}, mtest.CreateSuccessResponse(), false},
+		{"missing detail", &db.TaskInfo{}, nil, true},
+		{"existing name", &db.TaskInfo{Detail: "task"}, mtest.CreateWriteErrorsResponse(mtest.WriteError{Code: 11000, Message: "duplicate key"}), true},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			if test.response != nil {
+				mt.AddMockResponses(test.response)
+			}
+
+			task, err := newMockMongoDB(mt).CreateCalendarTask("user", "uid-1", test.info)
+			if test.wantErr {
+				if !errors.Is(err, db.ErrorInvalidRequest) {
+					mt.Fatalf("want ErrorInvalidRequest, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				mt.Fatalf("CreateCalendarTask error: %v", err)
+			}
+			if task.Detail != test.info.Detail || task.UpdatedAt == 0 {
+				mt.Fatalf("want task %q with an update time, got %+v", test.info.Detail, task)
+			}
+
+			// The name of the resource is the client ID of the task.
+			doc := sentCommand(mt, "insert", taskCollection).Lookup("documents").Array().Index(0).Value().Document()
+			if clientID := doc.Lookup(clientIDKey).StringValue(); clientID != "uid-1" {
+				mt.Fatalf("want client ID uid-1, got %s", clientID)
+			}
+		})
+	}
+}
+
+func TestUpdateCalendarTask(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	const userID = "user"
+	const updatedAt = 100
+	task := &dbTask{
+		ID:        primitive.NewObjectID(),
+		OwnerID:   userID,
+		UpdatedAt: updatedAt,
+		TaskInfo:  db.TaskInfo{Detail: "task", Project: "work", DueAt: 1, Tags: []string{"urgent"}, Recurrence: "FREQ=DAILY"},
+	}
+
+	tests := []struct {
+		name      string
+		updatedAt int64
+		info      *db.TaskInfo
+		// matched is the number of tasks matched by the update.
+		matched   int
+		wantSet   []string
+		wantUnset []string
+		wantErr   bool
+	}{
+		{
+			name:      "new detail",
+			updatedAt: updatedAt,
+			info:      &db.TaskInfo{Detail: "new", DueAt: 1, Tags: []string{"urgent"}, Recurrence: "FREQ=DAILY"},
+			matched:   1,
+			wantSet:   []string{taskDetailKey},
+		},
+		{
+			name:      "completed",
+			updatedAt: updatedAt,
+			info:      &db.TaskInfo{Detail: "task", Completed: true, DueAt: 1, Tags: []string{"later"}, Recurrence: "FREQ=DAILY"},
+			matched:   1,
+			wantSet:   []string{completedKey, tagsKey},
+		},
+		{
+			name:      "removed properties",
+			updatedAt: updatedAt,
+			info:      &db.TaskInfo{Detail: "task", DueAt: 1},
+			matched:   1,
+			wantUnset: []string{tagsKey, recurrenceKey},
+		},
+		{
+			name:      "new due date",
+			updatedAt: updatedAt,
+			info:      &db.TaskInfo{Detail: "task", DueAt: 2, Tags: []string{"urgent"}, Recurrence: "FREQ=DAILY"},
+			matched:   1,
+			wantSet:   []string{dueAtKey},
+		},
+		{
+			name:      "removed due date",
+			updatedAt: updatedAt,
+			info:      &db.TaskInfo{Detail: "task", Tags: []string{"urgent"}},
+			matched:   1,
+			wantUnset: []string{dueAtKey, recurrenceKey},
+		},
+		{
+			name:      "stale update time",
+			updatedAt: updatedAt - 1,
+			info:      &db.TaskInfo{Detail: "new"},
+			wantErr:   true,
+		},
+		{
+			name:      "updated by another request",
+			updatedAt: updatedAt,
+			info:      &db.TaskInfo{Detail: "new", DueAt: 1},
+			wantErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			// Reminders are rescheduled if the due date changes.
+			mt.AddMockResponses(mockFound(mt, taskCollection, task), mockWritten(test.matched), mockWritten(0))
+
+			got, err := newMockMongoDB(mt).UpdateCalendarTask(userID, task.ID.Hex(), test.updatedAt, test.info)
+			if test.wantErr {
+				if !errors.Is(err, db.ErrorInvalidRequest) {
+					mt.Fatalf("want ErrorInvalidRequest, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				mt.Fatalf("UpdateCalendarTask error: %v", err)
+			}
+
+			// The project of the task is kept.
+			if got.Detail != test.info.Detail || got.Project != task.Project {
+				mt.Fatalf("want task %q in project %q, got %+v", test.info.Detail, task.Project, got)
+			}
+
+			update := sentCommand(mt, "update", taskCollection).Lookup("updates").Array().Index(0).Value().Document()
+			if filterTime, ok := update.Lookup("q", updatedAtKey).Int64OK(); !ok || filterTime != updatedAt {
+				mt.Fatalf("want update of the task at %d, got %v", updatedAt, update.Lookup("q"))
+			}
+			// Every changed field has its field time updated, so it can be
+			// synced.
+			wantSet := append([]string{updatedAtKey}, test.wantSet...)
+			for _, key := range slices.Concat(test.wantSet, test.wantUnset) {
+				wantSet = append(wantSet, fieldTimeKey(key))
+			}
+			for key, want := range map[string][]string{"$set": wantSet, "$unset": test.wantUnset} {
+				var got []string
+				doc, _ := update.Lookup("u", key).DocumentOK()
+				elems, _ := doc.Elements()
+				for _, elem := range elems {
+					got = append(got, elem.Key())
+				}
+				slices.Sort(got)
+				slices.Sort(want)
+				if !slices.Equal(got, want) {
+					mt.Fatalf("want %s of %v, got %v", key, want, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// taskChangeBufferSize is the number of task changes buffered for a
+	// subscriber. Changes are dropped for subscribers that fall further
+	// behind so the change stream is never blocked.
+	taskChangeBufferSize = 256
+	// minChangeStreamRetryDelay and maxChangeStreamRetryDelay bound the delay
+	// before the change stream is reopened after an error.
+	minChangeStreamRetryDelay = time.Second
+	maxChangeStreamRetryDelay = time.Minute
+)
+
+// dbTaskChangeEvent is a change stream event of the tasks collection.
+type dbTaskChangeEvent struct {
+	OperationType string `bson:"operationType"`
+	DocumentKey   struct {
+		ID primitive.ObjectID `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument             *dbTask `bson:"fullDocument"`
+	FullDocumentBeforeChange *dbTask `bson:"fullDocumentBeforeChange"`
+}
+
+// StartTaskChangeStream opens a change stream on the tasks collection and
+// publishes the task changes it reads to the subscribers of
+// SubscribeTaskChanges until ctx is canceled. The stream is resumed after
+// errors. Returns an error if the stream cannot be opened, e.g. because the
+// database is not a replica set or is older than MongoDB 6.0.
+func (mdb *MongoDB) StartTaskChangeStream(ctx context.Context) error {
+	// Pre-images are the only record of who a deleted task was visible to,
+	// so deletions cannot be published without them.
+	err := mdb.db.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: taskCollection},
+		{Key: "changeStreamPreAndPostImages", Value: bson.M{"enabled": true}},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to enable pre-images of the tasks collection: %w", err)
+	}
+
+	stream, err := mdb.watchTasks(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	go mdb.readTaskChanges(ctx, stream)
+
+	return nil
+}
+
+// SubscribeTaskChanges returns a channel that receives the task changes read
+// by the change stream and a function that ends the subscription.
+func (mdb *MongoDB) SubscribeTaskChanges() (<-chan *db.TaskChange, func()) {
+	changes := make(chan *db.TaskChange, taskChangeBufferSize)
+
+	mdb.changesMtx.Lock()
+	if mdb.changeSubscribers == nil {
+		mdb.changeSubscribers = make(map[chan *db.TaskChange]struct{})
+	}
+	mdb.changeSubscribers[changes] = struct{}{}
+	mdb.changesMtx.Unlock()
+
+	unsubscribe := func() {
+		mdb.changesMtx.Lock()
+		defer mdb.changesMtx.Unlock()
+		if _, found := mdb.changeSubscribers[changes]; found {
+			delete(mdb.changeSubscribers, changes)
+			close(changes)
+		}
+	}
+
+	return changes, unsubscribe
+}
+
+// watchTasks opens a change stream on the tasks collection that starts after
+// the event with the provided resume token, or now if the token is nil.
+func (mdb *MongoDB) watchTasks(ctx context.Context, resumeToken bson.Raw) (*mongo.ChangeStream, error) {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{
+		"operationType": bson.M{"$in": bson.A{"insert", "update", "replace", "delete"}},
+	}}}}
+
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup).SetFullDocumentBeforeChange(options.WhenAvailable)
+	if resumeToken != nil {
+		opts.SetStartAfter(resumeToken)
+	}
+
+	stream, err := mdb.tasksCollection.Watch(ctx, pipeline, opts)
+	if err != nil {
+		return nil, fmt.Errorf("tasksCollection.Watch error: %w", err)
+	}
+
+	return stream, nil
+}
+
+// readTaskChanges publishes the changes read from stream and reopens the
+// stream after errors until ctx is canceled.
+func (mdb *MongoDB) readTaskChanges(ctx context.Context, stream *mongo.ChangeStream) {
+	retryDelay := minChangeStreamRetryDelay
+	for {
+		for stream.Next(ctx) {
+			retryDelay = minChangeStreamRetryDelay
+
+			var event *dbTaskChangeEvent
+			err := stream.Decode(&event)
+			if err != nil {
+				mdb.log.Error("failed to decode task change: ", "error", err)
+				continue
+			}
+
+			change, err := mdb.taskChange(event)
+			if err != nil {
+				mdb.log.Error("failed to prepare task change: ", "error", err)
+				continue
+			}
+
+			if change != nil {
+				mdb.publishTaskChange(change)
+			}
+		}
+
+		resumeToken := stream.ResumeToken()
+		err := stream.Err()
+		stream.Close(context.Background())
+		if ctx.Err() != nil {
+			return
+		}
+
+		mdb.log.Error("task change stream error, reopening: ", "error", err)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryDelay):
+			}
+
+			retryDelay = min(retryDelay*2, maxChangeStreamRetryDelay)
+			stream, err = mdb.watchTasks(ctx, resumeToken)
+			if err == nil {
+				break
+			}
+
+			var cmdErr mongo.CommandError
+			if resumeToken != nil && errors.As(err, &cmdErr) && cmdErr.HasErrorLabel("NonResumableChangeStreamError") {
+				// The resume token has expired from the oplog, so the changes
+				// since then are lost.
+				mdb.log.Error("task change stream cannot be resumed, restarting from now: ", "error", err)
+				resumeToken = nil
+				continue
+			}
+
+			mdb.log.Error("failed to reopen task change stream: ", "error", err)
+		}
+	}
+}
+
+// taskChange normalises a change stream event. Returns nil if the changed
+// task is not known, e.g. an update of a task that has since been deleted.
+// Returns an error for a deletion without a pre-image, e.g. because it expired,
+// since the users the task was visible to are no longer known.
+func (mdb *MongoDB) taskChange(event *dbTaskChangeEvent) (*db.TaskChange, error) {
+	change := &db.TaskChange{TaskID: event.DocumentKey.ID.Hex()}
+	task := event.FullDocument
+	switch event.OperationType {
+	case "insert":
+		change.Type = db.TaskChangeCreated
+	case "update", "replace":
+		change.Type = db.TaskChangeUpdated
+	case "delete":
+		change.Type = db.TaskChangeDeleted
+		task = event.FullDocumentBeforeChange
+	default:
+		return nil, nil
+	}
+
+	if task == nil {
+		if change.Type == db.TaskChangeDeleted {
+			return nil, fmt.Errorf("pre-image of deleted task %s is not available", change.TaskID)
+		}
+		return nil, nil
+	}
+
+	audience, err := mdb.taskAudience(task)
+	if err != nil {
+		return nil, err
+	}
+
+	change.Task = task.info()
+	change.Task.OwnerID = task.OwnerID
+	change.Audience = audience
+
+	return change, nil
+}
+
+// publishTaskChange sends change to all subscribers.
+func (mdb *MongoDB) publishTaskChange(change *db.TaskChange) {
+	mdb.changesMtx.Lock()
+	defer mdb.changesMtx.Unlock()
+
+	for changes := range mdb.changeSubscribers {
+		select {
+		case changes <- change:
+		default:
+			mdb.log.Error("task change subscriber is full, dropping change: ", "taskID", change.TaskID)
+		}
+	}
+}
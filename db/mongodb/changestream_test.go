@@ -0,0 +1,157 @@
+package mongodb
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestStartTaskChangeStream(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	failed := mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "failed"})
+	tests := []struct {
+		name      string
+		responses []bson.D
+	}{
+		// Deletions would be published without their audience.
+		{"pre-images not supported", []bson.D{failed}},
+		{"change streams not supported", []bson.D{mtest.CreateSuccessResponse(), failed}},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			mt.AddMockResponses(test.responses...)
+			if err := newMockMongoDB(mt).StartTaskChangeStream(context.Background()); err == nil {
+				mt.Fatal("want error")
+			}
+		})
+	}
+}
+
+func TestTaskChange(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name          string
+		operationType string
+		// task is the full document, or the pre-image for deletions.
+		task *dbTask
+		// shared is the user the personal task is shared with, if any.
+		shared       string
+		wantChange   bool
+		wantType     string
+		wantAudience []string
+		wantErr      bool
+	}{
+		{name: "insert", operationType: "insert", task: &dbTask{OwnerID: "owner"}, shared: "friend", wantChange: true, wantType: db.TaskChangeCreated, wantAudience: []string{"owner", "friend"}},
+		{name: "update", operationType: "update", task: &dbTask{OwnerID: "owner"}, wantChange: true, wantType: db.TaskChangeUpdated, wantAudience: []string{"owner"}},
+		{name: "replace", operationType: "replace", task: &dbTask{OwnerID: "owner"}, wantChange: true, wantType: db.TaskChangeUpdated, wantAudience: []string{"owner"}},
+		{name: "update of a deleted task", operationType: "update"},
+		{name: "delete with pre-image", operationType: "delete", task: &dbTask{OwnerID: "owner"}, shared: "owner", wantChange: true, wantType: db.TaskChangeDeleted, wantAudience: []string{"owner"}},
+		{name: "delete without pre-image", operationType: "delete", wantErr: true},
+		{name: "workspace task", operationType: "insert", task: &dbTask{OwnerID: "owner", WorkspaceID: "workspace"}, wantChange: true, wantType: db.TaskChangeCreated, wantAudience: []string{"member"}},
+		{name: "other operation", operationType: "drop"},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			event := &dbTaskChangeEvent{OperationType: test.operationType}
+			event.DocumentKey.ID = primitive.NewObjectID()
+			if test.task != nil {
+				test.task.ID = event.DocumentKey.ID
+				if test.operationType == "delete" {
+					event.FullDocumentBeforeChange = test.task
+				} else {
+					event.FullDocument = test.task
+				}
+
+				if test.task.WorkspaceID != "" {
+					member := &dbWorkspaceMember{ID: primitive.NewObjectID(), WorkspaceID: test.task.WorkspaceID, UserID: "member", Role: db.WorkspaceRoleMember}
+					mt.AddMockResponses(mockFound(mt, membersCollection, member))
+				} else if test.shared != "" {
+					share := &dbShare{ID: primitive.NewObjectID(), OwnerID: test.task.OwnerID, TaskID: test.task.ID.Hex(), UserID: test.shared, Permission: db.PermissionRead}
+					mt.AddMockResponses(mockFound(mt, sharesCollection, share))
+				} else {
+					mt.AddMockResponses(mockFound(mt, sharesCollection))
+				}
+			}
+
+			change, err := newMockMongoDB(mt).taskChange(event)
+			if test.wantErr {
+				if err == nil {
+					mt.Fatalf("want error, got change %+v", change)
+				}
+				return
+			}
+			if err != nil {
+				mt.Fatalf("taskChange error: %v", err)
+			}
+			if !test.wantChange {
+				if change != nil {
+					mt.Fatalf("want no change, got %+v", change)
+				}
+				return
+			}
+
+			if change == nil || change.Type != test.wantType || change.TaskID != event.DocumentKey.ID.Hex() {
+				mt.Fatalf("want %s change of %s, got %+v", test.wantType, event.DocumentKey.ID.Hex(), change)
+			}
+			if !slices.Equal(change.Audience, test.wantAudience) {
+				mt.Fatalf("want audience %v, got %v", test.wantAudience, change.Audience)
+			}
+			if change.Task == nil || change.Task.OwnerID != test.task.OwnerID {
+				mt.Fatalf("want task of %s, got %+v", test.task.OwnerID, change.Task)
+			}
+		})
+	}
+}
+
+func TestPublishTaskChange(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name string
+		// changes is the number of changes published.
+		changes      int
+		wantReceived int
+	}{
+		{"no changes", 0, 0},
+		{"buffered changes", taskChangeBufferSize, taskChangeBufferSize},
+		{"subscriber fell behind", taskChangeBufferSize + 1, taskChangeBufferSize},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			mdb := newMockMongoDB(mt)
+			changes, unsubscribe := mdb.SubscribeTaskChanges()
+			other, unsubscribeOther := mdb.SubscribeTaskChanges()
+			unsubscribeOther()
+
+			for i := 0; i < test.changes; i++ {
+				mdb.publishTaskChange(&db.TaskChange{Type: db.TaskChangeCreated})
+			}
+
+			if _, ok := <-other; ok {
+				mt.Fatal("want no changes after unsubscribing")
+			}
+
+			// Changes that do not fit in the buffer are dropped without
+			// closing the subscription.
+			unsubscribe()
+			unsubscribe()
+			received := 0
+			for range changes {
+				received++
+			}
+			if received != test.wantReceived {
+				mt.Fatalf("want %d changes received, got %d", test.wantReceived, received)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package mongodb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AddComment adds a comment to the task with the provided taskID. The comment
+// replies to the comment with the provided parentID if it is not empty. The
+// user with the provided userID must be able to edit the task.
+func (mdb *MongoDB) AddComment(userID, taskID, parentID, body string) (*db.Comment, error) {
+	if userID == "" || taskID == "" || body == "" {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	_, permission, err := mdb.taskWithPermission(userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	if permission == db.PermissionRead {
+		return nil, fmt.Errorf("%w: you do not have permission to comment on this task", db.ErrorInvalidRequest)
+	}
+
+	if parentID != "" {
+		parent, err := mdb.comment(taskID, parentID)
+		if err != nil {
+			return nil, err
+		}
+
+		if parent.Deleted {
+			return nil, fmt.Errorf("%w: cannot reply to a deleted comment", db.ErrorInvalidRequest)
+		}
+	}
+
+	author, err := mdb.user(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	comment := &dbComment{
+		ID:             primitive.NewObjectID(),
+		TaskID:         taskID,
+		ParentID:       parentID,
+		AuthorID:       userID,
+		AuthorUsername: author.Username,
+		Body:           body,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	_, err = mdb.commentsCollection.InsertOne(mdb.ctx, comment)
+	if err != nil {
+		return nil, fmt.Errorf("commentsCollection.InsertOne error: %w", err)
+	}
+
+	return comment.info(), nil
+}
+
+// Comments returns the comments on the task with the provided taskID as
+// threads, oldest first. The user with the provided userID must have access
+// to the task.
+func (mdb *MongoDB) Comments(userID, taskID string) ([]*db.Comment, error) {
+	if userID == "" || taskID == "" {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	_, _, err := mdb.taskWithPermission(userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := mdb.commentsCollection.Find(mdb.ctx, bson.M{taskIDKey: taskID}, options.Find().SetSort(bson.M{createdAtKey: 1}))
+	if err != nil {
+		return nil, fmt.Errorf("commentsCollection.Find error: %w", err)
+	}
+
+	var dbComments []*dbComment
+	err = cur.All(mdb.ctx, &dbComments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode retrieved comments: %w", err)
+	}
+
+	comments := make(map[string]*db.Comment, len(dbComments))
+	for _, dbComment := range dbComments {
+		comments[dbComment.ID.Hex()] = dbComment.info()
+	}
+
+	// Comments are sorted oldest first, so replies are added to their parent
+	// in the order they were created.
+	threads := make([]*db.Comment, 0)
+	for _, dbComment := range dbComments {
+		comment := comments[dbComment.ID.Hex()]
+		parent, found := comments[comment.ParentID]
+		if comment.ParentID == "" || !found {
+			threads = append(threads, comment)
+			continue
+		}
+		parent.Replies = append(parent.Replies, comment)
+	}
+
+	return threads, nil
+}
+
+// UpdateComment replaces the body of a comment on the task with the provided
+// taskID. Only the author of a comment can update it, while they can edit the
+// task. Returns ErrorInvalidRequest if the comment does not exist or has been
+// deleted.
+func (mdb *MongoDB) UpdateComment(userID, taskID, commentID, body string) (*db.Comment, error) {
+	if userID == "" || taskID == "" || commentID == "" || body == "" {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	comment, err := mdb.authorComment(userID, taskID, commentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if comment.Deleted {
+		return nil, fmt.Errorf("%w: comment has been deleted", db.ErrorInvalidRequest)
+	}
+
+	comment.Body = body
+	comment.UpdatedAt = time.Now().Unix()
+	update := bson.M{"$set": bson.M{
+		bodyKey:      comment.Body,
+		updatedAtKey: comment.UpdatedAt,
+	}}
+	_, err = mdb.commentsCollection.UpdateByID(mdb.ctx, comment.ID, update)
+	if err != nil {
+		return nil, fmt.Errorf("commentsCollection.UpdateByID error: %w", err)
+	}
+
+	return comment.info(), nil
+}
+
+// DeleteComment deletes a comment on the task with the provided taskID. Only
+// the author of a comment can delete it, while they can edit the task.
+// Comments that have replies are kept without their body so the thread is
+// preserved. Returns ErrorInvalidRequest if the comment does not exist or has
+// already been deleted.
+func (mdb *MongoDB) DeleteComment(userID, taskID, commentID string) error {
+	if userID == "" || taskID == "" || commentID == "" {
+		return fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	comment, err := mdb.authorComment(userID, taskID, commentID)
+	if err != nil {
+		return err
+	}
+
+	if comment.Deleted {
+		return fmt.Errorf("%w: comment has already been deleted", db.ErrorInvalidRequest)
+	}
+
+	nReplies, err := mdb.commentsCollection.CountDocuments(mdb.ctx, bson.M{parentIDKey: commentID})
+	if err != nil {
+		return fmt.Errorf("commentsCollection.CountDocuments error: %w", err)
+	}
+
+	if nReplies == 0 {
+		_, err = mdb.commentsCollection.DeleteOne(mdb.ctx, bson.M{dbIDKey: comment.ID})
+		if err != nil {
+			return fmt.Errorf("commentsCollection.DeleteOne error: %w", err)
+		}
+		return nil
+	}
+
+	update := bson.M{"$set": bson.M{
+		bodyKey:      "",
+		deletedKey:   true,
+		updatedAtKey: time.Now().Unix(),
+	}}
+	_, err = mdb.commentsCollection.UpdateByID(mdb.ctx, comment.ID, update)
+	if err != nil {
+		return fmt.Errorf("commentsCollection.UpdateByID error: %w", err)
+	}
+
+	return nil
+}
+
+// authorComment returns a comment on the task with the provided taskID after
+// checking that the user with the provided userID wrote it and can still
+// comment on the task.
+func (mdb *MongoDB) authorComment(userID, taskID, commentID string) (*dbComment, error) {
+	_, permission, err := mdb.taskWithPermission(userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	if permission == db.PermissionRead {
+		return nil, fmt.Errorf("%w: you do not have permission to change comments on this task", db.ErrorInvalidRequest)
+	}
+
+	comment, err := mdb.comment(taskID, commentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if comment.AuthorID != userID {
+		return nil, fmt.Errorf("%w: only the author of a comment can change it", db.ErrorInvalidRequest)
+	}
+
+	return comment, nil
+}
+
+// comment returns a comment on the task with the provided taskID. Returns
+// ErrorInvalidRequest if the comment does not exist.
+func (mdb *MongoDB) comment(taskID, commentID string) (*dbComment, error) {
+	commentDBID, err := primitive.ObjectIDFromHex(commentID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid comment ID", db.ErrorInvalidRequest)
+	}
+
+	var comment *dbComment
+	err = mdb.commentsCollection.FindOne(mdb.ctx, bson.M{dbIDKey: commentDBID, taskIDKey: taskID}).Decode(&comment)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("%w: comment does not exist", db.ErrorInvalidRequest)
+		}
+		return nil, fmt.Errorf("commentsCollection.FindOne error: %w", err)
+	}
+
+	return comment, nil
+}
+
+// setCommentCounts sets the number of comments that have not been deleted on
+// each of the provided tasks.
+func (mdb *MongoDB) setCommentCounts(tasks []*db.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	taskIDs := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		taskIDs = append(taskIDs, task.ID)
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			taskIDKey:  bson.M{"$in": taskIDs},
+			deletedKey: false,
+		}}},
+		{{Key: "$group", Value: bson.M{
+			dbIDKey: "$" + taskIDKey,
+			"count": bson.M{"$sum": 1},
+		}}},
+	}
+	cur, err := mdb.commentsCollection.Aggregate(mdb.ctx, pipeline)
+	if err != nil {
+		return fmt.Errorf("commentsCollection.Aggregate error: %w", err)
+	}
+
+	var counts []struct {
+		TaskID string `bson:"_id"`
+		Count  int64  `bson:"count"`
+	}
+	err = cur.All(mdb.ctx, &counts)
+	if err != nil {
+		return fmt.Errorf("failed to decode comment counts: %w", err)
+	}
+
+	commentCounts := make(map[string]int64, len(counts))
+	for _, count := range counts {
+		commentCounts[count.TaskID] = count.Count
+	}
+
+	for _, task := range tasks {
+		task.CommentCount = commentCounts[task.ID]
+	}
+
+	return nil
+}
+
+// info returns the public information of a comment.
+func (c *dbComment) info() *db.Comment {
+	return &db.Comment{
+		ID:             c.ID.Hex(),
+		TaskID:         c.TaskID,
+		ParentID:       c.ParentID,
+		AuthorID:       c.AuthorID,
+		AuthorUsername: c.AuthorUsername,
+		Body:           c.Body,
+		Deleted:        c.Deleted,
+		CreatedAt:      c.CreatedAt,
+		UpdatedAt:      c.UpdatedAt,
+		Replies:        []*db.Comment{},
+	}
+}
@@ -0,0 +1,134 @@
+package mongodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCommentPermissions(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	userID := primitive.NewObjectID().Hex()
+	personalTask := &dbTask{ID: primitive.NewObjectID(), OwnerID: "owner"}
+	workspaceTask := &dbTask{ID: primitive.NewObjectID(), OwnerID: "owner", WorkspaceID: "workspace"}
+	comment := &dbComment{ID: primitive.NewObjectID(), AuthorID: userID, Body: "comment"}
+	commentID := comment.ID.Hex()
+
+	tests := []struct {
+		name       string
+		task       *dbTask
+		permission string
+		// responses are the responses to the commands sent after the
+		// permission of the user is found.
+		responses func(mt *mtest.T) []bson.D
+		change    func(mdb *MongoDB, taskID string) error
+		wantErr   bool
+	}{{
+		name:       "read collaborator adds a comment",
+		task:       personalTask,
+		permission: db.PermissionRead,
+		change: func(mdb *MongoDB, taskID string) error {
+			_, err := mdb.AddComment(userID, taskID, "", "comment")
+			return err
+		},
+		wantErr: true,
+	}, {
+		name:       "workspace viewer adds a comment",
+		task:       workspaceTask,
+		permission: db.PermissionRead,
+		change: func(mdb *MongoDB, taskID string) error {
+			_, err := mdb.AddComment(userID, taskID, "", "comment")
+			return err
+		},
+		wantErr: true,
+	}, {
+		name:       "edit collaborator adds a comment",
+		task:       personalTask,
+		permission: db.PermissionEdit,
+		responses: func(mt *mtest.T) []bson.D {
+			user := &dbUser{Username: "user"}
+			user.ID, _ = primitive.ObjectIDFromHex(userID)
+			return []bson.D{mockFound(mt, usersCollection, user), mockWritten(1)}
+		},
+		change: func(mdb *MongoDB, taskID string) error {
+			_, err := mdb.AddComment(userID, taskID, "", "comment")
+			return err
+		},
+	}, {
+		name:       "read collaborator updates their comment",
+		task:       personalTask,
+		permission: db.PermissionRead,
+		change: func(mdb *MongoDB, taskID string) error {
+			_, err := mdb.UpdateComment(userID, taskID, commentID, "updated")
+			return err
+		},
+		wantErr: true,
+	}, {
+		name:       "workspace viewer updates their comment",
+		task:       workspaceTask,
+		permission: db.PermissionRead,
+		change: func(mdb *MongoDB, taskID string) error {
+			_, err := mdb.UpdateComment(userID, taskID, commentID, "updated")
+			return err
+		},
+		wantErr: true,
+	}, {
+		name:       "edit collaborator updates their comment",
+		task:       personalTask,
+		permission: db.PermissionEdit,
+		responses: func(mt *mtest.T) []bson.D {
+			return []bson.D{mockFound(mt, commentsCollection, comment), mockWritten(1)}
+		},
+		change: func(mdb *MongoDB, taskID string) error {
+			_, err := mdb.UpdateComment(userID, taskID, commentID, "updated")
+			return err
+		},
+	}, {
+		name:       "read collaborator deletes their comment",
+		task:       personalTask,
+		permission: db.PermissionRead,
+		change: func(mdb *MongoDB, taskID string) error {
+			return mdb.DeleteComment(userID, taskID, commentID)
+		},
+		wantErr: true,
+	}, {
+		name:       "workspace member deletes their comment",
+		task:       workspaceTask,
+		permission: db.PermissionEdit,
+		responses: func(mt *mtest.T) []bson.D {
+			return []bson.D{
+				mockFound(mt, commentsCollection, comment),
+				mockCounted(mt, commentsCollection, 0),
+				mockWritten(1),
+			}
+		},
+		change: func(mdb *MongoDB, taskID string) error {
+			return mdb.DeleteComment(userID, taskID, commentID)
+		},
+	}}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			mt.AddMockResponses(mockTaskPermission(mt, test.task, userID, test.permission)...)
+			if test.responses != nil {
+				mt.AddMockResponses(test.responses(mt)...)
+			}
+
+			err := test.change(newMockMongoDB(mt), test.task.ID.Hex())
+			if test.wantErr {
+				if !errors.Is(err, db.ErrorInvalidRequest) {
+					mt.Fatalf("want ErrorInvalidRequest, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				mt.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package mongodb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxFeedTokens is the number of feed tokens a user can have.
+const maxFeedTokens = 20
+
+// CreateFeedToken saves a new calendar feed token for the user with the
+// provided userID. Returns ErrorInvalidRequest if the user already has
+// maxFeedTokens tokens.
+func (mdb *MongoDB) CreateFeedToken(userID, name, token string) (*db.FeedToken, error) {
+	if userID == "" || name == "" || token == "" {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	nTokens, err := mdb.feedTokensCollection.CountDocuments(mdb.ctx, bson.M{userIDKey: userID})
+	if err != nil {
+		return nil, fmt.Errorf("feedTokensCollection.CountDocuments error: %w", err)
+	}
+
+	if nTokens >= maxFeedTokens {
+		return nil, fmt.Errorf("%w: you cannot have more than %d feed tokens", db.ErrorInvalidRequest, maxFeedTokens)
+	}
+
+	feedToken := &dbFeedToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Name:      name,
+		TokenHash: hashToken(token),
+		CreatedAt: time.Now().Unix(),
+	}
+
+	_, err = mdb.feedTokensCollection.InsertOne(mdb.ctx, feedToken)
+	if err != nil {
+		return nil, fmt.Errorf("feedTokensCollection.InsertOne error: %w", err)
+	}
+
+	return feedToken.info(), nil
+}
+
+// FeedTokens returns the calendar feed tokens of the user with the provided
+// userID.
+func (mdb *MongoDB) FeedTokens(userID string) ([]*db.FeedToken, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("%w: missing required argument", db.ErrorInvalidRequest)
+	}
+
+	cur, err := mdb.feedTokensCollection.Find(mdb.ctx, bson.M{userIDKey: userID}, options.Find().SetSort(bson.M{dbIDKey: -1}))
+	if err != nil {
+		return nil, fmt.Errorf("feedTokensCollection.Find error: %w", err)
+	}
+
+	var dbFeedTokens []*dbFeedToken
+	err = cur.All(mdb.ctx, &dbFeedTokens)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode retrieved feed tokens: %w", err)
+	}
+
+	feedTokens := make([]*db.FeedToken, 0, len(dbFeedTokens))
+	for _, feedToken := range dbFeedTokens {
+		feedTokens = append(feedTokens, feedToken.info())
+	}
+
+	return feedTokens, nil
+}
+
+// RevokeFeedToken deletes a calendar feed token of the user with the
+// provided userID. If no token match the provided tokenID, an
+// ErrorInvalidRequest is returned.
+func (mdb *MongoDB) RevokeFeedToken(userID, tokenID string) error {
+	if userID == "" || tokenID == "" {
+		return fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	tokenDBID, err := primitive.ObjectIDFromHex(tokenID)
+	if err != nil {
+		return fmt.Errorf("%w: invalid token ID", db.ErrorInvalidRequest)
+	}
+
+	res, err := mdb.feedTokensCollection.DeleteOne(mdb.ctx, bson.M{dbIDKey: tokenDBID, userIDKey: userID})
+	if err != nil {
+		return fmt.Errorf("feedTokensCollection.DeleteOne error: %w", err)
+	}
+
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("%w: feed token does not exist", db.ErrorInvalidRequest)
+	}
+
+	return nil
+}
+
+// FeedTokenOwner checks that the provided calendar feed token is valid and
+// returns the ID of the user that created it. Returns ErrorInvalidRequest if
+// the token does not exist, the user's account has been disabled or the user
+// must reset their password.
+func (mdb *MongoDB) FeedTokenOwner(token string) (string, error) {
+	if token == "" {
+		return "", fmt.Errorf("%w: missing required argument", db.ErrorInvalidRequest)
+	}
+
+	filter := bson.M{tokenHashKey: hashToken(token)}
+	update := bson.M{"$set": bson.M{lastUsedAtKey: time.Now().Unix()}}
+
+	var feedToken *dbFeedToken
+	err := mdb.feedTokensCollection.FindOneAndUpdate(mdb.ctx, filter, update).Decode(&feedToken)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", fmt.Errorf("%w: invalid feed token", db.ErrorInvalidRequest)
+		}
+		return "", fmt.Errorf("feedTokensCollection.FindOneAndUpdate error: %w", err)
+	}
+
+	user, err := mdb.user(feedToken.UserID)
+	if err != nil {
+		return "", err
+	}
+
+	err = checkCanLogin(user)
+	if err != nil {
+		return "", err
+	}
+
+	err = checkNoPasswordReset(user)
+	if err != nil {
+		return "", err
+	}
+
+	return feedToken.UserID, nil
+}
+
+// info returns the public information of a calendar feed token.
+func (t *dbFeedToken) info() *db.FeedToken {
+	return &db.FeedToken{
+		ID:         t.ID.Hex(),
+		Name:       t.Name,
+		CreatedAt:  t.CreatedAt,
+		LastUsedAt: t.LastUsedAt,
+	}
+}
@@ -0,0 +1,110 @@
+package mongodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCreateFeedToken(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	const token = "secret"
+
+	tests := []struct {
+		name    string
+		nTokens int
+		wantErr bool
+	}{
+		{"first token", 0, false},
+		{"last token", maxFeedTokens - 1, false},
+		{"too many tokens", maxFeedTokens, true},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			mt.AddMockResponses(mockCounted(mt, feedTokensCollection, test.nTokens))
+			if !test.wantErr {
+				mt.AddMockResponses(mtest.CreateSuccessResponse())
+			}
+
+			feedToken, err := newMockMongoDB(mt).CreateFeedToken("user", "phone", token)
+			if test.wantErr {
+				if !errors.Is(err, db.ErrorInvalidRequest) {
+					mt.Fatalf("want ErrorInvalidRequest, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				mt.Fatalf("CreateFeedToken error: %v", err)
+			}
+			if feedToken.Name != "phone" {
+				mt.Fatalf("want token named phone, got %+v", feedToken)
+			}
+
+			// Only the hash of the token is stored.
+			doc := sentCommand(mt, "insert", feedTokensCollection).Lookup("documents").Array().Index(0).Value().Document()
+			if tokenHash := doc.Lookup(tokenHashKey).StringValue(); tokenHash != hashToken(token) {
+				mt.Fatalf("want token hash %s, got %s", hashToken(token), tokenHash)
+			}
+		})
+	}
+}
+
+func TestFeedTokenOwner(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	const token = "secret"
+	userID := primitive.NewObjectID()
+
+	tests := []struct {
+		name      string
+		feedToken *dbFeedToken
+		// user is the owner of feedToken, if it is looked up.
+		user    *dbUser
+		wantErr bool
+	}{
+		{"unknown token", nil, nil, true},
+		{"disabled owner", &dbFeedToken{ID: primitive.NewObjectID(), UserID: userID.Hex()}, &dbUser{ID: userID, Disabled: true}, true},
+		{"owner must reset password", &dbFeedToken{ID: primitive.NewObjectID(), UserID: userID.Hex()}, &dbUser{ID: userID, MustResetPassword: true}, true},
+		{"valid token", &dbFeedToken{ID: primitive.NewObjectID(), UserID: userID.Hex()}, &dbUser{ID: userID}, false},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			if test.feedToken == nil {
+				mt.AddMockResponses(mockFoundAndModified(mt, nil))
+			} else {
+				mt.AddMockResponses(mockFoundAndModified(mt, test.feedToken), mockFound(mt, usersCollection, test.user))
+			}
+
+			owner, err := newMockMongoDB(mt).FeedTokenOwner(token)
+			if test.wantErr {
+				if !errors.Is(err, db.ErrorInvalidRequest) {
+					mt.Fatalf("want ErrorInvalidRequest, got %v", err)
+				}
+			} else {
+				if err != nil {
+					mt.Fatalf("FeedTokenOwner error: %v", err)
+				}
+				if owner != userID.Hex() {
+					mt.Fatalf("want owner %s, got %s", userID.Hex(), owner)
+				}
+			}
+
+			// Tokens are looked up by their hash and their last use is
+			// recorded.
+			cmd := sentCommand(mt, "findAndModify", feedTokensCollection)
+			if query := cmd.Lookup("query", tokenHashKey).StringValue(); query != hashToken(token) {
+				mt.Fatalf("want token looked up by hash %s, got %s", hashToken(token), query)
+			}
+			if cmd.Lookup("update", "$set", lastUsedAtKey).Type != bson.TypeInt64 {
+				mt.Fatalf("want last use recorded, got %v", cmd.Lookup("update"))
+			}
+		})
+	}
+}
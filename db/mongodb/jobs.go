@@ -0,0 +1,194 @@
+package mongodb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AcquireJobLock acquires or renews the lock on the job with the provided
+// name for the server with the provided owner ID, until the lease expires.
+// Returns false if another server holds the lock.
+func (mdb *MongoDB) AcquireJobLock(name, owner string, lease time.Duration) (bool, error) {
+	if name == "" || owner == "" || lease <= 0 {
+		return false, fmt.Errorf("%w: missing or invalid argument(s)", db.ErrorInvalidRequest)
+	}
+
+	now := time.Now()
+	filter := bson.M{
+		dbIDKey: name,
+		"$or": bson.A{
+			bson.M{ownerKey: owner},
+			bson.M{expiresAtKey: bson.M{"$lte": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{ownerKey: owner, expiresAtKey: now.Add(lease)}}
+
+	// The upsert inserts a lock if there is none, and fails with a duplicate
+	// key error if another server holds the lock.
+	_, err := mdb.jobLocksCollection.UpdateOne(mdb.ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("jobLocksCollection.UpdateOne error: %w", err)
+	}
+
+	return true, nil
+}
+
+// RecordJobRun saves the result of a run of the job with the provided name.
+func (mdb *MongoDB) RecordJobRun(name string, run *db.JobRun) error {
+	if name == "" || run == nil {
+		return fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	failures := 0
+	if run.Error != "" {
+		failures = 1
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			lastRunByKey:      run.Owner,
+			lastStartedAtKey:  run.StartedAt / 1000,
+			lastFinishedAtKey: run.FinishedAt / 1000,
+			lastDurationKey:   run.FinishedAt - run.StartedAt,
+			lastErrorKey:      run.Error,
+		},
+		"$inc": bson.M{runsKey: 1, failuresKey: failures},
+	}
+	_, err := mdb.jobsCollection.UpdateOne(mdb.ctx, bson.M{dbIDKey: name}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("jobsCollection.UpdateOne error: %w", err)
+	}
+
+	return nil
+}
+
+// Job returns the status of the job with the provided name. A job that has
+// never run has no last run.
+func (mdb *MongoDB) Job(name string) (*db.Job, error) {
+	if name == "" {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	job := &dbJob{Name: name}
+	err := mdb.jobsCollection.FindOne(mdb.ctx, bson.M{dbIDKey: name}).Decode(job)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("jobsCollection.FindOne error: %w", err)
+	}
+
+	lock := new(dbJobLock)
+	filter := bson.M{dbIDKey: name, expiresAtKey: bson.M{"$gt": time.Now()}}
+	err = mdb.jobLocksCollection.FindOne(mdb.ctx, filter).Decode(lock)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("jobLocksCollection.FindOne error: %w", err)
+		}
+		lock = nil
+	}
+
+	return job.info(lock), nil
+}
+
+// Jobs returns the status of all the jobs that have run or are locked,
+// ordered by name.
+func (mdb *MongoDB) Jobs() ([]*db.Job, error) {
+	cur, err := mdb.jobsCollection.Find(mdb.ctx, bson.M{}, options.Find().SetSort(bson.M{dbIDKey: 1}))
+	if err != nil {
+		return nil, fmt.Errorf("jobsCollection.Find error: %w", err)
+	}
+
+	var dbJobs []*dbJob
+	err = cur.All(mdb.ctx, &dbJobs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode retrieved jobs: %w", err)
+	}
+
+	cur, err = mdb.jobLocksCollection.Find(mdb.ctx, bson.M{expiresAtKey: bson.M{"$gt": time.Now()}})
+	if err != nil {
+		return nil, fmt.Errorf("jobLocksCollection.Find error: %w", err)
+	}
+
+	var dbLocks []*dbJobLock
+	err = cur.All(mdb.ctx, &dbLocks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode retrieved job locks: %w", err)
+	}
+
+	locks := make(map[string]*dbJobLock, len(dbLocks))
+	for _, lock := range dbLocks {
+		locks[lock.Name] = lock
+	}
+
+	jobs := make([]*db.Job, 0, len(dbJobs))
+	for _, job := range dbJobs {
+		jobs = append(jobs, job.info(locks[job.Name]))
+		delete(locks, job.Name)
+	}
+
+	// Jobs that are running for the first time have a lock but no status.
+	for _, lock := range dbLocks {
+		if _, ok := locks[lock.Name]; ok {
+			jobs = append(jobs, (&dbJob{Name: lock.Name}).info(lock))
+		}
+	}
+
+	return jobs, nil
+}
+
+// PurgeDeliveredRecords deletes the reminders that were delivered and the
+// webhook deliveries that succeeded or failed before the provided unix time.
+// Returns the number of records deleted.
+func (mdb *MongoDB) PurgeDeliveredRecords(before int64) (int64, error) {
+	if before <= 0 {
+		return 0, fmt.Errorf("%w: invalid purge time", db.ErrorInvalidRequest)
+	}
+
+	res, err := mdb.remindersCollection.DeleteMany(mdb.ctx, bson.M{
+		deliveredKey:   true,
+		deliveredAtKey: bson.M{"$lt": before},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("remindersCollection.DeleteMany error: %w", err)
+	}
+	purged := res.DeletedCount
+
+	res, err = mdb.deliveriesCollection.DeleteMany(mdb.ctx, bson.M{
+		statusKey:        bson.M{"$ne": db.DeliveryStatusPending},
+		lastAttemptAtKey: bson.M{"$lt": before},
+	})
+	if err != nil {
+		return purged, fmt.Errorf("deliveriesCollection.DeleteMany error: %w", err)
+	}
+
+	return purged + res.DeletedCount, nil
+}
+
+// info returns the public status of a job that is locked by lock, which may
+// be nil.
+func (j *dbJob) info(lock *dbJobLock) *db.Job {
+	job := &db.Job{
+		Name:           j.Name,
+		LastRunBy:      j.LastRunBy,
+		LastStartedAt:  j.LastStartedAt,
+		LastFinishedAt: j.LastFinishedAt,
+		LastDuration:   j.LastDuration,
+		LastError:      j.LastError,
+		Runs:           j.Runs,
+		Failures:       j.Failures,
+	}
+
+	if lock != nil {
+		job.Owner = lock.Owner
+		job.LockedUntil = lock.ExpiresAt.Unix()
+	}
+
+	return job
+}
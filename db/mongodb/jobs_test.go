@@ -0,0 +1,165 @@
+package mongodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestAcquireJobLock(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name         string
+		owner        string
+		response     bson.D
+		wantAcquired bool
+		wantErr      bool
+	}{
+		{name: "lock acquired or renewed", owner: "server", response: mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}), wantAcquired: true},
+		{name: "lock held by another server", owner: "server", response: mtest.CreateWriteErrorsResponse(mtest.WriteError{Code: 11000, Message: "duplicate key"})},
+		{name: "database error", owner: "server", response: mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "failed"}), wantErr: true},
+		{name: "missing owner", wantErr: true},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			if test.response != nil {
+				mt.AddMockResponses(test.response)
+			}
+
+			acquired, err := newMockMongoDB(mt).AcquireJobLock("job", test.owner, time.Minute)
+			if (err != nil) != test.wantErr {
+				mt.Fatalf("want error %v, got %v", test.wantErr, err)
+			}
+			if acquired != test.wantAcquired {
+				mt.Fatalf("want acquired %v, got %v", test.wantAcquired, acquired)
+			}
+			if test.response == nil {
+				return
+			}
+
+			// The lock is only taken over from the same owner or once it
+			// has expired, and is created if it does not exist.
+			update := sentCommand(mt, "update", jobLocksCollection).Lookup("updates").Array().Index(0).Value().Document()
+			if !update.Lookup("upsert").Boolean() {
+				mt.Fatal("want lock upserted")
+			}
+			or := update.Lookup("q", "$or").Array()
+			if owner := or.Index(0).Value().Document().Lookup(ownerKey).StringValue(); owner != test.owner {
+				mt.Fatalf("want lock of %s renewed, got %s", test.owner, owner)
+			}
+			if _, err := or.Index(1).Value().Document().LookupErr(expiresAtKey, "$lte"); err != nil {
+				mt.Fatalf("want expired lock acquired, got %v", or)
+			}
+		})
+	}
+}
+
+func TestRecordJobRun(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name         string
+		run          *db.JobRun
+		wantFailures int32
+	}{
+		{"successful run", &db.JobRun{Owner: "server", StartedAt: 1000, FinishedAt: 3500}, 0},
+		{"failed run", &db.JobRun{Owner: "server", StartedAt: 1000, FinishedAt: 3500, Error: "failed"}, 1},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			mt.AddMockResponses(mockWritten(1))
+
+			if err := newMockMongoDB(mt).RecordJobRun("job", test.run); err != nil {
+				mt.Fatalf("RecordJobRun error: %v", err)
+			}
+
+			update := sentCommand(mt, "update", jobsCollection).Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+			if failures := update.Lookup("$inc", failuresKey).Int32(); failures != test.wantFailures {
+				mt.Fatalf("want %d failures added, got %d", test.wantFailures, failures)
+			}
+			if duration := update.Lookup("$set", lastDurationKey).Int64(); duration != 2500 {
+				mt.Fatalf("want duration 2500, got %d", duration)
+			}
+			if startedAt := update.Lookup("$set", lastStartedAtKey).Int64(); startedAt != 1 {
+				mt.Fatalf("want start time in seconds, got %d", startedAt)
+			}
+		})
+	}
+}
+
+func TestJobs(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	lockedUntil := time.Now().Add(time.Minute).Truncate(time.Second)
+
+	tests := []struct {
+		name  string
+		jobs  []any
+		locks []any
+		// wantJobs are the names and owners of the jobs returned.
+		wantJobs []string
+	}{
+		{"no jobs", nil, nil, nil},
+		{"unlocked job", []any{&dbJob{Name: "purge", Runs: 1}}, nil, []string{"purge "}},
+		{"locked job", []any{&dbJob{Name: "purge", Runs: 1}}, []any{&dbJobLock{Name: "purge", Owner: "server", ExpiresAt: lockedUntil}}, []string{"purge server"}},
+		{"job running for the first time", []any{&dbJob{Name: "purge", Runs: 1}}, []any{&dbJobLock{Name: "reminders", Owner: "server", ExpiresAt: lockedUntil}}, []string{"purge ", "reminders server"}},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			mt.AddMockResponses(mockFound(mt, jobsCollection, test.jobs...), mockFound(mt, jobLocksCollection, test.locks...))
+
+			jobs, err := newMockMongoDB(mt).Jobs()
+			if err != nil {
+				mt.Fatalf("Jobs error: %v", err)
+			}
+			if len(jobs) != len(test.wantJobs) {
+				mt.Fatalf("want %d jobs, got %d", len(test.wantJobs), len(jobs))
+			}
+			for i, job := range jobs {
+				if got := job.Name + " " + job.Owner; got != test.wantJobs[i] {
+					mt.Fatalf("want job %q, got %q", test.wantJobs[i], got)
+				}
+				if job.Owner != "" && job.LockedUntil != lockedUntil.Unix() {
+					mt.Fatalf("want job locked until %d, got %d", lockedUntil.Unix(), job.LockedUntil)
+				}
+			}
+		})
+	}
+}
+
+func TestPurgeDeliveredRecords(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name       string
+		before     int64
+		responses  []bson.D
+		wantPurged int64
+		wantErr    bool
+	}{
+		{"invalid time", 0, nil, 0, true},
+		{"reminders and deliveries", 100, []bson.D{mockWritten(2), mockWritten(3)}, 5, false},
+		{"deliveries fail", 100, []bson.D{mockWritten(2), mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "failed"})}, 2, true},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			mt.AddMockResponses(test.responses...)
+
+			purged, err := newMockMongoDB(mt).PurgeDeliveredRecords(test.before)
+			if (err != nil) != test.wantErr {
+				mt.Fatalf("want error %v, got %v", test.wantErr, err)
+			}
+			if purged != test.wantPurged {
+				mt.Fatalf("want %d records purged, got %d", test.wantPurged, purged)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package mongodb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"github.com/ukane-philemon/megtask/webserver"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Check that *MongoDB satisfies webserver.LoginAttemptStore.
+var _ webserver.LoginAttemptStore = (*MongoDB)(nil)
+
+// LoginAttempts returns the failed login attempts recorded for key within the
+// window provided when they were recorded. A zero value is returned if no
+// failed attempts have been recorded.
+func (mdb *MongoDB) LoginAttempts(key string) (*db.LoginAttempts, error) {
+	filter := bson.M{
+		dbIDKey:      key,
+		expiresAtKey: bson.M{"$gt": time.Now()},
+	}
+
+	var attempts *dbLoginAttempts
+	err := mdb.loginAttemptsCollection.FindOne(mdb.ctx, filter).Decode(&attempts)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return &db.LoginAttempts{}, nil
+		}
+		return nil, fmt.Errorf("loginAttemptsCollection.FindOne error: %w", err)
+	}
+
+	return &db.LoginAttempts{
+		Failures:    attempts.Failures,
+		LastFailure: attempts.LastFailure,
+	}, nil
+}
+
+// RecordLoginFailure records a failed login attempt for key and returns the
+// updated attempts. Failures are forgotten once window has passed since the
+// last failure.
+func (mdb *MongoDB) RecordLoginFailure(key string, window time.Duration) (*db.LoginAttempts, error) {
+	now := time.Now()
+
+	// Use an update pipeline so the failure count is restarted atomically if
+	// the previous failures have expired but have not been removed yet.
+	update := mongo.Pipeline{{{
+		Key: "$set",
+		Value: bson.M{
+			failuresKey: bson.M{
+				"$cond": bson.A{
+					bson.M{"$gt": bson.A{"$" + expiresAtKey, now}},
+					bson.M{"$add": bson.A{"$" + failuresKey, 1}},
+					1,
+				},
+			},
+			lastFailureKey: now.Unix(),
+			expiresAtKey:   now.Add(window),
+		},
+	}}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var attempts *dbLoginAttempts
+	err := mdb.loginAttemptsCollection.FindOneAndUpdate(mdb.ctx, bson.M{dbIDKey: key}, update, opts).Decode(&attempts)
+	if err != nil {
+		return nil, fmt.Errorf("loginAttemptsCollection.FindOneAndUpdate error: %w", err)
+	}
+
+	return &db.LoginAttempts{
+		Failures:    attempts.Failures,
+		LastFailure: attempts.LastFailure,
+	}, nil
+}
+
+// RefundLoginAttempt removes one failed login attempt recorded for key.
+func (mdb *MongoDB) RefundLoginAttempt(key string) error {
+	filter := bson.M{
+		dbIDKey:     key,
+		failuresKey: bson.M{"$gt": 0},
+	}
+	_, err := mdb.loginAttemptsCollection.UpdateOne(mdb.ctx, filter, bson.M{"$inc": bson.M{failuresKey: -1}})
+	if err != nil {
+		return fmt.Errorf("loginAttemptsCollection.UpdateOne error: %w", err)
+	}
+	return nil
+}
+
+// ResetLoginAttempts removes the failed login attempts recorded for key.
+func (mdb *MongoDB) ResetLoginAttempts(key string) error {
+	_, err := mdb.loginAttemptsCollection.DeleteOne(mdb.ctx, bson.M{dbIDKey: key})
+	if err != nil {
+		return fmt.Errorf("loginAttemptsCollection.DeleteOne error: %w", err)
+	}
+	return nil
+}
@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"sync"
 
+	"github.com/ukane-philemon/megtask/db"
 	"github.com/ukane-philemon/megtask/webserver"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -16,27 +18,131 @@ import (
 const (
 	taskDB = "megTasks"
 
-	usersCollection = "users"
-	taskCollection  = "tasks"
+	usersCollection         = "users"
+	taskCollection          = "tasks"
+	userTokensCollection    = "userTokens"
+	apiTokensCollection     = "apiTokens"
+	loginAttemptsCollection = "loginAttempts"
+	sessionsCollection      = "sessions"
+	sharesCollection        = "shares"
+	workspacesCollection    = "workspaces"
+	membersCollection       = "workspaceMembers"
+	taskHistoryCollection   = "taskHistory"
+	commentsCollection      = "comments"
+	attachmentsCollection   = "attachments"
+	webhooksCollection      = "webhooks"
+	deliveriesCollection    = "webhookDeliveries"
+	tombstonesCollection    = "taskTombstones"
+	remindersCollection     = "reminders"
+	jobLocksCollection      = "jobLocks"
+	jobsCollection          = "jobs"
+	feedTokensCollection    = "feedTokens"
 
 	// Keys
-	dbIDKey       = "_id"
-	usernameKey   = "username"
-	ownerIDKey    = "ownerID"
-	completedKey  = "completed"
-	taskDetailKey = "detail"
+	dbIDKey              = "_id"
+	usernameKey          = "username"
+	emailKey             = "email"
+	emailVerifiedKey     = "emailVerified"
+	totpPendingSecretKey = "totpPendingSecret"
+	totpSecretKey        = "totpSecret"
+	totpEnabledKey       = "totpEnabled"
+	totpLastStepKey      = "totpLastStep"
+	recoveryCodesKey     = "recoveryCodes"
+	oidcIssuerKey        = "oidcIssuer"
+	oidcSubjectKey       = "oidcSubject"
+	passwordKey          = "password"
+	roleKey              = "role"
+	disabledKey          = "disabled"
+	mustResetPasswordKey = "mustResetPassword"
+	createdAtKey         = "createdAt"
+	userIDKey            = "userID"
+	purposeKey           = "purpose"
+	tokenHashKey         = "tokenHash"
+	expiresAtKey         = "expiresAt"
+	lastUsedAtKey        = "lastUsedAt"
+	lastSeenAtKey        = "lastSeenAt"
+	failuresKey          = "failures"
+	lastFailureKey       = "lastFailure"
+	ownerIDKey           = "ownerID"
+	completedKey         = "completed"
+	taskDetailKey        = "detail"
+	projectKey           = "project"
+	taskIDKey            = "taskID"
+	permissionKey        = "permission"
+	workspaceIDKey       = "workspaceID"
+	invitedKey           = "invited"
+	nameKey              = "name"
+	assigneeIDKey        = "assigneeID"
+	timestampKey         = "timestamp"
+	parentIDKey          = "parentID"
+	authorIDKey          = "authorID"
+	bodyKey              = "body"
+	deletedKey           = "deleted"
+	updatedAtKey         = "updatedAt"
+	uploaderIDKey        = "uploaderID"
+	sizeKey              = "size"
+	eventsKey            = "events"
+	webhookIDKey         = "webhookID"
+	statusKey            = "status"
+	attemptsKey          = "attempts"
+	responseStatusKey    = "responseStatus"
+	errorKey             = "error"
+	nextAttemptAtKey     = "nextAttemptAt"
+	lastAttemptAtKey     = "lastAttemptAt"
+	fieldTimesKey        = "fieldTimes"
+	clientIDKey          = "clientID"
+	previousIDKey        = "previousID"
+	deletedAtKey         = "deletedAt"
+	dueAtKey             = "dueAt"
+	remindAtKey          = "remindAt"
+	offsetKey            = "offset"
+	deliveredKey         = "delivered"
+	deliveredAtKey       = "deliveredAt"
+	claimedUntilKey      = "claimedUntil"
+	ownerKey             = "owner"
+	lastRunByKey         = "lastRunBy"
+	lastStartedAtKey     = "lastStartedAt"
+	lastFinishedAtKey    = "lastFinishedAt"
+	lastDurationKey      = "lastDuration"
+	lastErrorKey         = "lastError"
+	runsKey              = "runs"
+	tagsKey              = "tags"
+	recurrenceKey        = "recurrence"
 )
 
 // Check that *MongoDB satisfies webserver.TaskDatabase.
 var _ webserver.TaskDatabase = (*MongoDB)(nil)
 
+// Check that *MongoDB satisfies webserver.TaskChangeSource.
+var _ webserver.TaskChangeSource = (*MongoDB)(nil)
+
 // MongoDB implements webserver.TaskDatabase.
 type MongoDB struct {
-	ctx             context.Context
-	db              *mongo.Database
-	usersCollection *mongo.Collection
-	tasksCollection *mongo.Collection
-	log             *slog.Logger
+	ctx                     context.Context
+	db                      *mongo.Database
+	usersCollection         *mongo.Collection
+	tasksCollection         *mongo.Collection
+	userTokensCollection    *mongo.Collection
+	apiTokensCollection     *mongo.Collection
+	loginAttemptsCollection *mongo.Collection
+	sessionsCollection      *mongo.Collection
+	sharesCollection        *mongo.Collection
+	workspacesCollection    *mongo.Collection
+	membersCollection       *mongo.Collection
+	taskHistoryCollection   *mongo.Collection
+	commentsCollection      *mongo.Collection
+	attachmentsCollection   *mongo.Collection
+	webhooksCollection      *mongo.Collection
+	deliveriesCollection    *mongo.Collection
+	tombstonesCollection    *mongo.Collection
+	remindersCollection     *mongo.Collection
+	jobLocksCollection      *mongo.Collection
+	jobsCollection          *mongo.Collection
+	feedTokensCollection    *mongo.Collection
+	log                     *slog.Logger
+
+	changesMtx        sync.Mutex
+	changeSubscribers map[chan *db.TaskChange]struct{}
 }
 
 // New connects to a mongo database and returns a new instance of *MongoDB.
@@ -76,12 +182,360 @@ func New(ctx context.Context, connectionURL string, logger *slog.Logger) (*Mongo
 		Options: options.Index().SetUnique(true),
 	})
 
+	// Emails are optional but must be unique when provided.
+	usersCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{
+			Key:   emailKey,
+			Value: 1,
+		}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+			emailKey: bson.M{"$exists": true},
+		}),
+	})
+
+	// Each identity provider account can only be linked to one user.
+	usersCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{
+			Key:   oidcIssuerKey,
+			Value: 1,
+		}, {
+			Key:   oidcSubjectKey,
+			Value: 1,
+		}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+			oidcSubjectKey: bson.M{"$exists": true},
+		}),
+	})
+
+	// User tokens are looked up by their hash and are removed by the database
+	// once they expire.
+	userTokensCollection := db.Collection(userTokensCollection)
+	userTokensCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{{
+		Keys: bson.D{{
+			Key:   tokenHashKey,
+			Value: 1,
+		}},
+		Options: options.Index().SetUnique(true),
+	}, {
+		Keys: bson.D{{
+			Key:   expiresAtKey,
+			Value: 1,
+		}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}})
+
+	// API tokens are looked up by their hash on every request they are used
+	// for and are removed by the database once they expire.
+	apiTokensCollection := db.Collection(apiTokensCollection)
+	apiTokensCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{{
+		Keys: bson.D{{
+			Key:   tokenHashKey,
+			Value: 1,
+		}},
+		Options: options.Index().SetUnique(true),
+	}, {
+		Keys: bson.D{{
+			Key:   expiresAtKey,
+			Value: 1,
+		}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}})
+
+	// Feed tokens are looked up by their hash on every feed request and are
+	// listed per user.
+	feedTokensCollection := db.Collection(feedTokensCollection)
+	feedTokensCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{{
+		Keys: bson.D{{
+			Key:   tokenHashKey,
+			Value: 1,
+		}},
+		Options: options.Index().SetUnique(true),
+	}, {
+		Keys: bson.D{{
+			Key:   userIDKey,
+			Value: 1,
+		}},
+	}})
+
+	// Failed login attempts are removed by the database once they expire.
+	loginAttemptsCollection := db.Collection(loginAttemptsCollection)
+	loginAttemptsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{
+			Key:   expiresAtKey,
+			Value: 1,
+		}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+
+	// Sessions are listed per user and are removed by the database once they
+	// expire.
+	sessionsCollection := db.Collection(sessionsCollection)
+	sessionsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{{
+		Keys: bson.D{{
+			Key:   userIDKey,
+			Value: 1,
+		}},
+	}, {
+		Keys: bson.D{{
+			Key:   expiresAtKey,
+			Value: 1,
+		}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}})
+
+	// Shares are looked up by collaborator and each task or project can only
+	// be shared once with a collaborator.
+	sharesCollection := db.Collection(sharesCollection)
+	sharesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{{
+		Keys: bson.D{{
+			Key:   userIDKey,
+			Value: 1,
+		}},
+	}, {
+		Keys: bson.D{{
+			Key:   taskIDKey,
+			Value: 1,
+		}, {
+			Key:   userIDKey,
+			Value: 1,
+		}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+			taskIDKey: bson.M{"$exists": true},
+		}),
+	}, {
+		Keys: bson.D{{
+			Key:   ownerIDKey,
+			Value: 1,
+		}, {
+			Key:   projectKey,
+			Value: 1,
+		}, {
+			Key:   userIDKey,
+			Value: 1,
+		}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+			projectKey: bson.M{"$exists": true},
+		}),
+	}})
+
+	// Workspace tasks are listed per workspace, assigned tasks are listed
+	// per assignee and changed tasks are listed per owner for sync. A client
+	// can only create one task with each of its client IDs. Completed
+	// recurring tasks are listed to create their next occurrence, which is
+	// only created once.
+	tasksCollection := db.Collection(taskCollection)
+	tasksCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{{
+		Keys: bson.D{{
+			Key:   workspaceIDKey,
+			Value: 1,
+		}},
+		Options: options.Index().SetPartialFilterExpression(bson.M{
+			workspaceIDKey: bson.M{"$exists": true},
+		}),
+	}, {
+		Keys: bson.D{{
+			Key:   assigneeIDKey,
+			Value: 1,
+		}},
+		Options: options.Index().SetPartialFilterExpression(bson.M{
+			assigneeIDKey: bson.M{"$exists": true},
+		}),
+	}, {
+		Keys: bson.D{{
+			Key:   ownerIDKey,
+			Value: 1,
+		}, {
+			Key:   updatedAtKey,
+			Value: 1,
+		}},
+	}, {
+		Keys: bson.D{{
+			Key:   ownerIDKey,
+			Value: 1,
+		}, {
+			Key:   clientIDKey,
+			Value: 1,
+		}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+			clientIDKey: bson.M{"$exists": true},
+		}),
+	}, {
+		Keys: bson.D{{
+			Key:   completedKey,
+			Value: 1,
+		}},
+		Options: options.Index().SetPartialFilterExpression(bson.M{
+			recurrenceKey: bson.M{"$exists": true},
+		}),
+	}, {
+		Keys: bson.D{{
+			Key:   previousIDKey,
+			Value: 1,
+		}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+			previousIDKey: bson.M{"$exists": true},
+		}),
+	}})
+
+	// Task history is listed per task.
+	taskHistoryCollection := db.Collection(taskHistoryCollection)
+	taskHistoryCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{
+			Key:   taskIDKey,
+			Value: 1,
+		}},
+	})
+
+	// Comments are listed and counted per task.
+	commentsCollection := db.Collection(commentsCollection)
+	commentsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{
+			Key:   taskIDKey,
+			Value: 1,
+		}, {
+			Key:   createdAtKey,
+			Value: 1,
+		}},
+	})
+
+	// Attachments are listed per task and their sizes are summed per
+	// uploader to enforce quotas.
+	attachmentsCollection := db.Collection(attachmentsCollection)
+	attachmentsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{{
+		Keys: bson.D{{
+			Key:   taskIDKey,
+			Value: 1,
+		}},
+	}, {
+		Keys: bson.D{{
+			Key:   uploaderIDKey,
+			Value: 1,
+		}},
+	}})
+
+	// Webhooks are listed per user and matched by user when events are
+	// queued.
+	webhooksCollection := db.Collection(webhooksCollection)
+	webhooksCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{
+			Key:   userIDKey,
+			Value: 1,
+		}},
+	})
+
+	// Deliveries are listed per webhook, newest first, and pending deliveries
+	// are claimed in the order they are due.
+	deliveriesCollection := db.Collection(deliveriesCollection)
+	deliveriesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{{
+		Keys: bson.D{{
+			Key:   webhookIDKey,
+			Value: 1,
+		}, {
+			Key:   createdAtKey,
+			Value: -1,
+		}},
+	}, {
+		Keys: bson.D{{
+			Key:   statusKey,
+			Value: 1,
+		}, {
+			Key:   nextAttemptAtKey,
+			Value: 1,
+		}},
+	}})
+
+	// Tombstones are listed per owner in the order tasks were deleted and
+	// are removed by the database once they expire.
+	tombstonesCollection := db.Collection(tombstonesCollection)
+	tombstonesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{{
+		Keys: bson.D{{
+			Key:   ownerIDKey,
+			Value: 1,
+		}, {
+			Key:   deletedAtKey,
+			Value: 1,
+		}},
+	}, {
+		Keys: bson.D{{
+			Key:   expiresAtKey,
+			Value: 1,
+		}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}})
+
+	// Reminders are listed per task and user, and undelivered reminders are
+	// claimed in the order they are due.
+	remindersCollection := db.Collection(remindersCollection)
+	remindersCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{{
+		Keys: bson.D{{
+			Key:   taskIDKey,
+			Value: 1,
+		}, {
+			Key:   userIDKey,
+			Value: 1,
+		}},
+	}, {
+		Keys: bson.D{{
+			Key:   deliveredKey,
+			Value: 1,
+		}, {
+			Key:   remindAtKey,
+			Value: 1,
+		}},
+	}})
+
+	// Job locks are removed once they expire. Expired locks that have not
+	// been removed yet are ignored.
+	jobLocksCollection := db.Collection(jobLocksCollection)
+	jobLocksCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{
+			Key:   expiresAtKey,
+			Value: 1,
+		}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+
+	// A user can only be a member of or be invited to a workspace once.
+	membersCollection := db.Collection(membersCollection)
+	membersCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{{
+		Keys: bson.D{{
+			Key:   workspaceIDKey,
+			Value: 1,
+		}, {
+			Key:   userIDKey,
+			Value: 1,
+		}},
+		Options: options.Index().SetUnique(true),
+	}, {
+		Keys: bson.D{{
+			Key:   userIDKey,
+			Value: 1,
+		}},
+	}})
+
 	return &MongoDB{
-		ctx:             ctx,
-		db:              db,
-		usersCollection: usersCollection,
-		tasksCollection: db.Collection(taskCollection),
-		log:             logger,
+		ctx:                     ctx,
+		db:                      db,
+		usersCollection:         usersCollection,
+		tasksCollection:         tasksCollection,
+		userTokensCollection:    userTokensCollection,
+		apiTokensCollection:     apiTokensCollection,
+		loginAttemptsCollection: loginAttemptsCollection,
+		sessionsCollection:      sessionsCollection,
+		sharesCollection:        sharesCollection,
+		workspacesCollection:    db.Collection(workspacesCollection),
+		membersCollection:       membersCollection,
+		taskHistoryCollection:   taskHistoryCollection,
+		commentsCollection:      commentsCollection,
+		attachmentsCollection:   attachmentsCollection,
+		webhooksCollection:      webhooksCollection,
+		deliveriesCollection:    deliveriesCollection,
+		tombstonesCollection:    tombstonesCollection,
+		remindersCollection:     remindersCollection,
+		jobLocksCollection:      jobLocksCollection,
+		jobsCollection:          db.Collection(jobsCollection),
+		feedTokensCollection:    feedTokensCollection,
+		log:                     logger,
 	}, nil
 }
 
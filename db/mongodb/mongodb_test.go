@@ -0,0 +1,126 @@
+package mongodb
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// newMockMongoDB returns a *MongoDB that sends its commands to the mock
+// deployment of mt. The responses to the commands must be added to mt in the
+// order the commands are sent.
+func newMockMongoDB(mt *mtest.T) *MongoDB {
+	return &MongoDB{
+		ctx:                     context.Background(),
+		db:                      mt.DB,
+		usersCollection:         mt.DB.Collection(usersCollection),
+		tasksCollection:         mt.DB.Collection(taskCollection),
+		userTokensCollection:    mt.DB.Collection(userTokensCollection),
+		apiTokensCollection:     mt.DB.Collection(apiTokensCollection),
+		loginAttemptsCollection: mt.DB.Collection(loginAttemptsCollection),
+		sessionsCollection:      mt.DB.Collection(sessionsCollection),
+		sharesCollection:        mt.DB.Collection(sharesCollection),
+		workspacesCollection:    mt.DB.Collection(workspacesCollection),
+		membersCollection:       mt.DB.Collection(membersCollection),
+		taskHistoryCollection:   mt.DB.Collection(taskHistoryCollection),
+		commentsCollection:      mt.DB.Collection(commentsCollection),
+		attachmentsCollection:   mt.DB.Collection(attachmentsCollection),
+		webhooksCollection:      mt.DB.Collection(webhooksCollection),
+		deliveriesCollection:    mt.DB.Collection(deliveriesCollection),
+		tombstonesCollection:    mt.DB.Collection(tombstonesCollection),
+		remindersCollection:     mt.DB.Collection(remindersCollection),
+		jobLocksCollection:      mt.DB.Collection(jobLocksCollection),
+		jobsCollection:          mt.DB.Collection(jobsCollection),
+		feedTokensCollection:    mt.DB.Collection(feedTokensCollection),
+		log:                     slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+// mockFound returns the response to a find command on collection that
+// returns docs.
+func mockFound(mt *mtest.T, collection string, docs ...any) bson.D {
+	mt.Helper()
+
+	batch := make([]bson.D, 0, len(docs))
+	for _, doc := range docs {
+		batch = append(batch, mockDoc(mt, doc))
+	}
+
+	return mtest.CreateCursorResponse(0, taskDB+"."+collection, mtest.FirstBatch, batch...)
+}
+
+// mockDoc returns doc as it is sent by the server.
+func mockDoc(mt *mtest.T, doc any) bson.D {
+	mt.Helper()
+
+	b, err := bson.Marshal(doc)
+	if err != nil {
+		mt.Fatalf("bson.Marshal error: %v", err)
+	}
+
+	var d bson.D
+	if err := bson.Unmarshal(b, &d); err != nil {
+		mt.Fatalf("bson.Unmarshal error: %v", err)
+	}
+	return d
+}
+
+// mockCounted returns the response to the aggregate command sent to count
+// n documents in collection.
+func mockCounted(mt *mtest.T, collection string, n int) bson.D {
+	return mtest.CreateCursorResponse(0, taskDB+"."+collection, mtest.FirstBatch, bson.D{{Key: "n", Value: n}})
+}
+
+// mockTaskPermission returns the responses to the commands that find task
+// and the permission of the user with the provided userID on it. Workspace
+// tasks are edited by members and read by viewers.
+func mockTaskPermission(mt *mtest.T, task *dbTask, userID, permission string) []bson.D {
+	mt.Helper()
+
+	responses := []bson.D{mockFound(mt, taskCollection, task)}
+	if task.WorkspaceID != "" {
+		role := db.WorkspaceRoleMember
+		if permission == db.PermissionRead {
+			role = db.WorkspaceRoleViewer
+		}
+		member := &dbWorkspaceMember{ID: primitive.NewObjectID(), WorkspaceID: task.WorkspaceID, UserID: userID, Role: role}
+		return append(responses, mockFound(mt, membersCollection, member))
+	}
+
+	share := &dbShare{ID: primitive.NewObjectID(), OwnerID: task.OwnerID, TaskID: task.ID.Hex(), UserID: userID, Permission: permission}
+	return append(responses, mockFound(mt, sharesCollection, share))
+}
+
+// mockFoundAndModified returns the response to a findAndModify command that
+// found doc, or no document if doc is nil.
+func mockFoundAndModified(mt *mtest.T, doc any) bson.D {
+	mt.Helper()
+
+	if doc == nil {
+		return mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil})
+	}
+	return mtest.CreateSuccessResponse(bson.E{Key: "value", Value: mockDoc(mt, doc)})
+}
+
+// mockWritten returns the response to a write command that matched and
+// modified n documents.
+func mockWritten(n int) bson.D {
+	return mtest.CreateSuccessResponse(bson.E{Key: "n", Value: n}, bson.E{Key: "nModified", Value: n})
+}
+
+// sentCommand returns the last command named name that was sent to
+// collection, or nil if there is none.
+func sentCommand(mt *mtest.T, name, collection string) bson.Raw {
+	var command bson.Raw
+	for _, event := range mt.GetAllStartedEvents() {
+		if event.CommandName == name && event.Command.Lookup(name).StringValue() == collection {
+			command = event.Command
+		}
+	}
+	return command
+}
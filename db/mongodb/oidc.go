@@ -0,0 +1,122 @@
+package mongodb
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// nonAlphanumericRegex matches characters that are not allowed in usernames.
+var nonAlphanumericRegex = regexp.MustCompile("[^a-zA-Z0-9]+")
+
+// OIDCLogin returns the user linked to the provided identity provider account.
+// If no user is linked to the account, a new user without a password is
+// created using the preferred username and email. The email is only saved if
+// it has been verified by the identity provider and is not used by another
+// user. Returns ErrorInvalidRequest if the linked user is disabled or must
+// reset their password.
+func (mdb *MongoDB) OIDCLogin(issuer, subject, preferredUsername, email string, emailVerified bool) (*db.User, error) {
+	if issuer == "" || subject == "" {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	filter := bson.M{
+		oidcIssuerKey:  issuer,
+		oidcSubjectKey: subject,
+	}
+
+	var user *dbUser
+	err := mdb.usersCollection.FindOne(mdb.ctx, filter).Decode(&user)
+	if err == nil {
+		if err := checkCanLogin(user); err != nil {
+			return nil, err
+		}
+		if err := checkNoPasswordReset(user); err != nil {
+			return nil, err
+		}
+		return mdb.userInfo(user), nil
+	}
+
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("usersCollection.FindOne error: %w", err)
+	}
+
+	user = &dbUser{
+		OIDCIssuer:  issuer,
+		OIDCSubject: subject,
+		CreatedAt:   time.Now().Unix(),
+	}
+
+	if emailVerified && email != "" {
+		user.Email = strings.ToLower(email)
+		user.EmailVerified = true
+	}
+
+	baseUsername := nonAlphanumericRegex.ReplaceAllString(preferredUsername, "")
+	if baseUsername == "" {
+		localPart, _, _ := strings.Cut(email, "@")
+		baseUsername = nonAlphanumericRegex.ReplaceAllString(localPart, "")
+	}
+	if baseUsername == "" {
+		baseUsername = "user"
+	}
+
+	// Retry with a random suffix if the username is taken.
+	const maxAttempts = 5
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		user.ID = primitive.NewObjectID()
+		user.Username = baseUsername
+		if attempt > 0 {
+			suffix, err := rand.Int(rand.Reader, big.NewInt(100000))
+			if err != nil {
+				return nil, fmt.Errorf("rand.Int error: %w", err)
+			}
+			user.Username = fmt.Sprintf("%s%d", baseUsername, suffix)
+		}
+
+		_, err = mdb.usersCollection.InsertOne(mdb.ctx, user)
+		if err == nil {
+			return mdb.userInfo(user), nil
+		}
+
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, fmt.Errorf("usersCollection.InsertOne error: %w", err)
+		}
+
+		// The identity provider account may have been linked by a concurrent
+		// login.
+		var linkedUser *dbUser
+		err = mdb.usersCollection.FindOne(mdb.ctx, filter).Decode(&linkedUser)
+		if err == nil {
+			return mdb.userInfo(linkedUser), nil
+		}
+
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("usersCollection.FindOne error: %w", err)
+		}
+
+		// Do not link an email that is used by another user.
+		if user.Email != "" {
+			nEmailUsers, err := mdb.usersCollection.CountDocuments(mdb.ctx, bson.M{emailKey: user.Email})
+			if err != nil {
+				return nil, fmt.Errorf("usersCollection.CountDocuments error: %w", err)
+			}
+
+			if nEmailUsers > 0 {
+				user.Email = ""
+				user.EmailVerified = false
+			}
+		}
+	}
+
+	return nil, errors.New("failed to create a unique username for identity provider user")
+}
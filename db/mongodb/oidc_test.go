@@ -0,0 +1,147 @@
+package mongodb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestOIDCLogin(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	const (
+		issuer  = "https://idp.example.com"
+		subject = "subject"
+	)
+	linkedUser := func(modify func(*dbUser)) *dbUser {
+		user := &dbUser{ID: primitive.NewObjectID(), Username: "linked", OIDCIssuer: issuer, OIDCSubject: subject}
+		if modify != nil {
+			modify(user)
+		}
+		return user
+	}
+	duplicateKey := mtest.CreateWriteErrorsResponse(mtest.WriteError{Code: 11000, Message: "duplicate key"})
+
+	tests := []struct {
+		name              string
+		preferredUsername string
+		email             string
+		emailVerified     bool
+		// linked is the user linked to the account, if any.
+		linked *dbUser
+		// responses returns the responses to the commands sent to create a
+		// user if no user is linked.
+		responses func(mt *mtest.T) []bson.D
+		// wantUsername is the username of the returned user, or its prefix
+		// if it is taken.
+		wantUsername string
+		wantTaken    bool
+		wantEmail    string
+		wantErr      bool
+	}{{
+		name:         "linked user",
+		linked:       linkedUser(nil),
+		wantUsername: "linked",
+	}, {
+		name:    "linked user is disabled",
+		linked:  linkedUser(func(user *dbUser) { user.Disabled = true }),
+		wantErr: true,
+	}, {
+		name:    "linked user must reset their password",
+		linked:  linkedUser(func(user *dbUser) { user.MustResetPassword = true }),
+		wantErr: true,
+	}, {
+		name:              "new user with a verified email",
+		preferredUsername: "jane.doe",
+		email:             "Jane@Example.com",
+		emailVerified:     true,
+		responses: func(mt *mtest.T) []bson.D {
+			return []bson.D{mtest.CreateSuccessResponse()}
+		},
+		wantUsername: "janedoe",
+		wantEmail:    "jane@example.com",
+	}, {
+		name:              "new user with an unverified email",
+		preferredUsername: "jane",
+		email:             "jane@example.com",
+		responses: func(mt *mtest.T) []bson.D {
+			return []bson.D{mtest.CreateSuccessResponse()}
+		},
+		wantUsername: "jane",
+	}, {
+		name:          "username from the email",
+		email:         "jane.doe@example.com",
+		emailVerified: true,
+		responses: func(mt *mtest.T) []bson.D {
+			return []bson.D{mtest.CreateSuccessResponse()}
+		},
+		wantUsername: "janedoe",
+		wantEmail:    "jane.doe@example.com",
+	}, {
+		name:              "username is taken",
+		preferredUsername: "jane",
+		email:             "jane@example.com",
+		emailVerified:     true,
+		responses: func(mt *mtest.T) []bson.D {
+			return []bson.D{duplicateKey, mockFound(mt, usersCollection), mockCounted(mt, usersCollection, 0), mtest.CreateSuccessResponse()}
+		},
+		wantUsername: "jane",
+		wantTaken:    true,
+		wantEmail:    "jane@example.com",
+	}, {
+		name:              "email is used by another user",
+		preferredUsername: "jane",
+		email:             "jane@example.com",
+		emailVerified:     true,
+		responses: func(mt *mtest.T) []bson.D {
+			return []bson.D{duplicateKey, mockFound(mt, usersCollection), mockCounted(mt, usersCollection, 1), mtest.CreateSuccessResponse()}
+		},
+		wantUsername: "jane",
+		wantTaken:    true,
+	}, {
+		name:              "linked by a concurrent login",
+		preferredUsername: "jane",
+		responses: func(mt *mtest.T) []bson.D {
+			return []bson.D{duplicateKey, mockFound(mt, usersCollection, linkedUser(nil))}
+		},
+		wantUsername: "linked",
+	}}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			if test.linked != nil {
+				mt.AddMockResponses(mockFound(mt, usersCollection, test.linked))
+			} else {
+				mt.AddMockResponses(mockFound(mt, usersCollection))
+				mt.AddMockResponses(test.responses(mt)...)
+			}
+
+			user, err := newMockMongoDB(mt).OIDCLogin(issuer, subject, test.preferredUsername, test.email, test.emailVerified)
+			if test.wantErr {
+				if !errors.Is(err, db.ErrorInvalidRequest) {
+					mt.Fatalf("want ErrorInvalidRequest, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				mt.Fatalf("OIDCLogin error: %v", err)
+			}
+
+			if test.wantTaken {
+				if user.Username == test.wantUsername || !strings.HasPrefix(user.Username, test.wantUsername) {
+					mt.Fatalf("want a username with prefix %s, got %s", test.wantUsername, user.Username)
+				}
+			} else if user.Username != test.wantUsername {
+				mt.Fatalf("want username %s, got %s", test.wantUsername, user.Username)
+			}
+			if user.Email != test.wantEmail || user.EmailVerified != (test.wantEmail != "") {
+				mt.Fatalf("want email %q, got %q (verified %v)", test.wantEmail, user.Email, user.EmailVerified)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package mongodb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CompletedRecurringTasks returns up to limit completed tasks that still have
+// a recurrence rule, i.e. whose next occurrence has not been created.
+func (mdb *MongoDB) CompletedRecurringTasks(limit int) ([]*db.Task, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("%w: invalid limit", db.ErrorInvalidRequest)
+	}
+
+	filter := bson.M{
+		completedKey:  true,
+		recurrenceKey: bson.M{"$exists": true},
+	}
+	cur, err := mdb.tasksCollection.Find(mdb.ctx, filter, options.Find().SetLimit(int64(limit)))
+	if err != nil {
+		return nil, fmt.Errorf("tasksCollection.Find error: %w", err)
+	}
+
+	var tasks []*dbTask
+	err = cur.All(mdb.ctx, &tasks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode retrieved tasks: %w", err)
+	}
+
+	taskInfos := make([]*db.Task, 0, len(tasks))
+	for _, task := range tasks {
+		taskInfos = append(taskInfos, task.info())
+	}
+
+	return taskInfos, nil
+}
+
+// CreateNextOccurrence creates the next occurrence of the completed recurring
+// task with the provided taskID, due at dueAt and recurring with recurrence,
+// and removes the recurrence rule from the completed task. No task is created
+// if dueAt is zero, which ends the recurrence. The next occurrence is only
+// created once, and is returned again if it already exists. Returns
+// ErrorInvalidRequest if the task does not exist.
+func (mdb *MongoDB) CreateNextOccurrence(taskID string, dueAt int64, recurrence string) (*db.Task, error) {
+	taskDBID, err := primitive.ObjectIDFromHex(taskID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid task ID", db.ErrorInvalidRequest)
+	}
+
+	var task *dbTask
+	err = mdb.tasksCollection.FindOne(mdb.ctx, bson.M{dbIDKey: taskDBID}).Decode(&task)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("%w: task does not exist", db.ErrorInvalidRequest)
+		}
+		return nil, fmt.Errorf("tasksCollection.FindOne error: %w", err)
+	}
+
+	now := time.Now()
+	var nextTask *dbTask
+	if dueAt != 0 {
+		// The filter sets the previous ID of the new task, and matches the
+		// task created by a run that was interrupted before the recurrence
+		// rule of the completed task was removed.
+		newTask := &dbTask{
+			ID:          primitive.NewObjectID(),
+			OwnerID:     task.OwnerID,
+			WorkspaceID: task.WorkspaceID,
+			AssigneeID:  task.AssigneeID,
+			TaskInfo: db.TaskInfo{
+				Detail:     task.Detail,
+				Timestamp:  now.Unix(),
+				Project:    task.Project,
+				DueAt:      dueAt,
+				Tags:       task.Tags,
+				Recurrence: recurrence,
+			},
+			UpdatedAt:  now.UnixMilli(),
+			FieldTimes: newFieldTimes(now.UnixMilli()),
+		}
+
+		opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+		err = mdb.tasksCollection.FindOneAndUpdate(mdb.ctx, bson.M{previousIDKey: taskID}, bson.M{"$setOnInsert": newTask}, opts).Decode(&nextTask)
+		if err != nil {
+			return nil, fmt.Errorf("tasksCollection.FindOneAndUpdate error: %w", err)
+		}
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			updatedAtKey:                         now.UnixMilli(),
+			fieldTimeKey(db.SyncFieldRecurrence): now.UnixMilli(),
+		},
+		"$unset": bson.M{recurrenceKey: ""},
+	}
+	_, err = mdb.tasksCollection.UpdateOne(mdb.ctx, bson.M{dbIDKey: task.ID}, update)
+	if err != nil {
+		return nil, fmt.Errorf("tasksCollection.UpdateOne error: %w", err)
+	}
+
+	if nextTask == nil {
+		return nil, nil
+	}
+
+	return nextTask.info(), nil
+}
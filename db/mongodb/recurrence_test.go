@@ -0,0 +1,142 @@
+package mongodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCompletedRecurringTasks(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	task := &dbTask{ID: primitive.NewObjectID(), OwnerID: primitive.NewObjectID().Hex(), TaskInfo: db.TaskInfo{Completed: true, Recurrence: "FREQ=DAILY"}}
+
+	tests := []struct {
+		name      string
+		limit     int
+		responses []bson.D
+		wantTasks int
+		wantErr   error
+	}{
+		{"completed tasks", 10, []bson.D{mockFound(mt, taskCollection, task)}, 1, nil},
+		{"no completed tasks", 10, []bson.D{mockFound(mt, taskCollection)}, 0, nil},
+		{"invalid limit", 0, nil, 0, db.ErrorInvalidRequest},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			mt.AddMockResponses(test.responses...)
+
+			tasks, err := newMockMongoDB(mt).CompletedRecurringTasks(test.limit)
+			if !errors.Is(err, test.wantErr) {
+				mt.Fatalf("want error %v, got %v", test.wantErr, err)
+			}
+			if len(tasks) != test.wantTasks {
+				mt.Fatalf("want %d tasks, got %d", test.wantTasks, len(tasks))
+			}
+			if test.wantErr != nil {
+				return
+			}
+
+			filter := sentCommand(mt, "find", taskCollection).Lookup("filter").Document()
+			if !filter.Lookup(completedKey).Boolean() {
+				mt.Fatalf("want completed tasks, got filter %v", filter)
+			}
+			if tasks, ok := filter.Lookup(recurrenceKey).DocumentOK(); !ok || !tasks.Lookup("$exists").Boolean() {
+				mt.Fatalf("want recurring tasks, got filter %v", filter)
+			}
+		})
+	}
+}
+
+func TestCreateNextOccurrence(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	task := &dbTask{ID: primitive.NewObjectID(), OwnerID: primitive.NewObjectID().Hex(), TaskInfo: db.TaskInfo{Detail: "detail", Completed: true, DueAt: 100, Tags: []string{"home"}, Recurrence: "FREQ=DAILY"}}
+	nextTask := &dbTask{ID: primitive.NewObjectID(), OwnerID: task.OwnerID, PreviousID: task.ID.Hex(), TaskInfo: db.TaskInfo{Detail: "detail", DueAt: 200, Tags: []string{"home"}, Recurrence: "FREQ=DAILY"}}
+
+	tests := []struct {
+		name      string
+		taskID    string
+		dueAt     int64
+		responses []bson.D
+		wantTask  bool
+		wantErr   error
+	}{
+		{
+			name:      "next occurrence",
+			taskID:    task.ID.Hex(),
+			dueAt:     200,
+			responses: []bson.D{mockFound(mt, taskCollection, task), mockFoundAndModified(mt, nextTask), mockWritten(1)},
+			wantTask:  true,
+		},
+		{
+			name:      "ended recurrence",
+			taskID:    task.ID.Hex(),
+			responses: []bson.D{mockFound(mt, taskCollection, task), mockWritten(1)},
+		},
+		{
+			name:      "missing task",
+			taskID:    task.ID.Hex(),
+			dueAt:     200,
+			responses: []bson.D{mockFound(mt, taskCollection)},
+			wantErr:   db.ErrorInvalidRequest,
+		},
+		{
+			name:    "invalid task ID",
+			taskID:  "invalid",
+			dueAt:   200,
+			wantErr: db.ErrorInvalidRequest,
+		},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			mt.AddMockResponses(test.responses...)
+
+			gotTask, err := newMockMongoDB(mt).CreateNextOccurrence(test.taskID, test.dueAt, "FREQ=DAILY")
+			if !errors.Is(err, test.wantErr) {
+				mt.Fatalf("want error %v, got %v", test.wantErr, err)
+			}
+			if (gotTask != nil) != test.wantTask {
+				mt.Fatalf("want next occurrence %v, got %+v", test.wantTask, gotTask)
+			}
+			if test.wantErr != nil {
+				return
+			}
+
+			findAndModify := sentCommand(mt, "findAndModify", taskCollection)
+			if !test.wantTask {
+				if findAndModify != nil {
+					mt.Fatalf("want no next occurrence created, got %v", findAndModify)
+				}
+			} else {
+				if previousID := findAndModify.Lookup("query", previousIDKey).StringValue(); previousID != test.taskID {
+					mt.Fatalf("want next occurrence of %s, got %s", test.taskID, previousID)
+				}
+				inserted := findAndModify.Lookup("update", "$setOnInsert").Document()
+				if dueAt := inserted.Lookup(dueAtKey).Int64(); dueAt != test.dueAt {
+					mt.Fatalf("want next occurrence due at %d, got %d", test.dueAt, dueAt)
+				}
+				if detail := inserted.Lookup(taskDetailKey).StringValue(); detail != task.Detail {
+					mt.Fatalf("want next occurrence detail %q, got %q", task.Detail, detail)
+				}
+				if inserted.Lookup(completedKey).Boolean() {
+					mt.Fatal("want next occurrence not completed")
+				}
+				if gotTask.ID != nextTask.ID.Hex() {
+					mt.Fatalf("want next occurrence %s, got %s", nextTask.ID.Hex(), gotTask.ID)
+				}
+			}
+
+			update := sentCommand(mt, "update", taskCollection).Lookup("updates").Array().Index(0).Value().Document()
+			if _, err := update.LookupErr("u", "$unset", recurrenceKey); err != nil {
+				mt.Fatalf("want recurrence of the completed task removed, got %v", update)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package mongodb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxRemindersPerTask is the number of reminders a user can set on a task.
+const maxRemindersPerTask = 10
+
+// CreateReminder sets a reminder for the user with the provided userID on
+// the task with the provided taskID. The reminder is sent at remindAt, or
+// offset seconds before the task's due date if offset is not nil. The user
+// must be able to edit the task.
+func (mdb *MongoDB) CreateReminder(userID, taskID string, remindAt int64, offset *int64) (*db.Reminder, error) {
+	if userID == "" || taskID == "" || (remindAt == 0) == (offset == nil) {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	task, permission, err := mdb.taskWithPermission(userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	if permission == db.PermissionRead {
+		return nil, fmt.Errorf("%w: you do not have permission to set reminders on this task", db.ErrorInvalidRequest)
+	}
+
+	if offset != nil {
+		if task.DueAt == 0 {
+			return nil, fmt.Errorf("%w: the task does not have a due date", db.ErrorInvalidRequest)
+		}
+		remindAt = task.DueAt - *offset
+	}
+
+	now := time.Now().Unix()
+	if remindAt <= now {
+		return nil, fmt.Errorf("%w: the reminder time has already passed", db.ErrorInvalidRequest)
+	}
+
+	nReminders, err := mdb.remindersCollection.CountDocuments(mdb.ctx, bson.M{taskIDKey: taskID, userIDKey: userID})
+	if err != nil {
+		return nil, fmt.Errorf("remindersCollection.CountDocuments error: %w", err)
+	}
+
+	if nReminders >= maxRemindersPerTask {
+		return nil, fmt.Errorf("%w: you cannot set more than %d reminders on a task", db.ErrorInvalidRequest, maxRemindersPerTask)
+	}
+
+	reminder := &dbReminder{
+		ID:        primitive.NewObjectID(),
+		TaskID:    taskID,
+		UserID:    userID,
+		RemindAt:  remindAt,
+		Offset:    offset,
+		CreatedAt: now,
+	}
+
+	_, err = mdb.remindersCollection.InsertOne(mdb.ctx, reminder)
+	if err != nil {
+		return nil, fmt.Errorf("remindersCollection.InsertOne error: %w", err)
+	}
+
+	return reminder.info(), nil
+}
+
+// Reminders returns the reminders the user with the provided userID set on
+// the task with the provided taskID, in the order they are sent.
+func (mdb *MongoDB) Reminders(userID, taskID string) ([]*db.Reminder, error) {
+	if userID == "" || taskID == "" {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	_, _, err := mdb.taskWithPermission(userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{taskIDKey: taskID, userIDKey: userID}
+	cur, err := mdb.remindersCollection.Find(mdb.ctx, filter, options.Find().SetSort(bson.M{remindAtKey: 1}))
+	if err != nil {
+		return nil, fmt.Errorf("remindersCollection.Find error: %w", err)
+	}
+
+	var dbReminders []*dbReminder
+	err = cur.All(mdb.ctx, &dbReminders)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode retrieved reminders: %w", err)
+	}
+
+	reminders := make([]*db.Reminder, 0, len(dbReminders))
+	for _, reminder := range dbReminders {
+		reminders = append(reminders, reminder.info())
+	}
+
+	return reminders, nil
+}
+
+// DeleteReminder deletes a reminder the user with the provided userID set on
+// the task with the provided taskID. Returns ErrorInvalidRequest if there is
+// no such reminder.
+func (mdb *MongoDB) DeleteReminder(userID, taskID, reminderID string) error {
+	reminderDBID, err := primitive.ObjectIDFromHex(reminderID)
+	if userID == "" || taskID == "" || err != nil {
+		return fmt.Errorf("%w: missing or invalid argument(s)", db.ErrorInvalidRequest)
+	}
+
+	filter := bson.M{dbIDKey: reminderDBID, taskIDKey: taskID, userIDKey: userID}
+	res, err := mdb.remindersCollection.DeleteOne(mdb.ctx, filter)
+	if err != nil {
+		return fmt.Errorf("remindersCollection.DeleteOne error: %w", err)
+	}
+
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("%w: reminder does not exist", db.ErrorInvalidRequest)
+	}
+
+	return nil
+}
+
+// ClaimDueReminder claims the undelivered reminder that has been due the
+// longest, hiding it from other schedulers for the provided lease. Returns
+// nil if no reminder is due. Reminders whose task or user has been deleted,
+// or whose user has lost access to the task, are deleted.
+func (mdb *MongoDB) ClaimDueReminder(lease time.Duration) (*db.DueReminder, error) {
+	for {
+		now := time.Now()
+		filter := bson.M{
+			deliveredKey:    false,
+			remindAtKey:     bson.M{"$gt": 0, "$lte": now.Unix()},
+			claimedUntilKey: bson.M{"$lte": now.Unix()},
+		}
+		update := bson.M{
+			"$set": bson.M{claimedUntilKey: now.Add(lease).Unix()},
+			"$inc": bson.M{attemptsKey: 1},
+		}
+		opts := options.FindOneAndUpdate().SetSort(bson.M{remindAtKey: 1}).SetReturnDocument(options.After)
+
+		var reminder *dbReminder
+		err := mdb.remindersCollection.FindOneAndUpdate(mdb.ctx, filter, update, opts).Decode(&reminder)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("remindersCollection.FindOneAndUpdate error: %w", err)
+		}
+
+		dueReminder, err := mdb.dueReminder(reminder)
+		if err != nil || dueReminder != nil {
+			return dueReminder, err
+		}
+
+		_, err = mdb.remindersCollection.DeleteOne(mdb.ctx, bson.M{dbIDKey: reminder.ID})
+		if err != nil {
+			return nil, fmt.Errorf("remindersCollection.DeleteOne error: %w", err)
+		}
+	}
+}
+
+// dueReminder returns reminder with its task and user. Returns nil if the
+// reminder can no longer be delivered.
+func (mdb *MongoDB) dueReminder(reminder *dbReminder) (*db.DueReminder, error) {
+	// An invalid task ID matches no task.
+	taskDBID, _ := primitive.ObjectIDFromHex(reminder.TaskID)
+	var task *dbTask
+	err := mdb.tasksCollection.FindOne(mdb.ctx, bson.M{dbIDKey: taskDBID}).Decode(&task)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("tasksCollection.FindOne error: %w", err)
+	}
+
+	permission, err := mdb.taskPermission(reminder.UserID, task)
+	if err != nil || permission == "" {
+		return nil, err
+	}
+
+	user, err := mdb.user(reminder.UserID)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	taskInfo := task.info()
+	taskInfo.OwnerID = task.OwnerID
+	taskInfo.Permission = permission
+
+	return &db.DueReminder{
+		Reminder: reminder.info(),
+		Task:     taskInfo,
+		Username: user.Username,
+		Email:    user.Email,
+		Attempts: reminder.Attempts,
+	}, nil
+}
+
+// MarkReminderDelivered marks the reminder with the provided reminderID as
+// delivered, with the provided error if it could not be delivered. Marking a
+// reminder that has already been delivered has no effect.
+func (mdb *MongoDB) MarkReminderDelivered(reminderID, deliveryError string) error {
+	reminderDBID, err := primitive.ObjectIDFromHex(reminderID)
+	if err != nil {
+		return fmt.Errorf("%w: invalid reminder ID", db.ErrorInvalidRequest)
+	}
+
+	set := bson.M{deliveredKey: true, deliveredAtKey: time.Now().Unix()}
+	if deliveryError != "" {
+		set[errorKey] = deliveryError
+	}
+
+	_, err = mdb.remindersCollection.UpdateOne(mdb.ctx, bson.M{dbIDKey: reminderDBID, deliveredKey: false}, bson.M{"$set": set})
+	if err != nil {
+		return fmt.Errorf("remindersCollection.UpdateOne error: %w", err)
+	}
+
+	return nil
+}
+
+// rescheduleReminders moves the undelivered reminders relative to the due
+// date of the task with the provided taskID to the task's new due date.
+// Reminders are not sent while the task has no due date.
+func (mdb *MongoDB) rescheduleReminders(taskID string, dueAt int64) error {
+	var remindAt any = int64(0)
+	if dueAt != 0 {
+		remindAt = bson.M{"$subtract": bson.A{dueAt, "$" + offsetKey}}
+	}
+
+	filter := bson.M{
+		taskIDKey:    taskID,
+		deliveredKey: false,
+		offsetKey:    bson.M{"$exists": true},
+	}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{remindAtKey: remindAt}}}}
+	_, err := mdb.remindersCollection.UpdateMany(mdb.ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("remindersCollection.UpdateMany error: %w", err)
+	}
+
+	return nil
+}
+
+// info returns the public information of a reminder.
+func (r *dbReminder) info() *db.Reminder {
+	return &db.Reminder{
+		ID:          r.ID.Hex(),
+		TaskID:      r.TaskID,
+		UserID:      r.UserID,
+		RemindAt:    r.RemindAt,
+		Offset:      r.Offset,
+		Delivered:   r.Delivered,
+		DeliveredAt: r.DeliveredAt,
+		Error:       r.Error,
+		CreatedAt:   r.CreatedAt,
+	}
+}
@@ -0,0 +1,52 @@
+package mongodb
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCreateReminderPermissions(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	userID := primitive.NewObjectID().Hex()
+	personalTask := &dbTask{ID: primitive.NewObjectID(), OwnerID: "owner"}
+	workspaceTask := &dbTask{ID: primitive.NewObjectID(), OwnerID: "owner", WorkspaceID: "workspace"}
+
+	tests := []struct {
+		name       string
+		task       *dbTask
+		permission string
+		wantErr    bool
+	}{
+		{"read collaborator", personalTask, db.PermissionRead, true},
+		{"workspace viewer", workspaceTask, db.PermissionRead, true},
+		{"edit collaborator", personalTask, db.PermissionEdit, false},
+		{"workspace member", workspaceTask, db.PermissionEdit, false},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			mt.AddMockResponses(mockTaskPermission(mt, test.task, userID, test.permission)...)
+			if !test.wantErr {
+				mt.AddMockResponses(mockCounted(mt, remindersCollection, 0), mockWritten(1))
+			}
+
+			remindAt := time.Now().Add(time.Hour).Unix()
+			_, err := newMockMongoDB(mt).CreateReminder(userID, test.task.ID.Hex(), remindAt, nil)
+			if test.wantErr {
+				if !errors.Is(err, db.ErrorInvalidRequest) {
+					mt.Fatalf("want ErrorInvalidRequest, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				mt.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
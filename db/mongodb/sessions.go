@@ -0,0 +1,173 @@
+package mongodb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// sessionLastSeenInterval is the minimum interval between updates of a
+// session's last seen time, so every request does not require a write.
+const sessionLastSeenInterval = time.Minute
+
+// CreateSession creates a new login session for the user with the provided
+// userID that expires after the provided duration.
+func (mdb *MongoDB) CreateSession(userID, deviceLabel, userAgent, ip string, expiry time.Duration) (*db.Session, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("%w: missing required argument", db.ErrorInvalidRequest)
+	}
+
+	now := time.Now()
+	session := &dbSession{
+		ID:          primitive.NewObjectID(),
+		UserID:      userID,
+		DeviceLabel: deviceLabel,
+		UserAgent:   userAgent,
+		IP:          ip,
+		CreatedAt:   now.Unix(),
+		LastSeenAt:  now.Unix(),
+		ExpiresAt:   now.Add(expiry),
+	}
+
+	_, err := mdb.sessionsCollection.InsertOne(mdb.ctx, session)
+	if err != nil {
+		return nil, fmt.Errorf("sessionsCollection.InsertOne error: %w", err)
+	}
+
+	return session.info(), nil
+}
+
+// TouchSession checks that the session with the provided sessionID belongs to
+// the user with the provided userID and has not expired or been revoked, and
+// updates its last seen time. Returns ErrorInvalidRequest if the session is
+// not active.
+func (mdb *MongoDB) TouchSession(userID, sessionID string) error {
+	if userID == "" || sessionID == "" {
+		return fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	sessionDBID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return fmt.Errorf("%w: invalid session ID", db.ErrorInvalidRequest)
+	}
+
+	now := time.Now()
+	filter := bson.M{
+		dbIDKey:      sessionDBID,
+		userIDKey:    userID,
+		expiresAtKey: bson.M{"$gt": now},
+	}
+
+	var session *dbSession
+	err = mdb.sessionsCollection.FindOne(mdb.ctx, filter).Decode(&session)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return fmt.Errorf("%w: session has expired or been revoked", db.ErrorInvalidRequest)
+		}
+		return fmt.Errorf("sessionsCollection.FindOne error: %w", err)
+	}
+
+	if now.Unix()-session.LastSeenAt < int64(sessionLastSeenInterval.Seconds()) {
+		return nil
+	}
+
+	_, err = mdb.sessionsCollection.UpdateByID(mdb.ctx, sessionDBID, bson.M{"$set": bson.M{lastSeenAtKey: now.Unix()}})
+	if err != nil {
+		return fmt.Errorf("sessionsCollection.UpdateByID error: %w", err)
+	}
+
+	return nil
+}
+
+// Sessions returns the active login sessions of the user with the provided
+// userID, most recently seen first.
+func (mdb *MongoDB) Sessions(userID string) ([]*db.Session, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("%w: missing required argument", db.ErrorInvalidRequest)
+	}
+
+	filter := bson.M{
+		userIDKey:    userID,
+		expiresAtKey: bson.M{"$gt": time.Now()},
+	}
+	cur, err := mdb.sessionsCollection.Find(mdb.ctx, filter, options.Find().SetSort(bson.M{lastSeenAtKey: -1}))
+	if err != nil {
+		return nil, fmt.Errorf("sessionsCollection.Find error: %w", err)
+	}
+
+	var dbSessions []*dbSession
+	err = cur.All(mdb.ctx, &dbSessions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode retrieved sessions: %w", err)
+	}
+
+	sessions := make([]*db.Session, 0, len(dbSessions))
+	for _, session := range dbSessions {
+		sessions = append(sessions, session.info())
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession deletes a login session of the user with the provided userID.
+// Auth tokens issued for the session are no longer accepted. If no session
+// match the provided sessionID, an ErrorInvalidRequest is returned.
+func (mdb *MongoDB) RevokeSession(userID, sessionID string) error {
+	if userID == "" || sessionID == "" {
+		return fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	sessionDBID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return fmt.Errorf("%w: invalid session ID", db.ErrorInvalidRequest)
+	}
+
+	res, err := mdb.sessionsCollection.DeleteOne(mdb.ctx, bson.M{dbIDKey: sessionDBID, userIDKey: userID})
+	if err != nil {
+		return fmt.Errorf("sessionsCollection.DeleteOne error: %w", err)
+	}
+
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("%w: session does not exist", db.ErrorInvalidRequest)
+	}
+
+	return nil
+}
+
+// revokeUserSessions deletes all the login sessions of the user with the
+// provided userID except the session with the optional keepSessionID.
+func (mdb *MongoDB) revokeUserSessions(userID, keepSessionID string) error {
+	filter := bson.M{userIDKey: userID}
+	if keepSessionID != "" {
+		keepSessionDBID, err := primitive.ObjectIDFromHex(keepSessionID)
+		if err != nil {
+			return fmt.Errorf("primitive.ObjectIDFromHex error: %w", err)
+		}
+		filter[dbIDKey] = bson.M{"$ne": keepSessionDBID}
+	}
+
+	_, err := mdb.sessionsCollection.DeleteMany(mdb.ctx, filter)
+	if err != nil {
+		return fmt.Errorf("sessionsCollection.DeleteMany error: %w", err)
+	}
+	return nil
+}
+
+// info returns the public information of a session.
+func (s *dbSession) info() *db.Session {
+	return &db.Session{
+		ID:          s.ID.Hex(),
+		DeviceLabel: s.DeviceLabel,
+		UserAgent:   s.UserAgent,
+		IP:          s.IP,
+		CreatedAt:   s.CreatedAt,
+		LastSeenAt:  s.LastSeenAt,
+		ExpiresAt:   s.ExpiresAt.Unix(),
+	}
+}
@@ -0,0 +1,100 @@
+package mongodb
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestTouchSession(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		// session is the active session, if any.
+		session    *dbSession
+		wantUpdate bool
+		wantErr    bool
+	}{
+		{"expired or revoked session", nil, false, true},
+		{"recently seen session", &dbSession{LastSeenAt: now.Unix()}, false, false},
+		{"session not seen for a while", &dbSession{LastSeenAt: now.Add(-2 * sessionLastSeenInterval).Unix()}, true, false},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			sessionID := primitive.NewObjectID()
+			if test.session == nil {
+				mt.AddMockResponses(mockFound(mt, sessionsCollection))
+			} else {
+				test.session.ID = sessionID
+				test.session.UserID = "user"
+				mt.AddMockResponses(mockFound(mt, sessionsCollection, test.session), mockWritten(1))
+			}
+
+			err := newMockMongoDB(mt).TouchSession("user", sessionID.Hex())
+			if test.wantErr {
+				if !errors.Is(err, db.ErrorInvalidRequest) {
+					mt.Fatalf("want ErrorInvalidRequest, got %v", err)
+				}
+			} else if err != nil {
+				mt.Fatalf("TouchSession error: %v", err)
+			}
+
+			// Sessions are looked up for their user.
+			filter := sentCommand(mt, "find", sessionsCollection).Lookup("filter")
+			if userID := filter.Document().Lookup(userIDKey).StringValue(); userID != "user" {
+				mt.Fatalf("want session of user, got %s", userID)
+			}
+
+			if updated := sentCommand(mt, "update", sessionsCollection) != nil; updated != test.wantUpdate {
+				mt.Fatalf("want last seen time updated %v, got %v", test.wantUpdate, updated)
+			}
+		})
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name      string
+		sessionID string
+		deleted   int
+		wantErr   bool
+	}{
+		{"invalid session ID", "invalid", -1, true},
+		{"session of another user", primitive.NewObjectID().Hex(), 0, true},
+		{"session", primitive.NewObjectID().Hex(), 1, false},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			if test.deleted >= 0 {
+				mt.AddMockResponses(mockWritten(test.deleted))
+			}
+
+			err := newMockMongoDB(mt).RevokeSession("user", test.sessionID)
+			if test.wantErr {
+				if !errors.Is(err, db.ErrorInvalidRequest) {
+					mt.Fatalf("want ErrorInvalidRequest, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				mt.Fatalf("RevokeSession error: %v", err)
+			}
+
+			filter := sentCommand(mt, "delete", sessionsCollection).Lookup("deletes").Array().Index(0).Value().Document().Lookup("q").Document()
+			if userID := filter.Lookup(userIDKey).StringValue(); userID != "user" {
+				mt.Fatalf("want session of user deleted, got %s", userID)
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package mongodb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ShareTask shares the task with the provided taskID owned by ownerID with
+// the user with the provided username. Sharing a task again with the same
+// user replaces their permission. Returns ErrorInvalidRequest if the task or
+// user does not exist.
+func (mdb *MongoDB) ShareTask(ownerID, taskID, username, permission string) (*db.Share, error) {
+	if ownerID == "" || taskID == "" || username == "" {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	taskDBID, err := primitive.ObjectIDFromHex(taskID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid task ID", db.ErrorInvalidRequest)
+	}
+
+	// Workspace tasks are shared with the workspace's members instead.
+	filter := bson.M{
+		dbIDKey:        taskDBID,
+		ownerIDKey:     ownerID,
+		workspaceIDKey: bson.M{"$exists": false},
+	}
+	nTasksFound, err := mdb.tasksCollection.CountDocuments(mdb.ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("tasksCollection.CountDocuments error: %w", err)
+	}
+
+	if nTasksFound == 0 {
+		return nil, fmt.Errorf("%w: task does not exist", db.ErrorInvalidRequest)
+	}
+
+	collaborator, err := mdb.shareCollaborator(ownerID, username, permission)
+	if err != nil {
+		return nil, err
+	}
+
+	filter = bson.M{
+		taskIDKey: taskID,
+		userIDKey: collaborator.ID.Hex(),
+	}
+	return mdb.saveShare(filter, ownerID, collaborator.Username, permission)
+}
+
+// ShareProject shares all the tasks in the provided project owned by ownerID,
+// including tasks added to the project later, with the user with the provided
+// username. Sharing a project again with the same user replaces their
+// permission. Returns ErrorInvalidRequest if the user does not exist.
+func (mdb *MongoDB) ShareProject(ownerID, project, username, permission string) (*db.Share, error) {
+	if ownerID == "" || project == "" || username == "" {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	collaborator, err := mdb.shareCollaborator(ownerID, username, permission)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{
+		ownerIDKey: ownerID,
+		projectKey: project,
+		userIDKey:  collaborator.ID.Hex(),
+	}
+	return mdb.saveShare(filter, ownerID, collaborator.Username, permission)
+}
+
+// Shares returns all the tasks and projects the user with the provided
+// ownerID has shared with other users.
+func (mdb *MongoDB) Shares(ownerID string) ([]*db.Share, error) {
+	if ownerID == "" {
+		return nil, fmt.Errorf("%w: missing required argument", db.ErrorInvalidRequest)
+	}
+
+	cur, err := mdb.sharesCollection.Find(mdb.ctx, bson.M{ownerIDKey: ownerID}, options.Find().SetSort(bson.M{createdAtKey: -1}))
+	if err != nil {
+		return nil, fmt.Errorf("sharesCollection.Find error: %w", err)
+	}
+
+	var dbShares []*dbShare
+	err = cur.All(mdb.ctx, &dbShares)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode retrieved shares: %w", err)
+	}
+
+	shares := make([]*db.Share, 0, len(dbShares))
+	for _, share := range dbShares {
+		shares = append(shares, share.info())
+	}
+
+	return shares, nil
+}
+
+// RevokeShare deletes a share created by the user with the provided ownerID.
+// If no share match the provided shareID, an ErrorInvalidRequest is returned.
+func (mdb *MongoDB) RevokeShare(ownerID, shareID string) error {
+	if ownerID == "" || shareID == "" {
+		return fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	shareDBID, err := primitive.ObjectIDFromHex(shareID)
+	if err != nil {
+		return fmt.Errorf("%w: invalid share ID", db.ErrorInvalidRequest)
+	}
+
+	res, err := mdb.sharesCollection.DeleteOne(mdb.ctx, bson.M{dbIDKey: shareDBID, ownerIDKey: ownerID})
+	if err != nil {
+		return fmt.Errorf("sharesCollection.DeleteOne error: %w", err)
+	}
+
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("%w: share does not exist", db.ErrorInvalidRequest)
+	}
+
+	return nil
+}
+
+// SharedTasks returns the tasks other users have shared with the user with
+// the provided userID, directly or through a project. Only tasks with the
+// provided completed status are returned if completed is not nil.
+func (mdb *MongoDB) SharedTasks(userID string, completed *bool) ([]*db.Task, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("%w: missing required argument", db.ErrorInvalidRequest)
+	}
+
+	var extraFilter bson.M
+	if completed != nil {
+		extraFilter = bson.M{completedKey: *completed}
+	}
+
+	return mdb.sharedTasks(userID, extraFilter)
+}
+
+// sharedTasks returns the tasks shared with the user with the provided userID
+// that match extraFilter, with the user's permission on each task. Tasks are
+// sorted in descending order.
+func (mdb *MongoDB) sharedTasks(userID string, extraFilter bson.M) ([]*db.Task, error) {
+	cur, err := mdb.sharesCollection.Find(mdb.ctx, bson.M{userIDKey: userID})
+	if err != nil {
+		return nil, fmt.Errorf("sharesCollection.Find error: %w", err)
+	}
+
+	var shares []*dbShare
+	err = cur.All(mdb.ctx, &shares)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode retrieved shares: %w", err)
+	}
+
+	if len(shares) == 0 {
+		return []*db.Task{}, nil
+	}
+
+	taskPermissions := make(map[string]string)
+	projectPermissions := make(map[string]string)
+	var taskDBIDs []primitive.ObjectID
+	var taskFilters bson.A
+	for _, share := range shares {
+		if share.TaskID != "" {
+			taskDBID, err := primitive.ObjectIDFromHex(share.TaskID)
+			if err != nil {
+				continue
+			}
+			taskDBIDs = append(taskDBIDs, taskDBID)
+			taskPermissions[share.TaskID] = highestPermission(taskPermissions[share.TaskID], share.Permission)
+			continue
+		}
+
+		key := projectShareKey(share.OwnerID, share.Project)
+		if _, found := projectPermissions[key]; !found {
+			taskFilters = append(taskFilters, bson.M{ownerIDKey: share.OwnerID, projectKey: share.Project})
+		}
+		projectPermissions[key] = highestPermission(projectPermissions[key], share.Permission)
+	}
+
+	if len(taskDBIDs) > 0 {
+		taskFilters = append(taskFilters, bson.M{dbIDKey: bson.M{"$in": taskDBIDs}})
+	}
+
+	if len(taskFilters) == 0 {
+		return []*db.Task{}, nil
+	}
+
+	filter := bson.M{
+		"$or":          taskFilters,
+		ownerIDKey:     bson.M{"$ne": userID},
+		workspaceIDKey: bson.M{"$exists": false},
+	}
+	for key, val := range extraFilter {
+		filter[key] = val
+	}
+
+	dbTasks, err := mdb.findTasks(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]*db.Task, 0, len(dbTasks))
+	for _, dbTask := range dbTasks {
+		task := dbTask.info()
+		task.OwnerID = dbTask.OwnerID
+		task.Permission = taskPermissions[task.ID]
+		if dbTask.Project != "" {
+			task.Permission = highestPermission(task.Permission, projectPermissions[projectShareKey(dbTask.OwnerID, dbTask.Project)])
+		}
+		tasks = append(tasks, task)
+	}
+
+	return mdb.prepareTasks(tasks)
+}
+
+// shareCollaborator returns the user with the provided username that a task
+// or project is being shared with, after checking that the share is valid.
+func (mdb *MongoDB) shareCollaborator(ownerID, username, permission string) (*dbUser, error) {
+	if permission != db.PermissionRead && permission != db.PermissionEdit {
+		return nil, fmt.Errorf("%w: invalid permission %q", db.ErrorInvalidRequest, permission)
+	}
+
+	var collaborator *dbUser
+	err := mdb.usersCollection.FindOne(mdb.ctx, bson.M{usernameKey: username}).Decode(&collaborator)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("%w: user %s does not exist", db.ErrorInvalidRequest, username)
+		}
+		return nil, fmt.Errorf("usersCollection.FindOne error: %w", err)
+	}
+
+	if collaborator.ID.Hex() == ownerID {
+		return nil, fmt.Errorf("%w: you cannot share with yourself", db.ErrorInvalidRequest)
+	}
+
+	return collaborator, nil
+}
+
+// saveShare creates the share that matches filter or replaces its permission
+// if it already exists.
+func (mdb *MongoDB) saveShare(filter bson.M, ownerID, username, permission string) (*db.Share, error) {
+	setOnInsert := bson.M{
+		usernameKey:  username,
+		createdAtKey: time.Now().Unix(),
+	}
+	if _, found := filter[ownerIDKey]; !found {
+		setOnInsert[ownerIDKey] = ownerID
+	}
+
+	update := bson.M{
+		"$set":         bson.M{permissionKey: permission},
+		"$setOnInsert": setOnInsert,
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var share *dbShare
+	err := mdb.sharesCollection.FindOneAndUpdate(mdb.ctx, filter, update, opts).Decode(&share)
+	if err != nil {
+		return nil, fmt.Errorf("sharesCollection.FindOneAndUpdate error: %w", err)
+	}
+
+	return share.info(), nil
+}
+
+// highestPermission returns the permission that grants more access.
+func highestPermission(a, b string) string {
+	rank := map[string]int{
+		db.PermissionRead:  1,
+		db.PermissionEdit:  2,
+		db.PermissionOwner: 3,
+	}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// projectShareKey returns a key that identifies a project of a user.
+func projectShareKey(ownerID, project string) string {
+	return ownerID + "/" + project
+}
+
+// info returns the public information of a share.
+func (s *dbShare) info() *db.Share {
+	return &db.Share{
+		ID:         s.ID.Hex(),
+		TaskID:     s.TaskID,
+		Project:    s.Project,
+		UserID:     s.UserID,
+		Username:   s.Username,
+		Permission: s.Permission,
+		CreatedAt:  s.CreatedAt,
+	}
+}
@@ -0,0 +1,154 @@
+package mongodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestHighestPermission(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"", "", ""},
+		{"", db.PermissionRead, db.PermissionRead},
+		{db.PermissionRead, db.PermissionEdit, db.PermissionEdit},
+		{db.PermissionEdit, db.PermissionRead, db.PermissionEdit},
+		{db.PermissionOwner, db.PermissionEdit, db.PermissionOwner},
+	}
+
+	for _, test := range tests {
+		t.Run(test.a+" "+test.b, func(t *testing.T) {
+			if got := highestPermission(test.a, test.b); got != test.want {
+				t.Fatalf("want %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestTaskPermission(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	const userID = "user"
+	taskID := primitive.NewObjectID()
+	share := func(permission string) *dbShare {
+		return &dbShare{ID: primitive.NewObjectID(), UserID: userID, Permission: permission}
+	}
+	member := func(role string) *dbWorkspaceMember {
+		return &dbWorkspaceMember{ID: primitive.NewObjectID(), WorkspaceID: "workspace", UserID: userID, Role: role}
+	}
+
+	tests := []struct {
+		name string
+		task *dbTask
+		// found are the shares or workspace members found for the user.
+		found          []any
+		wantPermission string
+		// wantLookup is the collection the user's access is looked up in.
+		wantLookup string
+	}{
+		{"owner", &dbTask{ID: taskID, OwnerID: userID}, nil, db.PermissionOwner, ""},
+		{"not shared", &dbTask{ID: taskID, OwnerID: "owner"}, nil, "", sharesCollection},
+		{"shared task", &dbTask{ID: taskID, OwnerID: "owner"}, []any{share(db.PermissionRead)}, db.PermissionRead, sharesCollection},
+		{"task and project shared", &dbTask{ID: taskID, OwnerID: "owner", TaskInfo: db.TaskInfo{Project: "project"}}, []any{share(db.PermissionRead), share(db.PermissionEdit)}, db.PermissionEdit, sharesCollection},
+		{"workspace member", &dbTask{ID: taskID, OwnerID: "owner", WorkspaceID: "workspace"}, []any{member(db.WorkspaceRoleMember)}, db.PermissionEdit, membersCollection},
+		{"workspace viewer", &dbTask{ID: taskID, OwnerID: "owner", WorkspaceID: "workspace"}, []any{member(db.WorkspaceRoleViewer)}, db.PermissionRead, membersCollection},
+		{"task creator left the workspace", &dbTask{ID: taskID, OwnerID: userID, WorkspaceID: "workspace"}, nil, "", membersCollection},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			if test.wantLookup != "" {
+				mt.AddMockResponses(mockFound(mt, test.wantLookup, test.found...))
+			}
+
+			permission, err := newMockMongoDB(mt).taskPermission(userID, test.task)
+			if err != nil {
+				mt.Fatalf("taskPermission error: %v", err)
+			}
+			if permission != test.wantPermission {
+				mt.Fatalf("want permission %q, got %q", test.wantPermission, permission)
+			}
+
+			if test.wantLookup != sharesCollection {
+				return
+			}
+
+			// Project shares only apply to tasks in a project.
+			filters, _ := sentCommand(mt, "find", sharesCollection).Lookup("filter", "$or").Array().Values()
+			wantFilters := 1
+			if test.task.Project != "" {
+				wantFilters = 2
+			}
+			if len(filters) != wantFilters {
+				mt.Fatalf("want %d share filters, got %d", wantFilters, len(filters))
+			}
+		})
+	}
+}
+
+func TestShareTask(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	ownerID := primitive.NewObjectID()
+	collaborator := &dbUser{ID: primitive.NewObjectID(), Username: "collaborator"}
+
+	tests := []struct {
+		name       string
+		permission string
+		// tasks is the number of personal tasks with the ID owned by the
+		// owner.
+		tasks int
+		// user is the user with the username, if any.
+		user    *dbUser
+		wantErr bool
+	}{
+		{"task of another user", db.PermissionRead, 0, collaborator, true},
+		{"invalid permission", db.PermissionOwner, 1, collaborator, true},
+		{"missing user", db.PermissionRead, 1, nil, true},
+		{"share with yourself", db.PermissionRead, 1, &dbUser{ID: ownerID, Username: "owner"}, true},
+		{"share", db.PermissionEdit, 1, collaborator, false},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			mt.AddMockResponses(mockCounted(mt, taskCollection, test.tasks))
+			if test.user == nil {
+				mt.AddMockResponses(mockFound(mt, usersCollection))
+			} else {
+				mt.AddMockResponses(mockFound(mt, usersCollection, test.user))
+			}
+			share := &dbShare{ID: primitive.NewObjectID(), OwnerID: ownerID.Hex(), UserID: collaborator.ID.Hex(), Permission: test.permission}
+			mt.AddMockResponses(mockFoundAndModified(mt, share))
+
+			_, err := newMockMongoDB(mt).ShareTask(ownerID.Hex(), primitive.NewObjectID().Hex(), "collaborator", test.permission)
+			if test.wantErr {
+				if !errors.Is(err, db.ErrorInvalidRequest) {
+					mt.Fatalf("want ErrorInvalidRequest, got %v", err)
+				}
+				if sentCommand(mt, "findAndModify", sharesCollection) != nil {
+					mt.Fatal("want task not shared")
+				}
+				return
+			}
+			if err != nil {
+				mt.Fatalf("ShareTask error: %v", err)
+			}
+
+			// Workspace tasks cannot be shared.
+			query := sentCommand(mt, "aggregate", taskCollection).Lookup("pipeline").Array().Index(0).Value().Document().Lookup("$match").Document()
+			if _, err := query.LookupErr(workspaceIDKey, "$exists"); err != nil {
+				mt.Fatalf("want workspace tasks excluded, got %v", query)
+			}
+
+			set := sentCommand(mt, "findAndModify", sharesCollection).Lookup("update", "$set").Document()
+			if permission := set.Lookup(permissionKey).StringValue(); permission != test.permission {
+				mt.Fatalf("want permission %s, got %s", test.permission, permission)
+			}
+		})
+	}
+}
@@ -0,0 +1,502 @@
+package mongodb
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// tombstoneRetention is how long deleted tasks are remembered. Clients
+	// that have not synced for longer must download all their tasks again.
+	tombstoneRetention = 30 * 24 * time.Hour
+	// syncOverlap is subtracted from the current time to get the next sync
+	// version, so tasks written by slower requests or servers with slightly
+	// different clocks are not missed. Changes made in this window are sent
+	// again on the next sync.
+	syncOverlap = 5 * time.Second
+	// maxSyncUpdateAttempts is the number of times a sync update is retried
+	// when the task is changed by another request at the same time.
+	maxSyncUpdateAttempts = 3
+)
+
+// syncFields are the task fields that can be changed by a sync.
+var syncFields = []string{db.SyncFieldDetail, db.SyncFieldCompleted, db.SyncFieldProject, db.SyncFieldDueAt, db.SyncFieldTags, db.SyncFieldRecurrence}
+
+// TaskDelta returns the tasks owned by the user with the provided userID
+// that were changed or deleted after the provided sync version. All the
+// user's tasks are returned with Reset set if since is zero or older than the
+// deleted tasks that are remembered.
+func (mdb *MongoDB) TaskDelta(userID string, since int64) (*db.TaskDelta, error) {
+	if userID == "" || since < 0 {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	now := time.Now()
+	delta := &db.TaskDelta{
+		Deleted:     make([]*db.TaskTombstone, 0),
+		SyncVersion: now.Add(-syncOverlap).UnixMilli(),
+	}
+
+	if since == 0 || since < now.Add(-tombstoneRetention).UnixMilli() {
+		tasks, err := mdb.userTasks(userID, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		delta.Tasks = tasks
+		delta.Reset = true
+		return delta, nil
+	}
+
+	tasks, err := mdb.userTasks(userID, bson.M{updatedAtKey: bson.M{"$gt": since}})
+	if err != nil {
+		return nil, err
+	}
+	delta.Tasks = tasks
+
+	filter := bson.M{
+		ownerIDKey:     userID,
+		workspaceIDKey: bson.M{"$exists": false},
+		deletedAtKey:   bson.M{"$gt": since},
+	}
+	cur, err := mdb.tombstonesCollection.Find(mdb.ctx, filter, options.Find().SetSort(bson.D{{Key: deletedAtKey, Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("tombstonesCollection.Find error: %w", err)
+	}
+
+	var tombstones []*dbTaskTombstone
+	err = cur.All(mdb.ctx, &tombstones)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode retrieved tombstones: %w", err)
+	}
+
+	for _, tombstone := range tombstones {
+		delta.Deleted = append(delta.Deleted, &db.TaskTombstone{
+			TaskID:    tombstone.TaskID,
+			DeletedAt: tombstone.DeletedAt,
+		})
+	}
+
+	return delta, nil
+}
+
+// SyncTasks applies changes made by the user with the provided userID while
+// offline to the tasks they own, in order. Fields changed on the server after
+// a change was made on the client are kept and reported as conflicts.
+func (mdb *MongoDB) SyncTasks(userID string, changes []*db.SyncChange) ([]*db.SyncResult, error) {
+	if userID == "" || len(changes) == 0 {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	results := make([]*db.SyncResult, 0, len(changes))
+	var tasks []*db.Task
+	for _, change := range changes {
+		// Changes dated in the future would win every later conflict.
+		modifiedAt := min(change.ModifiedAt, time.Now().UnixMilli())
+
+		var result *db.SyncResult
+		var err error
+		switch change.Action {
+		case db.SyncActionCreate:
+			result, err = mdb.syncCreate(userID, change, modifiedAt)
+		case db.SyncActionUpdate:
+			result, err = mdb.syncUpdate(userID, change, modifiedAt)
+		case db.SyncActionDelete:
+			result, err = mdb.syncDelete(userID, change, modifiedAt)
+		default:
+			return nil, fmt.Errorf("%w: invalid sync action %q", db.ErrorInvalidRequest, change.Action)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result.Action = change.Action
+		result.ClientID = change.ClientID
+		if result.TaskID == "" {
+			result.TaskID = change.TaskID
+		}
+		if result.Status == "" {
+			result.Status = db.SyncStatusApplied
+			if len(result.Conflicts) > 0 {
+				result.Status = db.SyncStatusConflict
+			}
+		}
+
+		results = append(results, result)
+		if result.Task != nil {
+			tasks = append(tasks, result.Task)
+		}
+	}
+
+	err := mdb.setCommentCounts(tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// syncCreate creates the task of a sync change unless a task was already
+// created with its client ID.
+func (mdb *MongoDB) syncCreate(userID string, change *db.SyncChange, modifiedAt int64) (*db.SyncResult, error) {
+	if change.ClientID == "" || change.Detail == nil || *change.Detail == "" {
+		return nil, fmt.Errorf("%w: a new task requires a client ID and detail", db.ErrorInvalidRequest)
+	}
+
+	existing, err := mdb.clientTask(userID, change.ClientID)
+	if err != nil || existing != nil {
+		return syncTaskResult(existing, false), err
+	}
+
+	task := &dbTask{
+		ID:      primitive.NewObjectID(),
+		OwnerID: userID,
+		TaskInfo: db.TaskInfo{
+			Detail:    *change.Detail,
+			Timestamp: modifiedAt / 1000,
+		},
+		UpdatedAt:  time.Now().UnixMilli(),
+		FieldTimes: newFieldTimes(modifiedAt),
+		ClientID:   change.ClientID,
+	}
+	if change.Completed != nil {
+		task.Completed = *change.Completed
+	}
+	if change.Project != nil {
+		task.Project = *change.Project
+	}
+	if change.DueAt != nil {
+		task.DueAt = *change.DueAt
+	}
+	if change.Tags != nil && len(*change.Tags) > 0 {
+		task.Tags = *change.Tags
+	}
+	if change.Recurrence != nil {
+		task.Recurrence = *change.Recurrence
+	}
+
+	_, err = mdb.tasksCollection.InsertOne(mdb.ctx, task)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			// The same change is being synced by another request.
+			existing, err = mdb.clientTask(userID, change.ClientID)
+			if err == nil && existing == nil {
+				err = fmt.Errorf("task with client ID %q not found after duplicate key error", change.ClientID)
+			}
+			return syncTaskResult(existing, false), err
+		}
+		return nil, fmt.Errorf("tasksCollection.InsertOne error: %w", err)
+	}
+
+	return syncTaskResult(task, true), nil
+}
+
+// syncUpdate applies the fields of a sync change that were modified on the
+// client after they were last modified on the server.
+func (mdb *MongoDB) syncUpdate(userID string, change *db.SyncChange, modifiedAt int64) (*db.SyncResult, error) {
+	for attempt := 0; attempt < maxSyncUpdateAttempts; attempt++ {
+		task, err := mdb.ownTask(userID, change.TaskID)
+		if err != nil {
+			return nil, err
+		}
+
+		if task == nil {
+			return mdb.missingTaskResult(change.TaskID)
+		}
+
+		if task.Completed {
+			if change.Detail == nil && change.Project == nil && change.DueAt == nil && change.Tags == nil && change.Recurrence == nil {
+				return syncTaskResult(task, false), nil
+			}
+			return &db.SyncResult{Status: db.SyncStatusRejected, Error: "completed tasks cannot be updated"}, nil
+		}
+
+		result := &db.SyncResult{}
+		now := time.Now().UnixMilli()
+		set, unset := bson.M{}, bson.M{}
+		for _, field := range syncFields {
+			value, provided := syncChangeValue(change, field)
+			if !provided || sameFieldValue(value, task.fieldValue(field)) {
+				continue
+			}
+
+			serverModifiedAt := task.fieldTime(field)
+			if modifiedAt <= serverModifiedAt {
+				result.Conflicts = append(result.Conflicts, &db.SyncConflict{
+					Field:            field,
+					ServerValue:      task.fieldValue(field),
+					ServerModifiedAt: serverModifiedAt,
+				})
+				continue
+			}
+
+			if clearsField(field, value) {
+				unset[field] = ""
+			} else {
+				set[field] = value
+			}
+			set[fieldTimeKey(field)] = modifiedAt
+		}
+
+		if len(set) == 0 {
+			result.TaskID = task.ID.Hex()
+			result.Task = task.info()
+			return result, nil
+		}
+
+		set[updatedAtKey] = now
+		filter := bson.M{dbIDKey: task.ID, updatedAtKey: task.UpdatedAt}
+		if task.UpdatedAt == 0 {
+			filter[updatedAtKey] = bson.M{"$exists": false}
+		}
+
+		update := bson.M{"$set": set}
+		if len(unset) > 0 {
+			update["$unset"] = unset
+		}
+
+		var updatedTask *dbTask
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		err = mdb.tasksCollection.FindOneAndUpdate(mdb.ctx, filter, update, opts).Decode(&updatedTask)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				// The task was changed since it was retrieved.
+				continue
+			}
+			return nil, fmt.Errorf("tasksCollection.FindOneAndUpdate error: %w", err)
+		}
+
+		if updatedTask.DueAt != task.DueAt {
+			err = mdb.rescheduleReminders(updatedTask.ID.Hex(), updatedTask.DueAt)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		result.TaskID = updatedTask.ID.Hex()
+		result.Task = updatedTask.info()
+		result.Changed = true
+		return result, nil
+	}
+
+	return &db.SyncResult{Status: db.SyncStatusRejected, Error: "task is being changed by another request, please try again"}, nil
+}
+
+// syncDelete deletes the task of a sync change unless it was modified on the
+// server after it was deleted on the client.
+func (mdb *MongoDB) syncDelete(userID string, change *db.SyncChange, modifiedAt int64) (*db.SyncResult, error) {
+	task, err := mdb.ownTask(userID, change.TaskID)
+	if err != nil {
+		return nil, err
+	}
+
+	if task == nil {
+		return mdb.missingTaskResult(change.TaskID)
+	}
+
+	result := &db.SyncResult{}
+	for _, field := range syncFields {
+		serverModifiedAt := task.fieldTime(field)
+		if serverModifiedAt > modifiedAt {
+			result.Conflicts = append(result.Conflicts, &db.SyncConflict{
+				Field:            field,
+				ServerValue:      task.fieldValue(field),
+				ServerModifiedAt: serverModifiedAt,
+			})
+		}
+	}
+
+	if len(result.Conflicts) > 0 {
+		result.Task = task.info()
+		return result, nil
+	}
+
+	err = mdb.removeTask(task)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			// The task was deleted by another request.
+			return result, nil
+		}
+		return nil, err
+	}
+
+	result.Changed = true
+	return result, nil
+}
+
+// missingTaskResult returns the result of a change to a task the user does
+// not own. Deleting a task that has already been deleted is not an error.
+func (mdb *MongoDB) missingTaskResult(taskID string) (*db.SyncResult, error) {
+	nTombstones, err := mdb.tombstonesCollection.CountDocuments(mdb.ctx, bson.M{taskIDKey: taskID})
+	if err != nil {
+		return nil, fmt.Errorf("tombstonesCollection.CountDocuments error: %w", err)
+	}
+
+	if nTombstones > 0 {
+		return &db.SyncResult{Status: db.SyncStatusRejected, Error: "task has been deleted"}, nil
+	}
+
+	return &db.SyncResult{Status: db.SyncStatusRejected, Error: "task does not exist"}, nil
+}
+
+// ownTask returns the task with the provided taskID if it is owned by the
+// user with the provided userID and does not belong to a workspace. Returns
+// nil if there is no such task.
+func (mdb *MongoDB) ownTask(userID, taskID string) (*dbTask, error) {
+	taskDBID, err := primitive.ObjectIDFromHex(taskID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid task ID", db.ErrorInvalidRequest)
+	}
+
+	filter := bson.M{
+		dbIDKey:        taskDBID,
+		ownerIDKey:     userID,
+		workspaceIDKey: bson.M{"$exists": false},
+	}
+	return mdb.findSyncTask(filter)
+}
+
+// clientTask returns the task the user with the provided userID created with
+// the provided clientID, or nil if there is no such task.
+func (mdb *MongoDB) clientTask(userID, clientID string) (*dbTask, error) {
+	return mdb.findSyncTask(bson.M{ownerIDKey: userID, clientIDKey: clientID})
+}
+
+// findSyncTask returns the task that matches filter or nil if no task
+// matches.
+func (mdb *MongoDB) findSyncTask(filter bson.M) (*dbTask, error) {
+	var task *dbTask
+	err := mdb.tasksCollection.FindOne(mdb.ctx, filter).Decode(&task)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("tasksCollection.FindOne error: %w", err)
+	}
+
+	return task, nil
+}
+
+// syncTaskResult returns the result of a change that leaves task as it is.
+func syncTaskResult(task *dbTask, changed bool) *db.SyncResult {
+	if task == nil {
+		return nil
+	}
+
+	return &db.SyncResult{
+		TaskID:  task.ID.Hex(),
+		Changed: changed,
+		Task:    task.info(),
+	}
+}
+
+// newFieldTimes returns the field times of a task whose synced fields were
+// all modified at modifiedAt.
+func newFieldTimes(modifiedAt int64) map[string]int64 {
+	fieldTimes := make(map[string]int64, len(syncFields))
+	for _, field := range syncFields {
+		fieldTimes[field] = modifiedAt
+	}
+	return fieldTimes
+}
+
+// fieldTimeKey returns the key of the modification time of a synced field.
+func fieldTimeKey(field string) string {
+	return fieldTimesKey + "." + field
+}
+
+// fieldTime returns when a synced field of the task was last modified. Tasks
+// written before sync was introduced fall back to when they were last
+// updated or created.
+func (t *dbTask) fieldTime(field string) int64 {
+	if modifiedAt, found := t.FieldTimes[field]; found {
+		return modifiedAt
+	}
+	if t.UpdatedAt != 0 {
+		return t.UpdatedAt
+	}
+	return t.Timestamp * 1000
+}
+
+// syncChangeValue returns the value of a synced field set by change and
+// whether the field is set.
+func syncChangeValue(change *db.SyncChange, field string) (any, bool) {
+	switch field {
+	case db.SyncFieldDetail:
+		if change.Detail != nil {
+			return *change.Detail, true
+		}
+	case db.SyncFieldCompleted:
+		if change.Completed != nil {
+			return *change.Completed, true
+		}
+	case db.SyncFieldProject:
+		if change.Project != nil {
+			return *change.Project, true
+		}
+	case db.SyncFieldDueAt:
+		if change.DueAt != nil {
+			return *change.DueAt, true
+		}
+	case db.SyncFieldTags:
+		if change.Tags != nil {
+			return *change.Tags, true
+		}
+	case db.SyncFieldRecurrence:
+		if change.Recurrence != nil {
+			return *change.Recurrence, true
+		}
+	}
+	return nil, false
+}
+
+// fieldValue returns the value of a synced field of the task.
+func (t *dbTask) fieldValue(field string) any {
+	switch field {
+	case db.SyncFieldDetail:
+		return t.Detail
+	case db.SyncFieldCompleted:
+		return t.Completed
+	case db.SyncFieldDueAt:
+		return t.DueAt
+	case db.SyncFieldTags:
+		return t.Tags
+	case db.SyncFieldRecurrence:
+		return t.Recurrence
+	default:
+		return t.Project
+	}
+}
+
+// sameFieldValue returns true if a and b are the same value of a synced
+// field.
+func sameFieldValue(a, b any) bool {
+	if aTags, ok := a.([]string); ok {
+		bTags, _ := b.([]string)
+		return slices.Equal(aTags, bTags)
+	}
+	return a == b
+}
+
+// clearsField returns true if value removes an optional synced field from a
+// task.
+func clearsField(field string, value any) bool {
+	switch field {
+	case db.SyncFieldDueAt:
+		return value == int64(0)
+	case db.SyncFieldTags:
+		return len(value.([]string)) == 0
+	case db.SyncFieldRecurrence:
+		return value == ""
+	default:
+		return false
+	}
+}
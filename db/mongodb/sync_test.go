@@ -0,0 +1,431 @@
+package mongodb
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSyncUpdate(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	const userID = "user"
+	// serverTime is when the fields of the task were last modified on the
+	// server.
+	serverTime := time.Now().Add(-time.Hour).UnixMilli()
+	before, after := serverTime-1, serverTime+1
+	detail, project := "client detail", "client project"
+	completed := true
+	dueAt, noDueAt := time.Now().Add(24*time.Hour).Unix(), int64(0)
+	tags, noTags := []string{"home", "urgent"}, []string{}
+	recurrence := "FREQ=WEEKLY"
+
+	tests := []struct {
+		name string
+		// legacy is true if the task has no field times.
+		legacy    bool
+		completed bool
+		dueAt     int64
+		tags      []string
+		// newerOnServer is a field modified on the server after the change.
+		newerOnServer string
+		change        *db.SyncChange
+		missing       bool
+		nTombstones   int
+		// staleWrites is the number of updates that find the task changed by
+		// another request.
+		staleWrites int
+		wantStatus  string
+		wantChanged bool
+		// wantSet and wantUnset are the fields written and removed by the
+		// last update attempted.
+		wantSet       []string
+		wantUnset     []string
+		wantConflicts []string
+		wantError     string
+	}{
+		{
+			name:        "client is newer",
+			change:      &db.SyncChange{ModifiedAt: after, Detail: &detail, Project: &project},
+			wantStatus:  db.SyncStatusApplied,
+			wantChanged: true,
+			wantSet:     []string{db.SyncFieldDetail, db.SyncFieldProject},
+		},
+		{
+			name:          "server is newer",
+			change:        &db.SyncChange{ModifiedAt: before, Detail: &detail},
+			wantStatus:    db.SyncStatusConflict,
+			wantConflicts: []string{db.SyncFieldDetail},
+		},
+		{
+			name:          "same modification time",
+			change:        &db.SyncChange{ModifiedAt: serverTime, Completed: &completed},
+			wantStatus:    db.SyncStatusConflict,
+			wantConflicts: []string{db.SyncFieldCompleted},
+		},
+		{
+			name:       "unchanged value",
+			change:     &db.SyncChange{ModifiedAt: before, Detail: new(string)},
+			wantStatus: db.SyncStatusApplied,
+		},
+		{
+			name:          "legacy task is newer",
+			legacy:        true,
+			change:        &db.SyncChange{ModifiedAt: before, Project: &project},
+			wantStatus:    db.SyncStatusConflict,
+			wantConflicts: []string{db.SyncFieldProject},
+		},
+		{
+			name:        "legacy task is older",
+			legacy:      true,
+			change:      &db.SyncChange{ModifiedAt: after, Project: &project},
+			wantStatus:  db.SyncStatusApplied,
+			wantChanged: true,
+			wantSet:     []string{db.SyncFieldProject},
+		},
+		{
+			name:        "client change in the future",
+			change:      &db.SyncChange{ModifiedAt: time.Now().Add(2 * time.Hour).UnixMilli(), Detail: &detail},
+			wantStatus:  db.SyncStatusApplied,
+			wantChanged: true,
+			wantSet:     []string{db.SyncFieldDetail},
+		},
+		{
+			name:          "some fields are newer on the server",
+			newerOnServer: db.SyncFieldProject,
+			change:        &db.SyncChange{ModifiedAt: after, Detail: &detail, Project: &project},
+			wantStatus:    db.SyncStatusConflict,
+			wantChanged:   true,
+			wantSet:       []string{db.SyncFieldDetail},
+			wantConflicts: []string{db.SyncFieldProject},
+		},
+		{
+			name:        "client sets the due date",
+			change:      &db.SyncChange{ModifiedAt: after, DueAt: &dueAt},
+			wantStatus:  db.SyncStatusApplied,
+			wantChanged: true,
+			wantSet:     []string{db.SyncFieldDueAt},
+		},
+		{
+			name:        "client removes the due date",
+			dueAt:       dueAt,
+			change:      &db.SyncChange{ModifiedAt: after, DueAt: &noDueAt},
+			wantStatus:  db.SyncStatusApplied,
+			wantChanged: true,
+			wantUnset:   []string{db.SyncFieldDueAt},
+		},
+		{
+			name:          "due date is newer on the server",
+			newerOnServer: db.SyncFieldDueAt,
+			change:        &db.SyncChange{ModifiedAt: after, DueAt: &dueAt},
+			wantStatus:    db.SyncStatusConflict,
+			wantConflicts: []string{db.SyncFieldDueAt},
+		},
+		{
+			name:        "client sets tags and recurrence",
+			change:      &db.SyncChange{ModifiedAt: after, Tags: &tags, Recurrence: &recurrence},
+			wantStatus:  db.SyncStatusApplied,
+			wantChanged: true,
+			wantSet:     []string{db.SyncFieldTags, db.SyncFieldRecurrence},
+		},
+		{
+			name:        "client removes the tags",
+			tags:        tags,
+			change:      &db.SyncChange{ModifiedAt: after, Tags: &noTags},
+			wantStatus:  db.SyncStatusApplied,
+			wantChanged: true,
+			wantUnset:   []string{db.SyncFieldTags},
+		},
+		{
+			name:       "unchanged tags",
+			tags:       tags,
+			change:     &db.SyncChange{ModifiedAt: before, Tags: &tags},
+			wantStatus: db.SyncStatusApplied,
+		},
+		{
+			name:          "tags are newer on the server",
+			newerOnServer: db.SyncFieldTags,
+			change:        &db.SyncChange{ModifiedAt: after, Tags: &tags},
+			wantStatus:    db.SyncStatusConflict,
+			wantConflicts: []string{db.SyncFieldTags},
+		},
+		{
+			name:        "task changed by another request",
+			change:      &db.SyncChange{ModifiedAt: after, Detail: &detail},
+			staleWrites: 1,
+			wantStatus:  db.SyncStatusApplied,
+			wantChanged: true,
+			wantSet:     []string{db.SyncFieldDetail},
+		},
+		{
+			name:        "task keeps changing",
+			change:      &db.SyncChange{ModifiedAt: after, Detail: &detail},
+			staleWrites: maxSyncUpdateAttempts,
+			wantStatus:  db.SyncStatusRejected,
+			wantSet:     []string{db.SyncFieldDetail},
+			wantError:   "another request",
+		},
+		{
+			name:       "complete a completed task",
+			completed:  true,
+			change:     &db.SyncChange{ModifiedAt: after, Completed: &completed},
+			wantStatus: db.SyncStatusApplied,
+		},
+		{
+			name:       "update a completed task",
+			completed:  true,
+			change:     &db.SyncChange{ModifiedAt: after, Detail: &detail},
+			wantStatus: db.SyncStatusRejected,
+			wantError:  "completed tasks",
+		},
+		{
+			name:        "deleted task",
+			change:      &db.SyncChange{ModifiedAt: after, Detail: &detail},
+			missing:     true,
+			nTombstones: 1,
+			wantStatus:  db.SyncStatusRejected,
+			wantError:   "has been deleted",
+		},
+		{
+			name:       "unknown task",
+			change:     &db.SyncChange{ModifiedAt: after, Detail: &detail},
+			missing:    true,
+			wantStatus: db.SyncStatusRejected,
+			wantError:  "does not exist",
+		},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			task := &dbTask{
+				ID:        primitive.NewObjectID(),
+				OwnerID:   userID,
+				TaskInfo:  db.TaskInfo{Completed: test.completed, DueAt: test.dueAt, Tags: test.tags, Timestamp: serverTime / 1000},
+				UpdatedAt: serverTime,
+			}
+			if !test.legacy {
+				task.FieldTimes = newFieldTimes(serverTime)
+			}
+			if test.newerOnServer != "" {
+				task.FieldTimes[test.newerOnServer] = after + 1
+			}
+
+			change := *test.change
+			change.Action = db.SyncActionUpdate
+			change.TaskID = task.ID.Hex()
+
+			if test.missing {
+				mt.AddMockResponses(mockFound(mt, taskCollection), mockCounted(mt, tombstonesCollection, test.nTombstones))
+			}
+			for i := 0; i < test.staleWrites && !test.missing; i++ {
+				mt.AddMockResponses(mockFound(mt, taskCollection, task), mockFoundAndModified(mt, nil))
+			}
+			written := slices.Concat(test.wantSet, test.wantUnset)
+			if !test.missing && test.staleWrites < maxSyncUpdateAttempts {
+				mt.AddMockResponses(mockFound(mt, taskCollection, task))
+				if len(written) > 0 {
+					updated := *task
+					if slices.Contains(written, db.SyncFieldDueAt) {
+						// Reminders are moved to the new due date.
+						updated.DueAt = *change.DueAt
+						mt.AddMockResponses(mockFoundAndModified(mt, &updated), mockWritten(1))
+					} else {
+						mt.AddMockResponses(mockFoundAndModified(mt, &updated))
+					}
+				}
+				if test.wantStatus != db.SyncStatusRejected {
+					mt.AddMockResponses(mockFound(mt, commentsCollection))
+				}
+			}
+
+			results, err := newMockMongoDB(mt).SyncTasks(userID, []*db.SyncChange{&change})
+			if err != nil {
+				mt.Fatalf("SyncTasks error: %v", err)
+			}
+
+			result := results[0]
+			if result.Status != test.wantStatus || result.Changed != test.wantChanged || result.TaskID != change.TaskID {
+				mt.Fatalf("want status %s and changed %v, got %+v", test.wantStatus, test.wantChanged, result)
+			}
+			if test.wantError != "" {
+				if !strings.Contains(result.Error, test.wantError) {
+					mt.Fatalf("want error %q, got %q", test.wantError, result.Error)
+				}
+				if result.Task != nil {
+					mt.Fatalf("want no task for rejected changes, got %+v", result.Task)
+				}
+			}
+
+			var conflicts []string
+			for _, conflict := range result.Conflicts {
+				conflicts = append(conflicts, conflict.Field)
+			}
+			if !slices.Equal(conflicts, test.wantConflicts) {
+				mt.Fatalf("want conflicts %v, got %v", test.wantConflicts, conflicts)
+			}
+
+			update := sentCommand(mt, "findAndModify", taskCollection)
+			if len(written) == 0 {
+				if update != nil {
+					mt.Fatal("want task not updated")
+				}
+				return
+			}
+
+			// Only the winning fields are written, with the client time capped
+			// to the server time, and only if the task has not changed since
+			// it was read.
+			set := update.Lookup("update", "$set").Document()
+			unset, _ := update.Lookup("update", "$unset").DocumentOK()
+			for _, field := range syncFields {
+				_, err := set.LookupErr(field)
+				want := slices.Contains(test.wantSet, field)
+				if want != (err == nil) {
+					mt.Fatalf("want %s set %v, got %v", field, want, set)
+				}
+				_, err = unset.LookupErr(field)
+				wantUnset := slices.Contains(test.wantUnset, field)
+				if wantUnset != (err == nil) {
+					mt.Fatalf("want %s unset %v, got %v", field, wantUnset, unset)
+				}
+				if !want && !wantUnset {
+					continue
+				}
+
+				modifiedAt := set.Lookup(fieldTimeKey(field)).Int64()
+				if modifiedAt > time.Now().UnixMilli() || (change.ModifiedAt == after && modifiedAt != after) {
+					mt.Fatalf("want %s modified at the client time, got %d", field, modifiedAt)
+				}
+			}
+			if updatedAt := update.Lookup("query", updatedAtKey).Int64(); updatedAt != serverTime {
+				mt.Fatalf("want update of the task written at %d, got %d", serverTime, updatedAt)
+			}
+			rescheduled := sentCommand(mt, "update", remindersCollection) != nil
+			if want := slices.Contains(written, db.SyncFieldDueAt); rescheduled != want {
+				mt.Fatalf("want reminders rescheduled %v, got %v", want, rescheduled)
+			}
+		})
+	}
+}
+
+func TestSyncDelete(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	const userID = "user"
+	serverTime := time.Now().Add(-time.Hour).UnixMilli()
+
+	tests := []struct {
+		name       string
+		modifiedAt int64
+		// deleted is the number of tasks deleted, or -1 if the task is not
+		// deleted.
+		deleted       int
+		wantStatus    string
+		wantChanged   bool
+		wantConflicts int
+	}{
+		{"deleted after the last change", serverTime + 1, 1, db.SyncStatusApplied, true, 0},
+		{"deleted at the last change", serverTime, 1, db.SyncStatusApplied, true, 0},
+		{"changed after the deletion", serverTime - 1, -1, db.SyncStatusConflict, false, len(syncFields)},
+		{"deleted by another request", serverTime + 1, 0, db.SyncStatusApplied, false, 0},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			task := &dbTask{ID: primitive.NewObjectID(), OwnerID: userID, FieldTimes: newFieldTimes(serverTime)}
+			mt.AddMockResponses(mockFound(mt, taskCollection, task))
+			if test.deleted >= 0 {
+				mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: test.deleted}))
+			} else {
+				mt.AddMockResponses(mockFound(mt, commentsCollection))
+			}
+
+			change := &db.SyncChange{Action: db.SyncActionDelete, TaskID: task.ID.Hex(), ModifiedAt: test.modifiedAt}
+			results, err := newMockMongoDB(mt).SyncTasks(userID, []*db.SyncChange{change})
+			if err != nil {
+				mt.Fatalf("SyncTasks error: %v", err)
+			}
+
+			result := results[0]
+			if result.Status != test.wantStatus || result.Changed != test.wantChanged || len(result.Conflicts) != test.wantConflicts {
+				mt.Fatalf("want status %s, changed %v and %d conflicts, got %+v", test.wantStatus, test.wantChanged, test.wantConflicts, result)
+			}
+
+			// The task is kept with its server values if it has conflicts.
+			if (result.Task != nil) != (test.deleted < 0) {
+				mt.Fatalf("want task returned %v, got %+v", test.deleted < 0, result.Task)
+			}
+			if (sentCommand(mt, "delete", taskCollection) != nil) != (test.deleted >= 0) {
+				mt.Fatalf("want task deleted %v", test.deleted >= 0)
+			}
+		})
+	}
+}
+
+func TestSyncCreate(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	const (
+		userID   = "user"
+		clientID = "client"
+	)
+	detail := "detail"
+
+	tests := []struct {
+		name string
+		// existing is true if a task was already created with the client ID.
+		existing bool
+		// duplicate is true if the task is created by another request at the
+		// same time.
+		duplicate   bool
+		wantChanged bool
+	}{
+		{"new task", false, false, true},
+		{"retried sync", true, false, false},
+		{"concurrent sync", false, true, false},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			existing := &dbTask{ID: primitive.NewObjectID(), OwnerID: userID, ClientID: clientID, TaskInfo: db.TaskInfo{Detail: detail}}
+			switch {
+			case test.existing:
+				mt.AddMockResponses(mockFound(mt, taskCollection, existing))
+			case test.duplicate:
+				mt.AddMockResponses(
+					mockFound(mt, taskCollection),
+					mtest.CreateWriteErrorsResponse(mtest.WriteError{Code: 11000, Message: "duplicate key"}),
+					mockFound(mt, taskCollection, existing),
+				)
+			default:
+				mt.AddMockResponses(mockFound(mt, taskCollection), mtest.CreateSuccessResponse())
+			}
+			mt.AddMockResponses(mockFound(mt, commentsCollection))
+
+			change := &db.SyncChange{Action: db.SyncActionCreate, ClientID: clientID, ModifiedAt: time.Now().UnixMilli(), Detail: &detail}
+			results, err := newMockMongoDB(mt).SyncTasks(userID, []*db.SyncChange{change})
+			if err != nil {
+				mt.Fatalf("SyncTasks error: %v", err)
+			}
+
+			result := results[0]
+			if result.Status != db.SyncStatusApplied || result.Changed != test.wantChanged || result.ClientID != clientID {
+				mt.Fatalf("want applied with changed %v, got %+v", test.wantChanged, result)
+			}
+
+			// Every sync of the change returns the same task.
+			if !test.wantChanged && result.TaskID != existing.ID.Hex() {
+				mt.Fatalf("want existing task %s, got %s", existing.ID.Hex(), result.TaskID)
+			}
+			if test.existing && sentCommand(mt, "insert", taskCollection) != nil {
+				mt.Fatal("want no task inserted")
+			}
+		})
+	}
+}
@@ -13,43 +13,57 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// CreateTask creates a new task entry for a user.
-func (mdb *MongoDB) CreateTask(userID string, taskDetail string) ([]*db.Task, error) {
+// CreateTask creates a new task entry for a user and returns the new task and
+// the user's tasks. The project, due date, tags and recurrence rule are
+// optional.
+func (mdb *MongoDB) CreateTask(userID string, taskDetail, project string, dueAt int64, tags []string, recurrence string) (*db.Task, []*db.Task, error) {
 	if userID == "" || taskDetail == "" {
-		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+		return nil, nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
 	}
 
 	userDBID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
-		return nil, fmt.Errorf("primitive.ObjectIDFromHex error: %w", err)
+		return nil, nil, fmt.Errorf("primitive.ObjectIDFromHex error: %w", err)
 	}
 
 	// Check if user really exists.
 	filter := bson.M{dbIDKey: userDBID}
 	nUsersFound, err := mdb.usersCollection.CountDocuments(mdb.ctx, filter)
 	if err != nil {
-		return nil, fmt.Errorf("usersCollection.CountDocuments error: %w", err)
+		return nil, nil, fmt.Errorf("usersCollection.CountDocuments error: %w", err)
 	}
 
 	if nUsersFound != 1 {
-		return nil, fmt.Errorf("expected userID to match one user, got %d", nUsersFound)
+		return nil, nil, fmt.Errorf("expected userID to match one user, got %d", nUsersFound)
 	}
 
+	now := time.Now()
 	taskInfo := &dbTask{
 		ID:      primitive.NewObjectID(),
 		OwnerID: userID,
 		TaskInfo: db.TaskInfo{
-			Detail:    taskDetail,
-			Timestamp: time.Now().Unix(),
+			Detail:     taskDetail,
+			Timestamp:  now.Unix(),
+			Project:    project,
+			DueAt:      dueAt,
+			Tags:       tags,
+			Recurrence: recurrence,
 		},
+		UpdatedAt:  now.UnixMilli(),
+		FieldTimes: newFieldTimes(now.UnixMilli()),
 	}
 
 	_, err = mdb.tasksCollection.InsertOne(mdb.ctx, taskInfo)
 	if err != nil {
-		return nil, fmt.Errorf("tasksCollection.InsertOne error: %w", err)
+		return nil, nil, fmt.Errorf("tasksCollection.InsertOne error: %w", err)
 	}
 
-	return mdb.userTasks(userID, nil)
+	tasks, err := mdb.userTasks(userID, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return taskInfo.info(), tasks, nil
 }
 
 // Tasks returns all the tasks created by the provided userID.
@@ -70,47 +84,85 @@ func (mdb *MongoDB) TasksWithStatus(userID string, completed bool) ([]*db.Task,
 	return mdb.userTasks(userID, bson.M{completedKey: completed})
 }
 
-// UpdateTask updates an existing task for the provided userID. If no task
+// UpdateTask updates an existing task the provided userID owns or can edit.
+// Only the owner of a task can change its project. Returns the list of tasks
+// the updated task belongs to for the user, i.e the user's own tasks, the
+// tasks shared with the user or the tasks in the task's workspace. If no task
 // match the provided taskID, an ErrorInvalidRequest is returned.
-func (mdb *MongoDB) UpdateTask(userID, taskID string, newTaskDetail string, markAsComplete *bool) ([]*db.Task, error) {
-	nothingToUpdate := (newTaskDetail == "" && markAsComplete == nil)
+func (mdb *MongoDB) UpdateTask(userID, taskID string, taskUpdate *db.TaskUpdate) ([]*db.Task, error) {
+	nothingToUpdate := taskUpdate == nil || (taskUpdate.Detail == "" && taskUpdate.MarkAsComplete == nil && taskUpdate.Project == nil && taskUpdate.DueAt == nil && taskUpdate.Tags == nil && taskUpdate.Recurrence == nil)
 	if userID == "" || taskID == "" || nothingToUpdate {
 		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
 	}
 
-	taskDBID, err := primitive.ObjectIDFromHex(taskID)
+	task, permission, err := mdb.taskWithPermission(userID, taskID)
 	if err != nil {
-		return nil, fmt.Errorf("primitive.ObjectIDFromHex error: %w", err)
+		return nil, err
 	}
 
-	filter := bson.M{
-		ownerIDKey: userID,
-		dbIDKey:    taskDBID,
+	if permission == db.PermissionRead {
+		return nil, fmt.Errorf("%w: you do not have permission to update this task", db.ErrorInvalidRequest)
 	}
 
-	var task *dbTask
-	err = mdb.tasksCollection.FindOne(mdb.ctx, filter).Decode(&task)
-	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, fmt.Errorf("%w: task does not exist", db.ErrorInvalidRequest)
-		}
-		return nil, fmt.Errorf("tasksCollection.FindOne error: %w", err)
+	if taskUpdate.Project != nil && permission != db.PermissionOwner {
+		return nil, fmt.Errorf("%w: only the owner of a task can change its project", db.ErrorInvalidRequest)
 	}
 
 	if task.Completed {
 		return nil, fmt.Errorf("%w: completed tasks cannot be updated", db.ErrorInvalidRequest)
 	}
 
-	update := make(bson.M, 0)
-	if newTaskDetail != "" {
-		update[taskDetailKey] = newTaskDetail
+	now := time.Now().UnixMilli()
+	set := bson.M{updatedAtKey: now}
+	unset := bson.M{}
+	if taskUpdate.Detail != "" {
+		set[taskDetailKey] = taskUpdate.Detail
+		set[fieldTimeKey(db.SyncFieldDetail)] = now
+	}
+
+	if taskUpdate.MarkAsComplete != nil && *taskUpdate.MarkAsComplete != false {
+		set[completedKey] = *taskUpdate.MarkAsComplete
+		set[fieldTimeKey(db.SyncFieldCompleted)] = now
+	}
+
+	if taskUpdate.Project != nil {
+		set[projectKey] = *taskUpdate.Project
+		set[fieldTimeKey(db.SyncFieldProject)] = now
 	}
 
-	if markAsComplete != nil && *markAsComplete != false {
-		update[completedKey] = *markAsComplete
+	if taskUpdate.DueAt != nil {
+		if *taskUpdate.DueAt == 0 {
+			unset[dueAtKey] = ""
+		} else {
+			set[dueAtKey] = *taskUpdate.DueAt
+		}
+		set[fieldTimeKey(db.SyncFieldDueAt)] = now
+	}
+
+	if taskUpdate.Tags != nil {
+		if len(*taskUpdate.Tags) == 0 {
+			unset[tagsKey] = ""
+		} else {
+			set[tagsKey] = *taskUpdate.Tags
+		}
+		set[fieldTimeKey(db.SyncFieldTags)] = now
 	}
 
-	res, err := mdb.tasksCollection.UpdateOne(mdb.ctx, filter, bson.M{"$set": update}, options.Update().SetUpsert(false))
+	if taskUpdate.Recurrence != nil {
+		if *taskUpdate.Recurrence == "" {
+			unset[recurrenceKey] = ""
+		} else {
+			set[recurrenceKey] = *taskUpdate.Recurrence
+		}
+		set[fieldTimeKey(db.SyncFieldRecurrence)] = now
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	res, err := mdb.tasksCollection.UpdateOne(mdb.ctx, bson.M{dbIDKey: task.ID}, update, options.Update().SetUpsert(false))
 	if err != nil {
 		return nil, fmt.Errorf("tasksCollection.UpdateOne error: %w", err)
 	}
@@ -119,28 +171,153 @@ func (mdb *MongoDB) UpdateTask(userID, taskID string, newTaskDetail string, mark
 		return nil, fmt.Errorf("%w: task does not exist", db.ErrorInvalidRequest)
 	}
 
-	return mdb.userTasks(userID, nil)
+	if taskUpdate.DueAt != nil && *taskUpdate.DueAt != task.DueAt {
+		err = mdb.rescheduleReminders(task.ID.Hex(), *taskUpdate.DueAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return mdb.tasksAfterChange(userID, task, permission)
 }
 
-// DeleteTask removes an existing task from the record of the user that
-// match the provided userID. If no task match the provided taskID, an
-// ErrorInvalidRequest is returned.
+// DeleteTask removes an existing task the provided userID owns, or a task in a
+// workspace where the user is the owner or a member. Returns the list of tasks
+// the deleted task belonged to for the user, i.e. the user's own tasks, the
+// tasks shared with the user or the tasks in the task's workspace. If no task
+// match the provided taskID, an ErrorInvalidRequest is returned.
 func (mdb *MongoDB) DeleteTask(userID, taskID string) ([]*db.Task, error) {
 	if userID == "" || taskID == "" {
 		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
 	}
 
+	task, permission, err := mdb.taskWithPermission(userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canDeleteTask(task, permission) {
+		return nil, fmt.Errorf("%w: you do not have permission to delete this task", db.ErrorInvalidRequest)
+	}
+
+	err = mdb.removeTask(task)
+	if err != nil {
+		return nil, err
+	}
+
+	return mdb.tasksAfterChange(userID, task, permission)
+}
+
+// canDeleteTask checks if a user with the provided permission on task can
+// delete it. Deleting a task also deletes its shares, history, comments,
+// attachments and reminders, so collaborators cannot delete tasks shared with
+// them even with the edit permission. Workspace tasks can be deleted by the
+// workspace owner and members.
+func canDeleteTask(task *dbTask, permission string) bool {
+	if task.WorkspaceID != "" {
+		return permission == db.PermissionOwner || permission == db.PermissionEdit
+	}
+	return permission == db.PermissionOwner
+}
+
+// removeTask deletes task with its shares, history, comments, attachments
+// and reminders, and records a tombstone so clients can sync the deletion.
+// Returns ErrorInvalidRequest if the task has already been deleted.
+func (mdb *MongoDB) removeTask(task *dbTask) error {
+	taskID := task.ID.Hex()
+	res, err := mdb.tasksCollection.DeleteOne(mdb.ctx, bson.M{dbIDKey: task.ID})
+	if err != nil {
+		return fmt.Errorf("tasksCollection.DeleteOne error: %w", err)
+	}
+
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("%w: task does not exist", db.ErrorInvalidRequest)
+	}
+
+	now := time.Now()
+	_, err = mdb.tombstonesCollection.InsertOne(mdb.ctx, &dbTaskTombstone{
+		ID:          primitive.NewObjectID(),
+		TaskID:      taskID,
+		OwnerID:     task.OwnerID,
+		WorkspaceID: task.WorkspaceID,
+		DeletedAt:   now.UnixMilli(),
+		ExpiresAt:   now.Add(tombstoneRetention),
+	})
+	if err != nil {
+		mdb.log.Error("failed to record task tombstone: ", "error", err)
+	}
+
+	_, err = mdb.sharesCollection.DeleteMany(mdb.ctx, bson.M{taskIDKey: taskID})
+	if err != nil {
+		mdb.log.Error("failed to delete task shares: ", "error", err)
+	}
+
+	_, err = mdb.taskHistoryCollection.DeleteMany(mdb.ctx, bson.M{taskIDKey: taskID})
+	if err != nil {
+		mdb.log.Error("failed to delete task history: ", "error", err)
+	}
+
+	_, err = mdb.commentsCollection.DeleteMany(mdb.ctx, bson.M{taskIDKey: taskID})
+	if err != nil {
+		mdb.log.Error("failed to delete task comments: ", "error", err)
+	}
+
+	_, err = mdb.attachmentsCollection.DeleteMany(mdb.ctx, bson.M{taskIDKey: taskID})
+	if err != nil {
+		mdb.log.Error("failed to delete task attachments: ", "error", err)
+	}
+
+	_, err = mdb.remindersCollection.DeleteMany(mdb.ctx, bson.M{taskIDKey: taskID})
+	if err != nil {
+		mdb.log.Error("failed to delete task reminders: ", "error", err)
+	}
+
+	return nil
+}
+
+// taskWithPermission returns the task with the provided taskID and the
+// permission the user with the provided userID has on it. Returns
+// ErrorInvalidRequest if the task does not exist or the user has no access to
+// it.
+func (mdb *MongoDB) taskWithPermission(userID, taskID string) (*dbTask, string, error) {
 	taskDBID, err := primitive.ObjectIDFromHex(taskID)
 	if err != nil {
-		return nil, fmt.Errorf("primitive.ObjectIDFromHex error: %w", err)
+		return nil, "", fmt.Errorf("%w: invalid task ID", db.ErrorInvalidRequest)
 	}
 
-	filter := bson.M{
-		ownerIDKey: userID,
-		dbIDKey:    taskDBID,
+	var task *dbTask
+	err = mdb.tasksCollection.FindOne(mdb.ctx, bson.M{dbIDKey: taskDBID}).Decode(&task)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, "", fmt.Errorf("%w: task does not exist", db.ErrorInvalidRequest)
+		}
+		return nil, "", fmt.Errorf("tasksCollection.FindOne error: %w", err)
+	}
+
+	permission, err := mdb.taskPermission(userID, task)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Tasks the user cannot access are reported as missing so their
+	// existence is not revealed.
+	if permission == "" {
+		return nil, "", fmt.Errorf("%w: task does not exist", db.ErrorInvalidRequest)
 	}
 
-	res, err := mdb.tasksCollection.DeleteOne(mdb.ctx, filter)
+	return task, permission, nil
+}
+
+// TaskAudience returns the IDs of the users that can access the task with the
+// provided taskID. Returns ErrorInvalidRequest if the task does not exist.
+func (mdb *MongoDB) TaskAudience(taskID string) ([]string, error) {
+	taskDBID, err := primitive.ObjectIDFromHex(taskID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid task ID", db.ErrorInvalidRequest)
+	}
+
+	var task *dbTask
+	err = mdb.tasksCollection.FindOne(mdb.ctx, bson.M{dbIDKey: taskDBID}).Decode(&task)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, fmt.Errorf("%w: task does not exist", db.ErrorInvalidRequest)
@@ -148,21 +325,161 @@ func (mdb *MongoDB) DeleteTask(userID, taskID string) ([]*db.Task, error) {
 		return nil, fmt.Errorf("tasksCollection.FindOne error: %w", err)
 	}
 
-	if res.DeletedCount == 0 {
-		return nil, fmt.Errorf("%w: task does not exist", db.ErrorInvalidRequest)
+	return mdb.taskAudience(task)
+}
+
+// TaskWorkspaceID returns the ID of the workspace of the task with the
+// provided taskID, or an empty string if the task is not in a workspace.
+// Returns ErrorInvalidRequest if the task does not exist.
+func (mdb *MongoDB) TaskWorkspaceID(taskID string) (string, error) {
+	taskDBID, err := primitive.ObjectIDFromHex(taskID)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid task ID", db.ErrorInvalidRequest)
 	}
 
-	return mdb.userTasks(userID, nil)
+	var task *dbTask
+	opts := options.FindOne().SetProjection(bson.M{workspaceIDKey: 1})
+	err = mdb.tasksCollection.FindOne(mdb.ctx, bson.M{dbIDKey: taskDBID}, opts).Decode(&task)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", fmt.Errorf("%w: task does not exist", db.ErrorInvalidRequest)
+		}
+		return "", fmt.Errorf("tasksCollection.FindOne error: %w", err)
+	}
+
+	return task.WorkspaceID, nil
+}
+
+// taskAudience returns the IDs of the users that can access task.
+func (mdb *MongoDB) taskAudience(task *dbTask) ([]string, error) {
+	var userIDs []string
+	if task.WorkspaceID != "" {
+		cur, err := mdb.membersCollection.Find(mdb.ctx, bson.M{workspaceIDKey: task.WorkspaceID, invitedKey: false})
+		if err != nil {
+			return nil, fmt.Errorf("membersCollection.Find error: %w", err)
+		}
+
+		var members []*dbWorkspaceMember
+		err = cur.All(mdb.ctx, &members)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode retrieved workspace members: %w", err)
+		}
+
+		for _, member := range members {
+			userIDs = append(userIDs, member.UserID)
+		}
+		return userIDs, nil
+	}
+
+	shareFilters := bson.A{bson.M{taskIDKey: task.ID.Hex()}}
+	if task.Project != "" {
+		shareFilters = append(shareFilters, bson.M{ownerIDKey: task.OwnerID, projectKey: task.Project})
+	}
+
+	cur, err := mdb.sharesCollection.Find(mdb.ctx, bson.M{"$or": shareFilters})
+	if err != nil {
+		return nil, fmt.Errorf("sharesCollection.Find error: %w", err)
+	}
+
+	var shares []*dbShare
+	err = cur.All(mdb.ctx, &shares)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode retrieved shares: %w", err)
+	}
+
+	seen := map[string]bool{task.OwnerID: true}
+	userIDs = append(userIDs, task.OwnerID)
+	for _, share := range shares {
+		if !seen[share.UserID] {
+			seen[share.UserID] = true
+			userIDs = append(userIDs, share.UserID)
+		}
+	}
+
+	return userIDs, nil
+}
+
+// tasksAfterChange returns the list of tasks a changed task belongs to for the
+// user with the provided userID and permission.
+func (mdb *MongoDB) tasksAfterChange(userID string, task *dbTask, permission string) ([]*db.Task, error) {
+	switch {
+	case task.WorkspaceID != "":
+		return mdb.workspaceTasks(task.WorkspaceID, nil)
+	case permission != db.PermissionOwner:
+		return mdb.sharedTasks(userID, nil)
+	default:
+		return mdb.userTasks(userID, nil)
+	}
+}
+
+// taskPermission returns the permission the user with the provided userID
+// has on task. Permissions on workspace tasks are granted by the user's
+// workspace role. An empty permission is returned if the user cannot access
+// the task.
+func (mdb *MongoDB) taskPermission(userID string, task *dbTask) (string, error) {
+	if task.WorkspaceID != "" {
+		role, err := mdb.workspaceRole(task.WorkspaceID, userID)
+		if err != nil {
+			return "", err
+		}
+		return workspacePermission(role), nil
+	}
+
+	if task.OwnerID == userID {
+		return db.PermissionOwner, nil
+	}
+
+	shareFilters := bson.A{bson.M{taskIDKey: task.ID.Hex()}}
+	if task.Project != "" {
+		shareFilters = append(shareFilters, bson.M{ownerIDKey: task.OwnerID, projectKey: task.Project})
+	}
+
+	cur, err := mdb.sharesCollection.Find(mdb.ctx, bson.M{userIDKey: userID, "$or": shareFilters})
+	if err != nil {
+		return "", fmt.Errorf("sharesCollection.Find error: %w", err)
+	}
+
+	var shares []*dbShare
+	err = cur.All(mdb.ctx, &shares)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode retrieved shares: %w", err)
+	}
+
+	var permission string
+	for _, share := range shares {
+		permission = highestPermission(permission, share.Permission)
+	}
+
+	return permission, nil
 }
 
 // userTasks returns a list of tasks for the user with the provided userID.
-// Tasks are sorted in descending order.
+// Tasks the user created in workspaces are not included. Tasks are sorted in
+// descending order.
 func (mdb *MongoDB) userTasks(userID string, extraFilter bson.M) ([]*db.Task, error) {
-	filter := bson.M{ownerIDKey: userID}
+	filter := bson.M{
+		ownerIDKey:     userID,
+		workspaceIDKey: bson.M{"$exists": false},
+	}
 	for key, val := range extraFilter {
 		filter[key] = val
 	}
 
+	dbTasks, err := mdb.findTasks(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	userTasks := make([]*db.Task, 0, len(dbTasks))
+	for _, task := range dbTasks {
+		userTasks = append(userTasks, task.info())
+	}
+
+	return mdb.prepareTasks(userTasks)
+}
+
+// findTasks returns the tasks that match filter.
+func (mdb *MongoDB) findTasks(filter bson.M) ([]*dbTask, error) {
 	cur, err := mdb.tasksCollection.Find(mdb.ctx, filter)
 	if err != nil {
 		return nil, fmt.Errorf("tasksCollection.Find error: %w", err)
@@ -174,21 +491,32 @@ func (mdb *MongoDB) userTasks(userID string, extraFilter bson.M) ([]*db.Task, er
 		return nil, fmt.Errorf("failed to decode retrieved tasks: %w", err)
 	}
 
-	userTasks := make([]*db.Task, 0, len(dbTasks))
-	for _, task := range dbTasks {
-		userTasks = append(userTasks, &db.Task{
-			ID: task.ID.Hex(),
-			TaskInfo: db.TaskInfo{
-				Detail:    task.Detail,
-				Completed: task.Completed,
-				Timestamp: task.Timestamp,
-			},
-		})
-	}
-
-	sort.SliceStable(userTasks, func(i, j int) bool {
-		return userTasks[i].Timestamp > userTasks[j].Timestamp
+	return dbTasks, nil
+}
+
+// prepareTasks sets the comment counts of tasks and sorts them in descending
+// order of their timestamp.
+func (mdb *MongoDB) prepareTasks(tasks []*db.Task) ([]*db.Task, error) {
+	err := mdb.setCommentCounts(tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].Timestamp > tasks[j].Timestamp
 	})
 
-	return userTasks, nil
+	return tasks, nil
+}
+
+// info returns the public information of a task.
+func (t *dbTask) info() *db.Task {
+	return &db.Task{
+		ID:          t.ID.Hex(),
+		WorkspaceID: t.WorkspaceID,
+		AssigneeID:  t.AssigneeID,
+		UpdatedAt:   t.UpdatedAt,
+		ClientID:    t.ClientID,
+		TaskInfo:    t.TaskInfo,
+	}
 }
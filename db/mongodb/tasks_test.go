@@ -0,0 +1,156 @@
+package mongodb
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCanDeleteTask(t *testing.T) {
+	personalTask := &dbTask{OwnerID: "owner"}
+	workspaceTask := &dbTask{OwnerID: "owner", WorkspaceID: "workspace"}
+
+	tests := []struct {
+		name       string
+		task       *dbTask
+		permission string
+		want       bool
+	}{
+		{"owner", personalTask, db.PermissionOwner, true},
+		{"edit collaborator", personalTask, db.PermissionEdit, false},
+		{"read collaborator", personalTask, db.PermissionRead, false},
+		{"workspace owner", workspaceTask, db.PermissionOwner, true},
+		{"workspace member", workspaceTask, db.PermissionEdit, true},
+		{"workspace viewer", workspaceTask, db.PermissionRead, false},
+		{"no access", personalTask, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := canDeleteTask(test.task, test.permission); got != test.want {
+				t.Fatalf("want %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestUpdateTaskPermissions(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	userID := primitive.NewObjectID().Hex()
+	project := "project"
+
+	tests := []struct {
+		name       string
+		permission string
+		update     *db.TaskUpdate
+	}{
+		{"read collaborator updates the detail", db.PermissionRead, &db.TaskUpdate{Detail: "detail"}},
+		{"edit collaborator changes the project", db.PermissionEdit, &db.TaskUpdate{Project: &project}},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			task := &dbTask{ID: primitive.NewObjectID(), OwnerID: primitive.NewObjectID().Hex()}
+			mt.AddMockResponses(mockTaskPermission(mt, task, userID, test.permission)...)
+
+			_, err := newMockMongoDB(mt).UpdateTask(userID, task.ID.Hex(), test.update)
+			if !errors.Is(err, db.ErrorInvalidRequest) {
+				mt.Fatalf("want ErrorInvalidRequest, got %v", err)
+			}
+			if sentCommand(mt, "update", taskCollection) != nil || sentCommand(mt, "findAndModify", taskCollection) != nil {
+				mt.Fatal("want task not updated")
+			}
+		})
+	}
+}
+
+func TestUpdateTaskFieldTimes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	userID := primitive.NewObjectID().Hex()
+	project := "project"
+	dueAt, noDueAt := int64(100), int64(0)
+	tags, recurrence := []string{"home"}, ""
+
+	tests := []struct {
+		name   string
+		update *db.TaskUpdate
+		// wantFieldTimes are the synced fields whose modification time is
+		// written.
+		wantFieldTimes []string
+	}{
+		{"detail", &db.TaskUpdate{Detail: "detail"}, []string{db.SyncFieldDetail}},
+		{"detail and project", &db.TaskUpdate{Detail: "detail", Project: &project}, []string{db.SyncFieldDetail, db.SyncFieldProject}},
+		{"due date", &db.TaskUpdate{DueAt: &dueAt}, []string{db.SyncFieldDueAt}},
+		{"removed due date", &db.TaskUpdate{DueAt: &noDueAt}, []string{db.SyncFieldDueAt}},
+		{"tags", &db.TaskUpdate{Tags: &tags}, []string{db.SyncFieldTags}},
+		{"removed recurrence", &db.TaskUpdate{Recurrence: &recurrence}, []string{db.SyncFieldRecurrence}},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			task := &dbTask{ID: primitive.NewObjectID(), OwnerID: userID, TaskInfo: db.TaskInfo{DueAt: 50}}
+			mt.AddMockResponses(mockFound(mt, taskCollection, task), mockWritten(1))
+			if test.update.DueAt != nil {
+				mt.AddMockResponses(mockWritten(1))
+			}
+			mt.AddMockResponses(mockFound(mt, taskCollection))
+
+			_, err := newMockMongoDB(mt).UpdateTask(userID, task.ID.Hex(), test.update)
+			if err != nil {
+				mt.Fatalf("UpdateTask error: %v", err)
+			}
+
+			set := sentCommand(mt, "update", taskCollection).Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set").Document()
+			elems, _ := set.Elements()
+			var fieldTimes []string
+			for _, elem := range elems {
+				if field, found := strings.CutPrefix(elem.Key(), fieldTimesKey+"."); found {
+					fieldTimes = append(fieldTimes, field)
+				}
+			}
+			slices.Sort(fieldTimes)
+			slices.Sort(test.wantFieldTimes)
+			if !slices.Equal(fieldTimes, test.wantFieldTimes) {
+				mt.Fatalf("want field times of %v, got %v", test.wantFieldTimes, fieldTimes)
+			}
+		})
+	}
+}
+
+func TestDeleteTaskPermissions(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	userID := primitive.NewObjectID().Hex()
+
+	tests := []struct {
+		name       string
+		workspace  string
+		permission string
+	}{
+		{"read collaborator", "", db.PermissionRead},
+		{"edit collaborator", "", db.PermissionEdit},
+		{"workspace viewer", "workspace", db.PermissionRead},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			task := &dbTask{ID: primitive.NewObjectID(), OwnerID: primitive.NewObjectID().Hex(), WorkspaceID: test.workspace}
+			mt.AddMockResponses(mockTaskPermission(mt, task, userID, test.permission)...)
+
+			_, err := newMockMongoDB(mt).DeleteTask(userID, task.ID.Hex())
+			if !errors.Is(err, db.ErrorInvalidRequest) {
+				mt.Fatalf("want ErrorInvalidRequest, got %v", err)
+			}
+			if sentCommand(mt, "delete", taskCollection) != nil {
+				mt.Fatal("want task not deleted")
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package mongodb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"github.com/ukane-philemon/megtask/totp"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SetupTOTP saves a TOTP secret for the user with the provided userID that
+// will be used for two-factor authentication once it has been confirmed with
+// EnableTOTP. Returns the user's username and ErrorInvalidRequest if
+// two-factor authentication is already enabled.
+func (mdb *MongoDB) SetupTOTP(userID, secret string) (string, error) {
+	if userID == "" || secret == "" {
+		return "", fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	user, err := mdb.user(userID)
+	if err != nil {
+		return "", err
+	}
+
+	if user.TOTPEnabled {
+		return "", fmt.Errorf("%w: two-factor authentication is already enabled", db.ErrorInvalidRequest)
+	}
+
+	_, err = mdb.usersCollection.UpdateByID(mdb.ctx, user.ID, bson.M{"$set": bson.M{totpPendingSecretKey: secret}})
+	if err != nil {
+		return "", fmt.Errorf("usersCollection.UpdateByID error: %w", err)
+	}
+
+	return user.Username, nil
+}
+
+// EnableTOTP enables two-factor authentication for the user with the provided
+// userID if code is valid for the secret saved with SetupTOTP. The provided
+// recovery codes can each be used once instead of a TOTP code. Returns
+// ErrorInvalidRequest if the code is invalid.
+func (mdb *MongoDB) EnableTOTP(userID, code string, recoveryCodes []string) error {
+	if userID == "" || code == "" || len(recoveryCodes) == 0 {
+		return fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	user, err := mdb.user(userID)
+	if err != nil {
+		return err
+	}
+
+	if user.TOTPEnabled {
+		return fmt.Errorf("%w: two-factor authentication is already enabled", db.ErrorInvalidRequest)
+	}
+
+	if user.TOTPPendingSecret == "" {
+		return fmt.Errorf("%w: two-factor authentication has not been set up", db.ErrorInvalidRequest)
+	}
+
+	step, valid := totp.Validate(user.TOTPPendingSecret, code, time.Now())
+	if !valid {
+		return fmt.Errorf("%w: invalid two-factor authentication code", db.ErrorInvalidRequest)
+	}
+
+	recoveryCodeHashes := make([]string, 0, len(recoveryCodes))
+	for _, recoveryCode := range recoveryCodes {
+		recoveryCodeHashes = append(recoveryCodeHashes, hashToken(recoveryCode))
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			totpSecretKey:    user.TOTPPendingSecret,
+			totpEnabledKey:   true,
+			totpLastStepKey:  step,
+			recoveryCodesKey: recoveryCodeHashes,
+		},
+		"$unset": bson.M{totpPendingSecretKey: ""},
+	}
+	_, err = mdb.usersCollection.UpdateByID(mdb.ctx, user.ID, update)
+	if err != nil {
+		return fmt.Errorf("usersCollection.UpdateByID error: %w", err)
+	}
+
+	return nil
+}
+
+// DisableTOTP disables two-factor authentication for the user with the
+// provided userID if code is a valid TOTP or recovery code. Returns
+// ErrorInvalidRequest if the code is invalid.
+func (mdb *MongoDB) DisableTOTP(userID, code string) error {
+	if userID == "" || code == "" {
+		return fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	user, err := mdb.user(userID)
+	if err != nil {
+		return err
+	}
+
+	if !user.TOTPEnabled {
+		return fmt.Errorf("%w: two-factor authentication is not enabled", db.ErrorInvalidRequest)
+	}
+
+	err = mdb.useTwoFactorCode(user, code)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{totpEnabledKey: false, totpLastStepKey: 0},
+		"$unset": bson.M{
+			totpSecretKey:        "",
+			totpPendingSecretKey: "",
+			recoveryCodesKey:     "",
+		},
+	}
+	_, err = mdb.usersCollection.UpdateByID(mdb.ctx, user.ID, update)
+	if err != nil {
+		return fmt.Errorf("usersCollection.UpdateByID error: %w", err)
+	}
+
+	return nil
+}
+
+// VerifyTwoFactor checks that code is a valid TOTP or recovery code for the
+// user with the provided userID and returns the user's information. Each code
+// can only be used once. Returns ErrorInvalidRequest if the code is invalid.
+func (mdb *MongoDB) VerifyTwoFactor(userID, code string) (*db.User, error) {
+	if userID == "" || code == "" {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	user, err := mdb.user(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.TOTPEnabled {
+		return nil, fmt.Errorf("%w: two-factor authentication is not enabled", db.ErrorInvalidRequest)
+	}
+
+	err = checkCanLogin(user)
+	if err != nil {
+		return nil, err
+	}
+
+	err = mdb.useTwoFactorCode(user, code)
+	if err != nil {
+		return nil, err
+	}
+
+	return mdb.userInfo(user), nil
+}
+
+// useTwoFactorCode checks that code is a valid TOTP code or an unused recovery
+// code for user and marks it as used.
+func (mdb *MongoDB) useTwoFactorCode(user *dbUser, code string) error {
+	invalidCodeErr := fmt.Errorf("%w: invalid two-factor authentication code", db.ErrorInvalidRequest)
+
+	if len(code) == totp.Digits {
+		step, valid := totp.Validate(user.TOTPSecret, code, time.Now())
+		if !valid {
+			return invalidCodeErr
+		}
+
+		// Only accept codes for a newer time step than the last accepted code
+		// so an intercepted code cannot be replayed.
+		filter := bson.M{
+			dbIDKey:         user.ID,
+			totpLastStepKey: bson.M{"$lt": step},
+		}
+		res, err := mdb.usersCollection.UpdateOne(mdb.ctx, filter, bson.M{"$set": bson.M{totpLastStepKey: step}})
+		if err != nil {
+			return fmt.Errorf("usersCollection.UpdateOne error: %w", err)
+		}
+
+		if res.ModifiedCount == 0 {
+			return invalidCodeErr
+		}
+
+		return nil
+	}
+
+	// Recovery codes are removed once they have been used.
+	codeHash := hashToken(code)
+	filter := bson.M{
+		dbIDKey:          user.ID,
+		recoveryCodesKey: codeHash,
+	}
+	res, err := mdb.usersCollection.UpdateOne(mdb.ctx, filter, bson.M{"$pull": bson.M{recoveryCodesKey: codeHash}})
+	if err != nil {
+		return fmt.Errorf("usersCollection.UpdateOne error: %w", err)
+	}
+
+	if res.ModifiedCount == 0 {
+		return invalidCodeErr
+	}
+
+	return nil
+}
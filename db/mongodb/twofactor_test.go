@@ -0,0 +1,195 @@
+package mongodb
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"github.com/ukane-philemon/megtask/totp"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// testTOTPSecret is the secret used in the test vectors of RFC 6238.
+const testTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// totpCode returns the TOTP code for secret at time t.
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("DecodeString error: %v", err)
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(at.Unix()/totp.Period))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+func TestVerifyTwoFactor(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	const recoveryCode = "recovery-code"
+	now := time.Now()
+	code := totpCode(t, testTOTPSecret, now)
+	step := now.Unix() / totp.Period
+
+	// wrongCode is valid for a time step outside the accepted clock drift.
+	wrongCode := totpCode(t, testTOTPSecret, now.Add(-time.Hour))
+
+	newUser := func() *dbUser {
+		return &dbUser{
+			ID:            primitive.NewObjectID(),
+			Username:      "user",
+			TOTPSecret:    testTOTPSecret,
+			TOTPEnabled:   true,
+			RecoveryCodes: []string{hashToken(recoveryCode)},
+		}
+	}
+
+	tests := []struct {
+		name string
+		// user returns the user verifying the code.
+		user func() *dbUser
+		code string
+		// modified is the number of users modified when the code is used,
+		// or -1 if the code is not used.
+		modified int
+		// wantUpdate is the update sent to use the code.
+		wantUpdate string
+		wantErr    bool
+	}{
+		{"valid code", newUser, code, 1, "$set", false},
+		{"replayed code", newUser, code, 0, "$set", true},
+		{"wrong code", newUser, wrongCode, -1, "", true},
+		{"unused recovery code", newUser, recoveryCode, 1, "$pull", false},
+		{"used recovery code", newUser, recoveryCode, 0, "$pull", true},
+		{"two-factor authentication not enabled", func() *dbUser {
+			user := newUser()
+			user.TOTPEnabled = false
+			return user
+		}, code, -1, "", true},
+		{"disabled account", func() *dbUser {
+			user := newUser()
+			user.Disabled = true
+			return user
+		}, code, -1, "", true},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			user := test.user()
+			mt.AddMockResponses(mockFound(mt, usersCollection, user))
+			if test.modified >= 0 {
+				mt.AddMockResponses(mockWritten(test.modified))
+			}
+
+			_, err := newMockMongoDB(mt).VerifyTwoFactor(user.ID.Hex(), test.code)
+			if test.wantErr {
+				if !errors.Is(err, db.ErrorInvalidRequest) {
+					mt.Fatalf("want ErrorInvalidRequest, got %v", err)
+				}
+			} else if err != nil {
+				mt.Fatalf("VerifyTwoFactor error: %v", err)
+			}
+
+			update := sentCommand(mt, "update", usersCollection)
+			if test.wantUpdate == "" {
+				if update != nil {
+					mt.Fatal("want the code to not be used")
+				}
+				return
+			}
+			if update == nil {
+				mt.Fatal("want the code to be used")
+			}
+
+			statement := update.Lookup("updates").Array().Index(0).Value().Document()
+			filter := statement.Lookup("q").Document()
+			switch test.wantUpdate {
+			case "$set":
+				// Only codes for a newer time step than the last accepted
+				// code are accepted.
+				lastStep := filter.Lookup(totpLastStepKey, "$lt").AsInt64()
+				if lastStep < step-1 || lastStep > step+1 {
+					mt.Fatalf("want codes before step %d rejected, got %d", step, lastStep)
+				}
+			case "$pull":
+				pulled := statement.Lookup("u", "$pull", recoveryCodesKey).StringValue()
+				if pulled != hashToken(recoveryCode) || filter.Lookup(recoveryCodesKey).StringValue() != pulled {
+					mt.Fatalf("want the recovery code hash used, got %s", pulled)
+				}
+			}
+		})
+	}
+}
+
+func TestEnableTOTP(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	recoveryCodes := []string{"recovery-code-1", "recovery-code-2"}
+	code := totpCode(t, testTOTPSecret, time.Now())
+	wrongCode := totpCode(t, testTOTPSecret, time.Now().Add(-time.Hour))
+
+	tests := []struct {
+		name    string
+		user    *dbUser
+		code    string
+		wantErr bool
+	}{
+		{"not set up", &dbUser{ID: primitive.NewObjectID()}, code, true},
+		{"already enabled", &dbUser{ID: primitive.NewObjectID(), TOTPSecret: testTOTPSecret, TOTPEnabled: true}, code, true},
+		{"wrong code", &dbUser{ID: primitive.NewObjectID(), TOTPPendingSecret: testTOTPSecret}, wrongCode, true},
+		{"valid code", &dbUser{ID: primitive.NewObjectID(), TOTPPendingSecret: testTOTPSecret}, code, false},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			mt.AddMockResponses(mockFound(mt, usersCollection, test.user), mockWritten(1))
+
+			err := newMockMongoDB(mt).EnableTOTP(test.user.ID.Hex(), test.code, recoveryCodes)
+			update := sentCommand(mt, "update", usersCollection)
+			if test.wantErr {
+				if !errors.Is(err, db.ErrorInvalidRequest) {
+					mt.Fatalf("want ErrorInvalidRequest, got %v", err)
+				}
+				if update != nil {
+					mt.Fatal("want two-factor authentication to not be enabled")
+				}
+				return
+			}
+			if err != nil {
+				mt.Fatalf("EnableTOTP error: %v", err)
+			}
+
+			set := update.Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set").Document()
+			if set.Lookup(totpSecretKey).StringValue() != testTOTPSecret {
+				mt.Fatal("want the pending secret enabled")
+			}
+
+			// Only the hashes of recovery codes are stored.
+			hashes, _ := set.Lookup(recoveryCodesKey).Array().Values()
+			if len(hashes) != len(recoveryCodes) {
+				mt.Fatalf("want %d recovery codes, got %d", len(recoveryCodes), len(hashes))
+			}
+			for i, hash := range hashes {
+				if hash.StringValue() != hashToken(recoveryCodes[i]) {
+					mt.Fatalf("want recovery code %d hashed, got %s", i, hash.StringValue())
+				}
+			}
+		})
+	}
+}
@@ -1,19 +1,253 @@
 package mongodb
 
 import (
+	"time"
+
 	"github.com/ukane-philemon/megtask/db"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type dbUser struct {
-	ID        primitive.ObjectID `bson:"_id"`
-	Username  string             `bson:"username"`
-	Password  string             `bson:"password"`
-	CreatedAt int64              `bson:"createdAt"`
+	ID            primitive.ObjectID `bson:"_id"`
+	Username      string             `bson:"username"`
+	Email         string             `bson:"email,omitempty"`
+	EmailVerified bool               `bson:"emailVerified"`
+	Password      string             `bson:"password"`
+	CreatedAt     int64              `bson:"createdAt"`
+	// Role is empty for regular users.
+	Role     string `bson:"role,omitempty"`
+	Disabled bool   `bson:"disabled"`
+	// MustResetPassword is true if an admin has required the user to reset
+	// their password before they can login.
+	MustResetPassword bool `bson:"mustResetPassword"`
+
+	// TOTPPendingSecret is a TOTP secret that has been issued to the user but
+	// not yet confirmed with a valid code.
+	TOTPPendingSecret string `bson:"totpPendingSecret,omitempty"`
+	TOTPSecret        string `bson:"totpSecret,omitempty"`
+	TOTPEnabled       bool   `bson:"totpEnabled"`
+	// TOTPLastStep is the time step of the last accepted TOTP code and is used
+	// to prevent replays.
+	TOTPLastStep int64 `bson:"totpLastStep"`
+	// RecoveryCodes are hashes of single-use codes that can be used instead of
+	// a TOTP code.
+	RecoveryCodes []string `bson:"recoveryCodes,omitempty"`
+
+	// OIDCIssuer and OIDCSubject identify the external identity provider
+	// account linked to the user. Users created from an identity provider
+	// login do not have a password.
+	OIDCIssuer  string `bson:"oidcIssuer,omitempty"`
+	OIDCSubject string `bson:"oidcSubject,omitempty"`
 }
 
 type dbTask struct {
+	ID      primitive.ObjectID `bson:"_id"`
+	OwnerID string             `bson:"ownerID"`
+	// WorkspaceID is set for tasks that belong to a workspace. OwnerID is the
+	// member that created the task.
+	WorkspaceID string `bson:"workspaceID,omitempty"`
+	AssigneeID  string `bson:"assigneeID,omitempty"`
+	db.TaskInfo `bson:"inline"`
+	// UpdatedAt is when the task was last written, in unix milliseconds of
+	// the server's clock. It is used to find the tasks to sync.
+	UpdatedAt int64 `bson:"updatedAt,omitempty"`
+	// FieldTimes are when each synced field was last modified, in unix
+	// milliseconds, and are compared to resolve sync conflicts.
+	FieldTimes map[string]int64 `bson:"fieldTimes,omitempty"`
+	// ClientID is the identifier chosen by the client that created the task
+	// while offline.
+	ClientID string `bson:"clientID,omitempty"`
+	// PreviousID is the ID of the completed recurring task this task is the
+	// next occurrence of.
+	PreviousID string `bson:"previousID,omitempty"`
+}
+
+type dbReminder struct {
 	ID          primitive.ObjectID `bson:"_id"`
+	TaskID      string             `bson:"taskID"`
+	UserID      string             `bson:"userID"`
+	RemindAt    int64              `bson:"remindAt"`
+	Offset      *int64             `bson:"offset,omitempty"`
+	Delivered   bool               `bson:"delivered"`
+	DeliveredAt int64              `bson:"deliveredAt,omitempty"`
+	Error       string             `bson:"error,omitempty"`
+	Attempts    int                `bson:"attempts"`
+	// ClaimedUntil hides a reminder that is being delivered from other
+	// schedulers until the given unix time.
+	ClaimedUntil int64 `bson:"claimedUntil"`
+	CreatedAt    int64 `bson:"createdAt"`
+}
+
+type dbJobLock struct {
+	Name      string    `bson:"_id"`
+	Owner     string    `bson:"owner"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+type dbJob struct {
+	Name           string `bson:"_id"`
+	LastRunBy      string `bson:"lastRunBy"`
+	LastStartedAt  int64  `bson:"lastStartedAt"`
+	LastFinishedAt int64  `bson:"lastFinishedAt"`
+	LastDuration   int64  `bson:"lastDuration"`
+	LastError      string `bson:"lastError,omitempty"`
+	Runs           int64  `bson:"runs"`
+	Failures       int64  `bson:"failures"`
+}
+
+type dbTaskTombstone struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	TaskID      string             `bson:"taskID"`
 	OwnerID     string             `bson:"ownerID"`
-	db.TaskInfo `bson:"inline"`
+	WorkspaceID string             `bson:"workspaceID,omitempty"`
+	DeletedAt   int64              `bson:"deletedAt"`
+	ExpiresAt   time.Time          `bson:"expiresAt"`
+}
+
+type dbComment struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	TaskID         string             `bson:"taskID"`
+	ParentID       string             `bson:"parentID,omitempty"`
+	AuthorID       string             `bson:"authorID"`
+	AuthorUsername string             `bson:"authorUsername"`
+	Body           string             `bson:"body"`
+	Deleted        bool               `bson:"deleted"`
+	CreatedAt      int64              `bson:"createdAt"`
+	UpdatedAt      int64              `bson:"updatedAt"`
+}
+
+type dbWebhook struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	UserID    string             `bson:"userID"`
+	URL       string             `bson:"url"`
+	Events    []string           `bson:"events"`
+	Secret    string             `bson:"secret"`
+	CreatedAt int64              `bson:"createdAt"`
+}
+
+type dbWebhookDelivery struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	WebhookID      string             `bson:"webhookID"`
+	Event          string             `bson:"event"`
+	Payload        string             `bson:"payload"`
+	Status         string             `bson:"status"`
+	Attempts       int                `bson:"attempts"`
+	ResponseStatus int                `bson:"responseStatus,omitempty"`
+	Error          string             `bson:"error,omitempty"`
+	NextAttemptAt  int64              `bson:"nextAttemptAt,omitempty"`
+	LastAttemptAt  int64              `bson:"lastAttemptAt,omitempty"`
+	CreatedAt      int64              `bson:"createdAt"`
+}
+
+type dbAttachment struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	TaskID      string             `bson:"taskID"`
+	UploaderID  string             `bson:"uploaderID"`
+	Filename    string             `bson:"filename"`
+	ContentType string             `bson:"contentType"`
+	Size        int64              `bson:"size"`
+	CreatedAt   int64              `bson:"createdAt"`
+}
+
+type dbTaskHistoryEntry struct {
+	ID                 primitive.ObjectID `bson:"_id"`
+	TaskID             string             `bson:"taskID"`
+	ActorID            string             `bson:"actorID"`
+	Action             string             `bson:"action"`
+	AssigneeID         string             `bson:"assigneeID,omitempty"`
+	PreviousAssigneeID string             `bson:"previousAssigneeID,omitempty"`
+	Timestamp          int64              `bson:"timestamp"`
+}
+
+type dbWorkspace struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	Name      string             `bson:"name"`
+	OwnerID   string             `bson:"ownerID"`
+	CreatedAt int64              `bson:"createdAt"`
+}
+
+// dbWorkspaceMember is a member of a workspace or a user that has been
+// invited to a workspace.
+type dbWorkspaceMember struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	WorkspaceID string             `bson:"workspaceID"`
+	UserID      string             `bson:"userID"`
+	Username    string             `bson:"username"`
+	Role        string             `bson:"role"`
+	// Invited is true until the user accepts the invitation.
+	Invited   bool   `bson:"invited"`
+	InvitedBy string `bson:"invitedBy,omitempty"`
+	CreatedAt int64  `bson:"createdAt"`
+}
+
+// dbShare is a task or project shared by its owner with a collaborator. Only
+// one of TaskID or Project is set.
+type dbShare struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	OwnerID    string             `bson:"ownerID"`
+	TaskID     string             `bson:"taskID,omitempty"`
+	Project    string             `bson:"project,omitempty"`
+	UserID     string             `bson:"userID"`
+	Username   string             `bson:"username"`
+	Permission string             `bson:"permission"`
+	CreatedAt  int64              `bson:"createdAt"`
+}
+
+// dbUserToken is a single-use token issued to a user for a specific purpose
+// (e.g password reset). Only the hash of the token is stored.
+type dbUserToken struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	UserID    string             `bson:"userID"`
+	Purpose   string             `bson:"purpose"`
+	TokenHash string             `bson:"tokenHash"`
+	ExpiresAt time.Time          `bson:"expiresAt"`
+}
+
+type dbAPIToken struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	UserID    string             `bson:"userID"`
+	Name      string             `bson:"name"`
+	Scopes    []string           `bson:"scopes"`
+	TokenHash string             `bson:"tokenHash"`
+	// ExpiresAt is nil if the token does not expire.
+	ExpiresAt  *time.Time `bson:"expiresAt,omitempty"`
+	CreatedAt  int64      `bson:"createdAt"`
+	LastUsedAt int64      `bson:"lastUsedAt"`
+}
+
+type dbFeedToken struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	UserID     string             `bson:"userID"`
+	Name       string             `bson:"name"`
+	TokenHash  string             `bson:"tokenHash"`
+	CreatedAt  int64              `bson:"createdAt"`
+	LastUsedAt int64              `bson:"lastUsedAt"`
+}
+
+// dbLoginAttempts is information about consecutive failed login attempts for
+// a key (e.g a username or IP address).
+type dbLoginAttempts struct {
+	Key         string    `bson:"_id"`
+	Failures    int       `bson:"failures"`
+	LastFailure int64     `bson:"lastFailure"`
+	ExpiresAt   time.Time `bson:"expiresAt"`
+}
+
+// role returns the role of the user.
+func (u *dbUser) role() string {
+	if u.Role == "" {
+		return db.RoleUser
+	}
+	return u.Role
+}
+
+type dbSession struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	UserID      string             `bson:"userID"`
+	DeviceLabel string             `bson:"deviceLabel"`
+	UserAgent   string             `bson:"userAgent"`
+	IP          string             `bson:"ip"`
+	CreatedAt   int64              `bson:"createdAt"`
+	LastSeenAt  int64              `bson:"lastSeenAt"`
+	ExpiresAt   time.Time          `bson:"expiresAt"`
 }
@@ -0,0 +1,351 @@
+package mongodb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxWebhooksPerUser is the maximum number of webhooks a user can create.
+const maxWebhooksPerUser = 10
+
+// CreateWebhook saves a webhook that receives the provided events for the
+// user with the provided userID. Deliveries are signed with secret. Returns
+// ErrorInvalidRequest if the user already has the maximum number of webhooks.
+func (mdb *MongoDB) CreateWebhook(userID, url string, events []string, secret string) (*db.Webhook, error) {
+	if userID == "" || url == "" || len(events) == 0 || secret == "" {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	nWebhooks, err := mdb.webhooksCollection.CountDocuments(mdb.ctx, bson.M{userIDKey: userID})
+	if err != nil {
+		return nil, fmt.Errorf("webhooksCollection.CountDocuments error: %w", err)
+	}
+
+	if nWebhooks >= maxWebhooksPerUser {
+		return nil, fmt.Errorf("%w: you cannot create more than %d webhooks", db.ErrorInvalidRequest, maxWebhooksPerUser)
+	}
+
+	webhook := &dbWebhook{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		URL:       url,
+		Events:    events,
+		Secret:    secret,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	_, err = mdb.webhooksCollection.InsertOne(mdb.ctx, webhook)
+	if err != nil {
+		return nil, fmt.Errorf("webhooksCollection.InsertOne error: %w", err)
+	}
+
+	info := webhook.info()
+	info.Secret = webhook.Secret
+	return info, nil
+}
+
+// Webhooks returns the webhooks of the user with the provided userID, oldest
+// first. Secrets are not returned.
+func (mdb *MongoDB) Webhooks(userID string) ([]*db.Webhook, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("%w: missing required argument", db.ErrorInvalidRequest)
+	}
+
+	cur, err := mdb.webhooksCollection.Find(mdb.ctx, bson.M{userIDKey: userID}, options.Find().SetSort(bson.M{createdAtKey: 1}))
+	if err != nil {
+		return nil, fmt.Errorf("webhooksCollection.Find error: %w", err)
+	}
+
+	var dbWebhooks []*dbWebhook
+	err = cur.All(mdb.ctx, &dbWebhooks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode retrieved webhooks: %w", err)
+	}
+
+	webhooks := make([]*db.Webhook, 0, len(dbWebhooks))
+	for _, webhook := range dbWebhooks {
+		webhooks = append(webhooks, webhook.info())
+	}
+
+	return webhooks, nil
+}
+
+// DeleteWebhook deletes a webhook of the user with the provided userID and
+// its deliveries. Returns ErrorInvalidRequest if the webhook does not exist.
+func (mdb *MongoDB) DeleteWebhook(userID, webhookID string) error {
+	if userID == "" || webhookID == "" {
+		return fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	webhook, err := mdb.userWebhook(userID, webhookID)
+	if err != nil {
+		return err
+	}
+
+	_, err = mdb.webhooksCollection.DeleteOne(mdb.ctx, bson.M{dbIDKey: webhook.ID})
+	if err != nil {
+		return fmt.Errorf("webhooksCollection.DeleteOne error: %w", err)
+	}
+
+	_, err = mdb.deliveriesCollection.DeleteMany(mdb.ctx, bson.M{webhookIDKey: webhookID})
+	if err != nil {
+		mdb.log.Error("failed to delete webhook deliveries: ", "error", err)
+	}
+
+	return nil
+}
+
+// WebhookDeliveries returns the latest deliveries of a webhook of the user
+// with the provided userID, newest first. Returns ErrorInvalidRequest if the
+// webhook does not exist.
+func (mdb *MongoDB) WebhookDeliveries(userID, webhookID string, limit int64) ([]*db.WebhookDelivery, error) {
+	if userID == "" || webhookID == "" {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	_, err := mdb.userWebhook(userID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: createdAtKey, Value: -1}, {Key: dbIDKey, Value: -1}}).SetLimit(limit)
+	cur, err := mdb.deliveriesCollection.Find(mdb.ctx, bson.M{webhookIDKey: webhookID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("deliveriesCollection.Find error: %w", err)
+	}
+
+	var dbDeliveries []*dbWebhookDelivery
+	err = cur.All(mdb.ctx, &dbDeliveries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode retrieved webhook deliveries: %w", err)
+	}
+
+	deliveries := make([]*db.WebhookDelivery, 0, len(dbDeliveries))
+	for _, delivery := range dbDeliveries {
+		deliveries = append(deliveries, delivery.info())
+	}
+
+	return deliveries, nil
+}
+
+// CreateWebhookDelivery saves a delivery of the provided event to a webhook
+// of the user with the provided userID that is first attempted at
+// nextAttemptAt. Returns the webhook with its secret and the delivery, and
+// ErrorInvalidRequest if the webhook does not exist.
+func (mdb *MongoDB) CreateWebhookDelivery(userID, webhookID, event, payload string, nextAttemptAt int64) (*db.Webhook, *db.WebhookDelivery, error) {
+	if userID == "" || webhookID == "" || event == "" {
+		return nil, nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	webhook, err := mdb.userWebhook(userID, webhookID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	delivery := newDelivery(webhookID, event, payload)
+	delivery.NextAttemptAt = nextAttemptAt
+	_, err = mdb.deliveriesCollection.InsertOne(mdb.ctx, delivery)
+	if err != nil {
+		return nil, nil, fmt.Errorf("deliveriesCollection.InsertOne error: %w", err)
+	}
+
+	info := webhook.info()
+	info.Secret = webhook.Secret
+	return info, delivery.info(), nil
+}
+
+// QueueWebhookDeliveries saves a pending delivery of the provided event for
+// each webhook of the users with the provided userIDs that receives the
+// event.
+func (mdb *MongoDB) QueueWebhookDeliveries(userIDs []string, event, payload string) error {
+	if len(userIDs) == 0 || event == "" {
+		return nil
+	}
+
+	cur, err := mdb.webhooksCollection.Find(mdb.ctx, bson.M{
+		userIDKey: bson.M{"$in": userIDs},
+		eventsKey: event,
+	})
+	if err != nil {
+		return fmt.Errorf("webhooksCollection.Find error: %w", err)
+	}
+
+	var webhooks []*dbWebhook
+	err = cur.All(mdb.ctx, &webhooks)
+	if err != nil {
+		return fmt.Errorf("failed to decode retrieved webhooks: %w", err)
+	}
+
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	deliveries := make([]any, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		deliveries = append(deliveries, newDelivery(webhook.ID.Hex(), event, payload))
+	}
+
+	_, err = mdb.deliveriesCollection.InsertMany(mdb.ctx, deliveries)
+	if err != nil {
+		return fmt.Errorf("deliveriesCollection.InsertMany error: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimWebhookDelivery returns the pending delivery that has been due the
+// longest and its webhook with the webhook's secret. The delivery is not
+// returned again until the lease expires or an attempt is recorded, so
+// several server instances can send deliveries. Returns nil if no delivery
+// is due.
+func (mdb *MongoDB) ClaimWebhookDelivery(lease time.Duration) (*db.Webhook, *db.WebhookDelivery, error) {
+	for {
+		now := time.Now()
+		filter := bson.M{
+			statusKey:        db.DeliveryStatusPending,
+			nextAttemptAtKey: bson.M{"$lte": now.Unix()},
+		}
+		update := bson.M{"$set": bson.M{nextAttemptAtKey: now.Add(lease).Unix()}}
+		opts := options.FindOneAndUpdate().SetSort(bson.M{nextAttemptAtKey: 1}).SetReturnDocument(options.After)
+
+		var delivery *dbWebhookDelivery
+		err := mdb.deliveriesCollection.FindOneAndUpdate(mdb.ctx, filter, update, opts).Decode(&delivery)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, nil, nil
+			}
+			return nil, nil, fmt.Errorf("deliveriesCollection.FindOneAndUpdate error: %w", err)
+		}
+
+		// An invalid webhook ID matches no webhook.
+		webhookDBID, _ := primitive.ObjectIDFromHex(delivery.WebhookID)
+		var webhook *dbWebhook
+		err = mdb.webhooksCollection.FindOne(mdb.ctx, bson.M{dbIDKey: webhookDBID}).Decode(&webhook)
+		if err == nil {
+			info := webhook.info()
+			info.Secret = webhook.Secret
+			return info, delivery.info(), nil
+		}
+
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil, fmt.Errorf("webhooksCollection.FindOne error: %w", err)
+		}
+
+		// The webhook was deleted after the delivery was queued.
+		_, err = mdb.deliveriesCollection.DeleteOne(mdb.ctx, bson.M{dbIDKey: delivery.ID})
+		if err != nil {
+			return nil, nil, fmt.Errorf("deliveriesCollection.DeleteOne error: %w", err)
+		}
+	}
+}
+
+// RecordWebhookAttempt saves the result of sending the delivery with the
+// provided deliveryID. The delivery succeeds if the attempt has no error and
+// fails if the attempt has an error and no next attempt time.
+func (mdb *MongoDB) RecordWebhookAttempt(deliveryID string, attempt *db.WebhookAttempt) error {
+	deliveryDBID, err := primitive.ObjectIDFromHex(deliveryID)
+	if err != nil || attempt == nil {
+		return fmt.Errorf("%w: invalid delivery ID or attempt", db.ErrorInvalidRequest)
+	}
+
+	status := db.DeliveryStatusPending
+	switch {
+	case attempt.Error == "":
+		status = db.DeliveryStatusSucceeded
+	case attempt.NextAttemptAt == 0:
+		status = db.DeliveryStatusFailed
+	}
+
+	set := bson.M{
+		statusKey:         status,
+		responseStatusKey: attempt.ResponseStatus,
+		errorKey:          attempt.Error,
+		lastAttemptAtKey:  time.Now().Unix(),
+	}
+	update := bson.M{
+		"$set": set,
+		"$inc": bson.M{attemptsKey: 1},
+	}
+	if status == db.DeliveryStatusPending {
+		set[nextAttemptAtKey] = attempt.NextAttemptAt
+	} else {
+		update["$unset"] = bson.M{nextAttemptAtKey: ""}
+	}
+
+	_, err = mdb.deliveriesCollection.UpdateByID(mdb.ctx, deliveryDBID, update)
+	if err != nil {
+		return fmt.Errorf("deliveriesCollection.UpdateByID error: %w", err)
+	}
+
+	return nil
+}
+
+// userWebhook returns a webhook of the user with the provided userID.
+// Returns ErrorInvalidRequest if the webhook does not exist.
+func (mdb *MongoDB) userWebhook(userID, webhookID string) (*dbWebhook, error) {
+	webhookDBID, err := primitive.ObjectIDFromHex(webhookID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid webhook ID", db.ErrorInvalidRequest)
+	}
+
+	var webhook *dbWebhook
+	err = mdb.webhooksCollection.FindOne(mdb.ctx, bson.M{dbIDKey: webhookDBID, userIDKey: userID}).Decode(&webhook)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("%w: webhook does not exist", db.ErrorInvalidRequest)
+		}
+		return nil, fmt.Errorf("webhooksCollection.FindOne error: %w", err)
+	}
+
+	return webhook, nil
+}
+
+// newDelivery returns a pending delivery of event to the webhook with the
+// provided webhookID that is due now.
+func newDelivery(webhookID, event, payload string) *dbWebhookDelivery {
+	now := time.Now().Unix()
+	return &dbWebhookDelivery{
+		ID:            primitive.NewObjectID(),
+		WebhookID:     webhookID,
+		Event:         event,
+		Payload:       payload,
+		Status:        db.DeliveryStatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+}
+
+// info returns the public information of a webhook without its secret.
+func (w *dbWebhook) info() *db.Webhook {
+	return &db.Webhook{
+		ID:        w.ID.Hex(),
+		UserID:    w.UserID,
+		URL:       w.URL,
+		Events:    w.Events,
+		CreatedAt: w.CreatedAt,
+	}
+}
+
+// info returns the public information of a webhook delivery.
+func (d *dbWebhookDelivery) info() *db.WebhookDelivery {
+	return &db.WebhookDelivery{
+		ID:             d.ID.Hex(),
+		WebhookID:      d.WebhookID,
+		Event:          d.Event,
+		Payload:        d.Payload,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		ResponseStatus: d.ResponseStatus,
+		Error:          d.Error,
+		NextAttemptAt:  d.NextAttemptAt,
+		LastAttemptAt:  d.LastAttemptAt,
+		CreatedAt:      d.CreatedAt,
+	}
+}
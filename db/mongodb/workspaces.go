@@ -0,0 +1,423 @@
+package mongodb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateWorkspace creates a new workspace owned by the user with the provided
+// ownerID.
+func (mdb *MongoDB) CreateWorkspace(ownerID, name string) (*db.Workspace, error) {
+	if ownerID == "" || name == "" {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	owner, err := mdb.user(ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	workspace := &dbWorkspace{
+		ID:        primitive.NewObjectID(),
+		Name:      name,
+		OwnerID:   ownerID,
+		CreatedAt: now,
+	}
+
+	_, err = mdb.workspacesCollection.InsertOne(mdb.ctx, workspace)
+	if err != nil {
+		return nil, fmt.Errorf("workspacesCollection.InsertOne error: %w", err)
+	}
+
+	member := &dbWorkspaceMember{
+		ID:          primitive.NewObjectID(),
+		WorkspaceID: workspace.ID.Hex(),
+		UserID:      ownerID,
+		Username:    owner.Username,
+		Role:        db.WorkspaceRoleOwner,
+		CreatedAt:   now,
+	}
+
+	_, err = mdb.membersCollection.InsertOne(mdb.ctx, member)
+	if err != nil {
+		return nil, fmt.Errorf("membersCollection.InsertOne error: %w", err)
+	}
+
+	return workspace.info(db.WorkspaceRoleOwner), nil
+}
+
+// Workspaces returns the workspaces the user with the provided userID is a
+// member of.
+func (mdb *MongoDB) Workspaces(userID string) ([]*db.Workspace, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("%w: missing required argument", db.ErrorInvalidRequest)
+	}
+
+	return mdb.userWorkspaces(userID, false)
+}
+
+// WorkspaceInvitations returns the workspaces the user with the provided
+// userID has been invited to and has not yet responded to.
+func (mdb *MongoDB) WorkspaceInvitations(userID string) ([]*db.Workspace, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("%w: missing required argument", db.ErrorInvalidRequest)
+	}
+
+	return mdb.userWorkspaces(userID, true)
+}
+
+// WorkspaceMembers returns the members of the workspace with the provided
+// workspaceID and the users that have been invited to it.
+func (mdb *MongoDB) WorkspaceMembers(workspaceID string) ([]*db.WorkspaceMember, error) {
+	if workspaceID == "" {
+		return nil, fmt.Errorf("%w: missing required argument", db.ErrorInvalidRequest)
+	}
+
+	cur, err := mdb.membersCollection.Find(mdb.ctx, bson.M{workspaceIDKey: workspaceID}, options.Find().SetSort(bson.M{createdAtKey: 1}))
+	if err != nil {
+		return nil, fmt.Errorf("membersCollection.Find error: %w", err)
+	}
+
+	var dbMembers []*dbWorkspaceMember
+	err = cur.All(mdb.ctx, &dbMembers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode retrieved workspace members: %w", err)
+	}
+
+	members := make([]*db.WorkspaceMember, 0, len(dbMembers))
+	for _, member := range dbMembers {
+		members = append(members, &db.WorkspaceMember{
+			UserID:    member.UserID,
+			Username:  member.Username,
+			Role:      member.Role,
+			Invited:   member.Invited,
+			InvitedBy: member.InvitedBy,
+			CreatedAt: member.CreatedAt,
+		})
+	}
+
+	return members, nil
+}
+
+// WorkspaceRole returns the role of the user with the provided userID in the
+// workspace with the provided workspaceID. Returns ErrorInvalidRequest if the
+// user is not a member of the workspace.
+func (mdb *MongoDB) WorkspaceRole(workspaceID, userID string) (string, error) {
+	if workspaceID == "" || userID == "" {
+		return "", fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	role, err := mdb.workspaceRole(workspaceID, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if role == "" {
+		return "", fmt.Errorf("%w: workspace does not exist", db.ErrorInvalidRequest)
+	}
+
+	return role, nil
+}
+
+// InviteToWorkspace invites the user with the provided username to join the
+// workspace with the provided workspaceID with the provided role. Returns
+// ErrorInvalidRequest if the user does not exist or is already a member of or
+// has been invited to the workspace.
+func (mdb *MongoDB) InviteToWorkspace(workspaceID, inviterID, username, role string) (*db.WorkspaceMember, error) {
+	if workspaceID == "" || inviterID == "" || username == "" {
+		return nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	if role != db.WorkspaceRoleMember && role != db.WorkspaceRoleViewer {
+		return nil, fmt.Errorf("%w: invalid workspace role %q", db.ErrorInvalidRequest, role)
+	}
+
+	var user *dbUser
+	err := mdb.usersCollection.FindOne(mdb.ctx, bson.M{usernameKey: username}).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("%w: user %s does not exist", db.ErrorInvalidRequest, username)
+		}
+		return nil, fmt.Errorf("usersCollection.FindOne error: %w", err)
+	}
+
+	member := &dbWorkspaceMember{
+		ID:          primitive.NewObjectID(),
+		WorkspaceID: workspaceID,
+		UserID:      user.ID.Hex(),
+		Username:    user.Username,
+		Role:        role,
+		Invited:     true,
+		InvitedBy:   inviterID,
+		CreatedAt:   time.Now().Unix(),
+	}
+
+	_, err = mdb.membersCollection.InsertOne(mdb.ctx, member)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, fmt.Errorf("%w: %s is already a member of or has been invited to this workspace", db.ErrorInvalidRequest, username)
+		}
+		return nil, fmt.Errorf("membersCollection.InsertOne error: %w", err)
+	}
+
+	return &db.WorkspaceMember{
+		UserID:    member.UserID,
+		Username:  member.Username,
+		Role:      member.Role,
+		Invited:   member.Invited,
+		InvitedBy: member.InvitedBy,
+		CreatedAt: member.CreatedAt,
+	}, nil
+}
+
+// RespondToWorkspaceInvitation accepts or declines an invitation to the
+// workspace with the provided workspaceID for the user with the provided
+// userID. Returns ErrorInvalidRequest if the user has not been invited to the
+// workspace.
+func (mdb *MongoDB) RespondToWorkspaceInvitation(workspaceID, userID string, accept bool) error {
+	if workspaceID == "" || userID == "" {
+		return fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	filter := bson.M{
+		workspaceIDKey: workspaceID,
+		userIDKey:      userID,
+		invitedKey:     true,
+	}
+
+	var matched int64
+	if accept {
+		res, err := mdb.membersCollection.UpdateOne(mdb.ctx, filter, bson.M{"$set": bson.M{invitedKey: false}})
+		if err != nil {
+			return fmt.Errorf("membersCollection.UpdateOne error: %w", err)
+		}
+		matched = res.MatchedCount
+	} else {
+		res, err := mdb.membersCollection.DeleteOne(mdb.ctx, filter)
+		if err != nil {
+			return fmt.Errorf("membersCollection.DeleteOne error: %w", err)
+		}
+		matched = res.DeletedCount
+	}
+
+	if matched == 0 {
+		return fmt.Errorf("%w: invitation does not exist", db.ErrorInvalidRequest)
+	}
+
+	return nil
+}
+
+// RemoveWorkspaceMember removes the user with the provided userID from the
+// workspace with the provided workspaceID or cancels their invitation. The
+// owner of a workspace cannot be removed. Returns ErrorInvalidRequest if the
+// user is not a member of the workspace.
+func (mdb *MongoDB) RemoveWorkspaceMember(workspaceID, userID string) error {
+	if workspaceID == "" || userID == "" {
+		return fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	var member *dbWorkspaceMember
+	err := mdb.membersCollection.FindOne(mdb.ctx, bson.M{workspaceIDKey: workspaceID, userIDKey: userID}).Decode(&member)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return fmt.Errorf("%w: user is not a member of this workspace", db.ErrorInvalidRequest)
+		}
+		return fmt.Errorf("membersCollection.FindOne error: %w", err)
+	}
+
+	if member.Role == db.WorkspaceRoleOwner {
+		return fmt.Errorf("%w: the owner cannot be removed from a workspace", db.ErrorInvalidRequest)
+	}
+
+	_, err = mdb.membersCollection.DeleteOne(mdb.ctx, bson.M{dbIDKey: member.ID})
+	if err != nil {
+		return fmt.Errorf("membersCollection.DeleteOne error: %w", err)
+	}
+
+	return nil
+}
+
+// CreateWorkspaceTask creates a new task in the workspace with the provided
+// workspaceID and returns the new task and the workspace's tasks. The project,
+// due date, tags and recurrence rule are optional.
+func (mdb *MongoDB) CreateWorkspaceTask(workspaceID, userID, taskDetail, project string, dueAt int64, tags []string, recurrence string) (*db.Task, []*db.Task, error) {
+	if workspaceID == "" || userID == "" || taskDetail == "" {
+		return nil, nil, fmt.Errorf("%w: missing required argument(s)", db.ErrorInvalidRequest)
+	}
+
+	now := time.Now()
+	task := &dbTask{
+		ID:          primitive.NewObjectID(),
+		OwnerID:     userID,
+		WorkspaceID: workspaceID,
+		TaskInfo: db.TaskInfo{
+			Detail:     taskDetail,
+			Timestamp:  now.Unix(),
+			Project:    project,
+			DueAt:      dueAt,
+			Tags:       tags,
+			Recurrence: recurrence,
+		},
+		UpdatedAt:  now.UnixMilli(),
+		FieldTimes: newFieldTimes(now.UnixMilli()),
+	}
+
+	_, err := mdb.tasksCollection.InsertOne(mdb.ctx, task)
+	if err != nil {
+		return nil, nil, fmt.Errorf("tasksCollection.InsertOne error: %w", err)
+	}
+
+	tasks, err := mdb.workspaceTasks(workspaceID, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	newTask := task.info()
+	newTask.OwnerID = task.OwnerID
+	return newTask, tasks, nil
+}
+
+// WorkspaceTasks returns the tasks in the workspace with the provided
+// workspaceID. Only tasks with the provided completed status are returned if
+// completed is not nil.
+func (mdb *MongoDB) WorkspaceTasks(workspaceID string, completed *bool) ([]*db.Task, error) {
+	if workspaceID == "" {
+		return nil, fmt.Errorf("%w: missing required argument", db.ErrorInvalidRequest)
+	}
+
+	var extraFilter bson.M
+	if completed != nil {
+		extraFilter = bson.M{completedKey: *completed}
+	}
+
+	return mdb.workspaceTasks(workspaceID, extraFilter)
+}
+
+// workspaceTasks returns the tasks in the workspace with the provided
+// workspaceID that match extraFilter. Tasks are sorted in descending order.
+func (mdb *MongoDB) workspaceTasks(workspaceID string, extraFilter bson.M) ([]*db.Task, error) {
+	filter := bson.M{workspaceIDKey: workspaceID}
+	for key, val := range extraFilter {
+		filter[key] = val
+	}
+
+	dbTasks, err := mdb.findTasks(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]*db.Task, 0, len(dbTasks))
+	for _, dbTask := range dbTasks {
+		task := dbTask.info()
+		task.OwnerID = dbTask.OwnerID
+		tasks = append(tasks, task)
+	}
+
+	return mdb.prepareTasks(tasks)
+}
+
+// workspaceRole returns the role of the user with the provided userID in the
+// workspace with the provided workspaceID. An empty role is returned if the
+// user is not a member of the workspace.
+func (mdb *MongoDB) workspaceRole(workspaceID, userID string) (string, error) {
+	filter := bson.M{
+		workspaceIDKey: workspaceID,
+		userIDKey:      userID,
+		invitedKey:     false,
+	}
+
+	var member *dbWorkspaceMember
+	err := mdb.membersCollection.FindOne(mdb.ctx, filter).Decode(&member)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", nil
+		}
+		return "", fmt.Errorf("membersCollection.FindOne error: %w", err)
+	}
+
+	return member.Role, nil
+}
+
+// userWorkspaces returns the workspaces the user with the provided userID is
+// a member of, or has been invited to if invited is true.
+func (mdb *MongoDB) userWorkspaces(userID string, invited bool) ([]*db.Workspace, error) {
+	cur, err := mdb.membersCollection.Find(mdb.ctx, bson.M{userIDKey: userID, invitedKey: invited})
+	if err != nil {
+		return nil, fmt.Errorf("membersCollection.Find error: %w", err)
+	}
+
+	var members []*dbWorkspaceMember
+	err = cur.All(mdb.ctx, &members)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode retrieved workspace members: %w", err)
+	}
+
+	roles := make(map[string]string, len(members))
+	workspaceDBIDs := make([]primitive.ObjectID, 0, len(members))
+	for _, member := range members {
+		workspaceDBID, err := primitive.ObjectIDFromHex(member.WorkspaceID)
+		if err != nil {
+			continue
+		}
+		roles[member.WorkspaceID] = member.Role
+		workspaceDBIDs = append(workspaceDBIDs, workspaceDBID)
+	}
+
+	if len(workspaceDBIDs) == 0 {
+		return []*db.Workspace{}, nil
+	}
+
+	filter := bson.M{dbIDKey: bson.M{"$in": workspaceDBIDs}}
+	cur, err = mdb.workspacesCollection.Find(mdb.ctx, filter, options.Find().SetSort(bson.M{nameKey: 1}))
+	if err != nil {
+		return nil, fmt.Errorf("workspacesCollection.Find error: %w", err)
+	}
+
+	var dbWorkspaces []*dbWorkspace
+	err = cur.All(mdb.ctx, &dbWorkspaces)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode retrieved workspaces: %w", err)
+	}
+
+	workspaces := make([]*db.Workspace, 0, len(dbWorkspaces))
+	for _, workspace := range dbWorkspaces {
+		workspaces = append(workspaces, workspace.info(roles[workspace.ID.Hex()]))
+	}
+
+	return workspaces, nil
+}
+
+// workspacePermission returns the task permission that a workspace role
+// grants on the tasks in the workspace.
+func workspacePermission(role string) string {
+	switch role {
+	case db.WorkspaceRoleOwner:
+		return db.PermissionOwner
+	case db.WorkspaceRoleMember:
+		return db.PermissionEdit
+	case db.WorkspaceRoleViewer:
+		return db.PermissionRead
+	default:
+		return ""
+	}
+}
+
+// info returns the public information of a workspace for a user with the
+// provided role.
+func (w *dbWorkspace) info(role string) *db.Workspace {
+	return &db.Workspace{
+		ID:        w.ID.Hex(),
+		Name:      w.Name,
+		OwnerID:   w.OwnerID,
+		Role:      role,
+		CreatedAt: w.CreatedAt,
+	}
+}
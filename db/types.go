@@ -8,16 +8,69 @@ var (
 	ErrorInvalidRequest = errors.New("invalid request")
 )
 
+const (
+	// RoleUser is the role of regular users.
+	RoleUser = "user"
+	// RoleAdmin is the role of users that can manage other users.
+	RoleAdmin = "admin"
+)
+
+const (
+	// PermissionOwner is the permission of the user that created a task.
+	PermissionOwner = "owner"
+	// PermissionEdit allows a collaborator to view, update and delete shared
+	// tasks.
+	PermissionEdit = "edit"
+	// PermissionRead allows a collaborator to view shared tasks.
+	PermissionRead = "read"
+)
+
 // User is information about a user.
 type User struct {
-	ID       string  `json:"id"`
-	Username string  `json:"username"`
-	Tasks    []*Task `json:"tasks"`
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email,omitempty"`
+	Role     string `json:"role"`
+	// EmailVerified is true if the user has verified ownership of Email.
+	EmailVerified bool `json:"emailVerified"`
+	// TwoFactorEnabled is true if the user must provide a TOTP code or a
+	// recovery code after their password to login.
+	TwoFactorEnabled bool    `json:"twoFactorEnabled"`
+	Tasks            []*Task `json:"tasks"`
 }
 
+const (
+	// WorkspaceRoleOwner is the role of the user that created a workspace.
+	// Owners can manage members and edit all the tasks in the workspace.
+	WorkspaceRoleOwner = "owner"
+	// WorkspaceRoleMember allows a user to create and edit tasks in a
+	// workspace.
+	WorkspaceRoleMember = "member"
+	// WorkspaceRoleViewer allows a user to view the tasks in a workspace.
+	WorkspaceRoleViewer = "viewer"
+)
+
 // Task is information about a user's task item.
 type Task struct {
 	ID string `json:"id"`
+	// OwnerID is only set for tasks shared with a user and workspace tasks,
+	// where it is the member that created the task.
+	OwnerID string `json:"ownerID,omitempty"`
+	// Permission is only set for tasks shared with a user.
+	Permission string `json:"permission,omitempty"`
+	// WorkspaceID is only set for tasks that belong to a workspace.
+	WorkspaceID string `json:"workspaceID,omitempty"`
+	// AssigneeID is the ID of the user responsible for the task, if any.
+	AssigneeID string `json:"assigneeID,omitempty"`
+	// CommentCount is the number of comments on the task that have not been
+	// deleted.
+	CommentCount int64 `json:"commentCount"`
+	// UpdatedAt is when the task was last changed, in unix milliseconds. It
+	// is zero for tasks that have not changed since sync was introduced.
+	UpdatedAt int64 `json:"updatedAt,omitempty"`
+	// ClientID is the identifier chosen by the sync or CalDAV client that
+	// created the task, if any.
+	ClientID string `json:"clientID,omitempty"`
 	TaskInfo
 }
 
@@ -25,4 +78,410 @@ type TaskInfo struct {
 	Detail    string `json:"detail"`
 	Completed bool   `json:"completed"`
 	Timestamp int64  `json:"timestamp"`
+	// Project is an optional name used to group tasks. All the tasks in a
+	// project can be shared at once.
+	Project string `json:"project,omitempty"`
+	// DueAt is when the task is due, in unix seconds. It is zero if the task
+	// has no due date.
+	DueAt int64 `json:"dueAt,omitempty" bson:"dueAt,omitempty"`
+	// Tags are optional labels used to filter tasks.
+	Tags []string `json:"tags,omitempty" bson:"tags,omitempty"`
+	// Recurrence is an optional RFC 5545 recurrence rule, e.g
+	// "FREQ=WEEKLY;BYDAY=MO", that repeats the task from its due date.
+	Recurrence string `json:"recurrence,omitempty" bson:"recurrence,omitempty"`
+}
+
+const (
+	// TaskActionAssigned is the history action recorded when a task is
+	// assigned to a user.
+	TaskActionAssigned = "assigned"
+	// TaskActionUnassigned is the history action recorded when the assignee
+	// of a task is removed.
+	TaskActionUnassigned = "unassigned"
+)
+
+const (
+	// TaskChangeCreated is the type of a TaskChange for a new task.
+	TaskChangeCreated = "task.created"
+	// TaskChangeUpdated is the type of a TaskChange for an updated task.
+	TaskChangeUpdated = "task.updated"
+	// TaskChangeDeleted is the type of a TaskChange for a deleted task.
+	TaskChangeDeleted = "task.deleted"
+)
+
+// TaskChange is a change made to a task in the database, by any server or
+// directly in the database.
+type TaskChange struct {
+	Type   string
+	TaskID string
+	// Task is the task after the change. For deleted tasks, it is the task
+	// before it was deleted if the database provides it, otherwise nil.
+	Task *Task
+	// Audience are the IDs of the users that could access the task when it
+	// was changed. It is empty if the task is not known.
+	Audience []string
+}
+
+const (
+	// SyncActionCreate creates a task that was added on a client.
+	SyncActionCreate = "create"
+	// SyncActionUpdate updates the fields of a task set in a SyncChange.
+	SyncActionUpdate = "update"
+	// SyncActionDelete deletes a task.
+	SyncActionDelete = "delete"
+
+	// SyncStatusApplied is the status of a SyncChange that was fully
+	// applied.
+	SyncStatusApplied = "applied"
+	// SyncStatusConflict is the status of a SyncChange with fields that were
+	// not applied because they were changed more recently on the server.
+	SyncStatusConflict = "conflict"
+	// SyncStatusRejected is the status of a SyncChange that could not be
+	// applied, e.g because its task has been deleted.
+	SyncStatusRejected = "rejected"
+
+	// SyncFieldDetail, SyncFieldCompleted, SyncFieldProject, SyncFieldDueAt,
+	// SyncFieldTags and SyncFieldRecurrence are the task fields that can be
+	// changed by a SyncChange.
+	SyncFieldDetail     = "detail"
+	SyncFieldCompleted  = "completed"
+	SyncFieldProject    = "project"
+	SyncFieldDueAt      = "dueAt"
+	SyncFieldTags       = "tags"
+	SyncFieldRecurrence = "recurrence"
+)
+
+// SyncChange is a change made to a task by a client while it was offline.
+type SyncChange struct {
+	Action string `json:"action"`
+	// TaskID is the task to update or delete.
+	TaskID string `json:"taskID,omitempty"`
+	// ClientID is an identifier chosen by the client for a task it created.
+	// Creating a task with a ClientID that has already been used returns the
+	// existing task, so a sync can be retried safely.
+	ClientID string `json:"clientID,omitempty"`
+	// ModifiedAt is when the change was made on the client, in unix
+	// milliseconds.
+	ModifiedAt int64   `json:"modifiedAt"`
+	Detail     *string `json:"detail,omitempty"`
+	// Completed can only be set to true. Completed tasks cannot be changed.
+	Completed *bool   `json:"completed,omitempty"`
+	Project   *string `json:"project,omitempty"`
+	// DueAt is a unix time in seconds. Zero removes the due date of the task.
+	DueAt *int64 `json:"dueAt,omitempty"`
+	// Tags replace the tags of the task. An empty list removes them.
+	Tags *[]string `json:"tags,omitempty"`
+	// Recurrence is an RRULE value. An empty string stops the task from
+	// recurring.
+	Recurrence *string `json:"recurrence,omitempty"`
+}
+
+// SyncResult is the outcome of a SyncChange.
+type SyncResult struct {
+	Action   string `json:"action"`
+	TaskID   string `json:"taskID,omitempty"`
+	ClientID string `json:"clientID,omitempty"`
+	Status   string `json:"status"`
+	// Changed is true if the task was created, deleted or had at least one
+	// field updated.
+	Changed bool `json:"changed"`
+	// Error is the reason a change was rejected.
+	Error     string          `json:"error,omitempty"`
+	Conflicts []*SyncConflict `json:"conflicts,omitempty"`
+	// Task is the task after the change. It is nil if the task was deleted
+	// or the change was rejected.
+	Task *Task `json:"task,omitempty"`
+}
+
+// SyncConflict is a field of a SyncChange that was not applied because the
+// field was changed more recently on the server. The server's value is kept.
+type SyncConflict struct {
+	Field            string `json:"field"`
+	ServerValue      any    `json:"serverValue"`
+	ServerModifiedAt int64  `json:"serverModifiedAt"`
+}
+
+// TaskDelta is the changes made to a user's tasks since a sync version.
+type TaskDelta struct {
+	// Tasks are the tasks created or updated since the sync version.
+	Tasks []*Task
+	// Deleted are the tasks deleted since the sync version.
+	Deleted []*TaskTombstone
+	// Reset is true if the deleted tasks since the sync version are no
+	// longer known. Tasks then contains all the user's tasks and the client
+	// must remove the tasks that are not included.
+	Reset bool
+	// SyncVersion is the version to request the next changes from.
+	SyncVersion int64
+}
+
+// TaskTombstone records the deletion of a task.
+type TaskTombstone struct {
+	TaskID    string `json:"taskID"`
+	DeletedAt int64  `json:"deletedAt"`
+}
+
+// Reminder is a notification sent to a user about a task.
+type Reminder struct {
+	ID     string `json:"id"`
+	TaskID string `json:"taskID"`
+	UserID string `json:"userID"`
+	// RemindAt is when the reminder is sent, in unix seconds. It is zero for
+	// a reminder relative to the due date of a task that no longer has one.
+	RemindAt int64 `json:"remindAt"`
+	// Offset is only set for reminders relative to the due date of the task
+	// and is the number of seconds before the due date the reminder is sent.
+	Offset    *int64 `json:"offset,omitempty"`
+	Delivered bool   `json:"delivered"`
+	// DeliveredAt is when the reminder was delivered, in unix seconds.
+	DeliveredAt int64 `json:"deliveredAt,omitempty"`
+	// Error is set if the reminder could not be delivered.
+	Error     string `json:"error,omitempty"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// DueReminder is a reminder that is due with the information required to
+// deliver it.
+type DueReminder struct {
+	*Reminder
+	Task     *Task
+	Username string
+	// Email is empty if the user has no email address.
+	Email string
+	// Attempts is the number of times the reminder has been claimed for
+	// delivery, including this time.
+	Attempts int
+}
+
+// TaskHistoryEntry is a change made to a task.
+type TaskHistoryEntry struct {
+	ID     string `json:"id"`
+	TaskID string `json:"taskID"`
+	// ActorID is the ID of the user that made the change.
+	ActorID string `json:"actorID"`
+	Action  string `json:"action"`
+	// AssigneeID and PreviousAssigneeID are set for assignment changes.
+	AssigneeID         string `json:"assigneeID,omitempty"`
+	PreviousAssigneeID string `json:"previousAssigneeID,omitempty"`
+	Timestamp          int64  `json:"timestamp"`
+}
+
+// Comment is a comment on a task. Comments can reply to other comments to
+// form threads.
+type Comment struct {
+	ID     string `json:"id"`
+	TaskID string `json:"taskID"`
+	// ParentID is the ID of the comment this comment replies to, if any.
+	ParentID       string `json:"parentID,omitempty"`
+	AuthorID       string `json:"authorID"`
+	AuthorUsername string `json:"authorUsername"`
+	// Body is markdown text. It is empty if the comment has been deleted.
+	Body string `json:"body"`
+	// Deleted is true if the comment was deleted after it was replied to.
+	Deleted   bool       `json:"deleted"`
+	CreatedAt int64      `json:"createdAt"`
+	UpdatedAt int64      `json:"updatedAt"`
+	Replies   []*Comment `json:"replies"`
+}
+
+// Attachment is information about a file attached to a task.
+type Attachment struct {
+	ID         string `json:"id"`
+	TaskID     string `json:"taskID"`
+	UploaderID string `json:"uploaderID"`
+	Filename   string `json:"filename"`
+	// ContentType is detected from the content of the file.
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	CreatedAt   int64  `json:"createdAt"`
+}
+
+// TaskUpdate is information that may be updated on a task. Empty or nil
+// fields are not updated.
+type TaskUpdate struct {
+	Detail         string
+	MarkAsComplete *bool
+	// Project is set to an empty string to remove a task from its project.
+	Project *string
+	// DueAt is set to zero to remove the due date of a task.
+	DueAt *int64
+	// Tags is set to an empty list to remove the tags of a task.
+	Tags *[]string
+	// Recurrence is set to an empty string to stop a task from recurring.
+	Recurrence *string
+}
+
+// Share is information about a task or project shared with another user.
+// Only one of TaskID or Project is set.
+type Share struct {
+	ID      string `json:"id"`
+	TaskID  string `json:"taskID,omitempty"`
+	Project string `json:"project,omitempty"`
+	// UserID and Username are the collaborator the task or project is
+	// shared with.
+	UserID     string `json:"userID"`
+	Username   string `json:"username"`
+	Permission string `json:"permission"`
+	CreatedAt  int64  `json:"createdAt"`
+}
+
+// APIToken is information about a personal access token a user created for
+// scripts and integrations. The token itself is only available when it is
+// created.
+type APIToken struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresAt is zero if the token does not expire.
+	ExpiresAt  int64 `json:"expiresAt"`
+	CreatedAt  int64 `json:"createdAt"`
+	LastUsedAt int64 `json:"lastUsedAt"`
+}
+
+// FeedToken is a secret token that gives read access to a user's calendar
+// feed.
+type FeedToken struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	CreatedAt  int64  `json:"createdAt"`
+	LastUsedAt int64  `json:"lastUsedAt"`
+}
+
+// LoginAttempts is information about consecutive failed login attempts.
+type LoginAttempts struct {
+	Failures int `json:"failures"`
+	// LastFailure is the unix timestamp of the last failed attempt.
+	LastFailure int64 `json:"lastFailure"`
+}
+
+// UserSummary is information about a user and their tasks shown to admins.
+type UserSummary struct {
+	ID                 string `json:"id"`
+	Username           string `json:"username"`
+	Email              string `json:"email,omitempty"`
+	Role               string `json:"role"`
+	Disabled           bool   `json:"disabled"`
+	MustResetPassword  bool   `json:"mustResetPassword"`
+	TwoFactorEnabled   bool   `json:"twoFactorEnabled"`
+	CreatedAt          int64  `json:"createdAt"`
+	TaskCount          int64  `json:"taskCount"`
+	CompletedTaskCount int64  `json:"completedTaskCount"`
+}
+
+// Session is information about a login session of a user.
+type Session struct {
+	ID          string `json:"id"`
+	DeviceLabel string `json:"deviceLabel"`
+	UserAgent   string `json:"userAgent"`
+	IP          string `json:"ip"`
+	CreatedAt   int64  `json:"createdAt"`
+	LastSeenAt  int64  `json:"lastSeenAt"`
+	ExpiresAt   int64  `json:"expiresAt"`
+	// Current is true if this is the session of the request.
+	Current bool `json:"current"`
+}
+
+// Workspace is information about a workspace whose tasks are visible to all
+// its members.
+type Workspace struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	OwnerID string `json:"ownerID"`
+	// Role is the role of the user the workspace was retrieved for. For
+	// invitations, it is the role the user will have once they accept.
+	Role      string `json:"role"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// WorkspaceMember is information about a member of a workspace or a user
+// that has been invited to a workspace.
+type WorkspaceMember struct {
+	UserID    string `json:"userID"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	Invited   bool   `json:"invited"`
+	InvitedBy string `json:"invitedBy,omitempty"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+const (
+	// DeliveryStatusPending is the status of a webhook delivery that has not
+	// succeeded yet and will be attempted again.
+	DeliveryStatusPending = "pending"
+	// DeliveryStatusSucceeded is the status of a webhook delivery that
+	// received a successful response.
+	DeliveryStatusSucceeded = "succeeded"
+	// DeliveryStatusFailed is the status of a webhook delivery that will not
+	// be attempted again.
+	DeliveryStatusFailed = "failed"
+)
+
+// Webhook is a URL that receives the task events of a user.
+type Webhook struct {
+	ID     string   `json:"id"`
+	UserID string   `json:"userID"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Secret is used to sign deliveries and is only returned when the
+	// webhook is created.
+	Secret    string `json:"secret,omitempty"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// WebhookDelivery is an event sent or to be sent to a webhook.
+type WebhookDelivery struct {
+	ID        string `json:"id"`
+	WebhookID string `json:"webhookID"`
+	Event     string `json:"event"`
+	Payload   string `json:"payload"`
+	Status    string `json:"status"`
+	Attempts  int    `json:"attempts"`
+	// ResponseStatus is the HTTP status code of the last attempt and is zero
+	// if no response was received.
+	ResponseStatus int    `json:"responseStatus,omitempty"`
+	Error          string `json:"error,omitempty"`
+	NextAttemptAt  int64  `json:"nextAttemptAt,omitempty"`
+	LastAttemptAt  int64  `json:"lastAttemptAt,omitempty"`
+	CreatedAt      int64  `json:"createdAt"`
+}
+
+// WebhookAttempt is the result of sending a webhook delivery.
+type WebhookAttempt struct {
+	ResponseStatus int
+	Error          string
+	// NextAttemptAt is when the delivery will be attempted again if it did
+	// not succeed. The delivery fails if it is zero.
+	NextAttemptAt int64
+}
+
+// Job is the status of a background job that runs on one server at a time.
+type Job struct {
+	Name string `json:"name"`
+	// Owner is the server that holds the job's lock, if the lock has not
+	// expired.
+	Owner string `json:"owner,omitempty"`
+	// LockedUntil is when the owner's lock expires, in unix seconds.
+	LockedUntil int64 `json:"lockedUntil,omitempty"`
+	// LastRunBy is the server that ran the job last.
+	LastRunBy string `json:"lastRunBy,omitempty"`
+	// LastStartedAt and LastFinishedAt are in unix seconds.
+	LastStartedAt  int64 `json:"lastStartedAt,omitempty"`
+	LastFinishedAt int64 `json:"lastFinishedAt,omitempty"`
+	// LastDuration is how long the last run took, in milliseconds.
+	LastDuration int64 `json:"lastDuration"`
+	// LastError is set if the last run failed.
+	LastError string `json:"lastError,omitempty"`
+	Runs      int64  `json:"runs"`
+	Failures  int64  `json:"failures"`
+}
+
+// JobRun is the result of a run of a background job.
+type JobRun struct {
+	// Owner is the server that ran the job.
+	Owner string
+	// StartedAt and FinishedAt are in unix milliseconds.
+	StartedAt  int64
+	FinishedAt int64
+	// Error is set if the run failed.
+	Error string
 }
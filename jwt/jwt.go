@@ -11,11 +11,25 @@ import (
 const (
 	jwtIssuer = "MegTask"
 
-	JWTExpiry       = 15 * time.Minute
 	jwtAudienceUser = "User"
 	jwtAlg          = jwt.HS256
+
+	// ChallengeExpiry is how long a user has to complete a two-factor
+	// authentication challenge after providing a valid password.
+	ChallengeExpiry      = 5 * time.Minute
+	jwtAudienceChallenge = "TwoFactorChallenge"
 )
 
+// Claims are the claims added to auth tokens.
+type Claims struct {
+	jwt.RegisteredClaims
+	// Role is the role of the user the token was issued to.
+	Role string `json:"role,omitempty"`
+	// SessionID is the ID of the login session the token belongs to. The
+	// token is no longer valid once the session has been revoked.
+	SessionID string `json:"sid,omitempty"`
+}
+
 type Manager struct {
 	aud      string
 	builder  *jwt.Builder
@@ -49,14 +63,31 @@ func NewJWTManager() (*Manager, error) {
 	return m, nil
 }
 
-// GenerateJWtToken generates a new jwt token for the specified id.
-func (m *Manager) GenerateJWtToken(id string) (string, error) {
-	claims := &jwt.RegisteredClaims{
-		ID:        id,
-		Audience:  jwt.Audience{jwtAudienceUser},
-		Issuer:    jwtIssuer,
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(JWTExpiry)),
+// GenerateJWtToken generates a new jwt token for the specified id and role
+// that is bound to the specified login session and expires with it after
+// expiry.
+func (m *Manager) GenerateJWtToken(id, role, sessionID string, expiry time.Duration) (string, error) {
+	return m.generateToken(id, role, sessionID, jwtAudienceUser, expiry)
+}
+
+// GenerateChallengeToken generates a short-lived token for the specified id
+// that can only be used to complete a two-factor authentication challenge.
+func (m *Manager) GenerateChallengeToken(id string) (string, error) {
+	return m.generateToken(id, "", "", jwtAudienceChallenge, ChallengeExpiry)
+}
+
+// generateToken generates a new jwt token for the specified id and audience.
+func (m *Manager) generateToken(id, role, sessionID, audience string, expiry time.Duration) (string, error) {
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        id,
+			Audience:  jwt.Audience{audience},
+			Issuer:    jwtIssuer,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiry)),
+		},
+		Role:      role,
+		SessionID: sessionID,
 	}
 
 	token, err := m.builder.Build(claims)
@@ -67,14 +98,30 @@ func (m *Manager) GenerateJWtToken(id string) (string, error) {
 	return token.String(), nil
 }
 
-// IsValidToken checks that the provided token is valid and returns the unique
-// id added to the auth token.
-func (m *Manager) IsValidToken(jwtToken string) (string, bool) {
-	jwtClaims := new(jwt.RegisteredClaims)
-	err := jwt.ParseClaims([]byte(jwtToken), m.verifier, jwtClaims)
-	if err != nil || !(jwtClaims.IsIssuer(jwtIssuer) && jwtClaims.IsValidAt(time.Now())) || !jwtClaims.IsForAudience(m.aud) {
+// IsValidToken checks that the provided token is valid and returns the claims
+// added to the auth token. The unique id is the ID of the claims.
+func (m *Manager) IsValidToken(jwtToken string) (*Claims, bool) {
+	return m.isValidToken(jwtToken, m.aud)
+}
+
+// IsValidChallengeToken checks that the provided two-factor authentication
+// challenge token is valid and returns the unique id added to the token.
+func (m *Manager) IsValidChallengeToken(jwtToken string) (string, bool) {
+	jwtClaims, valid := m.isValidToken(jwtToken, jwtAudienceChallenge)
+	if !valid {
 		return "", false
 	}
-
 	return jwtClaims.ID, true
 }
+
+// isValidToken checks that the provided token is valid for the audience and
+// returns the claims added to the token.
+func (m *Manager) isValidToken(jwtToken, audience string) (*Claims, bool) {
+	jwtClaims := new(Claims)
+	err := jwt.ParseClaims([]byte(jwtToken), m.verifier, jwtClaims)
+	if err != nil || !(jwtClaims.IsIssuer(jwtIssuer) && jwtClaims.IsValidAt(time.Now())) || !jwtClaims.IsForAudience(audience) {
+		return nil, false
+	}
+
+	return jwtClaims, true
+}
@@ -0,0 +1,67 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/ukane-philemon/megtask/webserver"
+)
+
+// Check that *FileMailer satisfies webserver.Mailer.
+var _ webserver.Mailer = (*FileMailer)(nil)
+
+// FileMailer implements webserver.Mailer for local development and tests.
+// Emails are logged and, if a file path is provided, appended to the file
+// instead of being delivered.
+type FileMailer struct {
+	mtx      sync.Mutex
+	filePath string
+	log      *slog.Logger
+}
+
+// NewFileMailer returns a new instance of *FileMailer. filePath is optional.
+func NewFileMailer(filePath string, logger *slog.Logger) (*FileMailer, error) {
+	if logger == nil {
+		return nil, errors.New("mailer logger is required")
+	}
+
+	return &FileMailer{
+		filePath: filePath,
+		log:      logger,
+	}, nil
+}
+
+// SendMail writes a plain text email with the provided subject and body to
+// the mailer's log and file.
+func (m *FileMailer) SendMail(to, subject, body string) error {
+	msg, err := buildMessage("megtask@localhost", to, subject, body)
+	if err != nil {
+		return err
+	}
+
+	m.log.Info("Email sent: ", "to", to, "subject", subject)
+
+	if m.filePath == "" {
+		m.log.Info(string(msg))
+		return nil
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	file, err := os.OpenFile(m.filePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("os.OpenFile error: %w", err)
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "%s\r\n\r\n", msg)
+	if err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ukane-philemon/megtask/webserver"
+)
+
+// Check that *SMTPMailer satisfies webserver.Mailer.
+var _ webserver.Mailer = (*SMTPMailer)(nil)
+
+// SMTPMailer implements webserver.Mailer and sends emails through an SMTP
+// server.
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer returns a new instance of *SMTPMailer. Username and password
+// are optional and PLAIN authentication is used when they are provided.
+func NewSMTPMailer(host string, port int, username, password, from string) (*SMTPMailer, error) {
+	if host == "" || port <= 0 {
+		return nil, errors.New("a valid SMTP host and port is required")
+	}
+
+	if from == "" {
+		return nil, errors.New("a sender email address is required")
+	}
+
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPMailer{
+		addr: net.JoinHostPort(host, strconv.Itoa(port)),
+		from: from,
+		auth: auth,
+	}, nil
+}
+
+// SendMail sends a plain text email with the provided subject and body to the
+// provided email address.
+func (m *SMTPMailer) SendMail(to, subject, body string) error {
+	msg, err := buildMessage(m.from, to, subject, body)
+	if err != nil {
+		return err
+	}
+
+	err = smtp.SendMail(m.addr, m.auth, m.from, []string{to}, msg)
+	if err != nil {
+		return fmt.Errorf("smtp.SendMail error: %w", err)
+	}
+
+	return nil
+}
+
+// buildMessage returns an RFC 5322 formatted plain text email.
+func buildMessage(from, to, subject, body string) ([]byte, error) {
+	for _, header := range []string{from, to, subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, errors.New("email headers cannot contain line breaks")
+		}
+	}
+
+	var msg strings.Builder
+	msg.WriteString("From: " + from + "\r\n")
+	msg.WriteString("To: " + to + "\r\n")
+	msg.WriteString("Subject: " + subject + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	return []byte(msg.String()), nil
+}
@@ -6,9 +6,16 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/ukane-philemon/megtask/blobstore"
+	"github.com/ukane-philemon/megtask/breached"
+	megdb "github.com/ukane-philemon/megtask/db"
 	"github.com/ukane-philemon/megtask/db/mongodb"
+	"github.com/ukane-philemon/megtask/mailer"
+	"github.com/ukane-philemon/megtask/oidc"
 	"github.com/ukane-philemon/megtask/webserver"
 )
 
@@ -17,7 +24,63 @@ func main() {
 	defer cancel()
 
 	var dbConnectionURL string
+	var smtpHost, smtpUsername, smtpPassword, mailFrom, mailFile string
+	var smtpPort int
+	var baseURL string
+	var requireEmailVerification, dbLoginAttempts bool
+	var maxFailedLogins int
+	var sessionExpiry, authTokenExpiry time.Duration
+	var adminUsername string
+	var oidcIssuerURL, oidcClientID, oidcClientSecret, oidcRedirectURL string
+	var passwordMinLength int
+	var passwordRequireUppercase, passwordRequireLowercase, passwordRequireDigit, passwordRequireSymbol, passwordDisallowUsername bool
+	var breachedPasswordsDir string
+	var attachmentsDir string
+	var s3Endpoint, s3Region, s3Bucket, s3AccessKeyID, s3SecretAccessKey string
+	var s3PathStyle bool
+	var maxAttachmentSizeMB, attachmentQuotaMB int64
+	var allowPrivateWebhookURLs bool
+	var dbChangeStream bool
+	var reminderNotifiers string
+	var grpcAddr string
 	flag.StringVar(&dbConnectionURL, "dbURL", "", "dbConnectionURL is a mongoDB connection URL and must be provided to connect to a database.")
+	flag.StringVar(&smtpHost, "smtpHost", "", "smtpHost is the host of the SMTP server used to send emails. Emails are logged instead if not provided.")
+	flag.IntVar(&smtpPort, "smtpPort", 587, "smtpPort is the port of the SMTP server used to send emails.")
+	flag.StringVar(&smtpUsername, "smtpUsername", "", "smtpUsername is the optional username used to authenticate with the SMTP server.")
+	flag.StringVar(&smtpPassword, "smtpPassword", "", "smtpPassword is the optional password used to authenticate with the SMTP server.")
+	flag.StringVar(&mailFrom, "mailFrom", "", "mailFrom is the sender email address used when sending emails through the SMTP server.")
+	flag.StringVar(&mailFile, "mailFile", "", "mailFile is an optional file that emails are written to when no SMTP server is provided.")
+	flag.StringVar(&baseURL, "baseURL", "", "baseURL is the public URL of the server used to build links sent to users. Defaults to the server's address.")
+	flag.BoolVar(&requireEmailVerification, "requireEmailVerification", false, "requireEmailVerification requires an email when creating an account and prevents unverified users from logging in.")
+	flag.BoolVar(&dbLoginAttempts, "dbLoginAttempts", false, "dbLoginAttempts stores failed login attempts in the database so they are shared between server instances.")
+	flag.IntVar(&maxFailedLogins, "maxFailedLogins", 0, "maxFailedLogins is the number of consecutive failed logins after which a username is temporarily locked. Defaults to 10.")
+	flag.DurationVar(&sessionExpiry, "sessionExpiry", 0, "sessionExpiry is how long a login session is valid. Defaults to 30 days.")
+	flag.DurationVar(&authTokenExpiry, "authTokenExpiry", 0, "authTokenExpiry is how long an auth token is valid before it must be renewed. Defaults to 15 minutes.")
+	flag.StringVar(&oidcIssuerURL, "oidcIssuerURL", "", "oidcIssuerURL is the URL of an OpenID Connect identity provider users can login with. Identity provider logins are disabled if not provided.")
+	flag.StringVar(&oidcClientID, "oidcClientID", "", "oidcClientID is the client ID registered with the OpenID Connect identity provider.")
+	flag.StringVar(&oidcClientSecret, "oidcClientSecret", "", "oidcClientSecret is the client secret registered with the OpenID Connect identity provider.")
+	flag.StringVar(&oidcRedirectURL, "oidcRedirectURL", "", "oidcRedirectURL is the callback URL registered with the OpenID Connect identity provider. Defaults to {baseURL}/auth/oidc/callback.")
+	flag.StringVar(&adminUsername, "adminUsername", "", "adminUsername is the username of an existing user that will be given the admin role on startup.")
+	flag.IntVar(&passwordMinLength, "passwordMinLength", 6, "passwordMinLength is the minimum number of characters in a new password.")
+	flag.BoolVar(&passwordRequireUppercase, "passwordRequireUppercase", false, "passwordRequireUppercase requires new passwords to contain an uppercase letter.")
+	flag.BoolVar(&passwordRequireLowercase, "passwordRequireLowercase", false, "passwordRequireLowercase requires new passwords to contain a lowercase letter.")
+	flag.BoolVar(&passwordRequireDigit, "passwordRequireDigit", false, "passwordRequireDigit requires new passwords to contain a digit.")
+	flag.BoolVar(&passwordRequireSymbol, "passwordRequireSymbol", false, "passwordRequireSymbol requires new passwords to contain a symbol.")
+	flag.BoolVar(&passwordDisallowUsername, "passwordDisallowUsername", false, "passwordDisallowUsername rejects new passwords that contain the user's username.")
+	flag.StringVar(&breachedPasswordsDir, "breachedPasswordsDir", "", "breachedPasswordsDir is an optional directory of SHA-1 range files of breached passwords. New passwords found in it are rejected.")
+	flag.StringVar(&attachmentsDir, "attachmentsDir", "", "attachmentsDir is a directory where the content of task attachments is saved. Attachments are disabled if neither this nor an S3 bucket is provided.")
+	flag.StringVar(&s3Endpoint, "s3Endpoint", "", "s3Endpoint is the URL of an S3 compatible service where the content of task attachments is saved instead of attachmentsDir.")
+	flag.StringVar(&s3Region, "s3Region", "", "s3Region is the region of the S3 bucket. Defaults to us-east-1.")
+	flag.StringVar(&s3Bucket, "s3Bucket", "", "s3Bucket is the name of the S3 bucket where the content of task attachments is saved.")
+	flag.StringVar(&s3AccessKeyID, "s3AccessKeyID", "", "s3AccessKeyID is the access key ID used to authenticate with the S3 service.")
+	flag.StringVar(&s3SecretAccessKey, "s3SecretAccessKey", "", "s3SecretAccessKey is the secret access key used to authenticate with the S3 service.")
+	flag.BoolVar(&s3PathStyle, "s3PathStyle", false, "s3PathStyle addresses the S3 bucket in the URL path instead of the host name, as required by most self-hosted services.")
+	flag.Int64Var(&maxAttachmentSizeMB, "maxAttachmentSizeMB", 0, "maxAttachmentSizeMB is the maximum size in megabytes of an attached file. Defaults to 10.")
+	flag.Int64Var(&attachmentQuotaMB, "attachmentQuotaMB", 0, "attachmentQuotaMB is the total size in megabytes of the files each user can attach. Defaults to 100.")
+	flag.BoolVar(&allowPrivateWebhookURLs, "allowPrivateWebhookURLs", false, "allowPrivateWebhookURLs allows webhooks to send deliveries to loopback and private network addresses.")
+	flag.BoolVar(&dbChangeStream, "dbChangeStream", false, "dbChangeStream publishes task events from a MongoDB change stream so events from all server instances are delivered. Requires MongoDB 6.0 or later running as a replica set.")
+	flag.StringVar(&reminderNotifiers, "reminderNotifiers", "email,webhook", "reminderNotifiers is a comma separated list of the ways task reminders are delivered: email, webhook and log.")
+	flag.StringVar(&grpcAddr, "grpcAddr", "", "grpcAddr is the address the gRPC API listens on, e.g localhost:9090. The gRPC API is disabled if not provided.")
 	flag.Parse()
 
 	logger := slog.New(slog.Default().Handler())
@@ -29,6 +92,14 @@ func main() {
 		os.Exit(1)
 	}
 
+	if adminUsername != "" {
+		err = db.SetUserRole(adminUsername, megdb.RoleAdmin)
+		if err != nil {
+			println("db.SetUserRole error: ", err.Error())
+			os.Exit(1)
+		}
+	}
+
 	// Ensure graceful shutdown by capturing SIGINT and SIGTERM signals.
 	shutdownChan := make(chan os.Signal, 1)
 	signal.Notify(shutdownChan, syscall.SIGINT, syscall.SIGTERM)
@@ -38,7 +109,101 @@ func main() {
 		cancel()
 	}()
 
-	server, err := webserver.New(db, logger)
+	var mailSender webserver.Mailer
+	if smtpHost != "" {
+		mailSender, err = mailer.NewSMTPMailer(smtpHost, smtpPort, smtpUsername, smtpPassword, mailFrom)
+	} else {
+		mailSender, err = mailer.NewFileMailer(mailFile, logger)
+	}
+	if err != nil {
+		println("mailer error: ", err.Error())
+		os.Exit(1)
+	}
+
+	passwordPolicy := &webserver.PasswordPolicy{
+		MinLength:        passwordMinLength,
+		RequireUppercase: passwordRequireUppercase,
+		RequireLowercase: passwordRequireLowercase,
+		RequireDigit:     passwordRequireDigit,
+		RequireSymbol:    passwordRequireSymbol,
+		DisallowUsername: passwordDisallowUsername,
+	}
+	if breachedPasswordsDir != "" {
+		passwordPolicy.BreachedPasswords, err = breached.NewChecker(breachedPasswordsDir)
+		if err != nil {
+			println("breached.NewChecker error: ", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	serverCfg := &webserver.Config{
+		Mailer:                   mailSender,
+		BaseURL:                  baseURL,
+		RequireEmailVerification: requireEmailVerification,
+		MaxFailedLogins:          maxFailedLogins,
+		SessionExpiry:            sessionExpiry,
+		AuthTokenExpiry:          authTokenExpiry,
+		PasswordPolicy:           passwordPolicy,
+		MaxAttachmentSize:        maxAttachmentSizeMB << 20,
+		AttachmentQuota:          attachmentQuotaMB << 20,
+		AllowPrivateWebhookURLs:  allowPrivateWebhookURLs,
+		GRPCAddr:                 grpcAddr,
+	}
+	if oidcIssuerURL != "" {
+		serverCfg.OIDC = &oidc.Config{
+			IssuerURL:    oidcIssuerURL,
+			ClientID:     oidcClientID,
+			ClientSecret: oidcClientSecret,
+			RedirectURL:  oidcRedirectURL,
+		}
+	}
+	if dbLoginAttempts {
+		serverCfg.LoginAttemptStore = db
+	}
+	for _, name := range strings.Split(reminderNotifiers, ",") {
+		switch strings.TrimSpace(name) {
+		case "email":
+			serverCfg.ReminderNotifiers = append(serverCfg.ReminderNotifiers, webserver.NewEmailNotifier(mailSender))
+		case "webhook":
+			serverCfg.ReminderNotifiers = append(serverCfg.ReminderNotifiers, webserver.NewWebhookNotifier(db))
+		case "log":
+			serverCfg.ReminderNotifiers = append(serverCfg.ReminderNotifiers, webserver.NewLogNotifier(logger))
+		case "":
+		default:
+			println("unknown reminder notifier: ", name)
+			os.Exit(1)
+		}
+	}
+	if dbChangeStream {
+		err = db.StartTaskChangeStream(ctx)
+		if err != nil {
+			println("db.StartTaskChangeStream error: ", err.Error())
+			os.Exit(1)
+		}
+		serverCfg.TaskChanges = db
+	}
+	if s3Endpoint != "" {
+		serverCfg.BlobStore, err = blobstore.NewS3Store(&blobstore.S3Config{
+			Endpoint:        s3Endpoint,
+			Region:          s3Region,
+			Bucket:          s3Bucket,
+			AccessKeyID:     s3AccessKeyID,
+			SecretAccessKey: s3SecretAccessKey,
+			PathStyle:       s3PathStyle,
+		})
+		if err != nil {
+			println("blobstore.NewS3Store error: ", err.Error())
+			os.Exit(1)
+		}
+	} else if attachmentsDir != "" {
+		serverCfg.BlobStore, err = blobstore.NewLocalStore(attachmentsDir)
+		if err != nil {
+			println("blobstore.NewLocalStore error: ", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	server, err := webserver.New(db, logger, serverCfg)
 	if err != nil {
 		println("webserver.New error: ", err.Error())
 		os.Exit(1)
@@ -0,0 +1,31 @@
+package megtaskpb
+
+import (
+	"context"
+
+	"google.golang.org/grpc/credentials"
+)
+
+var _ credentials.PerRPCCredentials = (*TokenCredentials)(nil)
+
+// TokenCredentials sends a login token or personal access token as a bearer
+// token with every call.
+type TokenCredentials struct {
+	Token string
+	// Insecure allows the token to be sent on connections without transport
+	// security, e.g to a server on the same host or private network.
+	Insecure bool
+}
+
+// GetRequestMetadata returns the authorization metadata of a call.
+func (tc *TokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{
+		"authorization": "Bearer " + tc.Token,
+	}, nil
+}
+
+// RequireTransportSecurity checks if the token can only be sent on secure
+// connections.
+func (tc *TokenCredentials) RequireTransportSecurity() bool {
+	return !tc.Insecure
+}
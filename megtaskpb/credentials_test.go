@@ -0,0 +1,32 @@
+package megtaskpb
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTokenCredentials(t *testing.T) {
+	tests := []struct {
+		name                string
+		creds               *TokenCredentials
+		wantTransportSecure bool
+	}{
+		{"secure", &TokenCredentials{Token: "token"}, true},
+		{"insecure", &TokenCredentials{Token: "token", Insecure: true}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			md, err := test.creds.GetRequestMetadata(context.Background())
+			if err != nil {
+				t.Fatalf("GetRequestMetadata error: %v", err)
+			}
+			if len(md) != 1 || md["authorization"] != "Bearer token" {
+				t.Fatalf("want bearer token metadata, got %v", md)
+			}
+			if secure := test.creds.RequireTransportSecurity(); secure != test.wantTransportSecure {
+				t.Fatalf("want transport security required %v, got %v", test.wantTransportSecure, secure)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+// Package megtaskpb is the gRPC API of a megtask server and its Go client,
+// generated from megtask.proto. Calls must be authenticated with a login
+// token or personal access token; TokenCredentials sends one with every call.
+//
+//	conn, err := grpc.NewClient("localhost:9090",
+//		grpc.WithTransportCredentials(insecure.NewCredentials()),
+//		grpc.WithPerRPCCredentials(&megtaskpb.TokenCredentials{Token: token, Insecure: true}))
+//	...
+//	tasks, err := megtaskpb.NewTaskServiceClient(conn).ListTasks(ctx, &megtaskpb.ListTasksRequest{})
+//
+// Regenerate the code after changing megtask.proto with protoc,
+// protoc-gen-go and protoc-gen-go-grpc. The google/api protos are in
+// https://github.com/googleapis/googleapis.
+package megtaskpb
+
+//go:generate protoc -I . -I $GOOGLEAPIS_DIR --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative megtask.proto
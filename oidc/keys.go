@@ -0,0 +1,203 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/cristalhq/jwt/v4"
+)
+
+// minKeyRefreshInterval is the minimum time between fetches of the identity
+// provider's keys when a token is signed with an unknown key.
+const minKeyRefreshInterval = time.Minute
+
+// jsonWebKey is a public key in JWK format. Only RSA and EC keys are
+// supported.
+type jsonWebKey struct {
+	KeyID     string `json:"kid"`
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA keys.
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC keys.
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+// keySet is the identity provider's signing keys.
+type keySet struct {
+	keys      []jsonWebKey
+	fetchedAt time.Time
+}
+
+// verifier returns a verifier for tokens signed with the identity provider's
+// key with the provided keyID and algorithm. The provider's keys are fetched
+// again if no key matches, so keys can be rotated.
+func (p *Provider) verifier(ctx context.Context, keyID string, alg jwt.Algorithm) (jwt.Verifier, error) {
+	if alg == "" || alg == "none" || alg == jwt.HS256 || alg == jwt.HS384 || alg == jwt.HS512 {
+		return nil, fmt.Errorf("unsupported id token algorithm %q", alg)
+	}
+
+	p.mtx.Lock()
+	keys := p.keys
+	p.mtx.Unlock()
+
+	if keys != nil {
+		if key := keys.find(keyID, alg); key != nil {
+			return key.verifier(alg)
+		}
+
+		if time.Since(keys.fetchedAt) < minKeyRefreshInterval {
+			return nil, fmt.Errorf("no identity provider key matches key ID %q", keyID)
+		}
+	}
+
+	keys, err := p.fetchKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	key := keys.find(keyID, alg)
+	if key == nil {
+		return nil, fmt.Errorf("no identity provider key matches key ID %q", keyID)
+	}
+
+	return key.verifier(alg)
+}
+
+// fetchKeys fetches and caches the identity provider's keys.
+func (p *Provider) fetchKeys(ctx context.Context) (*keySet, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discovery.JWKSURI, nil)
+	if err != nil {
+		return nil, fmt.Errorf("http.NewRequestWithContext error: %w", err)
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err = p.doJSON(req, &jwks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch identity provider keys: %w", err)
+	}
+
+	keys := &keySet{
+		keys:      jwks.Keys,
+		fetchedAt: time.Now(),
+	}
+
+	p.mtx.Lock()
+	p.keys = keys
+	p.mtx.Unlock()
+
+	return keys, nil
+}
+
+// find returns the signing key that matches keyID and alg. If keyID is empty,
+// the key is only returned if it is the only signing key for alg.
+func (ks *keySet) find(keyID string, alg jwt.Algorithm) *jsonWebKey {
+	var match *jsonWebKey
+	for i := range ks.keys {
+		key := &ks.keys[i]
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		if key.Algorithm != "" && key.Algorithm != string(alg) {
+			continue
+		}
+
+		if keyID != "" {
+			if key.KeyID == keyID {
+				return key
+			}
+			continue
+		}
+
+		if match != nil {
+			return nil
+		}
+		match = key
+	}
+	return match
+}
+
+// verifier returns a verifier for tokens signed with k using alg.
+func (k *jsonWebKey) verifier(alg jwt.Algorithm) (jwt.Verifier, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA key exponent")
+		}
+
+		key := &rsa.PublicKey{N: n, E: int(e.Int64())}
+		switch alg {
+		case jwt.PS256, jwt.PS384, jwt.PS512:
+			return jwt.NewVerifierPS(alg, key)
+		default:
+			return jwt.NewVerifierRS(alg, key)
+		}
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported EC curve %q", k.Curve)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return jwt.NewVerifierES(alg, &ecdsa.PublicKey{Curve: curve, X: x, Y: y})
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+}
+
+// decodeBigInt decodes a base64url encoded big-endian integer.
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
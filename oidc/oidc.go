@@ -0,0 +1,309 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cristalhq/jwt/v4"
+)
+
+const (
+	// requestTimeout is the maximum duration of requests to the identity
+	// provider.
+	requestTimeout = 10 * time.Second
+	// maxResponseSize is the maximum size of responses read from the identity
+	// provider.
+	maxResponseSize = 1 << 20
+	// clockSkew is the clock difference tolerated when validating ID tokens.
+	clockSkew = time.Minute
+)
+
+// Config is information required to login with an OpenID Connect identity
+// provider.
+type Config struct {
+	// IssuerURL is the URL of the identity provider. The provider's
+	// configuration is discovered from
+	// {IssuerURL}/.well-known/openid-configuration.
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback URL registered with the identity provider.
+	RedirectURL string
+	// Scopes are additional scopes to request. The "openid", "profile" and
+	// "email" scopes are always requested.
+	Scopes []string
+	// HTTPClient is used for requests to the identity provider. Defaults to a
+	// client with a 10 second timeout.
+	HTTPClient *http.Client
+}
+
+// Claims are the ID token claims used to identify a user.
+type Claims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+}
+
+// discoveryDocument is the subset of the identity provider's configuration
+// that is used.
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider performs the OpenID Connect authorization code flow with PKCE
+// against an identity provider. The provider's configuration is discovered
+// on first use and cached.
+type Provider struct {
+	cfg        Config
+	httpClient *http.Client
+
+	mtx       sync.Mutex
+	discovery *discoveryDocument
+	keys      *keySet
+}
+
+// New returns a new instance of *Provider.
+func New(cfg *Config) (*Provider, error) {
+	if cfg == nil || cfg.IssuerURL == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.New("oidc issuer URL, client ID and redirect URL are required")
+	}
+
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: requestTimeout}
+	}
+
+	return &Provider{
+		cfg:        *cfg,
+		httpClient: httpClient,
+	}, nil
+}
+
+// Issuer returns the issuer URL of the identity provider.
+func (p *Provider) Issuer() string {
+	return strings.TrimSuffix(p.cfg.IssuerURL, "/")
+}
+
+// AuthCodeURL returns the URL of the identity provider's authorization
+// endpoint that users should be redirected to. codeVerifier is the PKCE code
+// verifier that must be provided to Exchange.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	scopes := append([]string{"openid", "profile", "email"}, p.cfg.Scopes...)
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.cfg.RedirectURL)
+	query.Set("scope", strings.Join(scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge(codeVerifier))
+	query.Set("code_challenge_method", "S256")
+
+	authURL, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+
+	// Preserve any query parameters already in the authorization endpoint.
+	existingQuery := authURL.Query()
+	for key, values := range query {
+		existingQuery[key] = values
+	}
+	authURL.RawQuery = existingQuery.Encode()
+
+	return authURL.String(), nil
+}
+
+// Exchange exchanges an authorization code for tokens at the identity
+// provider's token endpoint and returns the verified ID token claims. nonce
+// must match the nonce provided to AuthCodeURL.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Claims, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", p.cfg.ClientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("http.NewRequestWithContext error: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	var tokenRes struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	err = p.doJSON(req, &tokenRes)
+	if err != nil {
+		if tokenRes.Error != "" {
+			return nil, fmt.Errorf("token request failed: %s: %s", tokenRes.Error, tokenRes.ErrorDescription)
+		}
+		return nil, err
+	}
+
+	if tokenRes.IDToken == "" {
+		return nil, errors.New("token response is missing an id_token")
+	}
+
+	return p.VerifyIDToken(ctx, tokenRes.IDToken, nonce)
+}
+
+// VerifyIDToken verifies the signature and claims of an ID token issued by
+// the identity provider and returns its claims.
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*Claims, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwt.ParseNoVerify([]byte(rawIDToken))
+	if err != nil {
+		return nil, fmt.Errorf("jwt.ParseNoVerify error: %w", err)
+	}
+
+	header := token.Header()
+	verifier, err := p.verifier(ctx, header.KeyID, header.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifier.Verify(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token signature: %w", err)
+	}
+
+	claims := new(Claims)
+	err = token.DecodeClaims(claims)
+	if err != nil {
+		return nil, fmt.Errorf("token.DecodeClaims error: %w", err)
+	}
+
+	now := time.Now()
+	switch {
+	case !claims.IsIssuer(discovery.Issuer):
+		return nil, fmt.Errorf("unexpected id token issuer %q", claims.Issuer)
+	case !claims.IsForAudience(p.cfg.ClientID):
+		return nil, errors.New("id token was not issued for this client")
+	case claims.ExpiresAt == nil || !claims.IsValidExpiresAt(now.Add(-clockSkew)):
+		return nil, errors.New("id token has expired")
+	case !claims.IsValidIssuedAt(now.Add(clockSkew)):
+		return nil, errors.New("id token was issued in the future")
+	case claims.Nonce == "" || claims.Nonce != nonce:
+		return nil, errors.New("id token nonce does not match")
+	case claims.Subject == "":
+		return nil, errors.New("id token is missing a subject")
+	}
+
+	return claims, nil
+}
+
+// discover returns the identity provider's configuration, fetching it if it
+// has not been fetched yet.
+func (p *Provider) discover(ctx context.Context) (*discoveryDocument, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	discoveryURL := p.Issuer() + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("http.NewRequestWithContext error: %w", err)
+	}
+
+	discovery := new(discoveryDocument)
+	err = p.doJSON(req, discovery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch openid configuration: %w", err)
+	}
+
+	if discovery.Issuer != p.Issuer() {
+		return nil, fmt.Errorf("openid configuration issuer %q does not match %q", discovery.Issuer, p.Issuer())
+	}
+
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("openid configuration is missing required endpoints")
+	}
+
+	p.discovery = discovery
+	return discovery, nil
+}
+
+// doJSON sends req and decodes the JSON response body into resp. resp is
+// also decoded for error responses so error details can be read.
+func (p *Provider) doJSON(req *http.Request, resp any) error {
+	res, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("httpClient.Do error: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	decodeErr := json.Unmarshal(body, resp)
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response status %d from %s", res.StatusCode, req.URL.Redacted())
+	}
+
+	if decodeErr != nil {
+		return fmt.Errorf("json.Unmarshal error: %w", decodeErr)
+	}
+
+	return nil
+}
+
+// RandomString returns a random URL safe string that is suitable for use as
+// a state, nonce or PKCE code verifier.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("rand.Read error: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// codeChallenge returns the S256 PKCE code challenge for codeVerifier.
+func codeChallenge(codeVerifier string) string {
+	hash := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
@@ -0,0 +1,153 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 secret of the RFC 6238 Appendix B test vectors.
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestRFC6238Vectors(t *testing.T) {
+	// The RFC vectors have 8 digits, codes with fewer digits are their last
+	// digits.
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, test := range tests {
+		want := test.code[len(test.code)-Digits:]
+
+		key, _ := b32Encoding.DecodeString(rfc6238Secret)
+		if got := generateCode(key, uint64(test.unix/Period)); got != want {
+			t.Errorf("at %d: want code %s, got %s", test.unix, want, got)
+		}
+
+		step, valid := Validate(rfc6238Secret, want, time.Unix(test.unix, 0))
+		if !valid {
+			t.Errorf("at %d: code %s is not valid", test.unix, want)
+		}
+		if step != test.unix/Period {
+			t.Errorf("at %d: want step %d, got %d", test.unix, test.unix/Period, step)
+		}
+	}
+}
+
+func TestValidateDrift(t *testing.T) {
+	// The code for 1234567890 is valid in the period from 1234567890 to
+	// 1234567919.
+	const code = "005924"
+	generatedAt := time.Unix(1234567890, 0)
+
+	tests := []struct {
+		name  string
+		at    time.Time
+		valid bool
+	}{
+		{"same period", generatedAt.Add(29 * time.Second), true},
+		{"one period late", generatedAt.Add(Period * time.Second), true},
+		{"end of one period late", generatedAt.Add((Period + 29) * time.Second), true},
+		{"two periods late", generatedAt.Add(2 * Period * time.Second), false},
+		{"one period early", generatedAt.Add(-Period * time.Second), true},
+		{"two periods early", generatedAt.Add(-2 * Period * time.Second), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			step, valid := Validate(rfc6238Secret, code, test.at)
+			if valid != test.valid {
+				t.Fatalf("want valid %v, got %v", test.valid, valid)
+			}
+			// The step is the period the code was generated for, not the
+			// current period, so replays are detected across drift.
+			if valid && step != generatedAt.Unix()/Period {
+				t.Fatalf("want step %d, got %d", generatedAt.Unix()/Period, step)
+			}
+		})
+	}
+}
+
+func TestValidateReplay(t *testing.T) {
+	key, _ := b32Encoding.DecodeString(rfc6238Secret)
+	now := time.Unix(1234567890, 0)
+	step := now.Unix() / Period
+	codeAt := func(step int64) string { return generateCode(key, uint64(step)) }
+
+	// Callers only accept codes for a newer step than the last accepted code,
+	// as useTwoFactorCode does in the database.
+	tests := []struct {
+		name     string
+		lastStep int64
+		code     string
+		accepted bool
+	}{
+		{"first code", 0, codeAt(step), true},
+		{"same code again", step, codeAt(step), false},
+		{"previous code after a newer one", step, codeAt(step - 1), false},
+		{"next code", step, codeAt(step + 1), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			codeStep, valid := Validate(rfc6238Secret, test.code, now)
+			if !valid {
+				t.Fatalf("code %s is not valid", test.code)
+			}
+			if accepted := codeStep > test.lastStep; accepted != test.accepted {
+				t.Fatalf("want accepted %v, got %v", test.accepted, accepted)
+			}
+		})
+	}
+}
+
+func TestValidateInvalid(t *testing.T) {
+	now := time.Unix(59, 0)
+	tests := []struct {
+		name, secret, code string
+	}{
+		{"wrong code", rfc6238Secret, "287083"},
+		{"too short", rfc6238Secret, "28708"},
+		{"too long", rfc6238Secret, "4287082"},
+		{"invalid secret", "not base32!", "287082"},
+		{"other secret", strings.Repeat("A", 32), "287082"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, valid := Validate(test.secret, test.code, now); valid {
+				t.Fatal("want invalid code")
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret error: %v", err)
+	}
+
+	key, err := b32Encoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("secret is not base32: %v", err)
+	}
+	if len(key) != secretSize {
+		t.Fatalf("want %d byte secret, got %d", secretSize, len(key))
+	}
+
+	// Lowercase secrets, as typed by users, are accepted.
+	code := generateCode(key, uint64(time.Now().Unix()/Period))
+	if _, valid := Validate(strings.ToLower(secret), code, time.Now()); !valid {
+		t.Fatal("lowercase secret is not accepted")
+	}
+}
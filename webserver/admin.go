@@ -0,0 +1,179 @@
+package webserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ukane-philemon/megtask/db"
+)
+
+const (
+	// offsetQueryKey is the expected query key to provide the number of items
+	// to skip in a list.
+	offsetQueryKey = "offset"
+	// limitQueryKey is the expected query key to provide the maximum number
+	// of items to return in a list.
+	limitQueryKey = "limit"
+
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+// handleAdminRetrieveUsers handles the "GET /admin/users" endpoint and returns
+// a page of users with their task counts. This endpoint accepts optional
+// "offset" and "limit" query parameters.
+func (s *WebServer) handleAdminRetrieveUsers(res http.ResponseWriter, req *http.Request) {
+	offset, limit, err := pageParams(req)
+	if err != nil {
+		s.writeBadRequest(res, err.Error())
+		return
+	}
+
+	users, err := s.taskDB.Users(offset, limit)
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("taskDB.Users error: %w", err))
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"users": users,
+	})
+}
+
+// handleAdminRetrieveUser handles the "GET /admin/users/{userID}" endpoint and
+// returns a user with their task counts.
+func (s *WebServer) handleAdminRetrieveUser(res http.ResponseWriter, req *http.Request) {
+	userID := chi.URLParam(req, "userID")
+	user, err := s.taskDB.UserSummary(userID)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.UserSummary error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"user": user,
+	})
+}
+
+// handleAdminDisableUser handles the "POST /admin/users/{userID}/disable"
+// endpoint and disables a user's account.
+func (s *WebServer) handleAdminDisableUser(res http.ResponseWriter, req *http.Request) {
+	s.setUserDisabled(res, req, true)
+}
+
+// handleAdminEnableUser handles the "POST /admin/users/{userID}/enable"
+// endpoint and enables a disabled user's account.
+func (s *WebServer) handleAdminEnableUser(res http.ResponseWriter, req *http.Request) {
+	s.setUserDisabled(res, req, false)
+}
+
+// setUserDisabled disables or enables the account of the user in the request
+// URL.
+func (s *WebServer) setUserDisabled(res http.ResponseWriter, req *http.Request, disabled bool) {
+	userID := chi.URLParam(req, "userID")
+	if disabled && userID == s.reqUserID(req) {
+		s.writeBadRequest(res, "you cannot disable your own account")
+		return
+	}
+
+	err := s.taskDB.SetUserDisabled(userID, disabled)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.SetUserDisabled error: %w", err))
+		}
+		return
+	}
+
+	message := "Account enabled."
+	if disabled {
+		message = "Account disabled."
+	}
+
+	s.writeSuccess(res, map[string]string{
+		"message": message,
+	})
+}
+
+// handleAdminForcePasswordReset handles the
+// "POST /admin/users/{userID}/force-password-reset" endpoint and requires a
+// user to reset their password before they can login again. A password reset
+// token is emailed to the user if they have an email.
+func (s *WebServer) handleAdminForcePasswordReset(res http.ResponseWriter, req *http.Request) {
+	userID := chi.URLParam(req, "userID")
+	user, err := s.taskDB.ForcePasswordReset(userID)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.ForcePasswordReset error: %w", err))
+		}
+		return
+	}
+
+	if user.Email == "" {
+		s.writeSuccess(res, map[string]string{
+			"message": "Password reset required. The user has no email, so they must be given a reset token another way.",
+		})
+		return
+	}
+
+	err = s.sendPasswordReset(user.Email)
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("sendPasswordReset error: %w", err))
+		return
+	}
+
+	s.writeSuccess(res, map[string]string{
+		"message": "Password reset required. A password reset token has been emailed to the user.",
+	})
+}
+
+// handleAdminRetrieveJobs handles the "GET /admin/jobs" endpoint and returns
+// the status of the background jobs, including the server that holds each
+// job's lock and the result of its last run. The ID of the server that
+// handled the request is returned as "server".
+func (s *WebServer) handleAdminRetrieveJobs(res http.ResponseWriter, req *http.Request) {
+	jobs, err := s.taskDB.Jobs()
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("taskDB.Jobs error: %w", err))
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"server": s.jobs.owner,
+		"jobs":   s.jobs.jobInfos(jobs),
+	})
+}
+
+// pageParams returns the offset and limit query parameters of req.
+func pageParams(req *http.Request) (int64, int64, error) {
+	offset, limit := int64(0), int64(defaultPageLimit)
+	query := req.URL.Query()
+
+	if offsetStr := query.Get(offsetQueryKey); offsetStr != "" {
+		var err error
+		offset, err = strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New(`"offset" query param must be a positive number`)
+		}
+	}
+
+	if limitStr := query.Get(limitQueryKey); limitStr != "" {
+		var err error
+		limit, err = strconv.ParseInt(limitStr, 10, 64)
+		if err != nil || limit <= 0 || limit > maxPageLimit {
+			return 0, 0, fmt.Errorf(`"limit" query param must be between 1 and %d`, maxPageLimit)
+		}
+	}
+
+	return offset, limit, nil
+}
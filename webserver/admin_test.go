@@ -0,0 +1,160 @@
+package webserver
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+// adminDB is a TaskDatabase with the users in emails, which maps user IDs to
+// their email, and records the accounts it disables, the users it requires to
+// reset their password and the pages of users it returns.
+type adminDB struct {
+	authDB
+	emails        map[string]string
+	disabled      map[string]bool
+	resetRequired map[string]bool
+	page          *[2]int64
+}
+
+func (adb adminDB) APITokenOwner(token string) (string, []string, error) {
+	userID, scopes, err := adb.authDB.APITokenOwner(token)
+	if err == nil && adb.resetRequired[userID] {
+		return "", nil, db.ErrorInvalidRequest
+	}
+	return userID, scopes, err
+}
+
+func (adb adminDB) Users(offset, limit int64) ([]*db.UserSummary, error) {
+	*adb.page = [2]int64{offset, limit}
+	return nil, nil
+}
+
+func (adb adminDB) SetUserDisabled(userID string, disabled bool) error {
+	if _, ok := adb.emails[userID]; !ok {
+		return db.ErrorInvalidRequest
+	}
+	adb.disabled[userID] = disabled
+	return nil
+}
+
+func (adb adminDB) ForcePasswordReset(userID string) (*db.UserSummary, error) {
+	email, ok := adb.emails[userID]
+	if !ok {
+		return nil, db.ErrorInvalidRequest
+	}
+	if adb.resetRequired != nil {
+		adb.resetRequired[userID] = true
+	}
+	return &db.UserSummary{ID: userID, Email: email}, nil
+}
+
+func (adminDB) CreatePasswordResetToken(email, token string, expiry time.Duration) (string, error) {
+	return "user", nil
+}
+
+func TestAdminUsers(t *testing.T) {
+	adb := adminDB{
+		authDB:   authDB{roles: map[string]string{"admin": db.RoleAdmin, "user": db.RoleUser}},
+		emails:   map[string]string{"admin": "", "user": "user@example.com", "no-email": ""},
+		disabled: make(map[string]bool),
+		page:     new([2]int64),
+	}
+	mailer := new(testMailer)
+	s := newTestServer(t, adb, &Config{Mailer: mailer})
+
+	tests := []struct {
+		name         string
+		userID       string
+		method       string
+		path         string
+		wantStatus   int
+		wantPage     [2]int64
+		wantDisabled map[string]bool
+		wantEmails   int
+	}{
+		{name: "user lists users", userID: "user", method: http.MethodGet, path: "/admin/users", wantStatus: http.StatusForbidden},
+		{name: "user disables an account", userID: "user", method: http.MethodPost, path: "/admin/users/admin/disable", wantStatus: http.StatusForbidden},
+		{name: "default page", userID: "admin", method: http.MethodGet, path: "/admin/users", wantStatus: http.StatusOK, wantPage: [2]int64{0, defaultPageLimit}},
+		{name: "page", userID: "admin", method: http.MethodGet, path: "/admin/users?offset=10&limit=20", wantStatus: http.StatusOK, wantPage: [2]int64{10, 20}},
+		{name: "negative offset", userID: "admin", method: http.MethodGet, path: "/admin/users?offset=-1", wantStatus: http.StatusBadRequest},
+		{name: "zero limit", userID: "admin", method: http.MethodGet, path: "/admin/users?limit=0", wantStatus: http.StatusBadRequest},
+		{name: "limit too large", userID: "admin", method: http.MethodGet, path: fmt.Sprintf("/admin/users?limit=%d", maxPageLimit+1), wantStatus: http.StatusBadRequest},
+		{name: "disable own account", userID: "admin", method: http.MethodPost, path: "/admin/users/admin/disable", wantStatus: http.StatusBadRequest},
+		{name: "disable an account", userID: "admin", method: http.MethodPost, path: "/admin/users/user/disable", wantStatus: http.StatusOK, wantDisabled: map[string]bool{"user": true}},
+		{name: "enable an account", userID: "admin", method: http.MethodPost, path: "/admin/users/user/enable", wantStatus: http.StatusOK, wantDisabled: map[string]bool{"user": false}},
+		{name: "disable a missing account", userID: "admin", method: http.MethodPost, path: "/admin/users/missing/disable", wantStatus: http.StatusBadRequest},
+		{name: "force a password reset", userID: "admin", method: http.MethodPost, path: "/admin/users/user/force-password-reset", wantStatus: http.StatusOK, wantEmails: 1},
+		{name: "force a password reset without email", userID: "admin", method: http.MethodPost, path: "/admin/users/no-email/force-password-reset", wantStatus: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			*adb.page = [2]int64{}
+			mailer.sent = nil
+
+			token, err := s.jwtManager.GenerateJWtToken(test.userID, adb.roles[test.userID], "session", time.Minute)
+			if err != nil {
+				t.Fatalf("GenerateJWtToken error: %v", err)
+			}
+
+			res := testRequest(t, s, test.method, test.path, token, nil)
+			checkStatus(t, res, test.wantStatus)
+
+			if *adb.page != test.wantPage {
+				t.Fatalf("want page %v, got %v", test.wantPage, *adb.page)
+			}
+			for userID, disabled := range test.wantDisabled {
+				if adb.disabled[userID] != disabled {
+					t.Fatalf("want %s disabled %v", userID, disabled)
+				}
+			}
+			if len(mailer.sent) != test.wantEmails {
+				t.Fatalf("want %d emails sent, got %d", test.wantEmails, len(mailer.sent))
+			}
+		})
+	}
+}
+
+func TestForcePasswordResetAPIToken(t *testing.T) {
+	const apiToken = apiTokenPrefix + "token"
+	adb := adminDB{
+		authDB: authDB{
+			roles:  map[string]string{"admin": db.RoleAdmin, "user": db.RoleUser},
+			scopes: map[string][]string{apiToken: {scopeTasksRead}},
+		},
+		emails:        map[string]string{"user": "user@example.com"},
+		resetRequired: make(map[string]bool),
+		page:          new([2]int64),
+	}
+	s := newTestServer(t, adb, nil)
+
+	adminToken, err := s.jwtManager.GenerateJWtToken("admin", db.RoleAdmin, "session", time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateJWtToken error: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{"api token before the reset", http.MethodGet, "/webhooks", apiToken, http.StatusOK},
+		{"force a password reset", http.MethodPost, "/admin/users/user/force-password-reset", adminToken, http.StatusOK},
+		{"api token after the reset", http.MethodGet, "/webhooks", apiToken, http.StatusUnauthorized},
+	}
+
+	// The tests run in order, as the reset changes the result of the last
+	// request.
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := testRequest(t, s, test.method, test.path, test.token, nil)
+			checkStatus(t, res, test.wantStatus)
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package webserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ukane-philemon/megtask/db"
+)
+
+const (
+	// apiTokenPrefix is added to personal access tokens to distinguish them
+	// from login tokens.
+	apiTokenPrefix = "mgt_"
+
+	// scopeTasksRead allows an api token to retrieve tasks.
+	scopeTasksRead = "tasks:read"
+	// scopeTasksWrite allows an api token to create, update and delete tasks.
+	scopeTasksWrite = "tasks:write"
+)
+
+// validAPITokenScopes are the scopes that can be granted to an api token.
+var validAPITokenScopes = map[string]bool{
+	scopeTasksRead:  true,
+	scopeTasksWrite: true,
+}
+
+// apiTokenRouteScopes are the routes that can be accessed with an api token,
+// keyed by their method and route pattern, and the scope the token needs for
+// each route. Api tokens cannot access routes that are not listed, so account
+// management endpoints and new routes are denied by default. Routes with an
+// empty scope check the scopes of each operation they perform.
+var apiTokenRouteScopes = map[string]string{
+	"GET /ws":       "",
+	"POST /graphql": "",
+
+	"PROPFIND /caldav/*": scopeTasksRead,
+	"REPORT /caldav/*":   scopeTasksRead,
+	"GET /caldav/*":      scopeTasksRead,
+	"PUT /caldav/*":      scopeTasksWrite,
+	"DELETE /caldav/*":   scopeTasksWrite,
+
+	"POST /task":                                       scopeTasksWrite,
+	"GET /tasks":                                       scopeTasksRead,
+	"GET /events":                                      scopeTasksRead,
+	"GET /sync":                                        scopeTasksRead,
+	"POST /sync":                                       scopeTasksWrite,
+	"PATCH /task/{taskID}":                             scopeTasksWrite,
+	"DELETE /task/{taskID}":                            scopeTasksWrite,
+	"PATCH /task/{taskID}/assign":                      scopeTasksWrite,
+	"PATCH /task/{taskID}/unassign":                    scopeTasksWrite,
+	"GET /task/{taskID}/history":                       scopeTasksRead,
+	"POST /task/{taskID}/comments":                     scopeTasksWrite,
+	"GET /task/{taskID}/comments":                      scopeTasksRead,
+	"PATCH /task/{taskID}/comments/{commentID}":        scopeTasksWrite,
+	"DELETE /task/{taskID}/comments/{commentID}":       scopeTasksWrite,
+	"POST /task/{taskID}/reminders":                    scopeTasksWrite,
+	"GET /task/{taskID}/reminders":                     scopeTasksRead,
+	"DELETE /task/{taskID}/reminders/{reminderID}":     scopeTasksWrite,
+	"POST /task/{taskID}/attachments":                  scopeTasksWrite,
+	"GET /task/{taskID}/attachments":                   scopeTasksRead,
+	"GET /task/{taskID}/attachments/{attachmentID}":    scopeTasksRead,
+	"DELETE /task/{taskID}/attachments/{attachmentID}": scopeTasksWrite,
+
+	"POST /shares":             scopeTasksWrite,
+	"GET /shares":              scopeTasksRead,
+	"DELETE /shares/{shareID}": scopeTasksWrite,
+
+	"POST /webhooks":                       scopeTasksWrite,
+	"GET /webhooks":                        scopeTasksRead,
+	"DELETE /webhooks/{webhookID}":         scopeTasksWrite,
+	"GET /webhooks/{webhookID}/deliveries": scopeTasksRead,
+	"POST /webhooks/{webhookID}/ping":      scopeTasksWrite,
+
+	"POST /workspaces":                                  scopeTasksWrite,
+	"GET /workspaces":                                   scopeTasksRead,
+	"GET /workspace-invitations":                        scopeTasksRead,
+	"POST /workspace-invitations/{workspaceID}/accept":  scopeTasksWrite,
+	"POST /workspace-invitations/{workspaceID}/decline": scopeTasksWrite,
+
+	"GET /workspaces/{workspaceID}":                                             scopeTasksRead,
+	"POST /workspaces/{workspaceID}/leave":                                      scopeTasksWrite,
+	"POST /workspaces/{workspaceID}/invitations":                                scopeTasksWrite,
+	"DELETE /workspaces/{workspaceID}/members/{userID}":                         scopeTasksWrite,
+	"POST /workspaces/{workspaceID}/task":                                       scopeTasksWrite,
+	"GET /workspaces/{workspaceID}/tasks":                                       scopeTasksRead,
+	"PATCH /workspaces/{workspaceID}/task/{taskID}":                             scopeTasksWrite,
+	"DELETE /workspaces/{workspaceID}/task/{taskID}":                            scopeTasksWrite,
+	"PATCH /workspaces/{workspaceID}/task/{taskID}/assign":                      scopeTasksWrite,
+	"PATCH /workspaces/{workspaceID}/task/{taskID}/unassign":                    scopeTasksWrite,
+	"GET /workspaces/{workspaceID}/task/{taskID}/history":                       scopeTasksRead,
+	"POST /workspaces/{workspaceID}/task/{taskID}/comments":                     scopeTasksWrite,
+	"GET /workspaces/{workspaceID}/task/{taskID}/comments":                      scopeTasksRead,
+	"PATCH /workspaces/{workspaceID}/task/{taskID}/comments/{commentID}":        scopeTasksWrite,
+	"DELETE /workspaces/{workspaceID}/task/{taskID}/comments/{commentID}":       scopeTasksWrite,
+	"POST /workspaces/{workspaceID}/task/{taskID}/reminders":                    scopeTasksWrite,
+	"GET /workspaces/{workspaceID}/task/{taskID}/reminders":                     scopeTasksRead,
+	"DELETE /workspaces/{workspaceID}/task/{taskID}/reminders/{reminderID}":     scopeTasksWrite,
+	"POST /workspaces/{workspaceID}/task/{taskID}/attachments":                  scopeTasksWrite,
+	"GET /workspaces/{workspaceID}/task/{taskID}/attachments":                   scopeTasksRead,
+	"GET /workspaces/{workspaceID}/task/{taskID}/attachments/{attachmentID}":    scopeTasksRead,
+	"DELETE /workspaces/{workspaceID}/task/{taskID}/attachments/{attachmentID}": scopeTasksWrite,
+}
+
+// handleCreateAPIToken handles the "POST /api-tokens" endpoint and creates a
+// new personal access token for the user. The token is returned only once.
+func (s *WebServer) handleCreateAPIToken(res http.ResponseWriter, req *http.Request) {
+	form := new(createAPITokenRequest)
+	if !s.readPostBody(res, req, &form) {
+		return
+	}
+
+	err := form.Validate()
+	if err != nil {
+		s.writeBadRequest(res, err.Error())
+		return
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("randomToken error: %w", err))
+		return
+	}
+	token = apiTokenPrefix + token
+
+	userID := s.reqUserID(req)
+	expiry := time.Duration(form.ExpiresInDays) * 24 * time.Hour
+	apiToken, err := s.taskDB.CreateAPIToken(userID, form.Name, token, form.Scopes, expiry)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.CreateAPIToken error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"token":    token,
+		"apiToken": apiToken,
+		"message":  "Api token created. Store it safely, it will not be shown again.",
+	})
+}
+
+// handleRetrieveAPITokens handles the "GET /api-tokens" endpoint and returns
+// all the user's unexpired personal access tokens.
+func (s *WebServer) handleRetrieveAPITokens(res http.ResponseWriter, req *http.Request) {
+	userID := s.reqUserID(req)
+	apiTokens, err := s.taskDB.APITokens(userID)
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("taskDB.APITokens error: %w", err))
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"apiTokens": apiTokens,
+	})
+}
+
+// handleRevokeAPIToken handles the "DELETE /api-tokens/{tokenID}" endpoint and
+// revokes one of the user's personal access tokens.
+func (s *WebServer) handleRevokeAPIToken(res http.ResponseWriter, req *http.Request) {
+	tokenID := chi.URLParam(req, "tokenID")
+	userID := s.reqUserID(req)
+	err := s.taskDB.RevokeAPIToken(userID, tokenID)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.RevokeAPIToken error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]string{
+		"message": "Api token revoked.",
+	})
+}
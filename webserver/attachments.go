@@ -0,0 +1,254 @@
+package webserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ukane-philemon/megtask/db"
+)
+
+const (
+	// defaultMaxAttachmentSize is the default maximum size of an attached
+	// file.
+	defaultMaxAttachmentSize = 10 << 20 // 10MB
+	// defaultAttachmentQuota is the default total size of the files a user
+	// can attach.
+	defaultAttachmentQuota = 100 << 20 // 100MB
+	// maxAttachmentMemory is the size of an uploaded file that is kept in
+	// memory. Larger files are saved to a temporary file while they are
+	// processed.
+	maxAttachmentMemory = 1 << 20 // 1MB
+	// attachmentTransferTimeout replaces the server's read and write
+	// timeouts when a file is uploaded or downloaded.
+	attachmentTransferTimeout = 5 * time.Minute
+	// maxAttachmentFilenameLength is the maximum length of the name of an
+	// attached file.
+	maxAttachmentFilenameLength = 255
+)
+
+// handleUploadAttachment handles the "POST /task/{taskID}/attachments"
+// endpoint and attaches a file to a task. The file must be uploaded as the
+// "file" field of a multipart/form-data body.
+func (s *WebServer) handleUploadAttachment(res http.ResponseWriter, req *http.Request) {
+	s.extendDeadlines(res)
+
+	// Allow some room for the multipart boundaries and headers.
+	req.Body = http.MaxBytesReader(res, req.Body, s.maxAttachmentSize+maxAttachmentMemory)
+	err := req.ParseMultipartForm(maxAttachmentMemory)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			s.writeBadRequest(res, fmt.Sprintf("file is larger than the maximum size of %d bytes", s.maxAttachmentSize))
+		} else {
+			s.writeBadRequest(res, "invalid multipart form: "+err.Error())
+		}
+		return
+	}
+	defer req.MultipartForm.RemoveAll()
+
+	file, header, err := req.FormFile("file")
+	if err != nil {
+		s.writeBadRequest(res, "missing file")
+		return
+	}
+	defer file.Close()
+
+	filename, err := attachmentFilename(header)
+	if err != nil {
+		s.writeBadRequest(res, err.Error())
+		return
+	}
+
+	if header.Size == 0 {
+		s.writeBadRequest(res, "file is empty")
+		return
+	}
+
+	if header.Size > s.maxAttachmentSize {
+		s.writeBadRequest(res, fmt.Sprintf("file is larger than the maximum size of %d bytes", s.maxAttachmentSize))
+		return
+	}
+
+	// The content type provided by the client is not trusted.
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		s.writeServerError(res, fmt.Errorf("failed to read uploaded file: %w", err))
+		return
+	}
+	contentType := http.DetectContentType(sniff[:n])
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("failed to read uploaded file: %w", err))
+		return
+	}
+
+	taskID := chi.URLParam(req, "taskID")
+	userID := s.reqUserID(req)
+	attachment, err := s.taskDB.CreateAttachment(userID, taskID, filename, contentType, header.Size, s.attachmentQuota)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.CreateAttachment error: %w", err))
+		}
+		return
+	}
+
+	err = s.blobStore.PutBlob(req.Context(), attachmentBlobKey(attachment.ID), file, attachment.Size, attachment.ContentType)
+	if err != nil {
+		if delErr := s.taskDB.DeleteAttachment(userID, taskID, attachment.ID); delErr != nil {
+			s.log.Error("failed to delete attachment after failed upload: ", "error", delErr)
+		}
+		s.writeServerError(res, fmt.Errorf("blobStore.PutBlob error: %w", err))
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"attachment": attachment,
+	})
+}
+
+// handleRetrieveAttachments handles the "GET /task/{taskID}/attachments"
+// endpoint and returns information about the files attached to a task.
+func (s *WebServer) handleRetrieveAttachments(res http.ResponseWriter, req *http.Request) {
+	taskID := chi.URLParam(req, "taskID")
+	userID := s.reqUserID(req)
+	attachments, err := s.taskDB.Attachments(userID, taskID)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.Attachments error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"attachments": attachments,
+	})
+}
+
+// handleDownloadAttachment handles the
+// "GET /task/{taskID}/attachments/{attachmentID}" endpoint and streams the
+// content of a file attached to a task.
+func (s *WebServer) handleDownloadAttachment(res http.ResponseWriter, req *http.Request) {
+	taskID := chi.URLParam(req, "taskID")
+	attachmentID := chi.URLParam(req, "attachmentID")
+	userID := s.reqUserID(req)
+	attachment, err := s.taskDB.Attachment(userID, taskID, attachmentID)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.Attachment error: %w", err))
+		}
+		return
+	}
+
+	blob, err := s.blobStore.GetBlob(req.Context(), attachmentBlobKey(attachment.ID))
+	if err != nil {
+		if errors.Is(err, ErrBlobNotFound) {
+			s.writeJSONResponse(res, http.StatusNotFound, map[string]string{"errorMessage": "attachment content not found"})
+		} else {
+			s.writeServerError(res, fmt.Errorf("blobStore.GetBlob error: %w", err))
+		}
+		return
+	}
+	defer blob.Close()
+
+	s.extendDeadlines(res)
+
+	// Files are always downloaded so browsers never render uploaded content
+	// as part of the API's origin.
+	res.Header().Set("Content-Type", attachment.ContentType)
+	res.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	res.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	res.Header().Set("X-Content-Type-Options", "nosniff")
+	res.WriteHeader(http.StatusOK)
+
+	_, err = io.Copy(res, blob)
+	if err != nil {
+		s.log.Error("failed to write attachment: ", "error", err)
+	}
+}
+
+// handleDeleteAttachment handles the
+// "DELETE /task/{taskID}/attachments/{attachmentID}" endpoint and deletes a
+// file attached to a task.
+func (s *WebServer) handleDeleteAttachment(res http.ResponseWriter, req *http.Request) {
+	taskID := chi.URLParam(req, "taskID")
+	attachmentID := chi.URLParam(req, "attachmentID")
+	userID := s.reqUserID(req)
+	err := s.taskDB.DeleteAttachment(userID, taskID, attachmentID)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.DeleteAttachment error: %w", err))
+		}
+		return
+	}
+
+	s.deleteAttachmentBlobs(req.Context(), attachmentID)
+
+	s.writeSuccess(res, map[string]string{
+		"message": "Attachment deleted.",
+	})
+}
+
+// deleteAttachmentBlobs deletes the content of the attachments with the
+// provided IDs. Failures are logged since the attachments have already been
+// deleted.
+func (s *WebServer) deleteAttachmentBlobs(ctx context.Context, attachmentIDs ...string) {
+	for _, attachmentID := range attachmentIDs {
+		err := s.blobStore.DeleteBlob(ctx, attachmentBlobKey(attachmentID))
+		if err != nil {
+			s.log.Error("blobStore.DeleteBlob error: ", "attachmentID", attachmentID, "error", err)
+		}
+	}
+}
+
+// extendDeadlines replaces the server's read and write timeouts for the
+// current request so large files can be transferred.
+func (s *WebServer) extendDeadlines(res http.ResponseWriter) {
+	deadline := time.Now().Add(attachmentTransferTimeout)
+	rc := http.NewResponseController(res)
+	if err := rc.SetReadDeadline(deadline); err != nil {
+		s.log.Error("failed to extend read deadline: ", "error", err)
+	}
+	if err := rc.SetWriteDeadline(deadline); err != nil {
+		s.log.Error("failed to extend write deadline: ", "error", err)
+	}
+}
+
+// attachmentFilename returns the base name of an uploaded file.
+func attachmentFilename(header *multipart.FileHeader) (string, error) {
+	filename := strings.TrimSpace(filepath.Base(strings.ReplaceAll(header.Filename, "\\", "/")))
+	if filename == "" || filename == "." || filename == "/" {
+		return "", errors.New("missing file name")
+	}
+
+	if len(filename) > maxAttachmentFilenameLength {
+		return "", fmt.Errorf("file name is longer than %d characters", maxAttachmentFilenameLength)
+	}
+
+	return filename, nil
+}
+
+// attachmentBlobKey returns the key of the blob that holds the content of the
+// attachment with the provided ID.
+func attachmentBlobKey(attachmentID string) string {
+	return "attachments/" + attachmentID
+}
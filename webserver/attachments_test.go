@@ -0,0 +1,159 @@
+package webserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+// attachmentDB is a TaskDatabase for a user that has already attached usage
+// bytes of files. It keeps the last attachment it created.
+type attachmentDB struct {
+	workspaceDB
+	usage      int64
+	attachment **db.Attachment
+}
+
+func (adb attachmentDB) CreateAttachment(userID, taskID, filename, contentType string, size, quota int64) (*db.Attachment, error) {
+	if adb.usage+size > quota {
+		return nil, fmt.Errorf("%w: attachment storage quota exceeded", db.ErrorInvalidRequest)
+	}
+	*adb.attachment = &db.Attachment{ID: "attachment", TaskID: taskID, UploaderID: userID, Filename: filename, ContentType: contentType, Size: size}
+	return *adb.attachment, nil
+}
+
+func (adb attachmentDB) Attachment(userID, taskID, attachmentID string) (*db.Attachment, error) {
+	if *adb.attachment == nil {
+		return nil, db.ErrorInvalidRequest
+	}
+	return *adb.attachment, nil
+}
+
+// uploadRequest returns a request that uploads content as the "file" field of
+// a multipart form with the provided content type.
+func uploadRequest(t *testing.T, path, authToken, filename, contentType string, content []byte) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, filename))
+	header.Set("Content-Type", contentType)
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		t.Fatalf("CreatePart error: %v", err)
+	}
+	part.Write(content)
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, path, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+authToken)
+	return req
+}
+
+func TestUploadAttachment(t *testing.T) {
+	const (
+		maxSize = 1 << 10
+		quota   = 4 << 10
+	)
+
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 100)...)
+	html := []byte("<!DOCTYPE html><html><script>alert(1)</script></html>")
+
+	tests := []struct {
+		name string
+		// usage is the size of the files the user has already attached.
+		usage           int64
+		filename        string
+		contentType     string
+		content         []byte
+		wantStatus      int
+		wantContentType string
+	}{
+		{"png", 0, "image.png", "image/png", png, http.StatusOK, "image/png"},
+		{"png sent as html", 0, "page.html", "text/html", png, http.StatusOK, "image/png"},
+		{"html sent as png", 0, "image.png", "image/png", html, http.StatusOK, "text/html; charset=utf-8"},
+		{"text", 0, "notes.txt", "application/octet-stream", []byte("notes"), http.StatusOK, "text/plain; charset=utf-8"},
+		{"file of the maximum size", 0, "notes.txt", "text/plain", bytes.Repeat([]byte("a"), maxSize), http.StatusOK, "text/plain; charset=utf-8"},
+		{"file over the maximum size", 0, "notes.txt", "text/plain", bytes.Repeat([]byte("a"), maxSize+1), http.StatusBadRequest, ""},
+		{"body over the maximum size", 0, "notes.txt", "text/plain", bytes.Repeat([]byte("a"), maxSize+maxAttachmentMemory+1), http.StatusBadRequest, ""},
+		{"empty file", 0, "notes.txt", "text/plain", nil, http.StatusBadRequest, ""},
+		{"missing file name", 0, "", "text/plain", []byte("notes"), http.StatusBadRequest, ""},
+		{"quota used", quota - 5, "notes.txt", "text/plain", []byte("notes"), http.StatusOK, "text/plain; charset=utf-8"},
+		{"quota exceeded", quota - 4, "notes.txt", "text/plain", []byte("notes"), http.StatusBadRequest, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			adb := attachmentDB{
+				workspaceDB: workspaceDB{
+					authDB:         authDB{roles: map[string]string{"user": db.RoleUser}},
+					taskWorkspaces: map[string]string{"task": ""},
+				},
+				usage:      test.usage,
+				attachment: new(*db.Attachment),
+			}
+			blobStore := newMemBlobStore()
+			s := newTestServer(t, adb, &Config{BlobStore: blobStore, MaxAttachmentSize: maxSize, AttachmentQuota: quota})
+
+			token, err := s.jwtManager.GenerateJWtToken("user", db.RoleUser, "session", time.Minute)
+			if err != nil {
+				t.Fatalf("GenerateJWtToken error: %v", err)
+			}
+
+			res := httptest.NewRecorder()
+			s.mux.ServeHTTP(res, uploadRequest(t, "/task/task/attachments", token, test.filename, test.contentType, test.content))
+			checkStatus(t, res, test.wantStatus)
+
+			blob, stored := blobStore.blobs[attachmentBlobKey("attachment")]
+			if test.wantStatus != http.StatusOK {
+				if stored {
+					t.Fatal("want no blob stored for a rejected upload")
+				}
+				return
+			}
+
+			if !bytes.Equal(blob, test.content) {
+				t.Fatalf("want blob of %d bytes, got %d bytes", len(test.content), len(blob))
+			}
+
+			var body struct {
+				Attachment *db.Attachment `json:"attachment"`
+			}
+			if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+				t.Fatalf("json.Unmarshal error: %v", err)
+			}
+			if body.Attachment.ContentType != test.wantContentType || body.Attachment.Size != int64(len(test.content)) {
+				t.Fatalf("want %s attachment of %d bytes, got %s of %d bytes", test.wantContentType, len(test.content), body.Attachment.ContentType, body.Attachment.Size)
+			}
+
+			// Downloads use the detected content type and are never rendered
+			// by browsers.
+			res = testRequest(t, s, http.MethodGet, "/task/task/attachments/attachment", token, nil)
+			checkStatus(t, res, http.StatusOK)
+			if got := res.Header().Get("Content-Type"); got != test.wantContentType {
+				t.Fatalf("want download content type %s, got %s", test.wantContentType, got)
+			}
+			if res.Header().Get("X-Content-Type-Options") != "nosniff" {
+				t.Fatal("missing X-Content-Type-Options: nosniff header")
+			}
+			disposition, params, err := mime.ParseMediaType(res.Header().Get("Content-Disposition"))
+			if err != nil || disposition != "attachment" || params["filename"] != test.filename {
+				t.Fatalf("want attachment disposition of %s, got %s", test.filename, res.Header().Get("Content-Disposition"))
+			}
+			if !bytes.Equal(res.Body.Bytes(), test.content) {
+				t.Fatal("downloaded content does not match the upload")
+			}
+		})
+	}
+}
@@ -4,14 +4,46 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ukane-philemon/megtask/db"
 )
 
+const (
+	// passwordResetTokenExpiry is how long a password reset token remains
+	// valid.
+	passwordResetTokenExpiry = 30 * time.Minute
+	// emailVerificationTokenExpiry is how long an email verification token
+	// remains valid.
+	emailVerificationTokenExpiry = 24 * time.Hour
+
+	// verificationTokenQueryKey is the expected query key to provide an email
+	// verification token.
+	verificationTokenQueryKey = "token"
+
+	// maxAccountEmailsPerAddress is the number of account emails (e.g
+	// password reset emails) that can be requested for an email address
+	// within accountEmailsWindow. Further requests are accepted but no email
+	// is sent, so the response does not reveal whether an account exists.
+	maxAccountEmailsPerAddress = 3
+	// maxAccountEmailsPerIP is the number of account emails that can be
+	// requested from an IP address within accountEmailsWindow.
+	maxAccountEmailsPerIP = 20
+	// accountEmailsWindow is how long account email requests are counted
+	// after the last request.
+	accountEmailsWindow = time.Hour
+	// maxPendingAccountEmails is the number of account emails that can be
+	// sent in the background at the same time.
+	maxPendingAccountEmails = 16
+)
+
 // handleCreateAccount handles the "POST /create-account" endpoint and creates a
 // new user account.
 func (s *WebServer) handleCreateAccount(res http.ResponseWriter, req *http.Request) {
-	form := new(usernameAndPassword)
+	form := new(createAccountRequest)
 	if !s.readPostBody(res, req, &form) {
 		return
 	}
@@ -22,7 +54,16 @@ func (s *WebServer) handleCreateAccount(res http.ResponseWriter, req *http.Reque
 		return
 	}
 
-	err = s.taskDB.CreateAccount(form.Username, form.Password)
+	if s.requireEmailVerification && form.Email == "" {
+		s.writeBadRequest(res, "email is required")
+		return
+	}
+
+	if !s.validateNewPassword(res, form.Username, form.Password) {
+		return
+	}
+
+	err = s.taskDB.CreateAccount(form.Username, form.Password, form.Email)
 	if err != nil {
 		if errors.Is(err, db.ErrorInvalidRequest) {
 			s.writeBadRequest(res, err.Error())
@@ -32,15 +73,29 @@ func (s *WebServer) handleCreateAccount(res http.ResponseWriter, req *http.Reque
 		return
 	}
 
+	if form.Email == "" {
+		s.writeSuccess(res, map[string]string{
+			"message": "Account created successfully, proceed to login.",
+		})
+		return
+	}
+
+	// The account has been created, so failing to send the verification email
+	// is not fatal. The user can request a new verification email.
+	err = s.sendEmailVerification(form.Email)
+	if err != nil {
+		s.log.Error("failed to send email verification: ", "error", err)
+	}
+
 	s.writeSuccess(res, map[string]string{
-		"message": "Account created successfully, proceed to login.",
+		"message": "Account created successfully, check your email to verify your account.",
 	})
 }
 
 // handleLogin handles the "POST /login" endpoint and attempts to logs a user
 // into their account.
 func (s *WebServer) handleLogin(res http.ResponseWriter, req *http.Request) {
-	form := new(usernameAndPassword)
+	form := new(loginRequest)
 	if !s.readPostBody(res, req, &form) {
 		return
 	}
@@ -51,17 +106,91 @@ func (s *WebServer) handleLogin(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// The attempt is recorded as a failure before the password is checked,
+	// and refunded if the password is correct.
+	usernameKey, ipKey := usernameLoginKey(form.Username), ipLoginKey(req)
+	wait, err := s.loginThrottle.reserveAttempt(map[string]int{
+		usernameKey: s.loginThrottle.maxFailures,
+		ipKey:       s.loginThrottle.maxFailuresIP,
+	})
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("loginThrottle.reserveAttempt error: %w", err))
+		return
+	}
+
+	if wait > 0 {
+		s.writeTooManyRequests(res, wait)
+		return
+	}
+
 	userInfo, err := s.taskDB.Login(form.Username, form.Password)
 	if err != nil {
 		if errors.Is(err, db.ErrorInvalidRequest) {
 			s.writeBadRequest(res, err.Error())
 		} else {
+			if err := s.loginThrottle.refundAttempt(usernameKey, ipKey); err != nil {
+				s.log.Error("failed to refund login attempt: ", "error", err)
+			}
 			s.writeServerError(res, fmt.Errorf("taskDB.CreateAccount error: %w", err))
 		}
 		return
 	}
 
-	authToken, err := s.jwtManager.GenerateJWtToken(userInfo.ID)
+	// Failures for the username are reset, but only this attempt is refunded
+	// for the IP address so a successful login does not hide failed attempts
+	// from the same IP address for other usernames.
+	err = s.loginThrottle.store.ResetLoginAttempts(usernameKey)
+	if err != nil {
+		s.log.Error("failed to reset failed logins: ", "error", err)
+	}
+	err = s.loginThrottle.refundAttempt(ipKey)
+	if err != nil {
+		s.log.Error("failed to refund login attempt: ", "error", err)
+	}
+
+	s.completeLogin(res, req, userInfo, form.DeviceLabel)
+}
+
+// completeLogin applies the checks every login must pass once the user has
+// been authenticated with a password or an identity provider, and logs the
+// user in. Users with two-factor authentication enabled are sent a challenge
+// token instead, to be used with the "POST /login/2fa" endpoint.
+func (s *WebServer) completeLogin(res http.ResponseWriter, req *http.Request, userInfo *db.User, deviceLabel string) {
+	if s.requireEmailVerification && !userInfo.EmailVerified {
+		s.writeJSONResponse(res, http.StatusForbidden, map[string]string{
+			"errorMessage": "please verify your email before logging in",
+		})
+		return
+	}
+
+	if userInfo.TwoFactorEnabled {
+		challengeToken, err := s.jwtManager.GenerateChallengeToken(userInfo.ID)
+		if err != nil {
+			s.writeServerError(res, fmt.Errorf("jwtManager.GenerateChallengeToken error: %w", err))
+			return
+		}
+
+		s.writeSuccess(res, map[string]any{
+			"twoFactorRequired": true,
+			"challengeToken":    challengeToken,
+			"message":           "Provide a two-factor authentication code to complete login.",
+		})
+		return
+	}
+
+	s.writeLoginSuccess(res, req, userInfo, deviceLabel)
+}
+
+// writeLoginSuccess creates a login session and auth token for a user that has
+// been authenticated and writes it with the user's information.
+func (s *WebServer) writeLoginSuccess(res http.ResponseWriter, req *http.Request, userInfo *db.User, deviceLabel string) {
+	session, err := s.taskDB.CreateSession(userInfo.ID, deviceLabel, req.UserAgent(), reqIP(req), s.sessionExpiry)
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("taskDB.CreateSession error: %w", err))
+		return
+	}
+
+	authToken, err := s.jwtManager.GenerateJWtToken(userInfo.ID, userInfo.Role, session.ID, s.authTokenExpiry)
 	if err != nil {
 		s.writeServerError(res, fmt.Errorf("jwtManager.GenerateJWtToken error: %w", err))
 		return
@@ -73,3 +202,276 @@ func (s *WebServer) handleLogin(res http.ResponseWriter, req *http.Request) {
 		"message":   "Login successful.",
 	})
 }
+
+// handlePasswordResetRequest handles the "POST /password-reset/request"
+// endpoint and emails a password reset token to the owner of the provided
+// email if it has been verified. The same response is returned whether or not
+// an account exists for the email.
+func (s *WebServer) handlePasswordResetRequest(res http.ResponseWriter, req *http.Request) {
+	form := new(emailRequest)
+	if !s.readPostBody(res, req, &form) {
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(form.Email))
+	if validateEmail(email) != nil {
+		s.writeBadRequest(res, "a valid email is required")
+		return
+	}
+
+	if !s.queueAccountEmail(res, req, "password-reset", email, s.sendPasswordReset) {
+		return
+	}
+
+	s.writeSuccess(res, map[string]string{
+		"message": "If a verified account exists for this email, a password reset token has been sent to it.",
+	})
+}
+
+// queueAccountEmail sends an account email to the provided address with send
+// in the background, so the response time does not reveal whether an account
+// exists for the email. Requests are limited per email address and per IP
+// address for each kind of email. Returns false if a response has been
+// written because the IP address made too many requests.
+func (s *WebServer) queueAccountEmail(res http.ResponseWriter, req *http.Request, kind, email string, send func(email string) error) bool {
+	ipAttempts, err := s.loginThrottle.store.RecordLoginFailure(kind+":ip:"+reqIP(req), accountEmailsWindow)
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("loginThrottle.store.RecordLoginFailure error: %w", err))
+		return false
+	}
+
+	if ipAttempts.Failures > maxAccountEmailsPerIP {
+		res.Header().Set("Retry-After", strconv.Itoa(int(accountEmailsWindow.Seconds())))
+		s.writeJSONResponse(res, http.StatusTooManyRequests, map[string]string{
+			"errorMessage": "too many requests, please try again later",
+		})
+		return false
+	}
+
+	emailAttempts, err := s.loginThrottle.store.RecordLoginFailure(kind+":email:"+email, accountEmailsWindow)
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("loginThrottle.store.RecordLoginFailure error: %w", err))
+		return false
+	}
+
+	if emailAttempts.Failures > maxAccountEmailsPerAddress {
+		return true
+	}
+
+	// Emails are dropped instead of queued while too many are being sent so
+	// requests cannot start an unbounded number of goroutines.
+	select {
+	case s.accountEmails <- struct{}{}:
+	default:
+		s.log.Warn("too many pending account emails, dropping email: ", "kind", kind)
+		return true
+	}
+
+	go func() {
+		defer func() { <-s.accountEmails }()
+		err := send(email)
+		if err != nil && !errors.Is(err, db.ErrorInvalidRequest) {
+			s.log.Error("failed to send account email: ", "kind", kind, "error", err)
+		}
+	}()
+
+	return true
+}
+
+// sendPasswordReset creates a password reset token for the owner of the
+// provided email and emails it to them.
+func (s *WebServer) sendPasswordReset(email string) error {
+	token, err := randomToken()
+	if err != nil {
+		return fmt.Errorf("randomToken error: %w", err)
+	}
+
+	username, err := s.taskDB.CreatePasswordResetToken(email, token, passwordResetTokenExpiry)
+	if err != nil {
+		return fmt.Errorf("taskDB.CreatePasswordResetToken error: %w", err)
+	}
+
+	body := fmt.Sprintf("Hello %s,\n\nA password reset was requested for your Megtask account. "+
+		"Use the token below to set a new password. It expires in %s and can only be used once.\n\n%s\n\n"+
+		"If you did not request a password reset, you can ignore this email.\n", username, passwordResetTokenExpiry, token)
+
+	err = s.mailer.SendMail(email, "Reset your Megtask password", body)
+	if err != nil {
+		return fmt.Errorf("mailer.SendMail error: %w", err)
+	}
+
+	return nil
+}
+
+// handlePasswordResetConfirm handles the "POST /password-reset/confirm"
+// endpoint and sets a new password using a password reset token.
+func (s *WebServer) handlePasswordResetConfirm(res http.ResponseWriter, req *http.Request) {
+	form := new(confirmPasswordResetRequest)
+	if !s.readPostBody(res, req, &form) {
+		return
+	}
+
+	if form.Token == "" {
+		s.writeBadRequest(res, "missing password reset token")
+		return
+	}
+
+	username, err := s.taskDB.PasswordResetUsername(form.Token)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.PasswordResetUsername error: %w", err))
+		}
+		return
+	}
+
+	if !s.validateNewPassword(res, username, form.NewPassword) {
+		return
+	}
+
+	err = s.taskDB.ResetPassword(form.Token, form.NewPassword)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.ResetPassword error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]string{
+		"message": "Password has been reset successfully, proceed to login.",
+	})
+}
+
+// handleVerifyEmail handles the "GET /verify-email" endpoint and verifies the
+// email of the user that owns the "token" query parameter.
+func (s *WebServer) handleVerifyEmail(res http.ResponseWriter, req *http.Request) {
+	token := req.URL.Query().Get(verificationTokenQueryKey)
+	if token == "" {
+		s.writeBadRequest(res, "missing email verification token")
+		return
+	}
+
+	err := s.taskDB.VerifyEmail(token)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.VerifyEmail error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]string{
+		"message": "Email verified successfully, proceed to login.",
+	})
+}
+
+// handleResendEmailVerification handles the "POST /verify-email/resend"
+// endpoint and sends a new email verification token to an unverified email.
+// The same response is returned whether or not an account exists for the
+// email.
+func (s *WebServer) handleResendEmailVerification(res http.ResponseWriter, req *http.Request) {
+	form := new(emailRequest)
+	if !s.readPostBody(res, req, &form) {
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(form.Email))
+	if validateEmail(email) != nil {
+		s.writeBadRequest(res, "a valid email is required")
+		return
+	}
+
+	if !s.queueAccountEmail(res, req, "email-verification", email, s.sendEmailVerification) {
+		return
+	}
+
+	s.writeSuccess(res, map[string]string{
+		"message": "If an unverified account exists for this email, a verification link has been sent to it.",
+	})
+}
+
+// sendEmailVerification creates an email verification token for the owner of
+// the provided email and emails them a verification link.
+func (s *WebServer) sendEmailVerification(email string) error {
+	token, err := randomToken()
+	if err != nil {
+		return fmt.Errorf("randomToken error: %w", err)
+	}
+
+	username, err := s.taskDB.CreateEmailVerificationToken(email, token, emailVerificationTokenExpiry)
+	if err != nil {
+		return fmt.Errorf("taskDB.CreateEmailVerificationToken error: %w", err)
+	}
+
+	link := fmt.Sprintf("%s/verify-email?%s=%s", s.baseURL, verificationTokenQueryKey, url.QueryEscape(token))
+	body := fmt.Sprintf("Hello %s,\n\nPlease verify your email address for your Megtask account by opening the link below. "+
+		"The link expires in %s.\n\n%s\n\nIf you did not create a Megtask account, you can ignore this email.\n", username, emailVerificationTokenExpiry, link)
+
+	err = s.mailer.SendMail(email, "Verify your Megtask email", body)
+	if err != nil {
+		return fmt.Errorf("mailer.SendMail error: %w", err)
+	}
+
+	return nil
+}
+
+// handleChangePassword handles the "POST /change-password" endpoint and
+// changes the password of the logged in user. The user's other login sessions
+// are revoked.
+func (s *WebServer) handleChangePassword(res http.ResponseWriter, req *http.Request) {
+	form := new(changePasswordRequest)
+	if !s.readPostBody(res, req, &form) {
+		return
+	}
+
+	if form.CurrentPassword == "" {
+		s.writeBadRequest(res, "missing current password")
+		return
+	}
+
+	userID := s.reqUserID(req)
+	user, err := s.taskDB.UserSummary(userID)
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("taskDB.UserSummary error: %w", err))
+		return
+	}
+
+	if !s.validateNewPassword(res, user.Username, form.NewPassword) {
+		return
+	}
+
+	err = s.taskDB.ChangePassword(userID, form.CurrentPassword, form.NewPassword, s.reqSessionID(req))
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.ChangePassword error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]string{
+		"message": "Password changed successfully. Your other sessions have been logged out.",
+	})
+}
+
+// validateNewPassword checks that a new password satisfies the server's
+// password policy and writes a bad request response if it does not.
+func (s *WebServer) validateNewPassword(res http.ResponseWriter, username, password string) bool {
+	violation, err := s.passwordPolicy.validate(username, password)
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("passwordPolicy.validate error: %w", err))
+		return false
+	}
+
+	if violation != "" {
+		s.writeBadRequest(res, violation)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,289 @@
+package webserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+// accountEmailDB is a TaskDatabase that issues password reset and email
+// verification tokens for any email.
+type accountEmailDB struct {
+	TaskDatabase
+}
+
+func (accountEmailDB) CreatePasswordResetToken(email, token string, expiry time.Duration) (string, error) {
+	return "user", nil
+}
+
+func (accountEmailDB) CreateEmailVerificationToken(email, token string, expiry time.Duration) (string, error) {
+	return "user", nil
+}
+
+func TestPasswordResetRequestLimits(t *testing.T) {
+	mailer := &testMailer{sentChan: make(chan testEmail, 100)}
+	s := newTestServer(t, accountEmailDB{}, &Config{Mailer: mailer})
+
+	tests := []struct {
+		name       string
+		email      string
+		requests   int
+		wantStatus int
+		wantEmails int
+	}{{
+		name:       "under the email limit",
+		email:      "a@example.com",
+		requests:   maxAccountEmailsPerAddress,
+		wantStatus: http.StatusOK,
+		wantEmails: maxAccountEmailsPerAddress,
+	}, {
+		name:       "over the email limit is accepted but not sent",
+		email:      "a@example.com",
+		requests:   2,
+		wantStatus: http.StatusOK,
+		wantEmails: 0,
+	}, {
+		name:       "other emails are not limited by the first",
+		email:      "b@example.com",
+		requests:   1,
+		wantStatus: http.StatusOK,
+		wantEmails: 1,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for i := 0; i < test.requests; i++ {
+				res := testRequest(t, s, http.MethodPost, "/password-reset/request", "", map[string]string{"email": test.email})
+				checkStatus(t, res, test.wantStatus)
+			}
+
+			for i := 0; i < test.wantEmails; i++ {
+				select {
+				case email := <-mailer.sentChan:
+					if email.to != test.email {
+						t.Fatalf("want email sent to %s, got %s", test.email, email.to)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("want %d emails, got %d", test.wantEmails, i)
+				}
+			}
+
+			select {
+			case email := <-mailer.sentChan:
+				t.Fatalf("unexpected email to %s", email.to)
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+
+	// All the requests above were made from the same IP address.
+	made := maxAccountEmailsPerAddress + 3
+	for i := made; i < maxAccountEmailsPerIP; i++ {
+		res := testRequest(t, s, http.MethodPost, "/password-reset/request", "", map[string]string{"email": "c@example.com"})
+		checkStatus(t, res, http.StatusOK)
+	}
+	res := testRequest(t, s, http.MethodPost, "/password-reset/request", "", map[string]string{"email": "d@example.com"})
+	checkStatus(t, res, http.StatusTooManyRequests)
+	if res.Header().Get("Retry-After") == "" {
+		t.Fatal("missing Retry-After header")
+	}
+}
+
+// resetDB is a TaskDatabase with the password reset tokens in tokens, which
+// maps tokens to the usernames they were issued to. Passwords reset with a
+// token are saved in passwords.
+type resetDB struct {
+	TaskDatabase
+	tokens    map[string]string
+	passwords map[string]string
+}
+
+func (rdb resetDB) PasswordResetUsername(token string) (string, error) {
+	username, ok := rdb.tokens[token]
+	if !ok {
+		return "", fmt.Errorf("%w: invalid or expired token", db.ErrorInvalidRequest)
+	}
+	return username, nil
+}
+
+func (rdb resetDB) ResetPassword(token, newPassword string) error {
+	rdb.passwords[token] = newPassword
+	return nil
+}
+
+func TestPasswordResetConfirm(t *testing.T) {
+	rdb := resetDB{tokens: map[string]string{"token": "user"}, passwords: make(map[string]string)}
+	s := newTestServer(t, rdb, nil)
+
+	tests := []struct {
+		name         string
+		token        string
+		newPassword  string
+		wantStatus   int
+		wantPassword bool
+	}{
+		{"missing token", "", "new-password", http.StatusBadRequest, false},
+		{"invalid token", "other", "new-password", http.StatusBadRequest, false},
+		{"password too short", "token", "short", http.StatusBadRequest, false},
+		{"new password", "token", "new-password", http.StatusOK, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			delete(rdb.passwords, test.token)
+
+			res := testRequest(t, s, http.MethodPost, "/password-reset/confirm", "", map[string]string{"token": test.token, "newPassword": test.newPassword})
+			checkStatus(t, res, test.wantStatus)
+
+			if _, reset := rdb.passwords[test.token]; reset != test.wantPassword {
+				t.Fatalf("want password reset %v, got %v", test.wantPassword, reset)
+			}
+		})
+	}
+}
+
+// blockingEmailDB is a TaskDatabase that blocks creating email verification
+// tokens until release is closed.
+type blockingEmailDB struct {
+	TaskDatabase
+	release chan struct{}
+}
+
+func (bdb blockingEmailDB) CreateEmailVerificationToken(email, token string, expiry time.Duration) (string, error) {
+	<-bdb.release
+	return "user", nil
+}
+
+func TestResendEmailVerificationInBackground(t *testing.T) {
+	mailer := &testMailer{sentChan: make(chan testEmail, 1)}
+	db := blockingEmailDB{release: make(chan struct{})}
+	s := newTestServer(t, db, &Config{Mailer: mailer})
+
+	// The response must not wait for the database or the mailer, otherwise
+	// its timing reveals whether an unverified account exists.
+	res := testRequest(t, s, http.MethodPost, "/verify-email/resend", "", map[string]string{"email": "a@example.com"})
+	checkStatus(t, res, http.StatusOK)
+
+	close(db.release)
+	select {
+	case email := <-mailer.sentChan:
+		if email.to != "a@example.com" {
+			t.Fatalf("want email sent to a@example.com, got %s", email.to)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("verification email was not sent")
+	}
+}
+
+// verificationDB is a TaskDatabase that creates accounts and keeps the email
+// verification tokens it issues in tokens until they are used. Users log in
+// with an unverified email unless their username is "verified".
+type verificationDB struct {
+	TaskDatabase
+	mtx    *sync.Mutex
+	tokens map[string]string
+}
+
+func (verificationDB) CreateAccount(username, password, email string) error {
+	return nil
+}
+
+func (vdb verificationDB) CreateEmailVerificationToken(email, token string, expiry time.Duration) (string, error) {
+	vdb.mtx.Lock()
+	vdb.tokens[token] = email
+	vdb.mtx.Unlock()
+	return "user", nil
+}
+
+func (vdb verificationDB) VerifyEmail(token string) error {
+	vdb.mtx.Lock()
+	defer vdb.mtx.Unlock()
+	if _, ok := vdb.tokens[token]; !ok {
+		return fmt.Errorf("%w: invalid or expired token", db.ErrorInvalidRequest)
+	}
+	delete(vdb.tokens, token)
+	return nil
+}
+
+func (verificationDB) Login(username, password string) (*db.User, error) {
+	return &db.User{ID: "user", Username: username, EmailVerified: username == "verified"}, nil
+}
+
+func (verificationDB) CreateSession(userID, deviceLabel, userAgent, ip string, expiry time.Duration) (*db.Session, error) {
+	return &db.Session{ID: "session"}, nil
+}
+
+func TestCreateAccountEmailVerification(t *testing.T) {
+	tests := []struct {
+		name                     string
+		requireEmailVerification bool
+		email                    string
+		wantStatus               int
+		wantEmail                bool
+	}{
+		{"required email", true, "a@example.com", http.StatusOK, true},
+		{"missing required email", true, "", http.StatusBadRequest, false},
+		{"optional email", false, "a@example.com", http.StatusOK, true},
+		{"no email", false, "", http.StatusOK, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mailer := new(testMailer)
+			vdb := verificationDB{mtx: new(sync.Mutex), tokens: make(map[string]string)}
+			s := newTestServer(t, vdb, &Config{Mailer: mailer, RequireEmailVerification: test.requireEmailVerification})
+
+			res := testRequest(t, s, http.MethodPost, "/create-account", "", map[string]string{"username": "user", "password": "password", "email": test.email})
+			checkStatus(t, res, test.wantStatus)
+
+			if !test.wantEmail {
+				if len(mailer.sent) != 0 {
+					t.Fatalf("want no email, got %d", len(mailer.sent))
+				}
+				return
+			}
+
+			if len(mailer.sent) != 1 || mailer.sent[0].to != test.email {
+				t.Fatalf("want one verification email to %s, got %v", test.email, mailer.sent)
+			}
+
+			// The email links to the verification endpoint, and its token can
+			// only be used once.
+			_, link, found := strings.Cut(mailer.sent[0].body, s.baseURL)
+			if !found {
+				t.Fatalf("missing verification link: %s", mailer.sent[0].body)
+			}
+			link, _, _ = strings.Cut(link, "\n")
+			checkStatus(t, testRequest(t, s, http.MethodGet, link, "", nil), http.StatusOK)
+			checkStatus(t, testRequest(t, s, http.MethodGet, link, "", nil), http.StatusBadRequest)
+		})
+	}
+}
+
+func TestLoginEmailVerification(t *testing.T) {
+	tests := []struct {
+		name                     string
+		requireEmailVerification bool
+		username                 string
+		wantStatus               int
+	}{
+		{"verified email", true, "verified", http.StatusOK},
+		{"unverified email", true, "unverified", http.StatusForbidden},
+		{"verification not required", false, "unverified", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vdb := verificationDB{mtx: new(sync.Mutex), tokens: make(map[string]string)}
+			s := newTestServer(t, vdb, &Config{RequireEmailVerification: test.requireEmailVerification})
+
+			res := testRequest(t, s, http.MethodPost, "/login", "", map[string]string{"username": test.username, "password": "password"})
+			checkStatus(t, res, test.wantStatus)
+		})
+	}
+}
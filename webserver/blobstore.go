@@ -0,0 +1,25 @@
+package webserver
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrBlobNotFound is returned by a BlobStore if no blob has the requested
+// key.
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore stores the content of task attachments.
+type BlobStore interface {
+	// PutBlob saves size bytes read from r with the provided key, replacing
+	// any blob with the same key.
+	PutBlob(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// GetBlob returns the content of the blob with the provided key. The
+	// caller must close the returned reader. Returns ErrBlobNotFound if no
+	// blob has the key.
+	GetBlob(ctx context.Context, key string) (io.ReadCloser, error)
+	// DeleteBlob deletes the blob with the provided key. Deleting a blob that
+	// does not exist is not an error.
+	DeleteBlob(ctx context.Context, key string) error
+}
@@ -0,0 +1,886 @@
+package webserver
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ukane-philemon/megtask/db"
+)
+
+const (
+	caldavPath          = "/caldav"
+	caldavPrincipalPath = caldavPath + "/principal/"
+	caldavHomePath      = caldavPath + "/calendars/"
+
+	// defaultCalendarID is the ID of the calendar of the tasks that are not
+	// in a project.
+	defaultCalendarID   = "tasks"
+	defaultCalendarName = "Tasks"
+	// projectCalendarPrefix is added to the base64 encoded name of a project
+	// to get the ID of its calendar, so project names never clash with
+	// defaultCalendarID and are safe to use in URLs.
+	projectCalendarPrefix = "project-"
+	// calendarResourceExt is the extension of task resources.
+	calendarResourceExt = ".ics"
+
+	// maxCalDAVBodySize is the maximum size of a CalDAV request body.
+	maxCalDAVBodySize = 1 << 20
+
+	davNamespace            = "DAV:"
+	caldavNamespace         = "urn:ietf:params:xml:ns:caldav"
+	calendarServerNamespace = "http://calendarserver.org/ns/"
+)
+
+func init() {
+	// chi only routes the standard HTTP methods unless others are
+	// registered.
+	chi.RegisterMethod("PROPFIND")
+	chi.RegisterMethod("REPORT")
+}
+
+// caldavResourceKind is the kind of resource a CalDAV path refers to.
+type caldavResourceKind int
+
+const (
+	caldavRootKind caldavResourceKind = iota
+	caldavPrincipalKind
+	caldavHomeKind
+	caldavCalendarKind
+	caldavTaskKind
+)
+
+// caldavResource is the resource a CalDAV path refers to.
+type caldavResource struct {
+	kind caldavResourceKind
+	// calendarID and project are set for calendars and tasks.
+	calendarID string
+	project    string
+	// name is the name of a task resource without its extension.
+	name string
+}
+
+// parseCalDAVPath returns the resource path refers to. Returns false if path
+// does not refer to a CalDAV resource.
+func parseCalDAVPath(path string) (*caldavResource, bool) {
+	path = strings.TrimPrefix(path, caldavPath)
+	switch strings.TrimSuffix(path, "/") {
+	case "":
+		return &caldavResource{kind: caldavRootKind}, true
+	case strings.TrimSuffix(strings.TrimPrefix(caldavPrincipalPath, caldavPath), "/"):
+		return &caldavResource{kind: caldavPrincipalKind}, true
+	case strings.TrimSuffix(strings.TrimPrefix(caldavHomePath, caldavPath), "/"):
+		return &caldavResource{kind: caldavHomeKind}, true
+	}
+
+	path, found := strings.CutPrefix(path, strings.TrimPrefix(caldavHomePath, caldavPath))
+	if !found {
+		return nil, false
+	}
+
+	calendarID, name, _ := strings.Cut(path, "/")
+	project, ok := calendarProject(calendarID)
+	if !ok {
+		return nil, false
+	}
+
+	resource := &caldavResource{kind: caldavCalendarKind, calendarID: calendarID, project: project}
+	if name == "" {
+		return resource, true
+	}
+
+	name, found = strings.CutSuffix(name, calendarResourceExt)
+	if !found || !validCalendarResourceName(name) {
+		return nil, false
+	}
+
+	resource.kind = caldavTaskKind
+	resource.name = name
+	return resource, true
+}
+
+// calendarID returns the ID of the calendar of project.
+func calendarID(project string) string {
+	if project == "" {
+		return defaultCalendarID
+	}
+	return projectCalendarPrefix + base64.RawURLEncoding.EncodeToString([]byte(project))
+}
+
+// calendarProject returns the project of the calendar with the provided ID.
+// Returns false if the ID is invalid.
+func calendarProject(id string) (string, bool) {
+	if id == defaultCalendarID {
+		return "", true
+	}
+
+	encoded, found := strings.CutPrefix(id, projectCalendarPrefix)
+	if !found {
+		return "", false
+	}
+
+	project, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(project) == 0 || validateProject(string(project)) != nil {
+		return "", false
+	}
+
+	return string(project), true
+}
+
+// validCalendarResourceName returns true if name can be used as the name of
+// a task resource. Clients usually name resources after the UID of their
+// VTODO.
+func validCalendarResourceName(name string) bool {
+	if name == "" || len(name) > maxSyncClientIDLength {
+		return false
+	}
+
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.@+=", c)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// calendarResourceName returns the name of the resource of task.
+func calendarResourceName(task *db.Task) string {
+	if task.ClientID != "" {
+		return task.ClientID
+	}
+	return task.ID
+}
+
+// calendarTaskHref returns the path of the resource of task.
+func calendarTaskHref(task *db.Task) string {
+	return caldavHomePath + calendarID(task.Project) + "/" + calendarResourceName(task) + calendarResourceExt
+}
+
+// calendarTaskETag returns the entity tag of the resource of task, which
+// changes whenever the task is written.
+func calendarTaskETag(task *db.Task) string {
+	return `"` + strconv.FormatInt(task.UpdatedAt, 10) + `"`
+}
+
+// calendarTaskData returns the iCalendar object of task.
+func (s *WebServer) calendarTaskData(task *db.Task) []byte {
+	uid := task.ClientID
+	if uid == "" {
+		uid = task.ID + "@" + s.feedUIDDomain()
+	}
+
+	stamp := time.UnixMilli(task.UpdatedAt)
+	if task.UpdatedAt == 0 {
+		stamp = time.Unix(task.Timestamp, 0)
+	}
+
+	w := new(icsWriter)
+	w.begin()
+	w.task(task, icsComponentTodo, uid, stamp)
+	return w.end()
+}
+
+// caldavCalendar is a calendar collection and its tasks.
+type caldavCalendar struct {
+	id      string
+	project string
+	tasks   []*db.Task
+}
+
+// name returns the display name of the calendar.
+func (c *caldavCalendar) name() string {
+	if c.project == "" {
+		return defaultCalendarName
+	}
+	return c.project
+}
+
+// ctag returns a tag that changes whenever a task in the calendar is
+// created, written or deleted.
+func (c *caldavCalendar) ctag() string {
+	hash := sha256.New()
+	for _, task := range c.tasks {
+		fmt.Fprintf(hash, "%s:%d\n", task.ID, task.UpdatedAt)
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:16])
+}
+
+// userCalendars returns the calendars of the user with the provided userID:
+// the default calendar and a calendar for each of the projects of the user's
+// tasks.
+func (s *WebServer) userCalendars(userID string) ([]*caldavCalendar, error) {
+	tasks, err := s.taskDB.Tasks(userID)
+	if err != nil {
+		return nil, fmt.Errorf("taskDB.Tasks error: %w", err)
+	}
+
+	calendars := map[string]*caldavCalendar{
+		"": {id: defaultCalendarID},
+	}
+	for _, task := range tasks {
+		calendar := calendars[task.Project]
+		if calendar == nil {
+			calendar = &caldavCalendar{id: calendarID(task.Project), project: task.Project}
+			calendars[task.Project] = calendar
+		}
+		calendar.tasks = append(calendar.tasks, task)
+	}
+
+	sortedCalendars := make([]*caldavCalendar, 0, len(calendars))
+	for _, calendar := range calendars {
+		sortedCalendars = append(sortedCalendars, calendar)
+	}
+	sort.Slice(sortedCalendars, func(i, j int) bool {
+		return sortedCalendars[i].project < sortedCalendars[j].project
+	})
+
+	return sortedCalendars, nil
+}
+
+// userCalendar returns the calendar of project of the user with the provided
+// userID. The calendar of a project without tasks has no tasks.
+func (s *WebServer) userCalendar(userID, project string) (*caldavCalendar, error) {
+	calendars, err := s.userCalendars(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, calendar := range calendars {
+		if calendar.project == project {
+			return calendar, nil
+		}
+	}
+
+	return &caldavCalendar{id: calendarID(project), project: project}, nil
+}
+
+// davProp is a WebDAV property with its raw XML value.
+type davProp struct {
+	XMLName  xml.Name
+	InnerXML string `xml:",innerxml"`
+}
+
+// davProps are the properties of a resource, by name.
+type davProps map[xml.Name]string
+
+// davPropList is the content of a DAV:prop element.
+type davPropList struct {
+	Props []davProp
+}
+
+type davPropstat struct {
+	Prop   davPropList `xml:"DAV: prop"`
+	Status string      `xml:"DAV: status"`
+}
+
+type davResponse struct {
+	Href      string        `xml:"DAV: href"`
+	Propstats []davPropstat `xml:"DAV: propstat,omitempty"`
+	Status    string        `xml:"DAV: status,omitempty"`
+}
+
+type davMultistatus struct {
+	XMLName   xml.Name       `xml:"DAV: multistatus"`
+	Responses []*davResponse `xml:"DAV: response"`
+}
+
+// davPropNames are the names of the properties requested in a PROPFIND or
+// REPORT request.
+type davPropNames struct {
+	Names []struct {
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+type davPropfind struct {
+	Prop *davPropNames `xml:"DAV: prop"`
+}
+
+type caldavCompFilter struct {
+	Name    string             `xml:"name,attr"`
+	Filters []caldavCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+type caldavReport struct {
+	XMLName xml.Name
+	Prop    *davPropNames     `xml:"DAV: prop"`
+	Hrefs   []string          `xml:"DAV: href"`
+	Filter  *caldavCompFilter `xml:"urn:ietf:params:xml:ns:caldav filter>comp-filter"`
+}
+
+// matchesTodos returns true if a calendar-query filter matches VTODO
+// components. Property and time range filters are not applied, so clients
+// may receive more tasks than they asked for.
+func (f *caldavCompFilter) matchesTodos() bool {
+	if f == nil {
+		return true
+	}
+
+	if f.Name != "VCALENDAR" {
+		return false
+	}
+
+	for _, filter := range f.Filters {
+		if filter.Name != icsComponentTodo {
+			return false
+		}
+	}
+
+	return true
+}
+
+// response returns the response for a resource at href with props. Only the
+// requested properties are returned if names is not nil, and those that the
+// resource does not have are reported as not found.
+func (props davProps) response(href string, names *davPropNames) *davResponse {
+	var found, missing []davProp
+	if names == nil {
+		for name, value := range props {
+			found = append(found, davProp{XMLName: name, InnerXML: value})
+		}
+		sort.Slice(found, func(i, j int) bool {
+			return found[i].XMLName.Local < found[j].XMLName.Local
+		})
+	} else {
+		for _, name := range names.Names {
+			value, ok := props[name.XMLName]
+			if ok {
+				found = append(found, davProp{XMLName: name.XMLName, InnerXML: value})
+			} else {
+				missing = append(missing, davProp{XMLName: name.XMLName})
+			}
+		}
+	}
+
+	response := &davResponse{Href: href}
+	if len(found) > 0 {
+		response.Propstats = append(response.Propstats, davPropstat{Prop: davPropList{found}, Status: "HTTP/1.1 200 OK"})
+	}
+	if len(missing) > 0 {
+		response.Propstats = append(response.Propstats, davPropstat{Prop: davPropList{missing}, Status: "HTTP/1.1 404 Not Found"})
+	}
+	return response
+}
+
+// davHref returns the XML of a DAV:href element.
+func davHref(href string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(href))
+	return `<href xmlns="DAV:">` + b.String() + `</href>`
+}
+
+// davText returns s escaped as XML text.
+func davText(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// caldavProps returns the properties shared by all CalDAV resources.
+func (s *WebServer) caldavProps(req *http.Request, resourceType string) davProps {
+	privileges := `<privilege xmlns="DAV:"><read/></privilege>`
+	if reqHasScope(req, scopeTasksWrite) {
+		privileges += `<privilege xmlns="DAV:"><write/></privilege><privilege xmlns="DAV:"><write-content/></privilege><privilege xmlns="DAV:"><bind/></privilege><privilege xmlns="DAV:"><unbind/></privilege>`
+	}
+
+	return davProps{
+		{Space: davNamespace, Local: "resourcetype"}:               resourceType,
+		{Space: davNamespace, Local: "current-user-principal"}:     davHref(caldavPrincipalPath),
+		{Space: davNamespace, Local: "current-user-privilege-set"}: privileges,
+	}
+}
+
+// principalProps returns the properties of the root and principal resources.
+func (s *WebServer) principalProps(req *http.Request, kind caldavResourceKind) davProps {
+	resourceType := `<collection xmlns="DAV:"/>`
+	if kind == caldavPrincipalKind {
+		resourceType += `<principal xmlns="DAV:"/>`
+	}
+
+	props := s.caldavProps(req, resourceType)
+	props[xml.Name{Space: davNamespace, Local: "displayname"}] = "Megtask"
+	props[xml.Name{Space: davNamespace, Local: "principal-URL"}] = davHref(caldavPrincipalPath)
+	props[xml.Name{Space: caldavNamespace, Local: "calendar-home-set"}] = davHref(caldavHomePath)
+	return props
+}
+
+// calendarProps returns the properties of a calendar collection.
+func (s *WebServer) calendarProps(req *http.Request, calendar *caldavCalendar) davProps {
+	props := s.caldavProps(req, `<collection xmlns="DAV:"/><calendar xmlns="urn:ietf:params:xml:ns:caldav"/>`)
+	props[xml.Name{Space: davNamespace, Local: "displayname"}] = davText(calendar.name())
+	props[xml.Name{Space: calendarServerNamespace, Local: "getctag"}] = calendar.ctag()
+	props[xml.Name{Space: caldavNamespace, Local: "supported-calendar-component-set"}] = `<comp xmlns="urn:ietf:params:xml:ns:caldav" name="VTODO"/>`
+	props[xml.Name{Space: davNamespace, Local: "supported-report-set"}] = `<supported-report xmlns="DAV:"><report><calendar-query xmlns="urn:ietf:params:xml:ns:caldav"/></report></supported-report>` +
+		`<supported-report xmlns="DAV:"><report><calendar-multiget xmlns="urn:ietf:params:xml:ns:caldav"/></report></supported-report>`
+	return props
+}
+
+// taskProps returns the properties of a task resource. The task's iCalendar
+// object is only included if withData is true.
+func (s *WebServer) taskProps(req *http.Request, task *db.Task, withData bool) davProps {
+	props := s.caldavProps(req, "")
+	props[xml.Name{Space: davNamespace, Local: "getetag"}] = davText(calendarTaskETag(task))
+	props[xml.Name{Space: davNamespace, Local: "getcontenttype"}] = "text/calendar; charset=utf-8; component=VTODO"
+	if withData {
+		props[xml.Name{Space: caldavNamespace, Local: "calendar-data"}] = davText(string(s.calendarTaskData(task)))
+	}
+	return props
+}
+
+// readCalDAVBody decodes the XML body of req into v. An empty body leaves v
+// unchanged.
+func readCalDAVBody(req *http.Request, v any) error {
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxCalDAVBodySize))
+	if err != nil {
+		return fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return nil
+	}
+
+	err = xml.Unmarshal(body, v)
+	if err != nil {
+		return fmt.Errorf("invalid XML body: %w", err)
+	}
+
+	return nil
+}
+
+// writeMultistatus writes a WebDAV multi-status response.
+func (s *WebServer) writeMultistatus(res http.ResponseWriter, responses []*davResponse) {
+	body, err := xml.Marshal(&davMultistatus{Responses: responses})
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("xml.Marshal error: %w", err))
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	res.WriteHeader(http.StatusMultiStatus)
+	res.Write([]byte(xml.Header))
+	res.Write(body)
+}
+
+// writeCalDAVError writes a plain text error response, which CalDAV clients
+// can show to users.
+func (s *WebServer) writeCalDAVError(res http.ResponseWriter, code int, message string) {
+	http.Error(res, message, code)
+}
+
+// caldavAuthMiddleware authenticates CalDAV requests. CalDAV clients send
+// HTTP basic credentials, where the password is a personal access token. The
+// username is ignored. Clients are asked for credentials if none are sent or
+// they are invalid.
+func (s *WebServer) caldavAuthMiddleware(next http.Handler) http.Handler {
+	authed := s.authMiddleware(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Del("WWW-Authenticate")
+		next.ServeHTTP(res, req)
+	}))
+
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if _, password, ok := req.BasicAuth(); ok {
+			req.Header.Set("Authorization", "Bearer "+password)
+		}
+
+		res.Header().Set("WWW-Authenticate", `Basic realm="Megtask", charset="UTF-8"`)
+		authed.ServeHTTP(res, req)
+	})
+}
+
+// handleCalDAVWellKnown handles the "/.well-known/caldav" endpoint and
+// redirects CalDAV clients to the CalDAV root.
+func (s *WebServer) handleCalDAVWellKnown(res http.ResponseWriter, req *http.Request) {
+	http.Redirect(res, req, caldavPath+"/", http.StatusMovedPermanently)
+}
+
+// handleCalDAVOptions handles "OPTIONS /caldav/*" requests and reports the
+// CalDAV features the server supports.
+func (s *WebServer) handleCalDAVOptions(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("DAV", "1, 3, calendar-access")
+	res.Header().Set("Allow", "OPTIONS, GET, PUT, DELETE, PROPFIND, REPORT")
+	res.WriteHeader(http.StatusOK)
+}
+
+// handleCalDAVPropfind handles "PROPFIND /caldav/*" requests and returns the
+// properties of a resource and, unless the Depth header is "0", of its
+// children. Each project of the user is a calendar, and tasks that are not in
+// a project are in the "Tasks" calendar.
+func (s *WebServer) handleCalDAVPropfind(res http.ResponseWriter, req *http.Request) {
+	resource, ok := parseCalDAVPath(req.URL.Path)
+	if !ok {
+		s.writeCalDAVError(res, http.StatusNotFound, "resource not found")
+		return
+	}
+
+	form := new(davPropfind)
+	if err := readCalDAVBody(req, form); err != nil {
+		s.writeCalDAVError(res, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	withChildren := req.Header.Get("Depth") != "0"
+	userID := s.reqUserID(req)
+
+	var responses []*davResponse
+	switch resource.kind {
+	case caldavRootKind, caldavPrincipalKind:
+		href := caldavPath + "/"
+		if resource.kind == caldavPrincipalKind {
+			href = caldavPrincipalPath
+		}
+		responses = append(responses, s.principalProps(req, resource.kind).response(href, form.Prop))
+
+	case caldavHomeKind:
+		responses = append(responses, s.caldavProps(req, `<collection xmlns="DAV:"/>`).response(caldavHomePath, form.Prop))
+		if !withChildren {
+			break
+		}
+
+		calendars, err := s.userCalendars(userID)
+		if err != nil {
+			s.writeServerError(res, err)
+			return
+		}
+
+		for _, calendar := range calendars {
+			href := caldavHomePath + calendar.id + "/"
+			responses = append(responses, s.calendarProps(req, calendar).response(href, form.Prop))
+		}
+
+	case caldavCalendarKind:
+		calendar, err := s.userCalendar(userID, resource.project)
+		if err != nil {
+			s.writeServerError(res, err)
+			return
+		}
+
+		href := caldavHomePath + calendar.id + "/"
+		responses = append(responses, s.calendarProps(req, calendar).response(href, form.Prop))
+		if !withChildren {
+			break
+		}
+
+		for _, task := range calendar.tasks {
+			responses = append(responses, s.taskProps(req, task, false).response(calendarTaskHref(task), form.Prop))
+		}
+
+	case caldavTaskKind:
+		task, ok := s.calendarTask(res, userID, resource)
+		if !ok {
+			return
+		}
+		responses = append(responses, s.taskProps(req, task, false).response(calendarTaskHref(task), form.Prop))
+	}
+
+	s.writeMultistatus(res, responses)
+}
+
+// handleCalDAVReport handles "REPORT /caldav/calendars/{calendarID}/"
+// requests. The calendar-query report returns the tasks in the calendar and
+// the calendar-multiget report returns the requested tasks.
+func (s *WebServer) handleCalDAVReport(res http.ResponseWriter, req *http.Request) {
+	resource, ok := parseCalDAVPath(req.URL.Path)
+	if !ok || resource.kind != caldavCalendarKind {
+		s.writeCalDAVError(res, http.StatusNotFound, "calendar not found")
+		return
+	}
+
+	form := new(caldavReport)
+	if err := readCalDAVBody(req, form); err != nil {
+		s.writeCalDAVError(res, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	names := form.Prop
+	if names == nil {
+		names = &davPropNames{}
+		names.Names = append(names.Names, struct{ XMLName xml.Name }{xml.Name{Space: davNamespace, Local: "getetag"}})
+	}
+
+	withData := false
+	for _, name := range names.Names {
+		if name.XMLName == (xml.Name{Space: caldavNamespace, Local: "calendar-data"}) {
+			withData = true
+		}
+	}
+
+	calendar, err := s.userCalendar(s.reqUserID(req), resource.project)
+	if err != nil {
+		s.writeServerError(res, err)
+		return
+	}
+
+	responses := make([]*davResponse, 0)
+	switch {
+	case form.XMLName == xml.Name{Space: caldavNamespace, Local: "calendar-query"}:
+		if !form.Filter.matchesTodos() {
+			break
+		}
+		for _, task := range calendar.tasks {
+			responses = append(responses, s.taskProps(req, task, withData).response(calendarTaskHref(task), names))
+		}
+
+	case form.XMLName == xml.Name{Space: caldavNamespace, Local: "calendar-multiget"}:
+		tasks := make(map[string]*db.Task, len(calendar.tasks))
+		for _, task := range calendar.tasks {
+			tasks[calendarTaskHref(task)] = task
+		}
+
+		for _, href := range form.Hrefs {
+			task := tasks[strings.TrimSpace(href)]
+			if task == nil {
+				responses = append(responses, &davResponse{Href: href, Status: "HTTP/1.1 404 Not Found"})
+				continue
+			}
+			responses = append(responses, s.taskProps(req, task, withData).response(href, names))
+		}
+
+	default:
+		s.writeCalDAVError(res, http.StatusForbidden, "unsupported report")
+		return
+	}
+
+	s.writeMultistatus(res, responses)
+}
+
+// handleCalDAVGet handles "GET /caldav/calendars/{calendarID}/{name}.ics"
+// requests and returns a task as an iCalendar object with a VTODO.
+func (s *WebServer) handleCalDAVGet(res http.ResponseWriter, req *http.Request) {
+	resource, ok := parseCalDAVPath(req.URL.Path)
+	if !ok || resource.kind != caldavTaskKind {
+		s.writeCalDAVError(res, http.StatusNotFound, "resource not found")
+		return
+	}
+
+	task, ok := s.calendarTask(res, s.reqUserID(req), resource)
+	if !ok {
+		return
+	}
+
+	res.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	res.Header().Set("ETag", calendarTaskETag(task))
+	res.WriteHeader(http.StatusOK)
+	res.Write(s.calendarTaskData(task))
+}
+
+// handleCalDAVPut handles "PUT /caldav/calendars/{calendarID}/{name}.ics"
+// requests and creates or replaces a task from an iCalendar object with a
+// VTODO. The task is created in the calendar's project. The If-Match and
+// If-None-Match headers are supported so clients do not overwrite changes
+// they have not seen. Completed tasks cannot be changed.
+func (s *WebServer) handleCalDAVPut(res http.ResponseWriter, req *http.Request) {
+	resource, ok := parseCalDAVPath(req.URL.Path)
+	if !ok || resource.kind != caldavTaskKind {
+		s.writeCalDAVError(res, http.StatusNotFound, "resource not found")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(res, req.Body, maxCalDAVBodySize))
+	if err != nil {
+		s.writeCalDAVError(res, http.StatusRequestEntityTooLarge, "request body is too large")
+		return
+	}
+
+	todo, err := parseICSTodo(string(body))
+	if err != nil {
+		s.writeCalDAVError(res, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	info, err := todoTaskInfo(todo, resource.project)
+	if err != nil {
+		s.writeCalDAVError(res, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userID := s.reqUserID(req)
+	existing, err := s.taskDB.CalendarTask(userID, resource.name)
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("taskDB.CalendarTask error: %w", err))
+		return
+	}
+
+	if existing != nil && existing.Project != resource.project {
+		s.writeCalDAVError(res, http.StatusConflict, "the task is in another calendar")
+		return
+	}
+
+	ifMatch := req.Header.Get("If-Match")
+	if existing != nil && req.Header.Get("If-None-Match") == "*" ||
+		ifMatch != "" && (existing == nil || ifMatch != "*" && ifMatch != calendarTaskETag(existing)) {
+		s.writeCalDAVError(res, http.StatusPreconditionFailed, "the task has been changed")
+		return
+	}
+
+	if existing == nil {
+		task, err := s.taskDB.CreateCalendarTask(userID, resource.name, info)
+		if err != nil {
+			if errors.Is(err, db.ErrorInvalidRequest) {
+				s.writeCalDAVError(res, http.StatusPreconditionFailed, err.Error())
+			} else {
+				s.writeServerError(res, fmt.Errorf("taskDB.CreateCalendarTask error: %w", err))
+			}
+			return
+		}
+
+		s.publishTaskEvent(TaskCreatedEvent, task.ID, []*db.Task{task})
+		res.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	if existing.Completed {
+		if !sameTodoInfo(&existing.TaskInfo, info) {
+			s.writeCalDAVError(res, http.StatusForbidden, "completed tasks cannot be changed")
+			return
+		}
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	task, err := s.taskDB.UpdateCalendarTask(userID, existing.ID, existing.UpdatedAt, info)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeCalDAVError(res, http.StatusPreconditionFailed, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.UpdateCalendarTask error: %w", err))
+		}
+		return
+	}
+
+	s.publishTaskEvent(TaskUpdatedEvent, task.ID, []*db.Task{task})
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// handleCalDAVDelete handles "DELETE
+// /caldav/calendars/{calendarID}/{name}.ics" requests and deletes a task.
+func (s *WebServer) handleCalDAVDelete(res http.ResponseWriter, req *http.Request) {
+	resource, ok := parseCalDAVPath(req.URL.Path)
+	if !ok || resource.kind != caldavTaskKind {
+		s.writeCalDAVError(res, http.StatusNotFound, "resource not found")
+		return
+	}
+
+	userID := s.reqUserID(req)
+	task, ok := s.calendarTask(res, userID, resource)
+	if !ok {
+		return
+	}
+
+	if ifMatch := req.Header.Get("If-Match"); ifMatch != "" && ifMatch != "*" && ifMatch != calendarTaskETag(task) {
+		s.writeCalDAVError(res, http.StatusPreconditionFailed, "the task has been changed")
+		return
+	}
+
+	// The attachments and users of the task are retrieved before it is
+	// deleted, as they are not known afterwards.
+	var attachmentIDs []string
+	if s.blobStore != nil {
+		attachments, err := s.taskDB.Attachments(userID, task.ID)
+		if err != nil {
+			s.writeServerError(res, fmt.Errorf("taskDB.Attachments error: %w", err))
+			return
+		}
+
+		for _, attachment := range attachments {
+			attachmentIDs = append(attachmentIDs, attachment.ID)
+		}
+	}
+
+	audience, err := s.taskDB.TaskAudience(task.ID)
+	if err != nil && !errors.Is(err, db.ErrorInvalidRequest) {
+		s.log.Error("taskDB.TaskAudience error: ", "error", err)
+	}
+
+	_, err = s.taskDB.DeleteTask(userID, task.ID)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeCalDAVError(res, http.StatusNotFound, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.DeleteTask error: %w", err))
+		}
+		return
+	}
+
+	s.deleteAttachmentBlobs(req.Context(), attachmentIDs...)
+	s.publishEvent(TaskDeletedEvent, task.ID, nil, audience)
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// calendarTask returns the task resource refers to and writes a not found
+// response if it does not exist or is in another calendar.
+func (s *WebServer) calendarTask(res http.ResponseWriter, userID string, resource *caldavResource) (*db.Task, bool) {
+	task, err := s.taskDB.CalendarTask(userID, resource.name)
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("taskDB.CalendarTask error: %w", err))
+		return nil, false
+	}
+
+	if task == nil || task.Project != resource.project {
+		s.writeCalDAVError(res, http.StatusNotFound, "task not found")
+		return nil, false
+	}
+
+	return task, true
+}
+
+// todoTaskInfo returns the task information of todo in the calendar of
+// project. The project is removed from the todo's categories, which are
+// otherwise saved as the task's tags.
+func todoTaskInfo(todo *icsTodo, project string) (*db.TaskInfo, error) {
+	if strings.TrimSpace(todo.summary) == "" {
+		return nil, errors.New("the VTODO must have a SUMMARY")
+	}
+
+	if err := validateDueAt(todo.dueAt); err != nil {
+		return nil, err
+	}
+
+	categories := make([]string, 0, len(todo.categories))
+	for _, category := range todo.categories {
+		category = strings.TrimSpace(category)
+		if category != "" && category != project {
+			categories = append(categories, category)
+		}
+	}
+
+	tags, err := validateTags(categories)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateRecurrence(todo.recurrence); err != nil {
+		return nil, err
+	}
+
+	if todo.recurrence != "" && todo.dueAt == 0 {
+		return nil, errors.New("a recurring task must have a due date")
+	}
+
+	return &db.TaskInfo{
+		Detail:     todo.summary,
+		Completed:  todo.completed,
+		Project:    project,
+		DueAt:      todo.dueAt,
+		Tags:       tags,
+		Recurrence: todo.recurrence,
+	}, nil
+}
+
+// sameTodoInfo returns true if the fields of a task that can be written with
+// CalDAV are the same in a and b.
+func sameTodoInfo(a, b *db.TaskInfo) bool {
+	return a.Detail == b.Detail && a.Completed == b.Completed && a.DueAt == b.DueAt &&
+		strings.Join(a.Tags, ",") == strings.Join(b.Tags, ",") && a.Recurrence == b.Recurrence
+}
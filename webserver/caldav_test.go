@@ -0,0 +1,493 @@
+package webserver
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+const (
+	caldavReadToken  = apiTokenPrefix + "caldav-read"
+	caldavWriteToken = apiTokenPrefix + "caldav-write"
+)
+
+// caldavDB is a TaskDatabase with the tasks of "user": "uid-1" created by a
+// CalDAV client, "work" in the project "work" and the completed task "done".
+type caldavDB struct {
+	authDB
+}
+
+func (caldavDB) Tasks(userID string) ([]*db.Task, error) {
+	return []*db.Task{
+		{ID: "task1", ClientID: "uid-1", UpdatedAt: 100, TaskInfo: db.TaskInfo{Detail: "Buy milk", DueAt: 1735732800}},
+		{ID: "work", UpdatedAt: 200, TaskInfo: db.TaskInfo{Detail: "Standup", Project: "work"}},
+		{ID: "done", UpdatedAt: 300, TaskInfo: db.TaskInfo{Detail: "Call mum", Completed: true}},
+	}, nil
+}
+
+func (cdb caldavDB) CalendarTask(userID, name string) (*db.Task, error) {
+	tasks, _ := cdb.Tasks(userID)
+	for _, task := range tasks {
+		if calendarResourceName(task) == name {
+			return task, nil
+		}
+	}
+	return nil, nil
+}
+
+func (caldavDB) CreateCalendarTask(userID, name string, info *db.TaskInfo) (*db.Task, error) {
+	return &db.Task{ID: "new", ClientID: name, UpdatedAt: 1, TaskInfo: *info}, nil
+}
+
+func (caldavDB) UpdateCalendarTask(userID, taskID string, updatedAt int64, info *db.TaskInfo) (*db.Task, error) {
+	return &db.Task{ID: taskID, UpdatedAt: updatedAt + 1, TaskInfo: *info}, nil
+}
+
+func (caldavDB) DeleteTask(userID, taskID string) ([]*db.Task, error) {
+	return nil, nil
+}
+
+func (caldavDB) TaskAudience(taskID string) ([]string, error) {
+	return []string{"user"}, nil
+}
+
+// caldavRequest sends a CalDAV request to s authenticated with token as the
+// basic auth password, if it is not empty. body is sent as an iCalendar
+// object for PUT requests and as XML otherwise.
+func caldavRequest(t *testing.T, s *WebServer, method, path, token, body string, header map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		contentType := "application/xml; charset=utf-8"
+		if method == http.MethodPut {
+			contentType = "text/calendar; charset=utf-8"
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.SetBasicAuth("anyone", token)
+	}
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+
+	res := httptest.NewRecorder()
+	s.mux.ServeHTTP(res, req)
+	return res
+}
+
+// xmlnsAttr matches the namespace declarations of XML elements.
+var xmlnsAttr = regexp.MustCompile(` xmlns(:\w+)?="[^"]*"`)
+
+// vtodo returns an iCalendar object with a VTODO with the provided
+// properties.
+func vtodo(properties ...string) string {
+	lines := append([]string{"BEGIN:VCALENDAR", "VERSION:2.0", "BEGIN:VTODO"}, properties...)
+	lines = append(lines, "END:VTODO", "END:VCALENDAR", "")
+	return strings.Join(lines, "\r\n")
+}
+
+func TestCalDAV(t *testing.T) {
+	adb := authDB{scopes: map[string][]string{
+		caldavReadToken:  {scopeTasksRead},
+		caldavWriteToken: {scopeTasksRead, scopeTasksWrite},
+	}}
+	s := newTestServer(t, caldavDB{adb}, &Config{BaseURL: "https://tasks.example.com"})
+
+	tasksCalendar := caldavHomePath + defaultCalendarID + "/"
+	workCalendar := caldavHomePath + projectCalendarPrefix + base64.RawURLEncoding.EncodeToString([]byte("work")) + "/"
+	propfind := `<propfind xmlns="DAV:"><prop><displayname/><getetag/></prop></propfind>`
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		header     map[string]string
+		body       string
+		wantStatus int
+		// wantBody are parts of the response body.
+		wantBody []string
+		// unwantedBody are parts the response body must not contain.
+		unwantedBody []string
+	}{
+		{
+			name:       "no credentials",
+			method:     "PROPFIND",
+			path:       caldavHomePath,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "principal",
+			method:     "PROPFIND",
+			path:       caldavPrincipalPath,
+			token:      caldavReadToken,
+			header:     map[string]string{"Depth": "0"},
+			wantStatus: http.StatusMultiStatus,
+			wantBody:   []string{"<calendar-home-set><href>/caldav/calendars/</href></calendar-home-set>", "<principal/>"},
+		},
+		{
+			name:       "calendars",
+			method:     "PROPFIND",
+			path:       caldavHomePath,
+			token:      caldavReadToken,
+			header:     map[string]string{"Depth": "1"},
+			body:       propfind,
+			wantStatus: http.StatusMultiStatus,
+			wantBody:   []string{tasksCalendar, workCalendar, "<displayname>Tasks</displayname>", "<displayname>work</displayname>", "404 Not Found"},
+		},
+		{
+			name:         "read-only privileges",
+			method:       "PROPFIND",
+			path:         tasksCalendar,
+			token:        caldavReadToken,
+			header:       map[string]string{"Depth": "0"},
+			wantStatus:   http.StatusMultiStatus,
+			wantBody:     []string{"<read/>"},
+			unwantedBody: []string{"uid-1.ics", "<write/>"},
+		},
+		{
+			name:         "calendar tasks",
+			method:       "PROPFIND",
+			path:         tasksCalendar,
+			token:        caldavWriteToken,
+			body:         propfind,
+			wantStatus:   http.StatusMultiStatus,
+			wantBody:     []string{tasksCalendar + "uid-1.ics", tasksCalendar + "done.ics", "<getetag>&#34;100&#34;</getetag>"},
+			unwantedBody: []string{"work.ics"},
+		},
+		{
+			name:         "unknown calendar",
+			method:       "PROPFIND",
+			path:         caldavHomePath + "work/",
+			token:        caldavReadToken,
+			wantStatus:   http.StatusNotFound,
+			unwantedBody: []string{"multistatus"},
+		},
+		{
+			name:       "calendar query",
+			method:     "REPORT",
+			path:       workCalendar,
+			token:      caldavReadToken,
+			body:       `<calendar-query xmlns="urn:ietf:params:xml:ns:caldav" xmlns:D="DAV:"><D:prop><D:getetag/><calendar-data/></D:prop><filter><comp-filter name="VCALENDAR"><comp-filter name="VTODO"/></comp-filter></filter></calendar-query>`,
+			wantStatus: http.StatusMultiStatus,
+			wantBody:   []string{workCalendar + "work.ics", "SUMMARY:Standup", "UID:work@tasks.example.com"},
+		},
+		{
+			name:         "calendar query for events",
+			method:       "REPORT",
+			path:         workCalendar,
+			token:        caldavReadToken,
+			body:         `<calendar-query xmlns="urn:ietf:params:xml:ns:caldav"><filter><comp-filter name="VCALENDAR"><comp-filter name="VEVENT"/></comp-filter></filter></calendar-query>`,
+			wantStatus:   http.StatusMultiStatus,
+			unwantedBody: []string{"work.ics"},
+		},
+		{
+			name:       "calendar multiget",
+			method:     "REPORT",
+			path:       tasksCalendar,
+			token:      caldavReadToken,
+			body:       `<calendar-multiget xmlns="urn:ietf:params:xml:ns:caldav" xmlns:D="DAV:"><D:prop><calendar-data/></D:prop><D:href>` + tasksCalendar + `uid-1.ics</D:href><D:href>` + tasksCalendar + `gone.ics</D:href></calendar-multiget>`,
+			wantStatus: http.StatusMultiStatus,
+			wantBody:   []string{"UID:uid-1", "<href>" + tasksCalendar + "gone.ics</href><status>HTTP/1.1 404 Not Found</status>"},
+		},
+		{
+			name:       "unsupported report",
+			method:     "REPORT",
+			path:       tasksCalendar,
+			token:      caldavReadToken,
+			body:       `<free-busy-query xmlns="urn:ietf:params:xml:ns:caldav"/>`,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "get task",
+			method:     http.MethodGet,
+			path:       tasksCalendar + "uid-1.ics",
+			token:      caldavReadToken,
+			wantStatus: http.StatusOK,
+			wantBody:   []string{"BEGIN:VTODO", "UID:uid-1", "SUMMARY:Buy milk", "DUE:20250101T120000Z"},
+		},
+		{
+			name:       "get task from another calendar",
+			method:     http.MethodGet,
+			path:       tasksCalendar + "work.ics",
+			token:      caldavReadToken,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "create without write scope",
+			method:     http.MethodPut,
+			path:       tasksCalendar + "uid-2.ics",
+			token:      caldavReadToken,
+			body:       vtodo("UID:uid-2", "SUMMARY:Water plants"),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "create task",
+			method:     http.MethodPut,
+			path:       workCalendar + "uid-2.ics",
+			token:      caldavWriteToken,
+			header:     map[string]string{"If-None-Match": "*"},
+			body:       vtodo("UID:uid-2", "SUMMARY:Water plants", "CATEGORIES:work,home"),
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "create existing task",
+			method:     http.MethodPut,
+			path:       tasksCalendar + "uid-1.ics",
+			token:      caldavWriteToken,
+			header:     map[string]string{"If-None-Match": "*"},
+			body:       vtodo("UID:uid-1", "SUMMARY:Buy milk"),
+			wantStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:       "update task",
+			method:     http.MethodPut,
+			path:       tasksCalendar + "uid-1.ics",
+			token:      caldavWriteToken,
+			header:     map[string]string{"If-Match": `"100"`},
+			body:       vtodo("UID:uid-1", "SUMMARY:Buy oat milk"),
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "update changed task",
+			method:     http.MethodPut,
+			path:       tasksCalendar + "uid-1.ics",
+			token:      caldavWriteToken,
+			header:     map[string]string{"If-Match": `"99"`},
+			body:       vtodo("UID:uid-1", "SUMMARY:Buy oat milk"),
+			wantStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:       "move task to another calendar",
+			method:     http.MethodPut,
+			path:       workCalendar + "uid-1.ics",
+			token:      caldavWriteToken,
+			body:       vtodo("UID:uid-1", "SUMMARY:Buy milk"),
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "change completed task",
+			method:     http.MethodPut,
+			path:       tasksCalendar + "done.ics",
+			token:      caldavWriteToken,
+			body:       vtodo("UID:done", "SUMMARY:Call dad", "STATUS:COMPLETED"),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "rewrite completed task",
+			method:     http.MethodPut,
+			path:       tasksCalendar + "done.ics",
+			token:      caldavWriteToken,
+			body:       vtodo("UID:done", "SUMMARY:Call mum", "STATUS:COMPLETED"),
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "task without summary",
+			method:     http.MethodPut,
+			path:       tasksCalendar + "uid-2.ics",
+			token:      caldavWriteToken,
+			body:       vtodo("UID:uid-2"),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "event",
+			method:     http.MethodPut,
+			path:       tasksCalendar + "uid-2.ics",
+			token:      caldavWriteToken,
+			body:       "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:Party\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid resource name",
+			method:     http.MethodPut,
+			path:       tasksCalendar + "uid%202.ics",
+			token:      caldavWriteToken,
+			body:       vtodo("UID:uid-2", "SUMMARY:Water plants"),
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "delete changed task",
+			method:     http.MethodDelete,
+			path:       tasksCalendar + "uid-1.ics",
+			token:      caldavWriteToken,
+			header:     map[string]string{"If-Match": `"99"`},
+			wantStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:       "delete task",
+			method:     http.MethodDelete,
+			path:       workCalendar + "work.ics",
+			token:      caldavWriteToken,
+			header:     map[string]string{"If-Match": `"200"`},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "delete unknown task",
+			method:     http.MethodDelete,
+			path:       workCalendar + "gone.ics",
+			token:      caldavWriteToken,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := caldavRequest(t, s, test.method, test.path, test.token, test.body, test.header)
+			checkStatus(t, res, test.wantStatus)
+
+			if test.wantStatus == http.StatusUnauthorized && !strings.HasPrefix(res.Header().Get("WWW-Authenticate"), "Basic") {
+				t.Fatalf("want basic auth challenge, got %q", res.Header().Get("WWW-Authenticate"))
+			}
+
+			// Namespace declarations are removed and calendar data, which is
+			// escaped in XML responses, is unfolded to search the body.
+			body := xmlnsAttr.ReplaceAllString(res.Body.String(), "")
+			body = strings.ReplaceAll(body, "&#xD;&#xA; ", "")
+			body = strings.ReplaceAll(body, "\r\n ", "")
+			for _, want := range test.wantBody {
+				if !strings.Contains(body, want) {
+					t.Fatalf("want %q in the response, got %s", want, body)
+				}
+			}
+			for _, unwanted := range test.unwantedBody {
+				if strings.Contains(body, unwanted) {
+					t.Fatalf("want no %q in the response, got %s", unwanted, body)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCalDAVPath(t *testing.T) {
+	workID := projectCalendarPrefix + base64.RawURLEncoding.EncodeToString([]byte("work"))
+
+	tests := []struct {
+		name        string
+		path        string
+		wantOK      bool
+		wantKind    caldavResourceKind
+		wantProject string
+		wantName    string
+	}{
+		{"root", "/caldav/", true, caldavRootKind, "", ""},
+		{"principal", "/caldav/principal", true, caldavPrincipalKind, "", ""},
+		{"home", "/caldav/calendars/", true, caldavHomeKind, "", ""},
+		{"default calendar", "/caldav/calendars/tasks/", true, caldavCalendarKind, "", ""},
+		{"project calendar", "/caldav/calendars/" + workID + "/", true, caldavCalendarKind, "work", ""},
+		{"task", "/caldav/calendars/" + workID + "/uid-1@example.com.ics", true, caldavTaskKind, "work", "uid-1@example.com"},
+		{"unknown calendar", "/caldav/calendars/work/", false, 0, "", ""},
+		{"invalid project encoding", "/caldav/calendars/project-!!/", false, 0, "", ""},
+		{"empty project", "/caldav/calendars/project-/", false, 0, "", ""},
+		{"resource without extension", "/caldav/calendars/tasks/uid-1", false, 0, "", ""},
+		{"resource name with a slash", "/caldav/calendars/tasks/a/b.ics", false, 0, "", ""},
+		{"unknown path", "/caldav/files/", false, 0, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resource, ok := parseCalDAVPath(test.path)
+			if ok != test.wantOK {
+				t.Fatalf("want ok %v, got %v", test.wantOK, ok)
+			}
+			if !ok {
+				return
+			}
+			if resource.kind != test.wantKind || resource.project != test.wantProject || resource.name != test.wantName {
+				t.Fatalf("want kind %d, project %q and name %q, got %+v", test.wantKind, test.wantProject, test.wantName, resource)
+			}
+		})
+	}
+}
+
+func TestParseICSTodo(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    *icsTodo
+		wantErr bool
+	}{
+		{
+			name: "to-do",
+			data: vtodo("UID:uid-1", `SUMMARY:Buy milk\, eggs\nand bread`, "DUE:20250101T120000Z", "STATUS:NEEDS-ACTION", `CATEGORIES:home,shop\,food`, "CATEGORIES:urgent", "RRULE:FREQ=WEEKLY"),
+			want: &icsTodo{uid: "uid-1", summary: "Buy milk, eggs\nand bread", dueAt: 1735732800, categories: []string{"home", "shop,food", "urgent"}, recurrence: "FREQ=WEEKLY"},
+		},
+		{
+			name: "folded lines",
+			data: "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nSUMMARY:Buy\r\n  milk\r\nEND:VTODO\r\nEND:VCALENDAR\r\n",
+			want: &icsTodo{summary: "Buy milk"},
+		},
+		{
+			name: "completed",
+			data: vtodo("SUMMARY:Done", "COMPLETED:20250101T120000Z"),
+			want: &icsTodo{summary: "Done", completed: true},
+		},
+		{
+			name: "due date",
+			data: vtodo("SUMMARY:Pay rent", "DUE;VALUE=DATE:20250101"),
+			want: &icsTodo{summary: "Pay rent", dueAt: 1735689600},
+		},
+		{
+			name: "due time in a time zone",
+			data: vtodo("SUMMARY:Call", `DUE;TZID="America/New_York":20250101T070000`),
+			want: &icsTodo{summary: "Call", dueAt: 1735732800},
+		},
+		{
+			name: "alarm",
+			data: vtodo("SUMMARY:Call", "BEGIN:VALARM", "SUMMARY:Reminder", "DUE:20250101T120000Z", "END:VALARM"),
+			want: &icsTodo{summary: "Call"},
+		},
+		{
+			name: "override of an occurrence",
+			data: "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nRECURRENCE-ID:20250108T120000Z\r\nSUMMARY:Moved\r\nEND:VTODO\r\nBEGIN:VTODO\r\nSUMMARY:Weekly\r\nEND:VTODO\r\nEND:VCALENDAR\r\n",
+			want: &icsTodo{summary: "Weekly"},
+		},
+		{
+			name:    "invalid due date",
+			data:    vtodo("SUMMARY:Call", "DUE:tomorrow"),
+			wantErr: true,
+		},
+		{
+			name:    "no VTODO",
+			data:    "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:Party\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "unterminated VTODO",
+			data:    "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nSUMMARY:Call\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid content line",
+			data:    "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nSUMMARY\r\nEND:VTODO\r\nEND:VCALENDAR\r\n",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			todo, err := parseICSTodo(test.data)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("want error, got %+v", todo)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseICSTodo error: %v", err)
+			}
+
+			if todo.uid != test.want.uid || todo.summary != test.want.summary || todo.completed != test.want.completed ||
+				todo.dueAt != test.want.dueAt || strings.Join(todo.categories, "|") != strings.Join(test.want.categories, "|") ||
+				todo.recurrence != test.want.recurrence {
+				t.Fatalf("want %+v, got %+v", test.want, todo)
+			}
+		})
+	}
+}
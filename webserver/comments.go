@@ -0,0 +1,115 @@
+package webserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ukane-philemon/megtask/db"
+)
+
+// handleAddComment handles the "POST /task/{taskID}/comments" endpoint and
+// adds a comment to a task. The comment body is markdown and can reply to
+// another comment on the task.
+func (s *WebServer) handleAddComment(res http.ResponseWriter, req *http.Request) {
+	form := new(commentRequest)
+	if !s.readPostBody(res, req, &form) {
+		return
+	}
+
+	err := form.Validate()
+	if err != nil {
+		s.writeBadRequest(res, err.Error())
+		return
+	}
+
+	taskID := chi.URLParam(req, "taskID")
+	userID := s.reqUserID(req)
+	comment, err := s.taskDB.AddComment(userID, taskID, form.ParentID, form.Body)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.AddComment error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"comment": comment,
+	})
+}
+
+// handleRetrieveComments handles the "GET /task/{taskID}/comments" endpoint
+// and returns the comment threads of a task.
+func (s *WebServer) handleRetrieveComments(res http.ResponseWriter, req *http.Request) {
+	taskID := chi.URLParam(req, "taskID")
+	userID := s.reqUserID(req)
+	comments, err := s.taskDB.Comments(userID, taskID)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.Comments error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"comments": comments,
+	})
+}
+
+// handleUpdateComment handles the "PATCH /task/{taskID}/comments/{commentID}"
+// endpoint and updates the body of a comment written by the user.
+func (s *WebServer) handleUpdateComment(res http.ResponseWriter, req *http.Request) {
+	form := new(commentRequest)
+	if !s.readPostBody(res, req, &form) {
+		return
+	}
+
+	err := form.Validate()
+	if err != nil {
+		s.writeBadRequest(res, err.Error())
+		return
+	}
+
+	taskID := chi.URLParam(req, "taskID")
+	commentID := chi.URLParam(req, "commentID")
+	userID := s.reqUserID(req)
+	comment, err := s.taskDB.UpdateComment(userID, taskID, commentID, form.Body)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.UpdateComment error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"comment": comment,
+	})
+}
+
+// handleDeleteComment handles the "DELETE /task/{taskID}/comments/{commentID}"
+// endpoint and deletes a comment written by the user.
+func (s *WebServer) handleDeleteComment(res http.ResponseWriter, req *http.Request) {
+	taskID := chi.URLParam(req, "taskID")
+	commentID := chi.URLParam(req, "commentID")
+	userID := s.reqUserID(req)
+	err := s.taskDB.DeleteComment(userID, taskID, commentID)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.DeleteComment error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]string{
+		"message": "Comment deleted.",
+	})
+}
@@ -2,31 +2,396 @@ package webserver
 
 import (
 	"context"
+	"time"
 
 	"github.com/ukane-philemon/megtask/db"
 )
 
 type TaskDatabase interface {
-	// CreateAccount creates a new user with the provided username and password.
-	// An ErrorInvalidRequest will be returned is the username already exists.
-	CreateAccount(username, password string) error
+	// CreateAccount creates a new user with the provided username, password
+	// and optional email. An ErrorInvalidRequest will be returned is the
+	// username or email already exists.
+	CreateAccount(username, password, email string) error
 	// Login checks that the provided username and password matches a record in
 	// the database and are correct. Returns ErrorInvalidRequest if the password
 	// or username does not match any record.
 	Login(username, password string) (*db.User, error)
-	// CreateTask creates a new task entry for a user.
-	CreateTask(userID string, taskDetail string) ([]*db.Task, error)
+	// OIDCLogin returns the user linked to the provided identity provider
+	// account. If no user is linked to the account, a new user without a
+	// password is created using the preferred username and email. The email
+	// is only saved if it has been verified by the identity provider and is
+	// not used by another user. Returns ErrorInvalidRequest if the linked user
+	// is disabled or must reset their password.
+	OIDCLogin(issuer, subject, preferredUsername, email string, emailVerified bool) (*db.User, error)
+	// CreatePasswordResetToken saves a password reset token for the user with
+	// the provided email and returns the user's username. The token expires
+	// after the provided duration. Returns ErrorInvalidRequest if no user has
+	// the provided email or the email has not been verified.
+	CreatePasswordResetToken(email, token string, expiry time.Duration) (string, error)
+	// PasswordResetUsername returns the username of the user that owns the
+	// provided password reset token without consuming the token. Returns
+	// ErrorInvalidRequest if the token is invalid or has expired.
+	PasswordResetUsername(token string) (string, error)
+	// ResetPassword sets a new password for the user that owns the provided
+	// password reset token, logs them out of all their login sessions and
+	// revokes their api tokens. The token is consumed and cannot be reused.
+	// Returns ErrorInvalidRequest if the token is invalid or has expired.
+	ResetPassword(token, newPassword string) error
+	// ChangePassword sets a new password for the user with the provided userID
+	// if currentPassword is correct, and revokes all their login sessions
+	// except the session with the provided keepSessionID. Returns
+	// ErrorInvalidRequest if currentPassword is incorrect.
+	ChangePassword(userID, currentPassword, newPassword, keepSessionID string) error
+	// CreateEmailVerificationToken saves an email verification token for the
+	// user with the provided email and returns the user's username. The token
+	// expires after the provided duration. Returns ErrorInvalidRequest if no
+	// user has the provided email or the email has already been verified.
+	CreateEmailVerificationToken(email, token string, expiry time.Duration) (string, error)
+	// VerifyEmail marks the email of the user that owns the provided email
+	// verification token as verified. The token is consumed and cannot be
+	// reused. Returns ErrorInvalidRequest if the token is invalid or has
+	// expired.
+	VerifyEmail(token string) error
+	// SetupTOTP saves a TOTP secret for the user with the provided userID that
+	// will be used for two-factor authentication once it has been confirmed
+	// with EnableTOTP. Returns the user's username and ErrorInvalidRequest if
+	// two-factor authentication is already enabled.
+	SetupTOTP(userID, secret string) (string, error)
+	// EnableTOTP enables two-factor authentication for the user with the
+	// provided userID if code is valid for the secret saved with SetupTOTP.
+	// The provided recovery codes can each be used once instead of a TOTP
+	// code. Returns ErrorInvalidRequest if the code is invalid.
+	EnableTOTP(userID, code string, recoveryCodes []string) error
+	// DisableTOTP disables two-factor authentication for the user with the
+	// provided userID if code is a valid TOTP or recovery code. Returns
+	// ErrorInvalidRequest if the code is invalid.
+	DisableTOTP(userID, code string) error
+	// VerifyTwoFactor checks that code is a valid TOTP or recovery code for
+	// the user with the provided userID and returns the user's information.
+	// Each code can only be used once. Returns ErrorInvalidRequest if the code
+	// is invalid.
+	VerifyTwoFactor(userID, code string) (*db.User, error)
+	// CreateAPIToken saves a new personal access token for the user with the
+	// provided userID. The token expires after the provided duration or never
+	// expires if expiry is zero.
+	CreateAPIToken(userID, name, token string, scopes []string, expiry time.Duration) (*db.APIToken, error)
+	// APITokens returns all the unexpired personal access tokens created by
+	// the user with the provided userID.
+	APITokens(userID string) ([]*db.APIToken, error)
+	// RevokeAPIToken deletes a personal access token created by the user with
+	// the provided userID. If no token match the provided tokenID, an
+	// ErrorInvalidRequest is returned.
+	RevokeAPIToken(userID, tokenID string) error
+	// APITokenOwner checks that the provided personal access token is valid
+	// and returns the ID of the user that created it and the token's scopes.
+	// Returns ErrorInvalidRequest if the token does not exist or has expired.
+	APITokenOwner(token string) (string, []string, error)
+	// CreateFeedToken saves a new calendar feed token for the user with the
+	// provided userID. Returns ErrorInvalidRequest if the user has too many
+	// feed tokens.
+	CreateFeedToken(userID, name, token string) (*db.FeedToken, error)
+	// FeedTokens returns the calendar feed tokens of the user with the
+	// provided userID.
+	FeedTokens(userID string) ([]*db.FeedToken, error)
+	// RevokeFeedToken deletes a calendar feed token of the user with the
+	// provided userID. If no token match the provided tokenID, an
+	// ErrorInvalidRequest is returned.
+	RevokeFeedToken(userID, tokenID string) error
+	// FeedTokenOwner checks that the provided calendar feed token is valid
+	// and returns the ID of the user that created it. Returns
+	// ErrorInvalidRequest if the token does not exist or the user's account
+	// has been disabled.
+	FeedTokenOwner(token string) (string, error)
+	// CreateTask creates a new task entry for a user and returns the new task
+	// and the user's tasks. The project, due date, tags and recurrence rule
+	// are optional.
+	CreateTask(userID string, taskDetail, project string, dueAt int64, tags []string, recurrence string) (*db.Task, []*db.Task, error)
 	// Tasks returns all the tasks created by the provided userID.
 	Tasks(userID string) ([]*db.Task, error)
 	// TasksWithStatus returns user tasks that matches the provided filter.
 	TasksWithStatus(userID string, completed bool) ([]*db.Task, error)
-	// UpdateTask updates an existing task for the provided userID. If no task
-	// match the provided taskID, an ErrorInvalidRequest is returned.
-	UpdateTask(userID, taskID string, newTaskDetail string, markAsComplete *bool) ([]*db.Task, error)
-	// DeleteTask removes an existing task from the record of the user that
-	// match the provided userID. If no task match the provided taskID, an
+	// SharedTasks returns the tasks other users have shared with the user
+	// with the provided userID, directly or through a project. Only tasks
+	// with the provided completed status are returned if completed is not
+	// nil.
+	SharedTasks(userID string, completed *bool) ([]*db.Task, error)
+	// UpdateTask updates an existing task the provided userID owns or can
+	// edit. Only the owner of a task can change its project. Returns the list
+	// of tasks the updated task belongs to for the user, i.e the user's own
+	// tasks, the tasks shared with the user or the tasks in the task's
+	// workspace. If no task match the provided taskID, an ErrorInvalidRequest
+	// is returned.
+	UpdateTask(userID, taskID string, taskUpdate *db.TaskUpdate) ([]*db.Task, error)
+	// DeleteTask removes an existing task the provided userID owns, or a task
+	// in a workspace where the user is the owner or a member. Returns the list of tasks the deleted task belonged to for the
+	// user, i.e the user's own tasks, the tasks shared with the user or the
+	// tasks in the task's workspace. If no task match the provided taskID, an
 	// ErrorInvalidRequest is returned.
 	DeleteTask(userID, taskID string) ([]*db.Task, error)
+	// AssignTask assigns the task with the provided taskID to the user with
+	// the provided assigneeID, or removes the task's assignee if assigneeID
+	// is empty. The user with the provided userID must be able to edit the
+	// task and the assignee must have access to it. The change is recorded in
+	// the task's history. Returns the list of tasks the task belongs to for
+	// the user.
+	AssignTask(userID, taskID, assigneeID string) ([]*db.Task, error)
+	// AssignedTasks returns the tasks assigned to the user with the provided
+	// userID that the user can still access. Only tasks with the provided
+	// completed status are returned if completed is not nil.
+	AssignedTasks(userID string, completed *bool) ([]*db.Task, error)
+	// TaskAudience returns the IDs of the users that can access the task with
+	// the provided taskID. Returns ErrorInvalidRequest if the task does not
+	// exist.
+	TaskAudience(taskID string) ([]string, error)
+	// TaskDelta returns the tasks owned by the user with the provided userID
+	// that were changed or deleted after the provided sync version. All the
+	// user's tasks are returned with Reset set if since is zero or too old
+	// for the deleted tasks to be known.
+	TaskDelta(userID string, since int64) (*db.TaskDelta, error)
+	// SyncTasks applies changes made by the user with the provided userID
+	// while offline to the tasks they own, in order, and returns the result
+	// of each change. Each field is resolved separately: a field modified on
+	// the server after the client's change is kept and reported as a
+	// conflict.
+	SyncTasks(userID string, changes []*db.SyncChange) ([]*db.SyncResult, error)
+	// TaskHistory returns the changes made to the task with the provided
+	// taskID, oldest first. The user with the provided userID must have
+	// access to the task.
+	TaskHistory(userID, taskID string) ([]*db.TaskHistoryEntry, error)
+	// AddComment adds a comment to the task with the provided taskID. The
+	// comment replies to the comment with the provided parentID if it is not
+	// empty. The user with the provided userID must be able to edit the task.
+	AddComment(userID, taskID, parentID, body string) (*db.Comment, error)
+	// Comments returns the comments on the task with the provided taskID as
+	// threads, oldest first. The user with the provided userID must have
+	// access to the task.
+	Comments(userID, taskID string) ([]*db.Comment, error)
+	// UpdateComment replaces the body of a comment on the task with the
+	// provided taskID. Only the author of a comment can update it, while they
+	// can edit the task. Returns ErrorInvalidRequest if the comment does not
+	// exist or has been deleted.
+	UpdateComment(userID, taskID, commentID, body string) (*db.Comment, error)
+	// DeleteComment deletes a comment on the task with the provided taskID.
+	// Only the author of a comment can delete it, while they can edit the
+	// task. Comments that have replies are kept without their body so the
+	// thread is preserved. Returns ErrorInvalidRequest if the comment does not
+	// exist or has already been deleted.
+	DeleteComment(userID, taskID, commentID string) error
+	// CreateAttachment saves information about a file attached to the task
+	// with the provided taskID by the user with the provided userID. The user
+	// must be able to edit the task and the total size of the files they have
+	// attached must not exceed quota bytes. Returns ErrorInvalidRequest if the
+	// quota would be exceeded.
+	CreateAttachment(userID, taskID, filename, contentType string, size, quota int64) (*db.Attachment, error)
+	// Attachments returns the files attached to the task with the provided
+	// taskID, oldest first. The user must have access to the task.
+	Attachments(userID, taskID string) ([]*db.Attachment, error)
+	// Attachment returns information about a file attached to the task with
+	// the provided taskID. The user must have access to the task. Returns
+	// ErrorInvalidRequest if the attachment does not exist.
+	Attachment(userID, taskID, attachmentID string) (*db.Attachment, error)
+	// DeleteAttachment deletes information about a file attached to the task
+	// with the provided taskID. The user must be able to edit the task.
+	// Returns ErrorInvalidRequest if the attachment does not exist.
+	DeleteAttachment(userID, taskID, attachmentID string) error
+	// ShareTask shares the task with the provided taskID owned by ownerID
+	// with the user with the provided username. Sharing a task again with the
+	// same user replaces their permission. Returns ErrorInvalidRequest if the
+	// task or user does not exist.
+	ShareTask(ownerID, taskID, username, permission string) (*db.Share, error)
+	// ShareProject shares all the tasks in the provided project owned by
+	// ownerID, including tasks added to the project later, with the user
+	// with the provided username. Sharing a project again with the same user
+	// replaces their permission. Returns ErrorInvalidRequest if the user does
+	// not exist.
+	ShareProject(ownerID, project, username, permission string) (*db.Share, error)
+	// Shares returns all the tasks and projects the user with the provided
+	// ownerID has shared with other users.
+	Shares(ownerID string) ([]*db.Share, error)
+	// RevokeShare deletes a share created by the user with the provided
+	// ownerID. If no share match the provided shareID, an ErrorInvalidRequest
+	// is returned.
+	RevokeShare(ownerID, shareID string) error
+	// CreateWorkspace creates a new workspace owned by the user with the
+	// provided ownerID.
+	CreateWorkspace(ownerID, name string) (*db.Workspace, error)
+	// Workspaces returns the workspaces the user with the provided userID is
+	// a member of.
+	Workspaces(userID string) ([]*db.Workspace, error)
+	// WorkspaceInvitations returns the workspaces the user with the provided
+	// userID has been invited to and has not yet responded to.
+	WorkspaceInvitations(userID string) ([]*db.Workspace, error)
+	// WorkspaceMembers returns the members of the workspace with the provided
+	// workspaceID and the users that have been invited to it.
+	WorkspaceMembers(workspaceID string) ([]*db.WorkspaceMember, error)
+	// TaskWorkspaceID returns the ID of the workspace of the task with the
+	// provided taskID, or an empty string if the task is not in a workspace.
+	// Returns ErrorInvalidRequest if the task does not exist.
+	TaskWorkspaceID(taskID string) (string, error)
+	// WorkspaceRole returns the role of the user with the provided userID in
+	// the workspace with the provided workspaceID. Returns
+	// ErrorInvalidRequest if the user is not a member of the workspace.
+	WorkspaceRole(workspaceID, userID string) (string, error)
+	// InviteToWorkspace invites the user with the provided username to join
+	// the workspace with the provided workspaceID with the provided role.
+	// Returns ErrorInvalidRequest if the user does not exist or is already a
+	// member of or has been invited to the workspace.
+	InviteToWorkspace(workspaceID, inviterID, username, role string) (*db.WorkspaceMember, error)
+	// RespondToWorkspaceInvitation accepts or declines an invitation to the
+	// workspace with the provided workspaceID for the user with the provided
+	// userID. Returns ErrorInvalidRequest if the user has not been invited to
+	// the workspace.
+	RespondToWorkspaceInvitation(workspaceID, userID string, accept bool) error
+	// RemoveWorkspaceMember removes the user with the provided userID from
+	// the workspace with the provided workspaceID or cancels their
+	// invitation. The owner of a workspace cannot be removed. Returns
+	// ErrorInvalidRequest if the user is not a member of the workspace.
+	RemoveWorkspaceMember(workspaceID, userID string) error
+	// CreateWorkspaceTask creates a new task in the workspace with the
+	// provided workspaceID and returns the new task and the workspace's
+	// tasks. The project, due date, tags and recurrence rule are optional.
+	CreateWorkspaceTask(workspaceID, userID, taskDetail, project string, dueAt int64, tags []string, recurrence string) (*db.Task, []*db.Task, error)
+	// WorkspaceTasks returns the tasks in the workspace with the provided
+	// workspaceID. Only tasks with the provided completed status are returned
+	// if completed is not nil.
+	WorkspaceTasks(workspaceID string, completed *bool) ([]*db.Task, error)
+	// CreateSession creates a new login session for the user with the
+	// provided userID that expires after the provided duration.
+	CreateSession(userID, deviceLabel, userAgent, ip string, expiry time.Duration) (*db.Session, error)
+	// TouchSession checks that the session with the provided sessionID
+	// belongs to the user with the provided userID and has not expired or
+	// been revoked, and updates its last seen time. Returns
+	// ErrorInvalidRequest if the session is not active.
+	TouchSession(userID, sessionID string) error
+	// Sessions returns the active login sessions of the user with the
+	// provided userID, most recently seen first.
+	Sessions(userID string) ([]*db.Session, error)
+	// RevokeSession deletes a login session of the user with the provided
+	// userID. Auth tokens issued for the session are no longer accepted. If
+	// no session match the provided sessionID, an ErrorInvalidRequest is
+	// returned.
+	RevokeSession(userID, sessionID string) error
+	// Users returns a page of users sorted by creation time with their task
+	// counts.
+	Users(offset, limit int64) ([]*db.UserSummary, error)
+	// UserRole returns the current role of the user with the provided userID.
+	// Returns ErrorInvalidRequest if the user does not exist or has been
+	// disabled.
+	UserRole(userID string) (string, error)
+	// UserSummary returns information about the user with the provided userID
+	// and their task counts. Returns ErrorInvalidRequest if the user does not
+	// exist.
+	UserSummary(userID string) (*db.UserSummary, error)
+	// SetUserDisabled disables or enables the account of the user with the
+	// provided userID. Disabled users are logged out and cannot login or use
+	// their api tokens. Returns ErrorInvalidRequest if the user does not
+	// exist.
+	SetUserDisabled(userID string, disabled bool) error
+	// ForcePasswordReset logs out the user with the provided userID and
+	// requires them to reset their password before they can login again.
+	// Returns the user's information and ErrorInvalidRequest if the user does
+	// not exist.
+	ForcePasswordReset(userID string) (*db.UserSummary, error)
+	// CreateWebhook saves a webhook that receives the provided events for the
+	// user with the provided userID. Deliveries are signed with secret.
+	// Returns ErrorInvalidRequest if the user already has the maximum number
+	// of webhooks.
+	CreateWebhook(userID, url string, events []string, secret string) (*db.Webhook, error)
+	// Webhooks returns the webhooks of the user with the provided userID,
+	// oldest first. Secrets are not returned.
+	Webhooks(userID string) ([]*db.Webhook, error)
+	// DeleteWebhook deletes a webhook of the user with the provided userID
+	// and its deliveries. Returns ErrorInvalidRequest if the webhook does not
+	// exist.
+	DeleteWebhook(userID, webhookID string) error
+	// WebhookDeliveries returns the latest deliveries of a webhook of the
+	// user with the provided userID, newest first. Returns
+	// ErrorInvalidRequest if the webhook does not exist.
+	WebhookDeliveries(userID, webhookID string, limit int64) ([]*db.WebhookDelivery, error)
+	// CreateWebhookDelivery saves a delivery of the provided event to a
+	// webhook of the user with the provided userID that is first attempted at
+	// nextAttemptAt. Returns the webhook with its secret and the delivery,
+	// and ErrorInvalidRequest if the webhook does not exist.
+	CreateWebhookDelivery(userID, webhookID, event, payload string, nextAttemptAt int64) (*db.Webhook, *db.WebhookDelivery, error)
+	// QueueWebhookDeliveries saves a pending delivery of the provided event
+	// for each webhook of the users with the provided userIDs that receives
+	// the event.
+	QueueWebhookDeliveries(userIDs []string, event, payload string) error
+	// ClaimWebhookDelivery returns the pending delivery that has been due the
+	// longest and its webhook with the webhook's secret. The delivery is not
+	// returned again until the lease expires or an attempt is recorded.
+	// Returns nil if no delivery is due.
+	ClaimWebhookDelivery(lease time.Duration) (*db.Webhook, *db.WebhookDelivery, error)
+	// RecordWebhookAttempt saves the result of sending the delivery with the
+	// provided deliveryID.
+	RecordWebhookAttempt(deliveryID string, attempt *db.WebhookAttempt) error
+	// CreateReminder sets a reminder for the user with the provided userID on
+	// the task with the provided taskID. The reminder is sent at remindAt, or
+	// offset seconds before the task's due date if offset is not nil. The
+	// user must be able to edit the task. Returns ErrorInvalidRequest if the
+	// reminder time has passed or the task has no due date for a relative
+	// reminder.
+	CreateReminder(userID, taskID string, remindAt int64, offset *int64) (*db.Reminder, error)
+	// Reminders returns the reminders the user with the provided userID set
+	// on the task with the provided taskID, in the order they are sent.
+	Reminders(userID, taskID string) ([]*db.Reminder, error)
+	// DeleteReminder deletes a reminder the user with the provided userID set
+	// on the task with the provided taskID. Returns ErrorInvalidRequest if
+	// there is no such reminder.
+	DeleteReminder(userID, taskID, reminderID string) error
+	// ClaimDueReminder claims the undelivered reminder that has been due the
+	// longest and hides it from other schedulers for the provided lease, so
+	// it is retried if it is not marked as delivered. Returns nil if no
+	// reminder is due.
+	ClaimDueReminder(lease time.Duration) (*db.DueReminder, error)
+	// MarkReminderDelivered marks the reminder with the provided reminderID as
+	// delivered, with the provided error if it could not be delivered.
+	// Marking a reminder that has already been delivered has no effect.
+	MarkReminderDelivered(reminderID, deliveryError string) error
+	// CalendarTask returns the task of the user with the provided userID that
+	// is the calendar resource with the provided name. The name of a task is
+	// its client ID, or its ID if it was not created by a client. Returns nil
+	// if there is no such task.
+	CalendarTask(userID, name string) (*db.Task, error)
+	// CreateCalendarTask creates a task for the user with the provided
+	// userID from the calendar resource with the provided name, which is
+	// saved as the task's client ID. Returns ErrorInvalidRequest if the user
+	// has a task with the same name.
+	CreateCalendarTask(userID, name string, info *db.TaskInfo) (*db.Task, error)
+	// UpdateCalendarTask replaces the detail, completion state, due date, tags
+	// and recurrence rule of a task the user with the provided userID owns
+	// with those in info, if the task has not been updated since updatedAt.
+	// The project of the task is not changed. Returns ErrorInvalidRequest if
+	// the task does not exist or has been updated.
+	UpdateCalendarTask(userID, taskID string, updatedAt int64, info *db.TaskInfo) (*db.Task, error)
+	// AcquireJobLock acquires or renews the lock on the job with the
+	// provided name for the server with the provided owner ID, until the
+	// lease expires. Returns false if another server holds the lock.
+	AcquireJobLock(name, owner string, lease time.Duration) (bool, error)
+	// RecordJobRun saves the result of a run of the job with the provided
+	// name.
+	RecordJobRun(name string, run *db.JobRun) error
+	// Job returns the status of the job with the provided name. A job that
+	// has never run has no last run.
+	Job(name string) (*db.Job, error)
+	// Jobs returns the status of all the jobs that have run or are locked,
+	// ordered by name.
+	Jobs() ([]*db.Job, error)
+	// PurgeDeliveredRecords deletes the reminders that were delivered and the
+	// webhook deliveries that succeeded or failed before the provided unix
+	// time. Returns the number of records deleted.
+	PurgeDeliveredRecords(before int64) (int64, error)
+	// CompletedRecurringTasks returns up to limit completed tasks that still
+	// have a recurrence rule, i.e. whose next occurrence has not been
+	// created.
+	CompletedRecurringTasks(limit int) ([]*db.Task, error)
+	// CreateNextOccurrence creates the next occurrence of the completed
+	// recurring task with the provided taskID, due at dueAt and recurring
+	// with recurrence, and removes the recurrence rule from the completed
+	// task. No task is created if dueAt is zero, which ends the recurrence.
+	// The next occurrence is only created once, and is returned again if it
+	// already exists. Returns ErrorInvalidRequest if the task does not exist.
+	CreateNextOccurrence(taskID string, dueAt int64, recurrence string) (*db.Task, error)
 	// Shutdown gracefully disconnects the database after the server is
 	// shutdown.
 	Shutdown(ctx context.Context) error
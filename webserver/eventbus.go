@@ -0,0 +1,191 @@
+package webserver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+const (
+	// TaskCreatedEvent is published when a task is created.
+	TaskCreatedEvent = db.TaskChangeCreated
+	// TaskUpdatedEvent is published when a task is updated or assigned.
+	TaskUpdatedEvent = db.TaskChangeUpdated
+	// TaskDeletedEvent is published when a task is deleted.
+	TaskDeletedEvent = db.TaskChangeDeleted
+
+	// defaultEventLogSize is the default number of recent events kept so
+	// subscribers can resume after reconnecting.
+	defaultEventLogSize = 1000
+	// subscriberBufferSize is the number of events buffered for a subscriber.
+	// Subscribers that fall further behind are disconnected.
+	subscriberBufferSize = 64
+)
+
+// TaskEvent is a change made to a task.
+type TaskEvent struct {
+	// ID is set when the event is published on the event bus.
+	ID     uint64 `json:"id,omitempty"`
+	Type   string `json:"type"`
+	TaskID string `json:"taskID"`
+	// Task is the task after the change and is nil for deleted tasks.
+	Task      *db.Task `json:"task,omitempty"`
+	Timestamp int64    `json:"timestamp"`
+
+	// audience are the IDs of the users that receive the event.
+	audience []string
+}
+
+// eventSubscriber receives the events published for a user.
+type eventSubscriber struct {
+	userID string
+	events chan *TaskEvent
+}
+
+// eventBus delivers task events to the subscribers of the users that can
+// access the task. Recent events are kept in a bounded log so subscribers can
+// resume from the last event they received.
+type eventBus struct {
+	mtx         sync.Mutex
+	lastID      uint64
+	log         []*TaskEvent
+	logStart    int
+	subscribers map[string]map[*eventSubscriber]struct{}
+	closed      bool
+}
+
+// newEventBus returns a new *eventBus that keeps the last logSize events.
+func newEventBus(logSize int) *eventBus {
+	return &eventBus{
+		// Event IDs start from the current time so IDs from a previous run of
+		// the server are not mistaken for recent events. Microseconds keep
+		// the IDs within the integer precision of JavaScript clients.
+		lastID:      uint64(time.Now().UnixMicro()),
+		log:         make([]*TaskEvent, 0, logSize),
+		subscribers: make(map[string]map[*eventSubscriber]struct{}),
+	}
+}
+
+// publish assigns an ID to event, adds it to the log and sends it to the
+// subscribers of its audience. Subscribers that cannot keep up are
+// disconnected and must resume from the log.
+func (eb *eventBus) publish(event *TaskEvent) {
+	eb.mtx.Lock()
+	defer eb.mtx.Unlock()
+
+	if eb.closed {
+		return
+	}
+
+	eb.lastID++
+	event.ID = eb.lastID
+	event.Timestamp = time.Now().Unix()
+
+	if len(eb.log) < cap(eb.log) {
+		eb.log = append(eb.log, event)
+	} else if len(eb.log) > 0 {
+		eb.log[eb.logStart] = event
+		eb.logStart = (eb.logStart + 1) % len(eb.log)
+	}
+
+	for _, userID := range event.audience {
+		for sub := range eb.subscribers[userID] {
+			select {
+			case sub.events <- event:
+			default:
+				eb.removeSubscriber(sub)
+			}
+		}
+	}
+}
+
+// subscribe returns a new subscriber for the user with the provided userID
+// and the logged events for the user published after the event with the
+// provided lastEventID. If lastEventID is not zero and events after it are
+// no longer in the log, complete is false and the subscriber must reload its
+// state.
+func (eb *eventBus) subscribe(userID string, lastEventID uint64) (sub *eventSubscriber, missed []*TaskEvent, complete bool) {
+	eb.mtx.Lock()
+	defer eb.mtx.Unlock()
+
+	sub = &eventSubscriber{
+		userID: userID,
+		events: make(chan *TaskEvent, subscriberBufferSize),
+	}
+	if eb.closed {
+		close(sub.events)
+		return sub, nil, true
+	}
+
+	if eb.subscribers[userID] == nil {
+		eb.subscribers[userID] = make(map[*eventSubscriber]struct{})
+	}
+	eb.subscribers[userID][sub] = struct{}{}
+
+	if lastEventID == 0 {
+		return sub, nil, true
+	}
+
+	if lastEventID > eb.lastID {
+		return sub, nil, false
+	}
+
+	oldestID := eb.lastID + 1
+	for i := range eb.log {
+		event := eb.log[(eb.logStart+i)%len(eb.log)]
+		if i == 0 {
+			oldestID = event.ID
+		}
+		if event.ID > lastEventID && event.hasAudience(userID) {
+			missed = append(missed, event)
+		}
+	}
+
+	return sub, missed, lastEventID+1 >= oldestID
+}
+
+// unsubscribe stops sending events to sub.
+func (eb *eventBus) unsubscribe(sub *eventSubscriber) {
+	eb.mtx.Lock()
+	defer eb.mtx.Unlock()
+	eb.removeSubscriber(sub)
+}
+
+// close disconnects all subscribers and stops publishing events.
+func (eb *eventBus) close() {
+	eb.mtx.Lock()
+	defer eb.mtx.Unlock()
+
+	eb.closed = true
+	for _, subs := range eb.subscribers {
+		for sub := range subs {
+			eb.removeSubscriber(sub)
+		}
+	}
+}
+
+// removeSubscriber removes sub and closes its events channel. The caller
+// must hold eb.mtx.
+func (eb *eventBus) removeSubscriber(sub *eventSubscriber) {
+	subs, found := eb.subscribers[sub.userID]
+	if _, subscribed := subs[sub]; !found || !subscribed {
+		return
+	}
+
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(eb.subscribers, sub.userID)
+	}
+	close(sub.events)
+}
+
+// hasAudience checks if the user with the provided userID receives e.
+func (e *TaskEvent) hasAudience(userID string) bool {
+	for _, id := range e.audience {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
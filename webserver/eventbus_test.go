@@ -0,0 +1,104 @@
+package webserver
+
+import "testing"
+
+func TestEventBusSubscribe(t *testing.T) {
+	const logSize = 3
+
+	eb := newEventBus(logSize)
+	firstID := eb.lastID + 1
+
+	// Five events are published, so the first two are no longer in the log.
+	audiences := [][]string{{"a"}, {"a"}, {"a", "b"}, {"b"}, {"a"}}
+	for _, audience := range audiences {
+		eb.publish(&TaskEvent{Type: TaskUpdatedEvent, audience: audience})
+	}
+
+	tests := []struct {
+		name        string
+		userID      string
+		lastEventID uint64
+		// wantMissed are the offsets from firstID of the missed events.
+		wantMissed   []uint64
+		wantComplete bool
+	}{
+		{"new stream", "a", 0, nil, true},
+		{"up to date", "a", firstID + 4, nil, true},
+		{"missed the last event", "a", firstID + 3, []uint64{4}, true},
+		{"missed logged events", "a", firstID + 1, []uint64{2, 4}, true},
+		{"missed events of other users", "b", firstID + 1, []uint64{2, 3}, true},
+		{"missed events no longer logged", "a", firstID, []uint64{2, 4}, false},
+		{"event from another run of the server", "a", firstID + 100, nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sub, missed, complete := eb.subscribe(test.userID, test.lastEventID)
+			defer eb.unsubscribe(sub)
+
+			if complete != test.wantComplete {
+				t.Fatalf("want complete %v, got %v", test.wantComplete, complete)
+			}
+			if len(missed) != len(test.wantMissed) {
+				t.Fatalf("want %d missed events, got %d", len(test.wantMissed), len(missed))
+			}
+			for i, event := range missed {
+				if event.ID != firstID+test.wantMissed[i] {
+					t.Fatalf("want missed event %d, got %d", firstID+test.wantMissed[i], event.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestEventBusPublish(t *testing.T) {
+	tests := []struct {
+		name string
+		// events is the number of events published to "a".
+		events           int
+		wantReceived     int
+		wantDisconnected bool
+	}{
+		{"no events", 0, 0, false},
+		{"buffered events", subscriberBufferSize, subscriberBufferSize, false},
+		{"subscriber fell behind", subscriberBufferSize + 1, subscriberBufferSize, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			eb := newEventBus(defaultEventLogSize)
+			sub, _, _ := eb.subscribe("a", 0)
+			other, _, _ := eb.subscribe("b", 0)
+			defer eb.unsubscribe(other)
+
+			for i := 0; i < test.events; i++ {
+				eb.publish(&TaskEvent{Type: TaskCreatedEvent, audience: []string{"a"}})
+			}
+
+			if len(other.events) != 0 {
+				t.Fatalf("want no events for other users, got %d", len(other.events))
+			}
+
+			received := 0
+			disconnected := false
+		receive:
+			for {
+				select {
+				case _, ok := <-sub.events:
+					if !ok {
+						disconnected = true
+						break receive
+					}
+					received++
+				default:
+					break receive
+				}
+			}
+
+			if received != test.wantReceived || disconnected != test.wantDisconnected {
+				t.Fatalf("want %d events received and disconnected %v, got %d and %v", test.wantReceived, test.wantDisconnected, received, disconnected)
+			}
+			eb.unsubscribe(sub)
+		})
+	}
+}
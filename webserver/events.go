@@ -0,0 +1,151 @@
+package webserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+const (
+	// eventsHeartbeatInterval is how often a comment is sent on idle event
+	// streams so proxies do not close them.
+	eventsHeartbeatInterval = 15 * time.Second
+	// eventsRetryMillis is the reconnection delay suggested to clients.
+	eventsRetryMillis = 3000
+	// resetEvent is sent when events a client missed are no longer available.
+	// The client should reload its tasks.
+	resetEvent = "reset"
+)
+
+// handleEvents handles the "GET /events" endpoint and streams the task events
+// of the user as Server-Sent Events. Clients can resume a stream by sending
+// the ID of the last event they received in the "Last-Event-ID" header.
+func (s *WebServer) handleEvents(res http.ResponseWriter, req *http.Request) {
+	var lastEventID uint64
+	if header := req.Header.Get("Last-Event-ID"); header != "" {
+		var err error
+		lastEventID, err = strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			s.writeBadRequest(res, "invalid Last-Event-ID header")
+			return
+		}
+	}
+
+	// Event streams are kept open beyond the server's write timeout.
+	rc := http.NewResponseController(res)
+	err := rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("failed to disable write deadline: %w", err))
+		return
+	}
+
+	userID := s.reqUserID(req)
+	sub, missed, complete := s.events.subscribe(userID, lastEventID)
+	defer s.events.unsubscribe(sub)
+
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+
+	_, err = fmt.Fprintf(res, "retry: %d\n\n", eventsRetryMillis)
+	if err == nil && !complete {
+		_, err = fmt.Fprintf(res, "event: %s\ndata: {}\n\n", resetEvent)
+	}
+	for _, event := range missed {
+		if err != nil {
+			break
+		}
+		err = writeEvent(res, event)
+	}
+	if err == nil {
+		err = rc.Flush()
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for err == nil {
+		select {
+		case <-req.Context().Done():
+			return
+		case event, ok := <-sub.events:
+			if !ok {
+				// The subscriber fell behind or the server is shutting
+				// down. The client will reconnect and resume.
+				return
+			}
+			err = writeEvent(res, event)
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(res, ": heartbeat\n\n")
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+	}
+}
+
+// writeEvent writes event to res in the Server-Sent Events format.
+func writeEvent(res http.ResponseWriter, event *TaskEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("json.Marshal error: %w", err)
+	}
+
+	_, err = fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// publishTaskEvent publishes an event for the task with the provided taskID
+// to the users that can access it. The task is looked up in tasks, the list
+// returned after the change. The event is not published if its audience
+// cannot be retrieved.
+func (s *WebServer) publishTaskEvent(eventType, taskID string, tasks []*db.Task) {
+	audience, err := s.taskDB.TaskAudience(taskID)
+	if err != nil {
+		s.log.Error("taskDB.TaskAudience error: ", "error", err)
+		return
+	}
+
+	var task *db.Task
+	for _, t := range tasks {
+		if t.ID == taskID {
+			task = t
+			break
+		}
+	}
+
+	s.publishEvent(eventType, taskID, task, audience)
+}
+
+// publishEvent publishes an event for the task with the provided taskID to
+// the users in audience and queues it for their webhooks. Events are left to
+// s.taskChanges if it is set, so they are published once by every replica.
+func (s *WebServer) publishEvent(eventType, taskID string, task *db.Task, audience []string) {
+	event := newTaskEvent(eventType, taskID, task, audience)
+	if s.taskChanges == nil {
+		s.events.publish(event)
+	}
+	s.queueWebhookDeliveries(event)
+}
+
+// newTaskEvent returns a new *TaskEvent for the task with the provided taskID.
+func newTaskEvent(eventType, taskID string, task *db.Task, audience []string) *TaskEvent {
+	if task != nil {
+		// Permissions differ between users so they are not sent.
+		eventTask := *task
+		eventTask.Permission = ""
+		task = &eventTask
+	}
+
+	return &TaskEvent{
+		Type:     eventType,
+		TaskID:   taskID,
+		Task:     task,
+		audience: audience,
+	}
+}
@@ -0,0 +1,128 @@
+package webserver
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+// readEvent returns the fields of the next event in an event stream.
+func readEvent(t *testing.T, r *bufio.Reader) map[string]string {
+	t.Helper()
+
+	fields := make(map[string]string)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read event: %v", err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return fields
+		}
+
+		name, value, _ := strings.Cut(line, ": ")
+		fields[name] = value
+	}
+}
+
+func TestEventsStream(t *testing.T) {
+	tests := []struct {
+		name string
+		// lastEventID returns the Last-Event-ID header for the ID of the
+		// first event published before the stream is opened.
+		lastEventID func(firstID uint64) string
+		wantStatus  int
+		// wantEvents are the types and task IDs of the events received
+		// before the event published after the stream is opened.
+		wantEvents []string
+	}{
+		{"new stream", func(uint64) string { return "" }, http.StatusOK, nil},
+		{"resume", func(firstID uint64) string { return fmt.Sprint(firstID) }, http.StatusOK, []string{TaskUpdatedEvent + " missed"}},
+		{"resume from a forgotten event", func(uint64) string { return "1" }, http.StatusOK, []string{resetEvent + " ", TaskCreatedEvent + " old", TaskUpdatedEvent + " missed"}},
+		{"invalid Last-Event-ID", func(uint64) string { return "latest" }, http.StatusBadRequest, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestServer(t, authDB{roles: map[string]string{"user": db.RoleUser}}, nil)
+			server := httptest.NewServer(s.mux)
+			defer server.Close()
+
+			token, err := s.jwtManager.GenerateJWtToken("user", db.RoleUser, "session", time.Minute)
+			if err != nil {
+				t.Fatalf("GenerateJWtToken error: %v", err)
+			}
+
+			// Events for other users are not sent.
+			s.events.publish(&TaskEvent{Type: TaskCreatedEvent, TaskID: "old", audience: []string{"user"}})
+			firstID := s.events.lastID
+			s.events.publish(&TaskEvent{Type: TaskCreatedEvent, TaskID: "other", audience: []string{"other"}})
+			s.events.publish(&TaskEvent{Type: TaskUpdatedEvent, TaskID: "missed", audience: []string{"user"}})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/events", nil)
+			if err != nil {
+				t.Fatalf("http.NewRequest error: %v", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+			if lastEventID := test.lastEventID(firstID); lastEventID != "" {
+				req.Header.Set("Last-Event-ID", lastEventID)
+			}
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("http.Do error: %v", err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != test.wantStatus {
+				t.Fatalf("want status %d, got %d", test.wantStatus, res.StatusCode)
+			}
+			if test.wantStatus != http.StatusOK {
+				return
+			}
+			if contentType := res.Header.Get("Content-Type"); contentType != "text/event-stream" {
+				t.Fatalf("want an event stream, got %s", contentType)
+			}
+
+			r := bufio.NewReader(res.Body)
+			if retry := readEvent(t, r)["retry"]; retry != fmt.Sprint(eventsRetryMillis) {
+				t.Fatalf("want retry %d, got %s", eventsRetryMillis, retry)
+			}
+
+			for _, want := range test.wantEvents {
+				event := readEvent(t, r)
+				if got := event["event"] + " " + taskIDOf(event["data"]); got != want {
+					t.Fatalf("want event %q, got %v", want, event)
+				}
+			}
+
+			s.events.publish(&TaskEvent{Type: TaskDeletedEvent, TaskID: "new", audience: []string{"user"}})
+			event := readEvent(t, r)
+			if event["event"] != TaskDeletedEvent || event["id"] != fmt.Sprint(s.events.lastID) || taskIDOf(event["data"]) != "new" {
+				t.Fatalf("want the new event, got %v", event)
+			}
+		})
+	}
+}
+
+// taskIDOf returns the task ID in the JSON data of an event.
+func taskIDOf(data string) string {
+	_, after, found := strings.Cut(data, `"taskID":"`)
+	if !found {
+		return ""
+	}
+	taskID, _, _ := strings.Cut(after, `"`)
+	return taskID
+}
@@ -0,0 +1,226 @@
+package webserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ukane-philemon/megtask/db"
+)
+
+const (
+	// feedProjectQueryKey is the expected query key to only include the
+	// tasks in a project in a calendar feed.
+	feedProjectQueryKey = "project"
+	// feedTagQueryKey is the expected query key to only include the tasks
+	// with a tag in a calendar feed.
+	feedTagQueryKey = "tag"
+	// feedTypeQueryKey is the expected query key to choose how tasks are
+	// written in a calendar feed.
+	feedTypeQueryKey = "type"
+
+	// feedTypeTodo writes tasks as to-dos, which have a completion state.
+	feedTypeTodo = "todo"
+	// feedTypeEvent writes tasks as events, for calendar apps that do not
+	// show to-dos.
+	feedTypeEvent = "event"
+)
+
+// handleCreateFeedToken handles the "POST /feed-tokens" endpoint and creates a
+// secret calendar feed URL for the user. The URL is returned only once.
+func (s *WebServer) handleCreateFeedToken(res http.ResponseWriter, req *http.Request) {
+	form := new(createFeedTokenRequest)
+	if !s.readPostBody(res, req, &form) {
+		return
+	}
+
+	err := form.Validate()
+	if err != nil {
+		s.writeBadRequest(res, err.Error())
+		return
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("randomToken error: %w", err))
+		return
+	}
+
+	userID := s.reqUserID(req)
+	feedToken, err := s.taskDB.CreateFeedToken(userID, form.Name, token)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.CreateFeedToken error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"feedURL":   fmt.Sprintf("%s/feeds/%s.ics", s.baseURL, token),
+		"feedToken": feedToken,
+		"message":   "Feed created. Anyone with the feed URL can see your tasks, it will not be shown again.",
+	})
+}
+
+// handleRetrieveFeedTokens handles the "GET /feed-tokens" endpoint and returns
+// the user's calendar feed tokens.
+func (s *WebServer) handleRetrieveFeedTokens(res http.ResponseWriter, req *http.Request) {
+	userID := s.reqUserID(req)
+	feedTokens, err := s.taskDB.FeedTokens(userID)
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("taskDB.FeedTokens error: %w", err))
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"feedTokens": feedTokens,
+	})
+}
+
+// handleRevokeFeedToken handles the "DELETE /feed-tokens/{tokenID}" endpoint
+// and revokes one of the user's calendar feed tokens. The feed URL stops
+// working immediately.
+func (s *WebServer) handleRevokeFeedToken(res http.ResponseWriter, req *http.Request) {
+	tokenID := chi.URLParam(req, "tokenID")
+	userID := s.reqUserID(req)
+	err := s.taskDB.RevokeFeedToken(userID, tokenID)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.RevokeFeedToken error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]string{
+		"message": "Feed token revoked.",
+	})
+}
+
+// handleRetrieveFeed handles the "GET /feeds/{token}.ics" endpoint and returns
+// an iCalendar feed of the tasks with due dates the feed token's user owns,
+// is assigned or has been shared with. The feed is authenticated by the
+// token in the URL so calendar apps can subscribe to it. This endpoint
+// accepts optional "project", "tag" and "status" query parameters to filter
+// tasks, and an optional "type" query parameter that can be "todo" (the
+// default) or "event".
+func (s *WebServer) handleRetrieveFeed(res http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	project, tag := query.Get(feedProjectQueryKey), query.Get(feedTagQueryKey)
+
+	status := query.Get(taskStatusQueryKey)
+	if status != "" && !strings.EqualFold(status, pendingTasksFilter) && !strings.EqualFold(status, completedTasksFilter) {
+		s.writeBadRequest(res, `"status" query param can either be "pending" or "completed"`)
+		return
+	}
+
+	component := icsComponentTodo
+	switch query.Get(feedTypeQueryKey) {
+	case "", feedTypeTodo:
+	case feedTypeEvent:
+		component = icsComponentEvent
+	default:
+		s.writeBadRequest(res, `"type" query param can either be "todo" or "event"`)
+		return
+	}
+
+	userID, err := s.taskDB.FeedTokenOwner(chi.URLParam(req, "token"))
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeJSONResponse(res, http.StatusNotFound, map[string]string{"errorMessage": "feed not found"})
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.FeedTokenOwner error: %w", err))
+		}
+		return
+	}
+
+	tasks, err := s.feedTasks(userID)
+	if err != nil {
+		s.writeServerError(res, err)
+		return
+	}
+
+	completed := completedFilter(status)
+	feedTasks := make([]*db.Task, 0, len(tasks))
+	for _, task := range tasks {
+		if project != "" && task.Project != project {
+			continue
+		}
+		if tag != "" && !hasTag(task, tag) {
+			continue
+		}
+		if completed != nil && task.Completed != *completed {
+			continue
+		}
+		feedTasks = append(feedTasks, task)
+	}
+
+	name := "Megtask"
+	if project != "" {
+		name += " - " + project
+	}
+	if tag != "" {
+		name += " #" + tag
+	}
+
+	res.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	res.WriteHeader(http.StatusOK)
+	res.Write(taskCalendar(name, feedTasks, component, s.feedUIDDomain()))
+}
+
+// feedTasks returns the tasks the user with the provided userID owns, is
+// assigned or has been shared with, without duplicates.
+func (s *WebServer) feedTasks(userID string) ([]*db.Task, error) {
+	ownTasks, err := s.taskDB.Tasks(userID)
+	if err != nil {
+		return nil, fmt.Errorf("taskDB.Tasks error: %w", err)
+	}
+
+	sharedTasks, err := s.taskDB.SharedTasks(userID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("taskDB.SharedTasks error: %w", err)
+	}
+
+	assignedTasks, err := s.taskDB.AssignedTasks(userID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("taskDB.AssignedTasks error: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	var tasks []*db.Task
+	for _, list := range [][]*db.Task{ownTasks, sharedTasks, assignedTasks} {
+		for _, task := range list {
+			if !seen[task.ID] {
+				seen[task.ID] = true
+				tasks = append(tasks, task)
+			}
+		}
+	}
+
+	return tasks, nil
+}
+
+// feedUIDDomain returns the domain added to task IDs in calendar feeds.
+func (s *WebServer) feedUIDDomain() string {
+	baseURL, err := url.Parse(s.baseURL)
+	if err != nil || baseURL.Hostname() == "" {
+		return "megtask"
+	}
+	return baseURL.Hostname()
+}
+
+// hasTag returns true if task has the provided tag.
+func hasTag(task *db.Task, tag string) bool {
+	for _, taskTag := range task.Tags {
+		if taskTag == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package webserver
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+// feedsDB is a TaskDatabase with the feed token "secret" of "user", who owns
+// and was shared and assigned tasks with due dates.
+type feedsDB struct {
+	authDB
+}
+
+func (feedsDB) FeedTokenOwner(token string) (string, error) {
+	if token != "secret" {
+		return "", db.ErrorInvalidRequest
+	}
+	return "user", nil
+}
+
+func (feedsDB) Tasks(userID string) ([]*db.Task, error) {
+	return []*db.Task{
+		{ID: "own", TaskInfo: db.TaskInfo{Detail: "own", DueAt: 1, Project: "work", Tags: []string{"urgent"}}},
+		{ID: "done", TaskInfo: db.TaskInfo{Detail: "done", DueAt: 1, Completed: true}},
+		{ID: "someday", TaskInfo: db.TaskInfo{Detail: "someday"}},
+	}, nil
+}
+
+func (feedsDB) SharedTasks(userID string, completed *bool) ([]*db.Task, error) {
+	return []*db.Task{{ID: "shared", TaskInfo: db.TaskInfo{Detail: "shared", DueAt: 1, Project: "work"}}}, nil
+}
+
+func (feedsDB) AssignedTasks(userID string, completed *bool) ([]*db.Task, error) {
+	// Assigned tasks can also be shared with the user.
+	return []*db.Task{
+		{ID: "shared", TaskInfo: db.TaskInfo{Detail: "shared", DueAt: 1, Project: "work"}},
+		{ID: "assigned", TaskInfo: db.TaskInfo{Detail: "assigned", DueAt: 1, Tags: []string{"urgent"}}},
+	}, nil
+}
+
+func TestRetrieveFeed(t *testing.T) {
+	s := newTestServer(t, feedsDB{}, &Config{BaseURL: "https://tasks.example.com"})
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantName   string
+		// wantTasks are the IDs of the tasks in the feed, in order.
+		wantTasks     []string
+		wantComponent string
+	}{
+		{"unknown token", "/feeds/guess.ics", http.StatusNotFound, "", nil, ""},
+		{"all tasks", "/feeds/secret.ics", http.StatusOK, "Megtask", []string{"own", "done", "shared", "assigned"}, icsComponentTodo},
+		{"events", "/feeds/secret.ics?type=event", http.StatusOK, "Megtask", []string{"own", "done", "shared", "assigned"}, icsComponentEvent},
+		{"project", "/feeds/secret.ics?project=work", http.StatusOK, "Megtask - work", []string{"own", "shared"}, icsComponentTodo},
+		{"tag", "/feeds/secret.ics?tag=urgent", http.StatusOK, "Megtask #urgent", []string{"own", "assigned"}, icsComponentTodo},
+		{"completed tasks", "/feeds/secret.ics?status=COMPLETED", http.StatusOK, "Megtask", []string{"done"}, icsComponentTodo},
+		{"pending tasks in a project", "/feeds/secret.ics?status=pending&project=work&type=todo", http.StatusOK, "Megtask - work", []string{"own", "shared"}, icsComponentTodo},
+		{"unknown status", "/feeds/secret.ics?status=done", http.StatusBadRequest, "", nil, ""},
+		{"unknown type", "/feeds/secret.ics?type=journal", http.StatusBadRequest, "", nil, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := testRequest(t, s, http.MethodGet, test.path, "", nil)
+			checkStatus(t, res, test.wantStatus)
+			if test.wantStatus != http.StatusOK {
+				return
+			}
+
+			if contentType := res.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/calendar") {
+				t.Fatalf("want a calendar, got %s", contentType)
+			}
+
+			var name, component string
+			var tasks []string
+			for _, line := range strings.Split(res.Body.String(), "\r\n") {
+				property, value, _ := strings.Cut(line, ":")
+				switch property {
+				case "X-WR-CALNAME":
+					name = value
+				case "BEGIN":
+					if value != "VCALENDAR" {
+						component = value
+					}
+				case "UID":
+					// UIDs are made unique with the server's host name.
+					taskID, domain, _ := strings.Cut(value, "@")
+					if domain != "tasks.example.com" {
+						t.Fatalf("want UID domain tasks.example.com, got %s", value)
+					}
+					tasks = append(tasks, taskID)
+				}
+			}
+
+			if name != test.wantName || component != test.wantComponent {
+				t.Fatalf("want calendar %q of %s, got %q of %s", test.wantName, test.wantComponent, name, component)
+			}
+			if strings.Join(tasks, ",") != strings.Join(test.wantTasks, ",") {
+				t.Fatalf("want tasks %v, got %v", test.wantTasks, tasks)
+			}
+		})
+	}
+}
@@ -0,0 +1,647 @@
+package webserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/ukane-philemon/megtask/db"
+)
+
+const (
+	// graphQLMaxDepth is the maximum nesting of the fields selected in a
+	// GraphQL request.
+	graphQLMaxDepth = 6
+	// graphQLMaxComplexity is the maximum complexity of a GraphQL request.
+	// Each field costs 1, and the fields of lists are counted once for each
+	// item the list can have.
+	graphQLMaxComplexity = 2000
+
+	// defaultGraphQLPageSize and maxGraphQLPageSize are the default and
+	// maximum number of tasks returned by the tasks query.
+	defaultGraphQLPageSize = 50
+	maxGraphQLPageSize     = 100
+
+	// graphQLRequestCtxKey is the context key for the HTTP request of a
+	// GraphQL request, which resolvers use to authorize the user.
+	graphQLRequestCtxKey = "graphQLRequest"
+)
+
+const (
+	sortByCreatedAt = "createdAt"
+	sortByDueAt     = "dueAt"
+	sortByUpdatedAt = "updatedAt"
+	sortByDetail    = "detail"
+
+	sortAscending  = "asc"
+	sortDescending = "desc"
+)
+
+// graphQLTaskPage is a page of the tasks matching a tasks query.
+type graphQLTaskPage struct {
+	Tasks      []*db.Task `json:"tasks"`
+	TotalCount int        `json:"totalCount"`
+	HasMore    bool       `json:"hasMore"`
+}
+
+// handleGraphQL handles the "POST /graphql" endpoint and executes a GraphQL
+// query or mutation. Requests deeper than graphQLMaxDepth or more complex
+// than graphQLMaxComplexity are rejected before they are executed. Requests
+// authenticated with an api token need the "tasks:read" scope to read tasks
+// and the "tasks:write" scope to change them.
+func (s *WebServer) handleGraphQL(res http.ResponseWriter, req *http.Request) {
+	form := new(graphQLQueryRequest)
+	if !s.readPostBody(res, req, &form) {
+		return
+	}
+
+	if strings.TrimSpace(form.Query) == "" {
+		s.writeBadRequest(res, "missing query")
+		return
+	}
+
+	// Requests that are not executed have no data in their response.
+	doc, err := parser.Parse(parser.ParseParams{Source: form.Query})
+	if err != nil {
+		s.writeJSONResponse(res, http.StatusBadRequest, map[string]any{"errors": gqlerrors.FormatErrors(err)})
+		return
+	}
+
+	validation := graphql.ValidateDocument(s.graphQL, doc, nil)
+	if !validation.IsValid {
+		s.writeJSONResponse(res, http.StatusBadRequest, map[string]any{"errors": validation.Errors})
+		return
+	}
+
+	err = checkGraphQLLimits(s.graphQL, doc, form.OperationName, form.Variables)
+	if err != nil {
+		s.writeJSONResponse(res, http.StatusBadRequest, map[string]any{"errors": gqlerrors.FormatErrors(err)})
+		return
+	}
+
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        *s.graphQL,
+		AST:           doc,
+		OperationName: form.OperationName,
+		Args:          form.Variables,
+		Context:       context.WithValue(req.Context(), graphQLRequestCtxKey, req),
+	})
+	s.writeJSONResponse(res, http.StatusOK, result)
+}
+
+// graphQLRequest returns the HTTP request of a GraphQL request, and an error
+// if it was authenticated with an api token without the provided scope. No
+// scope is checked if scope is empty.
+func graphQLRequest(ctx context.Context, scope string) (*http.Request, error) {
+	req, ok := ctx.Value(graphQLRequestCtxKey).(*http.Request)
+	if !ok {
+		return nil, errors.New("not authorized")
+	}
+
+	if scope != "" && !reqHasScope(req, scope) {
+		return nil, fmt.Errorf("api token is missing the %q scope", scope)
+	}
+
+	return req, nil
+}
+
+// graphQLError returns the error of a resolver. Errors are sent to the
+// client, so internal errors are logged and replaced with a generic message.
+func (s *WebServer) graphQLError(method string, err error) error {
+	if errors.Is(err, db.ErrorInvalidRequest) {
+		return err
+	}
+	s.log.Error("Server error: ", "err", fmt.Errorf("%s error: %w", method, err))
+	return errors.New("Something unexpected happened, please try again later.")
+}
+
+// newGraphQLSchema returns the schema of the GraphQL API.
+func (s *WebServer) newGraphQLSchema() (*graphql.Schema, error) {
+	timestampType := graphql.NewScalar(graphql.ScalarConfig{
+		Name:        "Timestamp",
+		Description: "A unix time. Fields state whether it is in seconds or milliseconds.",
+		Serialize: func(v any) any {
+			n, ok := v.(int64)
+			if !ok {
+				return nil
+			}
+			return n
+		},
+		ParseValue: func(v any) any {
+			n, ok := v.(float64)
+			if !ok || n != math.Trunc(n) || math.Abs(n) > 1<<53 {
+				return nil
+			}
+			return int64(n)
+		},
+		ParseLiteral: func(v ast.Value) any {
+			literal, ok := v.(*ast.IntValue)
+			if !ok {
+				return nil
+			}
+			n, err := strconv.ParseInt(literal.Value, 10, 64)
+			if err != nil {
+				return nil
+			}
+			return n
+		},
+	})
+
+	taskStatusType := graphql.NewEnum(graphql.EnumConfig{
+		Name: "TaskStatus",
+		Values: graphql.EnumValueConfigMap{
+			"PENDING":   {Value: pendingTasksFilter},
+			"COMPLETED": {Value: completedTasksFilter},
+		},
+	})
+
+	taskScopeType := graphql.NewEnum(graphql.EnumConfig{
+		Name:        "TaskScope",
+		Description: "Which of the user's tasks to return.",
+		Values: graphql.EnumValueConfigMap{
+			"OWN":      {Description: "The tasks the user created.", Value: ownTasksScope},
+			"SHARED":   {Description: "The tasks other users have shared with the user.", Value: sharedTasksScope},
+			"ASSIGNED": {Description: "The tasks assigned to the user.", Value: assignedTasksScope},
+		},
+	})
+
+	taskSortFieldType := graphql.NewEnum(graphql.EnumConfig{
+		Name: "TaskSortField",
+		Values: graphql.EnumValueConfigMap{
+			"CREATED_AT": {Value: sortByCreatedAt},
+			"DUE_AT":     {Description: "Tasks without a due date are last.", Value: sortByDueAt},
+			"UPDATED_AT": {Value: sortByUpdatedAt},
+			"DETAIL":     {Value: sortByDetail},
+		},
+	})
+
+	sortDirectionType := graphql.NewEnum(graphql.EnumConfig{
+		Name: "SortDirection",
+		Values: graphql.EnumValueConfigMap{
+			"ASC":  {Value: sortAscending},
+			"DESC": {Value: sortDescending},
+		},
+	})
+
+	userType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.Fields{
+			"id":                 {Type: graphql.NewNonNull(graphql.ID)},
+			"username":           {Type: graphql.NewNonNull(graphql.String)},
+			"email":              {Type: graphql.String, Resolve: optionalString(func(user *db.UserSummary) string { return user.Email })},
+			"role":               {Type: graphql.NewNonNull(graphql.String)},
+			"twoFactorEnabled":   {Type: graphql.NewNonNull(graphql.Boolean)},
+			"createdAt":          {Description: "When the account was created, in unix seconds.", Type: graphql.NewNonNull(timestampType)},
+			"taskCount":          {Type: graphql.NewNonNull(graphql.Int)},
+			"completedTaskCount": {Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	// The fields of db.TaskInfo are embedded in db.Task, so they need their
+	// own resolvers.
+	taskType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Task",
+		Fields: graphql.Fields{
+			"id": {Type: graphql.NewNonNull(graphql.ID)},
+			"detail": {
+				Type:    graphql.NewNonNull(graphql.String),
+				Resolve: taskInfoField(func(task *db.TaskInfo) any { return task.Detail }),
+			},
+			"completed": {
+				Type:    graphql.NewNonNull(graphql.Boolean),
+				Resolve: taskInfoField(func(task *db.TaskInfo) any { return task.Completed }),
+			},
+			"createdAt": {
+				Description: "When the task was created, in unix seconds.",
+				Type:        graphql.NewNonNull(timestampType),
+				Resolve:     taskInfoField(func(task *db.TaskInfo) any { return task.Timestamp }),
+			},
+			"updatedAt": {
+				Description: "When the task was last changed, in unix milliseconds.",
+				Type:        timestampType,
+				Resolve:     optionalTimestamp(func(task *db.Task) int64 { return task.UpdatedAt }),
+			},
+			"project": {Type: graphql.String, Resolve: optionalString(func(task *db.Task) string { return task.Project })},
+			"dueAt": {
+				Description: "When the task is due, in unix seconds.",
+				Type:        timestampType,
+				Resolve:     optionalTimestamp(func(task *db.Task) int64 { return task.DueAt }),
+			},
+			"tags": {
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))),
+				Resolve: taskInfoField(func(task *db.TaskInfo) any {
+					if task.Tags == nil {
+						return []string{}
+					}
+					return task.Tags
+				}),
+			},
+			"recurrence": {
+				Description: "An RFC 5545 recurrence rule that repeats the task from its due date.",
+				Type:        graphql.String,
+				Resolve:     optionalString(func(task *db.Task) string { return task.Recurrence }),
+			},
+			"ownerID": {
+				Description: "The user that created the task. Only set for shared and workspace tasks.",
+				Type:        graphql.ID,
+				Resolve:     optionalString(func(task *db.Task) string { return task.OwnerID }),
+			},
+			"permission": {
+				Description: "The user's permission on a task shared with them.",
+				Type:        graphql.String,
+				Resolve:     optionalString(func(task *db.Task) string { return task.Permission }),
+			},
+			"workspaceID":  {Type: graphql.ID, Resolve: optionalString(func(task *db.Task) string { return task.WorkspaceID })},
+			"assigneeID":   {Type: graphql.ID, Resolve: optionalString(func(task *db.Task) string { return task.AssigneeID })},
+			"commentCount": {Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	taskPageType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "TaskPage",
+		Fields: graphql.Fields{
+			"tasks":      {Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(taskType)))},
+			"totalCount": {Description: "The number of tasks matching the query.", Type: graphql.NewNonNull(graphql.Int)},
+			"hasMore":    {Description: "Whether there are tasks after this page.", Type: graphql.NewNonNull(graphql.Boolean)},
+		},
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"me": {
+				Description: "The current user.",
+				Type:        graphql.NewNonNull(userType),
+				Resolve:     s.resolveGraphQLMe,
+			},
+			"task": {
+				Description: "A task the user owns, has been assigned or has been shared with.",
+				Type:        taskType,
+				Args: graphql.FieldConfigArgument{
+					"id": {Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: s.resolveGraphQLTask,
+			},
+			// The complexity of the tasks query depends on its limit, see
+			// graphQLLimits.fieldComplexity.
+			"tasks": {
+				Description: "A page of the user's tasks.",
+				Type:        graphql.NewNonNull(taskPageType),
+				Args: graphql.FieldConfigArgument{
+					"scope":         {Type: taskScopeType, DefaultValue: ownTasksScope},
+					"status":        {Type: taskStatusType},
+					"project":       {Description: `Only return the tasks in a project, or the tasks without a project if "".`, Type: graphql.String},
+					"tag":           {Description: "Only return the tasks with a tag.", Type: graphql.String},
+					"sortBy":        {Type: taskSortFieldType, DefaultValue: sortByCreatedAt},
+					"sortDirection": {Type: sortDirectionType, DefaultValue: sortAscending},
+					"offset":        {Type: graphql.Int, DefaultValue: 0},
+					"limit":         {Description: fmt.Sprintf("At most %d.", maxGraphQLPageSize), Type: graphql.Int, DefaultValue: defaultGraphQLPageSize},
+				},
+				Resolve: s.resolveGraphQLTasks,
+			},
+		},
+	})
+
+	createTaskInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "CreateTaskInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"detail":     {Type: graphql.NewNonNull(graphql.String)},
+			"project":    {Type: graphql.String},
+			"dueAt":      {Description: "When the task is due, in unix seconds.", Type: timestampType},
+			"tags":       {Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+			"recurrence": {Description: "An RFC 5545 recurrence rule. Recurring tasks must have a due date.", Type: graphql.String},
+		},
+	})
+
+	updateTaskInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:        "UpdateTaskInput",
+		Description: `The changes to make to a task. Omitted fields are not changed, and "", 0 or [] removes the task's project, due date, tags or recurrence rule.`,
+		Fields: graphql.InputObjectConfigFieldMap{
+			"detail":     {Type: graphql.String},
+			"project":    {Type: graphql.String},
+			"dueAt":      {Description: "When the task is due, in unix seconds.", Type: timestampType},
+			"tags":       {Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+			"recurrence": {Type: graphql.String},
+		},
+	})
+
+	idArgs := graphql.FieldConfigArgument{
+		"id": {Type: graphql.NewNonNull(graphql.ID)},
+	}
+
+	mutationType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createTask": {
+				Type: graphql.NewNonNull(taskType),
+				Args: graphql.FieldConfigArgument{
+					"input": {Type: graphql.NewNonNull(createTaskInputType)},
+				},
+				Resolve: s.resolveGraphQLCreateTask,
+			},
+			"updateTask": {
+				Type: graphql.NewNonNull(taskType),
+				Args: graphql.FieldConfigArgument{
+					"id":    {Type: graphql.NewNonNull(graphql.ID)},
+					"input": {Type: graphql.NewNonNull(updateTaskInputType)},
+				},
+				Resolve: s.resolveGraphQLUpdateTask,
+			},
+			"completeTask": {
+				Description: "Marks a task as completed. Completed tasks cannot be changed.",
+				Type:        graphql.NewNonNull(taskType),
+				Args:        idArgs,
+				Resolve:     s.resolveGraphQLCompleteTask,
+			},
+			"deleteTask": {
+				Description: "Deletes a task and returns its ID.",
+				Type:        graphql.NewNonNull(graphql.ID),
+				Args:        idArgs,
+				Resolve:     s.resolveGraphQLDeleteTask,
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query:    queryType,
+		Mutation: mutationType,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &schema, nil
+}
+
+// taskInfoField returns a resolver for a field of the db.TaskInfo of a task.
+func taskInfoField(value func(*db.TaskInfo) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return value(&p.Source.(*db.Task).TaskInfo), nil
+	}
+}
+
+// optionalString returns a resolver for a string field of T that is null
+// when it is empty.
+func optionalString[T any](value func(*T) string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		if s := value(p.Source.(*T)); s != "" {
+			return s, nil
+		}
+		return nil, nil
+	}
+}
+
+// optionalTimestamp returns a resolver for a timestamp field of T that is
+// null when it is zero.
+func optionalTimestamp[T any](value func(*T) int64) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		if t := value(p.Source.(*T)); t != 0 {
+			return t, nil
+		}
+		return nil, nil
+	}
+}
+
+// resolveGraphQLMe resolves the "me" query.
+func (s *WebServer) resolveGraphQLMe(p graphql.ResolveParams) (any, error) {
+	req, err := graphQLRequest(p.Context, "")
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.taskDB.UserSummary(s.reqUserID(req))
+	if err != nil {
+		return nil, s.graphQLError("taskDB.UserSummary", err)
+	}
+
+	return user, nil
+}
+
+// resolveGraphQLTask resolves the "task" query.
+func (s *WebServer) resolveGraphQLTask(p graphql.ResolveParams) (any, error) {
+	req, err := graphQLRequest(p.Context, scopeTasksRead)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks, err := s.feedTasks(s.reqUserID(req))
+	if err != nil {
+		return nil, s.graphQLError("feedTasks", err)
+	}
+
+	return findTask(tasks, p.Args["id"].(string)), nil
+}
+
+// resolveGraphQLTasks resolves the "tasks" query.
+func (s *WebServer) resolveGraphQLTasks(p graphql.ResolveParams) (any, error) {
+	req, err := graphQLRequest(p.Context, scopeTasksRead)
+	if err != nil {
+		return nil, err
+	}
+
+	// Arguments set to null are given their default value.
+	offset, _ := p.Args["offset"].(int)
+	limit, ok := p.Args["limit"].(int)
+	if !ok {
+		limit = defaultGraphQLPageSize
+	}
+	if offset < 0 {
+		return nil, errors.New("offset cannot be negative")
+	}
+	if limit < 1 || limit > maxGraphQLPageSize {
+		return nil, fmt.Errorf("limit must be between 1 and %d", maxGraphQLPageSize)
+	}
+
+	scope, _ := p.Args["scope"].(string)
+	status, _ := p.Args["status"].(string)
+	tasks, err := s.scopedTasks(s.reqUserID(req), scope, completedFilter(status))
+	if err != nil {
+		return nil, s.graphQLError("scopedTasks", err)
+	}
+
+	var project, tag *string
+	if value, ok := p.Args["project"].(string); ok {
+		project = &value
+	}
+	if value, ok := p.Args["tag"].(string); ok {
+		tag = &value
+	}
+	filteredTasks := filterTasks(tasks, project, tag)
+
+	sortBy, _ := p.Args["sortBy"].(string)
+	sortTasks(filteredTasks, sortBy, p.Args["sortDirection"] == sortDescending)
+
+	page := &graphQLTaskPage{Tasks: []*db.Task{}, TotalCount: len(filteredTasks)}
+	if offset < len(filteredTasks) {
+		end := min(offset+limit, len(filteredTasks))
+		page.Tasks = filteredTasks[offset:end]
+		page.HasMore = end < len(filteredTasks)
+	}
+
+	return page, nil
+}
+
+// sortTasks sorts tasks by the provided field. Tasks without a due date are
+// last when sorting by due date, and ties keep their order.
+func sortTasks(tasks []*db.Task, sortBy string, descending bool) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		a, b := tasks[i], tasks[j]
+		if sortBy == sortByDueAt && (a.DueAt == 0 || b.DueAt == 0) {
+			return a.DueAt != 0 && b.DueAt == 0
+		}
+
+		if descending {
+			a, b = b, a
+		}
+
+		switch sortBy {
+		case sortByDueAt:
+			return a.DueAt < b.DueAt
+		case sortByUpdatedAt:
+			return a.UpdatedAt < b.UpdatedAt
+		case sortByDetail:
+			return strings.ToLower(a.Detail) < strings.ToLower(b.Detail)
+		default:
+			return a.Timestamp < b.Timestamp
+		}
+	})
+}
+
+// resolveGraphQLCreateTask resolves the "createTask" mutation.
+func (s *WebServer) resolveGraphQLCreateTask(p graphql.ResolveParams) (any, error) {
+	req, err := graphQLRequest(p.Context, scopeTasksWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	input := p.Args["input"].(map[string]any)
+	form := &createTaskRequest{TaskDetail: input["detail"].(string)}
+	form.Project, _ = input["project"].(string)
+	form.DueAt, _ = input["dueAt"].(int64)
+	form.Tags = stringList(input["tags"])
+	form.Recurrence, _ = input["recurrence"].(string)
+
+	if err := form.Validate(); err != nil {
+		return nil, err
+	}
+
+	task, userTasks, err := s.taskDB.CreateTask(s.reqUserID(req), form.TaskDetail, form.Project, form.DueAt, form.Tags, form.Recurrence)
+	if err != nil {
+		return nil, s.graphQLError("taskDB.CreateTask", err)
+	}
+
+	s.publishTaskEvent(TaskCreatedEvent, task.ID, userTasks)
+
+	return task, nil
+}
+
+// resolveGraphQLUpdateTask resolves the "updateTask" mutation.
+func (s *WebServer) resolveGraphQLUpdateTask(p graphql.ResolveParams) (any, error) {
+	input := p.Args["input"].(map[string]any)
+	form := new(updateTaskRequest)
+	if detail, ok := input["detail"]; ok {
+		form.TaskDetail, _ = detail.(string)
+		if form.TaskDetail == "" {
+			return nil, errors.New("detail cannot be empty")
+		}
+	}
+
+	// Empty fields are removed from the task, as in the REST API.
+	if project, ok := input["project"]; ok {
+		project, _ := project.(string)
+		form.Project = &project
+	}
+	if dueAt, ok := input["dueAt"]; ok {
+		dueAt, _ := dueAt.(int64)
+		form.DueAt = &dueAt
+	}
+	if tags, ok := input["tags"]; ok {
+		tags := stringList(tags)
+		form.Tags = &tags
+	}
+	if recurrence, ok := input["recurrence"]; ok {
+		recurrence, _ := recurrence.(string)
+		form.Recurrence = &recurrence
+	}
+
+	return s.updateGraphQLTask(p, form)
+}
+
+// resolveGraphQLCompleteTask resolves the "completeTask" mutation.
+func (s *WebServer) resolveGraphQLCompleteTask(p graphql.ResolveParams) (any, error) {
+	return s.updateGraphQLTask(p, &updateTaskRequest{MarkAsCompleted: true})
+}
+
+// updateGraphQLTask updates the task with the ID in the "id" argument and
+// returns the updated task.
+func (s *WebServer) updateGraphQLTask(p graphql.ResolveParams, form *updateTaskRequest) (any, error) {
+	req, err := graphQLRequest(p.Context, scopeTasksWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := form.Validate(); err != nil {
+		return nil, err
+	}
+
+	taskID := p.Args["id"].(string)
+	userTasks, err := s.taskDB.UpdateTask(s.reqUserID(req), taskID, form.taskUpdate())
+	if err != nil {
+		return nil, s.graphQLError("taskDB.UpdateTask", err)
+	}
+
+	s.publishTaskEvent(TaskUpdatedEvent, taskID, userTasks)
+
+	task := findTask(userTasks, taskID)
+	if task == nil {
+		return nil, s.graphQLError("taskDB.UpdateTask", fmt.Errorf("updated task %s is not in the returned tasks", taskID))
+	}
+
+	return task, nil
+}
+
+// resolveGraphQLDeleteTask resolves the "deleteTask" mutation.
+func (s *WebServer) resolveGraphQLDeleteTask(p graphql.ResolveParams) (any, error) {
+	req, err := graphQLRequest(p.Context, scopeTasksWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	taskID := p.Args["id"].(string)
+	_, err = s.deleteTask(p.Context, s.reqUserID(req), taskID)
+	if err != nil {
+		return nil, s.graphQLError("deleteTask", err)
+	}
+
+	return taskID, nil
+}
+
+// findTask returns the task with the provided taskID in tasks, or nil if
+// there is none.
+func findTask(tasks []*db.Task, taskID string) *db.Task {
+	for _, task := range tasks {
+		if task.ID == taskID {
+			return task
+		}
+	}
+	return nil
+}
+
+// stringList returns the strings in a GraphQL list value.
+func stringList(value any) []string {
+	items, _ := value.([]any)
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		list = append(list, item.(string))
+	}
+	return list
+}
@@ -0,0 +1,393 @@
+package webserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+// graphQLDB is a TaskDatabase with the tasks of "user".
+type graphQLDB struct {
+	authDB
+}
+
+func (graphQLDB) UserSummary(userID string) (*db.UserSummary, error) {
+	return &db.UserSummary{ID: userID, Username: "ada", Role: db.RoleUser, TaskCount: 3, CompletedTaskCount: 1}, nil
+}
+
+func (gdb graphQLDB) Tasks(userID string) ([]*db.Task, error) {
+	return []*db.Task{
+		{ID: "milk", TaskInfo: db.TaskInfo{Detail: "Buy milk", Project: "work", Timestamp: 3}},
+		{ID: "call", TaskInfo: db.TaskInfo{Detail: "call mom", DueAt: 20, Timestamp: 1}},
+		{ID: "apply", TaskInfo: db.TaskInfo{Detail: "Apply", DueAt: 10, Completed: true, Timestamp: 2}},
+	}, nil
+}
+
+func (gdb graphQLDB) TasksWithStatus(userID string, completed bool) ([]*db.Task, error) {
+	tasks, _ := gdb.Tasks(userID)
+	var filtered []*db.Task
+	for _, task := range tasks {
+		if task.Completed == completed {
+			filtered = append(filtered, task)
+		}
+	}
+	return filtered, nil
+}
+
+func (graphQLDB) SharedTasks(userID string, completed *bool) ([]*db.Task, error) {
+	return nil, nil
+}
+
+func (graphQLDB) AssignedTasks(userID string, completed *bool) ([]*db.Task, error) {
+	return nil, nil
+}
+
+func (gdb graphQLDB) UpdateTask(userID, taskID string, taskUpdate *db.TaskUpdate) ([]*db.Task, error) {
+	tasks, _ := gdb.Tasks(userID)
+	task := findTask(tasks, taskID)
+	if task == nil {
+		return nil, db.ErrorInvalidRequest
+	}
+
+	if taskUpdate.Detail != "" {
+		task.Detail = taskUpdate.Detail
+	}
+	if taskUpdate.MarkAsComplete != nil {
+		task.Completed = *taskUpdate.MarkAsComplete
+	}
+	if taskUpdate.Project != nil {
+		task.Project = *taskUpdate.Project
+	}
+	if taskUpdate.DueAt != nil {
+		task.DueAt = *taskUpdate.DueAt
+	}
+	if taskUpdate.Tags != nil {
+		task.Tags = *taskUpdate.Tags
+	}
+	if taskUpdate.Recurrence != nil {
+		task.Recurrence = *taskUpdate.Recurrence
+	}
+	return tasks, nil
+}
+
+func (graphQLDB) TaskAudience(taskID string) ([]string, error) {
+	return []string{"user"}, nil
+}
+
+func (graphQLDB) CreateTask(userID string, taskDetail, project string, dueAt int64, tags []string, recurrence string) (*db.Task, []*db.Task, error) {
+	task := &db.Task{ID: "new", TaskInfo: db.TaskInfo{Detail: taskDetail, Project: project, DueAt: dueAt, Tags: tags}}
+	return task, []*db.Task{task}, nil
+}
+
+func TestGraphQL(t *testing.T) {
+	const (
+		readToken  = apiTokenPrefix + "read"
+		writeToken = apiTokenPrefix + "write"
+	)
+	gdb := graphQLDB{authDB{roles: map[string]string{"user": db.RoleUser}, scopes: map[string][]string{
+		readToken:  {scopeTasksRead},
+		writeToken: {scopeTasksWrite},
+	}}}
+	s := newTestServer(t, gdb, nil)
+
+	loginToken, err := s.jwtManager.GenerateJWtToken("user", db.RoleUser, "session", time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateJWtToken error: %v", err)
+	}
+
+	// allTaskFields selects every field of a task, and has a complexity of
+	// 15.
+	allTaskFields := "id detail completed createdAt updatedAt project dueAt tags recurrence ownerID permission workspaceID assigneeID commentCount __typename"
+
+	tests := []struct {
+		name       string
+		token      string
+		query      string
+		variables  map[string]any
+		wantStatus int
+		// wantData is the JSON of the data of the response. It is empty if
+		// the response has no data.
+		wantData string
+		// wantError is a part of the first error of the response.
+		wantError string
+	}{
+		{
+			name:       "unauthenticated",
+			query:      `{ me { id } }`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "missing query",
+			token:      loginToken,
+			query:      " ",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "me",
+			token:      loginToken,
+			query:      `{ me { id username email taskCount } }`,
+			wantStatus: http.StatusOK,
+			wantData:   `{"me":{"email":null,"id":"user","taskCount":3,"username":"ada"}}`,
+		},
+		{
+			name:       "tasks",
+			token:      loginToken,
+			query:      `{ tasks { tasks { id dueAt } totalCount hasMore } }`,
+			wantStatus: http.StatusOK,
+			wantData:   `{"tasks":{"hasMore":false,"tasks":[{"dueAt":20,"id":"call"},{"dueAt":10,"id":"apply"},{"dueAt":null,"id":"milk"}],"totalCount":3}}`,
+		},
+		{
+			name:       "tasks by due date",
+			token:      readToken,
+			query:      `{ tasks(sortBy: DUE_AT) { tasks { id } } }`,
+			wantStatus: http.StatusOK,
+			wantData:   `{"tasks":{"tasks":[{"id":"apply"},{"id":"call"},{"id":"milk"}]}}`,
+		},
+		{
+			name:       "tasks by detail descending",
+			token:      loginToken,
+			query:      `{ tasks(sortBy: DETAIL, sortDirection: DESC) { tasks { id } } }`,
+			wantStatus: http.StatusOK,
+			wantData:   `{"tasks":{"tasks":[{"id":"call"},{"id":"milk"},{"id":"apply"}]}}`,
+		},
+		{
+			name:       "filtered tasks",
+			token:      loginToken,
+			query:      `query Pending($project: String) { tasks(status: PENDING, project: $project) { tasks { id } totalCount } }`,
+			variables:  map[string]any{"project": "work"},
+			wantStatus: http.StatusOK,
+			wantData:   `{"tasks":{"tasks":[{"id":"milk"}],"totalCount":1}}`,
+		},
+		{
+			name:       "page of tasks",
+			token:      loginToken,
+			query:      `{ tasks(offset: 1, limit: 1) { tasks { id } totalCount hasMore } }`,
+			wantStatus: http.StatusOK,
+			wantData:   `{"tasks":{"hasMore":true,"tasks":[{"id":"apply"}],"totalCount":3}}`,
+		},
+		{
+			name:       "page too large",
+			token:      loginToken,
+			query:      `{ tasks(limit: 101) { totalCount } }`,
+			wantStatus: http.StatusOK,
+			wantData:   `null`,
+			wantError:  "limit must be between 1 and 100",
+		},
+		{
+			name:       "task",
+			token:      loginToken,
+			query:      `{ task(id: "call") { detail } missing: task(id: "gone") { detail } }`,
+			wantStatus: http.StatusOK,
+			wantData:   `{"missing":null,"task":{"detail":"call mom"}}`,
+		},
+		{
+			name:       "tasks without read scope",
+			token:      writeToken,
+			query:      `{ tasks { totalCount } }`,
+			wantStatus: http.StatusOK,
+			wantData:   `null`,
+			wantError:  `missing the "tasks:read" scope`,
+		},
+		{
+			name:       "create task",
+			token:      writeToken,
+			query:      `mutation { createTask(input: {detail: "Buy bread", project: "home", tags: ["food"]}) { id detail project tags } }`,
+			wantStatus: http.StatusOK,
+			wantData:   `{"createTask":{"detail":"Buy bread","id":"new","project":"home","tags":["food"]}}`,
+		},
+		{
+			name:       "create task without write scope",
+			token:      readToken,
+			query:      `mutation { createTask(input: {detail: "Buy bread"}) { id } }`,
+			wantStatus: http.StatusOK,
+			wantData:   `null`,
+			wantError:  `missing the "tasks:write" scope`,
+		},
+		{
+			name:       "create invalid task",
+			token:      loginToken,
+			query:      `mutation { createTask(input: {detail: "Buy bread", recurrence: "FREQ=DAILY"}) { id } }`,
+			wantStatus: http.StatusOK,
+			wantData:   `null`,
+			wantError:  "due date",
+		},
+		{
+			name:       "update task",
+			token:      writeToken,
+			query:      `mutation { updateTask(id: "milk", input: {detail: "Buy oat milk", dueAt: 30, tags: ["food", "food"]}) { detail project dueAt tags } }`,
+			wantStatus: http.StatusOK,
+			wantData:   `{"updateTask":{"detail":"Buy oat milk","dueAt":30,"project":"work","tags":["food"]}}`,
+		},
+		{
+			name:       "remove task fields",
+			token:      loginToken,
+			query:      `mutation { updateTask(id: "milk", input: {project: "", dueAt: 0, tags: []}) { project dueAt tags } }`,
+			wantStatus: http.StatusOK,
+			wantData:   `{"updateTask":{"dueAt":null,"project":null,"tags":[]}}`,
+		},
+		{
+			name:       "update missing task",
+			token:      loginToken,
+			query:      `mutation { updateTask(id: "gone", input: {detail: "Buy oat milk"}) { id } }`,
+			wantStatus: http.StatusOK,
+			wantData:   `null`,
+			wantError:  db.ErrorInvalidRequest.Error(),
+		},
+		{
+			name:       "complete task",
+			token:      loginToken,
+			query:      `mutation { completeTask(id: "call") { id completed } }`,
+			wantStatus: http.StatusOK,
+			wantData:   `{"completeTask":{"completed":true,"id":"call"}}`,
+		},
+		{
+			name:       "introspection",
+			token:      readToken,
+			query:      `{ __schema { queryType { name } mutationType { name } } }`,
+			wantStatus: http.StatusOK,
+			wantData:   `{"__schema":{"mutationType":{"name":"Mutation"},"queryType":{"name":"Query"}}}`,
+		},
+		{
+			name:       "syntax error",
+			token:      loginToken,
+			query:      `{ tasks { totalCount }`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "Syntax Error",
+		},
+		{
+			name:       "null literal",
+			token:      loginToken,
+			query:      `mutation { updateTask(id: "milk", input: {project: null}) { id } }`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "Syntax Error",
+		},
+		{
+			name:       "invalid variable",
+			token:      loginToken,
+			query:      `query Tasks($limit: Int) { tasks(limit: $limit) { totalCount } }`,
+			variables:  map[string]any{"limit": "ten"},
+			wantStatus: http.StatusOK,
+			wantData:   `null`,
+			wantError:  `Variable "$limit" got invalid value`,
+		},
+		{
+			name:       "invalid query",
+			token:      loginToken,
+			query:      `{ tasks { tasks { title } } }`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  `Cannot query field "title" on type "Task".`,
+		},
+		{
+			name:       "largest page of tasks",
+			token:      loginToken,
+			query:      `{ tasks(limit: 100) { tasks { ` + allTaskFields + ` } } }`,
+			wantStatus: http.StatusOK,
+			wantData:   `{"tasks":{"tasks":[`,
+		},
+		{
+			name:       "too complex",
+			token:      loginToken,
+			query:      `{ tasks(limit: 100) { tasks { ` + allTaskFields + ` } } other: tasks(limit: 100) { tasks { id detail completed createdAt updatedAt } } }`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "exceeds the maximum complexity of 2000",
+		},
+		{
+			name:       "too complex with variables",
+			token:      loginToken,
+			query:      `query Tasks($limit: Int) { tasks(limit: $limit) { tasks { ` + allTaskFields + ` } } a: tasks(limit: $limit) { tasks { ` + allTaskFields + ` } } }`,
+			variables:  map[string]any{"limit": 80},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "exceeds the maximum complexity of 2000",
+		},
+		{
+			name:       "invalid page size counted as the largest page",
+			token:      loginToken,
+			query:      `{ tasks(limit: 1000) { tasks { ` + allTaskFields + ` } } a: tasks(limit: -1) { tasks { ` + allTaskFields + ` } } }`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "exceeds the maximum complexity of 2000",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := testRequest(t, s, http.MethodPost, "/graphql", test.token, map[string]any{"query": test.query, "variables": test.variables})
+			checkStatus(t, res, test.wantStatus)
+			if test.wantData == "" && test.wantError == "" {
+				return
+			}
+
+			var response struct {
+				Data   json.RawMessage `json:"data"`
+				Errors []struct {
+					Message string `json:"message"`
+				} `json:"errors"`
+			}
+			if err := json.Unmarshal(res.Body.Bytes(), &response); err != nil {
+				t.Fatalf("json.Unmarshal error: %v", err)
+			}
+
+			// Response fields are sorted by name, so the data is compared
+			// after it is encoded with sorted keys.
+			var data any
+			if response.Data != nil {
+				if err := json.Unmarshal(response.Data, &data); err != nil {
+					t.Fatalf("json.Unmarshal error: %v", err)
+				}
+			}
+			sortedData, _ := json.Marshal(data)
+			if !strings.HasPrefix(string(sortedData), test.wantData) || (test.wantData == "") != (response.Data == nil) {
+				t.Fatalf("want data %s, got %s", test.wantData, res.Body)
+			}
+			if test.wantError == "" && len(response.Errors) > 0 {
+				t.Fatalf("want no errors, got %s", res.Body)
+			}
+			if test.wantError != "" && (len(response.Errors) == 0 || !strings.Contains(response.Errors[0].Message, test.wantError)) {
+				t.Fatalf("want error %q, got %s", test.wantError, res.Body)
+			}
+		})
+	}
+}
+
+func TestSortTasks(t *testing.T) {
+	tasks := []*db.Task{
+		{ID: "a", UpdatedAt: 2, TaskInfo: db.TaskInfo{Detail: "b", Timestamp: 1}},
+		{ID: "b", UpdatedAt: 1, TaskInfo: db.TaskInfo{Detail: "A", DueAt: 5, Timestamp: 2}},
+		{ID: "c", UpdatedAt: 3, TaskInfo: db.TaskInfo{Detail: "c", Timestamp: 2}},
+		{ID: "d", UpdatedAt: 2, TaskInfo: db.TaskInfo{Detail: "d", DueAt: 3, Timestamp: 0}},
+	}
+
+	tests := []struct {
+		name       string
+		sortBy     string
+		descending bool
+		// want are the IDs of the sorted tasks.
+		want string
+	}{
+		{"created", sortByCreatedAt, false, "d,a,b,c"},
+		{"created descending keeps ties in order", sortByCreatedAt, true, "b,c,a,d"},
+		{"due date", sortByDueAt, false, "d,b,a,c"},
+		{"due date descending keeps tasks without due date last", sortByDueAt, true, "b,d,a,c"},
+		{"updated", sortByUpdatedAt, false, "b,a,d,c"},
+		{"detail ignores case", sortByDetail, false, "b,a,c,d"},
+		{"unknown field sorts by creation", "", false, "d,a,b,c"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sorted := append([]*db.Task(nil), tasks...)
+			sortTasks(sorted, test.sortBy, test.descending)
+
+			var ids []string
+			for _, task := range sorted {
+				ids = append(ids, task.ID)
+			}
+			if got := strings.Join(ids, ","); got != test.want {
+				t.Fatalf("want %s, got %s", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package webserver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// maxGraphQLSelections is the maximum number of selections a GraphQL request
+// can expand to. Fragments can be spread many times without adding depth, so
+// requests are also limited by the number of selections they expand to.
+const maxGraphQLSelections = 10000
+
+// graphQLLimits measures the depth and complexity of a valid GraphQL
+// request.
+type graphQLLimits struct {
+	schema    *graphql.Schema
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]any
+	// defaults are the default values of the operation's variables.
+	defaults   map[string]ast.Value
+	selections int
+	depth      int
+}
+
+// checkGraphQLLimits returns an error if the operation with the provided name
+// in doc is deeper than graphQLMaxDepth, more complex than
+// graphQLMaxComplexity or has more than maxGraphQLSelections selections. doc
+// must have been validated against schema. Introspection fields are not
+// counted, as they do not read the database and the schema is small.
+func checkGraphQLLimits(schema *graphql.Schema, doc *ast.Document, operationName string, variables map[string]any) error {
+	l := &graphQLLimits{
+		schema:    schema,
+		fragments: make(map[string]*ast.FragmentDefinition),
+		variables: variables,
+		defaults:  make(map[string]ast.Value),
+	}
+
+	var op *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.FragmentDefinition:
+			l.fragments[def.Name.Value] = def
+		case *ast.OperationDefinition:
+			if operationName == "" || (def.Name != nil && def.Name.Value == operationName) {
+				op = def
+			}
+		}
+	}
+
+	// Requests without the operation are rejected when they are executed.
+	if op == nil {
+		return nil
+	}
+
+	for _, def := range op.VariableDefinitions {
+		if def.DefaultValue != nil {
+			l.defaults[def.Variable.Name.Value] = def.DefaultValue
+		}
+	}
+
+	root := schema.QueryType()
+	if op.Operation == ast.OperationTypeMutation {
+		root = schema.MutationType()
+	}
+
+	complexity := l.selectionSet(root, op.SelectionSet, 1)
+	switch {
+	case l.selections > maxGraphQLSelections:
+		return fmt.Errorf("Query has more than %d selections.", maxGraphQLSelections)
+	case l.depth > graphQLMaxDepth:
+		return fmt.Errorf("Query is deeper than the maximum depth of %d.", graphQLMaxDepth)
+	case complexity > graphQLMaxComplexity:
+		return fmt.Errorf("Query has a complexity of %d, which exceeds the maximum complexity of %d.", complexity, graphQLMaxComplexity)
+	}
+
+	return nil
+}
+
+// selectionSet returns the complexity of the selections on an object of type
+// obj at the provided depth, and records the deepest selection. Selections
+// are not visited past the limits.
+func (l *graphQLLimits) selectionSet(obj *graphql.Object, set *ast.SelectionSet, depth int) int {
+	if set == nil {
+		return 0
+	}
+
+	complexity := 0
+	for _, selection := range set.Selections {
+		l.selections++
+		if l.selections > maxGraphQLSelections || depth > graphQLMaxDepth {
+			l.depth = max(l.depth, depth)
+			return complexity
+		}
+
+		switch selection := selection.(type) {
+		case *ast.Field:
+			name := selection.Name.Value
+			def := obj.Fields()[name]
+			if def == nil || strings.HasPrefix(name, "__") {
+				continue
+			}
+
+			l.depth = max(l.depth, depth)
+			childComplexity := 0
+			if fieldType, ok := graphql.GetNamed(def.Type).(*graphql.Object); ok {
+				childComplexity = l.selectionSet(fieldType, selection.SelectionSet, depth+1)
+			}
+			complexity += l.fieldComplexity(obj, selection, childComplexity)
+		case *ast.InlineFragment:
+			complexity += l.selectionSet(l.fragmentType(obj, selection.TypeCondition), selection.SelectionSet, depth)
+		case *ast.FragmentSpread:
+			if fragment := l.fragments[selection.Name.Value]; fragment != nil {
+				complexity += l.selectionSet(l.fragmentType(obj, fragment.TypeCondition), fragment.SelectionSet, depth)
+			}
+		}
+	}
+
+	return complexity
+}
+
+// fragmentType returns the type of a fragment on an object of type obj.
+func (l *graphQLLimits) fragmentType(obj *graphql.Object, typeCondition *ast.Named) *graphql.Object {
+	if typeCondition == nil {
+		return obj
+	}
+	if fragmentType, ok := l.schema.Type(typeCondition.Name.Value).(*graphql.Object); ok {
+		return fragmentType
+	}
+	return obj
+}
+
+// fieldComplexity returns the complexity of a field of obj. Each field costs
+// 1, and the tasks of a tasks query are counted once for each task the page
+// can hold. Pages with an invalid size are counted as the largest page.
+func (l *graphQLLimits) fieldComplexity(obj *graphql.Object, field *ast.Field, childComplexity int) int {
+	if obj != l.schema.QueryType() || field.Name.Value != "tasks" {
+		return 1 + childComplexity
+	}
+
+	limit := defaultGraphQLPageSize
+	for _, arg := range field.Arguments {
+		if arg.Name.Value == "limit" {
+			limit = l.intValue(arg.Value, defaultGraphQLPageSize)
+		}
+	}
+	if limit < 1 || limit > maxGraphQLPageSize {
+		limit = maxGraphQLPageSize
+	}
+
+	return 1 + limit*childComplexity
+}
+
+// intValue returns the Int argument value v, or defaultValue if v is a
+// variable without a value. Returns -1 if the value is not an integer.
+func (l *graphQLLimits) intValue(v ast.Value, defaultValue int) int {
+	switch v := v.(type) {
+	case *ast.IntValue:
+		n, err := strconv.Atoi(v.Value)
+		if err != nil {
+			return -1
+		}
+		return n
+	case *ast.Variable:
+		name := v.Name.Value
+		value, ok := l.variables[name]
+		if !ok || value == nil {
+			if def, ok := l.defaults[name]; ok {
+				return l.intValue(def, defaultValue)
+			}
+			return defaultValue
+		}
+		n, ok := value.(float64)
+		if !ok || n != float64(int(n)) {
+			return -1
+		}
+		return int(n)
+	}
+	return -1
+}
@@ -0,0 +1,136 @@
+package webserver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+func TestCheckGraphQLLimits(t *testing.T) {
+	nodeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Node",
+		Fields: graphql.Fields{
+			"id": {Type: graphql.ID},
+		},
+	})
+	nodeType.AddFieldConfig("child", &graphql.Field{Type: nodeType})
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"node": {Type: nodeType},
+				"tasks": {
+					Type: graphql.NewList(nodeType),
+					Args: graphql.FieldConfigArgument{"limit": {Type: graphql.Int}},
+				},
+			},
+		}),
+	})
+	if err != nil {
+		t.Fatalf("NewSchema error: %v", err)
+	}
+
+	// nested returns a selection of the id of a node n levels below the
+	// node query.
+	nested := func(n int) string {
+		return "node { " + strings.Repeat("child { ", n) + "id" + strings.Repeat(" }", n) + " }"
+	}
+	// fields selects 19 fields of a node, so a page of 100 nodes has a
+	// complexity of 1901.
+	fields := strings.Repeat("id ", 19)
+
+	tests := []struct {
+		name          string
+		query         string
+		operationName string
+		variables     map[string]any
+		// wantError is a part of the error, or empty if the query is within
+		// limits.
+		wantError string
+	}{
+		{
+			name:  "deepest query",
+			query: "{ " + nested(graphQLMaxDepth-2) + " }",
+		},
+		{
+			name:      "too deep",
+			query:     "{ " + nested(graphQLMaxDepth-1) + " }",
+			wantError: "deeper than the maximum depth of 6",
+		},
+		{
+			name:      "too deep with fragments",
+			query:     "{ node { ...Child } } fragment Child on Node { child { ... on Node { child { child { child { child { id } } } } } } }",
+			wantError: "deeper than the maximum depth of 6",
+		},
+		{
+			name:  "introspection is not counted",
+			query: "{ __schema { types { fields { type { ofType { ofType { ofType { name } } } } } } } }",
+		},
+		{
+			name:  "largest page",
+			query: "{ tasks(limit: 100) { " + fields + "} }",
+		},
+		{
+			name:      "too complex",
+			query:     "{ tasks(limit: 100) { " + fields + "} other: tasks(limit: 10) { " + fields + "} }",
+			wantError: "complexity of 2092, which exceeds the maximum complexity of 2000",
+		},
+		{
+			name:      "too complex with fragments",
+			query:     "{ a: tasks(limit: 60) { ...Fields } b: tasks(limit: 60) { ...Fields } } fragment Fields on Node { " + fields + "}",
+			wantError: "exceeds the maximum complexity of 2000",
+		},
+		{
+			name:      "default page size",
+			query:     "{ a: tasks { " + fields + "} b: tasks { " + fields + "} c: tasks { " + fields + "} }",
+			wantError: "complexity of 2853,",
+		},
+		{
+			name:      "page size from variable",
+			query:     "query Tasks($limit: Int) { a: tasks(limit: $limit) { " + fields + "} }",
+			variables: map[string]any{"limit": float64(10)},
+		},
+		{
+			name:      "page size from variable default",
+			query:     "query Tasks($limit: Int = 100) { a: tasks(limit: $limit) { " + fields + "} b: tasks(limit: $limit) { id } }",
+			wantError: "complexity of 2002,",
+		},
+		{
+			name:      "invalid page size counted as the largest page",
+			query:     "{ a: tasks(limit: -1) { " + fields + "} b: tasks(limit: 100) { id } }",
+			wantError: "complexity of 2002,",
+		},
+		{
+			name:          "only the executed operation is counted",
+			query:         "query Small { node { id } } query Large { a: tasks(limit: 100) { " + fields + "} b: tasks(limit: 100) { " + fields + "} }",
+			operationName: "Small",
+		},
+		{
+			name:      "too many selections",
+			query:     "{ node { ...A } } fragment A on Node { " + strings.Repeat("...B ", 101) + "} fragment B on Node { " + strings.Repeat("id ", 100) + "}",
+			wantError: "more than 10000 selections",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc, err := parser.Parse(parser.ParseParams{Source: test.query})
+			if err != nil {
+				t.Fatalf("parser.Parse error: %v", err)
+			}
+			if validation := graphql.ValidateDocument(&schema, doc, nil); !validation.IsValid {
+				t.Fatalf("invalid query: %v", validation.Errors)
+			}
+
+			err = checkGraphQLLimits(&schema, doc, test.operationName, test.variables)
+			if test.wantError == "" && err != nil {
+				t.Fatalf("want no error, got %v", err)
+			}
+			if test.wantError != "" && (err == nil || !strings.Contains(err.Error(), test.wantError)) {
+				t.Fatalf("want error %q, got %v", test.wantError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package webserver
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/ukane-philemon/megtask/db"
+	"github.com/ukane-philemon/megtask/megtaskpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcAuthorizationKey is the metadata key of bearer tokens in gRPC calls.
+// Metadata keys are lowercase, so login tokens can also be sent with the
+// lowercase jwtHeader.
+const grpcAuthorizationKey = "authorization"
+
+// grpcMethodScopes are the methods that can be called with an api token and
+// the scope the token needs for each method. Like apiTokenRouteScopes, api
+// tokens cannot call methods that are not listed, and methods with an empty
+// scope can be called with any api token.
+var grpcMethodScopes = map[string]string{
+	megtaskpb.UserService_GetMe_FullMethodName: "",
+
+	megtaskpb.TaskService_ListTasks_FullMethodName:    scopeTasksRead,
+	megtaskpb.TaskService_GetTask_FullMethodName:      scopeTasksRead,
+	megtaskpb.TaskService_CreateTask_FullMethodName:   scopeTasksWrite,
+	megtaskpb.TaskService_UpdateTask_FullMethodName:   scopeTasksWrite,
+	megtaskpb.TaskService_CompleteTask_FullMethodName: scopeTasksWrite,
+	megtaskpb.TaskService_DeleteTask_FullMethodName:   scopeTasksWrite,
+}
+
+// grpcTaskScopes and grpcTaskStatuses map the enums of ListTasksRequest to
+// the scopes and status filters of the REST API.
+var (
+	grpcTaskScopes = map[megtaskpb.TaskScope]string{
+		megtaskpb.TaskScope_TASK_SCOPE_UNSPECIFIED: ownTasksScope,
+		megtaskpb.TaskScope_TASK_SCOPE_OWN:         ownTasksScope,
+		megtaskpb.TaskScope_TASK_SCOPE_SHARED:      sharedTasksScope,
+		megtaskpb.TaskScope_TASK_SCOPE_ASSIGNED:    assignedTasksScope,
+	}
+	grpcTaskStatuses = map[megtaskpb.TaskStatus]string{
+		megtaskpb.TaskStatus_TASK_STATUS_UNSPECIFIED: "",
+		megtaskpb.TaskStatus_TASK_STATUS_PENDING:     pendingTasksFilter,
+		megtaskpb.TaskStatus_TASK_STATUS_COMPLETED:   completedTasksFilter,
+	}
+)
+
+// grpcService implements the gRPC services defined in megtaskpb with the
+// same database, auth tokens and task events as the HTTP API.
+type grpcService struct {
+	megtaskpb.UnimplementedUserServiceServer
+	megtaskpb.UnimplementedTaskServiceServer
+
+	s *WebServer
+}
+
+// newGRPCServer returns a gRPC server for the user and task services.
+func (s *WebServer) newGRPCServer() *grpc.Server {
+	server := grpc.NewServer(grpc.UnaryInterceptor(s.grpcAuthInterceptor))
+
+	service := &grpcService{s: s}
+	megtaskpb.RegisterUserServiceServer(server, service)
+	megtaskpb.RegisterTaskServiceServer(server, service)
+
+	return server
+}
+
+// grpcAuthInterceptor authenticates gRPC calls like authMiddleware does HTTP
+// requests, and ensures calls authenticated with an api token are to a method
+// in grpcMethodScopes and have the scope it requires. Like with HTTP
+// requests, tokens can be sent in the lowercase jwtHeader metadata or as a
+// bearer token in the "authorization" metadata.
+func (s *WebServer) grpcAuthInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var authToken string
+	if values := md.Get(jwtHeader); len(values) > 0 {
+		authToken = values[0]
+	} else if values := md.Get(grpcAuthorizationKey); len(values) > 0 {
+		authToken, _ = strings.CutPrefix(values[0], "Bearer ")
+	}
+
+	ctx, err := s.authenticate(ctx, authToken)
+	if err != nil {
+		if errors.Is(err, errNotAuthorized) {
+			return nil, status.Error(codes.Unauthenticated, "not authorized")
+		}
+		return nil, s.grpcError(err)
+	}
+
+	if ctx.Value(apiTokenScopesCtxKey) != nil {
+		scope, allowed := grpcMethodScopes[info.FullMethod]
+		if !allowed {
+			return nil, status.Error(codes.PermissionDenied, "this method cannot be called with an api token")
+		}
+		if scope != "" && !ctxHasScope(ctx, scope) {
+			return nil, status.Errorf(codes.PermissionDenied, "api token is missing the %q scope", scope)
+		}
+	}
+
+	return handler(ctx, req)
+}
+
+// grpcError returns the status of a failed gRPC call. ErrorInvalidRequest
+// errors are returned to the client, other errors are logged and replaced
+// with a generic message.
+func (s *WebServer) grpcError(err error) error {
+	if errors.Is(err, db.ErrorInvalidRequest) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	s.log.Error("Server error: ", "err", err)
+	return status.Error(codes.Internal, "Something unexpected happened, please try again later.")
+}
+
+// grpcUserID retrieves the userID from the context of an authenticated gRPC
+// call.
+func grpcUserID(ctx context.Context) string {
+	userID, _ := ctx.Value(userIDCtxKey).(string)
+	return userID
+}
+
+// GetMe returns the authenticated user.
+func (gs *grpcService) GetMe(ctx context.Context, _ *megtaskpb.GetMeRequest) (*megtaskpb.User, error) {
+	user, err := gs.s.taskDB.UserSummary(grpcUserID(ctx))
+	if err != nil {
+		return nil, gs.s.grpcError(err)
+	}
+
+	return &megtaskpb.User{
+		Id:                 user.ID,
+		Username:           user.Username,
+		Email:              user.Email,
+		Role:               user.Role,
+		TwoFactorEnabled:   user.TwoFactorEnabled,
+		CreatedAt:          user.CreatedAt,
+		TaskCount:          user.TaskCount,
+		CompletedTaskCount: user.CompletedTaskCount,
+	}, nil
+}
+
+// ListTasks returns the user's tasks that match the request.
+func (gs *grpcService) ListTasks(ctx context.Context, req *megtaskpb.ListTasksRequest) (*megtaskpb.ListTasksResponse, error) {
+	scope, ok := grpcTaskScopes[req.Scope]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown scope %v", req.Scope)
+	}
+
+	taskStatus, ok := grpcTaskStatuses[req.Status]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown status %v", req.Status)
+	}
+
+	tasks, err := gs.s.scopedTasks(grpcUserID(ctx), scope, completedFilter(taskStatus))
+	if err != nil {
+		return nil, gs.s.grpcError(err)
+	}
+
+	tasks = filterTasks(tasks, req.Project, req.Tag)
+
+	res := &megtaskpb.ListTasksResponse{Tasks: make([]*megtaskpb.Task, 0, len(tasks))}
+	for _, task := range tasks {
+		res.Tasks = append(res.Tasks, grpcTask(task))
+	}
+
+	return res, nil
+}
+
+// GetTask returns a task the user owns, has been assigned or has been shared
+// with.
+func (gs *grpcService) GetTask(ctx context.Context, req *megtaskpb.GetTaskRequest) (*megtaskpb.Task, error) {
+	tasks, err := gs.s.feedTasks(grpcUserID(ctx))
+	if err != nil {
+		return nil, gs.s.grpcError(err)
+	}
+
+	task := findTask(tasks, req.Id)
+	if task == nil {
+		return nil, status.Error(codes.NotFound, "task not found")
+	}
+
+	return grpcTask(task), nil
+}
+
+// CreateTask creates a task owned by the user.
+func (gs *grpcService) CreateTask(ctx context.Context, req *megtaskpb.CreateTaskRequest) (*megtaskpb.Task, error) {
+	form := &createTaskRequest{
+		TaskDetail: req.Detail,
+		Project:    req.Project,
+		DueAt:      req.DueAt,
+		Tags:       req.Tags,
+		Recurrence: req.Recurrence,
+	}
+
+	if err := form.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	task, userTasks, err := gs.s.taskDB.CreateTask(grpcUserID(ctx), form.TaskDetail, form.Project, form.DueAt, form.Tags, form.Recurrence)
+	if err != nil {
+		return nil, gs.s.grpcError(err)
+	}
+
+	gs.s.publishTaskEvent(TaskCreatedEvent, task.ID, userTasks)
+
+	return grpcTask(task), nil
+}
+
+// UpdateTask changes the fields of a task listed in the update mask.
+func (gs *grpcService) UpdateTask(ctx context.Context, req *megtaskpb.UpdateTaskRequest) (*megtaskpb.Task, error) {
+	if len(req.UpdateMask.GetPaths()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "missing update mask")
+	}
+
+	form := new(updateTaskRequest)
+	for _, path := range req.UpdateMask.GetPaths() {
+		switch path {
+		case "detail":
+			if req.Task.GetDetail() == "" {
+				return nil, status.Error(codes.InvalidArgument, "detail cannot be empty")
+			}
+			form.TaskDetail = req.Task.GetDetail()
+		case "project":
+			project := req.Task.GetProject()
+			form.Project = &project
+		case "due_at":
+			dueAt := req.Task.GetDueAt()
+			form.DueAt = &dueAt
+		case "tags":
+			tags := req.Task.GetTags()
+			form.Tags = &tags
+		case "recurrence":
+			recurrence := req.Task.GetRecurrence()
+			form.Recurrence = &recurrence
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "field %q cannot be updated", path)
+		}
+	}
+
+	return gs.updateTask(ctx, req.Id, form)
+}
+
+// CompleteTask marks a task as completed.
+func (gs *grpcService) CompleteTask(ctx context.Context, req *megtaskpb.CompleteTaskRequest) (*megtaskpb.Task, error) {
+	return gs.updateTask(ctx, req.Id, &updateTaskRequest{MarkAsCompleted: true})
+}
+
+// updateTask updates the task with the provided taskID and returns the
+// updated task.
+func (gs *grpcService) updateTask(ctx context.Context, taskID string, form *updateTaskRequest) (*megtaskpb.Task, error) {
+	if err := form.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	userTasks, err := gs.s.taskDB.UpdateTask(grpcUserID(ctx), taskID, form.taskUpdate())
+	if err != nil {
+		return nil, gs.s.grpcError(err)
+	}
+
+	gs.s.publishTaskEvent(TaskUpdatedEvent, taskID, userTasks)
+
+	task := findTask(userTasks, taskID)
+	if task == nil {
+		return nil, status.Error(codes.NotFound, "task not found")
+	}
+
+	return grpcTask(task), nil
+}
+
+// DeleteTask deletes a task and its attachments.
+func (gs *grpcService) DeleteTask(ctx context.Context, req *megtaskpb.DeleteTaskRequest) (*megtaskpb.DeleteTaskResponse, error) {
+	_, err := gs.s.deleteTask(ctx, grpcUserID(ctx), req.Id)
+	if err != nil {
+		return nil, gs.s.grpcError(err)
+	}
+
+	return new(megtaskpb.DeleteTaskResponse), nil
+}
+
+// grpcTask returns task as a *megtaskpb.Task.
+func grpcTask(task *db.Task) *megtaskpb.Task {
+	return &megtaskpb.Task{
+		Id:           task.ID,
+		Detail:       task.Detail,
+		Completed:    task.Completed,
+		CreatedAt:    task.Timestamp,
+		UpdatedAt:    task.UpdatedAt,
+		Project:      task.Project,
+		DueAt:        task.DueAt,
+		Tags:         task.Tags,
+		Recurrence:   task.Recurrence,
+		OwnerId:      task.OwnerID,
+		Permission:   task.Permission,
+		WorkspaceId:  task.WorkspaceID,
+		AssigneeId:   task.AssigneeID,
+		CommentCount: task.CommentCount,
+	}
+}
@@ -0,0 +1,289 @@
+package webserver
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"github.com/ukane-philemon/megtask/megtaskpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// grpcDB is a graphQLDB that records the last task update. Only the task
+// "call" can be updated or deleted.
+type grpcDB struct {
+	graphQLDB
+	update *db.TaskUpdate
+}
+
+func (gdb *grpcDB) UpdateTask(userID, taskID string, taskUpdate *db.TaskUpdate) ([]*db.Task, error) {
+	if taskID != "call" {
+		return nil, db.ErrorInvalidRequest
+	}
+	gdb.update = taskUpdate
+
+	task := &db.Task{ID: taskID, TaskInfo: db.TaskInfo{Detail: "call mom"}}
+	if taskUpdate.Detail != "" {
+		task.Detail = taskUpdate.Detail
+	}
+	if taskUpdate.MarkAsComplete != nil {
+		task.Completed = *taskUpdate.MarkAsComplete
+	}
+	return []*db.Task{task}, nil
+}
+
+func (gdb *grpcDB) DeleteTask(userID, taskID string) ([]*db.Task, error) {
+	if taskID != "call" {
+		return nil, db.ErrorInvalidRequest
+	}
+	return nil, nil
+}
+
+// dialGRPC starts the gRPC server of s on an in-memory listener and returns
+// a connection to it.
+func dialGRPC(t *testing.T, s *WebServer) *grpc.ClientConn {
+	t.Helper()
+
+	listener := bufconn.Listen(1 << 20)
+	server := s.newGRPCServer()
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("grpc.NewClient error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestGRPCAuth(t *testing.T) {
+	const (
+		readToken  = apiTokenPrefix + "read"
+		writeToken = apiTokenPrefix + "write"
+	)
+	gdb := &grpcDB{graphQLDB: graphQLDB{authDB{roles: map[string]string{"user": db.RoleUser}, scopes: map[string][]string{
+		readToken:  {scopeTasksRead},
+		writeToken: {scopeTasksWrite},
+	}}}}
+	s := newTestServer(t, gdb, nil)
+	conn := dialGRPC(t, s)
+	users, tasks := megtaskpb.NewUserServiceClient(conn), megtaskpb.NewTaskServiceClient(conn)
+
+	loginToken, err := s.jwtManager.GenerateJWtToken("user", db.RoleUser, "session", time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateJWtToken error: %v", err)
+	}
+
+	getMe := func(ctx context.Context, opts ...grpc.CallOption) error {
+		_, err := users.GetMe(ctx, new(megtaskpb.GetMeRequest), opts...)
+		return err
+	}
+	listTasks := func(ctx context.Context, opts ...grpc.CallOption) error {
+		_, err := tasks.ListTasks(ctx, new(megtaskpb.ListTasksRequest), opts...)
+		return err
+	}
+	deleteTask := func(ctx context.Context, opts ...grpc.CallOption) error {
+		_, err := tasks.DeleteTask(ctx, &megtaskpb.DeleteTaskRequest{Id: "call"}, opts...)
+		return err
+	}
+
+	tests := []struct {
+		name string
+		call func(ctx context.Context, opts ...grpc.CallOption) error
+		// token is sent with TokenCredentials if it is not empty.
+		token string
+		// md is sent as the metadata of the call.
+		md       metadata.MD
+		wantCode codes.Code
+	}{
+		{"no token", getMe, "", nil, codes.Unauthenticated},
+		{"invalid token", getMe, "invalid", nil, codes.Unauthenticated},
+		{"login token", getMe, loginToken, nil, codes.OK},
+		{"login token in jwt metadata", getMe, "", metadata.Pairs(jwtHeader, loginToken), codes.OK},
+		{"api token in jwt metadata", getMe, "", metadata.Pairs(jwtHeader, readToken), codes.OK},
+		{"invalid token in jwt metadata", getMe, "", metadata.Pairs(jwtHeader, "invalid"), codes.Unauthenticated},
+		{"api token without scope", getMe, writeToken, nil, codes.OK},
+		{"read token reads tasks", listTasks, readToken, nil, codes.OK},
+		{"write token reads tasks", listTasks, writeToken, nil, codes.PermissionDenied},
+		{"read token deletes a task", deleteTask, readToken, nil, codes.PermissionDenied},
+		{"write token deletes a task", deleteTask, writeToken, nil, codes.OK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			if test.md != nil {
+				ctx = metadata.NewOutgoingContext(ctx, test.md)
+			}
+			var opts []grpc.CallOption
+			if test.token != "" {
+				opts = append(opts, grpc.PerRPCCredentials(&megtaskpb.TokenCredentials{Token: test.token, Insecure: true}))
+			}
+
+			err := test.call(ctx, opts...)
+			if code := status.Code(err); code != test.wantCode {
+				t.Fatalf("want code %v, got %v", test.wantCode, err)
+			}
+		})
+	}
+}
+
+func TestGRPCTasks(t *testing.T) {
+	gdb := &grpcDB{graphQLDB: graphQLDB{authDB{roles: map[string]string{"user": db.RoleUser}}}}
+	s := newTestServer(t, gdb, nil)
+	tasks := megtaskpb.NewTaskServiceClient(dialGRPC(t, s))
+
+	loginToken, err := s.jwtManager.GenerateJWtToken("user", db.RoleUser, "session", time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateJWtToken error: %v", err)
+	}
+	creds := grpc.PerRPCCredentials(&megtaskpb.TokenCredentials{Token: loginToken, Insecure: true})
+
+	// taskIDs returns the IDs of tasks.
+	taskIDs := func(tasks []*megtaskpb.Task) string {
+		var ids []string
+		for _, task := range tasks {
+			ids = append(ids, task.Id)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	listTests := []struct {
+		name    string
+		req     *megtaskpb.ListTasksRequest
+		want    string
+		wantErr codes.Code
+	}{
+		{"all tasks", new(megtaskpb.ListTasksRequest), "milk,call,apply", codes.OK},
+		{"pending tasks", &megtaskpb.ListTasksRequest{Status: megtaskpb.TaskStatus_TASK_STATUS_PENDING}, "milk,call", codes.OK},
+		{"completed tasks", &megtaskpb.ListTasksRequest{Status: megtaskpb.TaskStatus_TASK_STATUS_COMPLETED}, "apply", codes.OK},
+		{"tasks without project", &megtaskpb.ListTasksRequest{Project: proto.String("")}, "call,apply", codes.OK},
+		{"shared tasks", &megtaskpb.ListTasksRequest{Scope: megtaskpb.TaskScope_TASK_SCOPE_SHARED}, "", codes.OK},
+		{"unknown scope", &megtaskpb.ListTasksRequest{Scope: 10}, "", codes.InvalidArgument},
+		{"unknown status", &megtaskpb.ListTasksRequest{Status: 10}, "", codes.InvalidArgument},
+	}
+
+	for _, test := range listTests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := tasks.ListTasks(context.Background(), test.req, creds)
+			if code := status.Code(err); code != test.wantErr {
+				t.Fatalf("want code %v, got %v", test.wantErr, err)
+			}
+			if got := taskIDs(res.GetTasks()); got != test.want {
+				t.Fatalf("want tasks %q, got %q", test.want, got)
+			}
+		})
+	}
+
+	updateTests := []struct {
+		name string
+		req  *megtaskpb.UpdateTaskRequest
+		// want is the updated task and wantUpdate the update sent to the
+		// database, if the update is valid.
+		want       *megtaskpb.Task
+		wantUpdate *db.TaskUpdate
+		wantErr    codes.Code
+	}{
+		{
+			name:       "detail",
+			req:        &megtaskpb.UpdateTaskRequest{Id: "call", Task: &megtaskpb.Task{Detail: "call dad", Project: "ignored"}, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"detail"}}},
+			want:       &megtaskpb.Task{Id: "call", Detail: "call dad"},
+			wantUpdate: &db.TaskUpdate{Detail: "call dad"},
+		},
+		{
+			name:       "removed fields",
+			req:        &megtaskpb.UpdateTaskRequest{Id: "call", Task: new(megtaskpb.Task), UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"project", "due_at", "tags", "recurrence"}}},
+			want:       &megtaskpb.Task{Id: "call", Detail: "call mom"},
+			wantUpdate: &db.TaskUpdate{Project: proto.String(""), DueAt: proto.Int64(0), Tags: &[]string{}, Recurrence: proto.String("")},
+		},
+		{
+			name:    "missing update mask",
+			req:     &megtaskpb.UpdateTaskRequest{Id: "call", Task: &megtaskpb.Task{Detail: "call dad"}},
+			wantErr: codes.InvalidArgument,
+		},
+		{
+			name:    "empty detail",
+			req:     &megtaskpb.UpdateTaskRequest{Id: "call", Task: new(megtaskpb.Task), UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"detail"}}},
+			wantErr: codes.InvalidArgument,
+		},
+		{
+			name:    "unknown field",
+			req:     &megtaskpb.UpdateTaskRequest{Id: "call", Task: new(megtaskpb.Task), UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"completed"}}},
+			wantErr: codes.InvalidArgument,
+		},
+		{
+			name:    "unknown task",
+			req:     &megtaskpb.UpdateTaskRequest{Id: "gone", Task: &megtaskpb.Task{Detail: "call dad"}, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"detail"}}},
+			wantErr: codes.InvalidArgument,
+		},
+	}
+
+	for _, test := range updateTests {
+		t.Run(test.name, func(t *testing.T) {
+			gdb.update = nil
+			task, err := tasks.UpdateTask(context.Background(), test.req, creds)
+			if code := status.Code(err); code != test.wantErr {
+				t.Fatalf("want code %v, got %v", test.wantErr, err)
+			}
+			if test.wantErr != codes.OK {
+				return
+			}
+
+			if !proto.Equal(task, test.want) {
+				t.Fatalf("want task %v, got %v", test.want, task)
+			}
+			if got, want := gdb.update, test.wantUpdate; got.Detail != want.Detail || !equalPtr(got.Project, want.Project) ||
+				!equalPtr(got.DueAt, want.DueAt) || !equalPtr(got.Recurrence, want.Recurrence) || (got.Tags == nil) != (want.Tags == nil) {
+				t.Fatalf("want update %+v, got %+v", want, got)
+			}
+		})
+	}
+
+	t.Run("complete task", func(t *testing.T) {
+		task, err := tasks.CompleteTask(context.Background(), &megtaskpb.CompleteTaskRequest{Id: "call"}, creds)
+		if err != nil {
+			t.Fatalf("CompleteTask error: %v", err)
+		}
+		if !task.Completed {
+			t.Fatalf("want completed task, got %v", task)
+		}
+	})
+
+	t.Run("create invalid task", func(t *testing.T) {
+		_, err := tasks.CreateTask(context.Background(), &megtaskpb.CreateTaskRequest{Detail: "standup", Recurrence: "FREQ=DAILY"}, creds)
+		if code := status.Code(err); code != codes.InvalidArgument {
+			t.Fatalf("want code %v, got %v", codes.InvalidArgument, err)
+		}
+	})
+
+	t.Run("get unknown task", func(t *testing.T) {
+		_, err := tasks.GetTask(context.Background(), &megtaskpb.GetTaskRequest{Id: "gone"}, creds)
+		if code := status.Code(err); code != codes.NotFound {
+			t.Fatalf("want code %v, got %v", codes.NotFound, err)
+		}
+	})
+}
+
+// equalPtr checks if a and b are both nil or point to equal values.
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
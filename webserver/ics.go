@@ -0,0 +1,353 @@
+package webserver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+const (
+	// icsTimeLayout is the layout of RFC 5545 UTC date-time values.
+	icsTimeLayout = "20060102T150405Z"
+	// icsMaxLineLength is the maximum length of a content line in octets,
+	// excluding the line break. Longer lines are folded.
+	icsMaxLineLength = 75
+
+	// icsComponentTodo and icsComponentEvent are the calendar components
+	// tasks can be written as.
+	icsComponentTodo  = "VTODO"
+	icsComponentEvent = "VEVENT"
+)
+
+// icsWriter writes an RFC 5545 iCalendar object.
+type icsWriter struct {
+	b strings.Builder
+}
+
+// property writes a content line with the provided name and value, folding
+// it if it is too long. value must already be escaped if it is text.
+func (w *icsWriter) property(name, value string) {
+	line := name + ":" + value
+	limit := icsMaxLineLength
+	for len(line) > limit {
+		// Lines are not folded in the middle of a UTF-8 character.
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		w.b.WriteString(line[:cut])
+		w.b.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space.
+		limit = icsMaxLineLength - 1
+	}
+	w.b.WriteString(line)
+	w.b.WriteString("\r\n")
+}
+
+// task writes task as a component of the provided type with the provided UID
+// and DTSTAMP.
+func (w *icsWriter) task(task *db.Task, component, uid string, stamp time.Time) {
+	w.property("BEGIN", component)
+	w.property("UID", icsText(uid))
+	w.property("DTSTAMP", stamp.UTC().Format(icsTimeLayout))
+	w.property("CREATED", icsTime(task.Timestamp))
+	if task.UpdatedAt != 0 {
+		w.property("LAST-MODIFIED", icsTime(task.UpdatedAt/1000))
+	}
+
+	summary := task.Detail
+	if component == icsComponentTodo {
+		if task.DueAt != 0 {
+			// A recurrence rule repeats a component from its DTSTART, so
+			// recurring to-dos start when they are due.
+			if task.Recurrence != "" {
+				w.property("DTSTART", icsTime(task.DueAt))
+			}
+			w.property("DUE", icsTime(task.DueAt))
+		}
+		if task.Completed {
+			w.property("STATUS", "COMPLETED")
+			w.property("PERCENT-COMPLETE", "100")
+		} else {
+			w.property("STATUS", "NEEDS-ACTION")
+		}
+	} else {
+		// Events end when they start if they have no end, and do not block
+		// time in the calendar.
+		w.property("DTSTART", icsTime(task.DueAt))
+		w.property("TRANSP", "TRANSPARENT")
+		if task.Completed {
+			summary = "✓ " + summary
+		}
+	}
+	w.property("SUMMARY", icsText(summary))
+
+	var categories []string
+	if task.Project != "" {
+		categories = append(categories, icsText(task.Project))
+	}
+	for _, tag := range task.Tags {
+		categories = append(categories, icsText(tag))
+	}
+	if len(categories) > 0 {
+		w.property("CATEGORIES", strings.Join(categories, ","))
+	}
+
+	// Recurrence rules are validated when they are saved, so they can be
+	// written as is. They are omitted without a due date to start from.
+	if task.Recurrence != "" && task.DueAt != 0 {
+		w.property("RRULE", task.Recurrence)
+	}
+
+	w.property("END", component)
+}
+
+// begin writes the start of an iCalendar object.
+func (w *icsWriter) begin() {
+	w.property("BEGIN", "VCALENDAR")
+	w.property("VERSION", "2.0")
+	w.property("PRODID", "-//Megtask//Megtask Tasks//EN")
+	w.property("CALSCALE", "GREGORIAN")
+}
+
+// end writes the end of an iCalendar object and returns the object.
+func (w *icsWriter) end() []byte {
+	w.property("END", "VCALENDAR")
+	return []byte(w.b.String())
+}
+
+// taskCalendar returns an iCalendar object with the provided name that
+// contains tasks as components of the provided type. Tasks without a due date
+// are skipped. uidDomain is added to task IDs to make the UIDs of the
+// components globally unique.
+func taskCalendar(name string, tasks []*db.Task, component, uidDomain string) []byte {
+	now := time.Now()
+	w := new(icsWriter)
+	w.begin()
+	w.property("METHOD", "PUBLISH")
+	w.property("X-WR-CALNAME", icsText(name))
+	for _, task := range tasks {
+		if task.DueAt != 0 {
+			w.task(task, component, task.ID+"@"+uidDomain, now)
+		}
+	}
+	return w.end()
+}
+
+// icsTime returns the RFC 5545 UTC date-time of a unix time in seconds.
+func icsTime(unix int64) string {
+	return time.Unix(unix, 0).UTC().Format(icsTimeLayout)
+}
+
+// icsTextEscaper escapes the characters that are not allowed in RFC 5545
+// text values.
+var icsTextEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+	"\r", `\n`,
+)
+
+// icsText returns s escaped as an RFC 5545 text value.
+func icsText(s string) string {
+	return icsTextEscaper.Replace(s)
+}
+
+// icsTextUnescaper reverses icsTextEscaper.
+var icsTextUnescaper = strings.NewReplacer(
+	`\\`, `\`,
+	`\;`, ";",
+	`\,`, ",",
+	`\n`, "\n",
+	`\N`, "\n",
+)
+
+// icsProperty is an unfolded content line of an iCalendar object.
+type icsProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// parseICSProperties returns the content lines of an iCalendar object.
+func parseICSProperties(data string) ([]*icsProperty, error) {
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\n ", "")
+	data = strings.ReplaceAll(data, "\n\t", "")
+
+	var properties []*icsProperty
+	for _, line := range strings.Split(data, "\n") {
+		if line == "" {
+			continue
+		}
+
+		// The value starts at the first colon that is not in a quoted
+		// parameter value.
+		quoted, valueStart := false, -1
+		for i := 0; i < len(line) && valueStart < 0; i++ {
+			switch line[i] {
+			case '"':
+				quoted = !quoted
+			case ':':
+				if !quoted {
+					valueStart = i
+				}
+			}
+		}
+		if valueStart < 0 {
+			return nil, fmt.Errorf("invalid content line %q", line)
+		}
+
+		parts := strings.Split(line[:valueStart], ";")
+		property := &icsProperty{
+			name:   strings.ToUpper(parts[0]),
+			params: make(map[string]string),
+			value:  line[valueStart+1:],
+		}
+		for _, param := range parts[1:] {
+			name, value, _ := strings.Cut(param, "=")
+			property.params[strings.ToUpper(name)] = strings.Trim(value, `"`)
+		}
+		properties = append(properties, property)
+	}
+
+	return properties, nil
+}
+
+// icsTodo is the information megtask keeps from a VTODO component.
+type icsTodo struct {
+	uid        string
+	summary    string
+	completed  bool
+	dueAt      int64
+	categories []string
+	recurrence string
+	// override is true for a VTODO that overrides a single occurrence of a
+	// recurring VTODO.
+	override bool
+}
+
+// parseICSTodo returns the VTODO component of an iCalendar object. Components
+// nested in the VTODO, such as alarms, and overrides of single occurrences of
+// a recurring VTODO are ignored.
+func parseICSTodo(data string) (*icsTodo, error) {
+	properties, err := parseICSProperties(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var todo, current *icsTodo
+	var components []string
+	for _, property := range properties {
+		switch property.name {
+		case "BEGIN":
+			components = append(components, strings.ToUpper(property.value))
+			if len(components) == 2 && components[1] == icsComponentTodo {
+				current = new(icsTodo)
+			}
+			continue
+		case "END":
+			if len(components) == 0 {
+				return nil, errors.New("unexpected END")
+			}
+			if len(components) == 2 && current != nil {
+				if !current.override && todo == nil {
+					todo = current
+				}
+				current = nil
+			}
+			components = components[:len(components)-1]
+			continue
+		}
+
+		if current == nil || len(components) != 2 {
+			continue
+		}
+
+		switch property.name {
+		case "UID":
+			current.uid = icsTextUnescaper.Replace(property.value)
+		case "RECURRENCE-ID":
+			current.override = true
+		case "SUMMARY":
+			current.summary = icsTextUnescaper.Replace(property.value)
+		case "STATUS":
+			current.completed = current.completed || strings.EqualFold(property.value, "COMPLETED")
+		case "COMPLETED":
+			current.completed = true
+		case "DUE":
+			current.dueAt, err = parseICSTime(property)
+			if err != nil {
+				return nil, err
+			}
+		case "CATEGORIES":
+			current.categories = append(current.categories, splitICSList(property.value)...)
+		case "RRULE":
+			current.recurrence = property.value
+		}
+	}
+
+	if len(components) != 0 {
+		return nil, errors.New("unterminated component")
+	}
+
+	if todo == nil {
+		return nil, errors.New("a VTODO component is required")
+	}
+
+	return todo, nil
+}
+
+// parseICSTime returns the unix time of a DATE or DATE-TIME property. Dates
+// and floating times are read as UTC.
+func parseICSTime(property *icsProperty) (int64, error) {
+	if property.params["VALUE"] == "DATE" || len(property.value) == len("20060102") {
+		t, err := time.Parse("20060102", property.value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s date %q", property.name, property.value)
+		}
+		return t.Unix(), nil
+	}
+
+	location := time.UTC
+	if tzid := property.params["TZID"]; tzid != "" && !strings.HasSuffix(property.value, "Z") {
+		if tzLocation, err := time.LoadLocation(tzid); err == nil {
+			location = tzLocation
+		}
+	}
+
+	t, err := time.ParseInLocation("20060102T150405", strings.TrimSuffix(property.value, "Z"), location)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s date-time %q", property.name, property.value)
+	}
+
+	return t.Unix(), nil
+}
+
+// splitICSList returns the unescaped values of a comma separated list of text
+// values.
+func splitICSList(value string) []string {
+	var values []string
+	var current strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value):
+			current.WriteByte(value[i])
+			current.WriteByte(value[i+1])
+			i++
+		case value[i] == ',':
+			values = append(values, icsTextUnescaper.Replace(current.String()))
+			current.Reset()
+		default:
+			current.WriteByte(value[i])
+		}
+	}
+	return append(values, icsTextUnescaper.Replace(current.String()))
+}
@@ -0,0 +1,208 @@
+package webserver
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+func TestICSWriterProperty(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		// wantLines is the number of folded lines.
+		wantLines int
+	}{
+		{"short line", "Buy milk", 1},
+		{"longest line", strings.Repeat("a", icsMaxLineLength-len("SUMMARY:")), 1},
+		{"folded line", strings.Repeat("a", icsMaxLineLength-len("SUMMARY:")+1), 2},
+		{"line folded twice", strings.Repeat("a", 2*icsMaxLineLength), 3},
+		{"multi-byte characters", strings.Repeat("é", icsMaxLineLength), 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := new(icsWriter)
+			w.property("SUMMARY", test.value)
+			out := w.b.String()
+
+			if !strings.HasSuffix(out, "\r\n") {
+				t.Fatalf("want line ending with CRLF, got %q", out)
+			}
+
+			lines := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+			if len(lines) != test.wantLines {
+				t.Fatalf("want %d lines, got %d: %q", test.wantLines, len(lines), out)
+			}
+			for i, line := range lines {
+				if len(line) > icsMaxLineLength {
+					t.Fatalf("want lines of at most %d octets, got %d", icsMaxLineLength, len(line))
+				}
+				if !utf8.ValidString(line) {
+					t.Fatalf("want lines folded between characters, got %q", line)
+				}
+				if i > 0 && line[0] != ' ' {
+					t.Fatalf("want continuation line starting with a space, got %q", line)
+				}
+			}
+
+			// Unfolding the lines returns the original line.
+			if unfolded := strings.ReplaceAll(strings.TrimSuffix(out, "\r\n"), "\r\n ", ""); unfolded != "SUMMARY:"+test.value {
+				t.Fatalf("want unfolded line %q, got %q", "SUMMARY:"+test.value, unfolded)
+			}
+		})
+	}
+}
+
+func TestICSText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"plain text", "Buy milk", "Buy milk"},
+		{"separators", "milk, eggs; bread", `milk\, eggs\; bread`},
+		{"backslash", `C:\tasks`, `C:\\tasks`},
+		{"line breaks", "one\r\ntwo\nthree\rfour", `one\ntwo\nthree\nfour`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := icsText(test.text)
+			if got != test.want {
+				t.Fatalf("want %q, got %q", test.want, got)
+			}
+
+			// Line breaks are all read back as \n.
+			if unescaped := icsTextUnescaper.Replace(got); unescaped != strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(test.text) {
+				t.Fatalf("want %q unescaped, got %q", test.text, unescaped)
+			}
+		})
+	}
+}
+
+func TestTaskCalendar(t *testing.T) {
+	const dueAt = 1735732800 // 2025-01-01T12:00:00Z
+
+	tests := []struct {
+		name      string
+		task      *db.Task
+		component string
+		// wantLines are content lines of the component.
+		wantLines []string
+		// unwantedLines are properties the component must not have.
+		unwantedLines []string
+	}{
+		{
+			name:          "pending to-do",
+			task:          &db.Task{ID: "task", TaskInfo: db.TaskInfo{Detail: "Buy milk, eggs", DueAt: dueAt, Timestamp: dueAt - 3600}},
+			component:     icsComponentTodo,
+			wantLines:     []string{"BEGIN:VTODO", "UID:task@example.com", "DUE:20250101T120000Z", "CREATED:20250101T110000Z", "STATUS:NEEDS-ACTION", `SUMMARY:Buy milk\, eggs`, "END:VTODO"},
+			unwantedLines: []string{"PERCENT-COMPLETE", "DTSTART", "CATEGORIES", "RRULE", "LAST-MODIFIED"},
+		},
+		{
+			name:          "completed to-do",
+			task:          &db.Task{ID: "task", UpdatedAt: dueAt * 1000, TaskInfo: db.TaskInfo{Detail: "Buy milk", Completed: true, DueAt: dueAt}},
+			component:     icsComponentTodo,
+			wantLines:     []string{"STATUS:COMPLETED", "PERCENT-COMPLETE:100", "LAST-MODIFIED:20250101T120000Z", "SUMMARY:Buy milk"},
+			unwantedLines: []string{"DTSTART"},
+		},
+		{
+			name:          "event",
+			task:          &db.Task{ID: "task", TaskInfo: db.TaskInfo{Detail: "Standup", DueAt: dueAt}},
+			component:     icsComponentEvent,
+			wantLines:     []string{"BEGIN:VEVENT", "DTSTART:20250101T120000Z", "TRANSP:TRANSPARENT", "SUMMARY:Standup", "END:VEVENT"},
+			unwantedLines: []string{"DUE", "STATUS"},
+		},
+		{
+			name:      "completed event",
+			task:      &db.Task{ID: "task", TaskInfo: db.TaskInfo{Detail: "Standup", Completed: true, DueAt: dueAt}},
+			component: icsComponentEvent,
+			wantLines: []string{"SUMMARY:✓ Standup"},
+		},
+		{
+			name:      "project, tags and recurrence",
+			task:      &db.Task{ID: "task", TaskInfo: db.TaskInfo{Detail: "Standup", DueAt: dueAt, Project: "work, team", Tags: []string{"daily", "meeting"}, Recurrence: "FREQ=DAILY;BYDAY=MO,TU"}},
+			component: icsComponentTodo,
+			wantLines: []string{`CATEGORIES:work\, team,daily,meeting`, "DTSTART:20250101T120000Z", "DUE:20250101T120000Z", "RRULE:FREQ=DAILY;BYDAY=MO,TU"},
+		},
+		{
+			name:          "recurring event",
+			task:          &db.Task{ID: "task", TaskInfo: db.TaskInfo{Detail: "Standup", DueAt: dueAt, Recurrence: "FREQ=DAILY"}},
+			component:     icsComponentEvent,
+			wantLines:     []string{"DTSTART:20250101T120000Z", "RRULE:FREQ=DAILY"},
+			unwantedLines: []string{"DUE"},
+		},
+		{
+			name:          "task without due date",
+			task:          &db.Task{ID: "task", TaskInfo: db.TaskInfo{Detail: "Someday"}},
+			component:     icsComponentTodo,
+			unwantedLines: []string{"BEGIN:VTODO", "SUMMARY"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := string(taskCalendar("Work; home", []*db.Task{test.task}, test.component, "example.com"))
+
+			if !strings.HasPrefix(out, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n") || !strings.HasSuffix(out, "END:VCALENDAR\r\n") {
+				t.Fatalf("want a VCALENDAR object, got %q", out)
+			}
+			lines := strings.Split(out, "\r\n")
+			hasLine := func(prefix string, exact bool) bool {
+				for _, line := range lines {
+					if line == prefix || (!exact && strings.HasPrefix(line, prefix+":")) {
+						return true
+					}
+				}
+				return false
+			}
+
+			if !hasLine(`X-WR-CALNAME:Work\; home`, true) {
+				t.Fatalf("want escaped calendar name, got %q", out)
+			}
+			for _, want := range test.wantLines {
+				if !hasLine(want, true) {
+					t.Fatalf("want line %q, got %q", want, out)
+				}
+			}
+			for _, unwanted := range test.unwantedLines {
+				if hasLine(unwanted, false) || hasLine(unwanted, true) {
+					t.Fatalf("want no %s line, got %q", unwanted, out)
+				}
+			}
+		})
+	}
+}
+
+func TestRecurringTodo(t *testing.T) {
+	const dueAt = 1735732800 // 2025-01-01T12:00:00Z
+
+	tests := []struct {
+		name      string
+		dueAt     int64
+		wantStart bool
+	}{
+		{"due date", dueAt, true},
+		{"no due date", 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			task := &db.Task{ID: "task", TaskInfo: db.TaskInfo{Detail: "Standup", DueAt: test.dueAt, Recurrence: "FREQ=DAILY"}}
+
+			w := new(icsWriter)
+			w.task(task, icsComponentTodo, "task@example.com", time.Unix(dueAt, 0))
+			out := w.b.String()
+
+			for _, line := range []string{"DTSTART:20250101T120000Z", "RRULE:FREQ=DAILY"} {
+				if strings.Contains(out, "\r\n"+line+"\r\n") != test.wantStart {
+					t.Fatalf("want %q line %v, got %q", line, test.wantStart, out)
+				}
+			}
+		})
+	}
+}
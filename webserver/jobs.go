@@ -0,0 +1,235 @@
+package webserver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+const (
+	// jobLockLease is how long a server holds the lock on a job without
+	// renewing it. Another server takes over the job once the lock expires,
+	// e.g after the server that held it is stopped.
+	jobLockLease = 30 * time.Second
+	// jobLockRenewInterval is how often servers try to acquire or renew the
+	// lock on each job, and is the precision of job intervals.
+	jobLockRenewInterval = 5 * time.Second
+
+	remindersJobName = "reminders"
+	purgeJobName     = "purge"
+
+	// purgeJobInterval is how often delivered records are purged.
+	purgeJobInterval = time.Hour
+	// deliveredRecordRetention is how long delivered reminders and finished
+	// webhook deliveries are kept.
+	deliveredRecordRetention = 30 * 24 * time.Hour
+)
+
+// job is a background task that runs periodically on one server at a time.
+type job struct {
+	name     string
+	interval time.Duration
+	run      func(ctx context.Context) error
+}
+
+// jobRunner runs jobs on the server that holds their lock in the database,
+// so a job does not run on several server instances at once. Each job has
+// its own lock, so jobs can run on different servers.
+type jobRunner struct {
+	taskDB TaskDatabase
+	log    *slog.Logger
+	// owner identifies this server in job locks.
+	owner string
+	jobs  []*job
+}
+
+// newJobRunner returns a *jobRunner that identifies the server by its
+// hostname and process.
+func newJobRunner(taskDB TaskDatabase, logger *slog.Logger) *jobRunner {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "megtask"
+	}
+
+	return &jobRunner{
+		taskDB: taskDB,
+		log:    logger,
+		owner:  fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), time.Now().UnixNano()),
+	}
+}
+
+// add registers a job that runs every interval. Jobs must be added before
+// the runner is started.
+func (jr *jobRunner) add(name string, interval time.Duration, run func(ctx context.Context) error) {
+	jr.jobs = append(jr.jobs, &job{name: name, interval: interval, run: run})
+}
+
+// run runs the registered jobs until ctx is canceled. Locks are not released
+// when ctx is canceled, as the database is shut down with the server, and
+// expire after jobLockLease.
+func (jr *jobRunner) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, j := range jr.jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			jr.schedule(ctx, j)
+		}()
+	}
+	wg.Wait()
+}
+
+// schedule runs j every interval while this server holds its lock, until ctx
+// is canceled.
+func (jr *jobRunner) schedule(ctx context.Context, j *job) {
+	ticker := time.NewTicker(jobLockRenewInterval)
+	defer ticker.Stop()
+
+	var held bool
+	var lastStartedAt time.Time
+	for {
+		acquired, err := jr.taskDB.AcquireJobLock(j.name, jr.owner, jobLockLease)
+		if err != nil {
+			jr.log.Error("taskDB.AcquireJobLock error: ", "job", j.name, "error", err)
+		}
+
+		if acquired && !held {
+			// The job may have run recently on the server that held the lock
+			// before.
+			status, err := jr.taskDB.Job(j.name)
+			if err != nil {
+				jr.log.Error("taskDB.Job error: ", "job", j.name, "error", err)
+				acquired = false
+			} else {
+				jr.log.Info("Acquired job lock: ", "job", j.name, "owner", jr.owner)
+				lastStartedAt = time.Unix(status.LastStartedAt, 0)
+			}
+		}
+		held = acquired
+
+		// Ticks are not exact, so a job is run on the tick closest to its
+		// interval.
+		if held && time.Since(lastStartedAt) > j.interval-jobLockRenewInterval/2 {
+			lastStartedAt = time.Now()
+			jr.runJob(ctx, j)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runJob runs j and records the result. The lock on j is renewed while it
+// runs, and the run is canceled if the lock is lost.
+func (jr *jobRunner) runJob(ctx context.Context, j *job) {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go jr.renewLock(runCtx, j, cancel)
+
+	startedAt := time.Now()
+	err := j.run(runCtx)
+	if ctx.Err() != nil {
+		// The database is unavailable once the server is shut down.
+		return
+	}
+
+	run := &db.JobRun{
+		Owner:      jr.owner,
+		StartedAt:  startedAt.UnixMilli(),
+		FinishedAt: time.Now().UnixMilli(),
+	}
+	if err != nil {
+		jr.log.Error("job run error: ", "job", j.name, "error", err)
+		run.Error = err.Error()
+	}
+
+	err = jr.taskDB.RecordJobRun(j.name, run)
+	if err != nil {
+		jr.log.Error("taskDB.RecordJobRun error: ", "job", j.name, "error", err)
+	}
+}
+
+// renewLock renews the lock on j until ctx is canceled, and calls cancel if
+// another server acquires the lock.
+func (jr *jobRunner) renewLock(ctx context.Context, j *job, cancel context.CancelFunc) {
+	ticker := time.NewTicker(jobLockRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		acquired, err := jr.taskDB.AcquireJobLock(j.name, jr.owner, jobLockLease)
+		if err != nil {
+			jr.log.Error("taskDB.AcquireJobLock error: ", "job", j.name, "error", err)
+			continue
+		}
+
+		if !acquired {
+			jr.log.Warn("Lost job lock while running: ", "job", j.name)
+			cancel()
+			return
+		}
+	}
+}
+
+// jobInfo is the status of a job with its schedule on this server.
+type jobInfo struct {
+	*db.Job
+	// Interval is how often the job runs, in seconds. It is zero for jobs
+	// that are not run by this server.
+	Interval int64 `json:"interval"`
+}
+
+// jobInfos returns the status of the jobs registered on this server followed
+// by the other jobs in statuses.
+func (jr *jobRunner) jobInfos(statuses []*db.Job) []*jobInfo {
+	byName := make(map[string]*db.Job, len(statuses))
+	for _, status := range statuses {
+		byName[status.Name] = status
+	}
+
+	infos := make([]*jobInfo, 0, len(statuses))
+	for _, j := range jr.jobs {
+		status := byName[j.name]
+		if status == nil {
+			status = &db.Job{Name: j.name}
+		}
+		delete(byName, j.name)
+		infos = append(infos, &jobInfo{Job: status, Interval: int64(j.interval / time.Second)})
+	}
+
+	for _, status := range statuses {
+		if _, ok := byName[status.Name]; ok {
+			infos = append(infos, &jobInfo{Job: status})
+		}
+	}
+
+	return infos
+}
+
+// purgeDeliveredRecords deletes the reminders and webhook deliveries that
+// were delivered more than deliveredRecordRetention ago.
+func (s *WebServer) purgeDeliveredRecords(context.Context) error {
+	purged, err := s.taskDB.PurgeDeliveredRecords(time.Now().Add(-deliveredRecordRetention).Unix())
+	if err != nil {
+		return fmt.Errorf("taskDB.PurgeDeliveredRecords error: %w", err)
+	}
+
+	if purged > 0 {
+		s.log.Info("Purged delivered records: ", "count", purged)
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package webserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+// jobsDB is a TaskDatabase with a job lock and the status of the job.
+type jobsDB struct {
+	authDB
+	lockErr error
+	// lockOwner is the server that holds the lock, if any.
+	lockOwner string
+	status    *db.Job
+	statusErr error
+	runs      []*db.JobRun
+}
+
+func (jdb *jobsDB) AcquireJobLock(name, owner string, lease time.Duration) (bool, error) {
+	if jdb.lockErr != nil {
+		return false, jdb.lockErr
+	}
+	if jdb.lockOwner != "" && jdb.lockOwner != owner {
+		return false, nil
+	}
+	jdb.lockOwner = owner
+	return true, nil
+}
+
+func (jdb *jobsDB) Job(name string) (*db.Job, error) {
+	return jdb.status, jdb.statusErr
+}
+
+func (jdb *jobsDB) RecordJobRun(name string, run *db.JobRun) error {
+	jdb.runs = append(jdb.runs, run)
+	return nil
+}
+
+func TestJobRunnerSchedule(t *testing.T) {
+	tests := []struct {
+		name string
+		jdb  *jobsDB
+		// runErr is returned by the job.
+		runErr  error
+		wantRun bool
+	}{
+		{name: "lock acquired", jdb: &jobsDB{status: &db.Job{Name: "job"}}, wantRun: true},
+		{name: "lock held by another server", jdb: &jobsDB{lockOwner: "other", status: &db.Job{Name: "job"}}},
+		{name: "lock error", jdb: &jobsDB{lockErr: errors.New("unavailable"), status: &db.Job{Name: "job"}}},
+		{name: "job ran recently on another server", jdb: &jobsDB{status: &db.Job{Name: "job", LastStartedAt: time.Now().Unix()}}},
+		{name: "job ran an interval ago", jdb: &jobsDB{status: &db.Job{Name: "job", LastStartedAt: time.Now().Add(-time.Hour).Unix()}}, wantRun: true},
+		{name: "status error", jdb: &jobsDB{statusErr: errors.New("unavailable")}},
+		{name: "failed run", jdb: &jobsDB{status: &db.Job{Name: "job"}}, runErr: errors.New("failed"), wantRun: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jr := newJobRunner(test.jdb, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			ran := false
+			jr.add("job", time.Hour, func(context.Context) error {
+				ran = true
+				return test.runErr
+			})
+
+			// The job is due on the first tick, and the next tick is after
+			// jobLockRenewInterval.
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			jr.run(ctx)
+
+			if ran != test.wantRun {
+				t.Fatalf("want job run %v, got %v", test.wantRun, ran)
+			}
+			if !test.wantRun {
+				if len(test.jdb.runs) != 0 {
+					t.Fatalf("want no run recorded, got %d", len(test.jdb.runs))
+				}
+				return
+			}
+
+			if len(test.jdb.runs) != 1 {
+				t.Fatalf("want 1 run recorded, got %d", len(test.jdb.runs))
+			}
+			run := test.jdb.runs[0]
+			if run.Owner != jr.owner || run.FinishedAt < run.StartedAt {
+				t.Fatalf("want run by %s, got %+v", jr.owner, run)
+			}
+			if test.runErr != nil && run.Error != test.runErr.Error() {
+				t.Fatalf("want run error %q, got %q", test.runErr, run.Error)
+			}
+		})
+	}
+}
+
+func TestJobInfos(t *testing.T) {
+	jr := newJobRunner(authDB{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	jr.add(remindersJobName, time.Minute, nil)
+	jr.add(purgeJobName, time.Hour, nil)
+
+	tests := []struct {
+		name     string
+		statuses []*db.Job
+		// wantInfos are the names and intervals of the jobs returned.
+		wantInfos string
+	}{
+		{"jobs have not run", nil, "reminders 60, purge 3600"},
+		{"jobs ran", []*db.Job{{Name: purgeJobName}, {Name: remindersJobName}}, "reminders 60, purge 3600"},
+		{"job of another server", []*db.Job{{Name: "report"}, {Name: purgeJobName}}, "reminders 60, purge 3600, report 0"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var infos []string
+			for _, info := range jr.jobInfos(test.statuses) {
+				infos = append(infos, info.Name+" "+strconv.FormatInt(info.Interval, 10))
+			}
+			if got := strings.Join(infos, ", "); got != test.wantInfos {
+				t.Fatalf("want jobs %q, got %q", test.wantInfos, got)
+			}
+		})
+	}
+}
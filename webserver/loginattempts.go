@@ -0,0 +1,259 @@
+package webserver
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+const (
+	// defaultMaxFailedLogins is the default number of consecutive failed
+	// logins for a username before it is locked.
+	defaultMaxFailedLogins = 10
+	// defaultMaxFailedLoginsPerIP is the default number of consecutive failed
+	// logins from an IP address before it is locked.
+	defaultMaxFailedLoginsPerIP = 50
+	// defaultLoginLockoutDuration is how long logins are locked by default
+	// after too many failed attempts.
+	defaultLoginLockoutDuration = 15 * time.Minute
+	// loginAttemptsWindow is how long failed login attempts are remembered
+	// after the last failure.
+	loginAttemptsWindow = time.Hour
+)
+
+// LoginAttemptStore stores failed login attempts so repeated failures can be
+// slowed down and locked out.
+type LoginAttemptStore interface {
+	// LoginAttempts returns the failed login attempts recorded for key within
+	// the window provided when they were recorded. A zero value is returned if
+	// no failed attempts have been recorded.
+	LoginAttempts(key string) (*db.LoginAttempts, error)
+	// RecordLoginFailure records a failed login attempt for key and returns
+	// the updated attempts. Failures are forgotten once window has passed
+	// since the last failure.
+	RecordLoginFailure(key string, window time.Duration) (*db.LoginAttempts, error)
+	// RefundLoginAttempt removes one failed login attempt recorded for key.
+	// It is used to give back attempts that were recorded before verifying
+	// credentials that turned out to be valid.
+	RefundLoginAttempt(key string) error
+	// ResetLoginAttempts removes the failed login attempts recorded for key.
+	ResetLoginAttempts(key string) error
+}
+
+// loginThrottle blocks logins for usernames and IP addresses with too many
+// consecutive failed attempts.
+type loginThrottle struct {
+	store           LoginAttemptStore
+	maxFailures     int
+	maxFailuresIP   int
+	lockoutDuration time.Duration
+}
+
+// usernameLoginKey returns the LoginAttemptStore key for a username.
+func usernameLoginKey(username string) string {
+	return "username:" + username
+}
+
+// twoFactorLoginKey returns the LoginAttemptStore key for two-factor
+// authentication attempts of a user.
+func twoFactorLoginKey(userID string) string {
+	return "2fa:" + userID
+}
+
+// ipLoginKey returns the LoginAttemptStore key for the IP address of req.
+func ipLoginKey(req *http.Request) string {
+	return "ip:" + reqIP(req)
+}
+
+// blockedUntil returns the time until which logins for key are blocked. The
+// zero time is returned if logins are not blocked.
+func (lt *loginThrottle) blockedUntil(key string, maxFailures int) (time.Time, error) {
+	attempts, err := lt.store.LoginAttempts(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	failures := attempts.Failures
+	if failures >= maxFailures {
+		return time.Unix(attempts.LastFailure, 0).Add(lt.lockoutDuration), nil
+	}
+
+	// The first half of the allowed failures are free, after which each
+	// failure doubles the delay before the next attempt is allowed.
+	freeFailures := maxFailures / 2
+	if failures <= freeFailures {
+		return time.Time{}, nil
+	}
+
+	delay := time.Duration(math.Pow(2, float64(failures-freeFailures-1))) * time.Second
+	delay = min(delay, lt.lockoutDuration)
+	return time.Unix(attempts.LastFailure, 0).Add(delay), nil
+}
+
+// reserveAttempt records a login attempt for the provided keys, mapped to
+// their maximum failures, before the credentials are verified so concurrent
+// attempts cannot all be allowed before their failures are recorded. Each
+// attempt is reserved atomically and rejected if other attempts have been
+// reserved since the keys were checked, unless they are within the free
+// failures. The attempt counts as a failure unless it is refunded with
+// refundAttempt. If the attempt is not allowed, nothing is reserved and the
+// time the caller must wait is returned.
+func (lt *loginThrottle) reserveAttempt(keys map[string]int) (time.Duration, error) {
+	var wait time.Duration
+	for key, maxFailures := range keys {
+		until, err := lt.blockedUntil(key, maxFailures)
+		if err != nil {
+			return 0, err
+		}
+		wait = max(wait, time.Until(until))
+	}
+	if wait > 0 {
+		return wait, nil
+	}
+
+	reserved := make([]string, 0, len(keys))
+	for key, maxFailures := range keys {
+		attempts, err := lt.store.LoginAttempts(key)
+		if err != nil {
+			lt.refundAttempt(reserved...)
+			return 0, err
+		}
+
+		reservation, err := lt.store.RecordLoginFailure(key, loginAttemptsWindow)
+		if err != nil {
+			lt.refundAttempt(reserved...)
+			return 0, err
+		}
+		reserved = append(reserved, key)
+
+		// The failures before this attempt are different from the ones
+		// checked if other attempts were reserved in the meantime. Those
+		// attempts are as recent as this one, so this one must wait for
+		// them unless the failures are still free.
+		failures := reservation.Failures - 1
+		concurrent := failures != attempts.Failures && failures > maxFailures/2
+		if failures >= maxFailures || concurrent {
+			if err := lt.refundAttempt(reserved...); err != nil {
+				return 0, err
+			}
+			return time.Second, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// refundAttempt gives back an attempt reserved with reserveAttempt for the
+// provided keys.
+func (lt *loginThrottle) refundAttempt(keys ...string) error {
+	for _, key := range keys {
+		err := lt.store.RefundLoginAttempt(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTooManyRequests writes an http.StatusTooManyRequests response with a
+// Retry-After header for wait.
+func (s *WebServer) writeTooManyRequests(res http.ResponseWriter, wait time.Duration) {
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	res.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	s.writeJSONResponse(res, http.StatusTooManyRequests, map[string]string{
+		"errorMessage": "too many failed login attempts, please try again in " + (time.Duration(retryAfter) * time.Second).String(),
+	})
+}
+
+// memoryLoginAttemptStore is an in-memory LoginAttemptStore. Attempts are not
+// shared between server instances and are lost when the server restarts.
+type memoryLoginAttemptStore struct {
+	mtx      sync.Mutex
+	attempts map[string]*memoryLoginAttempts
+	writes   int
+}
+
+type memoryLoginAttempts struct {
+	db.LoginAttempts
+	expiresAt time.Time
+}
+
+// newMemoryLoginAttemptStore returns a new instance of
+// *memoryLoginAttemptStore.
+func newMemoryLoginAttemptStore() *memoryLoginAttemptStore {
+	return &memoryLoginAttemptStore{
+		attempts: make(map[string]*memoryLoginAttempts),
+	}
+}
+
+// LoginAttempts returns the failed login attempts recorded for key.
+func (ms *memoryLoginAttemptStore) LoginAttempts(key string) (*db.LoginAttempts, error) {
+	ms.mtx.Lock()
+	defer ms.mtx.Unlock()
+
+	attempts, found := ms.attempts[key]
+	if !found || time.Now().After(attempts.expiresAt) {
+		return &db.LoginAttempts{}, nil
+	}
+
+	loginAttempts := attempts.LoginAttempts
+	return &loginAttempts, nil
+}
+
+// RecordLoginFailure records a failed login attempt for key and returns the
+// updated attempts.
+func (ms *memoryLoginAttemptStore) RecordLoginFailure(key string, window time.Duration) (*db.LoginAttempts, error) {
+	ms.mtx.Lock()
+	defer ms.mtx.Unlock()
+
+	now := time.Now()
+
+	// Remove expired attempts every now and then so the map does not grow
+	// without bounds.
+	const pruneInterval = 1000
+	ms.writes++
+	if ms.writes%pruneInterval == 0 {
+		for k, attempts := range ms.attempts {
+			if now.After(attempts.expiresAt) {
+				delete(ms.attempts, k)
+			}
+		}
+	}
+
+	attempts, found := ms.attempts[key]
+	if !found || now.After(attempts.expiresAt) {
+		attempts = new(memoryLoginAttempts)
+		ms.attempts[key] = attempts
+	}
+
+	attempts.Failures++
+	attempts.LastFailure = now.Unix()
+	attempts.expiresAt = now.Add(window)
+
+	loginAttempts := attempts.LoginAttempts
+	return &loginAttempts, nil
+}
+
+// RefundLoginAttempt removes one failed login attempt recorded for key.
+func (ms *memoryLoginAttemptStore) RefundLoginAttempt(key string) error {
+	ms.mtx.Lock()
+	defer ms.mtx.Unlock()
+
+	if attempts, found := ms.attempts[key]; found && attempts.Failures > 0 {
+		attempts.Failures--
+	}
+	return nil
+}
+
+// ResetLoginAttempts removes the failed login attempts recorded for key.
+func (ms *memoryLoginAttemptStore) ResetLoginAttempts(key string) error {
+	ms.mtx.Lock()
+	defer ms.mtx.Unlock()
+
+	delete(ms.attempts, key)
+	return nil
+}
@@ -0,0 +1,222 @@
+package webserver
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+func TestReserveAttempt(t *testing.T) {
+	const maxFailures = 10
+
+	tests := []struct {
+		name         string
+		failures     int
+		wantWait     bool
+		wantFailures int
+	}{
+		{"no failures", 0, false, 1},
+		{"free failures", maxFailures / 2, false, maxFailures/2 + 1},
+		{"delayed after the free failures", maxFailures/2 + 1, true, maxFailures/2 + 1},
+		{"locked", maxFailures, true, maxFailures},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lt := &loginThrottle{
+				store:           newMemoryLoginAttemptStore(),
+				lockoutDuration: defaultLoginLockoutDuration,
+			}
+			for i := 0; i < test.failures; i++ {
+				lt.store.RecordLoginFailure("key", loginAttemptsWindow)
+			}
+
+			wait, err := lt.reserveAttempt(map[string]int{"key": maxFailures})
+			if err != nil {
+				t.Fatalf("reserveAttempt error: %v", err)
+			}
+			if (wait > 0) != test.wantWait {
+				t.Fatalf("want wait %v, got %v", test.wantWait, wait)
+			}
+
+			attempts, _ := lt.store.LoginAttempts("key")
+			if attempts.Failures != test.wantFailures {
+				t.Fatalf("want %d failures, got %d", test.wantFailures, attempts.Failures)
+			}
+
+			if !test.wantWait {
+				if err := lt.refundAttempt("key"); err != nil {
+					t.Fatalf("refundAttempt error: %v", err)
+				}
+				attempts, _ := lt.store.LoginAttempts("key")
+				if attempts.Failures != test.failures {
+					t.Fatalf("want %d failures after refund, got %d", test.failures, attempts.Failures)
+				}
+			}
+		})
+	}
+}
+
+// loginDB is a TaskDatabase that accepts one password for every username.
+// Checking a password takes a while, like bcrypt does.
+type loginDB struct {
+	TaskDatabase
+	password string
+	logins   *atomic.Int32
+}
+
+func (ldb loginDB) Login(username, password string) (*db.User, error) {
+	ldb.logins.Add(1)
+	time.Sleep(10 * time.Millisecond)
+	if password != ldb.password {
+		return nil, db.ErrorInvalidRequest
+	}
+	// Two-factor logins are completed without creating a session.
+	return &db.User{ID: "user", Username: username, TwoFactorEnabled: true}, nil
+}
+
+func TestConcurrentLoginsAreThrottled(t *testing.T) {
+	ldb := loginDB{password: "password", logins: new(atomic.Int32)}
+	s := newTestServer(t, ldb, nil)
+
+	// All the logins of a burst are allowed by the same check unless their
+	// attempts are reserved before the password is verified.
+	const burst = 50
+	var wg sync.WaitGroup
+	for i := 0; i < burst; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			testRequest(t, s, http.MethodPost, "/login", "", map[string]string{"username": "user", "password": "wrong"})
+		}()
+	}
+	wg.Wait()
+
+	want := int32(defaultMaxFailedLogins/2 + 1)
+	if logins := ldb.logins.Load(); logins != want {
+		t.Fatalf("want %d passwords verified, got %d", want, logins)
+	}
+}
+
+func TestSuccessfulLoginRefundsAttempt(t *testing.T) {
+	ldb := loginDB{password: "password", logins: new(atomic.Int32)}
+	s := newTestServer(t, ldb, nil)
+
+	tests := []struct {
+		name           string
+		username       string
+		password       string
+		wantStatus     int
+		wantIPFailures int
+	}{
+		{"wrong password", "a", "wrong", http.StatusBadRequest, 1},
+		{"other username", "b", "wrong", http.StatusBadRequest, 2},
+		{"correct password", "a", "password", http.StatusOK, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := testRequest(t, s, http.MethodPost, "/login", "", map[string]string{"username": test.username, "password": test.password})
+			checkStatus(t, res, test.wantStatus)
+
+			attempts, _ := s.loginThrottle.store.LoginAttempts("ip:192.0.2.1")
+			if attempts.Failures != test.wantIPFailures {
+				t.Fatalf("want %d failures for the IP address, got %d", test.wantIPFailures, attempts.Failures)
+			}
+		})
+	}
+
+	// The failures of the username are reset by the successful login.
+	attempts, _ := s.loginThrottle.store.LoginAttempts(usernameLoginKey("a"))
+	if attempts.Failures != 0 {
+		t.Fatalf("want no failures for the username, got %d", attempts.Failures)
+	}
+}
+
+func TestBlockedUntil(t *testing.T) {
+	const (
+		maxFailures = 10
+		lockout     = 15 * time.Minute
+	)
+
+	tests := []struct {
+		name      string
+		failures  int
+		wantDelay time.Duration
+	}{
+		{"no failures", 0, 0},
+		{"free failures", maxFailures / 2, 0},
+		{"first delayed failure", maxFailures/2 + 1, time.Second},
+		{"second delayed failure", maxFailures/2 + 2, 2 * time.Second},
+		{"last failure before lockout", maxFailures - 1, 8 * time.Second},
+		{"locked", maxFailures, lockout},
+		{"locked after more failures", maxFailures + 5, lockout},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lt := &loginThrottle{store: newMemoryLoginAttemptStore(), lockoutDuration: lockout}
+			for i := 0; i < test.failures; i++ {
+				lt.store.RecordLoginFailure("key", loginAttemptsWindow)
+			}
+
+			until, err := lt.blockedUntil("key", maxFailures)
+			if err != nil {
+				t.Fatalf("blockedUntil error: %v", err)
+			}
+
+			if test.wantDelay == 0 {
+				if !until.IsZero() {
+					t.Fatalf("want no delay, blocked until %v", until)
+				}
+				return
+			}
+
+			attempts, _ := lt.store.LoginAttempts("key")
+			if delay := until.Sub(time.Unix(attempts.LastFailure, 0)); delay != test.wantDelay {
+				t.Fatalf("want delay %v, got %v", test.wantDelay, delay)
+			}
+		})
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	ldb := loginDB{password: "password", logins: new(atomic.Int32)}
+	s := newTestServer(t, ldb, nil)
+
+	for i := 0; i < defaultMaxFailedLogins; i++ {
+		s.loginThrottle.store.RecordLoginFailure(usernameLoginKey("locked"), loginAttemptsWindow)
+	}
+
+	tests := []struct {
+		name           string
+		username       string
+		password       string
+		wantStatus     int
+		wantRetryAfter bool
+	}{
+		{"locked username", "locked", "password", http.StatusTooManyRequests, true},
+		{"other username", "other", "password", http.StatusOK, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := testRequest(t, s, http.MethodPost, "/login", "", map[string]string{"username": test.username, "password": test.password})
+			checkStatus(t, res, test.wantStatus)
+
+			retryAfter := res.Header().Get("Retry-After")
+			if (retryAfter != "") != test.wantRetryAfter {
+				t.Fatalf("want Retry-After %v, got %q", test.wantRetryAfter, retryAfter)
+			}
+		})
+	}
+
+	// A locked username is rejected before its password is verified.
+	if logins := ldb.logins.Load(); logins != 1 {
+		t.Fatalf("want 1 password verified, got %d", logins)
+	}
+}
@@ -0,0 +1,8 @@
+package webserver
+
+// Mailer sends emails to users.
+type Mailer interface {
+	// SendMail sends a plain text email with the provided subject and body to
+	// the provided email address.
+	SendMail(to, subject, body string) error
+}
@@ -2,34 +2,246 @@ package webserver
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ukane-philemon/megtask/db"
 )
 
 const jwtHeader = "Megtask-Authentication-Token"
 const userIDCtxKey = "userID"
+const userRoleCtxKey = "userRole"
+const sessionIDCtxKey = "sessionID"
+
+// apiTokenScopesCtxKey is the context key for the scopes of the personal
+// access token used to authenticate a request. It is not set for requests
+// authenticated with a login token.
+const apiTokenScopesCtxKey = "apiTokenScopes"
+
+// workspaceRoleCtxKey is the context key for the role of the authenticated
+// user in the workspace of a request.
+const workspaceRoleCtxKey = "workspaceRole"
+
+// errNotAuthorized is returned by authenticate when the auth token is
+// missing or invalid.
+var errNotAuthorized = errors.New("not authorized")
 
 // authMiddleware ensures the the correct and valid auth token is provided in
-// this request.
+// this request. A login token can be provided in the jwtHeader or as a bearer
+// token in the Authorization header, personal access tokens can only be
+// provided as bearer tokens.
 func (s *WebServer) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
 		authToken := req.Header.Get(jwtHeader)
 		if authToken == "" {
-			s.writeJSONResponse(res, http.StatusUnauthorized, "not authorized")
-			return
+			authToken = bearerToken(req)
 		}
 
-		userID, validToken := s.jwtManager.IsValidToken(authToken)
-		if !validToken {
-			s.writeJSONResponse(res, http.StatusUnauthorized, "not authorized")
+		ctx, err := s.authenticate(req.Context(), authToken)
+		if err != nil {
+			if errors.Is(err, errNotAuthorized) {
+				s.writeJSONResponse(res, http.StatusUnauthorized, "not authorized")
+			} else {
+				s.writeServerError(res, err)
+			}
 			return
 		}
 
 		// Set userID for use in subsequent handlers.
-		req = req.WithContext(context.WithValue(req.Context(), userIDCtxKey, userID))
+		req = req.WithContext(ctx)
+		next.ServeHTTP(res, req)
+	})
+}
+
+// authenticate returns ctx with the ID and current role of the user authToken
+// was issued to, and the scopes of personal access tokens or the session of
+// login tokens. Returns errNotAuthorized if authToken is not valid or its user
+// has been disabled.
+func (s *WebServer) authenticate(ctx context.Context, authToken string) (context.Context, error) {
+	if authToken == "" {
+		return nil, errNotAuthorized
+	}
+
+	if strings.HasPrefix(authToken, apiTokenPrefix) {
+		userID, scopes, err := s.taskDB.APITokenOwner(authToken)
+		if err != nil {
+			if errors.Is(err, db.ErrorInvalidRequest) {
+				return nil, errNotAuthorized
+			}
+			return nil, fmt.Errorf("taskDB.APITokenOwner error: %w", err)
+		}
+
+		// Api tokens never have more than the user role since they cannot
+		// access admin endpoints.
+		ctx = context.WithValue(ctx, userIDCtxKey, userID)
+		ctx = context.WithValue(ctx, userRoleCtxKey, db.RoleUser)
+		ctx = context.WithValue(ctx, apiTokenScopesCtxKey, scopes)
+		return ctx, nil
+	}
+
+	claims, validToken := s.jwtManager.IsValidToken(authToken)
+	if !validToken || claims.SessionID == "" {
+		return nil, errNotAuthorized
+	}
+
+	// Check the session on every request so revoked sessions are logged out
+	// immediately.
+	err := s.taskDB.TouchSession(claims.ID, claims.SessionID)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			return nil, errNotAuthorized
+		}
+		return nil, fmt.Errorf("taskDB.TouchSession error: %w", err)
+	}
+
+	// Check the user on every request too, so disabled users are logged out
+	// and role changes apply immediately instead of when the token expires.
+	role, err := s.taskDB.UserRole(claims.ID)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			return nil, errNotAuthorized
+		}
+		return nil, fmt.Errorf("taskDB.UserRole error: %w", err)
+	}
+
+	ctx = context.WithValue(ctx, userIDCtxKey, claims.ID)
+	ctx = context.WithValue(ctx, userRoleCtxKey, role)
+	ctx = context.WithValue(ctx, sessionIDCtxKey, claims.SessionID)
+	return ctx, nil
+}
+
+// apiTokenScopeMiddleware ensures requests authenticated with a personal
+// access token are to a route listed in apiTokenRouteScopes, and that the
+// token has the scope of the route. Requests authenticated with a login token
+// are not checked. It must be used after authMiddleware and run after the
+// route is matched, i.e. in a group or with With, so the full route pattern
+// is known.
+func (s *WebServer) apiTokenScopeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Context().Value(apiTokenScopesCtxKey) == nil {
+			next.ServeHTTP(res, req)
+			return
+		}
+
+		route := req.Method + " " + chi.RouteContext(req.Context()).RoutePattern()
+		scope, allowed := apiTokenRouteScopes[route]
+		if !allowed {
+			s.writeJSONResponse(res, http.StatusForbidden, map[string]string{
+				"errorMessage": "this endpoint cannot be accessed with an api token",
+			})
+			return
+		}
+
+		if scope != "" && !reqHasScope(req, scope) {
+			s.writeJSONResponse(res, http.StatusForbidden, map[string]string{
+				"errorMessage": fmt.Sprintf("api token is missing the %q scope", scope),
+			})
+			return
+		}
+
+		next.ServeHTTP(res, req)
+	})
+}
+
+// reqHasScope returns true if req was authenticated with a login token or
+// with a personal access token that has the provided scope.
+func reqHasScope(req *http.Request, scope string) bool {
+	return ctxHasScope(req.Context(), scope)
+}
+
+// ctxHasScope is like reqHasScope for the context of an authenticated
+// request.
+func ctxHasScope(ctx context.Context, scope string) bool {
+	scopes, isAPIToken := ctx.Value(apiTokenScopesCtxKey).([]string)
+	return !isAPIToken || slices.Contains(scopes, scope)
+}
+
+// requireRole returns a middleware that ensures the authenticated user has the
+// provided role. It must be used after authMiddleware.
+func (s *WebServer) requireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if s.reqUserRole(req) != role {
+				s.writeJSONResponse(res, http.StatusForbidden, map[string]string{
+					"errorMessage": "you do not have permission to access this endpoint",
+				})
+				return
+			}
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+// workspaceMiddleware ensures the authenticated user is a member of the
+// workspace in the request URL and adds their workspace role to the request
+// context. It must be used after authMiddleware on routes with a
+// "{workspaceID}" URL parameter.
+func (s *WebServer) workspaceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		workspaceID := chi.URLParam(req, "workspaceID")
+		role, err := s.taskDB.WorkspaceRole(workspaceID, s.reqUserID(req))
+		if err != nil {
+			if errors.Is(err, db.ErrorInvalidRequest) {
+				s.writeJSONResponse(res, http.StatusNotFound, map[string]string{
+					"errorMessage": "workspace does not exist",
+				})
+			} else {
+				s.writeServerError(res, fmt.Errorf("taskDB.WorkspaceRole error: %w", err))
+			}
+			return
+		}
+
+		ctx := context.WithValue(req.Context(), workspaceRoleCtxKey, role)
+		next.ServeHTTP(res, req.WithContext(ctx))
+	})
+}
+
+// taskWorkspaceMiddleware ensures the task in the request URL is in the
+// workspace in the request URL, or in no workspace on routes without a
+// "{workspaceID}" URL parameter, so workspace roles are always checked in the
+// task's own workspace. Tasks in other workspaces are reported as missing. It
+// must be used after authMiddleware, and after workspaceMiddleware on
+// workspace routes, on routes with a "{taskID}" URL parameter.
+func (s *WebServer) taskWorkspaceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		workspaceID, err := s.taskDB.TaskWorkspaceID(chi.URLParam(req, "taskID"))
+		if err != nil && !errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeServerError(res, fmt.Errorf("taskDB.TaskWorkspaceID error: %w", err))
+			return
+		}
+
+		if err != nil || workspaceID != chi.URLParam(req, "workspaceID") {
+			s.writeJSONResponse(res, http.StatusNotFound, map[string]string{
+				"errorMessage": "task does not exist",
+			})
+			return
+		}
+
 		next.ServeHTTP(res, req)
 	})
 }
 
+// requireWorkspaceRole returns a middleware that ensures the authenticated
+// user has one of the provided roles in the workspace of the request. It must
+// be used after workspaceMiddleware.
+func (s *WebServer) requireWorkspaceRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if !slices.Contains(roles, s.reqWorkspaceRole(req)) {
+				s.writeJSONResponse(res, http.StatusForbidden, map[string]string{
+					"errorMessage": "your workspace role does not allow this action",
+				})
+				return
+			}
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
 // reqUserID retrieves the userID from an authenticated request.
 func (s *WebServer) reqUserID(req *http.Request) string {
 	userIDVal := req.Context().Value(userIDCtxKey)
@@ -38,3 +250,42 @@ func (s *WebServer) reqUserID(req *http.Request) string {
 	}
 	return ""
 }
+
+// reqUserRole retrieves the role of the user from an authenticated request.
+func (s *WebServer) reqUserRole(req *http.Request) string {
+	roleVal := req.Context().Value(userRoleCtxKey)
+	if roleVal != nil {
+		return roleVal.(string)
+	}
+	return ""
+}
+
+// reqSessionID retrieves the login session ID from a request authenticated
+// with a login token.
+func (s *WebServer) reqSessionID(req *http.Request) string {
+	sessionIDVal := req.Context().Value(sessionIDCtxKey)
+	if sessionIDVal != nil {
+		return sessionIDVal.(string)
+	}
+	return ""
+}
+
+// reqWorkspaceRole retrieves the role of the user in the workspace of a
+// request.
+func (s *WebServer) reqWorkspaceRole(req *http.Request) string {
+	roleVal := req.Context().Value(workspaceRoleCtxKey)
+	if roleVal != nil {
+		return roleVal.(string)
+	}
+	return ""
+}
+
+// bearerToken returns the token in the Authorization header of req if it uses
+// the Bearer scheme.
+func bearerToken(req *http.Request) string {
+	scheme, token, found := strings.Cut(req.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
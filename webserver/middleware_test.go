@@ -0,0 +1,168 @@
+package webserver
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ukane-philemon/megtask/db"
+)
+
+// authDB is a TaskDatabase that accepts every login session of the users in
+// roles, which maps enabled users to their current role, and the api tokens
+// in scopes, which maps api tokens to their scopes.
+type authDB struct {
+	TaskDatabase
+	roles  map[string]string
+	scopes map[string][]string
+}
+
+func (adb authDB) APITokenOwner(token string) (string, []string, error) {
+	scopes, ok := adb.scopes[token]
+	if !ok {
+		return "", nil, db.ErrorInvalidRequest
+	}
+	return "user", scopes, nil
+}
+
+func (authDB) TouchSession(userID, sessionID string) error {
+	return nil
+}
+
+func (adb authDB) UserRole(userID string) (string, error) {
+	role, ok := adb.roles[userID]
+	if !ok {
+		return "", db.ErrorInvalidRequest
+	}
+	return role, nil
+}
+
+func (authDB) Users(offset, limit int64) ([]*db.UserSummary, error) {
+	return nil, nil
+}
+
+func (authDB) Webhooks(userID string) ([]*db.Webhook, error) {
+	return nil, nil
+}
+
+func (authDB) Sessions(userID string) ([]*db.Session, error) {
+	return nil, nil
+}
+
+func (authDB) QueueWebhookDeliveries(userIDs []string, event, payload string) error {
+	return nil
+}
+
+func TestAPITokenScopes(t *testing.T) {
+	const (
+		readToken  = apiTokenPrefix + "read"
+		writeToken = apiTokenPrefix + "write"
+	)
+	adb := authDB{roles: map[string]string{"user": db.RoleUser}, scopes: map[string][]string{
+		readToken:  {scopeTasksRead},
+		writeToken: {scopeTasksWrite},
+	}}
+	s := newTestServer(t, adb, nil)
+
+	loginToken, err := s.jwtManager.GenerateJWtToken("user", db.RoleUser, "session", time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateJWtToken error: %v", err)
+	}
+
+	const (
+		missingScope = "missing the"
+		notListed    = "cannot be accessed with an api token"
+	)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		wantStatus int
+		wantError  string
+	}{
+		{"read token with read scope", http.MethodGet, "/webhooks", readToken, http.StatusOK, ""},
+		{"write token without read scope", http.MethodGet, "/webhooks", writeToken, http.StatusForbidden, missingScope},
+		{"read token without write scope", http.MethodPost, "/task", readToken, http.StatusForbidden, missingScope},
+		{"read token creates a webhook", http.MethodPost, "/webhooks", readToken, http.StatusForbidden, missingScope},
+		{"read token deletes a webhook", http.MethodDelete, "/webhooks/w", readToken, http.StatusForbidden, missingScope},
+		{"read token pings a webhook", http.MethodPost, "/webhooks/w/ping", readToken, http.StatusForbidden, missingScope},
+		{"caldav without read scope", "PROPFIND", caldavHomePath, writeToken, http.StatusForbidden, missingScope},
+		{"workspace route without write scope", http.MethodPost, "/workspaces/w/leave", readToken, http.StatusForbidden, missingScope},
+		{"api token on unlisted route", http.MethodGet, "/sessions", readToken, http.StatusForbidden, notListed},
+		{"api token on account route", http.MethodPost, "/api-tokens", writeToken, http.StatusForbidden, notListed},
+		{"api token on admin route", http.MethodGet, "/admin/users", readToken, http.StatusForbidden, notListed},
+		{"login token on unlisted route", http.MethodGet, "/sessions", loginToken, http.StatusOK, ""},
+		{"login token on scoped route", http.MethodGet, "/webhooks", loginToken, http.StatusOK, ""},
+		{"unknown api token", http.MethodGet, "/webhooks", apiTokenPrefix + "unknown", http.StatusUnauthorized, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := testRequest(t, s, test.method, test.path, test.token, nil)
+			checkStatus(t, res, test.wantStatus)
+			if !strings.Contains(res.Body.String(), test.wantError) {
+				t.Fatalf("want error %q, got %s", test.wantError, res.Body.String())
+			}
+		})
+	}
+}
+
+func TestLoginTokenUserChecks(t *testing.T) {
+	adb := authDB{roles: map[string]string{
+		"user":     db.RoleUser,
+		"admin":    db.RoleAdmin,
+		"demoted":  db.RoleUser,
+		"promoted": db.RoleAdmin,
+	}}
+	s := newTestServer(t, adb, nil)
+
+	tests := []struct {
+		name       string
+		userID     string
+		tokenRole  string
+		path       string
+		wantStatus int
+	}{
+		{"enabled user", "user", db.RoleUser, "/sessions", http.StatusOK},
+		{"disabled user", "disabled", db.RoleUser, "/sessions", http.StatusUnauthorized},
+		{"admin", "admin", db.RoleAdmin, "/admin/users", http.StatusOK},
+		{"admin demoted after login", "demoted", db.RoleAdmin, "/admin/users", http.StatusForbidden},
+		{"user promoted after login", "promoted", db.RoleUser, "/admin/users", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token, err := s.jwtManager.GenerateJWtToken(test.userID, test.tokenRole, "session", time.Minute)
+			if err != nil {
+				t.Fatalf("GenerateJWtToken error: %v", err)
+			}
+
+			res := testRequest(t, s, http.MethodGet, test.path, token, nil)
+			checkStatus(t, res, test.wantStatus)
+		})
+	}
+}
+
+func TestAPITokenRouteScopesAreRoutes(t *testing.T) {
+	s := newTestServer(t, authDB{}, &Config{BlobStore: newMemBlobStore()})
+
+	routes := make(map[string]bool)
+	err := chi.Walk(s.mux, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		routes[method+" "+strings.TrimSuffix(route, "/")] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("chi.Walk error: %v", err)
+	}
+
+	// A misspelled route would silently deny api tokens access to it.
+	for route := range apiTokenRouteScopes {
+		if !routes[route] {
+			t.Errorf("%s is not a route", route)
+		}
+	}
+}
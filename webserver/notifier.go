@@ -0,0 +1,99 @@
+package webserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+// TaskReminderEvent is sent to webhooks when a reminder is due.
+const TaskReminderEvent = "task.reminder"
+
+// Notifier delivers task reminders to users.
+type Notifier interface {
+	// Notify delivers reminder to the user that set it.
+	Notify(ctx context.Context, reminder *db.DueReminder) error
+}
+
+// LogNotifier writes reminders to a log. It is useful in development.
+type LogNotifier struct {
+	log *slog.Logger
+}
+
+// NewLogNotifier returns a new *LogNotifier that writes to logger.
+func NewLogNotifier(logger *slog.Logger) *LogNotifier {
+	return &LogNotifier{log: logger}
+}
+
+// Notify logs reminder.
+func (ln *LogNotifier) Notify(_ context.Context, reminder *db.DueReminder) error {
+	ln.log.Info("Task reminder: ", "username", reminder.Username, "taskID", reminder.TaskID, "detail", reminder.Task.Detail)
+	return nil
+}
+
+// EmailNotifier emails reminders to users. Users without an email address
+// are skipped.
+type EmailNotifier struct {
+	mailer Mailer
+}
+
+// NewEmailNotifier returns a new *EmailNotifier that sends emails with
+// mailer.
+func NewEmailNotifier(mailer Mailer) *EmailNotifier {
+	return &EmailNotifier{mailer: mailer}
+}
+
+// Notify emails reminder to its user.
+func (en *EmailNotifier) Notify(_ context.Context, reminder *db.DueReminder) error {
+	if reminder.Email == "" {
+		return nil
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nThis is a reminder about your task:\n\n%s\n", reminder.Username, reminder.Task.Detail)
+	if reminder.Task.DueAt != 0 {
+		body += fmt.Sprintf("\nIt is due on %s.\n", time.Unix(reminder.Task.DueAt, 0).UTC().Format(time.RFC1123))
+	}
+
+	return en.mailer.SendMail(reminder.Email, "Megtask reminder", body)
+}
+
+// WebhookNotifier queues reminders for the webhooks of users as
+// TaskReminderEvent deliveries.
+type WebhookNotifier struct {
+	taskDB TaskDatabase
+}
+
+// NewWebhookNotifier returns a new *WebhookNotifier that queues deliveries
+// in taskDB.
+func NewWebhookNotifier(taskDB TaskDatabase) *WebhookNotifier {
+	return &WebhookNotifier{taskDB: taskDB}
+}
+
+// Notify queues reminder for the webhooks of its user. The deliveries are
+// sent by the server's webhook dispatcher.
+func (wn *WebhookNotifier) Notify(_ context.Context, reminder *db.DueReminder) error {
+	task := *reminder.Task
+	task.Permission = ""
+
+	payload, err := json.Marshal(map[string]any{
+		"type":      TaskReminderEvent,
+		"taskID":    reminder.TaskID,
+		"task":      &task,
+		"reminder":  reminder.Reminder,
+		"timestamp": time.Now().Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("json.Marshal error: %w", err)
+	}
+
+	err = wn.taskDB.QueueWebhookDeliveries([]string{reminder.UserID}, TaskReminderEvent, string(payload))
+	if err != nil {
+		return fmt.Errorf("taskDB.QueueWebhookDeliveries error: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package webserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+	"github.com/ukane-philemon/megtask/oidc"
+)
+
+const (
+	// oidcFlowExpiry is how long a user has to complete a login at the
+	// identity provider.
+	oidcFlowExpiry = 10 * time.Minute
+	// oidcStateCookie is the cookie that binds a login flow to the browser
+	// that started it.
+	oidcStateCookie = "megtask_oidc_state"
+	// deviceLabelQueryKey is the expected query key to provide a device label
+	// for the login session.
+	deviceLabelQueryKey = "deviceLabel"
+	// oidcRequestTimeout is the maximum duration of requests to the identity
+	// provider made while handling a request.
+	oidcRequestTimeout = 15 * time.Second
+)
+
+// oidcFlow is information about an identity provider login that has been
+// started but not completed.
+type oidcFlow struct {
+	nonce        string
+	codeVerifier string
+	deviceLabel  string
+	expiresAt    time.Time
+}
+
+// oidcFlows stores identity provider logins in progress by their state.
+type oidcFlows struct {
+	mtx   sync.Mutex
+	flows map[string]*oidcFlow
+}
+
+// add saves flow for state and removes expired flows.
+func (of *oidcFlows) add(state string, flow *oidcFlow) {
+	of.mtx.Lock()
+	defer of.mtx.Unlock()
+
+	now := time.Now()
+	for s, f := range of.flows {
+		if now.After(f.expiresAt) {
+			delete(of.flows, s)
+		}
+	}
+
+	of.flows[state] = flow
+}
+
+// take removes and returns the unexpired flow for state.
+func (of *oidcFlows) take(state string) *oidcFlow {
+	of.mtx.Lock()
+	defer of.mtx.Unlock()
+
+	flow, found := of.flows[state]
+	if !found {
+		return nil
+	}
+
+	delete(of.flows, state)
+	if time.Now().After(flow.expiresAt) {
+		return nil
+	}
+
+	return flow
+}
+
+// handleOIDCLogin handles the "GET /auth/oidc/login" endpoint and redirects
+// the user to the identity provider to login. This endpoint accepts an
+// optional "deviceLabel" query parameter for the login session.
+func (s *WebServer) handleOIDCLogin(res http.ResponseWriter, req *http.Request) {
+	deviceLabel := req.URL.Query().Get(deviceLabelQueryKey)
+	err := validateDeviceLabel(deviceLabel)
+	if err != nil {
+		s.writeBadRequest(res, err.Error())
+		return
+	}
+
+	var state, nonce, codeVerifier string
+	for _, value := range []*string{&state, &nonce, &codeVerifier} {
+		randomValue, err := oidc.RandomString()
+		if err != nil {
+			s.writeServerError(res, fmt.Errorf("oidc.RandomString error: %w", err))
+			return
+		}
+		*value = randomValue
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), oidcRequestTimeout)
+	defer cancel()
+
+	authURL, err := s.oidcProvider.AuthCodeURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("oidcProvider.AuthCodeURL error: %w", err))
+		return
+	}
+
+	s.oidcFlows.add(state, &oidcFlow{
+		nonce:        nonce,
+		codeVerifier: codeVerifier,
+		deviceLabel:  deviceLabel,
+		expiresAt:    time.Now().Add(oidcFlowExpiry),
+	})
+
+	http.SetCookie(res, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/auth/oidc",
+		MaxAge:   int(oidcFlowExpiry.Seconds()),
+		HttpOnly: true,
+		Secure:   req.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(res, req, authURL, http.StatusFound)
+}
+
+// handleOIDCCallback handles the "GET /auth/oidc/callback" endpoint that the
+// identity provider redirects the user to after login. A user is created for
+// the identity provider account on their first login.
+func (s *WebServer) handleOIDCCallback(res http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	if idpError := query.Get("error"); idpError != "" {
+		s.writeBadRequest(res, fmt.Sprintf("identity provider login failed: %s", idpError))
+		return
+	}
+
+	state, code := query.Get("state"), query.Get("code")
+	if state == "" || code == "" {
+		s.writeBadRequest(res, "missing state or code")
+		return
+	}
+
+	// Expire the state cookie since it can only be used once.
+	http.SetCookie(res, &http.Cookie{
+		Name:   oidcStateCookie,
+		Path:   "/auth/oidc",
+		MaxAge: -1,
+	})
+
+	stateCookie, err := req.Cookie(oidcStateCookie)
+	if err != nil || stateCookie.Value != state {
+		s.writeBadRequest(res, "login was not started from this browser, please try again")
+		return
+	}
+
+	flow := s.oidcFlows.take(state)
+	if flow == nil {
+		s.writeBadRequest(res, "login has expired, please try again")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), oidcRequestTimeout)
+	defer cancel()
+
+	claims, err := s.oidcProvider.Exchange(ctx, code, flow.codeVerifier, flow.nonce)
+	if err != nil {
+		s.log.Error("identity provider login failed: ", "error", err)
+		s.writeJSONResponse(res, http.StatusUnauthorized, map[string]string{
+			"errorMessage": "identity provider login failed, please try again",
+		})
+		return
+	}
+
+	preferredUsername := claims.PreferredUsername
+	if preferredUsername == "" {
+		preferredUsername = claims.Name
+	}
+
+	userInfo, err := s.taskDB.OIDCLogin(s.oidcProvider.Issuer(), claims.Subject, preferredUsername, claims.Email, claims.EmailVerified)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.OIDCLogin error: %w", err))
+		}
+		return
+	}
+
+	// Identity provider logins are subject to the same email verification
+	// and two-factor checks as password logins.
+	s.completeLogin(res, req, userInfo, flow.deviceLabel)
+}
@@ -0,0 +1,262 @@
+package webserver
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cristalhq/jwt/v4"
+	"github.com/ukane-philemon/megtask/db"
+	"github.com/ukane-philemon/megtask/oidc"
+)
+
+const mockIdPClientID = "megtask"
+
+// mockIdP is a local OpenID Connect identity provider. Authorization codes
+// are issued by calling authorize with the URL users are redirected to, and
+// can only be exchanged with the PKCE code verifier of that URL.
+type mockIdP struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mtx   sync.Mutex
+	codes map[string]*mockAuthorization
+}
+
+type mockAuthorization struct {
+	subject       string
+	nonce         string
+	codeChallenge string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey error: %v", err)
+	}
+
+	idp := &mockIdP{key: key, codes: make(map[string]*mockAuthorization)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(res http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(res).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(res http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(res).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kid": "key",
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", idp.handleToken)
+
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// authorize logs subject in at the authorization URL and returns the
+// authorization code the user is redirected back with.
+func (idp *mockIdP) authorize(t *testing.T, authURL *url.URL, subject string) string {
+	t.Helper()
+
+	query := authURL.Query()
+	if query.Get("client_id") != mockIdPClientID || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization request: %s", authURL)
+	}
+
+	code, err := oidc.RandomString()
+	if err != nil {
+		t.Fatalf("oidc.RandomString error: %v", err)
+	}
+
+	idp.mtx.Lock()
+	idp.codes[code] = &mockAuthorization{
+		subject:       subject,
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+	}
+	idp.mtx.Unlock()
+
+	return code
+}
+
+func (idp *mockIdP) handleToken(res http.ResponseWriter, req *http.Request) {
+	idp.mtx.Lock()
+	authorization := idp.codes[req.FormValue("code")]
+	delete(idp.codes, req.FormValue("code"))
+	idp.mtx.Unlock()
+
+	verifierHash := sha256.Sum256([]byte(req.FormValue("code_verifier")))
+	if authorization == nil || base64.RawURLEncoding.EncodeToString(verifierHash[:]) != authorization.codeChallenge {
+		res.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(res).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	signer, _ := jwt.NewSignerRS(jwt.RS256, idp.key)
+	now := time.Now()
+	idToken, err := jwt.NewBuilder(signer, jwt.WithKeyID("key")).Build(&oidc.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    idp.URL,
+			Subject:   authorization.subject,
+			Audience:  jwt.Audience{mockIdPClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+		Nonce: authorization.nonce,
+	})
+	if err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(res).Encode(map[string]string{"id_token": idToken.String()})
+}
+
+// oidcDB is a TaskDatabase with the users linked to the subjects of the mock
+// identity provider.
+type oidcDB struct {
+	TaskDatabase
+	users map[string]*db.User
+}
+
+func (odb oidcDB) OIDCLogin(issuer, subject, preferredUsername, email string, emailVerified bool) (*db.User, error) {
+	user, ok := odb.users[subject]
+	if !ok {
+		return nil, db.ErrorInvalidRequest
+	}
+	return user, nil
+}
+
+func (oidcDB) CreateSession(userID, deviceLabel, userAgent, ip string, expiry time.Duration) (*db.Session, error) {
+	return &db.Session{ID: "session"}, nil
+}
+
+// startOIDCLogin starts an identity provider login and returns its state
+// cookie and the authorization URL the user is redirected to.
+func startOIDCLogin(t *testing.T, s *WebServer) (*http.Cookie, *url.URL) {
+	t.Helper()
+
+	res := testRequest(t, s, http.MethodGet, "/auth/oidc/login", "", nil)
+	checkStatus(t, res, http.StatusFound)
+
+	authURL, err := url.Parse(res.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid authorization URL: %v", err)
+	}
+
+	for _, cookie := range res.Result().Cookies() {
+		if cookie.Name == oidcStateCookie {
+			return cookie, authURL
+		}
+	}
+
+	t.Fatal("missing state cookie")
+	return nil, nil
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := newMockIdP(t)
+	odb := oidcDB{users: map[string]*db.User{
+		"verified":   {ID: "1", EmailVerified: true},
+		"two-factor": {ID: "2", EmailVerified: true, TwoFactorEnabled: true},
+		"unverified": {ID: "3"},
+	}}
+	s := newTestServer(t, odb, &Config{
+		RequireEmailVerification: true,
+		OIDC: &oidc.Config{
+			IssuerURL:   idp.URL,
+			ClientID:    mockIdPClientID,
+			RedirectURL: "http://megtask.test/auth/oidc/callback",
+		},
+	})
+
+	tests := []struct {
+		name    string
+		subject string
+		// codeFromOtherLogin exchanges a code issued for another login, whose
+		// PKCE challenge does not match the code verifier of this login.
+		codeFromOtherLogin bool
+		// cookie is the state cookie sent with the callback: "own",
+		// "other" for the cookie of another login, or "none".
+		cookie string
+		// replay completes the login once before the tested callback.
+		replay         bool
+		wantStatus     int
+		wantAuthToken  bool
+		wantChallenged bool
+	}{
+		{name: "login", subject: "verified", cookie: "own", wantStatus: http.StatusOK, wantAuthToken: true},
+		{name: "two-factor challenge", subject: "two-factor", cookie: "own", wantStatus: http.StatusOK, wantChallenged: true},
+		{name: "unverified email", subject: "unverified", cookie: "own", wantStatus: http.StatusForbidden},
+		{name: "code from another login", subject: "verified", codeFromOtherLogin: true, cookie: "own", wantStatus: http.StatusUnauthorized},
+		{name: "state cookie of another login", subject: "verified", cookie: "other", wantStatus: http.StatusBadRequest},
+		{name: "missing state cookie", subject: "verified", cookie: "none", wantStatus: http.StatusBadRequest},
+		{name: "replayed state", subject: "verified", cookie: "own", replay: true, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ownCookie, ownAuthURL := startOIDCLogin(t, s)
+			otherCookie, otherAuthURL := startOIDCLogin(t, s)
+
+			callback := func() *httptest.ResponseRecorder {
+				authURL := ownAuthURL
+				if test.codeFromOtherLogin {
+					authURL = otherAuthURL
+				}
+				code := idp.authorize(t, authURL, test.subject)
+
+				query := url.Values{"state": {ownAuthURL.Query().Get("state")}, "code": {code}}
+				req := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?"+query.Encode(), nil)
+				switch test.cookie {
+				case "own":
+					req.AddCookie(ownCookie)
+				case "other":
+					req.AddCookie(otherCookie)
+				}
+
+				res := httptest.NewRecorder()
+				s.mux.ServeHTTP(res, req)
+				return res
+			}
+
+			if test.replay {
+				checkStatus(t, callback(), http.StatusOK)
+			}
+
+			res := callback()
+			checkStatus(t, res, test.wantStatus)
+
+			var body map[string]any
+			json.Unmarshal(res.Body.Bytes(), &body)
+			if _, ok := body["authToken"]; ok != test.wantAuthToken {
+				t.Fatalf("want auth token %v, got %s", test.wantAuthToken, res.Body.String())
+			}
+			if _, ok := body["challengeToken"]; ok != test.wantChallenged {
+				t.Fatalf("want challenge token %v, got %s", test.wantChallenged, res.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package webserver
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	// maxPasswordLength is the maximum length of a password in bytes. Longer
+	// passwords are truncated by bcrypt.
+	maxPasswordLength = 72
+	// defaultMinPasswordLength is the minimum length of a password if no
+	// password policy is configured.
+	defaultMinPasswordLength = 6
+)
+
+// BreachedPasswordChecker checks passwords against a list of passwords that
+// have appeared in data breaches.
+type BreachedPasswordChecker interface {
+	// IsBreached returns true if password has appeared in a data breach.
+	IsBreached(password string) (bool, error)
+}
+
+// PasswordPolicy is the policy new passwords must satisfy when an account is
+// created or a password is changed.
+type PasswordPolicy struct {
+	// MinLength is the minimum length of a password in bytes. Defaults to 6.
+	MinLength        int
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	// DisallowUsername rejects passwords that contain the username, ignoring
+	// case.
+	DisallowUsername bool
+	// BreachedPasswords is an optional checker that rejects passwords that
+	// have appeared in data breaches.
+	BreachedPasswords BreachedPasswordChecker
+}
+
+// validate checks that password satisfies the policy and returns a message
+// describing the unsatisfied rules. An empty message is returned if password
+// satisfies the policy.
+func (pp *PasswordPolicy) validate(username, password string) (string, error) {
+	minLength := pp.MinLength
+	if minLength <= 0 {
+		minLength = defaultMinPasswordLength
+	}
+
+	if len(password) > maxPasswordLength {
+		return fmt.Sprintf("password must be less than %d characters", maxPasswordLength), nil
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+
+	var requirements []string
+	if len(password) < minLength {
+		requirements = append(requirements, fmt.Sprintf("at least %d characters", minLength))
+	}
+	if pp.RequireUppercase && !hasUpper {
+		requirements = append(requirements, "an uppercase letter")
+	}
+	if pp.RequireLowercase && !hasLower {
+		requirements = append(requirements, "a lowercase letter")
+	}
+	if pp.RequireDigit && !hasDigit {
+		requirements = append(requirements, "a digit")
+	}
+	if pp.RequireSymbol && !hasSymbol {
+		requirements = append(requirements, "a symbol")
+	}
+
+	if len(requirements) > 0 {
+		return fmt.Sprintf("password must contain %s", joinRequirements(requirements)), nil
+	}
+
+	if pp.DisallowUsername && username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return "password cannot contain your username", nil
+	}
+
+	if pp.BreachedPasswords != nil {
+		breached, err := pp.BreachedPasswords.IsBreached(password)
+		if err != nil {
+			return "", fmt.Errorf("BreachedPasswords.IsBreached error: %w", err)
+		}
+
+		if breached {
+			return "password has appeared in a data breach, please choose a different password", nil
+		}
+	}
+
+	return "", nil
+}
+
+// joinRequirements joins password requirements into a readable list, e.g "a,
+// b and c".
+func joinRequirements(requirements []string) string {
+	if len(requirements) == 1 {
+		return requirements[0]
+	}
+	return strings.Join(requirements[:len(requirements)-1], ", ") + " and " + requirements[len(requirements)-1]
+}
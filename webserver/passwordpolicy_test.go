@@ -0,0 +1,68 @@
+package webserver
+
+import (
+	"strings"
+	"testing"
+)
+
+// breachedPasswords is a BreachedPasswordChecker for the passwords it
+// contains.
+type breachedPasswords map[string]bool
+
+func (bp breachedPasswords) IsBreached(password string) (bool, error) {
+	return bp[password], nil
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	strict := &PasswordPolicy{
+		MinLength:         10,
+		RequireUppercase:  true,
+		RequireLowercase:  true,
+		RequireDigit:      true,
+		RequireSymbol:     true,
+		DisallowUsername:  true,
+		BreachedPasswords: breachedPasswords{"Password123!": true},
+	}
+
+	tests := []struct {
+		name     string
+		policy   *PasswordPolicy
+		password string
+		// wantMessage is part of the message describing the unsatisfied
+		// rules, or empty if the password satisfies the policy.
+		wantMessage string
+	}{
+		{"default minimum length", new(PasswordPolicy), "12345", "at least 6 characters"},
+		{"default policy", new(PasswordPolicy), "123456", ""},
+		{"too long", new(PasswordPolicy), strings.Repeat("a", maxPasswordLength+1), "less than 72 characters"},
+		{"minimum length", strict, "Ab1!", "at least 10 characters"},
+		{"missing uppercase", strict, "abcdefgh1!", "an uppercase letter"},
+		{"missing lowercase", strict, "ABCDEFGH1!", "a lowercase letter"},
+		{"missing digit", strict, "Abcdefghi!", "a digit"},
+		{"missing symbol", strict, "Abcdefghi1", "a symbol"},
+		{"space counts as a symbol", strict, "Abcdefgh 1", ""},
+		{"missing requirements are listed", strict, "abcdefghij", "an uppercase letter, a digit and a symbol"},
+		{"contains username", strict, "xJaneDoe1!x", "cannot contain your username"},
+		{"breached", strict, "Password123!", "appeared in a data breach"},
+		{"satisfies policy", strict, "Tr0ub4dor&3", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message, err := test.policy.validate("janedoe", test.password)
+			if err != nil {
+				t.Fatalf("validate error: %v", err)
+			}
+
+			if test.wantMessage == "" {
+				if message != "" {
+					t.Fatalf("want password accepted, got %q", message)
+				}
+				return
+			}
+			if !strings.Contains(message, test.wantMessage) {
+				t.Fatalf("want message containing %q, got %q", test.wantMessage, message)
+			}
+		})
+	}
+}
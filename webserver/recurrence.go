@@ -0,0 +1,110 @@
+package webserver
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/teambition/rrule-go"
+	"github.com/ukane-philemon/megtask/db"
+)
+
+const (
+	recurrenceJobName = "recurrence"
+
+	// recurrenceJobInterval is how often completed recurring tasks are
+	// checked for.
+	recurrenceJobInterval = time.Minute
+	// recurrenceBatchSize is the number of completed recurring tasks
+	// retrieved at once.
+	recurrenceBatchSize = 100
+)
+
+// createNextOccurrences creates the next occurrence of the recurring tasks
+// that have been completed, until there are none left or ctx is canceled.
+func (s *WebServer) createNextOccurrences(ctx context.Context) error {
+	for ctx.Err() == nil {
+		tasks, err := s.taskDB.CompletedRecurringTasks(recurrenceBatchSize)
+		if err != nil {
+			return fmt.Errorf("taskDB.CompletedRecurringTasks error: %w", err)
+		}
+
+		if len(tasks) == 0 {
+			return nil
+		}
+
+		for _, task := range tasks {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			dueAt, recurrence, err := nextOccurrence(task.Recurrence, task.DueAt, time.Now())
+			if err != nil {
+				// The recurrence of a task with a rule that cannot be
+				// evaluated is ended, so the task is not retried forever.
+				s.log.Error("failed to evaluate recurrence rule, ending recurrence: ", "taskID", task.ID, "error", err)
+			}
+
+			nextTask, err := s.taskDB.CreateNextOccurrence(task.ID, dueAt, recurrence)
+			if err != nil {
+				return fmt.Errorf("taskDB.CreateNextOccurrence error: %w", err)
+			}
+
+			if nextTask != nil {
+				s.publishTaskEvent(TaskCreatedEvent, nextTask.ID, []*db.Task{nextTask})
+			}
+		}
+	}
+
+	return nil
+}
+
+// nextOccurrence returns the due date and recurrence rule of the first
+// occurrence of a task with the provided recurrence rule and due date that is
+// after both the due date and now. The rule is evaluated in UTC from the due
+// date, or from now if the task has no due date. A COUNT in the rule is
+// reduced by the occurrences before the next one, as the rule of the next
+// occurrence starts from its own due date. Returns a zero due date if the
+// rule has no more occurrences.
+func nextOccurrence(recurrence string, dueAt int64, now time.Time) (int64, string, error) {
+	opts, err := rrule.StrToROption(recurrence)
+	if err != nil {
+		return 0, "", err
+	}
+
+	opts.Dtstart = now.UTC().Truncate(time.Second)
+	if dueAt != 0 {
+		opts.Dtstart = time.Unix(dueAt, 0).UTC()
+	}
+
+	rule, err := rrule.NewRRule(*opts)
+	if err != nil {
+		return 0, "", err
+	}
+
+	after := opts.Dtstart
+	if now.After(after) {
+		after = now
+	}
+
+	next := rule.After(after, false)
+	if next.IsZero() {
+		return 0, "", nil
+	}
+
+	if opts.Count == 0 {
+		return next.Unix(), recurrence, nil
+	}
+
+	previous := len(rule.Between(opts.Dtstart, next, true)) - 1
+	parts := strings.Split(recurrence, ";")
+	for i, part := range parts {
+		if strings.HasPrefix(part, "COUNT=") {
+			parts[i] = "COUNT=" + strconv.Itoa(opts.Count-previous)
+		}
+	}
+
+	return next.Unix(), strings.Join(parts, ";"), nil
+}
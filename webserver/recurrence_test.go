@@ -0,0 +1,167 @@
+package webserver
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+func TestNextOccurrence(t *testing.T) {
+	now := time.Date(2025, time.January, 10, 12, 0, 0, 0, time.UTC)
+	at := func(day, hour int) int64 {
+		return time.Date(2025, time.January, day, hour, 0, 0, 0, time.UTC).Unix()
+	}
+
+	tests := []struct {
+		name           string
+		recurrence     string
+		dueAt          int64
+		wantDueAt      int64
+		wantRecurrence string
+		wantErr        bool
+	}{
+		{"due later", "FREQ=DAILY", at(12, 9), at(13, 9), "FREQ=DAILY", false},
+		{"overdue", "FREQ=DAILY", at(5, 9), at(11, 9), "FREQ=DAILY", false},
+		{"weekdays", "FREQ=WEEKLY;BYDAY=MO,WE", at(6, 9), at(13, 9), "FREQ=WEEKLY;BYDAY=MO,WE", false},
+		{"interval", "FREQ=MONTHLY;INTERVAL=2", at(15, 9), time.Date(2025, time.March, 15, 9, 0, 0, 0, time.UTC).Unix(), "FREQ=MONTHLY;INTERVAL=2", false},
+		{"count is reduced", "FREQ=DAILY;COUNT=5", at(8, 9), at(11, 9), "FREQ=DAILY;COUNT=2", false},
+		{"count is exhausted", "FREQ=DAILY;COUNT=2", at(8, 9), 0, "", false},
+		{"until has passed", "FREQ=DAILY;UNTIL=20250109T000000Z", at(8, 9), 0, "", false},
+		{"no due date", "FREQ=DAILY", 0, at(11, 12), "FREQ=DAILY", false},
+		{"invalid rule", "FREQ=SOMETIMES", at(12, 9), 0, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dueAt, recurrence, err := nextOccurrence(test.recurrence, test.dueAt, now)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("want error %v, got %v", test.wantErr, err)
+			}
+			if dueAt != test.wantDueAt || recurrence != test.wantRecurrence {
+				t.Fatalf("want %s with %q, got %s with %q", time.Unix(test.wantDueAt, 0).UTC(), test.wantRecurrence, time.Unix(dueAt, 0).UTC(), recurrence)
+			}
+		})
+	}
+}
+
+func TestValidateRecurrence(t *testing.T) {
+	tests := []struct {
+		name       string
+		recurrence string
+		wantErr    bool
+	}{
+		{"no recurrence", "", false},
+		{"weekdays", "FREQ=WEEKLY;BYDAY=MO,WE", false},
+		{"until", "FREQ=DAILY;UNTIL=20250109T000000Z", false},
+		{"missing frequency", "INTERVAL=2", true},
+		{"unsupported frequency", "FREQ=HOURLY", true},
+		{"unknown part", "FREQ=DAILY;BYHOUR=9", true},
+		{"count and until", "FREQ=DAILY;COUNT=2;UNTIL=20250109T000000Z", true},
+		{"invalid day", "FREQ=WEEKLY;BYDAY=XX", true},
+		{"invalid month", "FREQ=YEARLY;BYMONTH=13", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateRecurrence(test.recurrence)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("want error %v, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+// recurrenceDB is a TaskDatabase with completed recurring tasks of "user"
+// that records the next occurrences created.
+type recurrenceDB struct {
+	authDB
+	completed []*db.Task
+	// created are the task IDs, due dates and recurrence rules of the next
+	// occurrences created.
+	created *[]string
+	err     error
+}
+
+func (rdb *recurrenceDB) CompletedRecurringTasks(limit int) ([]*db.Task, error) {
+	return rdb.completed[:min(limit, len(rdb.completed))], rdb.err
+}
+
+func (rdb *recurrenceDB) CreateNextOccurrence(taskID string, dueAt int64, recurrence string) (*db.Task, error) {
+	rdb.completed = rdb.completed[1:]
+	*rdb.created = append(*rdb.created, strings.Join([]string{taskID, time.Unix(dueAt, 0).UTC().Format(time.DateOnly), recurrence}, " "))
+	if dueAt == 0 {
+		return nil, nil
+	}
+	return &db.Task{ID: "next-" + taskID, TaskInfo: db.TaskInfo{DueAt: dueAt, Recurrence: recurrence}}, nil
+}
+
+func (*recurrenceDB) TaskAudience(taskID string) ([]string, error) {
+	return []string{"user"}, nil
+}
+
+func TestCreateNextOccurrences(t *testing.T) {
+	dueAt := time.Now().AddDate(0, 0, 1).UTC().Truncate(24 * time.Hour)
+	nextDay := dueAt.AddDate(0, 0, 1).Format(time.DateOnly)
+
+	tests := []struct {
+		name      string
+		completed []*db.Task
+		dbErr     error
+		wantErr   bool
+		// wantCreated are the task IDs, due dates and recurrence rules of
+		// the next occurrences created.
+		wantCreated []string
+		wantEvents  []string
+	}{
+		{
+			name: "no completed tasks",
+		},
+		{
+			name: "completed tasks",
+			completed: []*db.Task{
+				{ID: "daily", TaskInfo: db.TaskInfo{Completed: true, DueAt: dueAt.Unix(), Recurrence: "FREQ=DAILY"}},
+				{ID: "last", TaskInfo: db.TaskInfo{Completed: true, DueAt: dueAt.Unix(), Recurrence: "FREQ=DAILY;COUNT=1"}},
+				{ID: "invalid", TaskInfo: db.TaskInfo{Completed: true, DueAt: dueAt.Unix(), Recurrence: "FREQ=SOMETIMES"}},
+			},
+			wantCreated: []string{"daily " + nextDay + " FREQ=DAILY", "last 1970-01-01 ", "invalid 1970-01-01 "},
+			wantEvents:  []string{TaskCreatedEvent + " next-daily"},
+		},
+		{
+			name:    "database error",
+			dbErr:   errors.New("failed"),
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var created []string
+			rdb := &recurrenceDB{authDB: authDB{roles: map[string]string{"user": db.RoleUser}}, completed: test.completed, created: &created, err: test.dbErr}
+			s := newTestServer(t, rdb, nil)
+			sub, _, _ := s.events.subscribe("user", 0)
+			defer s.events.unsubscribe(sub)
+
+			err := s.createNextOccurrences(context.Background())
+			if (err != nil) != test.wantErr {
+				t.Fatalf("want error %v, got %v", test.wantErr, err)
+			}
+
+			if strings.Join(created, ", ") != strings.Join(test.wantCreated, ", ") {
+				t.Fatalf("want next occurrences %v, got %v", test.wantCreated, created)
+			}
+
+			var events []string
+			for len(sub.events) > 0 {
+				event := <-sub.events
+				events = append(events, event.Type+" "+event.TaskID)
+			}
+			if strings.Join(events, ", ") != strings.Join(test.wantEvents, ", ") {
+				t.Fatalf("want events %v, got %v", test.wantEvents, events)
+			}
+		})
+	}
+}
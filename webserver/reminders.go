@@ -0,0 +1,84 @@
+package webserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ukane-philemon/megtask/db"
+)
+
+// handleCreateReminder handles the "POST /task/{taskID}/reminders" endpoint
+// and sets a reminder for the user on a task, either at a fixed time or
+// relative to the task's due date.
+func (s *WebServer) handleCreateReminder(res http.ResponseWriter, req *http.Request) {
+	form := new(reminderRequest)
+	if !s.readPostBody(res, req, &form) {
+		return
+	}
+
+	err := form.Validate()
+	if err != nil {
+		s.writeBadRequest(res, err.Error())
+		return
+	}
+
+	taskID := chi.URLParam(req, "taskID")
+	userID := s.reqUserID(req)
+	reminder, err := s.taskDB.CreateReminder(userID, taskID, form.RemindAt, form.Offset)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.CreateReminder error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"reminder": reminder,
+	})
+}
+
+// handleRetrieveReminders handles the "GET /task/{taskID}/reminders"
+// endpoint and returns the reminders the user set on a task.
+func (s *WebServer) handleRetrieveReminders(res http.ResponseWriter, req *http.Request) {
+	taskID := chi.URLParam(req, "taskID")
+	userID := s.reqUserID(req)
+	reminders, err := s.taskDB.Reminders(userID, taskID)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.Reminders error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"reminders": reminders,
+	})
+}
+
+// handleDeleteReminder handles the "DELETE
+// /task/{taskID}/reminders/{reminderID}" endpoint and deletes a reminder the
+// user set on a task.
+func (s *WebServer) handleDeleteReminder(res http.ResponseWriter, req *http.Request) {
+	taskID := chi.URLParam(req, "taskID")
+	reminderID := chi.URLParam(req, "reminderID")
+	userID := s.reqUserID(req)
+	err := s.taskDB.DeleteReminder(userID, taskID, reminderID)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.DeleteReminder error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]string{
+		"message": "Reminder deleted.",
+	})
+}
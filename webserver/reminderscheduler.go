@@ -0,0 +1,93 @@
+package webserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+const (
+	// reminderPollInterval is how often due reminders are checked for.
+	reminderPollInterval = 15 * time.Second
+	// reminderLease is how long a claimed reminder is hidden from other
+	// schedulers. A reminder that is not marked as delivered within the lease
+	// is retried.
+	reminderLease = 2 * time.Minute
+	// maxReminderAttempts is the number of times delivery of a reminder is
+	// attempted before it is marked as delivered with an error.
+	maxReminderAttempts = 5
+)
+
+// reminderScheduler delivers due reminders through notifiers. It is run by
+// the server's job runner as the reminders job.
+type reminderScheduler struct {
+	taskDB    TaskDatabase
+	notifiers []Notifier
+	log       *slog.Logger
+}
+
+// deliverDue delivers the reminders that are due until there are none left
+// or ctx is canceled.
+func (rs *reminderScheduler) deliverDue(ctx context.Context) error {
+	for ctx.Err() == nil {
+		reminder, err := rs.taskDB.ClaimDueReminder(reminderLease)
+		if err != nil {
+			return fmt.Errorf("taskDB.ClaimDueReminder error: %w", err)
+		}
+
+		if reminder == nil {
+			return nil
+		}
+
+		var deliveryError string
+		if !reminder.Task.Completed {
+			err = rs.notify(ctx, reminder)
+			if ctx.Err() != nil {
+				// The reminder is retried once its lease expires.
+				return nil
+			}
+
+			if err != nil {
+				rs.log.Error("failed to deliver reminder: ", "reminderID", reminder.ID, "attempts", reminder.Attempts, "error", err)
+				if reminder.Attempts < maxReminderAttempts {
+					continue
+				}
+				deliveryError = err.Error()
+			}
+		}
+
+		err = rs.taskDB.MarkReminderDelivered(reminder.ID, deliveryError)
+		if err != nil {
+			rs.log.Error("taskDB.MarkReminderDelivered error: ", "error", err)
+		}
+	}
+
+	return nil
+}
+
+// notify delivers reminder through all notifiers. The reminder is delivered
+// if at least one notifier succeeds, so it is not sent twice through the
+// notifiers that succeeded.
+func (rs *reminderScheduler) notify(ctx context.Context, reminder *db.DueReminder) error {
+	var errs []error
+	for _, notifier := range rs.notifiers {
+		err := notifier.Notify(ctx, reminder)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) == len(rs.notifiers) {
+		return errors.Join(errs...)
+	}
+
+	for _, err := range errs {
+		rs.log.Error("reminder notifier error: ", "reminderID", reminder.ID, "error", err)
+	}
+
+	return nil
+}
@@ -5,14 +5,23 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/graphql-go/graphql"
+	"github.com/ukane-philemon/megtask/db"
 	"github.com/ukane-philemon/megtask/jwt"
+	"github.com/ukane-philemon/megtask/oidc"
+	"google.golang.org/grpc"
 )
 
+// serverAddr is the address the server listens on.
+const serverAddr = "localhost:8080"
+
 // WebServer handles all routing and server logic.
 type WebServer struct {
 	mux    *chi.Mux
@@ -20,28 +29,242 @@ type WebServer struct {
 	taskDB TaskDatabase
 
 	jwtManager *jwt.Manager
+	mailer     Mailer
+	baseURL    string
+
+	sessionExpiry   time.Duration
+	authTokenExpiry time.Duration
+
+	requireEmailVerification bool
+	loginThrottle            *loginThrottle
+	// accountEmails limits the number of account emails sent in the
+	// background at the same time.
+	accountEmails chan struct{}
+
+	oidcProvider *oidc.Provider
+	oidcFlows    *oidcFlows
+
+	passwordPolicy *PasswordPolicy
+
+	blobStore         BlobStore
+	maxAttachmentSize int64
+	attachmentQuota   int64
+
+	events      *eventBus
+	taskChanges TaskChangeSource
+	webhooks    *webhookDispatcher
+	jobs        *jobRunner
+
+	graphQL *graphql.Schema
+
+	grpcAddr string
+}
+
+// Config is additional configuration for the WebServer.
+type Config struct {
+	// Mailer is used to send emails (e.g password reset tokens) to users.
+	Mailer Mailer
+	// BaseURL is the public URL of the server and is used to build links sent
+	// to users. Defaults to the server's address.
+	BaseURL string
+	// RequireEmailVerification makes email required when creating an account
+	// and prevents users from logging in until their email has been verified.
+	RequireEmailVerification bool
+	// SessionExpiry is how long a login session is valid. Defaults to 30
+	// days.
+	SessionExpiry time.Duration
+	// AuthTokenExpiry is how long an auth token is valid. Clients renew their
+	// auth token with the "POST /sessions/renew" endpoint until their session
+	// expires. Defaults to 15 minutes.
+	AuthTokenExpiry time.Duration
+	// LoginAttemptStore stores failed login attempts. Defaults to an in-memory
+	// store which is not shared between server instances.
+	LoginAttemptStore LoginAttemptStore
+	// MaxFailedLogins is the number of consecutive failed logins for a
+	// username after which logins for the username are locked for
+	// LoginLockoutDuration. Defaults to 10.
+	MaxFailedLogins int
+	// MaxFailedLoginsPerIP is the number of consecutive failed logins from an
+	// IP address after which logins from the IP address are locked for
+	// LoginLockoutDuration. Defaults to 50.
+	MaxFailedLoginsPerIP int
+	// LoginLockoutDuration is how long logins are locked after too many
+	// failed attempts. Defaults to 15 minutes.
+	LoginLockoutDuration time.Duration
+	// OIDC is optional configuration to login with an OpenID Connect identity
+	// provider. Identity provider logins are disabled if not provided. The
+	// redirect URL defaults to {BaseURL}/auth/oidc/callback.
+	OIDC *oidc.Config
+	// PasswordPolicy is the policy new passwords must satisfy. Defaults to a
+	// minimum length of 6 characters.
+	PasswordPolicy *PasswordPolicy
+	// BlobStore stores the content of task attachments. Attachments are
+	// disabled if not provided.
+	BlobStore BlobStore
+	// MaxAttachmentSize is the maximum size in bytes of an attached file.
+	// Defaults to 10MB.
+	MaxAttachmentSize int64
+	// AttachmentQuota is the total size in bytes of the files each user can
+	// attach. Defaults to 100MB.
+	AttachmentQuota int64
+	// EventLogSize is the number of recent task events kept so event streams
+	// can be resumed after a client reconnects. Defaults to 1000.
+	EventLogSize int
+	// AllowPrivateWebhookURLs allows webhooks to send deliveries to loopback
+	// and private network addresses. It should only be enabled if users are
+	// trusted.
+	AllowPrivateWebhookURLs bool
+	// TaskChanges is an optional source of the task changes made by all
+	// servers sharing the database. If provided, task events are published
+	// from it instead of the requests handled by this server, which keeps
+	// event streams consistent when multiple servers are running.
+	TaskChanges TaskChangeSource
+	// ReminderNotifiers deliver task reminders to users. Defaults to emailing
+	// reminders with Mailer and sending them to the user's webhooks.
+	ReminderNotifiers []Notifier
+	// GRPCAddr is the address the gRPC API listens on. The gRPC API is
+	// disabled if not provided.
+	GRPCAddr string
 }
 
 // New returns a new instance of *WebServer.
-func New(db TaskDatabase, logger *slog.Logger) (*WebServer, error) {
+func New(db TaskDatabase, logger *slog.Logger, cfg *Config) (*WebServer, error) {
 	if logger == nil {
 		return nil, errors.New("logger is required")
 	}
 
+	if cfg == nil || cfg.Mailer == nil {
+		return nil, errors.New("server config with a mailer is required")
+	}
+
 	jwtManager, err := jwt.NewJWTManager()
 	if err != nil {
 		return nil, fmt.Errorf("jwt.NewJWTManager error: %w", err)
 	}
 
+	baseURL := strings.TrimSuffix(cfg.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = "http://" + serverAddr
+	}
+
+	sessionExpiry := cfg.SessionExpiry
+	if sessionExpiry <= 0 {
+		sessionExpiry = defaultSessionExpiry
+	}
+
+	authTokenExpiry := cfg.AuthTokenExpiry
+	if authTokenExpiry <= 0 {
+		authTokenExpiry = defaultAuthTokenExpiry
+	}
+
+	throttle := &loginThrottle{
+		store:           cfg.LoginAttemptStore,
+		maxFailures:     cfg.MaxFailedLogins,
+		maxFailuresIP:   cfg.MaxFailedLoginsPerIP,
+		lockoutDuration: cfg.LoginLockoutDuration,
+	}
+	if throttle.store == nil {
+		throttle.store = newMemoryLoginAttemptStore()
+	}
+	if throttle.maxFailures <= 0 {
+		throttle.maxFailures = defaultMaxFailedLogins
+	}
+	if throttle.maxFailuresIP <= 0 {
+		throttle.maxFailuresIP = defaultMaxFailedLoginsPerIP
+	}
+	if throttle.lockoutDuration <= 0 {
+		throttle.lockoutDuration = defaultLoginLockoutDuration
+	}
+
+	var oidcProvider *oidc.Provider
+	if cfg.OIDC != nil {
+		oidcCfg := *cfg.OIDC
+		if oidcCfg.RedirectURL == "" {
+			oidcCfg.RedirectURL = baseURL + "/auth/oidc/callback"
+		}
+
+		oidcProvider, err = oidc.New(&oidcCfg)
+		if err != nil {
+			return nil, fmt.Errorf("oidc.New error: %w", err)
+		}
+	}
+
+	passwordPolicy := cfg.PasswordPolicy
+	if passwordPolicy == nil {
+		passwordPolicy = &PasswordPolicy{MinLength: defaultMinPasswordLength}
+	}
+
+	maxAttachmentSize := cfg.MaxAttachmentSize
+	if maxAttachmentSize <= 0 {
+		maxAttachmentSize = defaultMaxAttachmentSize
+	}
+
+	attachmentQuota := cfg.AttachmentQuota
+	if attachmentQuota <= 0 {
+		attachmentQuota = defaultAttachmentQuota
+	}
+
+	eventLogSize := cfg.EventLogSize
+	if eventLogSize <= 0 {
+		eventLogSize = defaultEventLogSize
+	}
+
+	reminderNotifiers := cfg.ReminderNotifiers
+	if len(reminderNotifiers) == 0 {
+		reminderNotifiers = []Notifier{NewEmailNotifier(cfg.Mailer), NewWebhookNotifier(db)}
+	}
+
 	chiMux := chi.NewMux()
 	chiMux.Use(middleware.Logger)
-	chiMux.Use(middleware.AllowContentType("application/json"))
+	// Multipart bodies are only read by the attachment upload endpoint.
+	// Other endpoints reject them when decoding the JSON body. CalDAV
+	// clients send iCalendar and XML bodies.
+	chiMux.Use(middleware.AllowContentType("application/json", "multipart/form-data", "text/calendar", "application/xml", "text/xml"))
 
 	server := &WebServer{
 		mux:        chiMux,
 		log:        logger,
 		taskDB:     db,
 		jwtManager: jwtManager,
+		mailer:     cfg.Mailer,
+		baseURL:    baseURL,
+
+		sessionExpiry:   sessionExpiry,
+		authTokenExpiry: authTokenExpiry,
+
+		requireEmailVerification: cfg.RequireEmailVerification,
+		loginThrottle:            throttle,
+		accountEmails:            make(chan struct{}, maxPendingAccountEmails),
+
+		oidcProvider: oidcProvider,
+		oidcFlows:    &oidcFlows{flows: make(map[string]*oidcFlow)},
+
+		passwordPolicy: passwordPolicy,
+
+		blobStore:         cfg.BlobStore,
+		maxAttachmentSize: maxAttachmentSize,
+		attachmentQuota:   attachmentQuota,
+
+		events:      newEventBus(eventLogSize),
+		taskChanges: cfg.TaskChanges,
+		webhooks:    newWebhookDispatcher(db, logger, cfg.AllowPrivateWebhookURLs),
+		jobs:        newJobRunner(db, logger),
+
+		grpcAddr: cfg.GRPCAddr,
+	}
+
+	reminders := &reminderScheduler{
+		taskDB:    db,
+		notifiers: reminderNotifiers,
+		log:       logger,
+	}
+	server.jobs.add(remindersJobName, reminderPollInterval, reminders.deliverDue)
+	server.jobs.add(purgeJobName, purgeJobInterval, server.purgeDeliveredRecords)
+	server.jobs.add(recurrenceJobName, recurrenceJobInterval, server.createNextOccurrences)
+
+	server.graphQL, err = server.newGraphQLSchema()
+	if err != nil {
+		return nil, fmt.Errorf("newGraphQLSchema error: %w", err)
 	}
 
 	server.registerRoutes()
@@ -53,13 +276,47 @@ func New(db TaskDatabase, logger *slog.Logger) (*WebServer, error) {
 // used by the server (e.g TaskDatabase) will be shutdown after server has been
 // shutdown successfully.
 func (s *WebServer) Start(ctx context.Context) error {
+	// The gRPC listener is opened first so the server does not start if its
+	// address is not available.
+	var grpcListener net.Listener
+	if s.grpcAddr != "" {
+		var err error
+		grpcListener, err = net.Listen("tcp", s.grpcAddr)
+		if err != nil {
+			return fmt.Errorf("net.Listen error: %w", err)
+		}
+	}
+
 	server := &http.Server{
-		Addr:         "localhost:8080",
+		Addr:         serverAddr,
 		Handler:      s.mux,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  10 * time.Second,
 	}
+	// Event streams are closed on shutdown so they do not keep the server
+	// from shutting down.
+	server.RegisterOnShutdown(s.events.close)
+
+	webhooksCtx, stopWebhooks := context.WithCancel(context.Background())
+	webhooksDone := make(chan struct{})
+	go func() {
+		defer close(webhooksDone)
+		s.webhooks.run(webhooksCtx)
+	}()
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	jobsDone := make(chan struct{})
+	go func() {
+		defer close(jobsDone)
+		s.jobs.run(jobsCtx)
+	}()
+
+	if s.taskChanges != nil {
+		changes, unsubscribe := s.taskChanges.SubscribeTaskChanges()
+		defer unsubscribe()
+		go s.publishTaskChanges(ctx, changes)
+	}
 
 	var serverError error
 	go func() {
@@ -71,6 +328,19 @@ func (s *WebServer) Start(ctx context.Context) error {
 
 	s.log.Info("Megtask server has started on -> ", "addr", server.Addr)
 
+	var grpcServer *grpc.Server
+	if grpcListener != nil {
+		grpcServer = s.newGRPCServer()
+		go func() {
+			err := grpcServer.Serve(grpcListener)
+			if err != nil {
+				serverError = err
+			}
+		}()
+
+		s.log.Info("Megtask gRPC server has started on -> ", "addr", grpcListener.Addr())
+	}
+
 	// Wait for application shutdown.
 	<-ctx.Done()
 
@@ -84,6 +354,32 @@ func (s *WebServer) Start(ctx context.Context) error {
 		s.log.Error("server.Shutdown error: ", "msg", err)
 	}
 
+	if grpcServer != nil {
+		s.log.Info("Gracefully shutting down the gRPC server....")
+
+		// Calls that are still running when the HTTP server's shutdown
+		// timeout expires are cancelled.
+		grpcStopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(grpcStopped)
+		}()
+		select {
+		case <-grpcStopped:
+		case <-shutdownCtx.Done():
+			grpcServer.Stop()
+		}
+	}
+
+	// Stop running jobs and sending webhook deliveries before the database is
+	// shutdown. Reminders and deliveries that are not sent are retried once
+	// their lease expires. Jobs are stopped first as the reminders job can
+	// queue webhook deliveries.
+	stopJobs()
+	<-jobsDone
+	stopWebhooks()
+	<-webhooksDone
+
 	dbShutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -103,15 +399,173 @@ func (s *WebServer) registerRoutes() {
 
 	s.mux.Post("/create-account", s.handleCreateAccount)
 	s.mux.Post("/login", s.handleLogin)
+	s.mux.Post("/login/2fa", s.handleTwoFactorLogin)
+	if s.oidcProvider != nil {
+		s.mux.Get("/auth/oidc/login", s.handleOIDCLogin)
+		s.mux.Get("/auth/oidc/callback", s.handleOIDCCallback)
+	}
+
+	s.mux.Post("/password-reset/request", s.handlePasswordResetRequest)
+	s.mux.Post("/password-reset/confirm", s.handlePasswordResetConfirm)
+	s.mux.Get("/verify-email", s.handleVerifyEmail)
+	s.mux.Post("/verify-email/resend", s.handleResendEmailVerification)
 
-	// Endpoints the require authentication.
+	// Calendar feeds are authenticated by the secret token in their URL, as
+	// calendar apps cannot send auth headers.
+	s.mux.Get("/feeds/{token}.ics", s.handleRetrieveFeed)
+
+	// CalDAV clients authenticate with HTTP basic credentials and discover
+	// the server with an unauthenticated OPTIONS request.
+	s.mux.Get("/.well-known/caldav", s.handleCalDAVWellKnown)
+	s.mux.Method("PROPFIND", "/.well-known/caldav", http.HandlerFunc(s.handleCalDAVWellKnown))
+	s.mux.Route(caldavPath, func(caldavMux chi.Router) {
+		caldavMux.Options("/*", s.handleCalDAVOptions)
+		caldavMux.Group(func(davMux chi.Router) {
+			davMux.Use(s.caldavAuthMiddleware, s.apiTokenScopeMiddleware)
+
+			davMux.Method("PROPFIND", "/*", http.HandlerFunc(s.handleCalDAVPropfind))
+			davMux.Method("REPORT", "/*", http.HandlerFunc(s.handleCalDAVReport))
+			davMux.Get("/*", s.handleCalDAVGet)
+			davMux.Put("/*", s.handleCalDAVPut)
+			davMux.Delete("/*", s.handleCalDAVDelete)
+		})
+	})
+
+	// WebSocket connections can also be authenticated with a token sent as a
+	// subprotocol. Commands sent over the connection are checked against the
+	// scopes of api tokens.
+	s.mux.With(wsTokenMiddleware, s.authMiddleware, s.apiTokenScopeMiddleware).Get("/ws", s.handleWebSocket)
+
+	// Endpoints the require authentication. Api tokens can only access the
+	// endpoints listed in apiTokenRouteScopes.
 	s.mux.Group(func(authedMux chi.Router) {
-		authedMux.Use(s.authMiddleware)
+		authedMux.Use(s.authMiddleware, s.apiTokenScopeMiddleware)
 
 		authedMux.Post("/task", s.handleCreateTask)
 		authedMux.Get("/tasks", s.handleRetrieveTasks)
-		authedMux.Patch("/task/{taskID}", s.handleUpdateTask)
-		authedMux.Delete("/task/{taskID}", s.handleDeleteTask)
+		authedMux.Get("/events", s.handleEvents)
+		authedMux.Get("/sync", s.handleRetrieveSyncChanges)
+		authedMux.Post("/sync", s.handleSync)
+
+		// Workspace tasks can only be accessed with the workspace endpoints
+		// below, where the user's workspace role is checked.
+		authedMux.Group(func(taskMux chi.Router) {
+			taskMux.Use(s.taskWorkspaceMiddleware)
+
+			taskMux.Patch("/task/{taskID}", s.handleUpdateTask)
+			taskMux.Delete("/task/{taskID}", s.handleDeleteTask)
+			taskMux.Patch("/task/{taskID}/assign", s.handleAssignTask)
+			taskMux.Patch("/task/{taskID}/unassign", s.handleUnassignTask)
+			taskMux.Get("/task/{taskID}/history", s.handleRetrieveTaskHistory)
+			taskMux.Post("/task/{taskID}/comments", s.handleAddComment)
+			taskMux.Get("/task/{taskID}/comments", s.handleRetrieveComments)
+			taskMux.Patch("/task/{taskID}/comments/{commentID}", s.handleUpdateComment)
+			taskMux.Delete("/task/{taskID}/comments/{commentID}", s.handleDeleteComment)
+			taskMux.Post("/task/{taskID}/reminders", s.handleCreateReminder)
+			taskMux.Get("/task/{taskID}/reminders", s.handleRetrieveReminders)
+			taskMux.Delete("/task/{taskID}/reminders/{reminderID}", s.handleDeleteReminder)
+			if s.blobStore != nil {
+				taskMux.Post("/task/{taskID}/attachments", s.handleUploadAttachment)
+				taskMux.Get("/task/{taskID}/attachments", s.handleRetrieveAttachments)
+				taskMux.Get("/task/{taskID}/attachments/{attachmentID}", s.handleDownloadAttachment)
+				taskMux.Delete("/task/{taskID}/attachments/{attachmentID}", s.handleDeleteAttachment)
+			}
+		})
+
+		authedMux.Post("/shares", s.handleCreateShare)
+		authedMux.Get("/shares", s.handleRetrieveShares)
+		authedMux.Delete("/shares/{shareID}", s.handleRevokeShare)
+
+		authedMux.Post("/webhooks", s.handleCreateWebhook)
+		authedMux.Get("/webhooks", s.handleRetrieveWebhooks)
+		authedMux.Delete("/webhooks/{webhookID}", s.handleDeleteWebhook)
+		authedMux.Get("/webhooks/{webhookID}/deliveries", s.handleRetrieveWebhookDeliveries)
+		authedMux.Post("/webhooks/{webhookID}/ping", s.handlePingWebhook)
+
+		authedMux.Post("/workspaces", s.handleCreateWorkspace)
+		authedMux.Get("/workspaces", s.handleRetrieveWorkspaces)
+		authedMux.Get("/workspace-invitations", s.handleRetrieveWorkspaceInvitations)
+		authedMux.Post("/workspace-invitations/{workspaceID}/accept", s.handleAcceptWorkspaceInvitation)
+		authedMux.Post("/workspace-invitations/{workspaceID}/decline", s.handleDeclineWorkspaceInvitation)
+
+		// GraphQL resolvers check the api token scopes of each field.
+		authedMux.Post("/graphql", s.handleGraphQL)
+
+		// Workspace endpoints can only be accessed by members of the
+		// workspace, with the actions allowed by their workspace role.
+		authedMux.Group(func(workspaceMux chi.Router) {
+			workspaceMux.Use(s.workspaceMiddleware)
+
+			editorRole := s.requireWorkspaceRole(db.WorkspaceRoleOwner, db.WorkspaceRoleMember)
+			ownerRole := s.requireWorkspaceRole(db.WorkspaceRoleOwner)
+
+			workspaceMux.Get("/workspaces/{workspaceID}", s.handleRetrieveWorkspace)
+			workspaceMux.Post("/workspaces/{workspaceID}/leave", s.handleLeaveWorkspace)
+			workspaceMux.With(ownerRole).Post("/workspaces/{workspaceID}/invitations", s.handleInviteToWorkspace)
+			workspaceMux.With(ownerRole).Delete("/workspaces/{workspaceID}/members/{userID}", s.handleRemoveWorkspaceMember)
+
+			workspaceMux.With(editorRole).Post("/workspaces/{workspaceID}/task", s.handleCreateWorkspaceTask)
+			workspaceMux.Get("/workspaces/{workspaceID}/tasks", s.handleRetrieveWorkspaceTasks)
+
+			// The role is checked in the workspace of the task, which must be
+			// the workspace in the URL.
+			workspaceMux.Group(func(taskMux chi.Router) {
+				taskMux.Use(s.taskWorkspaceMiddleware)
+
+				taskMux.With(editorRole).Patch("/workspaces/{workspaceID}/task/{taskID}", s.handleUpdateTask)
+				taskMux.With(editorRole).Delete("/workspaces/{workspaceID}/task/{taskID}", s.handleDeleteTask)
+				taskMux.With(editorRole).Patch("/workspaces/{workspaceID}/task/{taskID}/assign", s.handleAssignTask)
+				taskMux.With(editorRole).Patch("/workspaces/{workspaceID}/task/{taskID}/unassign", s.handleUnassignTask)
+				taskMux.Get("/workspaces/{workspaceID}/task/{taskID}/history", s.handleRetrieveTaskHistory)
+				taskMux.With(editorRole).Post("/workspaces/{workspaceID}/task/{taskID}/comments", s.handleAddComment)
+				taskMux.Get("/workspaces/{workspaceID}/task/{taskID}/comments", s.handleRetrieveComments)
+				taskMux.With(editorRole).Patch("/workspaces/{workspaceID}/task/{taskID}/comments/{commentID}", s.handleUpdateComment)
+				taskMux.With(editorRole).Delete("/workspaces/{workspaceID}/task/{taskID}/comments/{commentID}", s.handleDeleteComment)
+				taskMux.With(editorRole).Post("/workspaces/{workspaceID}/task/{taskID}/reminders", s.handleCreateReminder)
+				taskMux.Get("/workspaces/{workspaceID}/task/{taskID}/reminders", s.handleRetrieveReminders)
+				taskMux.With(editorRole).Delete("/workspaces/{workspaceID}/task/{taskID}/reminders/{reminderID}", s.handleDeleteReminder)
+				if s.blobStore != nil {
+					taskMux.With(editorRole).Post("/workspaces/{workspaceID}/task/{taskID}/attachments", s.handleUploadAttachment)
+					taskMux.Get("/workspaces/{workspaceID}/task/{taskID}/attachments", s.handleRetrieveAttachments)
+					taskMux.Get("/workspaces/{workspaceID}/task/{taskID}/attachments/{attachmentID}", s.handleDownloadAttachment)
+					taskMux.With(editorRole).Delete("/workspaces/{workspaceID}/task/{taskID}/attachments/{attachmentID}", s.handleDeleteAttachment)
+				}
+			})
+		})
+
+		// Account management endpoints are not in apiTokenRouteScopes, so they
+		// cannot be accessed with api tokens.
+		authedMux.Group(func(loginMux chi.Router) {
+			loginMux.Post("/2fa/setup", s.handleSetupTwoFactor)
+			loginMux.Post("/2fa/enable", s.handleEnableTwoFactor)
+			loginMux.Post("/2fa/disable", s.handleDisableTwoFactor)
+
+			loginMux.Post("/change-password", s.handleChangePassword)
+
+			loginMux.Get("/sessions", s.handleRetrieveSessions)
+			loginMux.Post("/sessions/renew", s.handleRenewSession)
+			loginMux.Delete("/sessions/{sessionID}", s.handleRevokeSession)
+
+			loginMux.Post("/api-tokens", s.handleCreateAPIToken)
+			loginMux.Get("/api-tokens", s.handleRetrieveAPITokens)
+			loginMux.Delete("/api-tokens/{tokenID}", s.handleRevokeAPIToken)
+
+			loginMux.Post("/feed-tokens", s.handleCreateFeedToken)
+			loginMux.Get("/feed-tokens", s.handleRetrieveFeedTokens)
+			loginMux.Delete("/feed-tokens/{tokenID}", s.handleRevokeFeedToken)
+
+			// Admin endpoints.
+			loginMux.Route("/admin", func(adminMux chi.Router) {
+				adminMux.Use(s.requireRole(db.RoleAdmin))
+
+				adminMux.Get("/users", s.handleAdminRetrieveUsers)
+				adminMux.Get("/users/{userID}", s.handleAdminRetrieveUser)
+				adminMux.Post("/users/{userID}/disable", s.handleAdminDisableUser)
+				adminMux.Post("/users/{userID}/enable", s.handleAdminEnableUser)
+				adminMux.Post("/users/{userID}/force-password-reset", s.handleAdminForcePasswordReset)
+				adminMux.Get("/jobs", s.handleAdminRetrieveJobs)
+			})
+		})
 	})
 }
 
@@ -0,0 +1,130 @@
+package webserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// testMailer is a Mailer that records the emails it sends.
+type testMailer struct {
+	mtx  sync.Mutex
+	sent []testEmail
+	// sentChan receives every sent email if it is not nil.
+	sentChan chan testEmail
+}
+
+type testEmail struct {
+	to, subject, body string
+}
+
+func (tm *testMailer) SendMail(to, subject, body string) error {
+	email := testEmail{to: to, subject: subject, body: body}
+	tm.mtx.Lock()
+	tm.sent = append(tm.sent, email)
+	tm.mtx.Unlock()
+	if tm.sentChan != nil {
+		tm.sentChan <- email
+	}
+	return nil
+}
+
+// memBlobStore is a BlobStore that keeps blobs in memory.
+type memBlobStore struct {
+	mtx   sync.Mutex
+	blobs map[string][]byte
+}
+
+func newMemBlobStore() *memBlobStore {
+	return &memBlobStore{blobs: make(map[string][]byte)}
+}
+
+func (ms *memBlobStore) PutBlob(_ context.Context, key string, r io.Reader, _ int64, _ string) error {
+	blob, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	ms.mtx.Lock()
+	ms.blobs[key] = blob
+	ms.mtx.Unlock()
+	return nil
+}
+
+func (ms *memBlobStore) GetBlob(_ context.Context, key string) (io.ReadCloser, error) {
+	ms.mtx.Lock()
+	defer ms.mtx.Unlock()
+	blob, ok := ms.blobs[key]
+	if !ok {
+		return nil, ErrBlobNotFound
+	}
+	return io.NopCloser(bytes.NewReader(blob)), nil
+}
+
+func (ms *memBlobStore) DeleteBlob(_ context.Context, key string) error {
+	ms.mtx.Lock()
+	delete(ms.blobs, key)
+	ms.mtx.Unlock()
+	return nil
+}
+
+// newTestServer returns a *WebServer for db. Methods of TaskDatabase that db
+// does not implement panic, so tests only implement the ones they need.
+func newTestServer(t *testing.T, db TaskDatabase, cfg *Config) *WebServer {
+	t.Helper()
+
+	if cfg == nil {
+		cfg = new(Config)
+	}
+	if cfg.Mailer == nil {
+		cfg.Mailer = new(testMailer)
+	}
+	if cfg.ReminderNotifiers == nil {
+		cfg.ReminderNotifiers = []Notifier{NewLogNotifier(slog.New(slog.NewTextHandler(io.Discard, nil)))}
+	}
+
+	s, err := New(db, slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	return s
+}
+
+// testRequest sends a request to s and returns the response. body is sent as
+// JSON if it is not nil, and authToken as a bearer token if it is not empty.
+func testRequest(t *testing.T, s *WebServer, method, path, authToken string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("json.Marshal error: %v", err)
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req := httptest.NewRequest(method, path, reqBody)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+authToken)
+	}
+
+	res := httptest.NewRecorder()
+	s.mux.ServeHTTP(res, req)
+	return res
+}
+
+// checkStatus fails the test if res does not have the wanted status code.
+func checkStatus(t *testing.T, res *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if res.Code != want {
+		t.Fatalf("want status %d, got %d: %s", want, res.Code, res.Body.String())
+	}
+}
@@ -0,0 +1,78 @@
+package webserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ukane-philemon/megtask/db"
+)
+
+const (
+	// defaultSessionExpiry is the default duration a login session is valid.
+	defaultSessionExpiry = 30 * 24 * time.Hour
+	// defaultAuthTokenExpiry is the default duration an auth token is valid.
+	// Clients renew their auth token while their session is valid, so a
+	// leaked token is only usable for a short time.
+	defaultAuthTokenExpiry = 15 * time.Minute
+)
+
+// handleRetrieveSessions handles the "GET /sessions" endpoint and returns the
+// user's active login sessions. The session of the request is marked as
+// current.
+func (s *WebServer) handleRetrieveSessions(res http.ResponseWriter, req *http.Request) {
+	userID := s.reqUserID(req)
+	sessions, err := s.taskDB.Sessions(userID)
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("taskDB.Sessions error: %w", err))
+		return
+	}
+
+	currentSessionID := s.reqSessionID(req)
+	for _, session := range sessions {
+		session.Current = session.ID == currentSessionID
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"sessions": sessions,
+	})
+}
+
+// handleRenewSession handles the "POST /sessions/renew" endpoint and returns a
+// new auth token for the session of the request. The session itself is not
+// extended, so renewing stops working when the session expires or is revoked.
+func (s *WebServer) handleRenewSession(res http.ResponseWriter, req *http.Request) {
+	authToken, err := s.jwtManager.GenerateJWtToken(s.reqUserID(req), s.reqUserRole(req), s.reqSessionID(req), s.authTokenExpiry)
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("jwtManager.GenerateJWtToken error: %w", err))
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"authToken": authToken,
+		"message":   "Auth token renewed.",
+	})
+}
+
+// handleRevokeSession handles the "DELETE /sessions/{sessionID}" endpoint and
+// revokes one of the user's login sessions. Revoking the current session logs
+// the user out.
+func (s *WebServer) handleRevokeSession(res http.ResponseWriter, req *http.Request) {
+	sessionID := chi.URLParam(req, "sessionID")
+	userID := s.reqUserID(req)
+	err := s.taskDB.RevokeSession(userID, sessionID)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.RevokeSession error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]string{
+		"message": "Session revoked.",
+	})
+}
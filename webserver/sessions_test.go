@@ -0,0 +1,214 @@
+package webserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+// sessionDB is a TaskDatabase that logs in any user and records the expiry of
+// the sessions it creates.
+type sessionDB struct {
+	TaskDatabase
+	expiry *time.Duration
+}
+
+func (sessionDB) Login(username, password string) (*db.User, error) {
+	return &db.User{ID: "user", Username: username, Role: db.RoleUser}, nil
+}
+
+func (sdb sessionDB) CreateSession(userID, deviceLabel, userAgent, ip string, expiry time.Duration) (*db.Session, error) {
+	*sdb.expiry = expiry
+	return &db.Session{ID: "session"}, nil
+}
+
+func TestLoginSessionExpiry(t *testing.T) {
+	tests := []struct {
+		name              string
+		cfg               *Config
+		wantSessionExpiry time.Duration
+		wantTokenExpiry   time.Duration
+	}{
+		{"default", nil, defaultSessionExpiry, defaultAuthTokenExpiry},
+		{"configured", &Config{SessionExpiry: 24 * time.Hour, AuthTokenExpiry: 5 * time.Minute}, 24 * time.Hour, 5 * time.Minute},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sdb := sessionDB{expiry: new(time.Duration)}
+			s := newTestServer(t, sdb, test.cfg)
+
+			res := testRequest(t, s, http.MethodPost, "/login", "", map[string]string{"username": "user", "password": "password"})
+			checkStatus(t, res, http.StatusOK)
+
+			if *sdb.expiry != test.wantSessionExpiry {
+				t.Fatalf("want session expiry %v, got %v", test.wantSessionExpiry, *sdb.expiry)
+			}
+
+			var body struct {
+				AuthToken string `json:"authToken"`
+			}
+			if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+				t.Fatalf("json.Unmarshal error: %v", err)
+			}
+
+			claims, valid := s.jwtManager.IsValidToken(body.AuthToken)
+			if !valid {
+				t.Fatal("invalid auth token")
+			}
+			if claims.SessionID != "session" {
+				t.Fatalf("want session ID session, got %s", claims.SessionID)
+			}
+			if expiresIn := time.Until(claims.ExpiresAt.Time); expiresIn < test.wantTokenExpiry-time.Minute || expiresIn > test.wantTokenExpiry {
+				t.Fatalf("want auth token to expire in %v, expires in %v", test.wantTokenExpiry, expiresIn)
+			}
+		})
+	}
+}
+
+func TestRenewSession(t *testing.T) {
+	apiToken := apiTokenPrefix + "token"
+	rdb := revocationDB{
+		authDB:   authDB{roles: map[string]string{"user": db.RoleUser}, scopes: map[string][]string{apiToken: {scopeTasksWrite}}},
+		sessions: map[string]bool{"laptop": true},
+	}
+	s := newTestServer(t, rdb, nil)
+
+	token, err := s.jwtManager.GenerateJWtToken("user", db.RoleUser, "laptop", time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateJWtToken error: %v", err)
+	}
+
+	// The tests share the session and run in order.
+	tests := []struct {
+		name       string
+		token      string
+		revoke     bool
+		wantStatus int
+	}{
+		{"api token", apiToken, false, http.StatusForbidden},
+		{"active session", token, false, http.StatusOK},
+		{"revoked session", token, true, http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.revoke {
+				delete(rdb.sessions, "laptop")
+			}
+
+			res := testRequest(t, s, http.MethodPost, "/sessions/renew", test.token, nil)
+			checkStatus(t, res, test.wantStatus)
+			if test.wantStatus != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				AuthToken string `json:"authToken"`
+			}
+			if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+				t.Fatalf("json.Unmarshal error: %v", err)
+			}
+
+			claims, valid := s.jwtManager.IsValidToken(body.AuthToken)
+			if !valid {
+				t.Fatal("invalid auth token")
+			}
+			if claims.ID != "user" || claims.Role != db.RoleUser || claims.SessionID != "laptop" {
+				t.Fatalf("want a token for the laptop session of user, got %+v", claims)
+			}
+			if expiresIn := time.Until(claims.ExpiresAt.Time); expiresIn <= time.Minute {
+				t.Fatalf("want auth token to expire in %v, expires in %v", defaultAuthTokenExpiry, expiresIn)
+			}
+		})
+	}
+}
+
+// revocationDB is a TaskDatabase with the active sessions of "user" in
+// sessions.
+type revocationDB struct {
+	authDB
+	sessions map[string]bool
+}
+
+func (rdb revocationDB) TouchSession(userID, sessionID string) error {
+	if !rdb.sessions[sessionID] {
+		return db.ErrorInvalidRequest
+	}
+	return nil
+}
+
+func (rdb revocationDB) Sessions(userID string) ([]*db.Session, error) {
+	var sessions []*db.Session
+	for sessionID := range rdb.sessions {
+		sessions = append(sessions, &db.Session{ID: sessionID})
+	}
+	return sessions, nil
+}
+
+func (rdb revocationDB) RevokeSession(userID, sessionID string) error {
+	if !rdb.sessions[sessionID] {
+		return db.ErrorInvalidRequest
+	}
+	delete(rdb.sessions, sessionID)
+	return nil
+}
+
+func TestSessionRevocation(t *testing.T) {
+	rdb := revocationDB{
+		authDB:   authDB{roles: map[string]string{"user": db.RoleUser}},
+		sessions: map[string]bool{"laptop": true, "phone": true},
+	}
+	s := newTestServer(t, rdb, nil)
+
+	tokens := make(map[string]string)
+	for _, sessionID := range []string{"laptop", "phone"} {
+		token, err := s.jwtManager.GenerateJWtToken("user", db.RoleUser, sessionID, time.Minute)
+		if err != nil {
+			t.Fatalf("GenerateJWtToken error: %v", err)
+		}
+		tokens[sessionID] = token
+	}
+
+	// The tests share the sessions and run in order.
+	tests := []struct {
+		name        string
+		session     string
+		method      string
+		path        string
+		wantStatus  int
+		wantCurrent string
+	}{
+		{"list sessions", "laptop", http.MethodGet, "/sessions", http.StatusOK, "laptop"},
+		{"revoke another session", "laptop", http.MethodDelete, "/sessions/phone", http.StatusOK, ""},
+		{"revoked session is logged out", "phone", http.MethodGet, "/sessions", http.StatusUnauthorized, ""},
+		{"revoke a revoked session", "laptop", http.MethodDelete, "/sessions/phone", http.StatusBadRequest, ""},
+		{"revoke the current session", "laptop", http.MethodDelete, "/sessions/laptop", http.StatusOK, ""},
+		{"current session is logged out", "laptop", http.MethodGet, "/sessions", http.StatusUnauthorized, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := testRequest(t, s, test.method, test.path, tokens[test.session], nil)
+			checkStatus(t, res, test.wantStatus)
+			if test.wantCurrent == "" {
+				return
+			}
+
+			var body struct {
+				Sessions []*db.Session `json:"sessions"`
+			}
+			if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+				t.Fatalf("json.Unmarshal error: %v", err)
+			}
+			for _, session := range body.Sessions {
+				if session.Current != (session.ID == test.wantCurrent) {
+					t.Fatalf("want only session %s current, got %s current %v", test.wantCurrent, session.ID, session.Current)
+				}
+			}
+		})
+	}
+}
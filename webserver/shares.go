@@ -0,0 +1,84 @@
+package webserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ukane-philemon/megtask/db"
+)
+
+// handleCreateShare handles the "POST /shares" endpoint and shares one of the
+// user's tasks or projects with another user with read or edit permission.
+func (s *WebServer) handleCreateShare(res http.ResponseWriter, req *http.Request) {
+	form := new(shareRequest)
+	if !s.readPostBody(res, req, &form) {
+		return
+	}
+
+	err := form.Validate()
+	if err != nil {
+		s.writeBadRequest(res, err.Error())
+		return
+	}
+
+	userID := s.reqUserID(req)
+
+	var share *db.Share
+	var methodName string
+	if form.TaskID != "" {
+		methodName = "taskDB.ShareTask"
+		share, err = s.taskDB.ShareTask(userID, form.TaskID, form.Username, form.Permission)
+	} else {
+		methodName = "taskDB.ShareProject"
+		share, err = s.taskDB.ShareProject(userID, form.Project, form.Username, form.Permission)
+	}
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("%s error: %w", methodName, err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"share": share,
+	})
+}
+
+// handleRetrieveShares handles the "GET /shares" endpoint and returns all the
+// tasks and projects the user has shared with other users.
+func (s *WebServer) handleRetrieveShares(res http.ResponseWriter, req *http.Request) {
+	userID := s.reqUserID(req)
+	shares, err := s.taskDB.Shares(userID)
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("taskDB.Shares error: %w", err))
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"shares": shares,
+	})
+}
+
+// handleRevokeShare handles the "DELETE /shares/{shareID}" endpoint and stops
+// sharing a task or project with a collaborator.
+func (s *WebServer) handleRevokeShare(res http.ResponseWriter, req *http.Request) {
+	shareID := chi.URLParam(req, "shareID")
+	userID := s.reqUserID(req)
+	err := s.taskDB.RevokeShare(userID, shareID)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.RevokeShare error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]string{
+		"message": "Share revoked.",
+	})
+}
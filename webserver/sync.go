@@ -0,0 +1,123 @@
+package webserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+// syncTokenQueryKey is the expected query key to provide the sync token
+// returned by the previous sync.
+const syncTokenQueryKey = "since"
+
+// handleRetrieveSyncChanges handles the "GET /sync" endpoint and returns the
+// user's tasks that changed or were deleted since the sync token in the
+// optional "since" query parameter, with the token to use for the next sync.
+// All the user's tasks are returned with "reset" set to true if no token is
+// provided or the token is too old, and the client must then remove the tasks
+// that are not included.
+func (s *WebServer) handleRetrieveSyncChanges(res http.ResponseWriter, req *http.Request) {
+	var since int64
+	if token := req.URL.Query().Get(syncTokenQueryKey); token != "" {
+		var err error
+		since, err = strconv.ParseInt(token, 10, 64)
+		if err != nil || since < 0 {
+			s.writeBadRequest(res, "invalid sync token")
+			return
+		}
+	}
+
+	delta, err := s.taskDB.TaskDelta(s.reqUserID(req), since)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.TaskDelta error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"tasks":     delta.Tasks,
+		"deleted":   delta.Deleted,
+		"reset":     delta.Reset,
+		"syncToken": strconv.FormatInt(delta.SyncVersion, 10),
+	})
+}
+
+// handleSync handles the "POST /sync" endpoint and applies a batch of changes
+// a client made to the user's tasks while it was offline. Each change is
+// answered with a result, in order, that reports the fields that were not
+// applied because they were changed more recently on the server.
+func (s *WebServer) handleSync(res http.ResponseWriter, req *http.Request) {
+	form := new(syncRequest)
+	if !s.readPostBody(res, req, &form) {
+		return
+	}
+
+	if err := form.Validate(); err != nil {
+		s.writeBadRequest(res, err.Error())
+		return
+	}
+
+	userID := s.reqUserID(req)
+
+	// The users and attachments of the tasks to delete are retrieved before
+	// the changes are applied, as they are not known afterwards.
+	audiences := make(map[string][]string)
+	attachmentIDs := make(map[string][]string)
+	for _, change := range form.Changes {
+		if change.Action != db.SyncActionDelete {
+			continue
+		}
+
+		audience, err := s.taskDB.TaskAudience(change.TaskID)
+		if err != nil && !errors.Is(err, db.ErrorInvalidRequest) {
+			s.log.Error("taskDB.TaskAudience error: ", "error", err)
+		}
+		audiences[change.TaskID] = audience
+
+		if s.blobStore != nil {
+			attachments, err := s.taskDB.Attachments(userID, change.TaskID)
+			if err != nil && !errors.Is(err, db.ErrorInvalidRequest) {
+				s.log.Error("taskDB.Attachments error: ", "error", err)
+			}
+			for _, attachment := range attachments {
+				attachmentIDs[change.TaskID] = append(attachmentIDs[change.TaskID], attachment.ID)
+			}
+		}
+	}
+
+	results, err := s.taskDB.SyncTasks(userID, form.Changes)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.SyncTasks error: %w", err))
+		}
+		return
+	}
+
+	for _, result := range results {
+		if !result.Changed {
+			continue
+		}
+
+		switch result.Action {
+		case db.SyncActionCreate:
+			s.publishTaskEvent(TaskCreatedEvent, result.TaskID, []*db.Task{result.Task})
+		case db.SyncActionUpdate:
+			s.publishTaskEvent(TaskUpdatedEvent, result.TaskID, []*db.Task{result.Task})
+		case db.SyncActionDelete:
+			s.deleteAttachmentBlobs(req.Context(), attachmentIDs[result.TaskID]...)
+			s.publishEvent(TaskDeletedEvent, result.TaskID, nil, audiences[result.TaskID])
+		}
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"results": results,
+	})
+}
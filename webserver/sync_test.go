@@ -0,0 +1,220 @@
+package webserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+// syncDB is a TaskDatabase that applies sync changes made after
+// syncServerTime and reports a conflict for older updates.
+type syncDB struct {
+	authDB
+}
+
+const syncServerTime = 1000
+
+func (syncDB) TaskDelta(userID string, since int64) (*db.TaskDelta, error) {
+	return &db.TaskDelta{Reset: since == 0, SyncVersion: since + 1}, nil
+}
+
+func (syncDB) SyncTasks(userID string, changes []*db.SyncChange) ([]*db.SyncResult, error) {
+	results := make([]*db.SyncResult, 0, len(changes))
+	for _, change := range changes {
+		result := &db.SyncResult{Action: change.Action, TaskID: change.TaskID, ClientID: change.ClientID, Status: db.SyncStatusApplied}
+		if change.ModifiedAt <= syncServerTime && change.Action != db.SyncActionCreate {
+			result.Status = db.SyncStatusConflict
+			result.Conflicts = []*db.SyncConflict{{Field: db.SyncFieldDetail, ServerValue: "server", ServerModifiedAt: syncServerTime}}
+		} else {
+			result.Changed = true
+		}
+		if change.Action == db.SyncActionCreate {
+			result.TaskID = "new"
+		}
+		if change.Action != db.SyncActionDelete || !result.Changed {
+			result.Task = &db.Task{ID: result.TaskID}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (syncDB) TaskAudience(taskID string) ([]string, error) {
+	return []string{"user"}, nil
+}
+
+func TestSync(t *testing.T) {
+	s := newTestServer(t, syncDB{authDB{roles: map[string]string{"user": db.RoleUser}}}, nil)
+
+	token, err := s.jwtManager.GenerateJWtToken("user", db.RoleUser, "session", time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateJWtToken error: %v", err)
+	}
+
+	detail, completed, pending := "detail", true, false
+	dueAt, invalidDueAt := int64(1700000000), int64(-1)
+	tags, recurrence, invalidRecurrence := []string{"home"}, "FREQ=DAILY", "DAILY"
+	tests := []struct {
+		name       string
+		changes    []*db.SyncChange
+		wantStatus int
+		// wantResults are the statuses of the results.
+		wantResults []string
+		// wantEvents are the types and task IDs of the events published.
+		wantEvents []string
+	}{
+		{
+			name:       "no changes",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "missing modification time",
+			changes:    []*db.SyncChange{{Action: db.SyncActionDelete, TaskID: "task"}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "create without client ID",
+			changes:    []*db.SyncChange{{Action: db.SyncActionCreate, ModifiedAt: 2000, Detail: &detail}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "update without fields",
+			changes:    []*db.SyncChange{{Action: db.SyncActionUpdate, TaskID: "task", ModifiedAt: 2000}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "mark a task as pending",
+			changes:    []*db.SyncChange{{Action: db.SyncActionUpdate, TaskID: "task", ModifiedAt: 2000, Completed: &pending}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid due date",
+			changes:    []*db.SyncChange{{Action: db.SyncActionUpdate, TaskID: "task", ModifiedAt: 2000, DueAt: &invalidDueAt}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid recurrence",
+			changes:    []*db.SyncChange{{Action: db.SyncActionUpdate, TaskID: "task", ModifiedAt: 2000, Recurrence: &invalidRecurrence}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "create a recurring task without due date",
+			changes:    []*db.SyncChange{{Action: db.SyncActionCreate, ClientID: "client", ModifiedAt: 2000, Detail: &detail, Recurrence: &recurrence}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown action",
+			changes:    []*db.SyncChange{{Action: "move", TaskID: "task", ModifiedAt: 2000}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "applied changes",
+			changes: []*db.SyncChange{
+				{Action: db.SyncActionCreate, ClientID: "client", ModifiedAt: 2000, Detail: &detail},
+				{Action: db.SyncActionUpdate, TaskID: "updated", ModifiedAt: 2000, Completed: &completed},
+				{Action: db.SyncActionUpdate, TaskID: "due", ModifiedAt: 2000, DueAt: &dueAt, Tags: &tags, Recurrence: &recurrence},
+				{Action: db.SyncActionDelete, TaskID: "deleted", ModifiedAt: 2000},
+			},
+			wantStatus:  http.StatusOK,
+			wantResults: []string{db.SyncStatusApplied, db.SyncStatusApplied, db.SyncStatusApplied, db.SyncStatusApplied},
+			wantEvents:  []string{TaskCreatedEvent + " new", TaskUpdatedEvent + " updated", TaskUpdatedEvent + " due", TaskDeletedEvent + " deleted"},
+		},
+		{
+			name: "conflicts",
+			changes: []*db.SyncChange{
+				{Action: db.SyncActionUpdate, TaskID: "updated", ModifiedAt: 500, Detail: &detail},
+				{Action: db.SyncActionDelete, TaskID: "deleted", ModifiedAt: 500},
+			},
+			wantStatus:  http.StatusOK,
+			wantResults: []string{db.SyncStatusConflict, db.SyncStatusConflict},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sub, _, _ := s.events.subscribe("user", 0)
+			defer s.events.unsubscribe(sub)
+
+			res := testRequest(t, s, http.MethodPost, "/sync", token, &syncRequest{Changes: test.changes})
+			checkStatus(t, res, test.wantStatus)
+			if test.wantStatus != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				Results []*db.SyncResult `json:"results"`
+			}
+			if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+				t.Fatalf("json.Unmarshal error: %v", err)
+			}
+			if len(body.Results) != len(test.wantResults) {
+				t.Fatalf("want %d results, got %s", len(test.wantResults), res.Body.String())
+			}
+			for i, result := range body.Results {
+				if result.Status != test.wantResults[i] {
+					t.Fatalf("want result %d %s, got %s", i, test.wantResults[i], result.Status)
+				}
+				if result.Status == db.SyncStatusConflict && (len(result.Conflicts) == 0 || result.Task == nil) {
+					t.Fatalf("want conflicts and the server task, got %+v", result)
+				}
+			}
+
+			// Only changes that were applied are published.
+			var events []string
+			for len(sub.events) > 0 {
+				event := <-sub.events
+				events = append(events, event.Type+" "+event.TaskID)
+			}
+			if strings.Join(events, ", ") != strings.Join(test.wantEvents, ", ") {
+				t.Fatalf("want events %v, got %v", test.wantEvents, events)
+			}
+		})
+	}
+}
+
+func TestRetrieveSyncChanges(t *testing.T) {
+	s := newTestServer(t, syncDB{authDB{roles: map[string]string{"user": db.RoleUser}}}, nil)
+
+	token, err := s.jwtManager.GenerateJWtToken("user", db.RoleUser, "session", time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateJWtToken error: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		query         string
+		wantStatus    int
+		wantReset     bool
+		wantSyncToken string
+	}{
+		{"first sync", "", http.StatusOK, true, "1"},
+		{"next sync", "?since=41", http.StatusOK, false, "42"},
+		{"negative token", "?since=-1", http.StatusBadRequest, false, ""},
+		{"invalid token", "?since=yesterday", http.StatusBadRequest, false, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := testRequest(t, s, http.MethodGet, "/sync"+test.query, token, nil)
+			checkStatus(t, res, test.wantStatus)
+			if test.wantStatus != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				Reset     bool   `json:"reset"`
+				SyncToken string `json:"syncToken"`
+			}
+			if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+				t.Fatalf("json.Unmarshal error: %v", err)
+			}
+			if body.Reset != test.wantReset || body.SyncToken != test.wantSyncToken {
+				t.Fatalf("want reset %v and sync token %s, got %s", test.wantReset, test.wantSyncToken, res.Body.String())
+			}
+		})
+	}
+}
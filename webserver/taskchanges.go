@@ -0,0 +1,39 @@
+package webserver
+
+import (
+	"context"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+// TaskChangeSource reports the changes made to tasks by every server that
+// shares the database, so servers running as replicas publish the same task
+// events.
+type TaskChangeSource interface {
+	// SubscribeTaskChanges returns a channel that receives task changes and a
+	// function that ends the subscription and closes the channel.
+	SubscribeTaskChanges() (<-chan *db.TaskChange, func())
+}
+
+// publishTaskChanges publishes the task changes received on changes to the
+// event bus until ctx is canceled.
+func (s *WebServer) publishTaskChanges(ctx context.Context, changes <-chan *db.TaskChange) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case change, ok := <-changes:
+			if !ok {
+				return
+			}
+
+			task := change.Task
+			if change.Type == TaskDeletedEvent {
+				// Deleted tasks are not sent with their events.
+				task = nil
+			}
+
+			s.events.publish(newTaskEvent(change.Type, change.TaskID, task, change.Audience))
+		}
+	}
+}
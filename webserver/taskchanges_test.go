@@ -0,0 +1,69 @@
+package webserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+// testChangeSource is a TaskChangeSource without changes.
+type testChangeSource struct{}
+
+func (testChangeSource) SubscribeTaskChanges() (<-chan *db.TaskChange, func()) {
+	return nil, func() {}
+}
+
+func TestPublishTaskChanges(t *testing.T) {
+	task := &db.Task{ID: "task", Permission: db.PermissionEdit}
+
+	tests := []struct {
+		name     string
+		change   *db.TaskChange
+		wantTask bool
+		// wantReceived is true if "user" receives the event.
+		wantReceived bool
+	}{
+		{"created", &db.TaskChange{Type: db.TaskChangeCreated, TaskID: "task", Task: task, Audience: []string{"user"}}, true, true},
+		{"updated", &db.TaskChange{Type: db.TaskChangeUpdated, TaskID: "task", Task: task, Audience: []string{"other", "user"}}, true, true},
+		{"deleted with the task", &db.TaskChange{Type: db.TaskChangeDeleted, TaskID: "task", Task: task, Audience: []string{"user"}}, false, true},
+		{"deleted without the task", &db.TaskChange{Type: db.TaskChangeDeleted, TaskID: "task"}, false, false},
+		{"other users", &db.TaskChange{Type: db.TaskChangeUpdated, TaskID: "task", Task: task, Audience: []string{"other"}}, true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestServer(t, authDB{}, &Config{TaskChanges: testChangeSource{}})
+			sub, _, _ := s.events.subscribe("user", 0)
+			defer s.events.unsubscribe(sub)
+
+			// Events published by this server are left to the change source.
+			s.publishEvent(TaskUpdatedEvent, "local", nil, []string{"user"})
+
+			changes := make(chan *db.TaskChange, 1)
+			changes <- test.change
+			close(changes)
+			s.publishTaskChanges(context.Background(), changes)
+
+			select {
+			case event := <-sub.events:
+				if !test.wantReceived {
+					t.Fatalf("want no event, got %+v", event)
+				}
+				if event.Type != test.change.Type || event.TaskID != test.change.TaskID {
+					t.Fatalf("want %s event of %s, got %+v", test.change.Type, test.change.TaskID, event)
+				}
+				if (event.Task != nil) != test.wantTask {
+					t.Fatalf("want task sent %v, got %+v", test.wantTask, event.Task)
+				}
+				if event.Task != nil && event.Task.Permission != "" {
+					t.Fatalf("want no permission sent, got %s", event.Task.Permission)
+				}
+			default:
+				if test.wantReceived {
+					t.Fatal("want an event")
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package webserver
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -20,6 +21,24 @@ const (
 	// pendingTasksFilter is the status filter used to filter only pending
 	// tasks.
 	pendingTasksFilter = "pending"
+
+	// taskScopeQueryKey is the expected query key to choose which tasks are
+	// returned.
+	taskScopeQueryKey = "scope"
+	// sharedTasksScope is the scope used to return tasks shared with the
+	// user instead of the user's own tasks.
+	sharedTasksScope = "shared"
+	// ownTasksScope and assignedTasksScope are the scopes used to return
+	// the user's own tasks and the tasks assigned to the user.
+	ownTasksScope      = "own"
+	assignedTasksScope = "assigned"
+
+	// taskAssigneeQueryKey is the expected query key to return the tasks
+	// assigned to a user.
+	taskAssigneeQueryKey = "assignee"
+	// currentUserAssignee is the assignee filter used to return the tasks
+	// assigned to the user.
+	currentUserAssignee = "me"
 )
 
 // handleCreateTask handles the "POST /task" endpoint and creates a new task
@@ -30,18 +49,21 @@ func (s *WebServer) handleCreateTask(res http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	if form.TaskDetail == "" {
-		s.writeBadRequest(res, "missing task detail")
+	err := form.Validate()
+	if err != nil {
+		s.writeBadRequest(res, err.Error())
 		return
 	}
 
 	userID := s.reqUserID(req)
-	userTasks, err := s.taskDB.CreateTask(userID, form.TaskDetail)
+	task, userTasks, err := s.taskDB.CreateTask(userID, form.TaskDetail, form.Project, form.DueAt, form.Tags, form.Recurrence)
 	if err != nil {
 		s.writeServerError(res, fmt.Errorf("taskDB.CreateTask error: %w", err))
 		return
 	}
 
+	s.publishTaskEvent(TaskCreatedEvent, task.ID, userTasks)
+
 	s.writeSuccess(res, map[string]any{
 		"tasks": userTasks,
 	})
@@ -49,7 +71,10 @@ func (s *WebServer) handleCreateTask(res http.ResponseWriter, req *http.Request)
 
 // handleRetrieveTasks handles the "GET /tasks" endpoint and returns all users
 // tasks sorted by timestamp. This endpoint excepts an optional "status" query
-// parameter that can either be "pending" or "completed".
+// parameter that can either be "pending" or "completed", and an optional
+// "scope" query parameter that can be "shared" to return tasks shared with the
+// user, or an optional "assignee" query parameter that can be "me" to return
+// tasks assigned to the user.
 func (s *WebServer) handleRetrieveTasks(res http.ResponseWriter, req *http.Request) {
 	status := req.URL.Query().Get(taskStatusQueryKey)
 	if status != "" && !strings.EqualFold(status, pendingTasksFilter) && !strings.EqualFold(status, completedTasksFilter) {
@@ -57,21 +82,30 @@ func (s *WebServer) handleRetrieveTasks(res http.ResponseWriter, req *http.Reque
 		return
 	}
 
-	userID := s.reqUserID(req)
+	scope := req.URL.Query().Get(taskScopeQueryKey)
+	if scope != "" && !strings.EqualFold(scope, sharedTasksScope) {
+		s.writeBadRequest(res, `"scope" query param can only be "shared"`)
+		return
+	}
 
-	var userTasks []*db.Task
-	var err error
-	var methodName string
-	if status != "" {
-		methodName = "taskDB.TasksWithStatus"
-		filterCompleted := strings.EqualFold(status, completedTasksFilter)
-		userTasks, err = s.taskDB.TasksWithStatus(userID, filterCompleted)
-	} else {
-		methodName = "taskDB.Tasks"
-		userTasks, err = s.taskDB.Tasks(userID)
+	assignee := req.URL.Query().Get(taskAssigneeQueryKey)
+	if assignee != "" && !strings.EqualFold(assignee, currentUserAssignee) {
+		s.writeBadRequest(res, `"assignee" query param can only be "me"`)
+		return
+	}
+
+	if scope != "" && assignee != "" {
+		s.writeBadRequest(res, `"scope" and "assignee" query params cannot be combined`)
+		return
+	}
+
+	if assignee != "" {
+		scope = assignedTasksScope
 	}
+
+	userTasks, err := s.scopedTasks(s.reqUserID(req), strings.ToLower(scope), completedFilter(status))
 	if err != nil {
-		s.writeServerError(res, fmt.Errorf("%s error: %w", methodName, err))
+		s.writeServerError(res, err)
 		return
 	}
 
@@ -89,20 +123,16 @@ func (s *WebServer) handleUpdateTask(res http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	if form.TaskDetail == "" && !form.MarkAsCompleted {
-		s.writeBadRequest(res, "missing required data")
+	err := form.Validate()
+	if err != nil {
+		s.writeBadRequest(res, err.Error())
 		return
 	}
 
-	var markAsCompleted *bool
-	if form.MarkAsCompleted {
-		markAsCompleted = &form.MarkAsCompleted
-	}
-
 	taskID := chi.URLParam(req, "taskID")
 	userID := s.reqUserID(req)
 
-	userTasks, err := s.taskDB.UpdateTask(userID, taskID, form.TaskDetail, markAsCompleted)
+	userTasks, err := s.taskDB.UpdateTask(userID, taskID, form.taskUpdate())
 	if err != nil {
 		if errors.Is(err, db.ErrorInvalidRequest) {
 			s.writeBadRequest(res, err.Error())
@@ -112,6 +142,8 @@ func (s *WebServer) handleUpdateTask(res http.ResponseWriter, req *http.Request)
 		return
 	}
 
+	s.publishTaskEvent(TaskUpdatedEvent, taskID, userTasks)
+
 	s.writeSuccess(res, map[string]any{
 		"tasks": userTasks,
 	})
@@ -122,12 +154,13 @@ func (s *WebServer) handleUpdateTask(res http.ResponseWriter, req *http.Request)
 func (s *WebServer) handleDeleteTask(res http.ResponseWriter, req *http.Request) {
 	taskID := chi.URLParam(req, "taskID")
 	userID := s.reqUserID(req)
-	userTasks, err := s.taskDB.DeleteTask(userID, taskID)
+
+	userTasks, err := s.deleteTask(req.Context(), userID, taskID)
 	if err != nil {
 		if errors.Is(err, db.ErrorInvalidRequest) {
 			s.writeBadRequest(res, err.Error())
 		} else {
-			s.writeServerError(res, fmt.Errorf("taskDB.DeleteTask: %w", err))
+			s.writeServerError(res, err)
 		}
 		return
 	}
@@ -136,3 +169,167 @@ func (s *WebServer) handleDeleteTask(res http.ResponseWriter, req *http.Request)
 		"tasks": userTasks,
 	})
 }
+
+// deleteTask deletes a task the user with the provided userID owns or can
+// edit and the content of its attachments, and notifies the users that could
+// access it. Returns the list of tasks the deleted task belonged to for the
+// user. ErrorInvalidRequest errors are returned unwrapped so they can be shown
+// to the user.
+func (s *WebServer) deleteTask(ctx context.Context, userID, taskID string) ([]*db.Task, error) {
+	// The attachments are retrieved before the task is deleted so their
+	// content can be deleted too.
+	var attachmentIDs []string
+	if s.blobStore != nil {
+		attachments, err := s.taskDB.Attachments(userID, taskID)
+		if err != nil {
+			if errors.Is(err, db.ErrorInvalidRequest) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("taskDB.Attachments error: %w", err)
+		}
+
+		for _, attachment := range attachments {
+			attachmentIDs = append(attachmentIDs, attachment.ID)
+		}
+	}
+
+	// The users that can access the task are retrieved before it is
+	// deleted so they can be notified.
+	audience, err := s.taskDB.TaskAudience(taskID)
+	if err != nil && !errors.Is(err, db.ErrorInvalidRequest) {
+		s.log.Error("taskDB.TaskAudience error: ", "error", err)
+	}
+
+	userTasks, err := s.taskDB.DeleteTask(userID, taskID)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("taskDB.DeleteTask: %w", err)
+	}
+
+	s.deleteAttachmentBlobs(ctx, attachmentIDs...)
+	s.publishEvent(TaskDeletedEvent, taskID, nil, audience)
+
+	return userTasks, nil
+}
+
+// handleAssignTask handles the "PATCH /task/{taskID}/assign" endpoint and
+// assigns a task to a user that has access to it.
+func (s *WebServer) handleAssignTask(res http.ResponseWriter, req *http.Request) {
+	form := new(assignTaskRequest)
+	if !s.readPostBody(res, req, &form) {
+		return
+	}
+
+	if form.AssigneeID == "" {
+		s.writeBadRequest(res, "missing assignee ID")
+		return
+	}
+
+	s.assignTask(res, req, form.AssigneeID)
+}
+
+// handleUnassignTask handles the "PATCH /task/{taskID}/unassign" endpoint and
+// removes the assignee of a task.
+func (s *WebServer) handleUnassignTask(res http.ResponseWriter, req *http.Request) {
+	s.assignTask(res, req, "")
+}
+
+// assignTask sets the assignee of the task in the request URL.
+func (s *WebServer) assignTask(res http.ResponseWriter, req *http.Request, assigneeID string) {
+	taskID := chi.URLParam(req, "taskID")
+	userID := s.reqUserID(req)
+	tasks, err := s.taskDB.AssignTask(userID, taskID, assigneeID)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.AssignTask error: %w", err))
+		}
+		return
+	}
+
+	s.publishTaskEvent(TaskUpdatedEvent, taskID, tasks)
+
+	s.writeSuccess(res, map[string]any{
+		"tasks": tasks,
+	})
+}
+
+// handleRetrieveTaskHistory handles the "GET /task/{taskID}/history" endpoint
+// and returns the changes made to a task.
+func (s *WebServer) handleRetrieveTaskHistory(res http.ResponseWriter, req *http.Request) {
+	taskID := chi.URLParam(req, "taskID")
+	userID := s.reqUserID(req)
+	history, err := s.taskDB.TaskHistory(userID, taskID)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.TaskHistory error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"history": history,
+	})
+}
+
+// completedFilter returns the completed status that matches a valid "status"
+// query parameter, or nil if status is empty.
+func completedFilter(status string) *bool {
+	if status == "" {
+		return nil
+	}
+	completed := strings.EqualFold(status, completedTasksFilter)
+	return &completed
+}
+
+// scopedTasks returns the tasks of the user with the provided userID in one
+// of ownTasksScope, sharedTasksScope or assignedTasksScope. Only tasks with
+// the completed status are returned if it is not nil.
+func (s *WebServer) scopedTasks(userID, scope string, completed *bool) ([]*db.Task, error) {
+	var tasks []*db.Task
+	var err error
+	var methodName string
+	switch scope {
+	case sharedTasksScope:
+		methodName = "taskDB.SharedTasks"
+		tasks, err = s.taskDB.SharedTasks(userID, completed)
+	case assignedTasksScope:
+		methodName = "taskDB.AssignedTasks"
+		tasks, err = s.taskDB.AssignedTasks(userID, completed)
+	default:
+		if completed != nil {
+			methodName = "taskDB.TasksWithStatus"
+			tasks, err = s.taskDB.TasksWithStatus(userID, *completed)
+		} else {
+			methodName = "taskDB.Tasks"
+			tasks, err = s.taskDB.Tasks(userID)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s error: %w", methodName, err)
+	}
+
+	return tasks, nil
+}
+
+// filterTasks returns the tasks in the provided project and with the
+// provided tag. A nil project or tag matches all tasks, and an empty project
+// matches the tasks without a project.
+func filterTasks(tasks []*db.Task, project, tag *string) []*db.Task {
+	filteredTasks := make([]*db.Task, 0, len(tasks))
+	for _, task := range tasks {
+		if project != nil && task.Project != *project {
+			continue
+		}
+		if tag != nil && !hasTag(task, *tag) {
+			continue
+		}
+		filteredTasks = append(filteredTasks, task)
+	}
+	return filteredTasks
+}
@@ -0,0 +1,91 @@
+package webserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+// tasksDB is a TaskDatabase that returns a task named after the method that
+// retrieved it and the completed filter it was called with.
+type tasksDB struct {
+	authDB
+}
+
+func (tasksDB) Tasks(userID string) ([]*db.Task, error) {
+	return []*db.Task{{ID: "Tasks"}}, nil
+}
+
+func (tasksDB) TasksWithStatus(userID string, completed bool) ([]*db.Task, error) {
+	return []*db.Task{{ID: "TasksWithStatus " + completedName(&completed)}}, nil
+}
+
+func (tasksDB) SharedTasks(userID string, completed *bool) ([]*db.Task, error) {
+	return []*db.Task{{ID: "SharedTasks " + completedName(completed)}}, nil
+}
+
+func (tasksDB) AssignedTasks(userID string, completed *bool) ([]*db.Task, error) {
+	return []*db.Task{{ID: "AssignedTasks " + completedName(completed)}}, nil
+}
+
+// completedName returns the name of a completed filter.
+func completedName(completed *bool) string {
+	switch {
+	case completed == nil:
+		return "all"
+	case *completed:
+		return "completed"
+	default:
+		return "pending"
+	}
+}
+
+func TestRetrieveTasks(t *testing.T) {
+	s := newTestServer(t, tasksDB{authDB{roles: map[string]string{"user": db.RoleUser}}}, nil)
+
+	token, err := s.jwtManager.GenerateJWtToken("user", db.RoleUser, "session", time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateJWtToken error: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantTasks  string
+	}{
+		{"own tasks", "", http.StatusOK, "Tasks"},
+		{"own pending tasks", "?status=pending", http.StatusOK, "TasksWithStatus pending"},
+		{"shared tasks", "?scope=shared", http.StatusOK, "SharedTasks all"},
+		{"shared completed tasks", "?scope=SHARED&status=completed", http.StatusOK, "SharedTasks completed"},
+		{"unknown scope", "?scope=public", http.StatusBadRequest, ""},
+		{"unknown status", "?scope=shared&status=done", http.StatusBadRequest, ""},
+		{"assigned tasks", "?assignee=me", http.StatusOK, "AssignedTasks all"},
+		{"assigned pending tasks", "?assignee=ME&status=pending", http.StatusOK, "AssignedTasks pending"},
+		{"tasks assigned to another user", "?assignee=user", http.StatusBadRequest, ""},
+		{"assignee with scope", "?assignee=me&scope=shared", http.StatusBadRequest, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := testRequest(t, s, http.MethodGet, "/tasks"+test.query, token, nil)
+			checkStatus(t, res, test.wantStatus)
+			if test.wantTasks == "" {
+				return
+			}
+
+			var body struct {
+				Tasks []*db.Task `json:"tasks"`
+			}
+			if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+				t.Fatalf("json.Unmarshal error: %v", err)
+			}
+			if len(body.Tasks) != 1 || body.Tasks[0].ID != test.wantTasks {
+				t.Fatalf("want tasks from %s, got %s", test.wantTasks, res.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package webserver
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ukane-philemon/megtask/db"
+	"github.com/ukane-philemon/megtask/totp"
+)
+
+const (
+	// totpIssuer is the issuer shown in authenticator apps.
+	totpIssuer = "Megtask"
+	// numRecoveryCodes is the number of recovery codes issued when two-factor
+	// authentication is enabled.
+	numRecoveryCodes = 10
+)
+
+// handleSetupTwoFactor handles the "POST /2fa/setup" endpoint and returns a
+// new TOTP secret and otpauth:// URI for the user. Two-factor authentication
+// is not enabled until the secret is confirmed with "POST /2fa/enable".
+func (s *WebServer) handleSetupTwoFactor(res http.ResponseWriter, req *http.Request) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("totp.GenerateSecret error: %w", err))
+		return
+	}
+
+	userID := s.reqUserID(req)
+	username, err := s.taskDB.SetupTOTP(userID, secret)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.SetupTOTP error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]string{
+		"secret":     secret,
+		"otpauthURI": totp.URI(totpIssuer, username, secret),
+		"message":    "Add the secret to your authenticator app and confirm it with a code to enable two-factor authentication.",
+	})
+}
+
+// handleEnableTwoFactor handles the "POST /2fa/enable" endpoint and enables
+// two-factor authentication if a valid code for the secret from
+// "POST /2fa/setup" is provided. Recovery codes are returned and are not
+// shown again.
+func (s *WebServer) handleEnableTwoFactor(res http.ResponseWriter, req *http.Request) {
+	form := new(twoFactorCodeRequest)
+	if !s.readPostBody(res, req, &form) {
+		return
+	}
+
+	if form.Code == "" {
+		s.writeBadRequest(res, "missing two-factor authentication code")
+		return
+	}
+
+	recoveryCodes, err := generateRecoveryCodes()
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("generateRecoveryCodes error: %w", err))
+		return
+	}
+
+	userID := s.reqUserID(req)
+	err = s.taskDB.EnableTOTP(userID, normalizeTwoFactorCode(form.Code), recoveryCodes)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.EnableTOTP error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"recoveryCodes": recoveryCodes,
+		"message":       "Two-factor authentication enabled. Store your recovery codes safely, they will not be shown again.",
+	})
+}
+
+// handleDisableTwoFactor handles the "POST /2fa/disable" endpoint and disables
+// two-factor authentication if a valid TOTP or recovery code is provided.
+func (s *WebServer) handleDisableTwoFactor(res http.ResponseWriter, req *http.Request) {
+	form := new(twoFactorCodeRequest)
+	if !s.readPostBody(res, req, &form) {
+		return
+	}
+
+	if form.Code == "" {
+		s.writeBadRequest(res, "missing two-factor authentication code")
+		return
+	}
+
+	userID := s.reqUserID(req)
+	err := s.taskDB.DisableTOTP(userID, normalizeTwoFactorCode(form.Code))
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.DisableTOTP error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]string{
+		"message": "Two-factor authentication disabled.",
+	})
+}
+
+// handleTwoFactorLogin handles the "POST /login/2fa" endpoint and completes
+// the login of a user with two-factor authentication enabled using the
+// challenge token returned by "POST /login".
+func (s *WebServer) handleTwoFactorLogin(res http.ResponseWriter, req *http.Request) {
+	form := new(twoFactorLoginRequest)
+	if !s.readPostBody(res, req, &form) {
+		return
+	}
+
+	if form.ChallengeToken == "" || form.Code == "" {
+		s.writeBadRequest(res, "missing challenge token or two-factor authentication code")
+		return
+	}
+
+	err := validateDeviceLabel(form.DeviceLabel)
+	if err != nil {
+		s.writeBadRequest(res, err.Error())
+		return
+	}
+
+	userID, validToken := s.jwtManager.IsValidChallengeToken(form.ChallengeToken)
+	if !validToken {
+		s.writeJSONResponse(res, http.StatusUnauthorized, map[string]string{
+			"errorMessage": "invalid or expired challenge token, please login again",
+		})
+		return
+	}
+
+	// Two-factor codes are short, so attempts are throttled like passwords.
+	twoFactorKey, ipKey := twoFactorLoginKey(userID), ipLoginKey(req)
+	wait, err := s.loginThrottle.reserveAttempt(map[string]int{
+		twoFactorKey: s.loginThrottle.maxFailures,
+		ipKey:        s.loginThrottle.maxFailuresIP,
+	})
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("loginThrottle.reserveAttempt error: %w", err))
+		return
+	}
+
+	if wait > 0 {
+		s.writeTooManyRequests(res, wait)
+		return
+	}
+
+	userInfo, err := s.taskDB.VerifyTwoFactor(userID, normalizeTwoFactorCode(form.Code))
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			if err := s.loginThrottle.refundAttempt(twoFactorKey, ipKey); err != nil {
+				s.log.Error("failed to refund two-factor login attempt: ", "error", err)
+			}
+			s.writeServerError(res, fmt.Errorf("taskDB.VerifyTwoFactor error: %w", err))
+		}
+		return
+	}
+
+	err = s.loginThrottle.store.ResetLoginAttempts(twoFactorKey)
+	if err != nil {
+		s.log.Error("failed to reset failed two-factor logins: ", "error", err)
+	}
+	err = s.loginThrottle.refundAttempt(ipKey)
+	if err != nil {
+		s.log.Error("failed to refund two-factor login attempt: ", "error", err)
+	}
+
+	s.writeLoginSuccess(res, req, userInfo, form.DeviceLabel)
+}
+
+// generateRecoveryCodes returns new random recovery codes.
+func generateRecoveryCodes() ([]string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	recoveryCodes := make([]string, 0, numRecoveryCodes)
+	for i := 0; i < numRecoveryCodes; i++ {
+		b := make([]byte, 10)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, fmt.Errorf("rand.Read error: %w", err)
+		}
+
+		code := strings.ToLower(encoding.EncodeToString(b))
+		recoveryCodes = append(recoveryCodes, code[:8]+"-"+code[8:])
+	}
+	return recoveryCodes, nil
+}
+
+// normalizeTwoFactorCode removes surrounding whitespace from a TOTP or
+// recovery code and lowercases it since recovery codes are issued in
+// lowercase.
+func normalizeTwoFactorCode(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
@@ -0,0 +1,85 @@
+package webserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+// twoFactorDB is a TaskDatabase that accepts each of the codes in codes once
+// for every user.
+type twoFactorDB struct {
+	TaskDatabase
+	codes map[string]bool
+}
+
+func (tdb twoFactorDB) VerifyTwoFactor(userID, code string) (*db.User, error) {
+	if !tdb.codes[code] {
+		return nil, db.ErrorInvalidRequest
+	}
+	delete(tdb.codes, code)
+	return &db.User{ID: userID, Username: "user", Role: db.RoleUser, TwoFactorEnabled: true}, nil
+}
+
+func (twoFactorDB) CreateSession(userID, deviceLabel, userAgent, ip string, expiry time.Duration) (*db.Session, error) {
+	return &db.Session{ID: "session"}, nil
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	s := newTestServer(t, twoFactorDB{codes: map[string]bool{"123456": true, "abcd-efgh": true}}, nil)
+
+	challengeToken, err := s.jwtManager.GenerateChallengeToken("user")
+	if err != nil {
+		t.Fatalf("GenerateChallengeToken error: %v", err)
+	}
+	authToken, err := s.jwtManager.GenerateJWtToken("user", db.RoleUser, "session", time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateJWtToken error: %v", err)
+	}
+
+	// The tests share the codes and run in order.
+	tests := []struct {
+		name           string
+		challengeToken string
+		code           string
+		wantStatus     int
+	}{
+		{"missing code", challengeToken, "", http.StatusBadRequest},
+		{"missing challenge token", "", "123456", http.StatusBadRequest},
+		{"invalid challenge token", "invalid", "123456", http.StatusUnauthorized},
+		{"auth token as challenge token", authToken, "123456", http.StatusUnauthorized},
+		{"wrong code", challengeToken, "654321", http.StatusBadRequest},
+		{"valid code", challengeToken, "123456", http.StatusOK},
+		{"replayed code", challengeToken, "123456", http.StatusBadRequest},
+		{"recovery code", challengeToken, " ABCD-EFGH ", http.StatusOK},
+		{"used recovery code", challengeToken, "abcd-efgh", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := testRequest(t, s, http.MethodPost, "/login/2fa", "", map[string]string{
+				"challengeToken": test.challengeToken,
+				"code":           test.code,
+			})
+			checkStatus(t, res, test.wantStatus)
+			if test.wantStatus != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				AuthToken string `json:"authToken"`
+			}
+			if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+				t.Fatalf("json.Unmarshal error: %v", err)
+			}
+
+			claims, valid := s.jwtManager.IsValidToken(body.AuthToken)
+			if !valid || claims.ID != "user" {
+				t.Fatalf("want an auth token for user, got %s", res.Body.String())
+			}
+		})
+	}
+}
@@ -3,7 +3,14 @@ package webserver
 import (
 	"errors"
 	"fmt"
+	"net/mail"
+	"net/url"
 	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/teambition/rrule-go"
+	"github.com/ukane-philemon/megtask/db"
 )
 
 var usernameRegex = regexp.MustCompile("^[a-zA-Z0-9]+$")
@@ -15,31 +22,735 @@ type usernameAndPassword struct {
 	Password string `json:"password"`
 }
 
-// Validate ensures valid data is provided in createAccountRequest.
+// Validate ensures valid data is provided in usernameAndPassword. New
+// passwords must also satisfy the server's PasswordPolicy.
 func (caq *usernameAndPassword) Validate() error {
 	// Username cannot contain special characters.
 	if caq.Username == "" || !usernameRegex.MatchString(caq.Username) {
 		return errors.New("username can only contain alphanumeric characters")
 	}
 
-	const maxPassLength, minPassLength = 72, 6
+	if caq.Password == "" || len(caq.Password) > maxPasswordLength {
+		return fmt.Errorf("password is required and must be less than %d characters", maxPasswordLength)
+	}
+
+	return nil
+}
+
+// validateEmail ensures email is a plain email address without a display
+// name.
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return errors.New("invalid email address")
+	}
+	return nil
+}
+
+// maxDeviceLabelLength is the maximum length of a session's device label.
+const maxDeviceLabelLength = 100
 
-	passLen := len(caq.Password)
-	if passLen < minPassLength || passLen > maxPassLength {
-		return fmt.Errorf("password must be more than %d characters but less than %d characters", minPassLength, maxPassLength)
+// loginRequest is information required to login an existing user.
+type loginRequest struct {
+	usernameAndPassword
+	// DeviceLabel is a name for the device the user is logging in from, e.g
+	// "Work laptop".
+	DeviceLabel string `json:"deviceLabel"` // optional
+}
+
+// Validate ensures valid data is provided in loginRequest.
+func (lr *loginRequest) Validate() error {
+	err := lr.usernameAndPassword.Validate()
+	if err != nil {
+		return err
 	}
+	return validateDeviceLabel(lr.DeviceLabel)
+}
 
+// validateDeviceLabel ensures a session's device label is not too long.
+func validateDeviceLabel(deviceLabel string) error {
+	if len(deviceLabel) > maxDeviceLabelLength {
+		return fmt.Errorf("device label must be less than %d characters", maxDeviceLabelLength)
+	}
 	return nil
 }
 
+// createAccountRequest is information required to create a new account. Email
+// is optional but is required to reset a forgotten password.
+type createAccountRequest struct {
+	usernameAndPassword
+	Email string `json:"email"` // optional
+}
+
+// Validate ensures valid data is provided in createAccountRequest.
+func (car *createAccountRequest) Validate() error {
+	err := car.usernameAndPassword.Validate()
+	if err != nil {
+		return err
+	}
+
+	if car.Email == "" {
+		return nil
+	}
+
+	car.Email = strings.ToLower(strings.TrimSpace(car.Email))
+	return validateEmail(car.Email)
+}
+
+// emailRequest is information required to request an email (e.g a password
+// reset token) be sent to an account's email.
+type emailRequest struct {
+	Email string `json:"email"`
+}
+
+// confirmPasswordResetRequest is information required to set a new password
+// with a password reset token.
+type confirmPasswordResetRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
 // createTaskRequest is information required to create new task.
 type createTaskRequest struct {
 	TaskDetail string `json:"taskDetail"`
+	Project    string `json:"project"` // optional
+	// DueAt is when the task is due, in unix seconds. Optional.
+	DueAt int64    `json:"dueAt"`
+	Tags  []string `json:"tags"` // optional
+	// Recurrence is an optional RFC 5545 recurrence rule that repeats the
+	// task from its due date.
+	Recurrence string `json:"recurrence"`
 }
 
-// updateTaskRequest is information that may be provided to update a task. Both cannot
-// be empty.
+// Validate validates the create task request and removes duplicate tags.
+func (ctr *createTaskRequest) Validate() error {
+	if ctr.TaskDetail == "" {
+		return errors.New("missing task detail")
+	}
+
+	if err := validateProject(ctr.Project); err != nil {
+		return err
+	}
+
+	if err := validateDueAt(ctr.DueAt); err != nil {
+		return err
+	}
+
+	tags, err := validateTags(ctr.Tags)
+	if err != nil {
+		return err
+	}
+	ctr.Tags = tags
+
+	if err := validateRecurrence(ctr.Recurrence); err != nil {
+		return err
+	}
+
+	if ctr.Recurrence != "" && ctr.DueAt == 0 {
+		return errors.New("a recurring task must have a due date")
+	}
+
+	return nil
+}
+
+// updateTaskRequest is information that may be provided to update a task. All
+// cannot be empty.
 type updateTaskRequest struct {
 	TaskDetail      string `json:"taskDetail"` // optional
 	MarkAsCompleted bool   `json:"markAsCompleted"`
+	// Project is optional and an empty string removes the task from its
+	// project.
+	Project *string `json:"project"`
+	// DueAt is optional and zero removes the due date of the task.
+	DueAt *int64 `json:"dueAt"`
+	// Tags is optional and an empty list removes the tags of the task.
+	Tags *[]string `json:"tags"`
+	// Recurrence is optional and an empty string stops the task from
+	// recurring.
+	Recurrence *string `json:"recurrence"`
+}
+
+// Validate validates the update task request and removes duplicate tags.
+func (utr *updateTaskRequest) Validate() error {
+	if utr.TaskDetail == "" && !utr.MarkAsCompleted && utr.Project == nil && utr.DueAt == nil && utr.Tags == nil && utr.Recurrence == nil {
+		return errors.New("missing required data")
+	}
+
+	if utr.Project != nil {
+		if err := validateProject(*utr.Project); err != nil {
+			return err
+		}
+	}
+
+	if utr.DueAt != nil {
+		if err := validateDueAt(*utr.DueAt); err != nil {
+			return err
+		}
+	}
+
+	if utr.Tags != nil {
+		tags, err := validateTags(*utr.Tags)
+		if err != nil {
+			return err
+		}
+		utr.Tags = &tags
+	}
+
+	if utr.Recurrence != nil {
+		if err := validateRecurrence(*utr.Recurrence); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// taskUpdate returns the changes to make to the task.
+func (utr *updateTaskRequest) taskUpdate() *db.TaskUpdate {
+	taskUpdate := &db.TaskUpdate{
+		Detail:     utr.TaskDetail,
+		Project:    utr.Project,
+		DueAt:      utr.DueAt,
+		Tags:       utr.Tags,
+		Recurrence: utr.Recurrence,
+	}
+	if utr.MarkAsCompleted {
+		taskUpdate.MarkAsComplete = &utr.MarkAsCompleted
+	}
+	return taskUpdate
+}
+
+// assignTaskRequest is information required to assign a task to a user.
+type assignTaskRequest struct {
+	AssigneeID string `json:"assigneeID"`
+}
+
+// maxCommentLength is the maximum length of a comment body.
+const maxCommentLength = 10000
+
+// commentRequest is information required to add or update a comment on a
+// task. ParentID is only used when adding a comment.
+type commentRequest struct {
+	ParentID string `json:"parentID"` // optional
+	Body     string `json:"body"`
+}
+
+// Validate validates the comment request.
+func (cr *commentRequest) Validate() error {
+	if strings.TrimSpace(cr.Body) == "" {
+		return errors.New("missing comment body")
+	}
+	if len(cr.Body) > maxCommentLength {
+		return fmt.Errorf("comment must be less than %d characters", maxCommentLength)
+	}
+	return nil
+}
+
+// maxProjectLength is the maximum length of a project name.
+const maxProjectLength = 64
+
+// validateProject checks that project is a valid project name. An empty
+// project is valid.
+func validateProject(project string) error {
+	if len(project) > maxProjectLength {
+		return fmt.Errorf("project must be less than %d characters", maxProjectLength)
+	}
+	if strings.TrimSpace(project) != project {
+		return errors.New("project cannot start or end with a space")
+	}
+	return nil
+}
+
+// maxDueAt is the latest due date a task can have, 9999-12-31T23:59:59Z. Larger
+// values are most likely milliseconds.
+const maxDueAt = 253402300799
+
+// validateDueAt checks that dueAt is a unix time in seconds. Zero means no due
+// date.
+func validateDueAt(dueAt int64) error {
+	if dueAt < 0 || dueAt > maxDueAt {
+		return errors.New("dueAt must be a unix time in seconds")
+	}
+	return nil
+}
+
+const (
+	// maxTags is the maximum number of tags a task can have.
+	maxTags = 20
+	// maxTagLength is the maximum length of a tag.
+	maxTagLength = 32
+)
+
+// validateTags checks that tags are valid and returns them without
+// duplicates.
+func validateTags(tags []string) ([]string, error) {
+	if len(tags) > maxTags {
+		return nil, fmt.Errorf("a task cannot have more than %d tags", maxTags)
+	}
+
+	seen := make(map[string]bool, len(tags))
+	validTags := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag == "" || len(tag) > maxTagLength {
+			return nil, fmt.Errorf("tags must be between 1 and %d characters", maxTagLength)
+		}
+		if strings.TrimSpace(tag) != tag {
+			return nil, errors.New("tags cannot start or end with a space")
+		}
+		// Commas separate the values of the CATEGORIES property in calendar
+		// feeds.
+		if strings.Contains(tag, ",") {
+			return nil, errors.New("tags cannot contain a comma")
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			validTags = append(validTags, tag)
+		}
+	}
+
+	return validTags, nil
+}
+
+// maxRecurrenceLength is the maximum length of a recurrence rule.
+const maxRecurrenceLength = 256
+
+// recurrenceRuleParts are the RFC 5545 recurrence rule parts a task's
+// recurrence can have.
+var recurrenceRuleParts = map[string]bool{
+	"FREQ":       true,
+	"UNTIL":      true,
+	"COUNT":      true,
+	"INTERVAL":   true,
+	"BYDAY":      true,
+	"BYMONTHDAY": true,
+	"BYYEARDAY":  true,
+	"BYWEEKNO":   true,
+	"BYMONTH":    true,
+	"BYSETPOS":   true,
+	"WKST":       true,
+}
+
+// recurrenceFrequencies are the frequencies a task can recur at.
+var recurrenceFrequencies = map[string]bool{
+	"DAILY":   true,
+	"WEEKLY":  true,
+	"MONTHLY": true,
+	"YEARLY":  true,
+}
+
+// validateRecurrence checks that recurrence is an RFC 5545 recurrence rule
+// without the "RRULE:" prefix, e.g "FREQ=WEEKLY;BYDAY=MO,WE", that the next
+// occurrences of a task can be created from. An empty recurrence is valid.
+func validateRecurrence(recurrence string) error {
+	if recurrence == "" {
+		return nil
+	}
+
+	if len(recurrence) > maxRecurrenceLength {
+		return fmt.Errorf("recurrence must be less than %d characters", maxRecurrenceLength)
+	}
+
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(recurrence, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || !recurrenceRuleParts[name] || seen[name] {
+			return fmt.Errorf("invalid recurrence rule part %q", part)
+		}
+		seen[name] = true
+
+		// Values are limited to the characters used by the allowed parts, so
+		// the rule can be written to calendar feeds as is.
+		if value == "" || strings.Trim(value, "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789,+-") != "" {
+			return fmt.Errorf("invalid recurrence rule part %q", part)
+		}
+
+		if name == "FREQ" && !recurrenceFrequencies[value] {
+			return errors.New("recurrence frequency must be DAILY, WEEKLY, MONTHLY or YEARLY")
+		}
+	}
+
+	if !seen["FREQ"] {
+		return errors.New("recurrence must have a FREQ")
+	}
+
+	if seen["UNTIL"] && seen["COUNT"] {
+		return errors.New("recurrence cannot have both UNTIL and COUNT")
+	}
+
+	opts, err := rrule.StrToROption(recurrence)
+	if err == nil {
+		_, err = rrule.NewRRule(*opts)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid recurrence rule: %v", err)
+	}
+
+	return nil
+}
+
+// maxReminderOffset is the maximum number of seconds before the due date of a
+// task a reminder can be sent.
+const maxReminderOffset = 365 * 24 * 60 * 60
+
+// reminderRequest is information required to set a reminder on a task. Only
+// one of RemindAt or Offset can be provided.
+type reminderRequest struct {
+	// RemindAt is when the reminder is sent, in unix seconds.
+	RemindAt int64 `json:"remindAt"`
+	// Offset is the number of seconds before the due date of the task the
+	// reminder is sent. The reminder moves with the due date.
+	Offset *int64 `json:"offset"`
+}
+
+// Validate ensures valid data is provided in reminderRequest.
+func (rr *reminderRequest) Validate() error {
+	if (rr.RemindAt == 0) == (rr.Offset == nil) {
+		return errors.New("either remindAt or offset is required")
+	}
+
+	if rr.Offset != nil {
+		if *rr.Offset < 0 || *rr.Offset > maxReminderOffset {
+			return fmt.Errorf("offset must be between 0 and %d seconds", maxReminderOffset)
+		}
+		return nil
+	}
+
+	return validateDueAt(rr.RemindAt)
+}
+
+// shareRequest is information required to share a task or a project with
+// another user.
+type shareRequest struct {
+	TaskID     string `json:"taskID"`
+	Project    string `json:"project"`
+	Username   string `json:"username"`
+	Permission string `json:"permission"`
+}
+
+// Validate validates the share request.
+func (sr *shareRequest) Validate() error {
+	if (sr.TaskID == "") == (sr.Project == "") {
+		return errors.New("provide either a taskID or a project to share")
+	}
+
+	if sr.Username == "" {
+		return errors.New("missing username")
+	}
+
+	if sr.Permission != db.PermissionRead && sr.Permission != db.PermissionEdit {
+		return fmt.Errorf(`permission can either be "%s" or "%s"`, db.PermissionRead, db.PermissionEdit)
+	}
+
+	return validateProject(sr.Project)
+}
+
+// changePasswordRequest is information required to change the password of a
+// logged in user.
+type changePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// twoFactorCodeRequest is information required to confirm a two-factor
+// authentication action.
+type twoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// twoFactorLoginRequest is information required to complete a login for a
+// user with two-factor authentication enabled.
+type twoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`        // TOTP or recovery code
+	DeviceLabel    string `json:"deviceLabel"` // optional
+}
+
+// createAPITokenRequest is information required to create a personal access
+// token.
+type createAPITokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresInDays is the number of days until the token expires. The token
+	// never expires if zero.
+	ExpiresInDays int `json:"expiresInDays"` // optional
+}
+
+// Validate ensures valid data is provided in createAPITokenRequest.
+func (ctr *createAPITokenRequest) Validate() error {
+	const maxNameLength, maxExpiryDays = 100, 365
+
+	ctr.Name = strings.TrimSpace(ctr.Name)
+	if ctr.Name == "" || len(ctr.Name) > maxNameLength {
+		return fmt.Errorf("token name is required and must be less than %d characters", maxNameLength)
+	}
+
+	if len(ctr.Scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+
+	for _, scope := range ctr.Scopes {
+		if !validAPITokenScopes[scope] {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+
+	if ctr.ExpiresInDays < 0 || ctr.ExpiresInDays > maxExpiryDays {
+		return fmt.Errorf("expiresInDays must be between 0 and %d", maxExpiryDays)
+	}
+
+	return nil
+}
+
+// createFeedTokenRequest is information required to create a calendar feed
+// token.
+type createFeedTokenRequest struct {
+	Name string `json:"name"`
+}
+
+// Validate ensures valid data is provided in createFeedTokenRequest.
+func (cfr *createFeedTokenRequest) Validate() error {
+	const maxNameLength = 100
+
+	cfr.Name = strings.TrimSpace(cfr.Name)
+	if cfr.Name == "" || len(cfr.Name) > maxNameLength {
+		return fmt.Errorf("feed name is required and must be less than %d characters", maxNameLength)
+	}
+
+	return nil
+}
+
+// maxWorkspaceNameLength is the maximum length of a workspace name.
+const maxWorkspaceNameLength = 64
+
+// createWorkspaceRequest is information required to create a workspace.
+type createWorkspaceRequest struct {
+	Name string `json:"name"`
+}
+
+// Validate validates the create workspace request.
+func (cw *createWorkspaceRequest) Validate() error {
+	cw.Name = strings.TrimSpace(cw.Name)
+	if cw.Name == "" {
+		return errors.New("missing workspace name")
+	}
+	if len(cw.Name) > maxWorkspaceNameLength {
+		return fmt.Errorf("workspace name must be less than %d characters", maxWorkspaceNameLength)
+	}
+	return nil
+}
+
+// workspaceInvitationRequest is information required to invite a user to a
+// workspace.
+type workspaceInvitationRequest struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// Validate validates the workspace invitation request.
+func (wi *workspaceInvitationRequest) Validate() error {
+	if wi.Username == "" {
+		return errors.New("missing username")
+	}
+	if wi.Role != db.WorkspaceRoleMember && wi.Role != db.WorkspaceRoleViewer {
+		return fmt.Errorf(`role can either be "%s" or "%s"`, db.WorkspaceRoleMember, db.WorkspaceRoleViewer)
+	}
+	return nil
+}
+
+// webhookRequest is information required to create a webhook. All events are
+// sent if Events is empty and a secret is generated if Secret is empty.
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+}
+
+// Validate ensures valid data is provided in webhookRequest.
+func (wr *webhookRequest) Validate() error {
+	webhookURL, err := url.Parse(wr.URL)
+	if err != nil || (webhookURL.Scheme != "https" && webhookURL.Scheme != "http") || webhookURL.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+
+	if webhookURL.User != nil {
+		return errors.New("url cannot contain credentials, use the secret to verify deliveries")
+	}
+
+	if len(wr.URL) > maxWebhookURLLength {
+		return fmt.Errorf("url must be less than %d characters", maxWebhookURLLength)
+	}
+
+	for _, event := range wr.Events {
+		if !slices.Contains(webhookEvents, event) {
+			return fmt.Errorf("unknown event %q, events can be %s", event, strings.Join(webhookEvents, ", "))
+		}
+	}
+
+	if wr.Secret != "" && (len(wr.Secret) < minWebhookSecretLength || len(wr.Secret) > maxWebhookSecretLength) {
+		return fmt.Errorf("secret must be between %d and %d characters", minWebhookSecretLength, maxWebhookSecretLength)
+	}
+
+	return nil
+}
+
+// maxSyncChanges is the maximum number of changes in a sync request.
+const maxSyncChanges = 100
+
+// maxSyncClientIDLength is the maximum length of the client ID of a task
+// created offline.
+const maxSyncClientIDLength = 64
+
+// syncRequest is a batch of changes made by a client while it was offline.
+type syncRequest struct {
+	Changes []*db.SyncChange `json:"changes"`
+}
+
+// Validate ensures every change in syncRequest has the fields required by
+// its action and removes duplicate tags.
+func (sr *syncRequest) Validate() error {
+	if len(sr.Changes) == 0 || len(sr.Changes) > maxSyncChanges {
+		return fmt.Errorf("changes are required and must be less than %d", maxSyncChanges+1)
+	}
+
+	for i, change := range sr.Changes {
+		if change == nil {
+			return fmt.Errorf("change %d: missing change", i)
+		}
+
+		if change.ModifiedAt <= 0 {
+			return fmt.Errorf("change %d: missing modifiedAt", i)
+		}
+
+		switch change.Action {
+		case db.SyncActionCreate:
+			if change.ClientID == "" || len(change.ClientID) > maxSyncClientIDLength {
+				return fmt.Errorf("change %d: clientID is required and must be less than %d characters", i, maxSyncClientIDLength)
+			}
+			if change.Detail == nil || *change.Detail == "" {
+				return fmt.Errorf("change %d: missing task detail", i)
+			}
+			if change.Recurrence != nil && *change.Recurrence != "" && (change.DueAt == nil || *change.DueAt == 0) {
+				return fmt.Errorf("change %d: a recurring task must have a due date", i)
+			}
+		case db.SyncActionUpdate:
+			if change.TaskID == "" {
+				return fmt.Errorf("change %d: missing task ID", i)
+			}
+			if change.Detail == nil && change.Completed == nil && change.Project == nil && change.DueAt == nil && change.Tags == nil && change.Recurrence == nil {
+				return fmt.Errorf("change %d: missing required data", i)
+			}
+			if change.Detail != nil && *change.Detail == "" {
+				return fmt.Errorf("change %d: task detail cannot be empty", i)
+			}
+			if change.Completed != nil && !*change.Completed {
+				return fmt.Errorf("change %d: completed tasks cannot be updated back to pending", i)
+			}
+		case db.SyncActionDelete:
+			if change.TaskID == "" {
+				return fmt.Errorf("change %d: missing task ID", i)
+			}
+		default:
+			return fmt.Errorf("change %d: action can be %q, %q or %q", i, db.SyncActionCreate, db.SyncActionUpdate, db.SyncActionDelete)
+		}
+
+		if change.Project != nil {
+			if err := validateProject(*change.Project); err != nil {
+				return fmt.Errorf("change %d: %w", i, err)
+			}
+		}
+
+		if change.DueAt != nil {
+			if err := validateDueAt(*change.DueAt); err != nil {
+				return fmt.Errorf("change %d: %w", i, err)
+			}
+		}
+
+		if change.Tags != nil {
+			tags, err := validateTags(*change.Tags)
+			if err != nil {
+				return fmt.Errorf("change %d: %w", i, err)
+			}
+			change.Tags = &tags
+		}
+
+		if change.Recurrence != nil {
+			if err := validateRecurrence(*change.Recurrence); err != nil {
+				return fmt.Errorf("change %d: %w", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// wsCommand is a message sent by a client over a WebSocket connection. ID is
+// chosen by the client and is returned in the acknowledgement of the command.
+type wsCommand struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// Scope and Project are used by subscribe and unsubscribe commands.
+	Scope   string `json:"scope"`
+	Project string `json:"project"`
+	// TaskID and TaskDetail are used by task commands. Project is also used
+	// to set the project of a created or updated task.
+	TaskID     string `json:"taskID"`
+	TaskDetail string `json:"taskDetail"`
+}
+
+// Validate ensures the fields required by the type of the command are
+// provided.
+func (wc *wsCommand) Validate() error {
+	if wc.ID == "" || len(wc.ID) > maxWSCommandIDLength {
+		return fmt.Errorf("command id is required and must be less than %d characters", maxWSCommandIDLength)
+	}
+
+	switch wc.Type {
+	case wsSubscribeCommand, wsUnsubscribeCommand:
+		switch wc.Scope {
+		case wsTasksScope:
+		case wsProjectScope:
+			if wc.Project == "" {
+				return errors.New("missing project")
+			}
+		default:
+			return fmt.Errorf("scope can either be %q or %q", wsTasksScope, wsProjectScope)
+		}
+	case wsCreateTaskCommand:
+		if wc.TaskDetail == "" {
+			return errors.New("missing task detail")
+		}
+	case wsUpdateTaskCommand:
+		if wc.TaskID == "" || wc.TaskDetail == "" {
+			return errors.New("missing task ID or task detail")
+		}
+	case wsCompleteTaskCommand:
+		if wc.TaskID == "" {
+			return errors.New("missing task ID")
+		}
+	default:
+		return fmt.Errorf("unknown command type %q", wc.Type)
+	}
+
+	return validateProject(wc.Project)
+}
+
+// wsMessage is a message sent to a client over a WebSocket connection.
+type wsMessage struct {
+	Type string `json:"type"`
+	// ID, OK and Error are set on acknowledgements.
+	ID    string `json:"id,omitempty"`
+	OK    bool   `json:"ok,omitempty"`
+	Error string `json:"error,omitempty"`
+	// Tasks is the list of tasks the changed task belongs to and is set on
+	// acknowledgements of task commands.
+	Tasks []*db.Task `json:"tasks,omitempty"`
+	// Event is set on event messages.
+	Event *TaskEvent `json:"event,omitempty"`
+}
+
+// graphQLQueryRequest is a GraphQL request.
+type graphQLQueryRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
 }
@@ -1,10 +1,34 @@
 package webserver
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
 )
 
+// randomToken returns a hex encoded random token that is suitable for use as
+// a secret.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("rand.Read error: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// reqIP returns the IP address of the client that sent req.
+func reqIP(req *http.Request) string {
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return ip
+}
+
 // readPostBody reads the request body into body.
 func (s *WebServer) readPostBody(res http.ResponseWriter, req *http.Request, body any) bool {
 	err := json.NewDecoder(req.Body).Decode(body)
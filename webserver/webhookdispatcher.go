@@ -0,0 +1,223 @@
+package webserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+const (
+	// webhookWorkers is the number of deliveries sent concurrently.
+	webhookWorkers = 4
+	// webhookPollInterval is how often the delivery queue is checked for
+	// retries when no new event has been queued.
+	webhookPollInterval = 5 * time.Second
+	// webhookTimeout is how long a webhook has to respond to a delivery.
+	webhookTimeout = 10 * time.Second
+	// webhookLease is how long a claimed delivery is hidden from other
+	// workers. It must be longer than webhookTimeout.
+	webhookLease = time.Minute
+	// maxWebhookAttempts is the number of times a delivery is sent before it
+	// fails.
+	maxWebhookAttempts = 8
+	// webhookRetryDelay is the delay before the first retry of a delivery.
+	// The delay doubles after every failed attempt.
+	webhookRetryDelay = 30 * time.Second
+
+	// webhookSignatureHeader is the header that carries the hex encoded
+	// HMAC-SHA256 of "{timestamp}.{body}" using the webhook's secret.
+	webhookSignatureHeader = "Megtask-Signature"
+	webhookTimestampHeader = "Megtask-Timestamp"
+	webhookEventHeader     = "Megtask-Event"
+	webhookDeliveryHeader  = "Megtask-Delivery"
+)
+
+// webhookDispatcher sends queued webhook deliveries and retries failed
+// deliveries with exponential backoff.
+type webhookDispatcher struct {
+	taskDB TaskDatabase
+	log    *slog.Logger
+	client *http.Client
+	wake   chan struct{}
+}
+
+// newWebhookDispatcher returns a new *webhookDispatcher. Deliveries to
+// private network addresses are refused unless allowPrivate is true.
+func newWebhookDispatcher(taskDB TaskDatabase, log *slog.Logger, allowPrivate bool) *webhookDispatcher {
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+	if !allowPrivate {
+		dialer.Control = publicAddressOnly
+	}
+
+	return &webhookDispatcher{
+		taskDB: taskDB,
+		log:    log,
+		client: &http.Client{
+			Timeout: webhookTimeout,
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: webhookTimeout,
+				MaxIdleConns:        100,
+				IdleConnTimeout:     90 * time.Second,
+			},
+			// Redirects are not followed so deliveries only go to the
+			// configured URL.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// run sends due deliveries until ctx is canceled.
+func (wd *webhookDispatcher) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < webhookWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wd.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// work claims and sends due deliveries, waiting for new deliveries when the
+// queue is empty.
+func (wd *webhookDispatcher) work(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		webhook, delivery, err := wd.taskDB.ClaimWebhookDelivery(webhookLease)
+		if err != nil {
+			wd.log.Error("taskDB.ClaimWebhookDelivery error: ", "error", err)
+		}
+
+		if delivery == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-wd.wake:
+			case <-ticker.C:
+			}
+			continue
+		}
+
+		wd.deliver(ctx, webhook, delivery)
+	}
+}
+
+// notify wakes a worker to send newly queued deliveries.
+func (wd *webhookDispatcher) notify() {
+	select {
+	case wd.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver sends delivery to webhook and records the result. The returned
+// attempt is also applied to delivery.
+func (wd *webhookDispatcher) deliver(ctx context.Context, webhook *db.Webhook, delivery *db.WebhookDelivery) *db.WebhookAttempt {
+	attempt := wd.send(ctx, webhook, delivery)
+
+	delivery.Attempts++
+	delivery.ResponseStatus = attempt.ResponseStatus
+	delivery.Error = attempt.Error
+	delivery.LastAttemptAt = time.Now().Unix()
+	delivery.NextAttemptAt = 0
+	switch {
+	case attempt.Error == "":
+		delivery.Status = db.DeliveryStatusSucceeded
+	case delivery.Attempts >= maxWebhookAttempts:
+		delivery.Status = db.DeliveryStatusFailed
+	default:
+		delivery.Status = db.DeliveryStatusPending
+		delay := webhookRetryDelay << (delivery.Attempts - 1)
+		attempt.NextAttemptAt = time.Now().Add(delay).Unix()
+		delivery.NextAttemptAt = attempt.NextAttemptAt
+	}
+
+	err := wd.taskDB.RecordWebhookAttempt(delivery.ID, attempt)
+	if err != nil {
+		wd.log.Error("taskDB.RecordWebhookAttempt error: ", "error", err)
+	}
+
+	return attempt
+}
+
+// send posts the payload of delivery to webhook.
+func (wd *webhookDispatcher) send(ctx context.Context, webhook *db.Webhook, delivery *db.WebhookDelivery) *db.WebhookAttempt {
+	body := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return &db.WebhookAttempt{Error: fmt.Sprintf("invalid request: %v", err)}
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Megtask-Webhook/1.0")
+	req.Header.Set(webhookEventHeader, delivery.Event)
+	req.Header.Set(webhookDeliveryHeader, delivery.ID)
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, "sha256="+signWebhookPayload(webhook.Secret, timestamp, body))
+
+	res, err := wd.client.Do(req)
+	if err != nil {
+		return &db.WebhookAttempt{Error: err.Error()}
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return &db.WebhookAttempt{
+			ResponseStatus: res.StatusCode,
+			Error:          fmt.Sprintf("unexpected response status %d", res.StatusCode),
+		}
+	}
+
+	return &db.WebhookAttempt{ResponseStatus: res.StatusCode}
+}
+
+// signWebhookPayload returns the hex encoded HMAC-SHA256 of
+// "{timestamp}.{body}" using secret.
+func signWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// publicAddressOnly is a net.Dialer Control function that refuses
+// connections to loopback, private and link-local addresses so webhooks
+// cannot be used to reach internal services.
+func publicAddressOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() {
+		return errors.New("webhook address is not public")
+	}
+
+	return nil
+}
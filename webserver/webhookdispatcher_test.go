@@ -0,0 +1,85 @@
+package webserver
+
+import (
+	"context"
+	"crypto/hmac"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      string
+		want      string
+	}{
+		{"payload", "secret", "1700000000", `{"event":"task.created"}`, "fc53e1d22cb0ed2216fe98c535f28e2e668e9a812f23e87d18f07b966afb540a"},
+		{"empty secret and body", "", "1700000000", "", "c1da1b6c6b8e9da7f4bbb90f7cab0820f271ad19ccbf80c88479c4e14f37d1c6"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := signWebhookPayload(test.secret, test.timestamp, []byte(test.body)); got != test.want {
+				t.Fatalf("want signature %s, got %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestWebhookSignatureVerification(t *testing.T) {
+	const secret = "secret"
+
+	var received struct {
+		header http.Header
+		body   []byte
+	}
+	receiver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		received.header = req.Header.Clone()
+		received.body, _ = io.ReadAll(req.Body)
+	}))
+	defer receiver.Close()
+
+	wd := newWebhookDispatcher(nil, slog.New(slog.NewTextHandler(io.Discard, nil)), true)
+	webhook := &db.Webhook{ID: "webhook", URL: receiver.URL, Secret: secret}
+	delivery := &db.WebhookDelivery{ID: "delivery", Event: "task.created", Payload: `{"event":"task.created"}`}
+	attempt := wd.send(context.Background(), webhook, delivery)
+	if attempt.Error != "" {
+		t.Fatalf("send error: %s", attempt.Error)
+	}
+
+	if received.header.Get(webhookEventHeader) != delivery.Event || received.header.Get(webhookDeliveryHeader) != delivery.ID {
+		t.Fatalf("unexpected delivery headers: %v", received.header)
+	}
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      string
+		wantValid bool
+	}{
+		{"webhook secret", secret, received.header.Get(webhookTimestampHeader), string(received.body), true},
+		{"other secret", "other", received.header.Get(webhookTimestampHeader), string(received.body), false},
+		{"changed timestamp", secret, "0", string(received.body), false},
+		{"changed body", secret, received.header.Get(webhookTimestampHeader), `{"event":"task.deleted"}`, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Receivers compute the signature of the request and compare it to
+			// the signature header in constant time.
+			want := "sha256=" + signWebhookPayload(test.secret, test.timestamp, []byte(test.body))
+			valid := hmac.Equal([]byte(want), []byte(received.header.Get(webhookSignatureHeader)))
+			if valid != test.wantValid {
+				t.Fatalf("want valid signature %v, got %v", test.wantValid, valid)
+			}
+		})
+	}
+}
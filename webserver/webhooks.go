@@ -0,0 +1,184 @@
+package webserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ukane-philemon/megtask/db"
+)
+
+const (
+	// webhookPingEvent is sent by the webhook test endpoint.
+	webhookPingEvent = "ping"
+
+	maxWebhookURLLength    = 2048
+	minWebhookSecretLength = 16
+	maxWebhookSecretLength = 256
+	// maxWebhookDeliveries is the number of deliveries returned in the
+	// delivery log of a webhook.
+	maxWebhookDeliveries = 50
+)
+
+// webhookEvents are the task events and reminders webhooks can receive.
+var webhookEvents = []string{TaskCreatedEvent, TaskUpdatedEvent, TaskDeletedEvent, TaskReminderEvent}
+
+// handleCreateWebhook handles the "POST /webhooks" endpoint and creates a
+// webhook that receives the user's task events. The secret used to sign
+// deliveries is only returned in the response of this endpoint.
+func (s *WebServer) handleCreateWebhook(res http.ResponseWriter, req *http.Request) {
+	form := new(webhookRequest)
+	if !s.readPostBody(res, req, &form) {
+		return
+	}
+
+	err := form.Validate()
+	if err != nil {
+		s.writeBadRequest(res, err.Error())
+		return
+	}
+
+	events := form.Events
+	if len(events) == 0 {
+		events = webhookEvents
+	}
+
+	secret := form.Secret
+	if secret == "" {
+		secret, err = randomToken()
+		if err != nil {
+			s.writeServerError(res, fmt.Errorf("randomToken error: %w", err))
+			return
+		}
+	}
+
+	userID := s.reqUserID(req)
+	webhook, err := s.taskDB.CreateWebhook(userID, form.URL, events, secret)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.CreateWebhook error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"webhook": webhook,
+	})
+}
+
+// handleRetrieveWebhooks handles the "GET /webhooks" endpoint and returns the
+// user's webhooks.
+func (s *WebServer) handleRetrieveWebhooks(res http.ResponseWriter, req *http.Request) {
+	userID := s.reqUserID(req)
+	webhooks, err := s.taskDB.Webhooks(userID)
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("taskDB.Webhooks error: %w", err))
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"webhooks": webhooks,
+	})
+}
+
+// handleDeleteWebhook handles the "DELETE /webhooks/{webhookID}" endpoint and
+// deletes a webhook of the user. Pending deliveries are not sent.
+func (s *WebServer) handleDeleteWebhook(res http.ResponseWriter, req *http.Request) {
+	webhookID := chi.URLParam(req, "webhookID")
+	userID := s.reqUserID(req)
+	err := s.taskDB.DeleteWebhook(userID, webhookID)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.DeleteWebhook error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]string{
+		"message": "Webhook deleted.",
+	})
+}
+
+// handleRetrieveWebhookDeliveries handles the
+// "GET /webhooks/{webhookID}/deliveries" endpoint and returns the latest
+// deliveries of a webhook with the result of their last attempt.
+func (s *WebServer) handleRetrieveWebhookDeliveries(res http.ResponseWriter, req *http.Request) {
+	webhookID := chi.URLParam(req, "webhookID")
+	userID := s.reqUserID(req)
+	deliveries, err := s.taskDB.WebhookDeliveries(userID, webhookID, maxWebhookDeliveries)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.WebhookDeliveries error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"deliveries": deliveries,
+	})
+}
+
+// handlePingWebhook handles the "POST /webhooks/{webhookID}/ping" endpoint
+// and sends a ping event to a webhook. The delivery is sent before the
+// response is written and is retried like other deliveries if it fails.
+func (s *WebServer) handlePingWebhook(res http.ResponseWriter, req *http.Request) {
+	webhookID := chi.URLParam(req, "webhookID")
+	userID := s.reqUserID(req)
+
+	payload, err := json.Marshal(map[string]any{
+		"type":      webhookPingEvent,
+		"webhookID": webhookID,
+		"timestamp": time.Now().Unix(),
+	})
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("json.Marshal error: %w", err))
+		return
+	}
+
+	// The delivery is leased so workers do not send it while it is sent
+	// here.
+	nextAttemptAt := time.Now().Add(webhookLease).Unix()
+	webhook, delivery, err := s.taskDB.CreateWebhookDelivery(userID, webhookID, webhookPingEvent, string(payload), nextAttemptAt)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.CreateWebhookDelivery error: %w", err))
+		}
+		return
+	}
+
+	s.webhooks.deliver(req.Context(), webhook, delivery)
+
+	s.writeSuccess(res, map[string]any{
+		"delivery": delivery,
+	})
+}
+
+// queueWebhookDeliveries queues deliveries of event to the webhooks of the
+// users in its audience. Failures are logged since the change that caused
+// the event has already been saved.
+func (s *WebServer) queueWebhookDeliveries(event *TaskEvent) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		s.log.Error("json.Marshal error: ", "error", err)
+		return
+	}
+
+	err = s.taskDB.QueueWebhookDeliveries(event.audience, event.Type, string(payload))
+	if err != nil {
+		s.log.Error("taskDB.QueueWebhookDeliveries error: ", "error", err)
+		return
+	}
+
+	s.webhooks.notify()
+}
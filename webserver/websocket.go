@@ -0,0 +1,311 @@
+package webserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/ukane-philemon/megtask/db"
+)
+
+const (
+	// wsProtocol is the WebSocket subprotocol of the API. Browsers cannot set
+	// headers on WebSocket requests, so they can send their auth token as a
+	// second subprotocol after wsProtocol.
+	wsProtocol = "megtask"
+
+	wsSubscribeCommand    = "subscribe"
+	wsUnsubscribeCommand  = "unsubscribe"
+	wsCreateTaskCommand   = "create"
+	wsUpdateTaskCommand   = "update"
+	wsCompleteTaskCommand = "complete"
+
+	// wsTasksScope subscribes to events for all the tasks the user can
+	// access.
+	wsTasksScope = "tasks"
+	// wsProjectScope subscribes to events for the tasks in a project.
+	wsProjectScope = "project"
+
+	wsAckMessage   = "ack"
+	wsEventMessage = "event"
+
+	maxWSCommandIDLength = 64
+	maxWSMessageSize     = 64 << 10 // 64KB
+
+	wsWriteTimeout = 10 * time.Second
+	// wsPongTimeout is how long a connection can be idle before it is
+	// closed. Pings are sent often enough for healthy clients to reply in
+	// time.
+	wsPongTimeout  = 60 * time.Second
+	wsPingInterval = 30 * time.Second
+)
+
+var wsUpgrader = websocket.Upgrader{
+	Subprotocols: []string{wsProtocol},
+	// Connections are authenticated with a token, not cookies, so they
+	// cannot be opened on behalf of a user by another site.
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// wsClient is a WebSocket connection of an authenticated user.
+type wsClient struct {
+	s      *WebServer
+	conn   *websocket.Conn
+	req    *http.Request
+	userID string
+
+	writeMtx sync.Mutex
+
+	subsMtx       sync.Mutex
+	subscriptions map[string]bool
+}
+
+// wsTokenMiddleware copies an auth token sent as a WebSocket subprotocol to
+// the Authorization header so the connection can be authenticated by
+// authMiddleware. Tokens sent in headers take precedence.
+func wsTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Header.Get(jwtHeader) == "" && bearerToken(req) == "" {
+			for _, protocol := range websocket.Subprotocols(req) {
+				if protocol != wsProtocol {
+					req.Header.Set("Authorization", "Bearer "+protocol)
+					break
+				}
+			}
+		}
+		next.ServeHTTP(res, req)
+	})
+}
+
+// handleWebSocket handles the "GET /ws" endpoint. It upgrades the request to
+// a WebSocket connection on which the user can subscribe to task events and
+// send task commands. Every command is acknowledged with its ID.
+func (s *WebServer) handleWebSocket(res http.ResponseWriter, req *http.Request) {
+	conn, err := wsUpgrader.Upgrade(res, req, nil)
+	if err != nil {
+		// The upgrader has already written an error response.
+		s.log.Error("websocket upgrade error: ", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	client := &wsClient{
+		s:             s,
+		conn:          conn,
+		req:           req,
+		userID:        s.reqUserID(req),
+		subscriptions: make(map[string]bool),
+	}
+
+	sub, _, _ := s.events.subscribe(client.userID, 0)
+	defer s.events.unsubscribe(sub)
+
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		client.readCommands()
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-readDone:
+			return
+		case event, ok := <-sub.events:
+			if !ok {
+				// The connection fell behind or the server is shutting down.
+				client.close(websocket.CloseTryAgainLater, "reconnect and reload tasks")
+				return
+			}
+			if client.subscribed(event) {
+				err = client.write(&wsMessage{Type: wsEventMessage, Event: event})
+			}
+		case <-ping.C:
+			if !client.sessionActive() {
+				client.close(websocket.ClosePolicyViolation, "session has been revoked")
+				return
+			}
+			client.writeMtx.Lock()
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+			client.writeMtx.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readCommands reads and handles commands until the connection is closed.
+func (c *wsClient) readCommands() {
+	c.conn.SetReadLimit(maxWSMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				c.s.log.Error("websocket read error: ", "error", err)
+			}
+			return
+		}
+
+		cmd := new(wsCommand)
+		err = json.Unmarshal(data, cmd)
+		if err == nil {
+			err = cmd.Validate()
+		}
+
+		ack := &wsMessage{Type: wsAckMessage, ID: cmd.ID}
+		if err == nil {
+			ack.Tasks, err = c.handleCommand(cmd)
+		}
+		if err != nil {
+			ack.Error = err.Error()
+		} else {
+			ack.OK = true
+		}
+
+		if c.write(ack) != nil {
+			return
+		}
+	}
+}
+
+// handleCommand runs cmd and returns the tasks to include in its
+// acknowledgement. Errors are sent to the client, so internal errors are
+// logged and replaced with a generic message.
+func (c *wsClient) handleCommand(cmd *wsCommand) ([]*db.Task, error) {
+	switch cmd.Type {
+	case wsSubscribeCommand, wsUnsubscribeCommand:
+		if !c.hasScope(scopeTasksRead) {
+			return nil, fmt.Errorf("api token is missing the %q scope", scopeTasksRead)
+		}
+
+		key := subscriptionKey(cmd.Scope, cmd.Project)
+		c.subsMtx.Lock()
+		if cmd.Type == wsSubscribeCommand {
+			c.subscriptions[key] = true
+		} else {
+			delete(c.subscriptions, key)
+		}
+		c.subsMtx.Unlock()
+		return nil, nil
+	}
+
+	if !c.hasScope(scopeTasksWrite) {
+		return nil, fmt.Errorf("api token is missing the %q scope", scopeTasksWrite)
+	}
+
+	var task *db.Task
+	var tasks []*db.Task
+	var err error
+	eventType, taskID := TaskUpdatedEvent, cmd.TaskID
+	switch cmd.Type {
+	case wsCreateTaskCommand:
+		task, tasks, err = c.s.taskDB.CreateTask(c.userID, cmd.TaskDetail, cmd.Project, 0, nil, "")
+		if err == nil {
+			eventType, taskID = TaskCreatedEvent, task.ID
+		}
+	case wsUpdateTaskCommand:
+		update := &db.TaskUpdate{Detail: cmd.TaskDetail}
+		if cmd.Project != "" {
+			update.Project = &cmd.Project
+		}
+		tasks, err = c.s.taskDB.UpdateTask(c.userID, cmd.TaskID, update)
+	case wsCompleteTaskCommand:
+		completed := true
+		tasks, err = c.s.taskDB.UpdateTask(c.userID, cmd.TaskID, &db.TaskUpdate{MarkAsComplete: &completed})
+	}
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			return nil, err
+		}
+		c.s.log.Error("websocket command error: ", "type", cmd.Type, "error", err)
+		return nil, errors.New("internal server error")
+	}
+
+	c.s.publishTaskEvent(eventType, taskID, tasks)
+
+	return tasks, nil
+}
+
+// subscribed checks if the client subscribed to event. Deleted tasks are not
+// sent with their events, so deletions are sent to all subscriptions.
+func (c *wsClient) subscribed(event *TaskEvent) bool {
+	c.subsMtx.Lock()
+	defer c.subsMtx.Unlock()
+
+	if c.subscriptions[subscriptionKey(wsTasksScope, "")] {
+		return true
+	}
+
+	if event.Task == nil {
+		return len(c.subscriptions) > 0
+	}
+
+	return event.Task.Project != "" && c.subscriptions[subscriptionKey(wsProjectScope, event.Task.Project)]
+}
+
+// hasScope checks if the connection was authenticated with a login token or
+// a personal access token that has the provided scope.
+func (c *wsClient) hasScope(scope string) bool {
+	scopes, isAPIToken := c.req.Context().Value(apiTokenScopesCtxKey).([]string)
+	return !isAPIToken || slices.Contains(scopes, scope)
+}
+
+// sessionActive checks that the login session of the connection has not been
+// revoked. Connections authenticated with personal access tokens are always
+// active.
+func (c *wsClient) sessionActive() bool {
+	sessionID, _ := c.req.Context().Value(sessionIDCtxKey).(string)
+	if sessionID == "" {
+		return true
+	}
+
+	err := c.s.taskDB.TouchSession(c.userID, sessionID)
+	if err != nil && !errors.Is(err, db.ErrorInvalidRequest) {
+		// Keep the connection open if the database is temporarily
+		// unavailable.
+		c.s.log.Error("taskDB.TouchSession error: ", "error", err)
+		return true
+	}
+
+	return err == nil
+}
+
+// write sends msg to the client.
+func (c *wsClient) write(msg *wsMessage) error {
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return c.conn.WriteJSON(msg)
+}
+
+// close sends a close message with the provided code and reason to the
+// client.
+func (c *wsClient) close(code int, reason string) {
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+
+	msg := websocket.FormatCloseMessage(code, reason)
+	c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteTimeout))
+}
+
+// subscriptionKey returns the key of a subscription to scope.
+func subscriptionKey(scope, project string) string {
+	if scope == wsProjectScope {
+		return scope + ":" + project
+	}
+	return scope
+}
@@ -0,0 +1,247 @@
+package webserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/ukane-philemon/megtask/db"
+)
+
+// wsDB is a TaskDatabase with the task "task" in the project "work" that
+// "user" can access.
+type wsDB struct {
+	authDB
+}
+
+func (wsDB) CreateTask(userID string, taskDetail, project string, dueAt int64, tags []string, recurrence string) (*db.Task, []*db.Task, error) {
+	task := &db.Task{ID: "new", TaskInfo: db.TaskInfo{Detail: taskDetail, Project: project}}
+	return task, []*db.Task{task}, nil
+}
+
+func (wsDB) UpdateTask(userID, taskID string, taskUpdate *db.TaskUpdate) ([]*db.Task, error) {
+	if taskID != "task" {
+		return nil, db.ErrorInvalidRequest
+	}
+	return []*db.Task{{ID: "task", TaskInfo: db.TaskInfo{Project: "work"}}}, nil
+}
+
+func (wsDB) TaskAudience(taskID string) ([]string, error) {
+	return []string{"user"}, nil
+}
+
+// dialWebSocket opens a WebSocket connection to server authenticated with
+// token, which is sent as a subprotocol if asProtocol is true.
+func dialWebSocket(t *testing.T, server *httptest.Server, token string, asProtocol bool) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+
+	dialer := &websocket.Dialer{HandshakeTimeout: 5 * time.Second, Subprotocols: []string{wsProtocol}}
+	header := make(http.Header)
+	if asProtocol {
+		dialer.Subprotocols = append(dialer.Subprotocols, token)
+	} else if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	return dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", header)
+}
+
+// readAck reads messages from conn until the acknowledgement of the command
+// with the provided id and returns it with the events received before it.
+func readAck(t *testing.T, conn *websocket.Conn, id string) (*wsMessage, []*TaskEvent) {
+	t.Helper()
+
+	var events []*TaskEvent
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		msg := new(wsMessage)
+		if err := conn.ReadJSON(msg); err != nil {
+			t.Fatalf("ReadJSON error: %v", err)
+		}
+		if msg.Type == wsEventMessage {
+			events = append(events, msg.Event)
+			continue
+		}
+		if msg.Type == wsAckMessage && msg.ID == id {
+			return msg, events
+		}
+	}
+}
+
+func TestWebSocketAuth(t *testing.T) {
+	const readToken = apiTokenPrefix + "read"
+	adb := authDB{roles: map[string]string{"user": db.RoleUser}, scopes: map[string][]string{readToken: {scopeTasksRead}}}
+	s := newTestServer(t, wsDB{adb}, nil)
+	server := httptest.NewServer(s.mux)
+	defer server.Close()
+
+	loginToken, err := s.jwtManager.GenerateJWtToken("user", db.RoleUser, "session", time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateJWtToken error: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		asProtocol bool
+		wantStatus int
+		// wantCreateError is part of the error of a create command, or empty
+		// if tasks can be created.
+		wantCreateError string
+	}{
+		{"login token header", loginToken, false, http.StatusSwitchingProtocols, ""},
+		{"login token protocol", loginToken, true, http.StatusSwitchingProtocols, ""},
+		{"api token without write scope", readToken, false, http.StatusSwitchingProtocols, "missing the"},
+		{"no token", "", false, http.StatusUnauthorized, ""},
+		{"invalid token", "invalid", true, http.StatusUnauthorized, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn, res, err := dialWebSocket(t, server, test.token, test.asProtocol)
+			if res == nil {
+				t.Fatalf("Dial error: %v", err)
+			}
+			if res.StatusCode != test.wantStatus {
+				t.Fatalf("want status %d, got %d", test.wantStatus, res.StatusCode)
+			}
+			if conn == nil {
+				return
+			}
+			defer conn.Close()
+
+			if conn.Subprotocol() != wsProtocol {
+				t.Fatalf("want subprotocol %s, got %s", wsProtocol, conn.Subprotocol())
+			}
+
+			// Every token can subscribe to events.
+			for _, cmd := range []*wsCommand{
+				{ID: "subscribe", Type: wsSubscribeCommand, Scope: wsTasksScope},
+				{ID: "create", Type: wsCreateTaskCommand, TaskDetail: "detail"},
+			} {
+				if err := conn.WriteJSON(cmd); err != nil {
+					t.Fatalf("WriteJSON error: %v", err)
+				}
+			}
+
+			if ack, _ := readAck(t, conn, "subscribe"); !ack.OK {
+				t.Fatalf("want subscribed, got %s", ack.Error)
+			}
+
+			ack, _ := readAck(t, conn, "create")
+			if test.wantCreateError == "" {
+				if !ack.OK {
+					t.Fatalf("want task created, got %s", ack.Error)
+				}
+			} else if ack.OK || !strings.Contains(ack.Error, test.wantCreateError) {
+				t.Fatalf("want error %q, got %+v", test.wantCreateError, ack)
+			}
+		})
+	}
+}
+
+func TestWebSocketCommands(t *testing.T) {
+	s := newTestServer(t, wsDB{authDB{roles: map[string]string{"user": db.RoleUser}}}, nil)
+	server := httptest.NewServer(s.mux)
+	defer server.Close()
+
+	token, err := s.jwtManager.GenerateJWtToken("user", db.RoleUser, "session", time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateJWtToken error: %v", err)
+	}
+
+	conn, _, err := dialWebSocket(t, server, token, false)
+	if err != nil {
+		t.Fatalf("Dial error: %v", err)
+	}
+	defer conn.Close()
+
+	// The tests share the connection and its subscriptions and run in order.
+	tests := []struct {
+		name string
+		cmd  *wsCommand
+		// wantError is part of the error of the acknowledgement, or empty if
+		// the command succeeds.
+		wantError string
+		// wantEvent is the type of the event the command sends, if any.
+		wantEvent string
+	}{
+		{name: "unknown command", cmd: &wsCommand{ID: "1", Type: "delete"}, wantError: "unknown command type"},
+		{name: "missing id", cmd: &wsCommand{Type: wsSubscribeCommand, Scope: wsTasksScope}, wantError: "command id is required"},
+		{name: "subscribe without project", cmd: &wsCommand{ID: "2", Type: wsSubscribeCommand, Scope: wsProjectScope}, wantError: "missing project"},
+		{name: "subscribe to a project", cmd: &wsCommand{ID: "3", Type: wsSubscribeCommand, Scope: wsProjectScope, Project: "work"}},
+		{name: "create in the project", cmd: &wsCommand{ID: "4", Type: wsCreateTaskCommand, TaskDetail: "detail", Project: "work"}, wantEvent: TaskCreatedEvent},
+		{name: "create without detail", cmd: &wsCommand{ID: "5", Type: wsCreateTaskCommand}, wantError: "missing task detail"},
+		{name: "update a missing task", cmd: &wsCommand{ID: "6", Type: wsUpdateTaskCommand, TaskID: "missing", TaskDetail: "detail"}, wantError: db.ErrorInvalidRequest.Error()},
+		{name: "complete a task in the project", cmd: &wsCommand{ID: "7", Type: wsCompleteTaskCommand, TaskID: "task"}, wantEvent: TaskUpdatedEvent},
+		{name: "unsubscribe", cmd: &wsCommand{ID: "8", Type: wsUnsubscribeCommand, Scope: wsProjectScope, Project: "work"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := conn.WriteJSON(test.cmd); err != nil {
+				t.Fatalf("WriteJSON error: %v", err)
+			}
+
+			ack, events := readAck(t, conn, test.cmd.ID)
+			if test.wantError == "" {
+				if !ack.OK {
+					t.Fatalf("want command acknowledged, got %s", ack.Error)
+				}
+			} else if ack.OK || !strings.Contains(ack.Error, test.wantError) {
+				t.Fatalf("want error %q, got %+v", test.wantError, ack)
+			}
+
+			if test.wantEvent == "" {
+				return
+			}
+
+			// The event may be sent after the acknowledgement.
+			if len(events) == 0 {
+				msg := new(wsMessage)
+				if err := conn.ReadJSON(msg); err != nil {
+					t.Fatalf("ReadJSON error: %v", err)
+				}
+				events = append(events, msg.Event)
+			}
+			if events[0] == nil || events[0].Type != test.wantEvent {
+				t.Fatalf("want %s event, got %+v", test.wantEvent, events[0])
+			}
+		})
+	}
+}
+
+func TestWSClientSubscribed(t *testing.T) {
+	workTask := &db.Task{ID: "work", TaskInfo: db.TaskInfo{Project: "work"}}
+	otherTask := &db.Task{ID: "other"}
+
+	tests := []struct {
+		name          string
+		subscriptions []string
+		event         *TaskEvent
+		want          bool
+	}{
+		{"no subscriptions", nil, &TaskEvent{Task: workTask}, false},
+		{"all tasks", []string{subscriptionKey(wsTasksScope, "")}, &TaskEvent{Task: otherTask}, true},
+		{"task in the project", []string{subscriptionKey(wsProjectScope, "work")}, &TaskEvent{Task: workTask}, true},
+		{"task in another project", []string{subscriptionKey(wsProjectScope, "home")}, &TaskEvent{Task: workTask}, false},
+		{"task without a project", []string{subscriptionKey(wsProjectScope, "work")}, &TaskEvent{Task: otherTask}, false},
+		{"deleted task", []string{subscriptionKey(wsProjectScope, "home")}, &TaskEvent{Type: TaskDeletedEvent}, true},
+		{"deleted task without subscriptions", nil, &TaskEvent{Type: TaskDeletedEvent}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &wsClient{subscriptions: make(map[string]bool)}
+			for _, key := range test.subscriptions {
+				c.subscriptions[key] = true
+			}
+			if got := c.subscribed(test.event); got != test.want {
+				t.Fatalf("want subscribed %v, got %v", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package webserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ukane-philemon/megtask/db"
+)
+
+// handleCreateWorkspace handles the "POST /workspaces" endpoint and creates a
+// new workspace owned by the user.
+func (s *WebServer) handleCreateWorkspace(res http.ResponseWriter, req *http.Request) {
+	form := new(createWorkspaceRequest)
+	if !s.readPostBody(res, req, &form) {
+		return
+	}
+
+	err := form.Validate()
+	if err != nil {
+		s.writeBadRequest(res, err.Error())
+		return
+	}
+
+	userID := s.reqUserID(req)
+	workspace, err := s.taskDB.CreateWorkspace(userID, form.Name)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.CreateWorkspace error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"workspace": workspace,
+	})
+}
+
+// handleRetrieveWorkspaces handles the "GET /workspaces" endpoint and returns
+// the workspaces the user is a member of.
+func (s *WebServer) handleRetrieveWorkspaces(res http.ResponseWriter, req *http.Request) {
+	userID := s.reqUserID(req)
+	workspaces, err := s.taskDB.Workspaces(userID)
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("taskDB.Workspaces error: %w", err))
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"workspaces": workspaces,
+	})
+}
+
+// handleRetrieveWorkspaceInvitations handles the "GET /workspace-invitations"
+// endpoint and returns the workspaces the user has been invited to.
+func (s *WebServer) handleRetrieveWorkspaceInvitations(res http.ResponseWriter, req *http.Request) {
+	userID := s.reqUserID(req)
+	invitations, err := s.taskDB.WorkspaceInvitations(userID)
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("taskDB.WorkspaceInvitations error: %w", err))
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"invitations": invitations,
+	})
+}
+
+// handleAcceptWorkspaceInvitation handles the "POST
+// /workspace-invitations/{workspaceID}/accept" endpoint and makes the user a
+// member of the workspace they were invited to.
+func (s *WebServer) handleAcceptWorkspaceInvitation(res http.ResponseWriter, req *http.Request) {
+	s.respondToWorkspaceInvitation(res, req, true)
+}
+
+// handleDeclineWorkspaceInvitation handles the "POST
+// /workspace-invitations/{workspaceID}/decline" endpoint and removes the
+// user's invitation to a workspace.
+func (s *WebServer) handleDeclineWorkspaceInvitation(res http.ResponseWriter, req *http.Request) {
+	s.respondToWorkspaceInvitation(res, req, false)
+}
+
+// respondToWorkspaceInvitation accepts or declines the user's invitation to
+// the workspace in the request URL.
+func (s *WebServer) respondToWorkspaceInvitation(res http.ResponseWriter, req *http.Request, accept bool) {
+	workspaceID := chi.URLParam(req, "workspaceID")
+	userID := s.reqUserID(req)
+	err := s.taskDB.RespondToWorkspaceInvitation(workspaceID, userID, accept)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.RespondToWorkspaceInvitation error: %w", err))
+		}
+		return
+	}
+
+	message := "Invitation declined."
+	if accept {
+		message = "Invitation accepted."
+	}
+
+	s.writeSuccess(res, map[string]string{
+		"message": message,
+	})
+}
+
+// handleRetrieveWorkspace handles the "GET /workspaces/{workspaceID}" endpoint
+// and returns the members of a workspace and the users invited to it.
+func (s *WebServer) handleRetrieveWorkspace(res http.ResponseWriter, req *http.Request) {
+	workspaceID := chi.URLParam(req, "workspaceID")
+	members, err := s.taskDB.WorkspaceMembers(workspaceID)
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("taskDB.WorkspaceMembers error: %w", err))
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"role":    s.reqWorkspaceRole(req),
+		"members": members,
+	})
+}
+
+// handleInviteToWorkspace handles the "POST
+// /workspaces/{workspaceID}/invitations" endpoint and invites a user to a
+// workspace as a member or viewer.
+func (s *WebServer) handleInviteToWorkspace(res http.ResponseWriter, req *http.Request) {
+	form := new(workspaceInvitationRequest)
+	if !s.readPostBody(res, req, &form) {
+		return
+	}
+
+	err := form.Validate()
+	if err != nil {
+		s.writeBadRequest(res, err.Error())
+		return
+	}
+
+	workspaceID := chi.URLParam(req, "workspaceID")
+	userID := s.reqUserID(req)
+	member, err := s.taskDB.InviteToWorkspace(workspaceID, userID, form.Username, form.Role)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.InviteToWorkspace error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"member": member,
+	})
+}
+
+// handleRemoveWorkspaceMember handles the "DELETE
+// /workspaces/{workspaceID}/members/{userID}" endpoint and removes a member
+// from a workspace or cancels their invitation.
+func (s *WebServer) handleRemoveWorkspaceMember(res http.ResponseWriter, req *http.Request) {
+	workspaceID := chi.URLParam(req, "workspaceID")
+	memberID := chi.URLParam(req, "userID")
+	s.removeWorkspaceMember(res, workspaceID, memberID, "Member removed.")
+}
+
+// handleLeaveWorkspace handles the "POST /workspaces/{workspaceID}/leave"
+// endpoint and removes the user from a workspace. The owner of a workspace
+// cannot leave it.
+func (s *WebServer) handleLeaveWorkspace(res http.ResponseWriter, req *http.Request) {
+	workspaceID := chi.URLParam(req, "workspaceID")
+	s.removeWorkspaceMember(res, workspaceID, s.reqUserID(req), "You have left the workspace.")
+}
+
+// removeWorkspaceMember removes a member from a workspace and writes the
+// provided message on success.
+func (s *WebServer) removeWorkspaceMember(res http.ResponseWriter, workspaceID, memberID, message string) {
+	err := s.taskDB.RemoveWorkspaceMember(workspaceID, memberID)
+	if err != nil {
+		if errors.Is(err, db.ErrorInvalidRequest) {
+			s.writeBadRequest(res, err.Error())
+		} else {
+			s.writeServerError(res, fmt.Errorf("taskDB.RemoveWorkspaceMember error: %w", err))
+		}
+		return
+	}
+
+	s.writeSuccess(res, map[string]string{
+		"message": message,
+	})
+}
+
+// handleCreateWorkspaceTask handles the "POST /workspaces/{workspaceID}/task"
+// endpoint and creates a new task in a workspace.
+func (s *WebServer) handleCreateWorkspaceTask(res http.ResponseWriter, req *http.Request) {
+	form := new(createTaskRequest)
+	if !s.readPostBody(res, req, &form) {
+		return
+	}
+
+	if form.TaskDetail == "" {
+		s.writeBadRequest(res, "missing task detail")
+		return
+	}
+
+	if err := validateProject(form.Project); err != nil {
+		s.writeBadRequest(res, err.Error())
+		return
+	}
+
+	if err := validateDueAt(form.DueAt); err != nil {
+		s.writeBadRequest(res, err.Error())
+		return
+	}
+
+	tags, err := validateTags(form.Tags)
+	if err != nil {
+		s.writeBadRequest(res, err.Error())
+		return
+	}
+
+	if err := validateRecurrence(form.Recurrence); err != nil {
+		s.writeBadRequest(res, err.Error())
+		return
+	}
+
+	if form.Recurrence != "" && form.DueAt == 0 {
+		s.writeBadRequest(res, "a recurring task must have a due date")
+		return
+	}
+
+	workspaceID := chi.URLParam(req, "workspaceID")
+	userID := s.reqUserID(req)
+	task, tasks, err := s.taskDB.CreateWorkspaceTask(workspaceID, userID, form.TaskDetail, form.Project, form.DueAt, tags, form.Recurrence)
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("taskDB.CreateWorkspaceTask error: %w", err))
+		return
+	}
+
+	s.publishTaskEvent(TaskCreatedEvent, task.ID, tasks)
+
+	s.writeSuccess(res, map[string]any{
+		"tasks": tasks,
+	})
+}
+
+// handleRetrieveWorkspaceTasks handles the "GET /workspaces/{workspaceID}/tasks"
+// endpoint and returns all the tasks in a workspace sorted by timestamp. This
+// endpoint excepts an optional "status" query parameter that can either be
+// "pending" or "completed".
+func (s *WebServer) handleRetrieveWorkspaceTasks(res http.ResponseWriter, req *http.Request) {
+	status := req.URL.Query().Get(taskStatusQueryKey)
+	if status != "" && !strings.EqualFold(status, pendingTasksFilter) && !strings.EqualFold(status, completedTasksFilter) {
+		s.writeBadRequest(res, `"status" query param can either be "pending" or "completed"`)
+		return
+	}
+
+	workspaceID := chi.URLParam(req, "workspaceID")
+	tasks, err := s.taskDB.WorkspaceTasks(workspaceID, completedFilter(status))
+	if err != nil {
+		s.writeServerError(res, fmt.Errorf("taskDB.WorkspaceTasks error: %w", err))
+		return
+	}
+
+	s.writeSuccess(res, map[string]any{
+		"tasks": tasks,
+	})
+}
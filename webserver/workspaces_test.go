@@ -0,0 +1,108 @@
+package webserver
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ukane-philemon/megtask/db"
+)
+
+// workspaceDB is a TaskDatabase with the tasks in taskWorkspaces, which maps
+// task IDs to their workspace, and the workspace roles in roles, which maps
+// workspace IDs to the roles of their members.
+type workspaceDB struct {
+	authDB
+	taskWorkspaces map[string]string
+	roles          map[string]map[string]string
+}
+
+func (wdb workspaceDB) TaskWorkspaceID(taskID string) (string, error) {
+	workspaceID, ok := wdb.taskWorkspaces[taskID]
+	if !ok {
+		return "", db.ErrorInvalidRequest
+	}
+	return workspaceID, nil
+}
+
+func (wdb workspaceDB) WorkspaceRole(workspaceID, userID string) (string, error) {
+	role, ok := wdb.roles[workspaceID][userID]
+	if !ok {
+		return "", db.ErrorInvalidRequest
+	}
+	return role, nil
+}
+
+func (workspaceDB) UpdateTask(userID, taskID string, taskUpdate *db.TaskUpdate) ([]*db.Task, error) {
+	return nil, nil
+}
+
+func (workspaceDB) TaskAudience(taskID string) ([]string, error) {
+	return nil, nil
+}
+
+func (workspaceDB) AddComment(userID, taskID, parentID, body string) (*db.Comment, error) {
+	return &db.Comment{ID: "comment"}, nil
+}
+
+func (workspaceDB) Comments(userID, taskID string) ([]*db.Comment, error) {
+	return nil, nil
+}
+
+func TestWorkspaceTaskRoutes(t *testing.T) {
+	wdb := workspaceDB{
+		authDB: authDB{roles: map[string]string{"member": db.RoleUser, "viewer": db.RoleUser}},
+		taskWorkspaces: map[string]string{
+			"taskA":    "A",
+			"taskB":    "B",
+			"personal": "",
+		},
+		roles: map[string]map[string]string{
+			"A": {"member": db.WorkspaceRoleMember, "viewer": db.WorkspaceRoleViewer},
+			"B": {"viewer": db.WorkspaceRoleViewer},
+		},
+	}
+	s := newTestServer(t, wdb, nil)
+
+	tests := []struct {
+		name       string
+		userID     string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{"member updates a task in the workspace", "member", http.MethodPatch, "/workspaces/A/task/taskA", http.StatusOK},
+		{"task in another workspace", "member", http.MethodPatch, "/workspaces/A/task/taskB", http.StatusNotFound},
+		{"personal task through a workspace", "member", http.MethodPatch, "/workspaces/A/task/personal", http.StatusNotFound},
+		{"missing task", "member", http.MethodPatch, "/workspaces/A/task/missing", http.StatusNotFound},
+		{"viewer of the task's workspace through another workspace", "viewer", http.MethodPatch, "/workspaces/B/task/taskA", http.StatusNotFound},
+		{"viewer updates a task", "viewer", http.MethodPatch, "/workspaces/A/task/taskA", http.StatusForbidden},
+		{"workspace task through task routes", "member", http.MethodPatch, "/task/taskA", http.StatusNotFound},
+		{"personal task through task routes", "member", http.MethodPatch, "/task/personal", http.StatusOK},
+		{"workspace task assigned through task routes", "member", http.MethodPatch, "/task/taskA/assign", http.StatusNotFound},
+		{"history of a task in another workspace", "viewer", http.MethodGet, "/workspaces/B/task/taskA/history", http.StatusNotFound},
+		{"member comments on a task in the workspace", "member", http.MethodPost, "/workspaces/A/task/taskA/comments", http.StatusOK},
+		{"comment on a task in another workspace", "member", http.MethodPost, "/workspaces/A/task/taskB/comments", http.StatusNotFound},
+		{"viewer reads comments", "viewer", http.MethodGet, "/workspaces/A/task/taskA/comments", http.StatusOK},
+		{"viewer comments", "viewer", http.MethodPost, "/workspaces/A/task/taskA/comments", http.StatusForbidden},
+		{"viewer edits a comment", "viewer", http.MethodPatch, "/workspaces/A/task/taskA/comments/comment", http.StatusForbidden},
+		{"viewer deletes a comment", "viewer", http.MethodDelete, "/workspaces/A/task/taskA/comments/comment", http.StatusForbidden},
+		{"workspace task comments through task routes", "member", http.MethodPost, "/task/taskA/comments", http.StatusNotFound},
+		{"personal task comments through task routes", "member", http.MethodPost, "/task/personal/comments", http.StatusOK},
+		{"viewer creates a reminder", "viewer", http.MethodPost, "/workspaces/A/task/taskA/reminders", http.StatusForbidden},
+		{"viewer deletes a reminder", "viewer", http.MethodDelete, "/workspaces/A/task/taskA/reminders/reminder", http.StatusForbidden},
+		{"workspace task reminders through task routes", "member", http.MethodGet, "/task/taskA/reminders", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token, err := s.jwtManager.GenerateJWtToken(test.userID, db.RoleUser, "session", time.Minute)
+			if err != nil {
+				t.Fatalf("GenerateJWtToken error: %v", err)
+			}
+
+			res := testRequest(t, s, test.method, test.path, token, map[string]string{"taskDetail": "detail", "body": "comment"})
+			checkStatus(t, res, test.wantStatus)
+		})
+	}
+}